@@ -0,0 +1,8 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package v1
+
+// Hub marks v1, the storage version, as the version the other versions of the
+// SecretProviderClass are converted to and from
+func (*SecretProviderClass) Hub() {}
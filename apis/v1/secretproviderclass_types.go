@@ -0,0 +1,471 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package v1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Provider enum for all the provider names
+type Provider string
+
+const (
+	// Azure provider for Azure Key Vault
+	Azure Provider = "Azure"
+	// Vault provider for Hashicorp Vault
+	Vault Provider = "Vault"
+)
+
+// The annotations and labels of the driver, e.g. RotationAnnotation, are
+// defined in the v1alpha1 package and used with both versions.
+
+// ConflictPolicy defines how a synced secret that already exists and isn't
+// managed by the driver is synced
+type ConflictPolicy string
+
+const (
+	// ConflictPolicyAdopt takes ownership of the secret and replaces its data
+	// with the synced data
+	ConflictPolicyAdopt ConflictPolicy = "Adopt"
+	// ConflictPolicyFail doesn't sync the secret
+	ConflictPolicyFail ConflictPolicy = "Fail"
+	// ConflictPolicyMerge sets the synced keys on the secret and keeps the
+	// other keys, without taking ownership of the secret
+	ConflictPolicyMerge ConflictPolicy = "Merge"
+)
+
+// RestartPolicy defines how the pods are restarted after the contents of their
+// volumes are rotated, for applications that only read the contents at startup
+type RestartPolicy string
+
+const (
+	// RestartPolicyNone doesn't restart the pods
+	RestartPolicyNone RestartPolicy = "None"
+	// RestartPolicyAnnotate sets the RotatedAtAnnotation on the pods, e.g. for
+	// a controller that restarts the workloads of the annotated pods
+	RestartPolicyAnnotate RestartPolicy = "Annotate"
+	// RestartPolicyEvict evicts the pods with the eviction API, so the pod
+	// disruption budgets of the workloads are respected
+	RestartPolicyEvict RestartPolicy = "Evict"
+)
+
+// ObjectEncoding is the encoding of the contents of a mounted object
+type ObjectEncoding string
+
+const (
+	// ObjectEncodingUTF8 writes the contents as is
+	ObjectEncodingUTF8 ObjectEncoding = "utf-8"
+	// ObjectEncodingBase64 decodes the base64 contents
+	ObjectEncodingBase64 ObjectEncoding = "base64"
+	// ObjectEncodingHex decodes the hex contents
+	ObjectEncodingHex ObjectEncoding = "hex"
+)
+
+// ObjectFormat is the format a mounted object is converted to
+type ObjectFormat string
+
+const (
+	// ObjectFormatJSON converts the JSON or YAML contents to JSON
+	ObjectFormatJSON ObjectFormat = "json"
+	// ObjectFormatYAML converts the JSON or YAML contents to YAML
+	ObjectFormatYAML ObjectFormat = "yaml"
+	// ObjectFormatSplitKeys writes every key of the JSON or YAML object to its
+	// own file in the directory of the file name
+	ObjectFormatSplitKeys ObjectFormat = "splitKeys"
+	// ObjectFormatSplitPEM writes the private key, the certificate and the CA
+	// chain of the PEM bundle to tls.key, tls.crt and ca.crt in the directory
+	// of the file name
+	ObjectFormatSplitPEM ObjectFormat = "splitPEM"
+)
+
+// OutputFileFormat is the format of a file rendered from the mounted objects
+type OutputFileFormat string
+
+const (
+	// OutputFileFormatDotenv renders the objects as KEY=value lines, e.g. for
+	// the env file loaders of the applications
+	OutputFileFormatDotenv OutputFileFormat = "dotenv"
+	// OutputFileFormatPKCS12 bundles the PEM private key and certificates of
+	// the objects into a PKCS#12 keystore, e.g. for JVM workloads
+	OutputFileFormatPKCS12 OutputFileFormat = "pkcs12"
+	// OutputFileFormatJKS bundles the PEM private key and certificates of the
+	// objects into a Java keystore
+	OutputFileFormatJKS OutputFileFormat = "jks"
+	// OutputFileFormatTemplate renders the Go template of the output file,
+	// e.g. a properties file interpolating several objects
+	OutputFileFormatTemplate OutputFileFormat = "template"
+)
+
+// NOTE: json tags are required.  Any new fields you add must have json tags for the fields to be serialized.
+
+// SecretObjectData defines the desired state of synced K8s secret object data
+type SecretObjectData struct {
+	// name of the object to sync
+	ObjectName string `json:"objectName,omitempty"`
+	// data field to populate
+	Key string `json:"key,omitempty"`
+	// Go template of the data field, rendered instead of syncing the content of
+	// objectName. The contents of the objects are referenced by object name with
+	// the object function, e.g. {{ object "username" }}
+	Template string `json:"template,omitempty"`
+}
+
+// SecretObject defines the desired state of synced K8s secret objects
+type SecretObject struct {
+	// name of the K8s secret object
+	SecretName string `json:"secretName,omitempty"`
+	// namespace of the K8s secret object, defaults to the namespace of the pod.
+	// Syncing into another namespace requires the namespace to be allowed by
+	// the driver and the AllowSyncFromAnnotation of the namespace.
+	Namespace string `json:"namespace,omitempty"`
+	// type of K8s secret object
+	Type string `json:"type,omitempty"`
+	// labels of K8s secret object
+	Labels map[string]string `json:"labels,omitempty"`
+	// annotations of K8s secret object
+	Annotations map[string]string `json:"annotations,omitempty"`
+	// data fields of K8s secret object
+	// +kubebuilder:validation:MaxItems=256
+	Data []*SecretObjectData `json:"data,omitempty"`
+	// ConflictPolicy defines how the K8s secret object is synced if it already
+	// exists and isn't managed by the driver, defaults to Adopt
+	// +kubebuilder:validation:Enum=Adopt;Fail;Merge
+	ConflictPolicy ConflictPolicy `json:"conflictPolicy,omitempty"`
+}
+
+// ConfigMapObject defines the desired state of synced K8s configmap objects
+type ConfigMapObject struct {
+	// name of the K8s configmap object
+	// +kubebuilder:validation:MinLength=1
+	ConfigMapName string `json:"configMapName"`
+	// labels of K8s configmap object
+	Labels map[string]string `json:"labels,omitempty"`
+	// annotations of K8s configmap object
+	Annotations map[string]string `json:"annotations,omitempty"`
+	// data fields of K8s configmap object
+	// +kubebuilder:validation:MinItems=1
+	Data []*SecretObjectData `json:"data"`
+}
+
+// RetryPolicy defines the retries of provider calls that fail with a retryable error
+type RetryPolicy struct {
+	// maximum number of attempts of a provider call, including the first attempt
+	// +kubebuilder:validation:Minimum=1
+	MaxAttempts *int32 `json:"maxAttempts,omitempty"`
+	// backoff before the first retry, doubled for every retry
+	InitialBackoff *metav1.Duration `json:"initialBackoff,omitempty"`
+	// maximum backoff between retries
+	MaxBackoff *metav1.Duration `json:"maxBackoff,omitempty"`
+}
+
+// FallbackProvider defines the provider that is used if mounting the contents
+// from the primary provider fails
+type FallbackProvider struct {
+	// name of the fallback provider, defaults to the provider of the SecretProviderClass
+	Provider Provider `json:"provider,omitempty"`
+	// configuration for the fallback provider, e.g. the address of a replicated secrets store
+	Parameters map[string]string `json:"parameters,omitempty"`
+}
+
+// RotationWindow defines a recurring window for the rotation of the volumes
+type RotationWindow struct {
+	// cron schedule of the start of the window in UTC, in the standard five
+	// field format, e.g. "0 2 * * 6" for every Saturday at 02:00
+	// +kubebuilder:validation:MinLength=1
+	Schedule string `json:"schedule"`
+	// duration of the window, e.g. 4h
+	Duration metav1.Duration `json:"duration"`
+}
+
+// AdditionalProvider defines a provider whose contents are mounted into the
+// same volume as the provider of the SecretProviderClass
+type AdditionalProvider struct {
+	// name of the provider
+	Provider Provider `json:"provider"`
+	// configuration for the provider
+	Parameters map[string]string `json:"parameters,omitempty"`
+}
+
+// MountedObject defines how an object mounted by the provider is written to
+// the volume
+type MountedObject struct {
+	// path of the file of the object mounted by the provider, relative to the
+	// volume, e.g. projects/123/secrets/db-password/versions/latest
+	// +kubebuilder:validation:MinLength=1
+	ObjectName string `json:"objectName"`
+	// path the file of the object is renamed to, relative to the volume, e.g.
+	// db-password. The file isn't renamed if not set.
+	FileName string `json:"fileName,omitempty"`
+	// octal permission of the file of the object, e.g. 0400 for a private key,
+	// overriding the permission of the file mounted by the provider
+	// +kubebuilder:validation:Pattern=`^0?[0-7]{3}$`
+	FilePermission string `json:"filePermission,omitempty"`
+	// encoding of the contents of the object mounted by the provider. The
+	// base64 and hex contents are decoded and the file is written with the
+	// decoded bytes, e.g. for keystores. Defaults to utf-8, the contents are
+	// written as is.
+	// +kubebuilder:validation:Enum=utf-8;base64;hex
+	Encoding ObjectEncoding `json:"encoding,omitempty"`
+	// format the decoded contents of the object are converted to. The json
+	// and yaml formats rewrite the file of the object, the splitKeys and
+	// splitPEM formats replace it by a directory with a file for every key of
+	// the object or every part of the PEM bundle, e.g. db/username and
+	// db/password for a JSON secret. The contents are written as is if not
+	// set.
+	// +kubebuilder:validation:Enum=json;yaml;splitKeys;splitPEM
+	Format ObjectFormat `json:"format,omitempty"`
+	// number of previous versions of the object kept in the volume next to
+	// the file of the object, under the file name with the suffix .1 for the
+	// previous version, .2 for the version before it and so on, e.g. to
+	// validate tokens signed with the previous key during a key rollover.
+	// The previous versions aren't kept if not set.
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=10
+	ObjectVersionHistory int32 `json:"objectVersionHistory,omitempty"`
+}
+
+// OutputFileObject defines a mounted object rendered into an output file
+type OutputFileObject struct {
+	// path of the file of the mounted object relative to the volume, after
+	// it's renamed by the mounted objects
+	// +kubebuilder:validation:MinLength=1
+	ObjectName string `json:"objectName"`
+	// key of the object in the output file, e.g. the name of the environment
+	// variable in a dotenv file. The keystore formats don't use keys.
+	// +kubebuilder:validation:MinLength=1
+	Key string `json:"key,omitempty"`
+}
+
+// OutputFile defines a file rendered into the volume from the contents of
+// mounted objects
+type OutputFile struct {
+	// path of the output file relative to the volume, e.g. app.env
+	// +kubebuilder:validation:MinLength=1
+	FileName string `json:"fileName"`
+	// format of the output file
+	// +kubebuilder:validation:Enum=dotenv;pkcs12;jks;template
+	Format OutputFileFormat `json:"format"`
+	// octal permission of the output file, defaults to 0644
+	// +kubebuilder:validation:Pattern=`^0?[0-7]{3}$`
+	FilePermission string `json:"filePermission,omitempty"`
+	// objects rendered into the output file, in order, required by the
+	// dotenv and keystore formats
+	// +kubebuilder:validation:MinItems=1
+	Objects []*OutputFileObject `json:"objects,omitempty"`
+	// Go template of the output file of the template format. The contents of
+	// the mounted objects are referenced with the object function, e.g.
+	// {{ object "db-password" }}.
+	Template string `json:"template,omitempty"`
+	// path of the file of the mounted object with the passphrase of the
+	// keystore relative to the volume, required by the keystore formats
+	PassphraseObjectName string `json:"passphraseObjectName,omitempty"`
+	// alias of the private key entry in the keystore, defaults to tls
+	Alias string `json:"alias,omitempty"`
+}
+
+// SecretProviderClassDefaults defines the defaults that apply to all the
+// objects of a SecretProviderClass
+type SecretProviderClassDefaults struct {
+	// minimum interval between the rotations of the volumes of the class, e.g.
+	// to call a rate limited secrets store less often. The volumes are rotated
+	// at most every rotation poll interval of the driver, and every poll
+	// interval if not set.
+	RotationInterval *metav1.Duration `json:"rotationInterval,omitempty"`
+	// octal permission of the files of the mounted objects that don't set
+	// their file permission
+	// +kubebuilder:validation:Pattern=`^0?[0-7]{3}$`
+	FilePermission string `json:"filePermission,omitempty"`
+	// encoding of the contents of the mounted objects that don't set their
+	// encoding
+	// +kubebuilder:validation:Enum=utf-8;base64;hex
+	Encoding ObjectEncoding `json:"encoding,omitempty"`
+	// labels added to the K8s secret and configmap objects synced from the
+	// mounted contents. The labels of a secret or configmap object override
+	// the labels with the same key.
+	SyncLabels map[string]string `json:"syncLabels,omitempty"`
+}
+
+// FileOwner defines the owner of the mounted files
+type FileOwner struct {
+	// user id that owns the mounted files. The files are owned by the user of
+	// the driver if not set.
+	// +kubebuilder:validation:Minimum=0
+	UID *int64 `json:"uid,omitempty"`
+	// group id that owns the mounted files, the files are readable by the
+	// group. Overrides the fsGroup of the pod.
+	// +kubebuilder:validation:Minimum=0
+	GID *int64 `json:"gid,omitempty"`
+}
+
+// The rules of the driver are validated when the class is applied instead of
+// when a pod mounts it. An update of a class that already broke a rule isn't
+// rejected for that rule, so the existing invalid classes can still be updated,
+// e.g. to remove their finalizers.
+// +kubebuilder:validation:XValidation:rule="(has(self.provider) && size(self.provider) > 0) || (has(self.extends) && size(self.extends) > 0) || (oldSelf.hasValue() && !((has(oldSelf.value().provider) && size(oldSelf.value().provider) > 0) || (has(oldSelf.value().extends) && size(oldSelf.value().extends) > 0)))",message="provider is required unless the class extends a base class",optionalOldSelf=true
+// +kubebuilder:validation:XValidation:rule="!has(self.secretObjects) || self.secretObjects.all(o, has(o.secretName) && size(o.secretName) > 0 && has(o.type) && size(o.type) > 0) || (oldSelf.hasValue() && has(oldSelf.value().secretObjects) && !oldSelf.value().secretObjects.all(o, has(o.secretName) && size(o.secretName) > 0 && has(o.type) && size(o.type) > 0))",message="secretObjects require a secretName and a type",optionalOldSelf=true
+// +kubebuilder:validation:XValidation:rule="!has(self.secretObjects) || self.secretObjects.all(o, has(o.data) && size(o.data) > 0) || (oldSelf.hasValue() && has(oldSelf.value().secretObjects) && !oldSelf.value().secretObjects.all(o, has(o.data) && size(o.data) > 0))",message="secretObjects require at least 1 data entry",optionalOldSelf=true
+// +kubebuilder:validation:XValidation:rule="!has(self.secretObjects) || self.secretObjects.all(o, !has(o.data) || o.data.all(d, has(d.key) && size(d.key) > 0)) || (oldSelf.hasValue() && has(oldSelf.value().secretObjects) && !oldSelf.value().secretObjects.all(o, !has(o.data) || o.data.all(d, has(d.key) && size(d.key) > 0)))",message="the data entries of secretObjects require a key",optionalOldSelf=true
+
+// SecretProviderClassSpec defines the desired state of SecretProviderClass
+type SecretProviderClassSpec struct {
+	// Configuration for provider name
+	Provider Provider `json:"provider,omitempty"`
+	// Configuration for specific provider
+	Parameters map[string]string `json:"parameters,omitempty"`
+	// SecretObjects are the K8s secrets synced from the mounted contents
+	// +kubebuilder:validation:MaxItems=256
+	SecretObjects []*SecretObject `json:"secretObjects,omitempty"`
+	// ConfigMapObjects are the K8s configmaps synced from the mounted contents
+	// that aren't sensitive, e.g. configuration
+	ConfigMapObjects []*ConfigMapObject `json:"configMapObjects,omitempty"`
+	// CacheTTL is the duration the mounted contents are reused for mount requests
+	// from pods with the same namespace, service account and parameters instead of
+	// calling the provider again. The cache is disabled if not set.
+	CacheTTL *metav1.Duration `json:"cacheTTL,omitempty"`
+	// SharedFetch fetches the contents once for the pods of a node that mount
+	// the class at the same time with the same namespace, service account and
+	// parameters, and writes them to the volume of each pod, instead of calling
+	// the providers for every pod, e.g. for the replicas of a deployment
+	SharedFetch bool `json:"sharedFetch,omitempty"`
+	// RetryPolicy overrides the driver retry policy for the provider calls
+	RetryPolicy *RetryPolicy `json:"retryPolicy,omitempty"`
+	// ProviderTimeout overrides the driver timeout for fetching the contents
+	// from the provider, including retries
+	ProviderTimeout *metav1.Duration `json:"providerTimeout,omitempty"`
+	// Fallback is the provider that is used if the provider is unhealthy or
+	// fails to mount the contents
+	Fallback *FallbackProvider `json:"fallback,omitempty"`
+	// AdditionalProviders are mounted into the same volume after the provider.
+	// The mount fails if more than one provider mounts a file with the same path.
+	AdditionalProviders []*AdditionalProvider `json:"additionalProviders,omitempty"`
+	// RestartPolicy restarts the pods after the mounted contents of their
+	// volumes changed during rotation. Defaults to None.
+	// +kubebuilder:validation:Enum=None;Annotate;Evict
+	RestartPolicy RestartPolicy `json:"restartPolicy,omitempty"`
+	// RotationWindows are the windows during which the volumes are rotated.
+	// The volumes are rotated at any time if empty.
+	RotationWindows []RotationWindow `json:"rotationWindows,omitempty"`
+	// RotationBlackouts are the windows during which the volumes aren't
+	// rotated, even during a rotation window
+	RotationBlackouts []RotationWindow `json:"rotationBlackouts,omitempty"`
+	// Extends is the name of the base class in the same namespace whose spec
+	// is merged into this spec. Parameters are merged by key, secret objects
+	// by secretName and namespace, configmap objects by configMapName,
+	// mounted objects by objectName and defaults by field, the other fields
+	// of this spec replace the fields of the base class if set.
+	Extends string `json:"extends,omitempty"`
+	// MountedObjects are the objects of the mounted contents whose files are
+	// renamed in the volume, e.g. to mount an object with a provider-specific
+	// path under a short file name
+	MountedObjects []*MountedObject `json:"mountedObjects,omitempty"`
+	// AllowedNamespaces are the namespaces of the pods that are allowed to
+	// mount the class, e.g. to restrict a ClusterSecretProviderClass to a few
+	// namespaces. Pods in all namespaces are allowed if empty.
+	AllowedNamespaces []string `json:"allowedNamespaces,omitempty"`
+	// PodSelector selects the pods that are allowed to mount the class by
+	// their labels, so a sensitive class can only be mounted by specific
+	// workloads. All pods are allowed if not set.
+	PodSelector *metav1.LabelSelector `json:"podSelector,omitempty"`
+	// Defaults apply to the mounted objects, secret objects and configmap
+	// objects of the class and to the rotation of its volumes, so the settings
+	// shared by the objects don't have to be repeated for every object
+	Defaults *SecretProviderClassDefaults `json:"defaults,omitempty"`
+	// SecretObjectsOwner is the owner of the files of the mounted objects, so
+	// containers that don't run as root can read the files without making
+	// them readable by all users
+	SecretObjectsOwner *FileOwner `json:"secretObjectsOwner,omitempty"`
+	// OutputFiles are rendered into the volume from the contents of the
+	// mounted objects on every mount and rotation, e.g. an env file
+	// combining the objects of several providers
+	OutputFiles []*OutputFile `json:"outputFiles,omitempty"`
+	// WriteChecksums writes a ..checksums.json file with the SHA-256 digests
+	// of the mounted files into the volume on every mount and rotation, so
+	// applications and audit tooling can verify the integrity of the files
+	WriteChecksums bool `json:"writeChecksums,omitempty"`
+	// WriteMetadata writes a ..metadata.json file with the ids and versions
+	// of the mounted objects and the time they were fetched into the volume on
+	// every mount and rotation, so tooling can check which versions a pod is
+	// running with
+	WriteMetadata bool `json:"writeMetadata,omitempty"`
+}
+
+// ByPodStatus defines the state of SecretProviderClass as seen by
+// an individual controller
+type ByPodStatus struct {
+	// id of the pod that wrote the status
+	ID string `json:"id,omitempty"`
+	// namespace of the pod that wrote the status
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// SecretProviderClassConditionType is the type of a SecretProviderClass condition
+type SecretProviderClassConditionType string
+
+const (
+	// SecretSynced is true if the secret objects of the SecretProviderClass
+	// were synced into k8s secrets
+	SecretSynced SecretProviderClassConditionType = "SecretSynced"
+	// ProviderReachable is true if the provider of the SecretProviderClass
+	// was reachable in the last mount that called the provider
+	ProviderReachable SecretProviderClassConditionType = "ProviderReachable"
+	// InUseByPods is true if the SecretProviderClass is mounted by pods
+	InUseByPods SecretProviderClassConditionType = "InUseByPods"
+	// LastMountError is true if the last mount of the SecretProviderClass
+	// failed, with the error in the message
+	LastMountError SecretProviderClassConditionType = "LastMountError"
+)
+
+// SecretProviderClassCondition describes the state of a SecretProviderClass at a certain point
+type SecretProviderClassCondition struct {
+	// type of the condition
+	Type SecretProviderClassConditionType `json:"type"`
+	// status of the condition, one of True, False or Unknown
+	Status corev1.ConditionStatus `json:"status"`
+	// last time the condition was updated, e.g. the synced secrets were updated
+	LastUpdateTime metav1.Time `json:"lastUpdateTime,omitempty"`
+	// last time the condition transitioned from one status to another
+	LastTransitionTime metav1.Time `json:"lastTransitionTime,omitempty"`
+	// reason for the last transition
+	Reason string `json:"reason,omitempty"`
+	// human readable message with details about the last transition
+	Message string `json:"message,omitempty"`
+}
+
+// SecretProviderClassStatus defines the observed state of SecretProviderClass
+type SecretProviderClassStatus struct {
+	ByPod []*ByPodStatus `json:"byPod,omitempty"`
+	// conditions of the SecretProviderClass
+	Conditions []SecretProviderClassCondition `json:"conditions,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:resource:shortName=spc
+// +kubebuilder:printcolumn:name="Provider",type="string",JSONPath=".spec.provider"
+// +kubebuilder:printcolumn:name="Synced",type="string",JSONPath=`.status.conditions[?(@.type=="SecretSynced")].status`
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+// +kubebuilder:storageversion
+
+// SecretProviderClass is the Schema for the secretproviderclasses API
+type SecretProviderClass struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   SecretProviderClassSpec   `json:"spec,omitempty"`
+	Status SecretProviderClassStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// SecretProviderClassList contains a list of SecretProviderClass
+type SecretProviderClassList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []SecretProviderClass `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&SecretProviderClass{}, &SecretProviderClassList{})
+}
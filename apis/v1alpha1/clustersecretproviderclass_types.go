@@ -0,0 +1,46 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ClusterSecretProviderClassKind is the secret provider class kind of the
+// spc pod statuses of pods that mount a ClusterSecretProviderClass
+const ClusterSecretProviderClassKind = "ClusterSecretProviderClass"
+
+// ClusterSecretProviderClassSpec defines the desired state of ClusterSecretProviderClass
+type ClusterSecretProviderClassSpec struct {
+	SecretProviderClassSpec `json:",inline"`
+	// namespaces of the pods that can mount the ClusterSecretProviderClass.
+	// An empty selector selects all namespaces.
+	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:scope=Cluster,shortName=cspc
+// +kubebuilder:printcolumn:name="Provider",type="string",JSONPath=".spec.provider"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+
+// ClusterSecretProviderClass is the Schema for the clustersecretproviderclasses API
+type ClusterSecretProviderClass struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec ClusterSecretProviderClassSpec `json:"spec,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// ClusterSecretProviderClassList contains a list of ClusterSecretProviderClass
+type ClusterSecretProviderClassList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ClusterSecretProviderClass `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&ClusterSecretProviderClass{}, &ClusterSecretProviderClassList{})
+}
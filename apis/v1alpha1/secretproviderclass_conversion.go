@@ -0,0 +1,306 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package v1alpha1
+
+import (
+	"fmt"
+
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+
+	v1 "sigs.k8s.io/secrets-store-csi-driver/apis/v1"
+)
+
+// ConvertTo converts the SecretProviderClass to the v1 hub version
+func (src *SecretProviderClass) ConvertTo(dstRaw conversion.Hub) error {
+	dst, ok := dstRaw.(*v1.SecretProviderClass)
+	if !ok {
+		return fmt.Errorf("unsupported conversion hub %T", dstRaw)
+	}
+	in := src.DeepCopy()
+	dst.ObjectMeta = in.ObjectMeta
+	dst.Spec = convertSpecToV1(&in.Spec)
+	dst.Status = convertStatusToV1(&in.Status)
+	return nil
+}
+
+// ConvertFrom converts the v1 hub version to the SecretProviderClass
+func (dst *SecretProviderClass) ConvertFrom(srcRaw conversion.Hub) error {
+	src, ok := srcRaw.(*v1.SecretProviderClass)
+	if !ok {
+		return fmt.Errorf("unsupported conversion hub %T", srcRaw)
+	}
+	in := src.DeepCopy()
+	dst.ObjectMeta = in.ObjectMeta
+	dst.Spec = convertSpecFromV1(&in.Spec)
+	dst.Status = convertStatusFromV1(&in.Status)
+	return nil
+}
+
+func convertSpecToV1(in *SecretProviderClassSpec) v1.SecretProviderClassSpec {
+	out := v1.SecretProviderClassSpec{
+		Provider:           v1.Provider(in.Provider),
+		Parameters:         in.Parameters,
+		CacheTTL:           in.CacheTTL,
+		SharedFetch:        in.SharedFetch,
+		RetryPolicy:        (*v1.RetryPolicy)(in.RetryPolicy),
+		ProviderTimeout:    in.ProviderTimeout,
+		RestartPolicy:      v1.RestartPolicy(in.RestartPolicy),
+		Extends:            in.Extends,
+		AllowedNamespaces:  in.AllowedNamespaces,
+		PodSelector:        in.PodSelector,
+		SecretObjectsOwner: (*v1.FileOwner)(in.SecretObjectsOwner),
+		WriteChecksums:     in.WriteChecksums,
+		WriteMetadata:      in.WriteMetadata,
+	}
+	if in.Defaults != nil {
+		out.Defaults = &v1.SecretProviderClassDefaults{
+			RotationInterval: in.Defaults.RotationInterval,
+			FilePermission:   in.Defaults.FilePermission,
+			Encoding:         v1.ObjectEncoding(in.Defaults.Encoding),
+			SyncLabels:       in.Defaults.SyncLabels,
+		}
+	}
+	for _, secretObj := range in.SecretObjects {
+		if secretObj == nil {
+			out.SecretObjects = append(out.SecretObjects, nil)
+			continue
+		}
+		out.SecretObjects = append(out.SecretObjects, &v1.SecretObject{
+			SecretName:     secretObj.SecretName,
+			Namespace:      secretObj.Namespace,
+			Type:           secretObj.Type,
+			Labels:         secretObj.Labels,
+			Annotations:    secretObj.Annotations,
+			Data:           convertObjectDataToV1(secretObj.Data),
+			ConflictPolicy: v1.ConflictPolicy(secretObj.ConflictPolicy),
+		})
+	}
+	for _, configMapObj := range in.ConfigMapObjects {
+		if configMapObj == nil {
+			out.ConfigMapObjects = append(out.ConfigMapObjects, nil)
+			continue
+		}
+		out.ConfigMapObjects = append(out.ConfigMapObjects, &v1.ConfigMapObject{
+			ConfigMapName: configMapObj.ConfigMapName,
+			Labels:        configMapObj.Labels,
+			Annotations:   configMapObj.Annotations,
+			Data:          convertObjectDataToV1(configMapObj.Data),
+		})
+	}
+	if in.Fallback != nil {
+		out.Fallback = &v1.FallbackProvider{
+			Provider:   v1.Provider(in.Fallback.Provider),
+			Parameters: in.Fallback.Parameters,
+		}
+	}
+	for _, additionalProvider := range in.AdditionalProviders {
+		if additionalProvider == nil {
+			out.AdditionalProviders = append(out.AdditionalProviders, nil)
+			continue
+		}
+		out.AdditionalProviders = append(out.AdditionalProviders, &v1.AdditionalProvider{
+			Provider:   v1.Provider(additionalProvider.Provider),
+			Parameters: additionalProvider.Parameters,
+		})
+	}
+	for _, window := range in.RotationWindows {
+		out.RotationWindows = append(out.RotationWindows, v1.RotationWindow(window))
+	}
+	for _, window := range in.RotationBlackouts {
+		out.RotationBlackouts = append(out.RotationBlackouts, v1.RotationWindow(window))
+	}
+	for _, mountedObj := range in.MountedObjects {
+		if mountedObj == nil {
+			out.MountedObjects = append(out.MountedObjects, nil)
+			continue
+		}
+		out.MountedObjects = append(out.MountedObjects, &v1.MountedObject{
+			ObjectName:           mountedObj.ObjectName,
+			FileName:             mountedObj.FileName,
+			FilePermission:       mountedObj.FilePermission,
+			Encoding:             v1.ObjectEncoding(mountedObj.Encoding),
+			Format:               v1.ObjectFormat(mountedObj.Format),
+			ObjectVersionHistory: mountedObj.ObjectVersionHistory,
+		})
+	}
+	for _, outputFile := range in.OutputFiles {
+		if outputFile == nil {
+			out.OutputFiles = append(out.OutputFiles, nil)
+			continue
+		}
+		converted := &v1.OutputFile{
+			FileName:             outputFile.FileName,
+			Format:               v1.OutputFileFormat(outputFile.Format),
+			FilePermission:       outputFile.FilePermission,
+			PassphraseObjectName: outputFile.PassphraseObjectName,
+			Alias:                outputFile.Alias,
+			Template:             outputFile.Template,
+		}
+		for _, obj := range outputFile.Objects {
+			converted.Objects = append(converted.Objects, (*v1.OutputFileObject)(obj))
+		}
+		out.OutputFiles = append(out.OutputFiles, converted)
+	}
+	return out
+}
+
+func convertSpecFromV1(in *v1.SecretProviderClassSpec) SecretProviderClassSpec {
+	out := SecretProviderClassSpec{
+		Provider:           Provider(in.Provider),
+		Parameters:         in.Parameters,
+		CacheTTL:           in.CacheTTL,
+		SharedFetch:        in.SharedFetch,
+		RetryPolicy:        (*RetryPolicy)(in.RetryPolicy),
+		ProviderTimeout:    in.ProviderTimeout,
+		RestartPolicy:      RestartPolicy(in.RestartPolicy),
+		Extends:            in.Extends,
+		AllowedNamespaces:  in.AllowedNamespaces,
+		PodSelector:        in.PodSelector,
+		SecretObjectsOwner: (*FileOwner)(in.SecretObjectsOwner),
+		WriteChecksums:     in.WriteChecksums,
+		WriteMetadata:      in.WriteMetadata,
+	}
+	if in.Defaults != nil {
+		out.Defaults = &SecretProviderClassDefaults{
+			RotationInterval: in.Defaults.RotationInterval,
+			FilePermission:   in.Defaults.FilePermission,
+			Encoding:         ObjectEncoding(in.Defaults.Encoding),
+			SyncLabels:       in.Defaults.SyncLabels,
+		}
+	}
+	for _, secretObj := range in.SecretObjects {
+		if secretObj == nil {
+			out.SecretObjects = append(out.SecretObjects, nil)
+			continue
+		}
+		out.SecretObjects = append(out.SecretObjects, &SecretObject{
+			SecretName:     secretObj.SecretName,
+			Namespace:      secretObj.Namespace,
+			Type:           secretObj.Type,
+			Labels:         secretObj.Labels,
+			Annotations:    secretObj.Annotations,
+			Data:           convertObjectDataFromV1(secretObj.Data),
+			ConflictPolicy: ConflictPolicy(secretObj.ConflictPolicy),
+		})
+	}
+	for _, configMapObj := range in.ConfigMapObjects {
+		if configMapObj == nil {
+			out.ConfigMapObjects = append(out.ConfigMapObjects, nil)
+			continue
+		}
+		out.ConfigMapObjects = append(out.ConfigMapObjects, &ConfigMapObject{
+			ConfigMapName: configMapObj.ConfigMapName,
+			Labels:        configMapObj.Labels,
+			Annotations:   configMapObj.Annotations,
+			Data:          convertObjectDataFromV1(configMapObj.Data),
+		})
+	}
+	if in.Fallback != nil {
+		out.Fallback = &FallbackProvider{
+			Provider:   Provider(in.Fallback.Provider),
+			Parameters: in.Fallback.Parameters,
+		}
+	}
+	for _, additionalProvider := range in.AdditionalProviders {
+		if additionalProvider == nil {
+			out.AdditionalProviders = append(out.AdditionalProviders, nil)
+			continue
+		}
+		out.AdditionalProviders = append(out.AdditionalProviders, &AdditionalProvider{
+			Provider:   Provider(additionalProvider.Provider),
+			Parameters: additionalProvider.Parameters,
+		})
+	}
+	for _, window := range in.RotationWindows {
+		out.RotationWindows = append(out.RotationWindows, RotationWindow(window))
+	}
+	for _, window := range in.RotationBlackouts {
+		out.RotationBlackouts = append(out.RotationBlackouts, RotationWindow(window))
+	}
+	for _, mountedObj := range in.MountedObjects {
+		if mountedObj == nil {
+			out.MountedObjects = append(out.MountedObjects, nil)
+			continue
+		}
+		out.MountedObjects = append(out.MountedObjects, &MountedObject{
+			ObjectName:           mountedObj.ObjectName,
+			FileName:             mountedObj.FileName,
+			FilePermission:       mountedObj.FilePermission,
+			Encoding:             ObjectEncoding(mountedObj.Encoding),
+			Format:               ObjectFormat(mountedObj.Format),
+			ObjectVersionHistory: mountedObj.ObjectVersionHistory,
+		})
+	}
+	for _, outputFile := range in.OutputFiles {
+		if outputFile == nil {
+			out.OutputFiles = append(out.OutputFiles, nil)
+			continue
+		}
+		converted := &OutputFile{
+			FileName:             outputFile.FileName,
+			Format:               OutputFileFormat(outputFile.Format),
+			FilePermission:       outputFile.FilePermission,
+			PassphraseObjectName: outputFile.PassphraseObjectName,
+			Alias:                outputFile.Alias,
+			Template:             outputFile.Template,
+		}
+		for _, obj := range outputFile.Objects {
+			converted.Objects = append(converted.Objects, (*OutputFileObject)(obj))
+		}
+		out.OutputFiles = append(out.OutputFiles, converted)
+	}
+	return out
+}
+
+func convertObjectDataToV1(in []*SecretObjectData) []*v1.SecretObjectData {
+	var out []*v1.SecretObjectData
+	for _, data := range in {
+		out = append(out, (*v1.SecretObjectData)(data))
+	}
+	return out
+}
+
+func convertObjectDataFromV1(in []*v1.SecretObjectData) []*SecretObjectData {
+	var out []*SecretObjectData
+	for _, data := range in {
+		out = append(out, (*SecretObjectData)(data))
+	}
+	return out
+}
+
+func convertStatusToV1(in *SecretProviderClassStatus) v1.SecretProviderClassStatus {
+	var out v1.SecretProviderClassStatus
+	for _, byPod := range in.ByPod {
+		out.ByPod = append(out.ByPod, (*v1.ByPodStatus)(byPod))
+	}
+	for _, condition := range in.Conditions {
+		out.Conditions = append(out.Conditions, v1.SecretProviderClassCondition{
+			Type:               v1.SecretProviderClassConditionType(condition.Type),
+			Status:             condition.Status,
+			LastUpdateTime:     condition.LastUpdateTime,
+			LastTransitionTime: condition.LastTransitionTime,
+			Reason:             condition.Reason,
+			Message:            condition.Message,
+		})
+	}
+	return out
+}
+
+func convertStatusFromV1(in *v1.SecretProviderClassStatus) SecretProviderClassStatus {
+	var out SecretProviderClassStatus
+	for _, byPod := range in.ByPod {
+		out.ByPod = append(out.ByPod, (*ByPodStatus)(byPod))
+	}
+	for _, condition := range in.Conditions {
+		out.Conditions = append(out.Conditions, SecretProviderClassCondition{
+			Type:               SecretProviderClassConditionType(condition.Type),
+			Status:             condition.Status,
+			LastUpdateTime:     condition.LastUpdateTime,
+			LastTransitionTime: condition.LastTransitionTime,
+			Reason:             condition.Reason,
+			Message:            condition.Message,
+		})
+	}
+	return out
+}
@@ -0,0 +1,103 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package v1alpha1
+
+import (
+	"reflect"
+	"testing"
+
+	fuzz "github.com/google/gofuzz"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	v1 "sigs.k8s.io/secrets-store-csi-driver/apis/v1"
+)
+
+func newFuzzer() *fuzz.Fuzzer {
+	// empty slices are converted to nil slices, which are serialized the same
+	return fuzz.New().NilChance(0.2).NumElements(1, 3)
+}
+
+func TestSecretProviderClassConversionRoundTrip(t *testing.T) {
+	f := newFuzzer()
+	for i := 0; i < 100; i++ {
+		spc := &SecretProviderClass{}
+		f.Fuzz(spc)
+		spc.TypeMeta = metav1.TypeMeta{}
+
+		hub := &v1.SecretProviderClass{}
+		if err := spc.ConvertTo(hub); err != nil {
+			t.Fatalf("expected err to be nil, got: %+v", err)
+		}
+		converted := &SecretProviderClass{}
+		if err := converted.ConvertFrom(hub); err != nil {
+			t.Fatalf("expected err to be nil, got: %+v", err)
+		}
+		if !reflect.DeepEqual(spc, converted) {
+			t.Fatalf("expected round trip of v1alpha1 to be lossless, expected: %+v, got: %+v", spc, converted)
+		}
+	}
+}
+
+func TestSecretProviderClassHubConversionRoundTrip(t *testing.T) {
+	f := newFuzzer()
+	for i := 0; i < 100; i++ {
+		hub := &v1.SecretProviderClass{}
+		f.Fuzz(hub)
+		hub.TypeMeta = metav1.TypeMeta{}
+
+		spc := &SecretProviderClass{}
+		if err := spc.ConvertFrom(hub); err != nil {
+			t.Fatalf("expected err to be nil, got: %+v", err)
+		}
+		converted := &v1.SecretProviderClass{}
+		if err := spc.ConvertTo(converted); err != nil {
+			t.Fatalf("expected err to be nil, got: %+v", err)
+		}
+		if !reflect.DeepEqual(hub, converted) {
+			t.Fatalf("expected round trip of v1 to be lossless, expected: %+v, got: %+v", hub, converted)
+		}
+	}
+}
+
+func TestSecretProviderClassConversionFields(t *testing.T) {
+	spc := &SecretProviderClass{
+		ObjectMeta: metav1.ObjectMeta{Name: "spc1", Namespace: "default"},
+		Spec: SecretProviderClassSpec{
+			Provider:      "vault",
+			Parameters:    map[string]string{"roleName": "app"},
+			SecretObjects: []*SecretObject{{SecretName: "secret1", Type: "Opaque", Data: []*SecretObjectData{{ObjectName: "object1", Key: "key1"}}, ConflictPolicy: ConflictPolicyMerge}},
+			RestartPolicy: RestartPolicyEvict,
+			Extends:       "base",
+		},
+		Status: SecretProviderClassStatus{
+			Conditions: []SecretProviderClassCondition{{Type: InUseByPods, Status: "True", Reason: "PodsMounted"}},
+		},
+	}
+
+	hub := &v1.SecretProviderClass{}
+	if err := spc.ConvertTo(hub); err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	expected := v1.SecretProviderClassSpec{
+		Provider:      "vault",
+		Parameters:    map[string]string{"roleName": "app"},
+		SecretObjects: []*v1.SecretObject{{SecretName: "secret1", Type: "Opaque", Data: []*v1.SecretObjectData{{ObjectName: "object1", Key: "key1"}}, ConflictPolicy: v1.ConflictPolicyMerge}},
+		RestartPolicy: v1.RestartPolicyEvict,
+		Extends:       "base",
+	}
+	if !reflect.DeepEqual(expected, hub.Spec) {
+		t.Errorf("expected spec: %+v, got: %+v", expected, hub.Spec)
+	}
+	if hub.Name != "spc1" || hub.Namespace != "default" {
+		t.Errorf("expected metadata of spc1 in default, got: %+v", hub.ObjectMeta)
+	}
+	if len(hub.Status.Conditions) != 1 || hub.Status.Conditions[0].Type != v1.InUseByPods {
+		t.Errorf("expected %s condition, got: %+v", v1.InUseByPods, hub.Status.Conditions)
+	}
+	// the source object isn't shared with the converted object
+	hub.Spec.Parameters["roleName"] = "changed"
+	if spc.Spec.Parameters["roleName"] != "app" {
+		t.Errorf("expected parameters of the source object to be unchanged, got: %+v", spc.Spec.Parameters)
+	}
+}
@@ -0,0 +1,199 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	apix "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// readCRD returns the CRD in config/crd/bases
+func readCRD(t *testing.T, name string) []byte {
+	data, err := ioutil.ReadFile(filepath.Join("..", "..", "config", "crd", "bases", name))
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	return data
+}
+
+// readCRDSchema returns the validation schema of the storage version of the
+// CRD in config/crd/bases
+func readCRDSchema(t *testing.T, name string) apix.JSONSchemaProps {
+	crd := &apix.CustomResourceDefinition{}
+	if err := yaml.Unmarshal(readCRD(t, name), crd); err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	for _, version := range crd.Spec.Versions {
+		if version.Storage && version.Schema != nil && version.Schema.OpenAPIV3Schema != nil {
+			return *version.Schema.OpenAPIV3Schema
+		}
+	}
+	t.Fatalf("expected the storage version of crd %s to have a validation schema", name)
+	return apix.JSONSchemaProps{}
+}
+
+// validateSchema returns the violations of the required, minItems, minLength
+// and enum rules of the schema by the value decoded from json
+func validateSchema(schema apix.JSONSchemaProps, value interface{}, path string) []string {
+	var errs []string
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for _, required := range schema.Required {
+			if _, ok := v[required]; !ok {
+				errs = append(errs, fmt.Sprintf("%s.%s: required", path, required))
+			}
+		}
+		for k, field := range v {
+			if property, ok := schema.Properties[k]; ok {
+				errs = append(errs, validateSchema(property, field, path+"."+k)...)
+			}
+		}
+	case []interface{}:
+		if schema.MinItems != nil && int64(len(v)) < *schema.MinItems {
+			errs = append(errs, fmt.Sprintf("%s: less than %d items", path, *schema.MinItems))
+		}
+		if schema.Items != nil && schema.Items.Schema != nil {
+			for i, item := range v {
+				errs = append(errs, validateSchema(*schema.Items.Schema, item, fmt.Sprintf("%s[%d]", path, i))...)
+			}
+		}
+	case string:
+		if schema.MinLength != nil && int64(utf8.RuneCountInString(v)) < *schema.MinLength {
+			errs = append(errs, fmt.Sprintf("%s: shorter than %d", path, *schema.MinLength))
+		}
+		if len(schema.Enum) > 0 {
+			allowed := false
+			for _, e := range schema.Enum {
+				if string(e.Raw) == fmt.Sprintf("%q", v) {
+					allowed = true
+				}
+			}
+			if !allowed {
+				errs = append(errs, fmt.Sprintf("%s: unsupported value %q", path, v))
+			}
+		}
+	}
+	return errs
+}
+
+func TestSecretProviderClassSchema(t *testing.T) {
+	cases := []struct {
+		name        string
+		crd         string
+		object      string
+		expectedErr bool
+	}{
+		{
+			// the objects created before the schema was validated don't
+			// set the fields that are checked by the driver when mounted
+			name:   "existing secret provider class without provider and secret object fields",
+			crd:    "secrets-store.csi.x-k8s.io_secretproviderclasses.yaml",
+			object: `{"spec": {"parameters": {"parameter1": "value1"}, "secretObjects": [{"secretName": "secret1", "data": [{"objectName": "object1"}]}, {"type": "Opaque"}, {"secretName": "secret2", "data": []}]}}`,
+		},
+		{
+			name:   "existing cluster secret provider class without provider and secret object fields",
+			crd:    "secrets-store.csi.x-k8s.io_clustersecretproviderclasses.yaml",
+			object: `{"spec": {"namespaceSelector": {}, "secretObjects": [{"secretName": "secret1", "data": [{"key": ""}]}]}}`,
+		},
+		{
+			name:        "configmap object without configmap name",
+			crd:         "secrets-store.csi.x-k8s.io_secretproviderclasses.yaml",
+			object:      `{"spec": {"provider": "provider1", "configMapObjects": [{"data": [{"objectName": "object1", "key": "key1"}]}]}}`,
+			expectedErr: true,
+		},
+		{
+			name:        "unsupported conflict policy",
+			crd:         "secrets-store.csi.x-k8s.io_secretproviderclasses.yaml",
+			object:      `{"spec": {"provider": "provider1", "secretObjects": [{"secretName": "secret1", "conflictPolicy": "Replace"}]}}`,
+			expectedErr: true,
+		},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			schema := readCRDSchema(t, test.crd)
+			var object interface{}
+			if err := json.Unmarshal([]byte(test.object), &object); err != nil {
+				t.Fatalf("expected err to be nil, got: %+v", err)
+			}
+			errs := validateSchema(schema, object, "")
+			if test.expectedErr && len(errs) == 0 || !test.expectedErr && len(errs) > 0 {
+				t.Errorf("expected err: %v, got: %v", test.expectedErr, errs)
+			}
+		})
+	}
+}
+
+func TestSecretProviderClassValidationRules(t *testing.T) {
+	expectedMessages := []string{
+		"provider is required unless the class extends a base class",
+		"secretObjects require a secretName and a type",
+		"secretObjects require at least 1 data entry",
+		"the data entries of secretObjects require a key",
+	}
+	for _, name := range []string{"secrets-store.csi.x-k8s.io_secretproviderclasses.yaml", "secrets-store.csi.x-k8s.io_clustersecretproviderclasses.yaml"} {
+		// the CEL rules aren't part of the JSONSchemaProps of the vendored
+		// apiextensions version, so the CRD is read as plain json
+		var crd struct {
+			Spec struct {
+				Versions []struct {
+					Name   string `json:"name"`
+					Schema struct {
+						OpenAPIV3Schema struct {
+							Properties struct {
+								Spec struct {
+									Validations []struct {
+										Rule            string `json:"rule"`
+										Message         string `json:"message"`
+										OptionalOldSelf bool   `json:"optionalOldSelf"`
+									} `json:"x-kubernetes-validations"`
+								} `json:"spec"`
+							} `json:"properties"`
+						} `json:"openAPIV3Schema"`
+					} `json:"schema"`
+				} `json:"versions"`
+			} `json:"spec"`
+		}
+		if err := yaml.Unmarshal(readCRD(t, name), &crd); err != nil {
+			t.Fatalf("expected err to be nil, got: %+v", err)
+		}
+		for _, version := range crd.Spec.Versions {
+			var messages []string
+			for _, rule := range version.Schema.OpenAPIV3Schema.Properties.Spec.Validations {
+				messages = append(messages, rule.Message)
+				// the rules only reject an update if the previous spec
+				// followed them, and oldSelf is optional as there's no
+				// previous spec on create
+				if !rule.OptionalOldSelf || !strings.Contains(rule.Rule, "oldSelf.hasValue()") {
+					t.Errorf("%s %s: expected rule %q to allow the updates of the existing invalid classes", name, version.Name, rule.Message)
+				}
+			}
+			if !reflect.DeepEqual(messages, expectedMessages) {
+				t.Errorf("%s %s: expected validation rules %v, got: %v", name, version.Name, expectedMessages, messages)
+			}
+		}
+	}
+}
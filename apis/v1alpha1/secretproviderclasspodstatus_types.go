@@ -21,18 +21,53 @@ import metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 const (
 	// InternalNodeLabel used for setting the node name spc pod status belongs to
 	InternalNodeLabel = "internal.secrets-store.csi.k8s.io/node-name"
+	// SyncedSecretsFinalizer is set on the spc pod status of a pod that syncs
+	// secrets, and blocks its deletion until the synced secrets are removed
+	SyncedSecretsFinalizer = "secrets-store.csi.k8s.io/synced-secrets"
 )
 
 // NOTE: json tags are required.  Any new fields you add must have json tags for the fields to be serialized.
 
 // SecretProviderClassPodStatusStatus defines the observed state of SecretProviderClassPodStatus
 type SecretProviderClassPodStatusStatus struct {
-	PodName                 string                      `json:"podName,omitempty"`
-	PodUID                  string                      `json:"podUID,omitempty"`
-	SecretProviderClassName string                      `json:"secretProviderClassName,omitempty"`
+	PodName                 string `json:"podName,omitempty"`
+	PodUID                  string `json:"podUID,omitempty"`
+	SecretProviderClassName string `json:"secretProviderClassName,omitempty"`
+	// SecretProviderClassKind is ClusterSecretProviderClass if the pod mounts a
+	// ClusterSecretProviderClass, and empty for a SecretProviderClass
+	SecretProviderClassKind string                      `json:"secretProviderClassKind,omitempty"`
 	Mounted                 bool                        `json:"mounted,omitempty"`
 	TargetPath              string                      `json:"targetPath,omitempty"`
 	Objects                 []SecretProviderClassObject `json:"objects,omitempty"`
+	// ExpiryTime is the earliest expiry of the mounted objects reported by the providers
+	ExpiryTime *metav1.Time `json:"expiryTime,omitempty"`
+	// Rotation is the status of the last rotation of the mounted contents
+	Rotation *RotationStatus `json:"rotation,omitempty"`
+	// SecretProviderClassGeneration is the generation of the secret provider
+	// class the contents were last mounted with. The contents are remounted
+	// when the secret provider class changes.
+	SecretProviderClassGeneration int64 `json:"secretProviderClassGeneration,omitempty"`
+}
+
+// RotationStatus defines the observed state of the rotation of the mounted contents
+type RotationStatus struct {
+	// time of the last successful rotation
+	LastRotationTime *metav1.Time `json:"lastRotationTime,omitempty"`
+	// time of the last rotation attempt
+	LastAttemptTime *metav1.Time `json:"lastAttemptTime,omitempty"`
+	// objects fetched from the external secrets store in the last rotation attempt
+	LastAttemptedObjects []SecretProviderClassObject `json:"lastAttemptedObjects,omitempty"`
+	// error of the last rotation attempt, empty if the attempt succeeded
+	LastError string `json:"lastError,omitempty"`
+	// number of consecutive failed rotation attempts
+	FailureCount int32 `json:"failureCount,omitempty"`
+	// true if the pod has to be restarted with the restart policy of the
+	// SecretProviderClass, e.g. because the eviction was blocked by a pod
+	// disruption budget
+	RestartPending bool `json:"restartPending,omitempty"`
+	// objects, mounted files and synced secrets the last rotation attempt in
+	// dry run mode would have changed
+	DryRunChanges []string `json:"dryRunChanges,omitempty"`
 }
 
 // SecretProviderClassObject defines the object fetched from external secrets store
@@ -42,6 +77,12 @@ type SecretProviderClassObject struct {
 }
 
 // +kubebuilder:object:root=true
+// +kubebuilder:resource:shortName=spcps
+// +kubebuilder:printcolumn:name="Pod",type="string",JSONPath=".status.podName"
+// +kubebuilder:printcolumn:name="Class",type="string",JSONPath=".status.secretProviderClassName"
+// +kubebuilder:printcolumn:name="Mounted",type="boolean",JSONPath=".status.mounted"
+// +kubebuilder:printcolumn:name="Last Rotation",type="date",JSONPath=".status.rotation.lastRotationTime"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
 
 // SecretProviderClassPodStatus is the Schema for the secretproviderclassespodstatus API
 type SecretProviderClassPodStatus struct {
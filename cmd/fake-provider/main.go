@@ -0,0 +1,55 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"flag"
+	"os"
+	"os/signal"
+	"syscall"
+
+	log "github.com/sirupsen/logrus"
+
+	"sigs.k8s.io/secrets-store-csi-driver/provider/fake"
+)
+
+var (
+	endpoint         = flag.String("endpoint", "/etc/kubernetes/secrets-store-csi-providers/fake.sock", "unix domain socket the provider serves on")
+	rotationInterval = flag.Duration("rotation-interval", 0, "interval the version of the mounted objects is incremented, 0 never increments the version")
+	debug            = flag.Bool("debug", false, "sets log to debug level")
+)
+
+func main() {
+	flag.Parse()
+
+	log.SetLevel(log.InfoLevel)
+	if *debug {
+		log.SetLevel(log.DebugLevel)
+	}
+
+	provider := fake.NewProvider(*endpoint, *rotationInterval)
+	if err := provider.Start(); err != nil {
+		log.Fatalf("failed to start fake provider, err: %+v", err)
+	}
+	defer provider.Stop()
+	log.Infof("fake provider listening on %s", *endpoint)
+
+	signalCh := make(chan os.Signal, 1)
+	signal.Notify(signalCh, syscall.SIGINT, syscall.SIGTERM)
+	<-signalCh
+	log.Infof("stopping fake provider")
+}
@@ -0,0 +1,166 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// kubectl-secrets_store is a kubectl plugin, run as kubectl secrets-store,
+// that validates secret provider classes before they are applied.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/config"
+
+	secretsstorev1 "sigs.k8s.io/secrets-store-csi-driver/apis/v1"
+	"sigs.k8s.io/secrets-store-csi-driver/apis/v1alpha1"
+	"sigs.k8s.io/secrets-store-csi-driver/pkg/validate"
+)
+
+var (
+	filename       = flag.String("filename", "", "manifest of the secret provider classes to validate, - reads the manifest from stdin")
+	namespace      = flag.String("namespace", "default", "namespace of the secret provider classes without namespace and of the pod mounting cluster secret provider classes")
+	local          = flag.Bool("local", false, "skips the checks that require access to the cluster, e.g. the dry run apply and the base classes")
+	providerVolume = flag.String("provider-volume", "", "directory of the provider sockets, the provider checks are skipped if not set")
+	dryRunFetch    = flag.Bool("dry-run-fetch", false, "fetches the objects from the providers into a temporary directory that is removed after the check")
+	podName        = flag.String("pod-name", "", "name of the pod the parameter templates are rendered with")
+	podLabels      = flag.String("pod-labels", "", "comma separated key=value labels of the pod the parameter templates are rendered with and the pod selector is matched against")
+	serviceAccount = flag.String("service-account", "default", "service account name of the pod the parameter templates are rendered with")
+	secrets        = flag.String("secrets", "{}", "json object of the node publish secrets of the dry run mount requests")
+	timeout        = flag.Duration("timeout", 30*time.Second, "timeout of each provider call")
+	output         = flag.String("output", "text", "format of the report, text or json")
+	debug          = flag.Bool("debug", false, "sets log to debug level")
+
+	scheme = runtime.NewScheme()
+)
+
+func init() {
+	flag.StringVar(filename, "f", "", "shorthand for -filename")
+	flag.StringVar(namespace, "n", "default", "shorthand for -namespace")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: kubectl secrets-store validate -f FILENAME [flags]\n\nFlags:\n")
+		flag.PrintDefaults()
+	}
+
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = v1alpha1.AddToScheme(scheme)
+	_ = secretsstorev1.AddToScheme(scheme)
+}
+
+func main() {
+	if len(os.Args) < 2 || os.Args[1] != "validate" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	// the flags follow the validate command
+	if err := flag.CommandLine.Parse(os.Args[2:]); err != nil {
+		os.Exit(2)
+	}
+
+	log.SetLevel(log.WarnLevel)
+	if *debug {
+		log.SetLevel(log.DebugLevel)
+	}
+	if len(*filename) == 0 {
+		log.Fatalf("filename is not set")
+	}
+	if *output != "text" && *output != "json" {
+		log.Fatalf("invalid output %s, must be text or json", *output)
+	}
+
+	objects, err := decodeFile(*filename)
+	if err != nil {
+		log.Fatalf("failed to decode %s, err: %+v", *filename, err)
+	}
+	if len(objects) == 0 {
+		log.Fatalf("no secret provider classes found in %s", *filename)
+	}
+
+	podLabelSet, err := labels.ConvertSelectorToLabelsMap(*podLabels)
+	if err != nil {
+		log.Fatalf("failed to parse pod labels, err: %+v", err)
+	}
+	cfg := validate.Config{
+		ProviderVolume: *providerVolume,
+		Pod: &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: *podName, Namespace: *namespace, Labels: podLabelSet},
+			Spec:       corev1.PodSpec{ServiceAccountName: *serviceAccount},
+		},
+		DryRunFetch: *dryRunFetch,
+		Timeout:     *timeout,
+	}
+	if err := json.Unmarshal([]byte(*secrets), &cfg.Secrets); err != nil {
+		log.Fatalf("failed to parse secrets, err: %+v", err)
+	}
+	if !*local {
+		restConfig, err := config.GetConfig()
+		if err != nil {
+			log.Fatalf("failed to get kubeconfig, run with -local to skip the cluster checks, err: %+v", err)
+		}
+		if cfg.Client, err = client.New(restConfig, client.Options{Scheme: scheme}); err != nil {
+			log.Fatalf("failed to create client, err: %+v", err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	signalCh := make(chan os.Signal, 1)
+	signal.Notify(signalCh, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-signalCh
+		cancel()
+	}()
+
+	report := validate.Run(ctx, objects, cfg)
+	if *output == "json" {
+		err = report.WriteJSON(os.Stdout)
+	} else {
+		err = report.WriteText(os.Stdout)
+	}
+	if err != nil {
+		log.Fatalf("failed to write report, err: %+v", err)
+	}
+	if !report.Passed() {
+		os.Exit(1)
+	}
+}
+
+// decodeFile decodes the secret provider classes of the manifest file or of
+// stdin if the filename is -
+func decodeFile(name string) ([]*validate.Object, error) {
+	var r io.Reader = os.Stdin
+	if name != "-" {
+		f, err := os.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+	return validate.Decode(r, *namespace)
+}
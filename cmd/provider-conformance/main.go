@@ -0,0 +1,93 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"sigs.k8s.io/secrets-store-csi-driver/pkg/conformance"
+)
+
+var (
+	provider       = flag.String("provider", "", "name of the provider, the provider serves on the <provider>.sock socket in the provider volume")
+	providerVolume = flag.String("provider-volume", "/etc/kubernetes/secrets-store-csi-providers", "directory of the provider sockets")
+	parameters     = flag.String("parameters", "{}", "json object of the secret provider class parameters of the mount requests")
+	secrets        = flag.String("secrets", "{}", "json object of the node publish secrets of the mount requests")
+	driverVersion  = flag.String("driver-version", "", "driver version checked against the minimum driver version of the provider, the check is skipped if not set")
+	rotationWait   = flag.Duration("rotation-wait", 0, "duration to wait for the mounted objects to be rotated, the rotation scenario is skipped if not set")
+	timeout        = flag.Duration("timeout", 30*time.Second, "timeout of each provider call")
+	output         = flag.String("output", "text", "format of the report, text or json")
+	debug          = flag.Bool("debug", false, "sets log to debug level")
+)
+
+func main() {
+	flag.Parse()
+
+	log.SetLevel(log.WarnLevel)
+	if *debug {
+		log.SetLevel(log.DebugLevel)
+	}
+	if *output != "text" && *output != "json" {
+		log.Fatalf("invalid output %s, must be text or json", *output)
+	}
+
+	config := conformance.Config{
+		Provider:       *provider,
+		ProviderVolume: *providerVolume,
+		DriverVersion:  *driverVersion,
+		RotationWait:   *rotationWait,
+		Timeout:        *timeout,
+	}
+	if err := json.Unmarshal([]byte(*parameters), &config.Parameters); err != nil {
+		log.Fatalf("failed to parse parameters, err: %+v", err)
+	}
+	if err := json.Unmarshal([]byte(*secrets), &config.Secrets); err != nil {
+		log.Fatalf("failed to parse secrets, err: %+v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	signalCh := make(chan os.Signal, 1)
+	signal.Notify(signalCh, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-signalCh
+		cancel()
+	}()
+
+	report, err := conformance.Run(ctx, config)
+	if err != nil {
+		log.Fatalf("failed to run conformance scenarios, err: %+v", err)
+	}
+	if *output == "json" {
+		err = report.WriteJSON(os.Stdout)
+	} else {
+		err = report.WriteText(os.Stdout)
+	}
+	if err != nil {
+		log.Fatalf("failed to write report, err: %+v", err)
+	}
+	if !report.Passed() {
+		os.Exit(1)
+	}
+}
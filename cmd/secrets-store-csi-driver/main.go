@@ -18,17 +18,28 @@ package main
 
 import (
 	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
 
 	log "github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/api/resource"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
 
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/config"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/conversion"
 
+	secretsstorev1 "sigs.k8s.io/secrets-store-csi-driver/apis/v1"
 	"sigs.k8s.io/secrets-store-csi-driver/apis/v1alpha1"
 	"sigs.k8s.io/secrets-store-csi-driver/controllers"
+	"sigs.k8s.io/secrets-store-csi-driver/pkg/sandbox"
 	secretsstore "sigs.k8s.io/secrets-store-csi-driver/pkg/secrets-store"
 	// +kubebuilder:scaffold:imports
 )
@@ -41,11 +52,76 @@ var (
 	logFormatJSON      = flag.Bool("log-format-json", false, "set log formatter to json")
 	logReportCaller    = flag.Bool("log-report-caller", false, "include the calling method as fields in the log")
 	providerVolumePath = flag.String("provider-volume", "/etc/kubernetes/secrets-store-csi-providers", "Volume path for provider")
+	kubeletRootDir     = flag.String("kubelet-root-dir", "/var/lib/kubelet", "root directory of the kubelet, the target paths of the pods deleted while the driver was down are cleaned up in its pods directory on start")
+	providerSockets    = flag.String("provider-sockets", "", "comma separated list of provider=dir pairs for providers with a <provider>.sock socket outside of the provider volume path")
+	providerPipes      = flag.String("provider-pipes", "", "comma separated list of provider=pipe pairs for providers listening on a named pipe, e.g. vault=\\\\.\\pipe\\vault (windows only)")
 	minProviderVersion = flag.String("min-provider-version", "", "set minimum supported provider versions with current driver")
 	metricsAddr        = flag.String("metrics-addr", ":8080", "The address the metric endpoint binds to")
 	// grpcSupportedProviders is a ; separated string that can contain a list of providers. The reason it's a string is to allow scenarios
 	// where the driver is being used with 2 providers, one which supports grpc and other using binary for provider.
-	grpcSupportedProviders = flag.String("grpc-supported-providers", "", "set list of providers that support grpc for driver-provider [alpha]")
+	// Deprecated: providers that create a <provider>.sock socket in the provider volume path are discovered automatically.
+	grpcSupportedProviders = flag.String("grpc-supported-providers", "", "set list of providers that support grpc for driver-provider [deprecated]")
+
+	providerHealthCheck         = flag.Bool("provider-health-check", false, "Enable health check for configured providers")
+	providerHealthCheckInterval = flag.Duration("provider-health-check-interval", 2*time.Minute, "Provider healthcheck interval duration")
+
+	providerTimeout             = flag.Duration("provider-timeout", 30*time.Second, "timeout for fetching the contents from the provider including retries, can be overridden with providerTimeout in the SecretProviderClass")
+	maxCachedContentAge         = flag.Duration("max-cached-content-age", 0, "maximum age of the previously mounted contents of a secretproviderclass served when its providers are unavailable. 0 doesn't serve cached contents")
+	mountTimeout                = flag.Duration("mount-timeout", 0, "deadline of mounting a volume, split between fetching the contents from the providers and writing the files. 0 doesn't time out the mounts")
+	mountWriteTimeout           = flag.Duration("mount-write-timeout", 10*time.Second, "part of the mount timeout reserved for writing the mounted files, the contents are fetched within the rest of the mount timeout")
+	maxFileSize                 = flag.String("max-file-size", "", "maximum size of a mounted file, e.g. 1Mi. Mounts with larger files fail")
+	maxVolumeSize               = flag.String("max-volume-size", "", "maximum total size of the files of a volume, e.g. 10Mi. Mounts and rotations with larger contents fail")
+	maxVolumeFiles              = flag.Int("max-volume-files", 0, "maximum number of files of a volume, 0 doesn't limit the number of files. Mounts and rotations with more files fail")
+	tmpfsSize                   = flag.String("tmpfs-size", "", "size limit of the tmpfs mounted for each volume, e.g. 10Mi. The tmpfs isn't limited if empty")
+	seLinuxContext              = flag.Bool("selinux-context", false, "label the mounted files with the SELinux context of the pod on the nodes with SELinux enabled, so the containers can read them without relabeling")
+	fsGroupPolicy               = flag.String("fs-group-policy", secretsstore.FSGroupPolicyNone, "File to make the mounted files owned and readable by the fsGroup of the pod, None to keep the group of the files")
+	maxConcurrentProviderCalls  = flag.Int("max-concurrent-provider-calls", 0, "maximum number of concurrent provider calls on the node, 0 doesn't limit the provider calls")
+	mountWorkers                = flag.Int("mount-workers", 16, "number of volumes mounted in parallel on the node, the other mounts wait for a worker. 0 doesn't limit the parallel mounts")
+	providersAllowlist          = flag.String("providers-allowlist", "", "comma separated list of providers the driver is allowed to call, all providers are allowed if not set")
+	providerRetryMaxAttempts    = flag.Int("provider-retry-max-attempts", 3, "maximum number of attempts of a provider grpc call that fails with a retryable error")
+	providerRetryInitialBackoff = flag.Duration("provider-retry-initial-backoff", 100*time.Millisecond, "backoff before the first retry of a provider grpc call, doubled for every retry")
+	providerRetryMaxBackoff     = flag.Duration("provider-retry-max-backoff", 2*time.Second, "maximum backoff between retries of a provider grpc call")
+	syncNamespaces              = flag.String("sync-namespaces", "", "comma separated list of namespaces the secrets can be synced into from other namespaces, if allowed by the secrets-store.csi.k8s.io/allow-sync-from annotation of the namespace")
+	standaloneSyncInterval      = flag.Duration("standalone-sync-interval", 0, "interval the secretproviderclasses annotated with secrets-store.csi.k8s.io/standalone-sync are synced into k8s secrets without pods, disabled if 0")
+	standaloneSyncLeaseNS       = flag.String("standalone-sync-lease-namespace", "kube-system", "namespace of the lease that elects the driver that runs the standalone sync")
+	spcLeaseNS                  = flag.String("secretproviderclass-lease-namespace", "kube-system", "namespace of the lease that elects the driver that sets the InUseByPods condition of the secretproviderclasses")
+	auditLogPath                = flag.String("audit-log-path", "", "path of the append-only log of the object versions mounted and rotated in the pod volumes, disabled if empty")
+
+	enableDefaultingWebhook = flag.Bool("enable-defaulting-webhook", false, "serve the mutating webhook that sets the defaults of the secretproviderclasses")
+	enableConversionWebhook = flag.Bool("enable-conversion-webhook", false, "serve the webhook that converts the secretproviderclasses between the api versions")
+	enablePodWebhook        = flag.Bool("enable-pod-validating-webhook", false, "serve the validating webhook that rejects the pods that aren't allowed to mount the secretproviderclass of their volumes")
+	denySubPathMounts       = flag.Bool("deny-subpath-mounts", false, "reject the pods with containers that mount a volume of the driver with subPath in the pod validating webhook, as the rotated contents aren't visible with subPath")
+	enableDeletionWebhook   = flag.Bool("enable-deletion-protection-webhook", false, "serve the validating webhook that rejects the deletion of the secretproviderclasses that are mounted by pods")
+	enableSpecWebhook       = flag.Bool("enable-spec-validating-webhook", false, "serve the validating webhook that rejects the secretproviderclasses the driver would fail to mount or sync")
+	webhookPort             = flag.Int("webhook-port", 9443, "port the defaulting, conversion, pod validating, deletion protection and spec validating webhooks are served at")
+	webhookCertDir          = flag.String("webhook-cert-dir", "/tmp/k8s-webhook-server/serving-certs", "directory with the tls.crt and tls.key serving certificate of the defaulting, conversion, pod validating, deletion protection and spec validating webhooks")
+	defaultParameters       = flag.String("default-parameters", "", "comma separated list of provider:key=value parameters the defaulting webhook sets in the secretproviderclasses of the provider if the key isn't set, e.g. vault:vaultAddress=https://vault:8200")
+
+	enableSecretRotation  = flag.Bool("enable-secret-rotation", false, "Enable secret rotation feature [alpha]")
+	rotationPollInterval  = flag.Duration("rotation-poll-interval", 2*time.Minute, "Secret rotation poll interval duration")
+	rotationJitter        = flag.Float64("rotation-jitter", 0.5, "maximum random delay of the rotation of a volume as a fraction of the rotation poll interval, so the volumes of a node aren't rotated at the same time")
+	rotationRenewBefore   = flag.Duration("rotation-renew-before", 30*time.Second, "how long before the expiry of the mounted objects reported by the providers the volume is rotated")
+	rotationMaxBackoff    = flag.Duration("rotation-max-backoff", 30*time.Minute, "maximum interval between the rotation attempts of a volume that keeps failing, 0 rotates failing volumes every poll interval")
+	rotationRateLimit     = flag.Float64("rotation-rate-limit", 0, "maximum number of provider calls per second for the rotation of the volumes of the node, 0 doesn't limit the provider calls")
+	rotationRateBurst     = flag.Int("rotation-rate-burst", 10, "maximum number of provider calls for the rotation above the rotation rate limit")
+	rotationDryRun        = flag.Bool("rotation-dry-run", false, "only report the changes the rotation would make with events, metrics and the secretproviderclasspodstatus, without updating the mounted contents")
+	rotationTriggerAddr   = flag.String("rotation-trigger-addr", "", "address of the http endpoint that rotates the volumes of a pod or secretproviderclass immediately, a loopback address or unix socket, e.g. localhost:8095 or unix:///var/run/secrets-store-csi-driver/rotate.sock. Disabled if empty")
+	rotationSyncDebounce  = flag.Duration("rotation-sync-debounce", 0, "minimum interval between the updates of a synced secret or configmap by the rotation, the changes within the interval are coalesced into a single update. 0 doesn't debounce the updates")
+	rotationSyncRateLimit = flag.Float64("rotation-sync-rate-limit", 0, "maximum number of updates of the synced secrets and configmaps per second per namespace by the rotation, 0 doesn't limit the updates")
+	rotationSyncRateBurst = flag.Int("rotation-sync-rate-burst", 10, "maximum number of updates of the synced secrets and configmaps per namespace above the rotation sync rate limit")
+
+	// the provider auth flags only apply to providers with a socket in the provider volume path
+	providerAllowedUIDs = flag.String("provider-allowed-uids", "", "comma separated list of uids the provider processes are allowed to run as, verified with SO_PEERCRED (linux only)")
+	providerTLSCAFile   = flag.String("provider-tls-ca-file", "", "CA bundle to verify the provider certificates with, enables mTLS for the provider connections")
+	providerTLSCertFile = flag.String("provider-tls-cert-file", "", "client certificate presented to the providers when mTLS is enabled")
+	providerTLSKeyFile  = flag.String("provider-tls-key-file", "", "client key of the certificate presented to the providers when mTLS is enabled")
+
+	// the sandbox flags only apply to providers invoked as binaries
+	providerExecTimeout        = flag.Duration("provider-exec-timeout", 0, "maximum duration of a provider binary invocation, 0 uses the mount request deadline")
+	providerExecMemoryLimit    = flag.String("provider-exec-memory-limit", "", "maximum virtual memory of a provider binary process, e.g. 512Mi (linux only)")
+	providerExecCPULimit       = flag.Duration("provider-exec-cpu-limit", 0, "maximum cpu time of a provider binary process, at least 1s and rounded up to seconds, e.g. 30s (linux only)")
+	providerExecMinimalEnv     = flag.Bool("provider-exec-minimal-env", false, "run provider binaries with only the PATH environment variable of the driver")
+	providerExecSeccompProfile = flag.String("provider-exec-seccomp-profile", "", "path to a seccomp BPF filter exported by libseccomp to load for provider binaries (linux only)")
 
 	scheme = runtime.NewScheme()
 )
@@ -53,10 +129,14 @@ var (
 func init() {
 	_ = clientgoscheme.AddToScheme(scheme)
 	_ = v1alpha1.AddToScheme(scheme)
+	_ = secretsstorev1.AddToScheme(scheme)
 	// +kubebuilder:scaffold:scheme
 }
 
 func main() {
+	// the driver is re-executed to apply the sandbox before executing provider binaries
+	sandbox.Init()
+
 	flag.Parse()
 
 	log.SetLevel(log.InfoLevel)
@@ -73,20 +153,72 @@ func main() {
 		Scheme:             scheme,
 		MetricsBindAddress: *metricsAddr,
 		LeaderElection:     false,
+		Port:               *webhookPort,
+		CertDir:            *webhookCertDir,
 	})
 	if err != nil {
 		log.Fatalf("failed to start manager, error: %+v", err)
 	}
 
+	// the InUseByPods condition is set by the driver elected with the lease
+	leaseClient, err := kubernetes.NewForConfig(mgr.GetConfig())
+	if err != nil {
+		log.Fatalf("failed to create secretproviderclass controller, error creating kubernetes client: %+v", err)
+	}
+	spcReconciler := &controllers.SecretProviderClassReconciler{
+		Client:         mgr.GetClient(),
+		Reader:         mgr.GetCache(),
+		KubeClient:     leaseClient,
+		LeaseNamespace: *spcLeaseNS,
+		NodeID:         *nodeID,
+	}
+	if err = spcReconciler.SetupWithManager(mgr); err != nil {
+		log.Fatalf("failed to create secretproviderclass controller, error: %+v", err)
+	}
+	// the synced secrets of the deleted spc pod statuses whose node is gone
+	// are cleaned up by the driver elected with the same lease
 	if err = (&controllers.SecretProviderClassPodStatusReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
-		NodeID: *nodeID,
-		Reader: mgr.GetCache(),
-		Writer: mgr.GetClient(),
+		Client:    mgr.GetClient(),
+		Scheme:    mgr.GetScheme(),
+		NodeID:    *nodeID,
+		Reader:    mgr.GetCache(),
+		Writer:    mgr.GetClient(),
+		APIReader: mgr.GetAPIReader(),
+		IsLeader:  spcReconciler.IsLeader,
+
+		SyncNamespaces: getSyncNamespaces(),
 	}).SetupWithManager(mgr); err != nil {
 		log.Fatalf("failed to create controller, error: %+v", err)
 	}
+	if *enableDefaultingWebhook {
+		parameters, err := getDefaultParameters()
+		if err != nil {
+			log.Fatalf("failed to create defaulting webhook, invalid default parameters %s, error: %+v", *defaultParameters, err)
+		}
+		// the webhook server is only started if a webhook is registered
+		mgr.GetWebhookServer().Register(controllers.SecretProviderClassDefaultingPath, &webhook.Admission{
+			Handler: &controllers.SecretProviderClassDefaulter{DefaultParameters: parameters},
+		})
+	}
+	if *enableConversionWebhook {
+		// the versions are converted through v1, the hub version
+		mgr.GetWebhookServer().Register(controllers.SecretProviderClassConversionPath, &conversion.Webhook{})
+	}
+	if *enablePodWebhook {
+		mgr.GetWebhookServer().Register(controllers.PodValidationPath, &webhook.Admission{
+			Handler: &controllers.PodValidator{Client: mgr.GetClient(), DriverName: *driverName, DenySubPath: *denySubPathMounts},
+		})
+	}
+	if *enableDeletionWebhook {
+		mgr.GetWebhookServer().Register(controllers.SecretProviderClassDeletionPath, &webhook.Admission{
+			Handler: &controllers.SecretProviderClassDeletionValidator{Client: mgr.GetClient()},
+		})
+	}
+	if *enableSpecWebhook {
+		mgr.GetWebhookServer().Register(controllers.SecretProviderClassValidationPath, &webhook.Admission{
+			Handler: &controllers.SecretProviderClassValidator{},
+		})
+	}
 	// +kubebuilder:scaffold:builder
 
 	go func() {
@@ -96,10 +228,10 @@ func main() {
 		}
 	}()
 
-	handle()
+	handle(mgr.GetEventRecorderFor("secrets-store-csi-driver"))
 }
 
-func handle() {
+func handle(eventRecorder record.EventRecorder) {
 	driver := secretsstore.GetDriver()
 	cfg, err := config.GetConfig()
 	if err != nil {
@@ -109,5 +241,235 @@ func handle() {
 	if err != nil {
 		log.Fatalf("failed to initialize driver, error creating client: %+v", err)
 	}
-	driver.Run(*driverName, *nodeID, *endpoint, *providerVolumePath, *minProviderVersion, *grpcSupportedProviders, c)
+	// the clientset is used for the subresources the client doesn't support,
+	// e.g. evicting the pods after rotation
+	kubeClient, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		log.Fatalf("failed to initialize driver, error creating kubernetes client: %+v", err)
+	}
+
+	// providers register by creating a socket in the provider volume path. The
+	// connections are long lived and shared across all mount requests.
+	providerAuth, err := getProviderAuth()
+	if err != nil {
+		log.Fatalf("failed to initialize driver, error configuring provider auth: %+v", err)
+	}
+	providerClients, err := secretsstore.NewPluginClientBuilderWithAuth(*providerVolumePath, providerAuth)
+	if err != nil {
+		log.Fatalf("failed to initialize driver, error creating provider clients: %+v", err)
+	}
+	defer providerClients.Cleanup()
+	providerSocketDirs, err := secretsstore.ParseProviderSocketDirs(*providerSockets)
+	if err != nil {
+		log.Fatalf("failed to initialize driver, invalid provider sockets %s, error: %+v", *providerSockets, err)
+	}
+	providerClients.SetProviderSocketDirs(providerSocketDirs)
+	providerPipeNames, err := secretsstore.ParseProviderPipes(*providerPipes)
+	if err != nil {
+		log.Fatalf("failed to initialize driver, invalid provider pipes %s, error: %+v", *providerPipes, err)
+	}
+	providerClients.SetProviderPipes(providerPipeNames)
+
+	// watch the provider volume path so providers installed after the driver
+	// started are discovered without restarting the driver
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	if err := providerClients.Watch(stopCh); err != nil {
+		log.Warningf("failed to watch provider volume path %s, err: %+v", *providerVolumePath, err)
+	}
+
+	if *providerHealthCheck {
+		go providerClients.HealthCheck(stopCh, *providerHealthCheckInterval)
+	}
+
+	providerSandbox, err := getProviderSandbox()
+	if err != nil {
+		log.Fatalf("failed to initialize driver, error configuring provider sandbox: %+v", err)
+	}
+
+	var maxFileSizeBytes int64
+	if len(*maxFileSize) > 0 {
+		quantity, err := resource.ParseQuantity(*maxFileSize)
+		if err != nil {
+			log.Fatalf("failed to initialize driver, invalid max file size %s, error: %+v", *maxFileSize, err)
+		}
+		maxFileSizeBytes = quantity.Value()
+	}
+	volumeQuota := secretsstore.VolumeQuota{MaxFiles: *maxVolumeFiles}
+	if len(*maxVolumeSize) > 0 {
+		quantity, err := resource.ParseQuantity(*maxVolumeSize)
+		if err != nil {
+			log.Fatalf("failed to initialize driver, invalid max volume size %s, error: %+v", *maxVolumeSize, err)
+		}
+		volumeQuota.MaxSize = quantity.Value()
+	}
+	var tmpfsSizeBytes int64
+	if len(*tmpfsSize) > 0 {
+		quantity, err := resource.ParseQuantity(*tmpfsSize)
+		if err != nil {
+			log.Fatalf("failed to initialize driver, invalid tmpfs size %s, error: %+v", *tmpfsSize, err)
+		}
+		tmpfsSizeBytes = quantity.Value()
+	}
+	if err := secretsstore.ValidateFSGroupPolicy(*fsGroupPolicy); err != nil {
+		log.Fatalf("failed to initialize driver, error: %+v", err)
+	}
+
+	retryPolicy := secretsstore.RetryPolicy{
+		MaxAttempts:    *providerRetryMaxAttempts,
+		InitialBackoff: *providerRetryInitialBackoff,
+		MaxBackoff:     *providerRetryMaxBackoff,
+	}
+
+	mountTimeoutConfig := secretsstore.MountTimeout{
+		Timeout:      *mountTimeout,
+		WriteTimeout: *mountWriteTimeout,
+	}
+	if err := mountTimeoutConfig.Validate(); err != nil {
+		log.Fatalf("failed to initialize driver, invalid mount timeout: %+v", err)
+	}
+
+	rotationConfig := secretsstore.RotationConfig{
+		Enabled:      *enableSecretRotation,
+		PollInterval: *rotationPollInterval,
+		Jitter:       *rotationJitter,
+		RenewBefore:  *rotationRenewBefore,
+		MaxBackoff:   *rotationMaxBackoff,
+		RateLimit:    *rotationRateLimit,
+		RateBurst:    *rotationRateBurst,
+		TriggerAddr:  *rotationTriggerAddr,
+		DryRun:       *rotationDryRun,
+
+		SyncNamespaces: getSyncNamespaces(),
+		SyncDebounce:   *rotationSyncDebounce,
+		SyncRateLimit:  *rotationSyncRateLimit,
+		SyncRateBurst:  *rotationSyncRateBurst,
+	}
+	if err := rotationConfig.Validate(); err != nil {
+		log.Fatalf("failed to initialize driver, invalid rotation config: %+v", err)
+	}
+
+	standaloneSyncConfig := secretsstore.StandaloneSyncConfig{
+		Interval:       *standaloneSyncInterval,
+		LeaseNamespace: *standaloneSyncLeaseNS,
+		SyncNamespaces: getSyncNamespaces(),
+	}
+
+	var auditLog *secretsstore.AuditLog
+	if len(*auditLogPath) > 0 {
+		if auditLog, err = secretsstore.NewAuditLog(*auditLogPath); err != nil {
+			log.Fatalf("failed to initialize driver, error opening audit log: %+v", err)
+		}
+		defer auditLog.Close()
+	}
+
+	driver.Run(secretsstore.Config{
+		DriverName:                 *driverName,
+		NodeID:                     *nodeID,
+		Endpoint:                   *endpoint,
+		ProviderVolumePath:         *providerVolumePath,
+		KubeletRootDir:             *kubeletRootDir,
+		MinProviderVersions:        *minProviderVersion,
+		GRPCSupportedProviders:     *grpcSupportedProviders,
+		ProviderClients:            providerClients,
+		ProviderSandbox:            providerSandbox,
+		RetryPolicy:                retryPolicy,
+		ProviderTimeout:            *providerTimeout,
+		MaxCachedContentAge:        *maxCachedContentAge,
+		MountTimeout:               mountTimeoutConfig,
+		MaxFileSize:                maxFileSizeBytes,
+		TmpfsSize:                  tmpfsSizeBytes,
+		VolumeQuota:                volumeQuota,
+		MaxConcurrentProviderCalls: *maxConcurrentProviderCalls,
+		MountWorkers:               *mountWorkers,
+		ProvidersAllowlist:         *providersAllowlist,
+		FSGroupPolicy:              *fsGroupPolicy,
+		SELinuxContext:             *seLinuxContext,
+		Rotation:                   rotationConfig,
+		StandaloneSync:             standaloneSyncConfig,
+		AuditLog:                   auditLog,
+		Client:                     c,
+		KubeClient:                 kubeClient,
+		EventRecorder:              eventRecorder,
+	})
+}
+
+// getSyncNamespaces returns the namespaces the secrets can be synced into from
+// other namespaces
+func getSyncNamespaces() []string {
+	var namespaces []string
+	for _, ns := range strings.Split(*syncNamespaces, ",") {
+		if ns = strings.TrimSpace(ns); len(ns) > 0 {
+			namespaces = append(namespaces, ns)
+		}
+	}
+	return namespaces
+}
+
+// getDefaultParameters returns the default parameters of the secretproviderclasses
+// by provider name
+func getDefaultParameters() (map[string]map[string]string, error) {
+	parameters := make(map[string]map[string]string)
+	for _, parameter := range strings.Split(*defaultParameters, ",") {
+		parameter = strings.TrimSpace(parameter)
+		if len(parameter) == 0 {
+			continue
+		}
+		kv := strings.SplitN(parameter, "=", 2)
+		providerKey := strings.SplitN(kv[0], ":", 2)
+		if len(kv) != 2 || len(providerKey) != 2 || len(providerKey[0]) == 0 || len(providerKey[1]) == 0 {
+			return nil, fmt.Errorf("invalid default parameter %s, expected provider:key=value", parameter)
+		}
+		if parameters[providerKey[0]] == nil {
+			parameters[providerKey[0]] = make(map[string]string)
+		}
+		parameters[providerKey[0]][providerKey[1]] = kv[1]
+	}
+	return parameters, nil
+}
+
+// getProviderAuth returns the configuration for authenticating the providers
+func getProviderAuth() (secretsstore.ProviderAuth, error) {
+	providerAuth := secretsstore.ProviderAuth{
+		TLSCAFile:   *providerTLSCAFile,
+		TLSCertFile: *providerTLSCertFile,
+		TLSKeyFile:  *providerTLSKeyFile,
+	}
+	for _, uid := range strings.Split(*providerAllowedUIDs, ",") {
+		uid = strings.TrimSpace(uid)
+		if len(uid) == 0 {
+			continue
+		}
+		allowedUID, err := strconv.ParseUint(uid, 10, 32)
+		if err != nil {
+			return providerAuth, fmt.Errorf("invalid provider uid %s, err: %+v", uid, err)
+		}
+		providerAuth.AllowedUIDs = append(providerAuth.AllowedUIDs, uint32(allowedUID))
+	}
+	return providerAuth, nil
+}
+
+// getProviderSandbox returns the sandbox configuration for provider binaries
+func getProviderSandbox() (sandbox.Config, error) {
+	providerSandbox := sandbox.Config{
+		Timeout:        *providerExecTimeout,
+		MinimalEnv:     *providerExecMinimalEnv,
+		SeccompProfile: *providerExecSeccompProfile,
+	}
+	if *providerExecCPULimit != 0 {
+		// RLIMIT_CPU is set in seconds, limits below a second would disable the limit
+		if *providerExecCPULimit < time.Second {
+			return providerSandbox, fmt.Errorf("invalid provider cpu limit %s, the limit must be at least 1s", *providerExecCPULimit)
+		}
+		// round up to the next second to not kill the provider before the limit
+		providerSandbox.CPULimit = uint64((*providerExecCPULimit + time.Second - 1) / time.Second)
+	}
+	if len(*providerExecMemoryLimit) > 0 {
+		memoryLimit, err := resource.ParseQuantity(*providerExecMemoryLimit)
+		if err != nil {
+			return providerSandbox, fmt.Errorf("invalid provider memory limit %s, err: %+v", *providerExecMemoryLimit, err)
+		}
+		providerSandbox.MemoryLimit = uint64(memoryLimit.Value())
+	}
+	return providerSandbox, providerSandbox.Validate()
 }
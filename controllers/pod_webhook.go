@@ -0,0 +1,109 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+	"sigs.k8s.io/secrets-store-csi-driver/apis/v1alpha1"
+)
+
+// PodValidationPath is the path the validating webhook of the pods is served at
+const PodValidationPath = "/validate-v1-pod"
+
+const (
+	// secretProviderClassAttribute and clusterSecretProviderClassAttribute
+	// are the volume attributes of the secret provider class of a volume
+	secretProviderClassAttribute        = "secretProviderClass"
+	clusterSecretProviderClassAttribute = "clusterSecretProviderClass"
+)
+
+// +kubebuilder:webhook:path=/validate-v1-pod,mutating=false,failurePolicy=ignore,groups="",resources=pods,verbs=create,versions=v1,name=vpod.secrets-store.csi.x-k8s.io
+
+// PodValidator is the validating webhook that rejects the pods that mount a
+// secret provider class whose allowed namespaces or pod selector don't allow
+// the pod, so the pods fail at admission instead of when the volume is
+// mounted. The node server enforces the same restrictions.
+type PodValidator struct {
+	// Client reads the secret provider classes of the volumes
+	Client client.Reader
+	// DriverName is the name of the driver of the volumes that are validated
+	DriverName string
+	// DenySubPath rejects the pods with containers that mount a volume of the
+	// driver with subPath, as the rotated contents aren't visible to them
+	DenySubPath bool
+}
+
+var _ admission.Handler = &PodValidator{}
+
+// Handle denies the pod if it isn't allowed to mount the secret provider
+// class of one of its volumes. A pod whose secret provider class doesn't exist
+// yet is allowed, the volume isn't mounted until the class is created.
+func (v *PodValidator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	pod := &corev1.Pod{}
+	if err := json.Unmarshal(req.Object.Raw, pod); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	// the namespace isn't set in the pods created by the workload controllers
+	if len(pod.Namespace) == 0 {
+		pod.Namespace = req.Namespace
+	}
+	for _, volume := range pod.Spec.Volumes {
+		if volume.CSI == nil || volume.CSI.Driver != v.DriverName {
+			continue
+		}
+		if v.DenySubPath {
+			if containers := SubPathContainers(pod, volume.Name); len(containers) > 0 {
+				return admission.Denied(fmt.Sprintf("containers %s mount volume %s with subPath, the rotated contents of the volume aren't visible with subPath", strings.Join(containers, ", "), volume.Name))
+			}
+		}
+		name, kind := volume.CSI.VolumeAttributes[secretProviderClassAttribute], ""
+		if clusterName := volume.CSI.VolumeAttributes[clusterSecretProviderClassAttribute]; len(clusterName) > 0 {
+			name, kind = clusterName, v1alpha1.ClusterSecretProviderClassKind
+		}
+		if len(name) == 0 {
+			continue
+		}
+		spc, err := GetSecretProviderClass(ctx, v.Client, name, kind, pod.Namespace)
+		if apierrors.IsNotFound(err) {
+			continue
+		}
+		if errors.Is(err, ErrNamespaceNotSelected) {
+			return admission.Denied(err.Error())
+		}
+		if err != nil {
+			return admission.Errored(http.StatusInternalServerError, err)
+		}
+		if err := CheckPodAllowed(spc, pod); err != nil {
+			if errors.Is(err, ErrPodNotAllowed) {
+				return admission.Denied(err.Error())
+			}
+			return admission.Errored(http.StatusInternalServerError, err)
+		}
+	}
+	return admission.Allowed("")
+}
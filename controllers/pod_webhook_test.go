@@ -0,0 +1,194 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	"sigs.k8s.io/secrets-store-csi-driver/apis/v1alpha1"
+)
+
+func TestPodValidatorHandle(t *testing.T) {
+	scheme, err := setupScheme()
+	assert.NoError(t, err)
+
+	restricted := &v1alpha1.SecretProviderClass{
+		ObjectMeta: metav1.ObjectMeta{Name: "restricted", Namespace: "team-a"},
+		Spec: v1alpha1.SecretProviderClassSpec{
+			Provider:    "provider1",
+			PodSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "db"}},
+		},
+	}
+	open := &v1alpha1.SecretProviderClass{
+		ObjectMeta: metav1.ObjectMeta{Name: "open", Namespace: "team-a"},
+		Spec:       v1alpha1.SecretProviderClassSpec{Provider: "provider1"},
+	}
+	cluster := &v1alpha1.ClusterSecretProviderClass{
+		ObjectMeta: metav1.ObjectMeta{Name: "cluster"},
+		Spec: v1alpha1.ClusterSecretProviderClassSpec{
+			SecretProviderClassSpec: v1alpha1.SecretProviderClassSpec{Provider: "provider1", AllowedNamespaces: []string{"team-b"}},
+			NamespaceSelector:       &metav1.LabelSelector{},
+		},
+	}
+	namespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-a"}}
+	v := &PodValidator{
+		Client:     fake.NewFakeClientWithScheme(scheme, restricted, open, cluster, namespace),
+		DriverName: "secrets-store.csi.k8s.io",
+	}
+
+	newPod := func(labels map[string]string, driver string, attributes map[string]string) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "pod1", Labels: labels},
+			Spec: corev1.PodSpec{
+				Volumes: []corev1.Volume{
+					{Name: "config", VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}},
+					{Name: "secrets", VolumeSource: corev1.VolumeSource{CSI: &corev1.CSIVolumeSource{Driver: driver, VolumeAttributes: attributes}}},
+				},
+			},
+		}
+	}
+
+	cases := []struct {
+		name            string
+		pod             *corev1.Pod
+		expectedAllowed bool
+	}{
+		{
+			name:            "pod selected",
+			pod:             newPod(map[string]string{"app": "db"}, "secrets-store.csi.k8s.io", map[string]string{"secretProviderClass": "restricted"}),
+			expectedAllowed: true,
+		},
+		{
+			name:            "pod not selected",
+			pod:             newPod(map[string]string{"app": "web"}, "secrets-store.csi.k8s.io", map[string]string{"secretProviderClass": "restricted"}),
+			expectedAllowed: false,
+		},
+		{
+			name:            "unrestricted class",
+			pod:             newPod(nil, "secrets-store.csi.k8s.io", map[string]string{"secretProviderClass": "open"}),
+			expectedAllowed: true,
+		},
+		{
+			name:            "class not found",
+			pod:             newPod(nil, "secrets-store.csi.k8s.io", map[string]string{"secretProviderClass": "missing"}),
+			expectedAllowed: true,
+		},
+		{
+			name:            "namespace not allowed by cluster class",
+			pod:             newPod(nil, "secrets-store.csi.k8s.io", map[string]string{"clusterSecretProviderClass": "cluster"}),
+			expectedAllowed: false,
+		},
+		{
+			name:            "volume of another driver",
+			pod:             newPod(map[string]string{"app": "web"}, "other.csi.k8s.io", map[string]string{"secretProviderClass": "restricted"}),
+			expectedAllowed: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			raw, err := json.Marshal(tc.pod)
+			assert.NoError(t, err)
+			resp := v.Handle(context.TODO(), admission.Request{
+				AdmissionRequest: admissionv1beta1.AdmissionRequest{
+					Namespace: "team-a",
+					Object:    runtime.RawExtension{Raw: raw},
+				},
+			})
+			assert.Equal(t, tc.expectedAllowed, resp.Allowed)
+		})
+	}
+}
+
+func TestPodValidatorHandleSubPath(t *testing.T) {
+	scheme, err := setupScheme()
+	assert.NoError(t, err)
+
+	newPod := func(driver, subPath string) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "pod1"},
+			Spec: corev1.PodSpec{
+				Containers: []corev1.Container{
+					{Name: "app", VolumeMounts: []corev1.VolumeMount{{Name: "secrets", MountPath: "/etc/app/tls.crt", SubPath: subPath}}},
+				},
+				Volumes: []corev1.Volume{
+					{Name: "secrets", VolumeSource: corev1.VolumeSource{CSI: &corev1.CSIVolumeSource{Driver: driver, VolumeAttributes: map[string]string{"secretProviderClass": "open"}}}},
+				},
+			},
+		}
+	}
+
+	cases := []struct {
+		name            string
+		denySubPath     bool
+		pod             *corev1.Pod
+		expectedAllowed bool
+	}{
+		{
+			name:            "subPath denied",
+			denySubPath:     true,
+			pod:             newPod("secrets-store.csi.k8s.io", "tls.crt"),
+			expectedAllowed: false,
+		},
+		{
+			name:            "subPath allowed",
+			pod:             newPod("secrets-store.csi.k8s.io", "tls.crt"),
+			expectedAllowed: true,
+		},
+		{
+			name:            "volume mounted without subPath",
+			denySubPath:     true,
+			pod:             newPod("secrets-store.csi.k8s.io", ""),
+			expectedAllowed: true,
+		},
+		{
+			name:            "volume of another driver",
+			denySubPath:     true,
+			pod:             newPod("other.csi.k8s.io", "tls.crt"),
+			expectedAllowed: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			v := &PodValidator{
+				Client:      fake.NewFakeClientWithScheme(scheme),
+				DriverName:  "secrets-store.csi.k8s.io",
+				DenySubPath: tc.denySubPath,
+			}
+			raw, err := json.Marshal(tc.pod)
+			assert.NoError(t, err)
+			resp := v.Handle(context.TODO(), admission.Request{
+				AdmissionRequest: admissionv1beta1.AdmissionRequest{
+					Namespace: "team-a",
+					Object:    runtime.RawExtension{Raw: raw},
+				},
+			})
+			assert.Equal(t, tc.expectedAllowed, resp.Allowed)
+		})
+	}
+}
@@ -0,0 +1,229 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	"sigs.k8s.io/secrets-store-csi-driver/apis/v1alpha1"
+)
+
+const (
+	// secretProviderClassLeaseName is the name of the lease that elects the
+	// driver that sets the InUseByPods condition of the secret provider classes
+	secretProviderClassLeaseName = "secrets-store-csi-driver-secretproviderclass"
+
+	secretProviderClassLeaseDuration = 15 * time.Second
+	secretProviderClassRenewDeadline = 10 * time.Second
+	secretProviderClassRetryPeriod   = 2 * time.Second
+)
+
+// SecretProviderClassReconciler sets the InUseByPods condition of the secret
+// provider classes from the spc pod statuses of the pods that mount them. The
+// driver runs on every node, but the condition is cluster-wide, so only the
+// driver elected with the lease reconciles the secret provider classes. The
+// other drivers ignore the requests until they're elected.
+type SecretProviderClassReconciler struct {
+	client.Client
+	Reader client.Reader
+	// KubeClient is the client of the lease
+	KubeClient kubernetes.Interface
+	// LeaseNamespace is the namespace of the lease that elects the driver that
+	// reconciles the secret provider classes
+	LeaseNamespace string
+	// NodeID is the identity of the driver in the leader election
+	NodeID string
+
+	// leader is 1 while the driver holds the lease
+	leader int32
+	// resync requeues all the secret provider classes when the driver is
+	// elected, the requests before were ignored
+	resync chan event.GenericEvent
+}
+
+// +kubebuilder:rbac:groups=secrets-store.csi.x-k8s.io,resources=secretproviderclasses/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=coordination.k8s.io,resources=leases,verbs=get;create;update
+
+func (r *SecretProviderClassReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
+	ctx := context.Background()
+
+	if !r.IsLeader() {
+		return ctrl.Result{}, nil
+	}
+
+	spc := &v1alpha1.SecretProviderClass{}
+	if err := r.Reader.Get(ctx, req.NamespacedName, spc); err != nil {
+		if apierrors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, err
+	}
+	pods, err := r.mountingPods(ctx, spc)
+	if err != nil {
+		log.Errorf("failed to list spc pod statuses of spc %s, err: %+v", req.NamespacedName, err)
+		return ctrl.Result{}, err
+	}
+	if err := UpdateSecretProviderClassConditions(ctx, r.Client, spc, InUseByPodsCondition(pods)); err != nil {
+		log.Errorf("failed to update %s condition of spc %s, err: %+v", v1alpha1.InUseByPods, req.NamespacedName, err)
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{}, nil
+}
+
+// mountingPods returns the number of pods in the namespace of the secret
+// provider class that mount it and aren't deleted
+func (r *SecretProviderClassReconciler) mountingPods(ctx context.Context, spc *v1alpha1.SecretProviderClass) (int, error) {
+	pods, err := MountingPods(ctx, r.Reader, spc.Name, "", spc.Namespace)
+	return len(pods), err
+}
+
+// InUseByPodsCondition returns the InUseByPods condition for the number of
+// pods that mount the secret provider class
+func InUseByPodsCondition(pods int) v1alpha1.SecretProviderClassCondition {
+	if pods == 0 {
+		return v1alpha1.SecretProviderClassCondition{
+			Type:    v1alpha1.InUseByPods,
+			Status:  corev1.ConditionFalse,
+			Reason:  NoPodsReason,
+			Message: "not mounted by any pods",
+		}
+	}
+	return v1alpha1.SecretProviderClassCondition{
+		Type:    v1alpha1.InUseByPods,
+		Status:  corev1.ConditionTrue,
+		Reason:  PodsMountedReason,
+		Message: fmt.Sprintf("mounted by %d pods", pods),
+	}
+}
+
+// IsLeader returns true if the driver holds the lease
+func (r *SecretProviderClassReconciler) IsLeader() bool {
+	return atomic.LoadInt32(&r.leader) == 1
+}
+
+// setLeader records if the driver holds the lease
+func (r *SecretProviderClassReconciler) setLeader(leader bool) {
+	var value int32
+	if leader {
+		value = 1
+	}
+	atomic.StoreInt32(&r.leader, value)
+}
+
+// Start runs the leader election of the reconciler until the stop channel is
+// closed. It implements the manager.Runnable interface.
+func (r *SecretProviderClassReconciler) Start(stopCh <-chan struct{}) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-stopCh
+		cancel()
+	}()
+	lock := &resourcelock.LeaseLock{
+		LeaseMeta: metav1.ObjectMeta{
+			Name:      secretProviderClassLeaseName,
+			Namespace: r.LeaseNamespace,
+		},
+		Client:     r.KubeClient.CoordinationV1(),
+		LockConfig: resourcelock.ResourceLockConfig{Identity: r.NodeID},
+	}
+	// the leader election is retried after the lease is lost
+	wait.Until(func() {
+		leaderelection.RunOrDie(ctx, leaderelection.LeaderElectionConfig{
+			Lock:            lock,
+			ReleaseOnCancel: true,
+			LeaseDuration:   secretProviderClassLeaseDuration,
+			RenewDeadline:   secretProviderClassRenewDeadline,
+			RetryPeriod:     secretProviderClassRetryPeriod,
+			Callbacks: leaderelection.LeaderCallbacks{
+				OnStartedLeading: func(ctx context.Context) {
+					log.Infof("started reconciling secretproviderclasses on node %s", r.NodeID)
+					r.setLeader(true)
+					if err := r.resyncAll(ctx); err != nil {
+						log.Errorf("failed to resync secretproviderclasses, err: %+v", err)
+					}
+				},
+				OnStoppedLeading: func() {
+					log.Infof("stopped reconciling secretproviderclasses on node %s", r.NodeID)
+					r.setLeader(false)
+				},
+			},
+		})
+	}, time.Second, stopCh)
+	return nil
+}
+
+// resyncAll requeues all the secret provider classes
+func (r *SecretProviderClassReconciler) resyncAll(ctx context.Context) error {
+	spcs := &v1alpha1.SecretProviderClassList{}
+	if err := r.Reader.List(ctx, spcs); err != nil {
+		return err
+	}
+	for i := range spcs.Items {
+		spc := &spcs.Items[i]
+		select {
+		case r.resync <- event.GenericEvent{Meta: spc, Object: spc}:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+	return nil
+}
+
+func (r *SecretProviderClassReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	r.resync = make(chan event.GenericEvent)
+	if err := mgr.Add(r); err != nil {
+		return err
+	}
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&v1alpha1.SecretProviderClass{}).
+		Watches(&source.Channel{Source: r.resync}, &handler.EnqueueRequestForObject{}).
+		// the deleted spc pod statuses are mapped to their secret provider
+		// class with the last known state of the object
+		Watches(&source.Kind{Type: &v1alpha1.SecretProviderClassPodStatus{}}, &handler.EnqueueRequestsFromMapFunc{
+			ToRequests: handler.ToRequestsFunc(func(obj handler.MapObject) []reconcile.Request {
+				spcPodStatus, ok := obj.Object.(*v1alpha1.SecretProviderClassPodStatus)
+				if !ok || len(spcPodStatus.Status.SecretProviderClassName) == 0 || len(spcPodStatus.Status.SecretProviderClassKind) > 0 {
+					return nil
+				}
+				return []reconcile.Request{{NamespacedName: types.NamespacedName{
+					Namespace: spcPodStatus.Namespace,
+					Name:      spcPodStatus.Status.SecretProviderClassName,
+				}}}
+			}),
+		}).
+		Complete(r)
+}
@@ -0,0 +1,126 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/secrets-store-csi-driver/apis/v1alpha1"
+)
+
+func TestSecretProviderClassReconcile(t *testing.T) {
+	g := NewWithT(t)
+
+	scheme, err := setupScheme()
+	g.Expect(err).NotTo(HaveOccurred())
+
+	now := metav1.Now()
+	deleted := newSecretProviderClassPodStatus("pod3-default-spc1", "default", "node2")
+	deleted.DeletionTimestamp = &now
+	otherSPC := newSecretProviderClassPodStatus("pod4-default-spc2", "default", "node1")
+	otherSPC.Status.SecretProviderClassName = "spc2"
+	client := fake.NewFakeClientWithScheme(scheme,
+		&v1alpha1.SecretProviderClass{ObjectMeta: metav1.ObjectMeta{Name: "spc1", Namespace: "default"}},
+		&v1alpha1.SecretProviderClass{ObjectMeta: metav1.ObjectMeta{Name: "spc3", Namespace: "default"}},
+		newSecretProviderClassPodStatus("pod1-default-spc1", "default", "node1"),
+		newSecretProviderClassPodStatus("pod2-default-spc1", "default", "node2"),
+		deleted,
+		otherSPC,
+	)
+	reconciler := &SecretProviderClassReconciler{Client: client, Reader: client}
+
+	// the secret provider classes are only reconciled by the elected driver
+	_, err = reconciler.Reconcile(ctrl.Request{NamespacedName: types.NamespacedName{Name: "spc1", Namespace: "default"}})
+	g.Expect(err).NotTo(HaveOccurred())
+	spc := &v1alpha1.SecretProviderClass{}
+	g.Expect(client.Get(context.TODO(), types.NamespacedName{Name: "spc1", Namespace: "default"}, spc)).To(Succeed())
+	g.Expect(spc.Status.Conditions).To(BeEmpty())
+
+	reconciler.setLeader(true)
+
+	cases := []struct {
+		name            string
+		spc             string
+		expectedStatus  v1.ConditionStatus
+		expectedMessage string
+	}{
+		{
+			name:            "mounted by pods",
+			spc:             "spc1",
+			expectedStatus:  v1.ConditionTrue,
+			expectedMessage: "mounted by 2 pods",
+		},
+		{
+			name:            "not mounted",
+			spc:             "spc3",
+			expectedStatus:  v1.ConditionFalse,
+			expectedMessage: "not mounted by any pods",
+		},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			key := types.NamespacedName{Name: test.spc, Namespace: "default"}
+			_, err := reconciler.Reconcile(ctrl.Request{NamespacedName: key})
+			g.Expect(err).NotTo(HaveOccurred())
+
+			spc := &v1alpha1.SecretProviderClass{}
+			g.Expect(client.Get(context.TODO(), key, spc)).To(Succeed())
+			g.Expect(spc.Status.Conditions).To(HaveLen(1))
+			g.Expect(spc.Status.Conditions[0].Type).To(Equal(v1alpha1.InUseByPods))
+			g.Expect(spc.Status.Conditions[0].Status).To(Equal(test.expectedStatus))
+			g.Expect(spc.Status.Conditions[0].Message).To(Equal(test.expectedMessage))
+		})
+	}
+
+	// deleted secret provider classes are ignored
+	_, err = reconciler.Reconcile(ctrl.Request{NamespacedName: types.NamespacedName{Name: "notfound", Namespace: "default"}})
+	g.Expect(err).NotTo(HaveOccurred())
+}
+
+func TestSecretProviderClassResyncAll(t *testing.T) {
+	g := NewWithT(t)
+
+	scheme, err := setupScheme()
+	g.Expect(err).NotTo(HaveOccurred())
+
+	client := fake.NewFakeClientWithScheme(scheme,
+		&v1alpha1.SecretProviderClass{ObjectMeta: metav1.ObjectMeta{Name: "spc1", Namespace: "default"}},
+		&v1alpha1.SecretProviderClass{ObjectMeta: metav1.ObjectMeta{Name: "spc2", Namespace: "other"}},
+	)
+	reconciler := &SecretProviderClassReconciler{Client: client, Reader: client, resync: make(chan event.GenericEvent, 2)}
+
+	g.Expect(reconciler.resyncAll(context.TODO())).To(Succeed())
+	close(reconciler.resync)
+	var requeued []string
+	for evt := range reconciler.resync {
+		requeued = append(requeued, evt.Meta.GetNamespace()+"/"+evt.Meta.GetName())
+	}
+	g.Expect(requeued).To(ConsistOf("default/spc1", "other/spc2"))
+}
@@ -0,0 +1,100 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	"sigs.k8s.io/secrets-store-csi-driver/apis/v1alpha1"
+)
+
+// SecretProviderClassDeletionPath is the path the validating webhook that
+// protects the secret provider classes in use from deletion is served at
+const SecretProviderClassDeletionPath = "/validate-secrets-store-csi-x-k8s-io-secretproviderclass"
+
+// maxDeniedPods is the maximum number of pods listed in the message of a
+// denied deletion
+const maxDeniedPods = 5
+
+// +kubebuilder:webhook:path=/validate-secrets-store-csi-x-k8s-io-secretproviderclass,mutating=false,failurePolicy=ignore,groups=secrets-store.csi.x-k8s.io,resources=secretproviderclasses;clustersecretproviderclasses,verbs=delete,versions=v1;v1alpha1,name=vsecretproviderclass.secrets-store.csi.x-k8s.io
+
+// SecretProviderClassDeletionValidator is the validating webhook that rejects
+// the deletion of the secret provider classes that are mounted by pods, so
+// deleting a class doesn't break the rotation and the secret sync of the
+// running workloads. The class can be deleted once the pods that mount it are
+// deleted.
+type SecretProviderClassDeletionValidator struct {
+	// Client reads the spc pod statuses of the pods that mount the classes
+	Client client.Reader
+}
+
+var _ admission.Handler = &SecretProviderClassDeletionValidator{}
+
+// Handle denies the deletion of the secret provider class or cluster secret
+// provider class if it's mounted by pods that aren't deleted
+func (v *SecretProviderClassDeletionValidator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	if req.Operation != admissionv1beta1.Delete {
+		return admission.Allowed("")
+	}
+	kind, namespace, resource := "", req.Namespace, "secretproviderclass"
+	if req.Kind.Kind == v1alpha1.ClusterSecretProviderClassKind {
+		kind, namespace, resource = v1alpha1.ClusterSecretProviderClassKind, "", "clustersecretproviderclass"
+	}
+	pods, err := MountingPods(ctx, v.Client, req.Name, kind, namespace)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	if len(pods) == 0 {
+		return admission.Allowed("")
+	}
+	listed := pods
+	if len(listed) > maxDeniedPods {
+		listed = append(listed[:maxDeniedPods:maxDeniedPods], "...")
+	}
+	return admission.Denied(fmt.Sprintf("%s %s is mounted by %d pods: %s, delete the pods before the %s",
+		resource, req.Name, len(pods), strings.Join(listed, ", "), resource))
+}
+
+// MountingPods returns the sorted namespace/name of the pods that mount the
+// secret provider class of the kind and aren't deleted, from their spc pod
+// statuses. The pods of all namespaces are returned if the namespace is empty.
+func MountingPods(ctx context.Context, reader client.Reader, name, kind, namespace string) ([]string, error) {
+	list := &v1alpha1.SecretProviderClassPodStatusList{}
+	var opts []client.ListOption
+	if len(namespace) > 0 {
+		opts = append(opts, client.InNamespace(namespace))
+	}
+	if err := reader.List(ctx, list, opts...); err != nil {
+		return nil, err
+	}
+	var pods []string
+	for _, item := range list.Items {
+		if item.Status.SecretProviderClassName == name && item.Status.SecretProviderClassKind == kind && item.GetDeletionTimestamp().IsZero() {
+			pods = append(pods, fmt.Sprintf("%s/%s", item.Namespace, item.Status.PodName))
+		}
+	}
+	sort.Strings(pods)
+	return pods, nil
+}
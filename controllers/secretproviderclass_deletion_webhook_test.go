@@ -0,0 +1,147 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	"sigs.k8s.io/secrets-store-csi-driver/apis/v1alpha1"
+)
+
+func TestSecretProviderClassDeletionValidatorHandle(t *testing.T) {
+	scheme, err := setupScheme()
+	assert.NoError(t, err)
+
+	newPodStatus := func(name, namespace, spcName, spcKind string, deleted bool) *v1alpha1.SecretProviderClassPodStatus {
+		spcPodStatus := &v1alpha1.SecretProviderClassPodStatus{
+			ObjectMeta: metav1.ObjectMeta{Name: name + "-" + namespace + "-" + spcName, Namespace: namespace},
+			Status: v1alpha1.SecretProviderClassPodStatusStatus{
+				PodName:                 name,
+				SecretProviderClassName: spcName,
+				SecretProviderClassKind: spcKind,
+				Mounted:                 true,
+			},
+		}
+		if deleted {
+			now := metav1.NewTime(time.Now())
+			spcPodStatus.DeletionTimestamp = &now
+		}
+		return spcPodStatus
+	}
+	v := &SecretProviderClassDeletionValidator{
+		Client: fake.NewFakeClientWithScheme(scheme,
+			newPodStatus("pod1", "team-a", "in-use", "", false),
+			newPodStatus("pod2", "team-a", "in-use", "", false),
+			newPodStatus("pod3", "team-a", "terminating", "", true),
+			newPodStatus("pod4", "team-b", "other-namespace", "", false),
+			newPodStatus("pod5", "team-b", "cluster", v1alpha1.ClusterSecretProviderClassKind, false),
+			newPodStatus("pod6", "team-a", "unused-cluster", "", false),
+		),
+	}
+
+	cases := []struct {
+		name            string
+		kind            string
+		spcName         string
+		namespace       string
+		operation       admissionv1beta1.Operation
+		expectedAllowed bool
+		expectedMessage string
+	}{
+		{
+			name:            "mounted by pods",
+			kind:            "SecretProviderClass",
+			spcName:         "in-use",
+			namespace:       "team-a",
+			operation:       admissionv1beta1.Delete,
+			expectedAllowed: false,
+			expectedMessage: "secretproviderclass in-use is mounted by 2 pods: team-a/pod1, team-a/pod2, delete the pods before the secretproviderclass",
+		},
+		{
+			name:            "not mounted",
+			kind:            "SecretProviderClass",
+			spcName:         "unused",
+			namespace:       "team-a",
+			operation:       admissionv1beta1.Delete,
+			expectedAllowed: true,
+		},
+		{
+			name:            "pod status deleted",
+			kind:            "SecretProviderClass",
+			spcName:         "terminating",
+			namespace:       "team-a",
+			operation:       admissionv1beta1.Delete,
+			expectedAllowed: true,
+		},
+		{
+			name:            "mounted in another namespace",
+			kind:            "SecretProviderClass",
+			spcName:         "other-namespace",
+			namespace:       "team-a",
+			operation:       admissionv1beta1.Delete,
+			expectedAllowed: true,
+		},
+		{
+			name:            "cluster class mounted by pods",
+			kind:            v1alpha1.ClusterSecretProviderClassKind,
+			spcName:         "cluster",
+			operation:       admissionv1beta1.Delete,
+			expectedAllowed: false,
+			expectedMessage: "clustersecretproviderclass cluster is mounted by 1 pods: team-b/pod5, delete the pods before the clustersecretproviderclass",
+		},
+		{
+			name:            "cluster class with the name of a mounted class",
+			kind:            v1alpha1.ClusterSecretProviderClassKind,
+			spcName:         "unused-cluster",
+			operation:       admissionv1beta1.Delete,
+			expectedAllowed: true,
+		},
+		{
+			name:            "update of a mounted class",
+			kind:            "SecretProviderClass",
+			spcName:         "in-use",
+			namespace:       "team-a",
+			operation:       admissionv1beta1.Update,
+			expectedAllowed: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			resp := v.Handle(context.TODO(), admission.Request{
+				AdmissionRequest: admissionv1beta1.AdmissionRequest{
+					Kind:      metav1.GroupVersionKind{Group: v1alpha1.GroupVersion.Group, Version: v1alpha1.GroupVersion.Version, Kind: tc.kind},
+					Name:      tc.spcName,
+					Namespace: tc.namespace,
+					Operation: tc.operation,
+				},
+			})
+			assert.Equal(t, tc.expectedAllowed, resp.Allowed)
+			if !tc.expectedAllowed {
+				assert.Equal(t, tc.expectedMessage, string(resp.Result.Reason))
+			}
+		})
+	}
+}
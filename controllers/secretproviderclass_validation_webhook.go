@@ -0,0 +1,123 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	"sigs.k8s.io/secrets-store-csi-driver/apis/v1alpha1"
+)
+
+// SecretProviderClassValidationPath is the path the validating webhook that
+// rejects the invalid specs of the secret provider classes is served at
+const SecretProviderClassValidationPath = "/validate-spec-secrets-store-csi-x-k8s-io-secretproviderclass"
+
+// +kubebuilder:webhook:path=/validate-spec-secrets-store-csi-x-k8s-io-secretproviderclass,mutating=false,failurePolicy=ignore,groups=secrets-store.csi.x-k8s.io,resources=secretproviderclasses;clustersecretproviderclasses,verbs=create;update,versions=v1;v1alpha1,name=vspecsecretproviderclass.secrets-store.csi.x-k8s.io
+
+// SecretProviderClassValidator is the validating webhook that rejects the
+// secret provider classes the driver would fail to mount or sync, e.g. a
+// secret object without data. The rules are also CEL rules of the CRD schema,
+// which the API servers before Kubernetes 1.30 don't evaluate on create. An
+// update is only rejected if the class was valid before the update, so the
+// existing invalid classes can still be updated, e.g. to remove their
+// finalizers.
+type SecretProviderClassValidator struct{}
+
+var _ admission.Handler = &SecretProviderClassValidator{}
+
+// Handle denies the creation of an invalid secret provider class or cluster
+// secret provider class, and the update of a valid class to an invalid class
+func (v *SecretProviderClassValidator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	if req.Operation != admissionv1beta1.Create && req.Operation != admissionv1beta1.Update {
+		return admission.Allowed("")
+	}
+	// v1 and v1alpha1 share the same schema, and the spec of a cluster secret
+	// provider class inlines the spec of a secret provider class, so all of
+	// them are decoded into the v1alpha1 secret provider class spec
+	spec, err := decodeSecretProviderClassSpec(req.Object.Raw)
+	if err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	errs := ValidateSecretProviderClassSpec(spec)
+	if len(errs) == 0 {
+		return admission.Allowed("")
+	}
+	if req.Operation == admissionv1beta1.Update {
+		oldSpec, err := decodeSecretProviderClassSpec(req.OldObject.Raw)
+		if err != nil {
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+		if len(ValidateSecretProviderClassSpec(oldSpec)) > 0 {
+			return admission.Allowed("")
+		}
+	}
+	resource := "secretproviderclass"
+	if req.Kind.Kind == v1alpha1.ClusterSecretProviderClassKind {
+		resource = "clustersecretproviderclass"
+	}
+	return admission.Denied(fmt.Sprintf("%s %s is invalid: %s", resource, req.Name, strings.Join(errs, ", ")))
+}
+
+// decodeSecretProviderClassSpec returns the spec of the secret provider class
+// or cluster secret provider class decoded from json
+func decodeSecretProviderClassSpec(raw []byte) (*v1alpha1.SecretProviderClassSpec, error) {
+	spc := &v1alpha1.SecretProviderClass{}
+	if err := json.Unmarshal(raw, spc); err != nil {
+		return nil, err
+	}
+	return &spc.Spec, nil
+}
+
+// ValidateSecretProviderClassSpec returns the problems the driver would
+// reject the spec of a secret provider class for when it mounts the volumes
+// and syncs the secrets. The provider of a class that extends a base class is
+// inherited from the base class, so it isn't required.
+func ValidateSecretProviderClassSpec(spec *v1alpha1.SecretProviderClassSpec) []string {
+	var errs []string
+	if len(spec.Provider) == 0 && len(spec.Extends) == 0 {
+		errs = append(errs, "spec.provider: required")
+	}
+	for i, secretObj := range spec.SecretObjects {
+		path := fmt.Sprintf("spec.secretObjects[%d]", i)
+		if secretObj == nil {
+			errs = append(errs, path+": required")
+			continue
+		}
+		if len(secretObj.SecretName) == 0 {
+			errs = append(errs, path+".secretName: required")
+		}
+		if len(secretObj.Type) == 0 {
+			errs = append(errs, path+".type: required")
+		}
+		if len(secretObj.Data) == 0 {
+			errs = append(errs, path+".data: at least 1 entry required")
+		}
+		for j, data := range secretObj.Data {
+			if data == nil || len(data.Key) == 0 {
+				errs = append(errs, fmt.Sprintf("%s.data[%d].key: required", path, j))
+			}
+		}
+	}
+	return errs
+}
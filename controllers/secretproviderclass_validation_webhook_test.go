@@ -0,0 +1,161 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	"sigs.k8s.io/secrets-store-csi-driver/apis/v1alpha1"
+)
+
+func TestValidateSecretProviderClassSpec(t *testing.T) {
+	cases := []struct {
+		name         string
+		spec         v1alpha1.SecretProviderClassSpec
+		expectedErrs []string
+	}{
+		{
+			name: "valid",
+			spec: v1alpha1.SecretProviderClassSpec{
+				Provider: "provider1",
+				SecretObjects: []*v1alpha1.SecretObject{
+					{SecretName: "secret1", Type: "Opaque", Data: []*v1alpha1.SecretObjectData{{ObjectName: "obj1", Key: "key1"}}},
+				},
+			},
+		},
+		{
+			name: "provider inherited from the base class",
+			spec: v1alpha1.SecretProviderClassSpec{Extends: "base"},
+		},
+		{
+			name:         "provider not set",
+			spec:         v1alpha1.SecretProviderClassSpec{},
+			expectedErrs: []string{"spec.provider: required"},
+		},
+		{
+			name: "invalid secret objects",
+			spec: v1alpha1.SecretProviderClassSpec{
+				Provider: "provider1",
+				SecretObjects: []*v1alpha1.SecretObject{
+					{SecretName: "secret1", Type: "Opaque"},
+					{Data: []*v1alpha1.SecretObjectData{{ObjectName: "obj1"}}},
+				},
+			},
+			expectedErrs: []string{
+				"spec.secretObjects[0].data: at least 1 entry required",
+				"spec.secretObjects[1].secretName: required",
+				"spec.secretObjects[1].type: required",
+				"spec.secretObjects[1].data[0].key: required",
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expectedErrs, ValidateSecretProviderClassSpec(&tc.spec))
+		})
+	}
+}
+
+func TestSecretProviderClassValidatorHandle(t *testing.T) {
+	valid := []byte(`{"apiVersion":"secrets-store.csi.x-k8s.io/v1","kind":"SecretProviderClass","metadata":{"name":"spc1"},"spec":{"provider":"provider1","secretObjects":[{"secretName":"secret1","type":"Opaque","data":[{"objectName":"obj1","key":"key1"}]}]}}`)
+	invalid := []byte(`{"apiVersion":"secrets-store.csi.x-k8s.io/v1","kind":"SecretProviderClass","metadata":{"name":"spc1"},"spec":{"provider":"provider1","secretObjects":[{"secretName":"secret1","type":"Opaque"}]}}`)
+
+	cases := []struct {
+		name            string
+		kind            string
+		operation       admissionv1beta1.Operation
+		object          []byte
+		oldObject       []byte
+		expectedAllowed bool
+		expectedMessage string
+	}{
+		{
+			name:            "create a valid class",
+			kind:            "SecretProviderClass",
+			operation:       admissionv1beta1.Create,
+			object:          valid,
+			expectedAllowed: true,
+		},
+		{
+			name:            "create an invalid class",
+			kind:            "SecretProviderClass",
+			operation:       admissionv1beta1.Create,
+			object:          invalid,
+			expectedAllowed: false,
+			expectedMessage: "secretproviderclass spc1 is invalid: spec.secretObjects[0].data: at least 1 entry required",
+		},
+		{
+			name:            "create an invalid cluster class",
+			kind:            v1alpha1.ClusterSecretProviderClassKind,
+			operation:       admissionv1beta1.Create,
+			object:          invalid,
+			expectedAllowed: false,
+			expectedMessage: "clustersecretproviderclass spc1 is invalid: spec.secretObjects[0].data: at least 1 entry required",
+		},
+		{
+			name:            "update a valid class to an invalid class",
+			kind:            "SecretProviderClass",
+			operation:       admissionv1beta1.Update,
+			object:          invalid,
+			oldObject:       valid,
+			expectedAllowed: false,
+			expectedMessage: "secretproviderclass spc1 is invalid: spec.secretObjects[0].data: at least 1 entry required",
+		},
+		{
+			name:            "update an existing invalid class",
+			kind:            "SecretProviderClass",
+			operation:       admissionv1beta1.Update,
+			object:          invalid,
+			oldObject:       invalid,
+			expectedAllowed: true,
+		},
+		{
+			name:            "delete an invalid class",
+			kind:            "SecretProviderClass",
+			operation:       admissionv1beta1.Delete,
+			oldObject:       invalid,
+			expectedAllowed: true,
+		},
+	}
+
+	v := &SecretProviderClassValidator{}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			resp := v.Handle(context.TODO(), admission.Request{
+				AdmissionRequest: admissionv1beta1.AdmissionRequest{
+					Kind:      metav1.GroupVersionKind{Group: v1alpha1.GroupVersion.Group, Version: "v1", Kind: tc.kind},
+					Name:      "spc1",
+					Operation: tc.operation,
+					Object:    runtime.RawExtension{Raw: tc.object},
+					OldObject: runtime.RawExtension{Raw: tc.oldObject},
+				},
+			})
+			assert.Equal(t, tc.expectedAllowed, resp.Allowed)
+			if !tc.expectedAllowed {
+				assert.Equal(t, tc.expectedMessage, string(resp.Result.Reason))
+			}
+		})
+	}
+}
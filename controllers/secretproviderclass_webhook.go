@@ -0,0 +1,130 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+	"sigs.k8s.io/secrets-store-csi-driver/apis/v1alpha1"
+)
+
+// SecretProviderClassDefaultingPath is the path the defaulting webhook of the
+// secret provider classes is served at
+const SecretProviderClassDefaultingPath = "/mutate-secrets-store-csi-x-k8s-io-secretproviderclass"
+
+// SecretProviderClassConversionPath is the path the conversion webhook between
+// the versions of the secret provider classes is served at
+const SecretProviderClassConversionPath = "/convert"
+
+// +kubebuilder:webhook:path=/mutate-secrets-store-csi-x-k8s-io-secretproviderclass,mutating=true,failurePolicy=ignore,groups=secrets-store.csi.x-k8s.io,resources=secretproviderclasses,verbs=create;update,versions=v1;v1alpha1,name=msecretproviderclass.secrets-store.csi.x-k8s.io
+
+// SecretProviderClassDefaulter is the mutating webhook that sets the defaults
+// of the secret provider classes, so the defaults are visible in the stored
+// object and don't have to be repeated in every class
+type SecretProviderClassDefaulter struct {
+	// DefaultParameters are the parameters set for the keys that aren't set
+	// in the parameters of a provider, by provider name
+	DefaultParameters map[string]map[string]string
+}
+
+var _ admission.Handler = &SecretProviderClassDefaulter{}
+
+// Handle returns the patch that sets the defaults of the secret provider class
+func (d *SecretProviderClassDefaulter) Handle(ctx context.Context, req admission.Request) admission.Response {
+	// v1 and v1alpha1 share the same schema, so both versions are decoded into
+	// the v1alpha1 type. Only the spec is replaced, so the patch doesn't touch
+	// the apiVersion, metadata and status of the original object.
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(req.Object.Raw, &obj); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	spc := &v1alpha1.SecretProviderClass{}
+	if err := json.Unmarshal(req.Object.Raw, spc); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	DefaultSecretProviderClass(spc, d.DefaultParameters)
+	spec, err := json.Marshal(spc.Spec)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	obj["spec"] = spec
+	current, err := json.Marshal(obj)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	return admission.PatchResponseFromRaw(req.Object.Raw, current)
+}
+
+// DefaultSecretProviderClass sets the defaults of the secret provider class.
+// The parameters of the primary, fallback and additional providers are
+// defaulted with the default parameters of their provider.
+func DefaultSecretProviderClass(spc *v1alpha1.SecretProviderClass, defaultParameters map[string]map[string]string) {
+	spec := &spc.Spec
+	// the restart policy and parameters of a class that extends a base class
+	// are inherited from the base class if they aren't set
+	extends := len(spec.Extends) > 0
+	if len(spec.RestartPolicy) == 0 && !extends {
+		spec.RestartPolicy = v1alpha1.RestartPolicyNone
+	}
+	for _, secretObj := range spec.SecretObjects {
+		if secretObj == nil {
+			continue
+		}
+		if len(secretObj.Type) == 0 {
+			secretObj.Type = string(corev1.SecretTypeOpaque)
+		}
+		if len(secretObj.ConflictPolicy) == 0 {
+			secretObj.ConflictPolicy = v1alpha1.ConflictPolicyAdopt
+		}
+	}
+	if !extends {
+		spec.Parameters = defaultProviderParameters(spec.Parameters, defaultParameters[string(spec.Provider)])
+	}
+	if spec.Fallback != nil {
+		fallbackProvider := spec.Provider
+		if len(spec.Fallback.Provider) > 0 {
+			fallbackProvider = spec.Fallback.Provider
+		}
+		spec.Fallback.Parameters = defaultProviderParameters(spec.Fallback.Parameters, defaultParameters[string(fallbackProvider)])
+	}
+	for _, additionalProvider := range spec.AdditionalProviders {
+		if additionalProvider == nil {
+			continue
+		}
+		additionalProvider.Parameters = defaultProviderParameters(additionalProvider.Parameters, defaultParameters[string(additionalProvider.Provider)])
+	}
+}
+
+// defaultProviderParameters returns the parameters with the default parameters
+// set for the keys that aren't set
+func defaultProviderParameters(parameters, defaults map[string]string) map[string]string {
+	for k, v := range defaults {
+		if _, ok := parameters[k]; ok {
+			continue
+		}
+		if parameters == nil {
+			parameters = make(map[string]string, len(defaults))
+		}
+		parameters[k] = v
+	}
+	return parameters
+}
@@ -0,0 +1,170 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	apix "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/conversion"
+
+	secretsstorev1 "sigs.k8s.io/secrets-store-csi-driver/apis/v1"
+	"sigs.k8s.io/secrets-store-csi-driver/apis/v1alpha1"
+)
+
+func TestDefaultSecretProviderClass(t *testing.T) {
+	defaultParameters := map[string]map[string]string{
+		"vault": {"vaultAddress": "https://vault:8200", "roleName": "default"},
+		"azure": {"tenantId": "tenant1"},
+	}
+	spc := &v1alpha1.SecretProviderClass{
+		Spec: v1alpha1.SecretProviderClassSpec{
+			Provider:   "vault",
+			Parameters: map[string]string{"roleName": "app", "objects": "secret1"},
+			SecretObjects: []*v1alpha1.SecretObject{
+				{SecretName: "secret1"},
+				{SecretName: "secret2", Type: "kubernetes.io/tls", ConflictPolicy: v1alpha1.ConflictPolicyFail},
+			},
+			Fallback: &v1alpha1.FallbackProvider{},
+			AdditionalProviders: []*v1alpha1.AdditionalProvider{
+				{Provider: "azure"},
+				{Provider: "gcp", Parameters: map[string]string{"secrets": "secret2"}},
+			},
+			RestartPolicy: "",
+		},
+	}
+
+	DefaultSecretProviderClass(spc, defaultParameters)
+
+	assert.Equal(t, v1alpha1.RestartPolicyNone, spc.Spec.RestartPolicy)
+	assert.Equal(t, "Opaque", spc.Spec.SecretObjects[0].Type)
+	assert.Equal(t, v1alpha1.ConflictPolicyAdopt, spc.Spec.SecretObjects[0].ConflictPolicy)
+	assert.Equal(t, "kubernetes.io/tls", spc.Spec.SecretObjects[1].Type)
+	assert.Equal(t, v1alpha1.ConflictPolicyFail, spc.Spec.SecretObjects[1].ConflictPolicy)
+	// the parameters set in the class take precedence over the defaults
+	assert.Equal(t, map[string]string{"vaultAddress": "https://vault:8200", "roleName": "app", "objects": "secret1"}, spc.Spec.Parameters)
+	// the fallback provider defaults to the primary provider
+	assert.Equal(t, map[string]string{"vaultAddress": "https://vault:8200", "roleName": "default"}, spc.Spec.Fallback.Parameters)
+	assert.Equal(t, map[string]string{"tenantId": "tenant1"}, spc.Spec.AdditionalProviders[0].Parameters)
+	assert.Equal(t, map[string]string{"secrets": "secret2"}, spc.Spec.AdditionalProviders[1].Parameters)
+}
+
+func TestDefaultSecretProviderClassExtends(t *testing.T) {
+	spc := &v1alpha1.SecretProviderClass{
+		Spec: v1alpha1.SecretProviderClassSpec{
+			Provider:      "vault",
+			Parameters:    map[string]string{"objects": "secret1"},
+			SecretObjects: []*v1alpha1.SecretObject{{SecretName: "secret1"}},
+			Extends:       "base",
+		},
+	}
+
+	DefaultSecretProviderClass(spc, map[string]map[string]string{"vault": {"vaultAddress": "https://vault:8200"}})
+
+	// the restart policy and parameters are inherited from the base class
+	assert.Empty(t, spc.Spec.RestartPolicy)
+	assert.Equal(t, map[string]string{"objects": "secret1"}, spc.Spec.Parameters)
+	assert.Equal(t, "Opaque", spc.Spec.SecretObjects[0].Type)
+}
+
+func TestSecretProviderClassDefaulterHandle(t *testing.T) {
+	d := &SecretProviderClassDefaulter{
+		DefaultParameters: map[string]map[string]string{"vault": {"vaultAddress": "https://vault:8200"}},
+	}
+
+	raw := []byte(`{"apiVersion":"secrets-store.csi.x-k8s.io/v1","kind":"SecretProviderClass","metadata":{"name":"spc1","namespace":"default"},"spec":{"provider":"vault","parameters":{"objects":"secret1"},"restartPolicy":"Evict"}}`)
+	resp := d.Handle(context.TODO(), admission.Request{
+		AdmissionRequest: admissionv1beta1.AdmissionRequest{
+			Object: runtime.RawExtension{Raw: raw},
+		},
+	})
+	assert.True(t, resp.Allowed)
+	patches, err := json.Marshal(resp.Patches)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `[{"op":"add","path":"/spec/parameters/vaultAddress","value":"https://vault:8200"}]`, string(patches))
+
+	resp = d.Handle(context.TODO(), admission.Request{
+		AdmissionRequest: admissionv1beta1.AdmissionRequest{
+			Object: runtime.RawExtension{Raw: []byte(`{"spec":`)},
+		},
+	})
+	assert.False(t, resp.Allowed)
+}
+
+func TestSecretProviderClassConversionWebhook(t *testing.T) {
+	scheme, err := setupScheme()
+	assert.NoError(t, err)
+	assert.NoError(t, secretsstorev1.AddToScheme(scheme))
+	wh := &conversion.Webhook{}
+	assert.NoError(t, wh.InjectScheme(scheme))
+
+	cases := []struct {
+		name              string
+		apiVersion        string
+		desiredAPIVersion string
+	}{
+		{
+			name:              "v1alpha1 to v1",
+			apiVersion:        "secrets-store.csi.x-k8s.io/v1alpha1",
+			desiredAPIVersion: "secrets-store.csi.x-k8s.io/v1",
+		},
+		{
+			name:              "v1 to v1alpha1",
+			apiVersion:        "secrets-store.csi.x-k8s.io/v1",
+			desiredAPIVersion: "secrets-store.csi.x-k8s.io/v1alpha1",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			spec := `{"provider":"vault","parameters":{"roleName":"app"},"secretObjects":[{"secretName":"secret1","type":"Opaque","data":[{"objectName":"object1","key":"key1"}]}],"restartPolicy":"Evict"}`
+			raw := []byte(`{"apiVersion":"` + tc.apiVersion + `","kind":"SecretProviderClass","metadata":{"name":"spc1","namespace":"default"},"spec":` + spec + `}`)
+			review, err := json.Marshal(&apix.ConversionReview{
+				TypeMeta: metav1.TypeMeta{Kind: "ConversionReview", APIVersion: "apiextensions.k8s.io/v1beta1"},
+				Request: &apix.ConversionRequest{
+					UID:               "uid1",
+					DesiredAPIVersion: tc.desiredAPIVersion,
+					Objects:           []runtime.RawExtension{{Raw: raw}},
+				},
+			})
+			assert.NoError(t, err)
+
+			rec := httptest.NewRecorder()
+			wh.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, SecretProviderClassConversionPath, bytes.NewReader(review)))
+			assert.Equal(t, http.StatusOK, rec.Code)
+
+			resp := &apix.ConversionReview{}
+			assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), resp))
+			assert.Equal(t, "Success", resp.Response.Result.Status)
+			assert.Len(t, resp.Response.ConvertedObjects, 1)
+			var converted map[string]json.RawMessage
+			assert.NoError(t, json.Unmarshal(resp.Response.ConvertedObjects[0].Raw, &converted))
+			assert.JSONEq(t, `"`+tc.desiredAPIVersion+`"`, string(converted["apiVersion"]))
+			assert.JSONEq(t, spec, string(converted["spec"]))
+		})
+	}
+}
@@ -18,6 +18,7 @@ package controllers
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"strings"
@@ -32,11 +33,11 @@ import (
 	log "github.com/sirupsen/logrus"
 	corev1 "k8s.io/api/core/v1"
 	v1 "k8s.io/api/core/v1"
-	"k8s.io/apimachinery/pkg/api/errors"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/secrets-store-csi-driver/apis/v1alpha1"
@@ -45,6 +46,31 @@ import (
 const (
 	certType       = "CERTIFICATE"
 	privateKeyType = "RSA PRIVATE KEY"
+
+	// FieldManager is the field manager of the synced secrets and configmaps
+	FieldManager = "secrets-store-csi-driver"
+
+	// SecretSyncedReason is the reason of the SecretSynced condition when the
+	// secret objects were synced
+	SecretSyncedReason = "Synced"
+	// SecretSyncFailedReason is the reason of the SecretSynced condition when
+	// syncing the secret objects failed
+	SecretSyncFailedReason = "SyncFailed"
+	// ProviderReachableReason is the reason of the ProviderReachable condition
+	// when the provider was called
+	ProviderReachableReason = "Reachable"
+	// ProviderUnreachableReason is the reason of the ProviderReachable
+	// condition when the provider couldn't be reached
+	ProviderUnreachableReason = "Unreachable"
+	// PodsMountedReason is the reason of the InUseByPods condition when pods
+	// mount the secret provider class
+	PodsMountedReason = "PodsMounted"
+	// NoPodsReason is the reason of the InUseByPods condition when no pods
+	// mount the secret provider class
+	NoPodsReason = "NoPods"
+	// MountSucceededReason is the reason of the LastMountError condition when
+	// the last mount succeeded
+	MountSucceededReason = "MountSucceeded"
 )
 
 // SecretProviderClassPodStatusReconciler reconciles a SecretProviderClassPodStatus object
@@ -55,11 +81,30 @@ type SecretProviderClassPodStatusReconciler struct {
 	NodeID string
 	Reader client.Reader
 	Writer client.Writer
+	// SyncNamespaces are the namespaces the secrets can be synced into from
+	// other namespaces
+	SyncNamespaces []string
+	// APIReader reads the nodes of the deleted spc pod statuses from the API
+	// server, so the drivers don't cache the nodes of the cluster
+	APIReader client.Reader
+	// IsLeader returns true if the driver is elected to clean up the synced
+	// secrets of the deleted spc pod statuses whose node is gone
+	IsLeader func() bool
 }
 
+// deletedStatusRequeueInterval is the interval the deleted spc pod statuses
+// whose synced secrets are cleaned up by another driver are checked again, in
+// case the node of the pod is gone or the elected driver changed
+const deletedStatusRequeueInterval = time.Minute
+
 // +kubebuilder:rbac:groups=secrets-store.csi.x-k8s.io,resources=secretproviderclasspodstatuses,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=secrets-store.csi.x-k8s.io,resources=secretproviderclasspodstatuses/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=secrets-store.csi.x-k8s.io,resources=secretproviderclasses,verbs=get;list;watch
+// +kubebuilder:rbac:groups=secrets-store.csi.x-k8s.io,resources=clustersecretproviderclasses,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=namespaces,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=pods,verbs=get;list
+// +kubebuilder:rbac:groups="",resources=nodes,verbs=get
+// +kubebuilder:rbac:groups="",resources=events,verbs=create;patch
 
 func (r *SecretProviderClassPodStatusReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 	ctx := context.Background()
@@ -75,8 +120,24 @@ func (r *SecretProviderClassPodStatusReconciler) Reconcile(req ctrl.Request) (ct
 		return ctrl.Result{}, err
 	}
 
-	// reconcile delete
+	// reconcile delete. The synced secrets are cleaned up by the driver of the
+	// node of the pod, or by the elected driver if the node is gone.
 	if !spcPodStatus.GetDeletionTimestamp().IsZero() {
+		if !hasFinalizer(&spcPodStatus, v1alpha1.SyncedSecretsFinalizer) {
+			return ctrl.Result{}, nil
+		}
+		cleanup, err := r.cleansUpDeletedStatus(ctx, &spcPodStatus)
+		if err != nil {
+			logger.Errorf("failed to check the node of the deleted spc pod status, err: %+v", err)
+			return ctrl.Result{RequeueAfter: deletedStatusRequeueInterval}, nil
+		}
+		if !cleanup {
+			return ctrl.Result{RequeueAfter: deletedStatusRequeueInterval}, nil
+		}
+		if err := r.cleanupSyncedSecrets(ctx, &spcPodStatus); err != nil {
+			logger.Errorf("failed to clean up synced secrets, err: %+v", err)
+			return ctrl.Result{RequeueAfter: 5 * time.Second}, err
+		}
 		logger.Infof("reconcile complete")
 		return ctrl.Result{}, nil
 	}
@@ -92,8 +153,8 @@ func (r *SecretProviderClassPodStatusReconciler) Reconcile(req ctrl.Request) (ct
 	}
 
 	spcName := spcPodStatus.Status.SecretProviderClassName
-	spc := &v1alpha1.SecretProviderClass{}
-	if err := r.Reader.Get(ctx, client.ObjectKey{Namespace: req.Namespace, Name: spcName}, spc); err != nil {
+	spc, err := GetSecretProviderClass(ctx, r.Reader, spcName, spcPodStatus.Status.SecretProviderClassKind, req.Namespace)
+	if err != nil {
 		logger.Errorf("failed to get spc %s, err: %+v", spcName, err)
 		if apierrors.IsNotFound(err) {
 			return ctrl.Result{RequeueAfter: 5 * time.Second}, nil
@@ -101,17 +162,30 @@ func (r *SecretProviderClassPodStatusReconciler) Reconcile(req ctrl.Request) (ct
 		return ctrl.Result{}, err
 	}
 
-	if len(spc.Spec.SecretObjects) == 0 {
+	if len(spc.Spec.SecretObjects) == 0 && len(spc.Spec.ConfigMapObjects) == 0 {
 		logger.Infof("no secret objects defined for spc, nothing to reconcile")
 		return ctrl.Result{}, nil
 	}
 
+	// the finalizer is set before the secrets are synced, so they're removed
+	// even if the node crashes before the pod is deleted
+	if len(spc.Spec.SecretObjects) > 0 && !hasFinalizer(&spcPodStatus, v1alpha1.SyncedSecretsFinalizer) {
+		patch := client.MergeFromWithOptions(spcPodStatus.DeepCopy(), client.MergeFromWithOptimisticLock{})
+		controllerutil.AddFinalizer(&spcPodStatus, v1alpha1.SyncedSecretsFinalizer)
+		if err := r.Writer.Patch(ctx, &spcPodStatus, patch); err != nil {
+			logger.Errorf("failed to add finalizer, err: %+v", err)
+			return ctrl.Result{}, err
+		}
+	}
+
 	files, err := getMountedFiles(spcPodStatus.Status.TargetPath)
 	if err != nil {
 		logger.Errorf("failed to get mounted files, err: %+v", err)
 		return ctrl.Result{RequeueAfter: 10 * time.Second}, err
 	}
 	errs := make([]error, 0)
+	// updated is true if any of the synced secrets was created
+	updated := false
 	for idx, secretObj := range spc.Spec.SecretObjects {
 		if len(secretObj.SecretName) == 0 {
 			logger.Errorf("secret name is empty at index %d", idx)
@@ -128,20 +202,46 @@ func (r *SecretProviderClassPodStatusReconciler) Reconcile(req ctrl.Request) (ct
 			errs = append(errs, fmt.Errorf("data is empty at index %d for secret %s", idx, secretObj.SecretName))
 			continue
 		}
-		exists, err := r.secretExists(ctx, secretObj.SecretName, req.Namespace)
+		namespace := req.Namespace
+		if len(secretObj.Namespace) > 0 && secretObj.Namespace != req.Namespace {
+			if err := CrossNamespaceSyncAllowed(ctx, r.Reader, r.SyncNamespaces, req.Namespace, secretObj.Namespace); err != nil {
+				logger.Errorf("failed to sync secret %s into namespace %s, err: %v", secretObj.SecretName, secretObj.Namespace, err)
+				errs = append(errs, fmt.Errorf("failed to sync secret %s into namespace %s, err: %v", secretObj.SecretName, secretObj.Namespace, err))
+				continue
+			}
+			namespace = secretObj.Namespace
+		}
+		exists, err := r.secretExists(ctx, secretObj.SecretName, namespace)
 		if err != nil {
 			logger.Errorf("failed to check if secret %s exists, err: %+v", secretObj.SecretName, err)
 			errs = append(errs, fmt.Errorf("failed to check if secret %s exists, err: %+v", secretObj.SecretName, err))
 			continue
 		}
+		// existing secrets that aren't managed by the driver are adopted, or
+		// synced with the conflict policy of the secret object
+		adopt := true
+		if exists && len(secretObj.ConflictPolicy) > 0 && secretObj.ConflictPolicy != v1alpha1.ConflictPolicyAdopt {
+			managed, err := r.secretManaged(ctx, secretObj.SecretName, namespace)
+			if err != nil {
+				logger.Errorf("failed to get secret %s, err: %+v", secretObj.SecretName, err)
+				errs = append(errs, fmt.Errorf("failed to get secret %s, err: %+v", secretObj.SecretName, err))
+				continue
+			}
+			if !managed && secretObj.ConflictPolicy == v1alpha1.ConflictPolicyFail {
+				logger.Errorf("secret %s already exists and isn't managed by the driver", secretObj.SecretName)
+				errs = append(errs, fmt.Errorf("secret %s already exists and isn't managed by the driver", secretObj.SecretName))
+				continue
+			}
+			adopt = managed
+		}
 		funcs := []func() (bool, error){}
 
-		if !exists {
-			secretType := getSecretType(secretObj.Type)
+		if !exists || !adopt {
+			secretType := GetSecretType(secretObj.Type)
 			datamap := make(map[string][]byte)
 
 			for _, data := range secretObj.Data {
-				if len(data.ObjectName) == 0 {
+				if len(data.ObjectName) == 0 && len(data.Template) == 0 {
 					logger.Errorf("object name in data is empty at index %d for secret %s", idx, secretObj.SecretName)
 					errs = append(errs, fmt.Errorf("object name in data is empty at index %d for secret %s", idx, secretObj.SecretName))
 					continue
@@ -151,6 +251,22 @@ func (r *SecretProviderClassPodStatusReconciler) Reconcile(req ctrl.Request) (ct
 					errs = append(errs, fmt.Errorf("key in data is empty at index %d for secret %s", idx, secretObj.SecretName))
 					continue
 				}
+				if len(data.Template) > 0 {
+					content, err := RenderSecretTemplate(data.Template, func(objectName string) ([]byte, error) {
+						file, ok := files[objectName]
+						if !ok {
+							return nil, fmt.Errorf("file matching objectName %s not found", objectName)
+						}
+						return ioutil.ReadFile(file)
+					})
+					if err != nil {
+						logger.Errorf("failed to render template for key %s, err: %v for secret: %s", data.Key, err, secretObj.SecretName)
+						errs = append(errs, fmt.Errorf("failed to render template for key %s, err: %v for secret: %s", data.Key, err, secretObj.SecretName))
+						continue
+					}
+					datamap[data.Key] = content
+					continue
+				}
 				file, ok := files[data.ObjectName]
 				if !ok {
 					logger.Errorf("file matching objectName %s not found for secret %s", data.ObjectName, secretObj.SecretName)
@@ -164,7 +280,7 @@ func (r *SecretProviderClassPodStatusReconciler) Reconcile(req ctrl.Request) (ct
 				}
 				datamap[data.Key] = content
 				if secretType == corev1.SecretTypeTLS {
-					c, err := getCertPart(content, data.Key)
+					c, err := GetCertPart(content, data.Key)
 					if err != nil {
 						logger.Errorf("failed to get cert data from file %s, err: %v for secret: %s", file, err, secretObj.SecretName)
 						return ctrl.Result{RequeueAfter: 5 * time.Second}, status.Error(codes.Internal, err.Error())
@@ -173,25 +289,113 @@ func (r *SecretProviderClassPodStatusReconciler) Reconcile(req ctrl.Request) (ct
 				}
 			}
 
+			if err := ValidateSecretData(secretType, datamap); err != nil {
+				logger.Errorf("invalid data for secret %s, err: %v", secretObj.SecretName, err)
+				errs = append(errs, fmt.Errorf("invalid data for secret %s, err: %v", secretObj.SecretName, err))
+				continue
+			}
+
 			createFn := func() (bool, error) {
-				if err := r.createK8sSecret(ctx, secretObj.SecretName, req.Namespace, datamap, secretObj.Labels, secretType); err != nil {
+				if err := r.createK8sSecret(ctx, secretObj.SecretName, namespace, datamap, secretObj.Labels, secretObj.Annotations, secretType, syncedFrom(&spcPodStatus)); err != nil {
 					logger.Errorf("failed createK8sSecret, err: %v for secret: %s", err, secretObj.SecretName)
 					return false, nil
 				}
 				return true, nil
 			}
-			funcs = append(funcs, createFn)
+			mergeFn := func() (bool, error) {
+				if err := r.mergeK8sSecret(ctx, secretObj.SecretName, namespace, datamap, secretObj.Labels, secretObj.Annotations); err != nil {
+					logger.Errorf("failed mergeK8sSecret, err: %v for secret: %s", err, secretObj.SecretName)
+					return false, nil
+				}
+				return true, nil
+			}
+			if !exists {
+				funcs = append(funcs, createFn)
+			} else {
+				funcs = append(funcs, mergeFn)
+			}
 		}
 
-		// patch the secret with the owner reference
+		// patch the secret with the owner reference. Owner references can't
+		// cross namespaces, so secrets synced into another namespace aren't
+		// garbage collected.
 		patchFn := func() (bool, error) {
-			if err := r.patchSecretWithOwnerRef(ctx, secretObj.SecretName, req.Namespace, &spcPodStatus); err != nil {
+			if err := r.patchSecretWithOwnerRef(ctx, secretObj.SecretName, namespace, &spcPodStatus); err != nil {
 				logger.Errorf("failed to set owner ref for secret, err: %+v", err)
 				return false, nil
 			}
 			return true, nil
 		}
 
+		if adopt && namespace == req.Namespace {
+			funcs = append(funcs, patchFn)
+		}
+		for _, f := range funcs {
+			if err := wait.ExponentialBackoff(wait.Backoff{
+				Steps:    5,
+				Duration: 1 * time.Millisecond,
+				Factor:   1.0,
+				Jitter:   0.1,
+			}, f); err != nil {
+				r.updateSecretSyncedCondition(ctx, spc, fmt.Errorf("failed to sync secret %s, err: %v", secretObj.SecretName, err), updated)
+				return ctrl.Result{RequeueAfter: 5 * time.Second}, err
+			}
+		}
+		if !exists {
+			updated = true
+		}
+	}
+	if len(spc.Spec.SecretObjects) > 0 {
+		r.updateSecretSyncedCondition(ctx, spc, utilerrors.NewAggregate(errs), updated)
+	}
+
+	for idx, configMapObj := range spc.Spec.ConfigMapObjects {
+		if len(configMapObj.ConfigMapName) == 0 {
+			logger.Errorf("configmap name is empty at index %d", idx)
+			errs = append(errs, fmt.Errorf("configmap name is empty at index %d", idx))
+			continue
+		}
+		exists, err := r.configMapExists(ctx, configMapObj.ConfigMapName, req.Namespace)
+		if err != nil {
+			logger.Errorf("failed to check if configmap %s exists, err: %+v", configMapObj.ConfigMapName, err)
+			errs = append(errs, fmt.Errorf("failed to check if configmap %s exists, err: %+v", configMapObj.ConfigMapName, err))
+			continue
+		}
+		funcs := []func() (bool, error){}
+
+		if !exists {
+			datamap, err := ConfigMapData(configMapObj.Data, func(objectName string) ([]byte, error) {
+				file, ok := files[objectName]
+				if !ok {
+					return nil, fmt.Errorf("file matching objectName %s not found", objectName)
+				}
+				return ioutil.ReadFile(file)
+			})
+			if err != nil {
+				logger.Errorf("failed to get data for configmap %s, err: %v", configMapObj.ConfigMapName, err)
+				errs = append(errs, fmt.Errorf("failed to get data for configmap %s, err: %v", configMapObj.ConfigMapName, err))
+				continue
+			}
+
+			createFn := func() (bool, error) {
+				if err := r.createK8sConfigMap(ctx, configMapObj.ConfigMapName, req.Namespace, datamap, configMapObj.Labels, configMapObj.Annotations); err != nil {
+					logger.Errorf("failed createK8sConfigMap, err: %v for configmap: %s", err, configMapObj.ConfigMapName)
+					return false, nil
+				}
+				return true, nil
+			}
+			funcs = append(funcs, createFn)
+		}
+
+		// patch the configmap with the owner reference
+		patchFn := func() (bool, error) {
+			if err := r.patchConfigMapWithOwnerRef(ctx, configMapObj.ConfigMapName, req.Namespace, &spcPodStatus); err != nil {
+				logger.Errorf("failed to set owner ref for configmap, err: %+v", err)
+				return false, nil
+			}
+			return true, nil
+		}
+
 		funcs = append(funcs, patchFn)
 		for _, f := range funcs {
 			if err := wait.ExponentialBackoff(wait.Backoff{
@@ -222,20 +426,173 @@ func (r *SecretProviderClassPodStatusReconciler) SetupWithManager(mgr ctrl.Manag
 		Complete(r)
 }
 
-// createK8sSecret creates K8s secret with data from mounted files
+// updateSecretSyncedCondition sets the SecretSynced condition of the secret
+// provider class to the result of the sync. Failures are only logged, the
+// condition is updated again in the next reconcile.
+func (r *SecretProviderClassPodStatusReconciler) updateSecretSyncedCondition(ctx context.Context, spc *v1alpha1.SecretProviderClass, syncErr error, updated bool) {
+	if err := UpdateSecretSyncedCondition(ctx, r.Client, spc, syncErr, updated); err != nil {
+		log.Errorf("failed to update %s condition of spc %s/%s, err: %+v", v1alpha1.SecretSynced, spc.Namespace, spc.Name, err)
+	}
+}
+
+// cleanupSyncedSecrets deletes the secrets synced for the spc pod status, unless
+// the secret provider class is still used by other pods in the namespace, and
+// removes the finalizer. Secrets that aren't managed by the driver, e.g. merged
+// secrets, or that were synced from another secret provider class are kept.
+// Secrets in other namespaces are only deleted if the secret provider class is
+// still allowed to sync into the namespace.
+func (r *SecretProviderClassPodStatusReconciler) cleanupSyncedSecrets(ctx context.Context, spcPodStatus *v1alpha1.SecretProviderClassPodStatus) error {
+	if !hasFinalizer(spcPodStatus, v1alpha1.SyncedSecretsFinalizer) {
+		return nil
+	}
+	spc, err := GetSecretProviderClass(ctx, r.Reader, spcPodStatus.Status.SecretProviderClassName, spcPodStatus.Status.SecretProviderClassKind, spcPodStatus.Namespace)
+	if err != nil && !apierrors.IsNotFound(err) && !errors.Is(err, ErrNamespaceNotSelected) {
+		return err
+	}
+	// the secret objects are unknown once the secret provider class is deleted
+	// or no longer selects the namespace, the secrets in the namespace of the
+	// pod are garbage collected with their owner references
+	if spc == nil {
+		spc = &v1alpha1.SecretProviderClass{}
+	}
+	inUse, err := r.secretProviderClassInUse(ctx, spcPodStatus)
+	if err != nil {
+		return err
+	}
+	if !inUse {
+		for _, secretObj := range spc.Spec.SecretObjects {
+			if len(secretObj.SecretName) == 0 {
+				continue
+			}
+			namespace := spcPodStatus.Namespace
+			if len(secretObj.Namespace) > 0 && secretObj.Namespace != spcPodStatus.Namespace {
+				if err := CrossNamespaceSyncAllowed(ctx, r.Reader, r.SyncNamespaces, spcPodStatus.Namespace, secretObj.Namespace); err != nil {
+					log.Warningf("keeping secret %s/%s, err: %v", secretObj.Namespace, secretObj.SecretName, err)
+					continue
+				}
+				namespace = secretObj.Namespace
+			}
+			if err := r.deleteManagedSecret(ctx, secretObj.SecretName, namespace, spcPodStatus); err != nil {
+				return err
+			}
+		}
+	}
+
+	patch := client.MergeFromWithOptions(spcPodStatus.DeepCopy(), client.MergeFromWithOptimisticLock{})
+	controllerutil.RemoveFinalizer(spcPodStatus, v1alpha1.SyncedSecretsFinalizer)
+	return r.Writer.Patch(ctx, spcPodStatus, patch)
+}
+
+// cleansUpDeletedStatus returns true if the synced secrets of the deleted spc
+// pod status are cleaned up by this driver. They're cleaned up by the driver
+// of the node of the pod, or by the driver elected with the secretproviderclass
+// lease if the node is gone, so the drivers of all nodes don't clean up the
+// same secrets.
+func (r *SecretProviderClassPodStatusReconciler) cleansUpDeletedStatus(ctx context.Context, spcPodStatus *v1alpha1.SecretProviderClassPodStatus) (bool, error) {
+	node, ok := spcPodStatus.GetLabels()[v1alpha1.InternalNodeLabel]
+	if ok && strings.EqualFold(node, r.NodeID) {
+		return true, nil
+	}
+	if r.IsLeader == nil || !r.IsLeader() {
+		return false, nil
+	}
+	if !ok {
+		return true, nil
+	}
+	err := r.APIReader.Get(ctx, types.NamespacedName{Name: node}, &corev1.Node{})
+	if apierrors.IsNotFound(err) {
+		return true, nil
+	}
+	return false, err
+}
+
+// secretProviderClassInUse checks if the secret provider class of the spc pod
+// status is used by other pods in the namespace that aren't deleted. The pods
+// of other namespaces don't sync from the same secret provider class, as cluster
+// secret provider classes are synced from as the namespace of the pod.
+func (r *SecretProviderClassPodStatusReconciler) secretProviderClassInUse(ctx context.Context, spcPodStatus *v1alpha1.SecretProviderClassPodStatus) (bool, error) {
+	list := &v1alpha1.SecretProviderClassPodStatusList{}
+	if err := r.Reader.List(ctx, list, client.InNamespace(spcPodStatus.Namespace)); err != nil {
+		return false, err
+	}
+	for _, item := range list.Items {
+		if item.Name == spcPodStatus.Name || !item.GetDeletionTimestamp().IsZero() {
+			continue
+		}
+		if item.Status.SecretProviderClassName == spcPodStatus.Status.SecretProviderClassName &&
+			item.Status.SecretProviderClassKind == spcPodStatus.Status.SecretProviderClassKind {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// deleteManagedSecret deletes the secret with name and namespace if it's
+// managed by the driver and was synced from the secret provider class of the
+// spc pod status. Secrets without the SyncedFromAnnotation, synced before the
+// annotation was set, are only deleted in the namespace of the pod.
+func (r *SecretProviderClassPodStatusReconciler) deleteManagedSecret(ctx context.Context, name, namespace string, spcPodStatus *v1alpha1.SecretProviderClassPodStatus) error {
+	secret := &corev1.Secret{}
+	if err := r.Client.Get(ctx, types.NamespacedName{Namespace: namespace, Name: name}, secret); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	if !IsManagedSecret(secret) {
+		return nil
+	}
+	source, ok := secret.GetAnnotations()[v1alpha1.SyncedFromAnnotation]
+	if ok && source != syncedFrom(spcPodStatus) || !ok && namespace != spcPodStatus.Namespace {
+		log.Infof("keeping k8s secret %s/%s synced from %q", namespace, name, source)
+		return nil
+	}
+	if err := r.Writer.Delete(ctx, secret); err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+	log.Infof("deleted k8s secret: %s/%s", namespace, name)
+	return nil
+}
+
+// syncedFrom returns the SyncedFromAnnotation value of the secrets synced for
+// the spc pod status
+func syncedFrom(spcPodStatus *v1alpha1.SecretProviderClassPodStatus) string {
+	return SyncedFrom(spcPodStatus.Namespace, spcPodStatus.Status.SecretProviderClassKind, spcPodStatus.Status.SecretProviderClassName)
+}
+
+// hasFinalizer checks if the finalizer is set on the object
+func hasFinalizer(o metav1.Object, finalizer string) bool {
+	for _, f := range o.GetFinalizers() {
+		if f == finalizer {
+			return true
+		}
+	}
+	return false
+}
+
+// createK8sSecret creates K8s secret with data from mounted files, annotated
+// with the secret provider class it's synced from.
 // If a secret with the same name already exists in the namespace of the pod, the error is nil.
-func (r *SecretProviderClassPodStatusReconciler) createK8sSecret(ctx context.Context, name, namespace string, datamap map[string][]byte, labelsmap map[string]string, secretType corev1.SecretType) error {
+func (r *SecretProviderClassPodStatusReconciler) createK8sSecret(ctx context.Context, name, namespace string, datamap map[string][]byte, labelsmap, annotationsmap map[string]string, secretType corev1.SecretType, source string) error {
+	labels := map[string]string{v1alpha1.ManagedLabel: "true"}
+	for k, v := range labelsmap {
+		labels[k] = v
+	}
 	secret := &corev1.Secret{
 		ObjectMeta: metav1.ObjectMeta{
-			Namespace: namespace,
-			Name:      name,
-			Labels:    labelsmap,
+			Namespace:   namespace,
+			Name:        name,
+			Labels:      labels,
+			Annotations: SyncedSecretAnnotations(annotationsmap, datamap),
 		},
 		Type: secretType,
 		Data: datamap,
 	}
+	if len(source) > 0 {
+		secret.Annotations[v1alpha1.SyncedFromAnnotation] = source
+	}
 
-	err := r.Writer.Create(ctx, secret)
+	err := r.Writer.Create(ctx, secret, client.FieldOwner(FieldManager))
 	if err == nil {
 		log.Infof("created k8s secret: %s/%s", namespace, name)
 		return nil
@@ -246,6 +603,13 @@ func (r *SecretProviderClassPodStatusReconciler) createK8sSecret(ctx context.Con
 	return err
 }
 
+// mergeK8sSecret sets the data from mounted files on the existing K8s secret
+// with server-side apply, for the Merge conflict policy. The keys that aren't
+// synced are kept.
+func (r *SecretProviderClassPodStatusReconciler) mergeK8sSecret(ctx context.Context, name, namespace string, datamap map[string][]byte, labelsmap, annotationsmap map[string]string) error {
+	return ApplySecret(ctx, r.Writer, name, namespace, labelsmap, annotationsmap, datamap)
+}
+
 // patchSecretWithOwnerRef patches the secret owner reference with the spc pod status
 func (r *SecretProviderClassPodStatusReconciler) patchSecretWithOwnerRef(ctx context.Context, name, namespace string, spcPodStatus *v1alpha1.SecretProviderClassPodStatus) error {
 	secret := &corev1.Secret{}
@@ -254,7 +618,7 @@ func (r *SecretProviderClassPodStatusReconciler) patchSecretWithOwnerRef(ctx con
 		Name:      name,
 	}
 	err := r.Client.Get(ctx, secretKey, secret)
-	if err != nil && !errors.IsNotFound(err) {
+	if err != nil && !apierrors.IsNotFound(err) {
 		return err
 	}
 
@@ -266,6 +630,15 @@ func (r *SecretProviderClassPodStatusReconciler) patchSecretWithOwnerRef(ctx con
 	return r.Writer.Patch(ctx, secret, patch)
 }
 
+// secretManaged checks if the secret with name and namespace is managed by the driver
+func (r *SecretProviderClassPodStatusReconciler) secretManaged(ctx context.Context, name, namespace string) (bool, error) {
+	secret := &corev1.Secret{}
+	if err := r.Client.Get(ctx, types.NamespacedName{Namespace: namespace, Name: name}, secret); err != nil {
+		return false, err
+	}
+	return IsManagedSecret(secret), nil
+}
+
 // secretExists checks if the secret with name and namespace already exists
 func (r *SecretProviderClassPodStatusReconciler) secretExists(ctx context.Context, name, namespace string) (bool, error) {
 	o := &v1.Secret{}
@@ -282,3 +655,64 @@ func (r *SecretProviderClassPodStatusReconciler) secretExists(ctx context.Contex
 	}
 	return false, err
 }
+
+// createK8sConfigMap creates K8s configmap with data from mounted files
+// If a configmap with the same name already exists in the namespace of the pod, the error is nil.
+func (r *SecretProviderClassPodStatusReconciler) createK8sConfigMap(ctx context.Context, name, namespace string, datamap, labelsmap, annotationsmap map[string]string) error {
+	configMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:   namespace,
+			Name:        name,
+			Labels:      labelsmap,
+			Annotations: annotationsmap,
+		},
+		Data: datamap,
+	}
+
+	err := r.Writer.Create(ctx, configMap, client.FieldOwner(FieldManager))
+	if err == nil {
+		log.Infof("created k8s configmap: %s/%s", namespace, name)
+		return nil
+	}
+	if apierrors.IsAlreadyExists(err) {
+		return nil
+	}
+	return err
+}
+
+// patchConfigMapWithOwnerRef patches the configmap owner reference with the spc pod status
+func (r *SecretProviderClassPodStatusReconciler) patchConfigMapWithOwnerRef(ctx context.Context, name, namespace string, spcPodStatus *v1alpha1.SecretProviderClassPodStatus) error {
+	configMap := &corev1.ConfigMap{}
+	configMapKey := types.NamespacedName{
+		Namespace: namespace,
+		Name:      name,
+	}
+	err := r.Client.Get(ctx, configMapKey, configMap)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+
+	patch := client.MergeFromWithOptions(configMap.DeepCopy(), client.MergeFromWithOptimisticLock{})
+	err = controllerutil.SetOwnerReference(spcPodStatus, configMap, r.Scheme)
+	if err != nil {
+		return err
+	}
+	return r.Writer.Patch(ctx, configMap, patch)
+}
+
+// configMapExists checks if the configmap with name and namespace already exists
+func (r *SecretProviderClassPodStatusReconciler) configMapExists(ctx context.Context, name, namespace string) (bool, error) {
+	o := &corev1.ConfigMap{}
+	configMapKey := types.NamespacedName{
+		Namespace: namespace,
+		Name:      name,
+	}
+	err := r.Client.Get(ctx, configMapKey, o)
+	if err == nil {
+		return true, nil
+	}
+	if apierrors.IsNotFound(err) {
+		return false, nil
+	}
+	return false, err
+}
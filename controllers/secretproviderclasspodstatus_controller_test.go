@@ -18,6 +18,10 @@ package controllers
 
 import (
 	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 
 	. "github.com/onsi/gomega"
@@ -30,6 +34,7 @@ import (
 	"k8s.io/apimachinery/pkg/types"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 
+	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 	"sigs.k8s.io/secrets-store-csi-driver/apis/v1alpha1"
@@ -75,11 +80,28 @@ func newSecretProviderClassPodStatus(name, namespace, node string) *v1alpha1.Sec
 	}
 }
 
+// applyClient is a client that supports server-side apply patches, which the
+// fake client doesn't, by converting them into merge patches
+type applyClient struct {
+	client.Client
+}
+
+func (c applyClient) Patch(ctx context.Context, obj runtime.Object, patch client.Patch, opts ...client.PatchOption) error {
+	if patch.Type() != types.ApplyPatchType {
+		return c.Client.Patch(ctx, obj, patch, opts...)
+	}
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return err
+	}
+	return c.Client.Patch(ctx, obj, client.RawPatch(types.MergePatchType, data))
+}
+
 func newReconciler(client client.Client, scheme *runtime.Scheme) *SecretProviderClassPodStatusReconciler {
 	return &SecretProviderClassPodStatusReconciler{
 		Client: client,
 		Reader: client,
-		Writer: client,
+		Writer: applyClient{client},
 		Log:    log.New(),
 		Scheme: scheme,
 	}
@@ -142,6 +164,7 @@ func TestCreateK8sSecret(t *testing.T) {
 	g.Expect(err).NotTo(HaveOccurred())
 
 	labels := map[string]string{"environment": "test"}
+	annotations := map[string]string{"reloader.stakater.com/match": "true"}
 
 	initObjects := []runtime.Object{
 		newSecret("my-secret", "default", labels),
@@ -150,16 +173,319 @@ func TestCreateK8sSecret(t *testing.T) {
 	reconciler := newReconciler(client, scheme)
 
 	// secret already exists
-	err = reconciler.createK8sSecret(context.TODO(), "my-secret", "default", nil, labels, v1.SecretTypeOpaque)
+	err = reconciler.createK8sSecret(context.TODO(), "my-secret", "default", nil, labels, annotations, v1.SecretTypeOpaque, "")
 	g.Expect(err).NotTo(HaveOccurred())
 
-	err = reconciler.createK8sSecret(context.TODO(), "my-secret2", "default", nil, labels, v1.SecretTypeOpaque)
+	err = reconciler.createK8sSecret(context.TODO(), "my-secret2", "default", nil, labels, annotations, v1.SecretTypeOpaque, "default/SecretProviderClass/spc1")
 	g.Expect(err).NotTo(HaveOccurred())
 	secret := &v1.Secret{}
 	err = client.Get(context.TODO(), types.NamespacedName{Name: "my-secret2", Namespace: "default"}, secret)
 	g.Expect(err).NotTo(HaveOccurred())
 
-	g.Expect(secret.Labels).To(Equal(labels))
+	g.Expect(secret.Labels).To(Equal(map[string]string{"environment": "test", v1alpha1.ManagedLabel: "true"}))
+	g.Expect(secret.Annotations).To(Equal(map[string]string{"reloader.stakater.com/match": "true", v1alpha1.ContentHashAnnotation: SecretDataHash(nil), v1alpha1.SyncedFromAnnotation: "default/SecretProviderClass/spc1"}))
 
 	g.Expect(secret.Name).To(Equal("my-secret2"))
 }
+
+func TestCreateK8sConfigMap(t *testing.T) {
+	g := NewWithT(t)
+
+	scheme, err := setupScheme()
+	g.Expect(err).NotTo(HaveOccurred())
+
+	labels := map[string]string{"environment": "test"}
+	annotations := map[string]string{"reloader.stakater.com/match": "true"}
+	data := map[string]string{"config.yaml": "level: debug"}
+
+	initObjects := []runtime.Object{
+		&v1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "my-configmap", Namespace: "default"}},
+	}
+	client := fake.NewFakeClientWithScheme(scheme, initObjects...)
+	reconciler := newReconciler(client, scheme)
+
+	// configmap already exists
+	err = reconciler.createK8sConfigMap(context.TODO(), "my-configmap", "default", data, labels, annotations)
+	g.Expect(err).NotTo(HaveOccurred())
+	exists, err := reconciler.configMapExists(context.TODO(), "my-configmap", "default")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(exists).To(BeTrue())
+
+	err = reconciler.createK8sConfigMap(context.TODO(), "my-configmap2", "default", data, labels, annotations)
+	g.Expect(err).NotTo(HaveOccurred())
+	configMap := &v1.ConfigMap{}
+	err = client.Get(context.TODO(), types.NamespacedName{Name: "my-configmap2", Namespace: "default"}, configMap)
+	g.Expect(err).NotTo(HaveOccurred())
+
+	g.Expect(configMap.Data).To(Equal(data))
+	g.Expect(configMap.Labels).To(Equal(labels))
+	g.Expect(configMap.Annotations).To(Equal(annotations))
+
+	err = reconciler.patchConfigMapWithOwnerRef(context.TODO(), "my-configmap2", "default", newSecretProviderClassPodStatus("my-spc-pod-status", "default", "node1"))
+	g.Expect(err).NotTo(HaveOccurred())
+	err = client.Get(context.TODO(), types.NamespacedName{Name: "my-configmap2", Namespace: "default"}, configMap)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(configMap.GetOwnerReferences()).To(HaveLen(1))
+}
+
+func TestMergeK8sSecret(t *testing.T) {
+	g := NewWithT(t)
+
+	scheme, err := setupScheme()
+	g.Expect(err).NotTo(HaveOccurred())
+
+	secret := newSecret("my-secret", "default", nil)
+	secret.Data = map[string][]byte{"username": []byte("admin"), "password": []byte("existing")}
+	client := fake.NewFakeClientWithScheme(scheme, secret)
+	reconciler := newReconciler(client, scheme)
+
+	managed, err := reconciler.secretManaged(context.TODO(), "my-secret", "default")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(managed).To(BeFalse())
+
+	err = reconciler.mergeK8sSecret(context.TODO(), "my-secret", "default", map[string][]byte{"password": []byte("synced")}, map[string]string{"team": "a"}, nil)
+	g.Expect(err).NotTo(HaveOccurred())
+	merged := &v1.Secret{}
+	err = client.Get(context.TODO(), types.NamespacedName{Name: "my-secret", Namespace: "default"}, merged)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(merged.Data).To(Equal(map[string][]byte{"username": []byte("admin"), "password": []byte("synced")}))
+	g.Expect(merged.Labels).To(Equal(map[string]string{"team": "a"}))
+	g.Expect(merged.GetOwnerReferences()).To(BeEmpty())
+}
+
+func TestReconcileExistingSecretOwnerRef(t *testing.T) {
+	cases := []struct {
+		name              string
+		secretObject      *v1alpha1.SecretObject
+		secretNamespace   string
+		expectedOwnerRefs int
+		expectedData      map[string][]byte
+	}{
+		{
+			name:              "existing secret adopted",
+			secretObject:      &v1alpha1.SecretObject{SecretName: "secret1", Type: "Opaque"},
+			secretNamespace:   "default",
+			expectedOwnerRefs: 1,
+		},
+		{
+			name:            "existing secret merged",
+			secretObject:    &v1alpha1.SecretObject{SecretName: "secret1", Type: "Opaque", ConflictPolicy: v1alpha1.ConflictPolicyMerge},
+			secretNamespace: "default",
+			expectedData:    map[string][]byte{"key1": []byte("value1")},
+		},
+		{
+			// owner references can't cross namespaces
+			name:            "existing secret in another namespace",
+			secretObject:    &v1alpha1.SecretObject{SecretName: "secret1", Namespace: "team-a", Type: "Opaque"},
+			secretNamespace: "team-a",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			scheme, err := setupScheme()
+			g.Expect(err).NotTo(HaveOccurred())
+
+			targetPath, err := ioutil.TempDir("", "spcps")
+			g.Expect(err).NotTo(HaveOccurred())
+			defer os.RemoveAll(targetPath)
+			err = ioutil.WriteFile(filepath.Join(targetPath, "object1"), []byte("value1"), 0644)
+			g.Expect(err).NotTo(HaveOccurred())
+
+			tc.secretObject.Data = []*v1alpha1.SecretObjectData{{ObjectName: "object1", Key: "key1"}}
+			spc := &v1alpha1.SecretProviderClass{
+				ObjectMeta: metav1.ObjectMeta{Name: "spc1", Namespace: "default", ResourceVersion: "73659"},
+				Spec: v1alpha1.SecretProviderClassSpec{
+					SecretObjects: []*v1alpha1.SecretObject{tc.secretObject},
+				},
+			}
+			spcPodStatus := newSecretProviderClassPodStatus("pod1-default-spc1", "default", "node1")
+			spcPodStatus.Status.TargetPath = targetPath
+			client := fake.NewFakeClientWithScheme(scheme,
+				spc,
+				spcPodStatus,
+				&v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-a", Annotations: map[string]string{v1alpha1.AllowSyncFromAnnotation: "default"}}},
+				newSecret("secret1", tc.secretNamespace, nil),
+			)
+			reconciler := newReconciler(client, scheme)
+			reconciler.NodeID = "node1"
+			reconciler.SyncNamespaces = []string{"team-a"}
+
+			_, err = reconciler.Reconcile(ctrl.Request{NamespacedName: types.NamespacedName{Name: "pod1-default-spc1", Namespace: "default"}})
+			g.Expect(err).NotTo(HaveOccurred())
+
+			// the secrets are synced once the finalizer is set
+			err = client.Get(context.TODO(), types.NamespacedName{Name: "pod1-default-spc1", Namespace: "default"}, spcPodStatus)
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(spcPodStatus.Finalizers).To(ContainElement(v1alpha1.SyncedSecretsFinalizer))
+
+			secret := &v1.Secret{}
+			err = client.Get(context.TODO(), types.NamespacedName{Name: "secret1", Namespace: tc.secretNamespace}, secret)
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(secret.GetOwnerReferences()).To(HaveLen(tc.expectedOwnerRefs))
+			if tc.expectedOwnerRefs > 0 {
+				g.Expect(secret.GetOwnerReferences()[0].UID).To(Equal(spcPodStatus.UID))
+			}
+			if tc.expectedData != nil {
+				g.Expect(secret.Data).To(Equal(tc.expectedData))
+			}
+		})
+	}
+}
+
+func TestCleanupSyncedSecrets(t *testing.T) {
+	g := NewWithT(t)
+
+	scheme, err := setupScheme()
+	g.Expect(err).NotTo(HaveOccurred())
+
+	spc := &v1alpha1.SecretProviderClass{
+		ObjectMeta: metav1.ObjectMeta{Name: "spc1", Namespace: "default"},
+		Spec: v1alpha1.SecretProviderClassSpec{
+			SecretObjects: []*v1alpha1.SecretObject{
+				{SecretName: "managed"},
+				{SecretName: "unmanaged"},
+				{SecretName: "other-namespace", Namespace: "team-a"},
+				{SecretName: "other-source", Namespace: "team-a"},
+				{SecretName: "not-annotated", Namespace: "team-a"},
+				{SecretName: "not-allowed", Namespace: "team-b"},
+				{SecretName: "notfound"},
+			},
+		},
+	}
+	spcPodStatus := newSecretProviderClassPodStatus("pod1-default-spc1", "default", "node1")
+	spcPodStatus.Finalizers = []string{v1alpha1.SyncedSecretsFinalizer}
+	managedLabels := map[string]string{v1alpha1.ManagedLabel: "true"}
+	syncedSecret := func(name, namespace, source string) *v1.Secret {
+		secret := newSecret(name, namespace, managedLabels)
+		secret.Annotations = map[string]string{v1alpha1.SyncedFromAnnotation: source}
+		return secret
+	}
+	client := fake.NewFakeClientWithScheme(scheme,
+		spc,
+		spcPodStatus,
+		&v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-a", Annotations: map[string]string{v1alpha1.AllowSyncFromAnnotation: "default"}}},
+		&v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-b"}},
+		newSecret("managed", "default", managedLabels),
+		newSecret("unmanaged", "default", nil),
+		syncedSecret("other-namespace", "team-a", "default/SecretProviderClass/spc1"),
+		syncedSecret("other-source", "team-a", "platform/SecretProviderClass/spc1"),
+		newSecret("not-annotated", "team-a", managedLabels),
+		syncedSecret("not-allowed", "team-b", "default/SecretProviderClass/spc1"),
+	)
+	reconciler := newReconciler(client, scheme)
+	reconciler.SyncNamespaces = []string{"team-a", "team-b"}
+
+	err = reconciler.cleanupSyncedSecrets(context.TODO(), spcPodStatus)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(spcPodStatus.Finalizers).To(BeEmpty())
+
+	exists, err := reconciler.secretExists(context.TODO(), "managed", "default")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(exists).To(BeFalse())
+	exists, err = reconciler.secretExists(context.TODO(), "other-namespace", "team-a")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(exists).To(BeFalse())
+	exists, err = reconciler.secretExists(context.TODO(), "unmanaged", "default")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(exists).To(BeTrue())
+	// secrets in other namespaces are kept if they were synced from another
+	// secret provider class or syncing into the namespace isn't allowed
+	for _, name := range []string{"other-source", "not-annotated"} {
+		exists, err = reconciler.secretExists(context.TODO(), name, "team-a")
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(exists).To(BeTrue())
+	}
+	exists, err = reconciler.secretExists(context.TODO(), "not-allowed", "team-b")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(exists).To(BeTrue())
+}
+
+func TestCleanupSyncedSecretsInUse(t *testing.T) {
+	g := NewWithT(t)
+
+	scheme, err := setupScheme()
+	g.Expect(err).NotTo(HaveOccurred())
+
+	spc := &v1alpha1.SecretProviderClass{
+		ObjectMeta: metav1.ObjectMeta{Name: "spc1", Namespace: "default"},
+		Spec: v1alpha1.SecretProviderClassSpec{
+			SecretObjects: []*v1alpha1.SecretObject{{SecretName: "managed"}},
+		},
+	}
+	spcPodStatus := newSecretProviderClassPodStatus("pod1-default-spc1", "default", "node1")
+	spcPodStatus.Finalizers = []string{v1alpha1.SyncedSecretsFinalizer}
+	client := fake.NewFakeClientWithScheme(scheme,
+		spc,
+		spcPodStatus,
+		newSecretProviderClassPodStatus("pod2-default-spc1", "default", "node2"),
+		newSecret("managed", "default", map[string]string{v1alpha1.ManagedLabel: "true"}),
+	)
+	reconciler := newReconciler(client, scheme)
+
+	err = reconciler.cleanupSyncedSecrets(context.TODO(), spcPodStatus)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(spcPodStatus.Finalizers).To(BeEmpty())
+
+	exists, err := reconciler.secretExists(context.TODO(), "managed", "default")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(exists).To(BeTrue())
+}
+
+func TestCleansUpDeletedStatus(t *testing.T) {
+	g := NewWithT(t)
+
+	scheme, err := setupScheme()
+	g.Expect(err).NotTo(HaveOccurred())
+
+	client := fake.NewFakeClientWithScheme(scheme, &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node2"}})
+
+	cases := []struct {
+		name            string
+		node            string
+		leader          bool
+		expectedCleanup bool
+	}{
+		{
+			name:            "node of the pod",
+			node:            "node1",
+			expectedCleanup: true,
+		},
+		{
+			name: "node of another driver",
+			node: "node2",
+		},
+		{
+			name:   "node of another driver on the elected driver",
+			node:   "node2",
+			leader: true,
+		},
+		{
+			name: "node gone",
+			node: "node3",
+		},
+		{
+			name:            "node gone on the elected driver",
+			node:            "node3",
+			leader:          true,
+			expectedCleanup: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			reconciler := newReconciler(client, scheme)
+			reconciler.NodeID = "node1"
+			reconciler.APIReader = client
+			leader := tc.leader
+			reconciler.IsLeader = func() bool { return leader }
+
+			cleanup, err := reconciler.cleansUpDeletedStatus(context.TODO(), newSecretProviderClassPodStatus("pod1-default-spc1", "default", tc.node))
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(cleanup).To(Equal(tc.expectedCleanup))
+		})
+	}
+}
@@ -17,22 +17,46 @@ limitations under the License.
 package controllers
 
 import (
+	"bytes"
+	"context"
 	"crypto/ecdsa"
 	"crypto/rsa"
+	"crypto/sha256"
 	"crypto/x509"
+	"encoding/json"
 	"encoding/pem"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"strings"
+	"text/template"
 
 	log "github.com/sirupsen/logrus"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"sigs.k8s.io/secrets-store-csi-driver/apis/v1alpha1"
 )
 
-// getCertPart returns the certificate or the private key part of the cert
-func getCertPart(data []byte, key string) ([]byte, error) {
+// maxExtendsDepth is the maximum number of base classes in the extends chain
+// of a secret provider class
+const maxExtendsDepth = 5
+
+// ErrNamespaceNotSelected is returned if the namespace selector of a cluster
+// secret provider class doesn't select the namespace of the pod
+var ErrNamespaceNotSelected = errors.New("namespace is not selected by the cluster secret provider class")
+
+// ErrPodNotAllowed is returned if the allowed namespaces or the pod selector
+// of a secret provider class don't allow the pod to mount the class
+var ErrPodNotAllowed = errors.New("pod is not allowed to use the secret provider class")
+
+// GetCertPart returns the certificate or the private key part of the cert
+func GetCertPart(data []byte, key string) ([]byte, error) {
 	if key == corev1.TLSPrivateKeyKey {
 		return getPrivateKey(data)
 	}
@@ -105,8 +129,8 @@ func getPrivateKey(data []byte) ([]byte, error) {
 	return pem.EncodeToMemory(block), nil
 }
 
-// getSecretType returns a k8s secret type, defaults to Opaque
-func getSecretType(sType string) corev1.SecretType {
+// GetSecretType returns a k8s secret type, defaults to Opaque
+func GetSecretType(sType string) corev1.SecretType {
 	switch sType {
 	case "kubernetes.io/basic-auth":
 		return corev1.SecretTypeBasicAuth
@@ -127,6 +151,643 @@ func getSecretType(sType string) corev1.SecretType {
 	}
 }
 
+// ValidateSecretData returns an error if the data of a synced secret is missing
+// the keys required by the secret type, so the secret isn't created or updated
+// with a partial payload
+func ValidateSecretData(secretType corev1.SecretType, data map[string][]byte) error {
+	var required []string
+	switch secretType {
+	case corev1.SecretTypeTLS:
+		required = []string{corev1.TLSCertKey, corev1.TLSPrivateKeyKey}
+	case corev1.SecretTypeDockerConfigJson:
+		required = []string{corev1.DockerConfigJsonKey}
+	case corev1.SecretTypeDockercfg:
+		required = []string{corev1.DockerConfigKey}
+	case corev1.SecretTypeSSHAuth:
+		required = []string{corev1.SSHAuthPrivateKey}
+	case corev1.SecretTypeBasicAuth:
+		// the username or the password can be empty, but one of them must be set
+		_, hasUsername := data[corev1.BasicAuthUsernameKey]
+		_, hasPassword := data[corev1.BasicAuthPasswordKey]
+		if !hasUsername && !hasPassword {
+			return fmt.Errorf("secret of type %s requires key %s or %s", secretType, corev1.BasicAuthUsernameKey, corev1.BasicAuthPasswordKey)
+		}
+	}
+	for _, key := range required {
+		if len(data[key]) == 0 {
+			return fmt.Errorf("secret of type %s requires non-empty key %s", secretType, key)
+		}
+	}
+	switch secretType {
+	case corev1.SecretTypeDockerConfigJson:
+		if !json.Valid(data[corev1.DockerConfigJsonKey]) {
+			return fmt.Errorf("key %s of secret of type %s must be valid json", corev1.DockerConfigJsonKey, secretType)
+		}
+	case corev1.SecretTypeDockercfg:
+		if !json.Valid(data[corev1.DockerConfigKey]) {
+			return fmt.Errorf("key %s of secret of type %s must be valid json", corev1.DockerConfigKey, secretType)
+		}
+	}
+	return nil
+}
+
+// RenderSecretTemplate renders the template of a synced secret data field. The
+// contents of the objects referenced with the object function in the template
+// are returned by the object func.
+func RenderSecretTemplate(text string, object func(objectName string) ([]byte, error)) ([]byte, error) {
+	tmpl, err := parseSecretTemplate(text, object)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, nil); err != nil {
+		return nil, fmt.Errorf("failed to render template, err: %v", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// ValidateSecretTemplate returns an error if the template of a synced secret
+// data field can't be parsed
+func ValidateSecretTemplate(text string) error {
+	_, err := parseSecretTemplate(text, func(objectName string) ([]byte, error) {
+		return nil, nil
+	})
+	return err
+}
+
+// parseSecretTemplate parses the template of a synced secret data field with
+// the object function returning the contents of the objects
+func parseSecretTemplate(text string, object func(objectName string) ([]byte, error)) (*template.Template, error) {
+	tmpl, err := template.New("data").Funcs(template.FuncMap{
+		"object": func(objectName string) (string, error) {
+			content, err := object(objectName)
+			if err != nil {
+				return "", err
+			}
+			return string(content), nil
+		},
+	}).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse template, err: %v", err)
+	}
+	return tmpl, nil
+}
+
+// ConfigMapData returns the data of a synced configmap. The contents of the
+// objects referenced by object name or template are returned by the object func.
+func ConfigMapData(data []*v1alpha1.SecretObjectData, object func(objectName string) ([]byte, error)) (map[string]string, error) {
+	datamap := make(map[string]string, len(data))
+	for _, d := range data {
+		if len(d.Key) == 0 {
+			return nil, fmt.Errorf("key in data is empty")
+		}
+		if len(d.Template) > 0 {
+			content, err := RenderSecretTemplate(d.Template, object)
+			if err != nil {
+				return nil, fmt.Errorf("failed to render template for key %s, err: %v", d.Key, err)
+			}
+			datamap[d.Key] = string(content)
+			continue
+		}
+		if len(d.ObjectName) == 0 {
+			return nil, fmt.Errorf("object name in data is empty for key %s", d.Key)
+		}
+		content, err := object(d.ObjectName)
+		if err != nil {
+			return nil, err
+		}
+		datamap[d.Key] = string(content)
+	}
+	return datamap, nil
+}
+
+// IsManagedSecret returns true if the secret was created by the driver or is
+// owned by a secret provider class or secret provider class pod status
+func IsManagedSecret(secret *corev1.Secret) bool {
+	if secret.GetLabels()[v1alpha1.ManagedLabel] == "true" {
+		return true
+	}
+	for _, ref := range secret.GetOwnerReferences() {
+		if strings.HasPrefix(ref.APIVersion, v1alpha1.GroupVersion.Group+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// SyncedFrom returns the SyncedFromAnnotation value of the secrets synced for
+// the pods in namespace that mount the secret provider class name of kind
+func SyncedFrom(namespace, kind, name string) string {
+	if len(kind) == 0 {
+		kind = "SecretProviderClass"
+	}
+	return fmt.Sprintf("%s/%s/%s", namespace, kind, name)
+}
+
+// CheckConflictPolicy returns an error if the existing secret can't be synced
+// with the conflict policy, i.e. with the Fail policy if the secret isn't
+// managed by the driver
+func CheckConflictPolicy(policy v1alpha1.ConflictPolicy, secret *corev1.Secret) error {
+	if policy == v1alpha1.ConflictPolicyFail && !IsManagedSecret(secret) {
+		return fmt.Errorf("secret %s/%s already exists and isn't managed by the driver", secret.Namespace, secret.Name)
+	}
+	return nil
+}
+
+// SecretDataHash returns the sha256 hash of the synced data of a secret. The
+// hash doesn't depend on the order of the keys.
+func SecretDataHash(data map[string][]byte) string {
+	// the keys of maps are sorted by json
+	b, _ := json.Marshal(data)
+	return fmt.Sprintf("%x", sha256.Sum256(b))
+}
+
+// SyncedSecretAnnotations returns the annotations of the secret object with
+// the ContentHashAnnotation set to the hash of the synced data
+func SyncedSecretAnnotations(annotations map[string]string, data map[string][]byte) map[string]string {
+	synced := make(map[string]string, len(annotations)+1)
+	for k, v := range annotations {
+		synced[k] = v
+	}
+	synced[v1alpha1.ContentHashAnnotation] = SecretDataHash(data)
+	return synced
+}
+
+// ApplySecret sets the labels, annotations and data of the synced secret with
+// server-side apply. The driver only owns the keys it syncs, so other
+// controllers can set labels, annotations or keys on the same secret. The
+// ContentHashAnnotation is set to the hash of the synced data.
+func ApplySecret(ctx context.Context, w client.Writer, name, namespace string, labels, annotations map[string]string, data map[string][]byte) error {
+	secret := &corev1.Secret{
+		TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "Secret"},
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:   namespace,
+			Name:        name,
+			Labels:      labels,
+			Annotations: SyncedSecretAnnotations(annotations, data),
+		},
+		Data: data,
+	}
+	return w.Patch(ctx, secret, client.Apply, client.FieldOwner(FieldManager), client.ForceOwnership)
+}
+
+// ApplyConfigMap sets the labels, annotations and data of the synced configmap
+// with server-side apply, the same as ApplySecret
+func ApplyConfigMap(ctx context.Context, w client.Writer, name, namespace string, labels, annotations, data map[string]string) error {
+	configMap := &corev1.ConfigMap{
+		TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "ConfigMap"},
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:   namespace,
+			Name:        name,
+			Labels:      labels,
+			Annotations: annotations,
+		},
+		Data: data,
+	}
+	return w.Patch(ctx, configMap, client.Apply, client.FieldOwner(FieldManager), client.ForceOwnership)
+}
+
+// SetSecretSyncedCondition sets the SecretSynced condition of the secret
+// provider class status to the result of the sync and returns true if the
+// condition changed. The last update time is set when the synced secrets were
+// updated or the condition changed.
+func SetSecretSyncedCondition(status *v1alpha1.SecretProviderClassStatus, syncErr error, updated bool, now metav1.Time) bool {
+	condition := v1alpha1.SecretProviderClassCondition{
+		Type:    v1alpha1.SecretSynced,
+		Status:  corev1.ConditionTrue,
+		Reason:  SecretSyncedReason,
+		Message: "secret objects synced",
+	}
+	if syncErr != nil {
+		condition.Status = corev1.ConditionFalse
+		condition.Reason = SecretSyncFailedReason
+		condition.Message = syncErr.Error()
+	}
+	return SetSecretProviderClassCondition(status, condition, updated, now)
+}
+
+// SetSecretProviderClassCondition sets the condition of its type in the
+// status. The transition time is only set if the status of the condition
+// changed, and the update time if the condition changed or updated is true.
+// It returns false if the status wasn't changed.
+func SetSecretProviderClassCondition(status *v1alpha1.SecretProviderClassStatus, condition v1alpha1.SecretProviderClassCondition, updated bool, now metav1.Time) bool {
+	for i := range status.Conditions {
+		current := &status.Conditions[i]
+		if current.Type != condition.Type {
+			continue
+		}
+		if current.Status == condition.Status && current.Reason == condition.Reason && current.Message == condition.Message {
+			if !updated {
+				return false
+			}
+			current.LastUpdateTime = now
+			return true
+		}
+		if current.Status != condition.Status {
+			current.LastTransitionTime = now
+		}
+		current.Status = condition.Status
+		current.Reason = condition.Reason
+		current.Message = condition.Message
+		current.LastUpdateTime = now
+		return true
+	}
+	condition.LastUpdateTime = now
+	condition.LastTransitionTime = now
+	status.Conditions = append(status.Conditions, condition)
+	return true
+}
+
+// UpdateSecretSyncedCondition patches the status of the secret provider class
+// with the SecretSynced condition if it changed
+func UpdateSecretSyncedCondition(ctx context.Context, c client.StatusClient, spc *v1alpha1.SecretProviderClass, syncErr error, updated bool) error {
+	if IsClusterSecretProviderClass(spc) {
+		return nil
+	}
+	patch := client.MergeFrom(spc.DeepCopy())
+	if !SetSecretSyncedCondition(&spc.Status, syncErr, updated, metav1.Now()) {
+		return nil
+	}
+	return c.Status().Patch(ctx, spc, patch)
+}
+
+// UpdateSecretProviderClassConditions patches the status of the secret provider
+// class with the conditions if any of them changed
+func UpdateSecretProviderClassConditions(ctx context.Context, c client.StatusClient, spc *v1alpha1.SecretProviderClass, conditions ...v1alpha1.SecretProviderClassCondition) error {
+	if IsClusterSecretProviderClass(spc) {
+		return nil
+	}
+	patch := client.MergeFrom(spc.DeepCopy())
+	changed := false
+	now := metav1.Now()
+	for _, condition := range conditions {
+		if SetSecretProviderClassCondition(&spc.Status, condition, false, now) {
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	return c.Status().Patch(ctx, spc, patch)
+}
+
+// CrossNamespaceSyncAllowed returns an error if the secret provider classes in
+// namespace aren't allowed to sync secrets into targetNamespace. The target
+// namespace must be in the allowlist of the driver and its
+// AllowSyncFromAnnotation must list namespace or *.
+func CrossNamespaceSyncAllowed(ctx context.Context, c client.Reader, allowlist []string, namespace, targetNamespace string) error {
+	allowed := false
+	for _, ns := range allowlist {
+		if ns == targetNamespace {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		return fmt.Errorf("syncing secrets into namespace %s is not allowed by the driver", targetNamespace)
+	}
+	target := &corev1.Namespace{}
+	if err := c.Get(ctx, client.ObjectKey{Name: targetNamespace}, target); err != nil {
+		return fmt.Errorf("failed to get namespace %s, err: %v", targetNamespace, err)
+	}
+	for _, ns := range strings.Split(target.GetAnnotations()[v1alpha1.AllowSyncFromAnnotation], ",") {
+		if ns = strings.TrimSpace(ns); ns == "*" || ns == namespace {
+			return nil
+		}
+	}
+	return fmt.Errorf("syncing secrets from namespace %s is not allowed by the %s annotation of namespace %s", namespace, v1alpha1.AllowSyncFromAnnotation, targetNamespace)
+}
+
+// GetSecretProviderClass returns the secret provider class with name mounted by
+// the pods in namespace. If kind is ClusterSecretProviderClassKind, the cluster
+// secret provider class is returned as a secret provider class in namespace,
+// provided its namespace selector selects namespace.
+func GetSecretProviderClass(ctx context.Context, c client.Reader, name, kind, namespace string) (*v1alpha1.SecretProviderClass, error) {
+	if kind != v1alpha1.ClusterSecretProviderClassKind {
+		spc := &v1alpha1.SecretProviderClass{}
+		if err := c.Get(ctx, client.ObjectKey{Namespace: namespace, Name: name}, spc); err != nil {
+			return nil, err
+		}
+		return ResolveSecretProviderClass(ctx, c, spc)
+	}
+	cspc := &v1alpha1.ClusterSecretProviderClass{}
+	if err := c.Get(ctx, client.ObjectKey{Name: name}, cspc); err != nil {
+		return nil, err
+	}
+	selector, err := metav1.LabelSelectorAsSelector(cspc.Spec.NamespaceSelector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid namespace selector of clustersecretproviderclass %s, err: %v", name, err)
+	}
+	ns := &corev1.Namespace{}
+	if err := c.Get(ctx, client.ObjectKey{Name: namespace}, ns); err != nil {
+		return nil, fmt.Errorf("failed to get namespace %s, err: %v", namespace, err)
+	}
+	if !selector.Matches(labels.Set(ns.GetLabels())) {
+		return nil, fmt.Errorf("%w: namespace %s, clustersecretproviderclass %s", ErrNamespaceNotSelected, namespace, name)
+	}
+	// the status of the cluster secret provider class isn't reported, the kind
+	// marks the secret provider class to skip the status updates
+	return ResolveSecretProviderClass(ctx, c, &v1alpha1.SecretProviderClass{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: v1alpha1.GroupVersion.String(),
+			Kind:       v1alpha1.ClusterSecretProviderClassKind,
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            cspc.Name,
+			Namespace:       namespace,
+			UID:             cspc.UID,
+			Generation:      cspc.Generation,
+			ResourceVersion: cspc.ResourceVersion,
+			Labels:          cspc.Labels,
+			Annotations:     cspc.Annotations,
+		},
+		Spec: *cspc.Spec.SecretProviderClassSpec.DeepCopy(),
+	})
+}
+
+// ResolveSecretProviderClass returns the secret provider class with the specs
+// of the base classes it extends merged into its spec and the defaults of the
+// merged spec applied to its objects. The base classes of a cluster secret
+// provider class are cluster secret provider classes.
+func ResolveSecretProviderClass(ctx context.Context, c client.Reader, spc *v1alpha1.SecretProviderClass) (*v1alpha1.SecretProviderClass, error) {
+	if len(spc.Spec.Extends) == 0 && spc.Spec.Defaults == nil {
+		return spc, nil
+	}
+	resolved := spc.DeepCopy()
+	seen := sets.NewString(spc.Name)
+	for base := spc.Spec.Extends; len(base) > 0; {
+		if seen.Has(base) {
+			return nil, fmt.Errorf("secretproviderclass %s extends itself through %s", spc.Name, base)
+		}
+		if seen.Len() > maxExtendsDepth {
+			return nil, fmt.Errorf("secretproviderclass %s extends more than %d classes", spc.Name, maxExtendsDepth)
+		}
+		seen.Insert(base)
+		var baseSpec *v1alpha1.SecretProviderClassSpec
+		if IsClusterSecretProviderClass(spc) {
+			cspc := &v1alpha1.ClusterSecretProviderClass{}
+			if err := c.Get(ctx, client.ObjectKey{Name: base}, cspc); err != nil {
+				return nil, fmt.Errorf("failed to get base clustersecretproviderclass %s of %s, err: %w", base, spc.Name, err)
+			}
+			baseSpec = &cspc.Spec.SecretProviderClassSpec
+		} else {
+			baseSPC := &v1alpha1.SecretProviderClass{}
+			if err := c.Get(ctx, client.ObjectKey{Namespace: spc.Namespace, Name: base}, baseSPC); err != nil {
+				return nil, fmt.Errorf("failed to get base secretproviderclass %s of %s, err: %w", base, spc.Name, err)
+			}
+			baseSpec = &baseSPC.Spec
+		}
+		resolved.Spec = MergeSecretProviderClassSpec(baseSpec, &resolved.Spec)
+		base = baseSpec.Extends
+	}
+	resolved.Spec.Extends = spc.Spec.Extends
+	ApplySecretProviderClassDefaults(&resolved.Spec)
+	return resolved, nil
+}
+
+// ApplySecretProviderClassDefaults sets the file permission and encoding of
+// the defaults of the spec in the mounted objects that don't set them, and
+// adds the sync labels of the defaults to the labels of the secret and
+// configmap objects. The labels of an object override the sync labels.
+func ApplySecretProviderClassDefaults(spec *v1alpha1.SecretProviderClassSpec) {
+	defaults := spec.Defaults
+	if defaults == nil {
+		return
+	}
+	for _, mountedObj := range spec.MountedObjects {
+		if mountedObj == nil {
+			continue
+		}
+		if len(mountedObj.FilePermission) == 0 {
+			mountedObj.FilePermission = defaults.FilePermission
+		}
+		if len(mountedObj.Encoding) == 0 {
+			mountedObj.Encoding = defaults.Encoding
+		}
+	}
+	if len(defaults.SyncLabels) == 0 {
+		return
+	}
+	for _, secretObj := range spec.SecretObjects {
+		if secretObj != nil {
+			secretObj.Labels = withSyncLabels(defaults.SyncLabels, secretObj.Labels)
+		}
+	}
+	for _, configMapObj := range spec.ConfigMapObjects {
+		if configMapObj != nil {
+			configMapObj.Labels = withSyncLabels(defaults.SyncLabels, configMapObj.Labels)
+		}
+	}
+}
+
+// withSyncLabels returns the sync labels merged with the labels of an object
+func withSyncLabels(syncLabels, labels map[string]string) map[string]string {
+	merged := make(map[string]string, len(syncLabels)+len(labels))
+	for k, v := range syncLabels {
+		merged[k] = v
+	}
+	for k, v := range labels {
+		merged[k] = v
+	}
+	return merged
+}
+
+// MergeSecretProviderClassSpec returns the spec of a secret provider class
+// that extends base. Parameters are merged by key, secret objects by
+// secretName and namespace, configmap objects by configMapName, mounted
+// objects by objectName and defaults by field, the other fields of spec
+// replace the fields of base if they are set.
+func MergeSecretProviderClassSpec(base, spec *v1alpha1.SecretProviderClassSpec) v1alpha1.SecretProviderClassSpec {
+	merged := *base.DeepCopy()
+	override := spec.DeepCopy()
+	if len(override.Provider) > 0 {
+		merged.Provider = override.Provider
+	}
+	if len(override.Parameters) > 0 && merged.Parameters == nil {
+		merged.Parameters = make(map[string]string, len(override.Parameters))
+	}
+	for k, v := range override.Parameters {
+		merged.Parameters[k] = v
+	}
+	for _, secretObj := range override.SecretObjects {
+		if secretObj == nil {
+			continue
+		}
+		replaced := false
+		for i, baseObj := range merged.SecretObjects {
+			if baseObj != nil && baseObj.SecretName == secretObj.SecretName && baseObj.Namespace == secretObj.Namespace {
+				merged.SecretObjects[i], replaced = secretObj, true
+				break
+			}
+		}
+		if !replaced {
+			merged.SecretObjects = append(merged.SecretObjects, secretObj)
+		}
+	}
+	for _, mountedObj := range override.MountedObjects {
+		if mountedObj == nil {
+			continue
+		}
+		replaced := false
+		for i, baseObj := range merged.MountedObjects {
+			if baseObj != nil && baseObj.ObjectName == mountedObj.ObjectName {
+				merged.MountedObjects[i], replaced = mountedObj, true
+				break
+			}
+		}
+		if !replaced {
+			merged.MountedObjects = append(merged.MountedObjects, mountedObj)
+		}
+	}
+	for _, configMapObj := range override.ConfigMapObjects {
+		if configMapObj == nil {
+			continue
+		}
+		replaced := false
+		for i, baseObj := range merged.ConfigMapObjects {
+			if baseObj != nil && baseObj.ConfigMapName == configMapObj.ConfigMapName {
+				merged.ConfigMapObjects[i], replaced = configMapObj, true
+				break
+			}
+		}
+		if !replaced {
+			merged.ConfigMapObjects = append(merged.ConfigMapObjects, configMapObj)
+		}
+	}
+	if override.CacheTTL != nil {
+		merged.CacheTTL = override.CacheTTL
+	}
+	if override.RetryPolicy != nil {
+		merged.RetryPolicy = override.RetryPolicy
+	}
+	if override.ProviderTimeout != nil {
+		merged.ProviderTimeout = override.ProviderTimeout
+	}
+	if override.Fallback != nil {
+		merged.Fallback = override.Fallback
+	}
+	if len(override.AdditionalProviders) > 0 {
+		merged.AdditionalProviders = override.AdditionalProviders
+	}
+	if len(override.RestartPolicy) > 0 {
+		merged.RestartPolicy = override.RestartPolicy
+	}
+	if len(override.RotationWindows) > 0 {
+		merged.RotationWindows = override.RotationWindows
+	}
+	if len(override.RotationBlackouts) > 0 {
+		merged.RotationBlackouts = override.RotationBlackouts
+	}
+	if len(override.AllowedNamespaces) > 0 {
+		merged.AllowedNamespaces = override.AllowedNamespaces
+	}
+	if override.PodSelector != nil {
+		merged.PodSelector = override.PodSelector
+	}
+	if override.SecretObjectsOwner != nil {
+		merged.SecretObjectsOwner = override.SecretObjectsOwner
+	}
+	if len(override.OutputFiles) > 0 {
+		merged.OutputFiles = override.OutputFiles
+	}
+	if override.WriteChecksums {
+		merged.WriteChecksums = true
+	}
+	if override.SharedFetch {
+		merged.SharedFetch = true
+	}
+	if override.WriteMetadata {
+		merged.WriteMetadata = true
+	}
+	merged.Defaults = mergeDefaults(merged.Defaults, override.Defaults)
+	merged.Extends = override.Extends
+	return merged
+}
+
+// mergeDefaults returns the defaults of a secret provider class that extends
+// a class with the base defaults. The sync labels are merged by key, the other
+// fields of defaults replace the fields of base if they are set.
+func mergeDefaults(base, defaults *v1alpha1.SecretProviderClassDefaults) *v1alpha1.SecretProviderClassDefaults {
+	if base == nil {
+		return defaults
+	}
+	if defaults == nil {
+		return base
+	}
+	merged := base.DeepCopy()
+	if defaults.RotationInterval != nil {
+		merged.RotationInterval = defaults.RotationInterval
+	}
+	if len(defaults.FilePermission) > 0 {
+		merged.FilePermission = defaults.FilePermission
+	}
+	if len(defaults.Encoding) > 0 {
+		merged.Encoding = defaults.Encoding
+	}
+	if len(defaults.SyncLabels) > 0 {
+		merged.SyncLabels = withSyncLabels(merged.SyncLabels, defaults.SyncLabels)
+	}
+	return merged
+}
+
+// RestrictsPods returns true if the secret provider class restricts the pods
+// that are allowed to mount it
+func RestrictsPods(spc *v1alpha1.SecretProviderClass) bool {
+	return len(spc.Spec.AllowedNamespaces) > 0 || spc.Spec.PodSelector != nil
+}
+
+// CheckPodAllowed returns an error wrapping ErrPodNotAllowed if the namespace
+// of the pod isn't one of the allowed namespaces of the secret provider class
+// or if the labels of the pod don't match its pod selector
+func CheckPodAllowed(spc *v1alpha1.SecretProviderClass, pod *corev1.Pod) error {
+	if len(spc.Spec.AllowedNamespaces) > 0 {
+		allowed := false
+		for _, namespace := range spc.Spec.AllowedNamespaces {
+			if namespace == pod.Namespace {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return fmt.Errorf("%w: namespace %s of pod %s is not an allowed namespace of secretproviderclass %s", ErrPodNotAllowed, pod.Namespace, pod.Name, spc.Name)
+		}
+	}
+	if spc.Spec.PodSelector != nil {
+		selector, err := metav1.LabelSelectorAsSelector(spc.Spec.PodSelector)
+		if err != nil {
+			return fmt.Errorf("invalid pod selector of secretproviderclass %s, err: %v", spc.Name, err)
+		}
+		if !selector.Matches(labels.Set(pod.Labels)) {
+			return fmt.Errorf("%w: pod %s/%s is not selected by the pod selector of secretproviderclass %s", ErrPodNotAllowed, pod.Namespace, pod.Name, spc.Name)
+		}
+	}
+	return nil
+}
+
+// SubPathContainers returns the names of the containers and init containers of
+// the pod that mount the volume with subPath or subPathExpr. The files mounted
+// with subPath are bind mounted when the container starts, so the containers
+// don't see the updates of the volume, e.g. by the rotation.
+func SubPathContainers(pod *corev1.Pod, volumeName string) []string {
+	var names []string
+	containers := append(append([]corev1.Container{}, pod.Spec.InitContainers...), pod.Spec.Containers...)
+	for _, container := range containers {
+		for _, volumeMount := range container.VolumeMounts {
+			if volumeMount.Name == volumeName && (len(volumeMount.SubPath) > 0 || len(volumeMount.SubPathExpr) > 0) {
+				names = append(names, container.Name)
+				break
+			}
+		}
+	}
+	return names
+}
+
+// IsClusterSecretProviderClass returns true if the secret provider class was
+// returned by GetSecretProviderClass for a cluster secret provider class
+func IsClusterSecretProviderClass(spc *v1alpha1.SecretProviderClass) bool {
+	return spc.Kind == v1alpha1.ClusterSecretProviderClassKind
+}
+
 // getMountedFiles returns all the mounted files names with filepath base as key
 func getMountedFiles(targetPath string) (map[string]string, error) {
 	paths := make(map[string]string)
@@ -7,6 +7,7 @@ require (
 	github.com/blang/semver v3.5.0+incompatible
 	github.com/container-storage-interface/spec v1.0.0
 	github.com/golang/protobuf v1.4.2
+	github.com/google/gofuzz v1.0.0
 	github.com/kubernetes-csi/csi-lib-utils v0.6.1
 	github.com/kubernetes-csi/csi-test v1.1.0
 	github.com/onsi/gomega v1.8.1
@@ -15,12 +16,18 @@ require (
 	github.com/stretchr/testify v1.5.1
 	go.opentelemetry.io/otel v0.4.3
 	go.opentelemetry.io/otel/exporters/metric/prometheus v0.4.3
+	golang.org/x/crypto v0.0.0-20191011191535-87dc89f01550
 	golang.org/x/net v0.0.0-20200222125558-5a598a2470a0
+	golang.org/x/sys v0.0.0-20200302150141-5c8b2ff67527
+	golang.org/x/time v0.0.0-20190308202827-9d24e82272b4
 	google.golang.org/grpc v1.27.1
 	google.golang.org/protobuf v1.25.0
+	gopkg.in/fsnotify.v1 v1.4.7
 	k8s.io/api v0.17.2
+	k8s.io/apiextensions-apiserver v0.17.2
 	k8s.io/apimachinery v0.17.2
 	k8s.io/client-go v0.17.2
 	k8s.io/utils v0.0.0-20191114184206-e782cd3c129f
 	sigs.k8s.io/controller-runtime v0.5.5
+	sigs.k8s.io/yaml v1.1.0
 )
@@ -0,0 +1,491 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package conformance drives a provider through the scenarios the driver
+// relies on, e.g. the Mount, Version and rotation of the mounted contents, and
+// reports whether the provider passed each scenario. It is used by the
+// provider-conformance binary to certify providers before release.
+package conformance
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/blang/semver"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"sigs.k8s.io/secrets-store-csi-driver/pkg/providersdk"
+	secretsstore "sigs.k8s.io/secrets-store-csi-driver/pkg/secrets-store"
+	"sigs.k8s.io/secrets-store-csi-driver/pkg/version"
+	"sigs.k8s.io/secrets-store-csi-driver/provider/v1alpha1"
+)
+
+// Status is the result of a conformance scenario
+type Status string
+
+const (
+	// Passed is the status of a scenario the provider passed
+	Passed Status = "PASS"
+	// Failed is the status of a scenario the provider failed
+	Failed Status = "FAIL"
+	// Skipped is the status of a scenario that doesn't apply to the provider
+	Skipped Status = "SKIP"
+)
+
+// permission is the file permission of the mount requests
+const permission = "420"
+
+// Config is the configuration of a conformance run
+type Config struct {
+	// Provider is the name of the provider, the provider serves on the
+	// <Provider>.sock socket in the provider volume
+	Provider string
+	// ProviderVolume is the directory of the provider sockets
+	ProviderVolume string
+	// Parameters are the secret provider class parameters of the mount
+	// requests. The pod info is added if not set.
+	Parameters map[string]string
+	// Secrets are the node publish secrets of the mount requests
+	Secrets map[string]string
+	// DriverVersion is the driver version checked against the minimum driver
+	// version of the provider. The check is skipped if not set.
+	DriverVersion string
+	// RotationWait is the duration to wait for the mounted objects to be
+	// rotated. The rotation scenario is skipped if not set.
+	RotationWait time.Duration
+	// Timeout is the timeout of each provider call
+	Timeout time.Duration
+}
+
+// Result is the result of a conformance scenario
+type Result struct {
+	Scenario string        `json:"scenario"`
+	Status   Status        `json:"status"`
+	Message  string        `json:"message,omitempty"`
+	Duration time.Duration `json:"duration"`
+}
+
+// Report is the result of the conformance scenarios for a provider
+type Report struct {
+	Provider string   `json:"provider"`
+	Results  []Result `json:"results"`
+}
+
+// Passed returns true if the provider didn't fail any scenario
+func (r *Report) Passed() bool {
+	for _, result := range r.Results {
+		if result.Status == Failed {
+			return false
+		}
+	}
+	return true
+}
+
+// WriteText writes the report as a table
+func (r *Report) WriteText(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(tw, "SCENARIO\tSTATUS\tDURATION\tMESSAGE\n")
+	for _, result := range r.Results {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", result.Scenario, result.Status, result.Duration.Round(time.Millisecond), result.Message)
+	}
+	summary := "PASSED"
+	if !r.Passed() {
+		summary = "FAILED"
+	}
+	fmt.Fprintf(tw, "\nprovider %s %s conformance\n", r.Provider, summary)
+	return tw.Flush()
+}
+
+// WriteJSON writes the report as json
+func (r *Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// scenario is a conformance scenario. run returns the status and a message
+// describing the result.
+type scenario struct {
+	name string
+	run  func(r *runner, ctx context.Context) (Status, string)
+}
+
+// scenarios are the conformance scenarios in the order they are run. Later
+// scenarios compare their results to the results of the Mount scenario.
+var scenarios = []scenario{
+	{name: "Version", run: (*runner).checkVersion},
+	{name: "Health", run: (*runner).checkHealth},
+	{name: "Capabilities", run: (*runner).checkCapabilities},
+	{name: "Mount", run: (*runner).checkMount},
+	{name: "MountStream", run: (*runner).checkMountStream},
+	{name: "InvalidMountRequest", run: (*runner).checkInvalidMountRequest},
+	{name: "Rotation", run: (*runner).checkRotation},
+}
+
+// runner holds the state shared by the scenarios of a conformance run
+type runner struct {
+	config       Config
+	client       v1alpha1.CSIDriverProviderClient
+	capabilities secretsstore.ProviderCapabilities
+	attributes   string
+	secrets      string
+	// mounted is the result of the Mount scenario, nil if the scenario failed
+	mounted *mountResult
+	// tempDirs are the target paths removed at the end of the run
+	tempDirs []string
+}
+
+// mountResult is the object versions and the files mounted in a target path
+type mountResult struct {
+	targetPath     string
+	objectVersions map[string]string
+	files          map[string]string
+}
+
+// Run runs the conformance scenarios against the provider and returns the
+// report. An error is returned if the provider can't be reached.
+func Run(ctx context.Context, config Config) (*Report, error) {
+	if len(config.Provider) == 0 {
+		return nil, errors.New("provider is not set")
+	}
+	r, err := newRunner(config)
+	if err != nil {
+		return nil, err
+	}
+	defer r.cleanup()
+
+	builder := secretsstore.NewPluginClientBuilder(config.ProviderVolume)
+	defer builder.Cleanup()
+	if !builder.HasProvider(config.Provider) {
+		return nil, fmt.Errorf("provider %s socket not found in %s", config.Provider, config.ProviderVolume)
+	}
+	if r.client, err = builder.Get(ctx, config.Provider); err != nil {
+		return nil, err
+	}
+
+	report := &Report{Provider: config.Provider}
+	for _, s := range scenarios {
+		start := time.Now()
+		scenarioStatus, message := s.run(r, ctx)
+		report.Results = append(report.Results, Result{
+			Scenario: s.name,
+			Status:   scenarioStatus,
+			Message:  message,
+			Duration: time.Since(start),
+		})
+	}
+	return report, nil
+}
+
+// newRunner returns a runner with the attributes and secrets of the mount
+// requests for the config
+func newRunner(config Config) (*runner, error) {
+	if config.Timeout == 0 {
+		config.Timeout = 30 * time.Second
+	}
+	parameters := map[string]string{
+		providersdk.PodNameParameter:            "provider-conformance",
+		providersdk.PodNamespaceParameter:       "default",
+		providersdk.PodUIDParameter:             "9d4a5b4c-6a1e-4a3c-8e5b-1c2d3e4f5a6b",
+		providersdk.ServiceAccountNameParameter: "default",
+	}
+	for k, v := range config.Parameters {
+		parameters[k] = v
+	}
+	attributes, err := json.Marshal(parameters)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal parameters, err: %+v", err)
+	}
+	secrets := config.Secrets
+	if secrets == nil {
+		secrets = map[string]string{}
+	}
+	secretsStr, err := json.Marshal(secrets)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal secrets, err: %+v", err)
+	}
+	return &runner{
+		config:       config,
+		attributes:   string(attributes),
+		secrets:      string(secretsStr),
+		capabilities: secretsstore.ProviderCapabilities{ObjectVersioning: true},
+	}, nil
+}
+
+// cleanup removes the target paths of the run
+func (r *runner) cleanup() {
+	for _, dir := range r.tempDirs {
+		os.RemoveAll(dir)
+	}
+}
+
+// targetPath returns a new empty target path
+func (r *runner) targetPath() (string, error) {
+	dir, err := ioutil.TempDir("", "provider-conformance")
+	if err != nil {
+		return "", err
+	}
+	r.tempDirs = append(r.tempDirs, dir)
+	return dir, nil
+}
+
+// checkVersion checks the provider reports a valid version compatible with the
+// driver version
+func (r *runner) checkVersion(ctx context.Context) (Status, string) {
+	ctx, cancel := context.WithTimeout(ctx, r.config.Timeout)
+	defer cancel()
+	resp, err := r.client.Version(ctx, &v1alpha1.VersionRequest{Version: r.config.DriverVersion})
+	if err != nil {
+		return Failed, fmt.Sprintf("Version RPC failed, err: %+v", err)
+	}
+	if len(resp.GetRuntimeName()) == 0 {
+		return Failed, "runtime name is not set"
+	}
+	if _, err := semver.ParseTolerant(resp.GetRuntimeVersion()); err != nil {
+		return Failed, fmt.Sprintf("runtime version %q is not a valid semver, err: %+v", resp.GetRuntimeVersion(), err)
+	}
+	if len(resp.GetMinDriverVersion()) > 0 {
+		if _, err := semver.ParseTolerant(resp.GetMinDriverVersion()); err != nil {
+			return Failed, fmt.Sprintf("minimum driver version %q is not a valid semver, err: %+v", resp.GetMinDriverVersion(), err)
+		}
+	}
+	message := fmt.Sprintf("%s %s", resp.GetRuntimeName(), resp.GetRuntimeVersion())
+	if len(r.config.DriverVersion) > 0 {
+		compatible, err := version.IsDriverCompatible(r.config.DriverVersion, resp.GetMinDriverVersion())
+		if err != nil {
+			return Failed, err.Error()
+		}
+		if !compatible {
+			return Failed, fmt.Sprintf("%s requires minimum driver version %s, driver version is %s", message, resp.GetMinDriverVersion(), r.config.DriverVersion)
+		}
+	}
+	return Passed, message
+}
+
+// checkHealth checks the provider reports to be healthy. The Health RPC is optional.
+func (r *runner) checkHealth(ctx context.Context) (Status, string) {
+	ctx, cancel := context.WithTimeout(ctx, r.config.Timeout)
+	defer cancel()
+	resp, err := r.client.Health(ctx, &v1alpha1.HealthRequest{})
+	if status.Code(err) == codes.Unimplemented {
+		return Skipped, "Health RPC is not implemented"
+	}
+	if err != nil {
+		return Failed, fmt.Sprintf("Health RPC failed, err: %+v", err)
+	}
+	if !resp.GetHealthy() {
+		return Failed, fmt.Sprintf("provider is unhealthy: %s", resp.GetMessage())
+	}
+	return Passed, ""
+}
+
+// checkCapabilities gets the capabilities advertised by the provider. The
+// Capabilities RPC is optional, the default capabilities are used if the
+// provider doesn't implement it.
+func (r *runner) checkCapabilities(ctx context.Context) (Status, string) {
+	ctx, cancel := context.WithTimeout(ctx, r.config.Timeout)
+	defer cancel()
+	resp, err := r.client.Capabilities(ctx, &v1alpha1.CapabilitiesRequest{})
+	if status.Code(err) == codes.Unimplemented {
+		return Skipped, "Capabilities RPC is not implemented, using the default capabilities"
+	}
+	if err != nil {
+		return Failed, fmt.Sprintf("Capabilities RPC failed, err: %+v", err)
+	}
+	var capabilities []string
+	for _, capability := range resp.GetCapabilities() {
+		switch capability {
+		case v1alpha1.Capability_ROTATION:
+			r.capabilities.Rotation = true
+		case v1alpha1.Capability_STREAMING:
+			r.capabilities.Streaming = true
+		case v1alpha1.Capability_TOKEN_AUTH:
+			r.capabilities.TokenAuth = true
+		}
+		capabilities = append(capabilities, capability.String())
+	}
+	r.capabilities.ObjectVersioning = containsCapability(resp.GetCapabilities(), v1alpha1.Capability_OBJECT_VERSIONING)
+	return Passed, strings.Join(capabilities, ",")
+}
+
+// checkMount checks the objects are mounted to the target path
+func (r *runner) checkMount(ctx context.Context) (Status, string) {
+	result, err := r.mountContent(ctx, secretsstore.MountContent)
+	if err != nil {
+		return Failed, err.Error()
+	}
+	r.mounted = result
+	return Passed, fmt.Sprintf("mounted %d files, %d object versions", len(result.files), len(result.objectVersions))
+}
+
+// checkMountStream checks the streamed files are the same as the mounted files
+func (r *runner) checkMountStream(ctx context.Context) (Status, string) {
+	if !r.capabilities.Streaming {
+		return Skipped, "provider doesn't advertise the STREAMING capability"
+	}
+	result, err := r.mountContent(ctx, secretsstore.MountContentStream)
+	if err != nil {
+		return Failed, err.Error()
+	}
+	if r.mounted != nil && !reflect.DeepEqual(result.files, r.mounted.files) {
+		return Failed, fmt.Sprintf("streamed files %v don't match the mounted files %v", fileNames(result.files), fileNames(r.mounted.files))
+	}
+	return Passed, fmt.Sprintf("streamed %d files", len(result.files))
+}
+
+// checkInvalidMountRequest checks the provider rejects a mount request with
+// malformed attributes
+func (r *runner) checkInvalidMountRequest(ctx context.Context) (Status, string) {
+	targetPath, err := r.targetPath()
+	if err != nil {
+		return Failed, err.Error()
+	}
+	ctx, cancel := context.WithTimeout(ctx, r.config.Timeout)
+	defer cancel()
+	_, _, err = secretsstore.MountContent(ctx, r.client, r.capabilities, "{", r.secrets, targetPath, permission)
+	if err == nil {
+		return Failed, "mount request with malformed attributes succeeded"
+	}
+	return Passed, ""
+}
+
+// checkRotation checks the mounted objects are rotated within the rotation wait.
+// Providers that advertise the ROTATION capability are expected to update the
+// target path, other providers are expected to return the new objects when
+// the objects are mounted again.
+func (r *runner) checkRotation(ctx context.Context) (Status, string) {
+	if r.config.RotationWait == 0 {
+		return Skipped, "rotation wait is not set"
+	}
+	if r.mounted == nil {
+		return Failed, "Mount scenario failed"
+	}
+	select {
+	case <-ctx.Done():
+		return Failed, ctx.Err().Error()
+	case <-time.After(r.config.RotationWait):
+	}
+
+	if r.capabilities.Rotation {
+		files, err := readFiles(r.mounted.targetPath)
+		if err != nil {
+			return Failed, err.Error()
+		}
+		if reflect.DeepEqual(files, r.mounted.files) {
+			return Failed, fmt.Sprintf("mounted files not rotated in %s", r.config.RotationWait)
+		}
+		return Passed, "mounted files updated by the provider"
+	}
+
+	result, err := r.mountContent(ctx, secretsstore.MountContent)
+	if err != nil {
+		return Failed, err.Error()
+	}
+	if reflect.DeepEqual(result.files, r.mounted.files) {
+		return Failed, fmt.Sprintf("mounted files not rotated in %s", r.config.RotationWait)
+	}
+	if r.capabilities.ObjectVersioning && reflect.DeepEqual(result.objectVersions, r.mounted.objectVersions) {
+		return Failed, "mounted files rotated without updating the object versions"
+	}
+	return Passed, "rotated files mounted"
+}
+
+// mountFunc is the signature of secretsstore.MountContent and
+// secretsstore.MountContentStream
+type mountFunc func(ctx context.Context, client v1alpha1.CSIDriverProviderClient, capabilities secretsstore.ProviderCapabilities, attributes, secrets, targetPath, permission string) (map[string]string, string, error)
+
+// mountContent mounts the objects to a new target path and returns the
+// object versions and the mounted files
+func (r *runner) mountContent(ctx context.Context, mount mountFunc) (*mountResult, error) {
+	targetPath, err := r.targetPath()
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, r.config.Timeout)
+	defer cancel()
+	objectVersions, errorCode, err := mount(ctx, r.client, r.capabilities, r.attributes, r.secrets, targetPath, permission)
+	if err != nil {
+		return nil, fmt.Errorf("mount failed with error code %s, err: %+v", errorCode, err)
+	}
+	files, err := readFiles(targetPath)
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, errors.New("no files mounted to the target path")
+	}
+	return &mountResult{targetPath: targetPath, objectVersions: objectVersions, files: files}, nil
+}
+
+// readFiles returns the contents of the files in the target path by the path
+// relative to the target path
+func readFiles(targetPath string) (map[string]string, error) {
+	files := make(map[string]string)
+	err := filepath.Walk(targetPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		contents, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(targetPath, path)
+		if err != nil {
+			return err
+		}
+		files[filepath.ToSlash(rel)] = string(contents)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read files in %s, err: %+v", targetPath, err)
+	}
+	return files, nil
+}
+
+// fileNames returns the sorted names of the files
+func fileNames(files map[string]string) []string {
+	var names []string
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// containsCapability returns true if the capability is in the capabilities
+func containsCapability(capabilities []v1alpha1.Capability, capability v1alpha1.Capability) bool {
+	for _, c := range capabilities {
+		if c == capability {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,240 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package conformance
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"sigs.k8s.io/secrets-store-csi-driver/pkg/providersdk"
+	"sigs.k8s.io/secrets-store-csi-driver/provider/fake"
+	"sigs.k8s.io/secrets-store-csi-driver/provider/v1alpha1"
+)
+
+// failingProvider fails all mount requests
+type failingProvider struct{}
+
+func (p *failingProvider) Mount(ctx context.Context, req *providersdk.MountRequest) (*providersdk.MountResponse, error) {
+	return nil, status.Error(codes.Unavailable, "secrets store not reachable")
+}
+
+// staticProvider mounts the same file for all mount requests
+type staticProvider struct{}
+
+func (p *staticProvider) Mount(ctx context.Context, req *providersdk.MountRequest) (*providersdk.MountResponse, error) {
+	resp := providersdk.NewMountResponse()
+	if err := resp.AddObject("secret/foo", "v1", "foo", req.Permission, []byte("foo-v1")); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func getTempTestDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "ut")
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	return dir
+}
+
+func TestRun(t *testing.T) {
+	cases := []struct {
+		name             string
+		parameters       map[string]string
+		rotationWait     time.Duration
+		expectedStatuses map[string]Status
+	}{
+		{
+			name:       "rotation skipped",
+			parameters: map[string]string{"objects": "foo,bar"},
+			expectedStatuses: map[string]Status{
+				"Version":             Passed,
+				"Health":              Passed,
+				"Capabilities":        Passed,
+				"Mount":               Passed,
+				"MountStream":         Skipped,
+				"InvalidMountRequest": Passed,
+				"Rotation":            Skipped,
+			},
+		},
+		{
+			name:         "objects rotated",
+			parameters:   map[string]string{"objects": "foo,bar"},
+			rotationWait: 200 * time.Millisecond,
+			expectedStatuses: map[string]Status{
+				"Mount":    Passed,
+				"Rotation": Passed,
+			},
+		},
+		{
+			name:         "objects not rotated",
+			parameters:   map[string]string{"objects": "foo,bar", "version": "v1"},
+			rotationWait: 200 * time.Millisecond,
+			expectedStatuses: map[string]Status{
+				"Mount":    Passed,
+				"Rotation": Failed,
+			},
+		},
+		{
+			name:       "mount failed",
+			parameters: map[string]string{},
+			expectedStatuses: map[string]Status{
+				"Version":  Passed,
+				"Mount":    Failed,
+				"Rotation": Skipped,
+			},
+		},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			dir := getTempTestDir(t)
+			defer os.RemoveAll(dir)
+
+			provider := fake.NewProvider(filepath.Join(dir, "fake.sock"), 100*time.Millisecond)
+			if err := provider.Start(); err != nil {
+				t.Fatalf("expected err to be nil, got: %+v", err)
+			}
+			defer provider.Stop()
+
+			report, err := Run(context.TODO(), Config{
+				Provider:       "fake",
+				ProviderVolume: dir,
+				Parameters:     test.parameters,
+				DriverVersion:  "0.0.13",
+				RotationWait:   test.rotationWait,
+			})
+			if err != nil {
+				t.Fatalf("expected err to be nil, got: %+v", err)
+			}
+			if len(report.Results) != len(scenarios) {
+				t.Fatalf("expected %d results, got: %d", len(scenarios), len(report.Results))
+			}
+			passed := true
+			for _, result := range report.Results {
+				if result.Status == Failed {
+					passed = false
+				}
+				if expected, ok := test.expectedStatuses[result.Scenario]; ok && result.Status != expected {
+					t.Errorf("expected scenario %s status: %s, got: %s (%s)", result.Scenario, expected, result.Status, result.Message)
+				}
+			}
+			if report.Passed() != passed {
+				t.Errorf("expected report passed: %v, got: %v", passed, report.Passed())
+			}
+		})
+	}
+}
+
+func TestRunFailingProvider(t *testing.T) {
+	dir := getTempTestDir(t)
+	defer os.RemoveAll(dir)
+
+	server := providersdk.NewServer(filepath.Join(dir, "failing.sock"), providersdk.Config{Name: "failing", Version: "0.0.1", MinDriverVersion: "0.0.20"}, &failingProvider{})
+	if err := server.Start(); err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	defer server.Stop()
+
+	report, err := Run(context.TODO(), Config{
+		Provider:       "failing",
+		ProviderVolume: dir,
+		DriverVersion:  "0.0.13",
+		RotationWait:   time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	if report.Passed() {
+		t.Fatalf("expected report to fail")
+	}
+	for _, result := range report.Results {
+		switch result.Scenario {
+		case "Version", "Mount", "Rotation":
+			if result.Status != Failed {
+				t.Errorf("expected scenario %s to fail, got: %s (%s)", result.Scenario, result.Status, result.Message)
+			}
+		}
+	}
+
+	var text bytes.Buffer
+	if err := report.WriteText(&text); err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	if !strings.Contains(text.String(), "provider failing FAILED conformance") {
+		t.Errorf("expected report summary, got: %s", text.String())
+	}
+	var buf bytes.Buffer
+	if err := report.WriteJSON(&buf); err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	var decoded Report
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	if len(decoded.Results) != len(report.Results) {
+		t.Errorf("expected %d results in json report, got: %d", len(report.Results), len(decoded.Results))
+	}
+}
+
+func TestRunStreamingProvider(t *testing.T) {
+	dir := getTempTestDir(t)
+	defer os.RemoveAll(dir)
+
+	server := providersdk.NewServer(filepath.Join(dir, "static.sock"), providersdk.Config{
+		Name:         "static",
+		Version:      "0.0.1",
+		Capabilities: []v1alpha1.Capability{v1alpha1.Capability_OBJECT_VERSIONING, v1alpha1.Capability_STREAMING},
+		ChunkSize:    2,
+	}, &staticProvider{})
+	if err := server.Start(); err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	defer server.Stop()
+
+	report, err := Run(context.TODO(), Config{Provider: "static", ProviderVolume: dir})
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	for _, result := range report.Results {
+		if result.Scenario == "MountStream" && result.Status != Passed {
+			t.Errorf("expected scenario MountStream status: PASS, got: %s (%s)", result.Status, result.Message)
+		}
+	}
+	if !report.Passed() {
+		t.Errorf("expected report to pass")
+	}
+}
+
+func TestRunProviderNotFound(t *testing.T) {
+	dir := getTempTestDir(t)
+	defer os.RemoveAll(dir)
+
+	if _, err := Run(context.TODO(), Config{Provider: "fake", ProviderVolume: dir}); err == nil {
+		t.Fatalf("expected err to be not nil")
+	}
+}
@@ -0,0 +1,102 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package providersdk
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"sigs.k8s.io/secrets-store-csi-driver/provider/v1alpha1"
+)
+
+const (
+	// PodNameParameter is the parameter with the name of the pod
+	PodNameParameter = "csi.storage.k8s.io/pod.name"
+	// PodNamespaceParameter is the parameter with the namespace of the pod
+	PodNamespaceParameter = "csi.storage.k8s.io/pod.namespace"
+	// PodUIDParameter is the parameter with the uid of the pod
+	PodUIDParameter = "csi.storage.k8s.io/pod.uid"
+	// ServiceAccountNameParameter is the parameter with the service account
+	// name of the pod
+	ServiceAccountNameParameter = "csi.storage.k8s.io/serviceAccount.name"
+)
+
+// MountRequest is a parsed mount request of the driver
+type MountRequest struct {
+	// Parameters are the parameters of the SecretProviderClass and the pod
+	// attributes added by the driver
+	Parameters map[string]string
+	// Secrets is the secret data referenced in nodePublishSecretRef
+	Secrets map[string]string
+	// TargetPath is the path the volume is published to
+	TargetPath string
+	// Permission is the permission of the mounted files
+	Permission os.FileMode
+}
+
+// ParseMountRequest parses the attributes, secrets and permission of the mount
+// request
+func ParseMountRequest(req *v1alpha1.MountRequest) (*MountRequest, error) {
+	if len(req.GetAttributes()) == 0 {
+		return nil, fmt.Errorf("missing attributes")
+	}
+	if len(req.GetTargetPath()) == 0 {
+		return nil, fmt.Errorf("missing target path")
+	}
+	if len(req.GetPermission()) == 0 {
+		return nil, fmt.Errorf("missing permissions")
+	}
+
+	mountReq := &MountRequest{TargetPath: req.GetTargetPath()}
+	if err := json.Unmarshal([]byte(req.GetAttributes()), &mountReq.Parameters); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal attributes, err: %v", err)
+	}
+	if len(req.GetSecrets()) > 0 {
+		if err := json.Unmarshal([]byte(req.GetSecrets()), &mountReq.Secrets); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal secrets, err: %v", err)
+		}
+	}
+	if err := json.Unmarshal([]byte(req.GetPermission()), &mountReq.Permission); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal file permission, err: %v", err)
+	}
+	if mountReq.Parameters == nil {
+		mountReq.Parameters = make(map[string]string)
+	}
+	return mountReq, nil
+}
+
+// PodName returns the name of the pod the volume is mounted for
+func (r *MountRequest) PodName() string {
+	return r.Parameters[PodNameParameter]
+}
+
+// PodNamespace returns the namespace of the pod the volume is mounted for
+func (r *MountRequest) PodNamespace() string {
+	return r.Parameters[PodNamespaceParameter]
+}
+
+// PodUID returns the uid of the pod the volume is mounted for
+func (r *MountRequest) PodUID() string {
+	return r.Parameters[PodUIDParameter]
+}
+
+// ServiceAccountName returns the service account name of the pod the volume
+// is mounted for
+func (r *MountRequest) ServiceAccountName() string {
+	return r.Parameters[ServiceAccountNameParameter]
+}
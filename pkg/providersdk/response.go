@@ -0,0 +1,121 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package providersdk
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"sigs.k8s.io/secrets-store-csi-driver/pkg/util/fileutil"
+	"sigs.k8s.io/secrets-store-csi-driver/provider/v1alpha1"
+)
+
+// MountResponse builds the files and object versions returned to the driver,
+// which writes the files to the target path
+type MountResponse struct {
+	files          []*v1alpha1.File
+	objectVersions []*v1alpha1.ObjectVersion
+	paths          map[string]bool
+}
+
+// NewMountResponse returns an empty mount response
+func NewMountResponse() *MountResponse {
+	return &MountResponse{paths: make(map[string]bool)}
+}
+
+// AddFile adds a file with the path relative to the target path. An error is
+// returned if the path is absolute, contains '..' elements or was already added.
+func (r *MountResponse) AddFile(path string, mode os.FileMode, contents []byte) error {
+	file := &v1alpha1.File{Path: path, Mode: int32(mode), Contents: contents}
+	if err := fileutil.ValidatePayloads([]*v1alpha1.File{file}); err != nil {
+		return err
+	}
+	if r.paths[filepath.Clean(path)] {
+		return fmt.Errorf("invalid file path %q, duplicate path", path)
+	}
+	r.paths[filepath.Clean(path)] = true
+	r.files = append(r.files, file)
+	return nil
+}
+
+// AddObjectVersion adds the version of an object fetched from the secrets
+// store. The id must be unique, e.g. secret/secret1.
+func (r *MountResponse) AddObjectVersion(id, version string) {
+	r.objectVersions = append(r.objectVersions, &v1alpha1.ObjectVersion{Id: id, Version: version})
+}
+
+// SetObjectExpiry sets the expiry of an object added with AddObjectVersion,
+// e.g. the end of the lease of a dynamic credential. The driver rotates the
+// volume shortly before the earliest expiry of the mounted objects.
+func (r *MountResponse) SetObjectExpiry(id string, expiry time.Time) {
+	for _, ov := range r.objectVersions {
+		if ov.Id == id {
+			ov.ExpiryTime = expiry.Unix()
+		}
+	}
+}
+
+// AddObject adds the file and the version of an object
+func (r *MountResponse) AddObject(id, version, path string, mode os.FileMode, contents []byte) error {
+	if err := r.AddFile(path, mode, contents); err != nil {
+		return err
+	}
+	r.AddObjectVersion(id, version)
+	return nil
+}
+
+// Files returns the files of the response
+func (r *MountResponse) Files() []*v1alpha1.File {
+	return r.files
+}
+
+// ObjectVersions returns the object versions of the response
+func (r *MountResponse) ObjectVersions() []*v1alpha1.ObjectVersion {
+	return r.objectVersions
+}
+
+// Error is a provider error with a standardized reason. The driver records
+// a pod event with a distinct reason for each standardized reason.
+type Error struct {
+	// Reason is the standardized reason of the error
+	Reason v1alpha1.ErrorReason
+	// Code is the provider specific error code, used in the driver metrics
+	Code string
+	// Message is the human readable description of the error
+	Message string
+}
+
+// NewError returns a provider error with the standardized reason
+func NewError(reason v1alpha1.ErrorReason, code, message string) *Error {
+	return &Error{Reason: reason, Code: code, Message: message}
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s (code: %s): %s", e.Reason, e.Code, e.Message)
+}
+
+// proto returns the error of the mount response. The reason is used as the
+// code if the code isn't set, so the driver always detects the error.
+func (e *Error) proto() *v1alpha1.Error {
+	code := e.Code
+	if len(code) == 0 {
+		code = e.Reason.String()
+	}
+	return &v1alpha1.Error{Reason: e.Reason, Code: code, Message: e.Message}
+}
@@ -0,0 +1,252 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package providersdk is a scaffold for providers of the Secrets Store CSI
+// Driver. The Server serves the provider grpc interface on the provider socket,
+// parses the mount requests, builds the mount responses and reports the
+// provider version and capabilities, so a provider only implements fetching
+// the objects from its secrets store.
+package providersdk
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+
+	"github.com/blang/semver"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"sigs.k8s.io/secrets-store-csi-driver/provider/v1alpha1"
+)
+
+const (
+	// providerAPIVersion is the version of the provider grpc interface
+	providerAPIVersion = "v1alpha1"
+	// defaultChunkSize is the default maximum size of the file chunks in the
+	// mount stream
+	defaultChunkSize = 1024 * 1024
+)
+
+// Provider fetches the objects of the mount requests from a secrets store
+type Provider interface {
+	// Mount returns the files and the object versions for the mount request.
+	// Return an *Error to report a standardized error reason to the driver.
+	Mount(ctx context.Context, req *MountRequest) (*MountResponse, error)
+}
+
+// HealthChecker is implemented by providers that report their health, e.g.
+// whether the secrets store is reachable. Providers that don't implement
+// HealthChecker are always reported as healthy.
+type HealthChecker interface {
+	// Health returns an error if the provider can't serve mount requests
+	Health(ctx context.Context) error
+}
+
+// Config is the configuration of the provider server
+type Config struct {
+	// Name is the runtime name of the provider reported to the driver
+	Name string
+	// Version is the semver-compatible version of the provider
+	Version string
+	// MinDriverVersion is the minimum semver-compatible driver version the
+	// provider works with. All driver versions are supported if not set.
+	MinDriverVersion string
+	// Capabilities are the capabilities advertised to the driver. The
+	// server implements the STREAMING capability for the provider.
+	Capabilities []v1alpha1.Capability
+	// ParametersSchema is the JSON schema of the SecretProviderClass
+	// parameters advertised to the driver. The driver rejects the mount
+	// requests with parameters that don't match the schema.
+	ParametersSchema string
+	// ChunkSize is the maximum size of the file chunks in the mount stream,
+	// defaults to 1MiB
+	ChunkSize int
+	// ServerOptions are the options of the grpc server, e.g. the credentials
+	// for mTLS
+	ServerOptions []grpc.ServerOption
+}
+
+// validate returns an error if the name isn't set or the versions aren't
+// semver-compatible
+func (c Config) validate() error {
+	if len(c.Name) == 0 {
+		return fmt.Errorf("provider name is not set")
+	}
+	if _, err := semver.ParseTolerant(c.Version); err != nil {
+		return fmt.Errorf("invalid provider version %q, err: %v", c.Version, err)
+	}
+	if len(c.MinDriverVersion) > 0 {
+		if _, err := semver.ParseTolerant(c.MinDriverVersion); err != nil {
+			return fmt.Errorf("invalid minimum driver version %q, err: %v", c.MinDriverVersion, err)
+		}
+	}
+	if len(c.ParametersSchema) > 0 && !json.Valid([]byte(c.ParametersSchema)) {
+		return fmt.Errorf("parameters schema is not valid json")
+	}
+	return nil
+}
+
+// Server serves the provider grpc interface for a Provider
+type Server struct {
+	v1alpha1.UnimplementedCSIDriverProviderServer
+
+	config     Config
+	provider   Provider
+	socketPath string
+	grpcServer *grpc.Server
+	listener   net.Listener
+}
+
+// NewServer returns a server for the provider that serves on the unix domain
+// socket. The socket must be named <provider-name>.sock in the providers
+// directory of the driver.
+func NewServer(socketPath string, config Config, provider Provider) *Server {
+	if config.ChunkSize <= 0 {
+		config.ChunkSize = defaultChunkSize
+	}
+	s := &Server{
+		config:     config,
+		provider:   provider,
+		socketPath: socketPath,
+		grpcServer: grpc.NewServer(config.ServerOptions...),
+	}
+	v1alpha1.RegisterCSIDriverProviderServer(s.grpcServer, s)
+	return s
+}
+
+// Start validates the configuration and starts serving. The socket of a
+// previous run of the provider is removed.
+func (s *Server) Start() error {
+	if err := s.config.validate(); err != nil {
+		return err
+	}
+	if err := os.Remove(s.socketPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove socket %s, err: %v", s.socketPath, err)
+	}
+	var err error
+	s.listener, err = net.Listen("unix", s.socketPath)
+	if err != nil {
+		return err
+	}
+	go s.grpcServer.Serve(s.listener)
+	return nil
+}
+
+// Stop stops serving and removes the socket
+func (s *Server) Stop() {
+	s.grpcServer.Stop()
+	os.Remove(s.socketPath)
+}
+
+// Version implements provider csi-provider method
+func (s *Server) Version(ctx context.Context, req *v1alpha1.VersionRequest) (*v1alpha1.VersionResponse, error) {
+	return &v1alpha1.VersionResponse{
+		Version:          providerAPIVersion,
+		RuntimeName:      s.config.Name,
+		RuntimeVersion:   s.config.Version,
+		MinDriverVersion: s.config.MinDriverVersion,
+	}, nil
+}
+
+// Health implements provider csi-provider method
+func (s *Server) Health(ctx context.Context, req *v1alpha1.HealthRequest) (*v1alpha1.HealthResponse, error) {
+	checker, ok := s.provider.(HealthChecker)
+	if !ok {
+		return &v1alpha1.HealthResponse{Healthy: true}, nil
+	}
+	if err := checker.Health(ctx); err != nil {
+		return &v1alpha1.HealthResponse{Healthy: false, Message: err.Error()}, nil
+	}
+	return &v1alpha1.HealthResponse{Healthy: true}, nil
+}
+
+// Capabilities implements provider csi-provider method
+func (s *Server) Capabilities(ctx context.Context, req *v1alpha1.CapabilitiesRequest) (*v1alpha1.CapabilitiesResponse, error) {
+	return &v1alpha1.CapabilitiesResponse{
+		Capabilities:     append([]v1alpha1.Capability{}, s.config.Capabilities...),
+		ParametersSchema: s.config.ParametersSchema,
+	}, nil
+}
+
+// Mount implements provider csi-provider method
+func (s *Server) Mount(ctx context.Context, req *v1alpha1.MountRequest) (*v1alpha1.MountResponse, error) {
+	resp, err := s.mount(ctx, req)
+	if providerErr := (*Error)(nil); errors.As(err, &providerErr) {
+		// the error is returned in the response so the driver gets the reason
+		return &v1alpha1.MountResponse{Error: providerErr.proto()}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &v1alpha1.MountResponse{
+		ObjectVersion: resp.objectVersions,
+		Files:         resp.files,
+	}, nil
+}
+
+// MountStream implements provider csi-provider method. The files are split in
+// chunks of at most ChunkSize bytes.
+func (s *Server) MountStream(req *v1alpha1.MountRequest, stream v1alpha1.CSIDriverProvider_MountStreamServer) error {
+	resp, err := s.mount(stream.Context(), req)
+	if providerErr := (*Error)(nil); errors.As(err, &providerErr) {
+		return stream.Send(&v1alpha1.MountStreamResponse{Error: providerErr.proto()})
+	}
+	if err != nil {
+		return err
+	}
+	if err := stream.Send(&v1alpha1.MountStreamResponse{ObjectVersion: resp.objectVersions}); err != nil {
+		return err
+	}
+	for _, file := range resp.files {
+		for offset := 0; offset == 0 || offset < len(file.Contents); offset += s.config.ChunkSize {
+			end := offset + s.config.ChunkSize
+			if end > len(file.Contents) {
+				end = len(file.Contents)
+			}
+			chunk := &v1alpha1.FileChunk{
+				Path:     file.Path,
+				Mode:     file.Mode,
+				Offset:   int64(offset),
+				Contents: file.Contents[offset:end],
+			}
+			if err := stream.Send(&v1alpha1.MountStreamResponse{Chunks: []*v1alpha1.FileChunk{chunk}}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// mount parses the mount request and calls the provider
+func (s *Server) mount(ctx context.Context, req *v1alpha1.MountRequest) (*MountResponse, error) {
+	mountReq, err := ParseMountRequest(req)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	resp, err := s.provider.Mount(ctx, mountReq)
+	if err != nil {
+		return nil, err
+	}
+	if resp == nil {
+		return NewMountResponse(), nil
+	}
+	return resp, nil
+}
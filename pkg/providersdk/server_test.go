@@ -0,0 +1,313 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package providersdk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"sigs.k8s.io/secrets-store-csi-driver/provider/v1alpha1"
+)
+
+// testProvider mounts the files set in the test or returns the error
+type testProvider struct {
+	files     map[string]string
+	err       error
+	healthErr error
+}
+
+func (p *testProvider) Mount(ctx context.Context, req *MountRequest) (*MountResponse, error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+	resp := NewMountResponse()
+	for path, contents := range p.files {
+		if err := resp.AddObject("secret/"+path, "v1", path, req.Permission, []byte(contents)); err != nil {
+			return nil, err
+		}
+	}
+	return resp, nil
+}
+
+func (p *testProvider) Health(ctx context.Context) error {
+	return p.healthErr
+}
+
+// startTestServer starts a server for the provider and returns a client
+func startTestServer(t *testing.T, config Config, provider Provider) (v1alpha1.CSIDriverProviderClient, func()) {
+	dir, err := ioutil.TempDir("", "ut")
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	socket := filepath.Join(dir, "provider1.sock")
+	server := NewServer(socket, config, provider)
+	if err := server.Start(); err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	conn, err := grpc.Dial(socket, grpc.WithInsecure(), grpc.WithContextDialer(func(ctx context.Context, target string) (net.Conn, error) {
+		return (&net.Dialer{}).DialContext(ctx, "unix", target)
+	}))
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	return v1alpha1.NewCSIDriverProviderClient(conn), func() {
+		conn.Close()
+		server.Stop()
+		os.RemoveAll(dir)
+	}
+}
+
+func testMountRequest() *v1alpha1.MountRequest {
+	return &v1alpha1.MountRequest{
+		Attributes: `{"objects": "secret1"}`,
+		TargetPath: "/var/lib/kubelet/pods/d448c6a2-cda8-42e3-84fb-3cf75faa8399/volumes/kubernetes.io~csi/secrets-store-inline/mount",
+		Permission: "420",
+	}
+}
+
+func TestServerStart(t *testing.T) {
+	cases := []struct {
+		name        string
+		config      Config
+		expectedErr bool
+	}{
+		{
+			name:   "valid config",
+			config: Config{Name: "provider1", Version: "0.0.1", MinDriverVersion: "0.0.13"},
+		},
+		{
+			name:        "name not set",
+			config:      Config{Version: "0.0.1"},
+			expectedErr: true,
+		},
+		{
+			name:        "invalid version",
+			config:      Config{Name: "provider1", Version: "latest"},
+			expectedErr: true,
+		},
+		{
+			name:        "invalid min driver version",
+			config:      Config{Name: "provider1", Version: "0.0.1", MinDriverVersion: "latest"},
+			expectedErr: true,
+		},
+		{
+			name:        "invalid parameters schema",
+			config:      Config{Name: "provider1", Version: "0.0.1", ParametersSchema: "{"},
+			expectedErr: true,
+		},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "ut")
+			if err != nil {
+				t.Fatalf("expected err to be nil, got: %+v", err)
+			}
+			defer os.RemoveAll(dir)
+
+			// the socket of a previous run is removed
+			socket := filepath.Join(dir, "provider1.sock")
+			if err := ioutil.WriteFile(socket, nil, 0600); err != nil {
+				t.Fatalf("expected err to be nil, got: %+v", err)
+			}
+			server := NewServer(socket, test.config, &testProvider{})
+			err = server.Start()
+			if test.expectedErr {
+				if err == nil {
+					t.Fatalf("expected err to be not nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected err to be nil, got: %+v", err)
+			}
+			server.Stop()
+		})
+	}
+}
+
+func TestServerVersionHealthCapabilities(t *testing.T) {
+	provider := &testProvider{}
+	client, stop := startTestServer(t, Config{
+		Name:             "provider1",
+		Version:          "0.0.1",
+		MinDriverVersion: "0.0.13",
+		Capabilities:     []v1alpha1.Capability{v1alpha1.Capability_OBJECT_VERSIONING},
+		ParametersSchema: `{"properties": {"objects": {"type": "string"}}}`,
+	}, provider)
+	defer stop()
+
+	version, err := client.Version(context.TODO(), &v1alpha1.VersionRequest{})
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	if version.GetRuntimeName() != "provider1" || version.GetRuntimeVersion() != "0.0.1" || version.GetMinDriverVersion() != "0.0.13" {
+		t.Errorf("expected version provider1 0.0.1 with min driver version 0.0.13, got: %+v", version)
+	}
+
+	capabilities, err := client.Capabilities(context.TODO(), &v1alpha1.CapabilitiesRequest{})
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	if !reflect.DeepEqual(capabilities.GetCapabilities(), []v1alpha1.Capability{v1alpha1.Capability_OBJECT_VERSIONING}) {
+		t.Errorf("expected capabilities: [OBJECT_VERSIONING], got: %v", capabilities.GetCapabilities())
+	}
+	if capabilities.GetParametersSchema() != `{"properties": {"objects": {"type": "string"}}}` {
+		t.Errorf("expected parameters schema to be advertised, got: %q", capabilities.GetParametersSchema())
+	}
+
+	health, err := client.Health(context.TODO(), &v1alpha1.HealthRequest{})
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	if !health.GetHealthy() {
+		t.Errorf("expected provider to be healthy, got: %+v", health)
+	}
+	provider.healthErr = errors.New("secrets store not reachable")
+	if health, err = client.Health(context.TODO(), &v1alpha1.HealthRequest{}); err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	if health.GetHealthy() || health.GetMessage() != "secrets store not reachable" {
+		t.Errorf("expected provider to be unhealthy, got: %+v", health)
+	}
+}
+
+func TestServerMount(t *testing.T) {
+	cases := []struct {
+		name          string
+		provider      *testProvider
+		req           *v1alpha1.MountRequest
+		expectedFiles map[string]string
+		expectedError *v1alpha1.Error
+		expectedCode  codes.Code
+	}{
+		{
+			name:          "files mounted",
+			provider:      &testProvider{files: map[string]string{"secret1": "value1", "secret2": "value2"}},
+			req:           testMountRequest(),
+			expectedFiles: map[string]string{"secret1": "value1", "secret2": "value2"},
+		},
+		{
+			name:          "provider error with reason",
+			provider:      &testProvider{err: NewError(v1alpha1.ErrorReason_OBJECT_NOT_FOUND, "", "secret1 not found")},
+			req:           testMountRequest(),
+			expectedError: &v1alpha1.Error{Reason: v1alpha1.ErrorReason_OBJECT_NOT_FOUND, Code: "OBJECT_NOT_FOUND", Message: "secret1 not found"},
+		},
+		{
+			name:         "provider error",
+			provider:     &testProvider{err: status.Error(codes.Unavailable, "secrets store not reachable")},
+			req:          testMountRequest(),
+			expectedCode: codes.Unavailable,
+		},
+		{
+			name:         "invalid file path",
+			provider:     &testProvider{files: map[string]string{"../secret1": "value1"}},
+			req:          testMountRequest(),
+			expectedCode: codes.Unknown,
+		},
+		{
+			name:         "invalid mount request",
+			provider:     &testProvider{},
+			req:          &v1alpha1.MountRequest{Attributes: "{}"},
+			expectedCode: codes.InvalidArgument,
+		},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			client, stop := startTestServer(t, Config{Name: "provider1", Version: "0.0.1", ChunkSize: 4}, test.provider)
+			defer stop()
+
+			resp, err := client.Mount(context.TODO(), test.req)
+			if status.Code(err) != test.expectedCode {
+				t.Fatalf("expected err code: %v, got: %+v", test.expectedCode, err)
+			}
+			if err != nil {
+				return
+			}
+			if !reflect.DeepEqual(resp.GetError(), test.expectedError) {
+				t.Errorf("expected error: %v, got: %v", test.expectedError, resp.GetError())
+			}
+			files := make(map[string]string)
+			for _, file := range resp.GetFiles() {
+				if file.GetMode() != 0644 {
+					t.Errorf("expected file mode: 0644, got: %o", file.GetMode())
+				}
+				files[file.GetPath()] = string(file.GetContents())
+			}
+			if len(files) > 0 || len(test.expectedFiles) > 0 {
+				if !reflect.DeepEqual(files, test.expectedFiles) {
+					t.Errorf("expected files: %v, got: %v", test.expectedFiles, files)
+				}
+			}
+
+			// the streamed files are the same as the files of the mount response
+			stream, err := client.MountStream(context.TODO(), test.req)
+			if err != nil {
+				t.Fatalf("expected err to be nil, got: %+v", err)
+			}
+			streamedFiles := make(map[string]string)
+			for {
+				resp, err := stream.Recv()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatalf("expected err to be nil, got: %+v", err)
+				}
+				if !reflect.DeepEqual(resp.GetError(), test.expectedError) {
+					t.Errorf("expected error: %v, got: %v", test.expectedError, resp.GetError())
+				}
+				for _, chunk := range resp.GetChunks() {
+					if len(chunk.GetContents()) > 4 {
+						t.Errorf("expected chunk of at most 4 bytes, got: %d", len(chunk.GetContents()))
+					}
+					if chunk.GetOffset() != int64(len(streamedFiles[chunk.GetPath()])) {
+						t.Errorf("expected chunk offset: %d, got: %d", len(streamedFiles[chunk.GetPath()]), chunk.GetOffset())
+					}
+					streamedFiles[chunk.GetPath()] += string(chunk.GetContents())
+				}
+			}
+			if !reflect.DeepEqual(streamedFiles, files) {
+				t.Errorf("expected streamed files: %v, got: %v", files, streamedFiles)
+			}
+		})
+	}
+}
+
+func TestErrorString(t *testing.T) {
+	err := fmt.Errorf("mount failed: %w", NewError(v1alpha1.ErrorReason_AUTH_FAILURE, "AccessDenied", "role is not authorized"))
+	if err.Error() != "mount failed: AUTH_FAILURE (code: AccessDenied): role is not authorized" {
+		t.Errorf("unexpected error string: %s", err.Error())
+	}
+	var providerErr *Error
+	if !errors.As(err, &providerErr) {
+		t.Errorf("expected wrapped error to be a provider error")
+	}
+}
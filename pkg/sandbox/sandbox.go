@@ -0,0 +1,149 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package sandbox runs provider binaries with resource limits, a minimal
+// environment and an optional seccomp filter.
+package sandbox
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"time"
+)
+
+const (
+	// execCommand is the argument the driver is re-executed with to apply the
+	// sandbox to the current process before executing the provider binary
+	execCommand = "__sandbox-exec"
+)
+
+// Config is the sandbox configuration for provider binaries
+type Config struct {
+	// Timeout is the maximum duration of a provider binary invocation. A zero
+	// timeout only uses the deadline of the request.
+	Timeout time.Duration
+	// MemoryLimit is the maximum size of the provider process virtual memory
+	// in bytes (RLIMIT_AS). Zero means no limit.
+	MemoryLimit uint64
+	// CPULimit is the maximum CPU time of the provider process in seconds
+	// (RLIMIT_CPU). Zero means no limit.
+	CPULimit uint64
+	// MinimalEnv runs the provider with only the PATH (and on windows
+	// SystemRoot) environment variables of the driver instead of the full
+	// driver environment.
+	MinimalEnv bool
+	// SeccompProfile is the path to a seccomp BPF filter in the raw format
+	// exported by libseccomp (seccomp_export_bpf). The filter is loaded before
+	// the provider binary is executed.
+	SeccompProfile string
+}
+
+// needsExec returns true if the sandbox must be applied by re-executing the
+// driver before executing the provider binary
+func (c Config) needsExec() bool {
+	return c.MemoryLimit > 0 || c.CPULimit > 0 || len(c.SeccompProfile) > 0
+}
+
+// Validate returns an error if the configuration is not supported on the
+// current platform or the seccomp profile can't be read.
+func (c Config) Validate() error {
+	if c.needsExec() && runtime.GOOS != "linux" {
+		return fmt.Errorf("provider resource limits and seccomp profile are only supported on linux")
+	}
+	if len(c.SeccompProfile) > 0 {
+		if _, err := loadSeccompFilter(c.SeccompProfile); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Command returns the exec.Cmd to run the provider binary name with args in
+// the sandbox. The process is killed if the context is done before it exits.
+func Command(ctx context.Context, c Config, name string, args ...string) *exec.Cmd {
+	var cmd *exec.Cmd
+	if c.needsExec() {
+		sandboxArgs := []string{
+			execCommand,
+			"--memory-limit", strconv.FormatUint(c.MemoryLimit, 10),
+			"--cpu-limit", strconv.FormatUint(c.CPULimit, 10),
+			"--seccomp-profile", c.SeccompProfile,
+			"--",
+			name,
+		}
+		cmd = exec.CommandContext(ctx, "/proc/self/exe", append(sandboxArgs, args...)...)
+	} else {
+		cmd = exec.CommandContext(ctx, name, args...)
+	}
+	if c.MinimalEnv {
+		cmd.Env = minimalEnv()
+	}
+	return cmd
+}
+
+// minimalEnv returns the environment variables required to run a binary
+func minimalEnv() []string {
+	keys := []string{"PATH"}
+	if runtime.GOOS == "windows" {
+		keys = append(keys, "SystemRoot")
+	}
+	var env []string
+	for _, key := range keys {
+		if value, ok := os.LookupEnv(key); ok {
+			env = append(env, key+"="+value)
+		}
+	}
+	return env
+}
+
+// Init applies the sandbox and executes the provider binary if the process was
+// started by Command. Init must be called at the start of main before any other
+// initialization and only returns if the process was not started by Command.
+func Init() {
+	if len(os.Args) < 2 || os.Args[1] != execCommand {
+		return
+	}
+	if err := sandboxExec(os.Args[2:]); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to run provider in sandbox, err: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// sandboxExec parses the sandbox arguments, applies the sandbox to the current
+// process and replaces it with the provider binary.
+func sandboxExec(args []string) error {
+	var c Config
+	fs := flag.NewFlagSet(execCommand, flag.ContinueOnError)
+	fs.Uint64Var(&c.MemoryLimit, "memory-limit", 0, "")
+	fs.Uint64Var(&c.CPULimit, "cpu-limit", 0, "")
+	fs.StringVar(&c.SeccompProfile, "seccomp-profile", "", "")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return fmt.Errorf("provider binary not set")
+	}
+	binary, err := exec.LookPath(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	return execSandboxed(c, binary, fs.Args(), os.Environ())
+}
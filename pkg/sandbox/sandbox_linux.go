@@ -0,0 +1,91 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sandbox
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"runtime"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// sockFilterSize is the size of a single BPF instruction (struct sock_filter)
+const sockFilterSize = 8
+
+// execSandboxed applies the resource limits and the seccomp filter to the
+// current process and replaces it with the binary.
+func execSandboxed(c Config, binary string, argv, env []string) error {
+	if c.MemoryLimit > 0 {
+		if err := syscall.Setrlimit(syscall.RLIMIT_AS, &syscall.Rlimit{Cur: c.MemoryLimit, Max: c.MemoryLimit}); err != nil {
+			return fmt.Errorf("failed to set memory limit, err: %v", err)
+		}
+	}
+	if c.CPULimit > 0 {
+		if err := syscall.Setrlimit(unix.RLIMIT_CPU, &syscall.Rlimit{Cur: c.CPULimit, Max: c.CPULimit}); err != nil {
+			return fmt.Errorf("failed to set cpu limit, err: %v", err)
+		}
+	}
+
+	// the seccomp filter is only applied to the calling thread, so the filter
+	// must be loaded on the same thread that executes the binary
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	if len(c.SeccompProfile) > 0 {
+		filter, err := loadSeccompFilter(c.SeccompProfile)
+		if err != nil {
+			return err
+		}
+		if err := unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0); err != nil {
+			return fmt.Errorf("failed to set no new privileges, err: %v", err)
+		}
+		prog := unix.SockFprog{
+			Len:    uint16(len(filter)),
+			Filter: &filter[0],
+		}
+		if err := unix.Prctl(unix.PR_SET_SECCOMP, unix.SECCOMP_MODE_FILTER, uintptr(unsafe.Pointer(&prog)), 0, 0); err != nil {
+			return fmt.Errorf("failed to load seccomp filter %s, err: %v", c.SeccompProfile, err)
+		}
+	}
+	return syscall.Exec(binary, argv, env)
+}
+
+// loadSeccompFilter reads the BPF filter in the raw format exported by libseccomp
+func loadSeccompFilter(path string) ([]unix.SockFilter, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read seccomp profile %s, err: %v", path, err)
+	}
+	if len(data) == 0 || len(data)%sockFilterSize != 0 || len(data)/sockFilterSize > unix.BPF_MAXINSNS {
+		return nil, fmt.Errorf("invalid seccomp profile %s, expected a BPF filter of at most %d instructions", path, unix.BPF_MAXINSNS)
+	}
+	filter := make([]unix.SockFilter, len(data)/sockFilterSize)
+	for i := range filter {
+		instruction := data[i*sockFilterSize : (i+1)*sockFilterSize]
+		filter[i] = unix.SockFilter{
+			Code: binary.LittleEndian.Uint16(instruction[0:2]),
+			Jt:   instruction[2],
+			Jf:   instruction[3],
+			K:    binary.LittleEndian.Uint32(instruction[4:8]),
+		}
+	}
+	return filter, nil
+}
@@ -0,0 +1,204 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sandbox
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestMain(m *testing.M) {
+	// the test binary is re-executed by Command to apply the sandbox
+	Init()
+	os.Exit(m.Run())
+}
+
+func runSandboxed(t *testing.T, c Config, script string) (string, error) {
+	cmd := Command(context.TODO(), c, "/bin/sh", "-c", script)
+	stdout := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+	cmd.Stdout, cmd.Stderr = stdout, stderr
+	err := cmd.Run()
+	if err != nil {
+		t.Logf("stderr: %s", stderr.String())
+	}
+	return strings.TrimSpace(stdout.String()), err
+}
+
+func TestCommandLimits(t *testing.T) {
+	cases := []struct {
+		name           string
+		config         Config
+		script         string
+		expectedOutput string
+	}{
+		{
+			name:           "memory limit",
+			config:         Config{MemoryLimit: 1 << 30},
+			script:         "ulimit -v",
+			expectedOutput: "1048576",
+		},
+		{
+			name:           "cpu limit",
+			config:         Config{CPULimit: 30},
+			script:         "ulimit -t",
+			expectedOutput: "30",
+		},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			output, err := runSandboxed(t, test.config, test.script)
+			if err != nil {
+				t.Fatalf("expected err to be nil, got: %+v", err)
+			}
+			if output != test.expectedOutput {
+				t.Errorf("expected output: %s, got: %s", test.expectedOutput, output)
+			}
+		})
+	}
+}
+
+func TestCommandMinimalEnv(t *testing.T) {
+	os.Setenv("SANDBOX_TEST_SECRET", "secret")
+	defer os.Unsetenv("SANDBOX_TEST_SECRET")
+
+	output, err := runSandboxed(t, Config{}, "echo $SANDBOX_TEST_SECRET")
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	if output != "secret" {
+		t.Errorf("expected the driver environment to be inherited, got: %s", output)
+	}
+
+	output, err = runSandboxed(t, Config{MinimalEnv: true}, "echo $SANDBOX_TEST_SECRET")
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	if output != "" {
+		t.Errorf("expected the driver environment to not be inherited, got: %s", output)
+	}
+}
+
+func TestCommandTimeout(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.TODO(), 100*time.Millisecond)
+	defer cancel()
+
+	cmd := Command(ctx, Config{MemoryLimit: 1 << 30}, "/bin/sleep", "10")
+	start := time.Now()
+	if err := cmd.Run(); err == nil {
+		t.Fatalf("expected err to be not nil")
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Errorf("expected the provider process to be killed when the context is done")
+	}
+}
+
+func TestCommandSeccompProfile(t *testing.T) {
+	if runtime.GOARCH != "amd64" {
+		t.Skip("seccomp filter in test is only valid for amd64")
+	}
+	dir, err := ioutil.TempDir("", "ut")
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// deny mkdir and mkdirat with EPERM and allow all other syscalls
+	filter := []unix.SockFilter{
+		{Code: unix.BPF_LD | unix.BPF_W | unix.BPF_ABS, K: 0},
+		{Code: unix.BPF_JMP | unix.BPF_JEQ | unix.BPF_K, Jt: 1, K: unix.SYS_MKDIR},
+		{Code: unix.BPF_JMP | unix.BPF_JEQ | unix.BPF_K, Jf: 1, K: unix.SYS_MKDIRAT},
+		{Code: unix.BPF_RET | unix.BPF_K, K: 0x00050000 | uint32(unix.EPERM)},
+		{Code: unix.BPF_RET | unix.BPF_K, K: 0x7fff0000},
+	}
+	profile := &bytes.Buffer{}
+	for _, instruction := range filter {
+		binary.Write(profile, binary.LittleEndian, instruction)
+	}
+	profilePath := filepath.Join(dir, "profile.bpf")
+	if err := ioutil.WriteFile(profilePath, profile.Bytes(), 0644); err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+
+	c := Config{SeccompProfile: profilePath}
+	if err := c.Validate(); err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	if _, err := runSandboxed(t, c, "mkdir "+filepath.Join(dir, "denied")); err == nil {
+		t.Errorf("expected mkdir to be denied by the seccomp filter")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "denied")); !os.IsNotExist(err) {
+		t.Errorf("expected directory to not be created, got: %+v", err)
+	}
+	if _, err := runSandboxed(t, c, "echo allowed"); err != nil {
+		t.Errorf("expected err to be nil, got: %+v", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ut")
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	invalidProfile := filepath.Join(dir, "invalid.bpf")
+	if err := ioutil.WriteFile(invalidProfile, []byte("invalid"), 0644); err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+
+	cases := []struct {
+		name        string
+		config      Config
+		expectedErr bool
+	}{
+		{
+			name:   "empty config",
+			config: Config{},
+		},
+		{
+			name:        "seccomp profile not found",
+			config:      Config{SeccompProfile: filepath.Join(dir, "notfound.bpf")},
+			expectedErr: true,
+		},
+		{
+			name:        "invalid seccomp profile",
+			config:      Config{SeccompProfile: invalidProfile},
+			expectedErr: true,
+		},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.config.Validate()
+			if test.expectedErr && err == nil || !test.expectedErr && err != nil {
+				t.Fatalf("expected err: %v, got: %+v", test.expectedErr, err)
+			}
+		})
+	}
+}
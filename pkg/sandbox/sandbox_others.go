@@ -0,0 +1,34 @@
+//go:build !linux
+// +build !linux
+
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sandbox
+
+import (
+	"fmt"
+)
+
+// execSandboxed is only supported on linux
+func execSandboxed(c Config, binary string, argv, env []string) error {
+	return fmt.Errorf("provider sandbox is only supported on linux")
+}
+
+// loadSeccompFilter is only supported on linux
+func loadSeccompFilter(path string) ([]struct{}, error) {
+	return nil, fmt.Errorf("seccomp profile is only supported on linux")
+}
@@ -0,0 +1,119 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package secretsstore
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"sigs.k8s.io/secrets-store-csi-driver/apis/v1alpha1"
+)
+
+const (
+	// auditEventMount is recorded for the objects mounted in a new volume
+	auditEventMount = "Mount"
+	// auditEventRotation is recorded for the objects rotated in a mounted volume
+	auditEventRotation = "Rotation"
+	// auditEventSecretsRefresh is recorded for the objects refreshed in the
+	// synced secrets of a volume that is no longer mounted
+	auditEventSecretsRefresh = "SecretsRefresh"
+)
+
+// AuditLog is an append-only log of the object versions delivered to the pod
+// volumes. Every mount and rotation that changes the object versions of a
+// volume is recorded as a JSON line, so it can be proven when the credentials
+// were delivered to a pod.
+type AuditLog struct {
+	lock sync.Mutex
+	file *os.File
+}
+
+// auditRecord is a line of the audit log
+type auditRecord struct {
+	Time                string                               `json:"time"`
+	Event               string                               `json:"event"`
+	Node                string                               `json:"node"`
+	PodNamespace        string                               `json:"podNamespace"`
+	PodName             string                               `json:"podName"`
+	PodUID              string                               `json:"podUID"`
+	SecretProviderClass string                               `json:"secretProviderClass"`
+	Provider            string                               `json:"provider"`
+	TargetPath          string                               `json:"targetPath"`
+	Objects             []v1alpha1.SecretProviderClassObject `json:"objects"`
+}
+
+// NewAuditLog opens the audit log at the path, new records are appended to
+// the existing records
+func NewAuditLog(path string) (*AuditLog, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create audit log directory, err: %+v", err)
+	}
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log %s, err: %+v", path, err)
+	}
+	return &AuditLog{file: file}, nil
+}
+
+// Close closes the audit log
+func (a *AuditLog) Close() error {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	return a.file.Close()
+}
+
+// record appends the record to the audit log. Failing to write the record is
+// logged and doesn't fail the mount or rotation, the objects are delivered
+// already. The record is dropped if the audit log isn't enabled.
+func (a *AuditLog) record(record auditRecord) {
+	if a == nil {
+		return
+	}
+	record.Time = time.Now().UTC().Format(time.RFC3339Nano)
+	line, err := json.Marshal(record)
+	if err != nil {
+		log.Errorf("failed to marshal audit record for pod %s/%s, err: %+v", record.PodNamespace, record.PodName, err)
+		return
+	}
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if _, err := a.file.Write(append(line, '\n')); err != nil {
+		log.Errorf("failed to write audit record for pod %s/%s, err: %+v", record.PodNamespace, record.PodName, err)
+	}
+}
+
+// recordAudit appends the object versions delivered to the pod volume to the
+// audit log of the node server
+func (ns *nodeServer) recordAudit(event, podName, podNamespace, podUID, secretProviderClass, providerName, targetPath string, objectVersions map[string]string) {
+	ns.auditLog.record(auditRecord{
+		Event:               event,
+		Node:                ns.nodeID,
+		PodNamespace:        podNamespace,
+		PodName:             podName,
+		PodUID:              podUID,
+		SecretProviderClass: secretProviderClass,
+		Provider:            providerName,
+		TargetPath:          targetPath,
+		Objects:             secretProviderClassObjects(objectVersions),
+	})
+}
@@ -0,0 +1,106 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package secretsstore
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// readAuditRecords returns the records in the audit log
+func readAuditRecords(t *testing.T, path string) []auditRecord {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	var records []auditRecord
+	for _, line := range strings.Split(strings.TrimSpace(string(contents)), "\n") {
+		if len(line) == 0 {
+			continue
+		}
+		var record auditRecord
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("expected err to be nil, got: %+v", err)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestAuditLog(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ut")
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "audit", "audit.log")
+
+	// the records are dropped if the audit log isn't enabled
+	ns := &nodeServer{nodeID: "testnode"}
+	ns.recordAudit(auditEventMount, "pod1", "default", "poduid1", "spc1", "provider1", "/target", map[string]string{"secret/secret1": "v1"})
+
+	ns.auditLog, err = NewAuditLog(path)
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	ns.recordAudit(auditEventMount, "pod1", "default", "poduid1", "spc1", "provider1", "/target", map[string]string{"secret/secret1": "v1"})
+	if err := ns.auditLog.Close(); err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+
+	// new records are appended to the existing records
+	ns.auditLog, err = NewAuditLog(path)
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	defer ns.auditLog.Close()
+	ns.recordAudit(auditEventRotation, "pod1", "default", "poduid1", "spc1", "provider1", "/target", map[string]string{"secret/secret1": "v2"})
+
+	records := readAuditRecords(t, path)
+	if len(records) != 2 {
+		t.Fatalf("expected 2 audit records, got: %+v", records)
+	}
+	for i, expected := range []struct {
+		event   string
+		version string
+	}{{auditEventMount, "v1"}, {auditEventRotation, "v2"}} {
+		record := records[i]
+		if len(record.Time) == 0 {
+			t.Errorf("expected time to be recorded, got: %+v", record)
+		}
+		record.Time = ""
+		expectedRecord := auditRecord{
+			Event:               expected.event,
+			Node:                "testnode",
+			PodNamespace:        "default",
+			PodName:             "pod1",
+			PodUID:              "poduid1",
+			SecretProviderClass: "spc1",
+			Provider:            "provider1",
+			TargetPath:          "/target",
+			Objects:             secretProviderClassObjects(map[string]string{"secret/secret1": expected.version}),
+		}
+		if !reflect.DeepEqual(record, expectedRecord) {
+			t.Errorf("expected audit record: %+v, got: %+v", expectedRecord, record)
+		}
+	}
+}
@@ -46,13 +46,21 @@ func (cs *controllerServer) CreateVolume(ctx context.Context, req *csi.CreateVol
 		return nil, status.Error(codes.InvalidArgument, "volume_capabilities is empty")
 	}
 	capacityBytes := req.GetCapacityRange().GetRequiredBytes()
-	volumeContext := req.GetParameters()
 	volName := req.GetName()
 
-	if volumeContext == nil {
-		volumeContext = make(map[string]string)
+	// the parameters of the storage class are the volume attributes of the
+	// provisioned volume, e.g. the secret provider class mounted by the pods
+	volumeContext := make(map[string]string, len(req.GetParameters()))
+	for k, v := range req.GetParameters() {
+		volumeContext[k] = v
+	}
+	// the volumes without parameters are mounted with the mock provider, they
+	// are only created by the sanity tests
+	if len(volumeContext) == 0 {
+		volumeContext["providerName"] = "mock_provider"
+	} else if err := validateProvisionedVolume(volumeContext, req.GetVolumeCapabilities()); err != nil {
+		return nil, err
 	}
-	volumeContext["providerName"] = "mock_provider"
 
 	// check if volume with same name exists
 	existingVol, exists := cs.findVolumeByName(volName)
@@ -136,6 +144,37 @@ func (cs *controllerServer) findVolumeInternal(key, nameOrID string) (csi.Volume
 	return csi.Volume{}, false
 }
 
+// validateProvisionedVolume validates the parameters and capabilities of a
+// volume provisioned for a persistent volume claim, e.g. the claim of a generic
+// ephemeral volume. The volume must reference a secret provider class and only
+// be read by the pods, like the inline volumes.
+func validateProvisionedVolume(parameters map[string]string, capabilities []*csi.VolumeCapability) error {
+	secretProviderClass := parameters[secretProviderClassField]
+	clusterSecretProviderClass := parameters[clusterSecretProviderClassField]
+	if len(secretProviderClass) > 0 && len(clusterSecretProviderClass) > 0 {
+		return status.Error(codes.InvalidArgument, "secretProviderClass and clusterSecretProviderClass are mutually exclusive")
+	}
+	if len(secretProviderClass) == 0 && len(clusterSecretProviderClass) == 0 {
+		return status.Error(codes.InvalidArgument, "secretProviderClass or clusterSecretProviderClass parameter missing in request")
+	}
+	for _, capability := range capabilities {
+		if capability.GetBlock() != nil {
+			return status.Error(codes.InvalidArgument, "block volumes are not supported")
+		}
+		if !readerOnlyAccessMode(capability.GetAccessMode()) {
+			return status.Errorf(codes.InvalidArgument, "access mode %v is not supported, the volumes are read only", capability.GetAccessMode().GetMode())
+		}
+	}
+	return nil
+}
+
+// readerOnlyAccessMode returns true if the access mode only allows reading the
+// volume, e.g. the ReadOnlyMany access mode of a persistent volume claim
+func readerOnlyAccessMode(accessMode *csi.VolumeCapability_AccessMode) bool {
+	mode := accessMode.GetMode()
+	return mode == csi.VolumeCapability_AccessMode_SINGLE_NODE_READER_ONLY || mode == csi.VolumeCapability_AccessMode_MULTI_NODE_READER_ONLY
+}
+
 func isMockProvider(provider string) bool {
 	return strings.EqualFold(provider, "mock_provider")
 }
@@ -0,0 +1,112 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package secretsstore
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestCreateVolume(t *testing.T) {
+	mountCapability := func(mode csi.VolumeCapability_AccessMode_Mode) *csi.VolumeCapability {
+		return &csi.VolumeCapability{
+			AccessType: &csi.VolumeCapability_Mount{Mount: &csi.VolumeCapability_MountVolume{}},
+			AccessMode: &csi.VolumeCapability_AccessMode{Mode: mode},
+		}
+	}
+
+	cases := []struct {
+		name                  string
+		parameters            map[string]string
+		capability            *csi.VolumeCapability
+		expectedCode          codes.Code
+		expectedVolumeContext map[string]string
+	}{
+		{
+			name:                  "mock provider volume",
+			capability:            mountCapability(csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER),
+			expectedVolumeContext: map[string]string{"providerName": "mock_provider"},
+		},
+		{
+			name:                  "provisioned volume",
+			parameters:            map[string]string{"secretProviderClass": "spc1"},
+			capability:            mountCapability(csi.VolumeCapability_AccessMode_MULTI_NODE_READER_ONLY),
+			expectedVolumeContext: map[string]string{"secretProviderClass": "spc1"},
+		},
+		{
+			name:                  "provisioned volume of a cluster secret provider class",
+			parameters:            map[string]string{"clusterSecretProviderClass": "cspc1"},
+			capability:            mountCapability(csi.VolumeCapability_AccessMode_SINGLE_NODE_READER_ONLY),
+			expectedVolumeContext: map[string]string{"clusterSecretProviderClass": "cspc1"},
+		},
+		{
+			name:         "secret provider class missing",
+			parameters:   map[string]string{"csi.storage.k8s.io/pvc/name": "pvc1"},
+			capability:   mountCapability(csi.VolumeCapability_AccessMode_MULTI_NODE_READER_ONLY),
+			expectedCode: codes.InvalidArgument,
+		},
+		{
+			name:         "both secret provider classes",
+			parameters:   map[string]string{"secretProviderClass": "spc1", "clusterSecretProviderClass": "cspc1"},
+			capability:   mountCapability(csi.VolumeCapability_AccessMode_MULTI_NODE_READER_ONLY),
+			expectedCode: codes.InvalidArgument,
+		},
+		{
+			name:         "writer access mode",
+			parameters:   map[string]string{"secretProviderClass": "spc1"},
+			capability:   mountCapability(csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER),
+			expectedCode: codes.InvalidArgument,
+		},
+		{
+			name:       "block volume",
+			parameters: map[string]string{"secretProviderClass": "spc1"},
+			capability: &csi.VolumeCapability{
+				AccessType: &csi.VolumeCapability_Block{Block: &csi.VolumeCapability_BlockVolume{}},
+				AccessMode: &csi.VolumeCapability_AccessMode{Mode: csi.VolumeCapability_AccessMode_MULTI_NODE_READER_ONLY},
+			},
+			expectedCode: codes.InvalidArgument,
+		},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			driver := NewFakeDriver()
+			driver.AddControllerServiceCapabilities([]csi.ControllerServiceCapability_RPC_Type{csi.ControllerServiceCapability_RPC_CREATE_DELETE_VOLUME})
+			cs := newControllerServer(driver)
+
+			resp, err := cs.CreateVolume(context.TODO(), &csi.CreateVolumeRequest{
+				Name:               "pvc-1",
+				Parameters:         test.parameters,
+				VolumeCapabilities: []*csi.VolumeCapability{test.capability},
+			})
+			if code := status.Code(err); code != test.expectedCode {
+				t.Fatalf("expected error code %v, got: %+v", test.expectedCode, err)
+			}
+			if err != nil {
+				return
+			}
+			if !reflect.DeepEqual(resp.GetVolume().GetVolumeContext(), test.expectedVolumeContext) {
+				t.Errorf("expected volume context: %v, got: %v", test.expectedVolumeContext, resp.GetVolume().GetVolumeContext())
+			}
+		})
+	}
+}
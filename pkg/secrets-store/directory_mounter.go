@@ -0,0 +1,73 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package secretsstore
+
+import (
+	"io"
+	"os"
+
+	"k8s.io/utils/mount"
+)
+
+// directoryMounter mounts the volumes as directories of the kubelet directory
+// on the nodes without tmpfs. A directory with contents is a mount point, so
+// the mounted volumes are rotated and aren't mounted again when the kubelet
+// retries NodePublishVolume, and unmounting a directory removes its contents.
+type directoryMounter struct {
+	mount.Interface
+}
+
+// Mount creates the target directory of the tmpfs mounts
+func (m *directoryMounter) Mount(source, target, fstype string, options []string) error {
+	if fstype != "tmpfs" {
+		return m.Interface.Mount(source, target, fstype, options)
+	}
+	return os.MkdirAll(target, 0755)
+}
+
+// IsLikelyNotMountPoint returns false if the directory has contents
+func (m *directoryMounter) IsLikelyNotMountPoint(file string) (bool, error) {
+	stat, err := os.Lstat(file)
+	if err != nil {
+		return true, err
+	}
+	if !stat.IsDir() {
+		return m.Interface.IsLikelyNotMountPoint(file)
+	}
+	dir, err := os.Open(file)
+	if err != nil {
+		return true, err
+	}
+	defer dir.Close()
+	if _, err := dir.Readdirnames(1); err != nil {
+		if err == io.EOF {
+			return true, nil
+		}
+		return true, err
+	}
+	return false, nil
+}
+
+// Unmount removes the contents of the target directory. The directory is left
+// for the kubelet to remove.
+func (m *directoryMounter) Unmount(target string) error {
+	stat, err := os.Lstat(target)
+	if err != nil || !stat.IsDir() {
+		return m.Interface.Unmount(target)
+	}
+	return removeMountedFiles(target)
+}
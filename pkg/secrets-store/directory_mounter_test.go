@@ -0,0 +1,83 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package secretsstore
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"k8s.io/utils/mount"
+)
+
+func TestDirectoryMounter(t *testing.T) {
+	dir := getTestTargetPath(t)
+	defer os.RemoveAll(dir)
+	targetPath := filepath.Join(dir, "mount")
+	mounter := &directoryMounter{Interface: mount.NewFakeMounter([]mount.MountPoint{})}
+
+	if _, err := mounter.IsLikelyNotMountPoint(targetPath); !os.IsNotExist(err) {
+		t.Fatalf("expected not exist err, got: %+v", err)
+	}
+	if err := mounter.Mount("tmpfs", targetPath, "tmpfs", []string{}); err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	notMnt, err := mounter.IsLikelyNotMountPoint(targetPath)
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	if !notMnt {
+		t.Fatalf("expected empty target path to not be a mount point")
+	}
+
+	if err := os.MkdirAll(filepath.Join(targetPath, "certs"), 0755); err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(targetPath, "certs", "cert1"), []byte("cert"), 0444); err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	notMnt, err = mounter.IsLikelyNotMountPoint(targetPath)
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	if notMnt {
+		t.Fatalf("expected target path with contents to be a mount point")
+	}
+
+	if err := mounter.Unmount(targetPath); err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	files, err := ioutil.ReadDir(targetPath)
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	if len(files) != 0 {
+		t.Fatalf("expected unmount to remove the contents of the target path, got: %d files", len(files))
+	}
+
+	// the mounted files are removed with the target path
+	if err := ioutil.WriteFile(filepath.Join(targetPath, "secret1"), []byte("secret"), 0444); err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	if err := mount.CleanupMountPoint(targetPath, mounter, false); err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	if _, err := os.Stat(targetPath); !os.IsNotExist(err) {
+		t.Fatalf("expected target path to be removed, got: %+v", err)
+	}
+}
@@ -23,6 +23,8 @@ const (
 	FailedToEnsureMountPoint = "FailedToEnsureMountPoint"
 	// IncompatibleProviderVersion error
 	IncompatibleProviderVersion = "IncompatibleProviderVersion"
+	// IncompatibleDriverVersion error
+	IncompatibleDriverVersion = "IncompatibleDriverVersion"
 	// ProviderError error
 	ProviderError = "ProviderError"
 	// FailedToMount error
@@ -33,4 +35,78 @@ const (
 	FailedToCreateProviderGRPCClient = "FailedToCreateProviderGRPCClient"
 	// GRPCProviderError error
 	GRPCProviderError = "GRPCProviderError"
+	// ProviderTimeout error
+	ProviderTimeout = "ProviderTimeout"
+	// ProviderUnhealthy error
+	ProviderUnhealthy = "ProviderUnhealthy"
+	// InvalidProviderResponse error
+	InvalidProviderResponse = "InvalidProviderResponse"
+	// FilePathCollision error
+	FilePathCollision = "FilePathCollision"
+	// ProviderNotAllowed error
+	ProviderNotAllowed = "ProviderNotAllowed"
+	// ProviderAuthFailure error
+	ProviderAuthFailure = "ProviderAuthFailure"
+	// SecretObjectNotFound error
+	SecretObjectNotFound = "SecretObjectNotFound"
+	// ProviderThrottled error
+	ProviderThrottled = "ProviderThrottled"
+	// ProviderBackendTimeout error
+	ProviderBackendTimeout = "ProviderBackendTimeout"
+	// FailedToWriteFiles error
+	FailedToWriteFiles = "FailedToWriteFiles"
+	// FailedToRotate error
+	FailedToRotate = "FailedToRotate"
+	// FailedToSyncSecrets error
+	FailedToSyncSecrets = "FailedToSyncSecrets"
+	// FailedToRestart error
+	FailedToRestart = "FailedToRestart"
+	// InvalidRotationWindow error
+	InvalidRotationWindow = "InvalidRotationWindow"
+	// InvalidProviderParameters error
+	InvalidProviderParameters = "InvalidProviderParameters"
+	// NamespaceNotSelected error
+	NamespaceNotSelected = "NamespaceNotSelected"
+	// InvalidMountedObjects error
+	InvalidMountedObjects = "InvalidMountedObjects"
+	// PodNotAllowed error
+	PodNotAllowed = "PodNotAllowed"
+	// TargetPathNotTmpfs error
+	TargetPathNotTmpfs = "TargetPathNotTmpfs"
+	// InvalidOutputFiles error
+	InvalidOutputFiles = "InvalidOutputFiles"
+	// VolumeQuotaExceeded error
+	VolumeQuotaExceeded = "VolumeQuotaExceeded"
+	// MountFetchTimeout error
+	MountFetchTimeout = "MountFetchTimeout"
+	// MountWriteTimeout error
+	MountWriteTimeout = "MountWriteTimeout"
+	// SubPathMount warning
+	SubPathMount = "SubPathMount"
+	// CachedContentServed warning
+	CachedContentServed = "CachedContentServed"
+	// ServiceAccountTokensExpired error
+	ServiceAccountTokensExpired = "ServiceAccountTokensExpired"
 )
+
+// podEventReasons are the error reasons of a failed mount that are recorded as
+// warning events on the pod. These are the errors the user can fix in the pod,
+// the SecretProviderClass or the provider.
+var podEventReasons = map[string]bool{
+	IncompatibleProviderVersion: true,
+	IncompatibleDriverVersion:   true,
+	ProviderNotAllowed:          true,
+	ProviderAuthFailure:         true,
+	SecretObjectNotFound:        true,
+	ProviderThrottled:           true,
+	ProviderBackendTimeout:      true,
+	InvalidProviderParameters:   true,
+	NamespaceNotSelected:        true,
+	InvalidMountedObjects:       true,
+	PodNotAllowed:               true,
+	TargetPathNotTmpfs:          true,
+	InvalidOutputFiles:          true,
+	VolumeQuotaExceeded:         true,
+	MountFetchTimeout:           true,
+	MountWriteTimeout:           true,
+}
@@ -0,0 +1,53 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package secretsstore
+
+import (
+	"testing"
+)
+
+func TestPodEventReasons(t *testing.T) {
+	reasons := []string{
+		IncompatibleProviderVersion,
+		IncompatibleDriverVersion,
+		ProviderNotAllowed,
+		InvalidProviderParameters,
+		NamespaceNotSelected,
+		InvalidMountedObjects,
+		PodNotAllowed,
+		TargetPathNotTmpfs,
+		InvalidOutputFiles,
+		VolumeQuotaExceeded,
+		MountFetchTimeout,
+		MountWriteTimeout,
+	}
+	for _, reason := range providerErrorReasons {
+		reasons = append(reasons, reason)
+	}
+	for _, reason := range reasons {
+		if !podEventReasons[reason] {
+			t.Errorf("expected %s to be recorded as a pod event", reason)
+		}
+	}
+
+	// the errors of the driver and the node aren't recorded on the pod
+	for _, reason := range []string{ProviderBinaryNotFound, FailedToEnsureMountPoint, FailedToMount, GRPCProviderError, FailedToWriteFiles} {
+		if podEventReasons[reason] {
+			t.Errorf("expected %s not to be recorded as a pod event", reason)
+		}
+	}
+}
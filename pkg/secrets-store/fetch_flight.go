@@ -0,0 +1,90 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package secretsstore
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"sigs.k8s.io/secrets-store-csi-driver/provider/v1alpha1"
+)
+
+// fetchResult is the contents fetched from the providers for a volume
+type fetchResult struct {
+	objectVersions map[string]string
+	// expiry is the earliest expiry of the fetched objects
+	expiry time.Time
+	files  []*v1alpha1.File
+	// providerName is the provider that fetched the contents, the fallback
+	// provider if the primary provider failed
+	providerName string
+	errorReason  string
+	err          error
+}
+
+// fetchFlights shares the fetches of the volumes that mount the same contents,
+// e.g. the volumes of the replicas of a deployment scheduled on the node at the
+// same time. The volumes that are mounted while the contents are fetched for
+// another volume wait for its result instead of calling the providers again.
+type fetchFlights struct {
+	lock    sync.Mutex
+	flights map[string]*fetchFlight
+}
+
+// fetchFlight is a fetch in progress
+type fetchFlight struct {
+	// done is closed once the fetch completed
+	done   chan struct{}
+	result fetchResult
+}
+
+func newFetchFlights() *fetchFlights {
+	return &fetchFlights{
+		flights: make(map[string]*fetchFlight),
+	}
+}
+
+// do fetches the contents for the key or waits for the fetch in progress, and
+// returns its result. shared is true if the contents were fetched for another
+// volume. The fetch runs with the context of the volume that started it, the
+// other volumes stop waiting once their context is done.
+func (f *fetchFlights) do(ctx context.Context, key string, fetch func() fetchResult) (result fetchResult, shared bool, err error) {
+	f.lock.Lock()
+	flight, shared := f.flights[key]
+	if shared {
+		f.lock.Unlock()
+		select {
+		case <-flight.done:
+			return flight.result, true, nil
+		case <-ctx.Done():
+			return fetchResult{}, true, ctx.Err()
+		}
+	}
+	flight = &fetchFlight{done: make(chan struct{})}
+	f.flights[key] = flight
+	f.lock.Unlock()
+
+	defer func() {
+		f.lock.Lock()
+		delete(f.flights, key)
+		f.lock.Unlock()
+		close(flight.done)
+	}()
+	flight.result = fetch()
+	return flight.result, false, nil
+}
@@ -0,0 +1,91 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package secretsstore
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFetchFlights(t *testing.T) {
+	flights := newFetchFlights()
+
+	var lock sync.Mutex
+	var calls int
+	started := make(chan struct{}, 10)
+	release := make(chan struct{})
+	fetch := func() fetchResult {
+		lock.Lock()
+		calls++
+		lock.Unlock()
+		started <- struct{}{}
+		<-release
+		return fetchResult{objectVersions: map[string]string{"secret1": "v1"}, providerName: "provider1"}
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		result, shared, err := flights.do(context.TODO(), "key1", fetch)
+		if err != nil || shared || result.objectVersions["secret1"] != "v1" {
+			t.Errorf("expected the fetched contents, got: %+v, %v, %+v", result, shared, err)
+		}
+	}()
+	<-started
+
+	// the volumes mounted while the contents are fetched wait for the result
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result, shared, err := flights.do(context.TODO(), "key1", fetch)
+			if err != nil || !shared || result.objectVersions["secret1"] != "v1" || result.providerName != "provider1" {
+				t.Errorf("expected the shared contents, got: %+v, %v, %+v", result, shared, err)
+			}
+		}()
+	}
+	// the volume stops waiting once its context is done
+	ctx, cancel := context.WithTimeout(context.TODO(), 10*time.Millisecond)
+	defer cancel()
+	if _, shared, err := flights.do(ctx, "key1", fetch); err != context.DeadlineExceeded || !shared {
+		t.Fatalf("expected err: %v and shared: true, got: %+v, %v", context.DeadlineExceeded, err, shared)
+	}
+	// the fetches of other contents aren't shared
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if _, shared, _ := flights.do(context.TODO(), "key2", fetch); shared {
+			t.Errorf("expected the contents of key2 to be fetched")
+		}
+	}()
+	<-started
+	close(release)
+	wg.Wait()
+	lock.Lock()
+	if calls != 2 {
+		t.Errorf("expected 2 fetches, got: %d", calls)
+	}
+	lock.Unlock()
+
+	// the contents are fetched again once the fetch completed
+	if _, shared, _ := flights.do(context.TODO(), "key1", fetch); shared {
+		t.Errorf("expected a new fetch once the fetch completed")
+	}
+}
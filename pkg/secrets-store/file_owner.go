@@ -0,0 +1,61 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package secretsstore
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"sigs.k8s.io/secrets-store-csi-driver/apis/v1alpha1"
+)
+
+const (
+	// FSGroupPolicyNone doesn't change the group of the mounted files
+	FSGroupPolicyNone = "None"
+	// FSGroupPolicyFile makes the mounted files owned and readable by the
+	// fsGroup of the pod, like the File fsGroupPolicy of the CSIDriver
+	FSGroupPolicyFile = "File"
+)
+
+// ValidateFSGroupPolicy returns an error if the fsGroup policy isn't supported
+func ValidateFSGroupPolicy(policy string) error {
+	if policy != FSGroupPolicyNone && policy != FSGroupPolicyFile {
+		return fmt.Errorf("invalid fsGroup policy %q, must be %s or %s", policy, FSGroupPolicyNone, FSGroupPolicyFile)
+	}
+	return nil
+}
+
+// fileOwner returns the uid and gid that own the mounted files of the pod, -1
+// if the owner or the group isn't changed. The secret objects owner of the
+// class overrides the fsGroup of the pod, which is only used with the File
+// fsGroup policy, so the pod is only required with the File fsGroup policy.
+func (ns *nodeServer) fileOwner(spc *v1alpha1.SecretProviderClass, pod *corev1.Pod) (int, int) {
+	uid, gid := -1, -1
+	if ns.fsGroupPolicy == FSGroupPolicyFile && pod != nil && pod.Spec.SecurityContext != nil && pod.Spec.SecurityContext.FSGroup != nil {
+		gid = int(*pod.Spec.SecurityContext.FSGroup)
+	}
+	if owner := spc.Spec.SecretObjectsOwner; owner != nil {
+		if owner.UID != nil {
+			uid = int(*owner.UID)
+		}
+		if owner.GID != nil {
+			gid = int(*owner.GID)
+		}
+	}
+	return uid, gid
+}
@@ -0,0 +1,94 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package secretsstore
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"sigs.k8s.io/secrets-store-csi-driver/apis/v1alpha1"
+)
+
+func TestFileOwner(t *testing.T) {
+	fsGroup, uid, gid := int64(2000), int64(1000), int64(3000)
+	pod := &corev1.Pod{Spec: corev1.PodSpec{SecurityContext: &corev1.PodSecurityContext{FSGroup: &fsGroup}}}
+	cases := []struct {
+		name          string
+		fsGroupPolicy string
+		owner         *v1alpha1.FileOwner
+		pod           *corev1.Pod
+		expectedUID   int
+		expectedGID   int
+	}{
+		{
+			name:          "owner not changed",
+			fsGroupPolicy: FSGroupPolicyNone,
+			pod:           pod,
+			expectedUID:   -1,
+			expectedGID:   -1,
+		},
+		{
+			name:          "fsGroup of the pod",
+			fsGroupPolicy: FSGroupPolicyFile,
+			pod:           pod,
+			expectedUID:   -1,
+			expectedGID:   2000,
+		},
+		{
+			name:          "pod without fsGroup",
+			fsGroupPolicy: FSGroupPolicyFile,
+			pod:           &corev1.Pod{},
+			expectedUID:   -1,
+			expectedGID:   -1,
+		},
+		{
+			name:          "secret objects owner uid",
+			fsGroupPolicy: FSGroupPolicyFile,
+			owner:         &v1alpha1.FileOwner{UID: &uid},
+			pod:           pod,
+			expectedUID:   1000,
+			expectedGID:   2000,
+		},
+		{
+			name:          "secret objects owner overrides the fsGroup",
+			fsGroupPolicy: FSGroupPolicyFile,
+			owner:         &v1alpha1.FileOwner{UID: &uid, GID: &gid},
+			pod:           pod,
+			expectedUID:   1000,
+			expectedGID:   3000,
+		},
+	}
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			ns := &nodeServer{fsGroupPolicy: test.fsGroupPolicy}
+			spc := &v1alpha1.SecretProviderClass{Spec: v1alpha1.SecretProviderClassSpec{SecretObjectsOwner: test.owner}}
+			uid, gid := ns.fileOwner(spc, test.pod)
+			if uid != test.expectedUID || gid != test.expectedGID {
+				t.Fatalf("expected owner %d:%d, got: %d:%d", test.expectedUID, test.expectedGID, uid, gid)
+			}
+		})
+	}
+}
+
+func TestValidateFSGroupPolicy(t *testing.T) {
+	for policy, expectedErr := range map[string]bool{FSGroupPolicyNone: false, FSGroupPolicyFile: false, "": true, "ReadWriteOnceWithFSType": true} {
+		if err := ValidateFSGroupPolicy(policy); (err != nil) != expectedErr {
+			t.Errorf("expected err for policy %q: %v, got: %+v", policy, expectedErr, err)
+		}
+	}
+}
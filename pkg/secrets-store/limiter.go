@@ -0,0 +1,56 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package secretsstore
+
+import (
+	"context"
+)
+
+// providerCallLimiter bounds the number of concurrent provider calls on the
+// node, so a large number of pods started at the same time doesn't exceed the
+// rate limits of the secrets stores. A nil limiter doesn't limit the calls.
+type providerCallLimiter chan struct{}
+
+// newProviderCallLimiter returns a limiter for max concurrent provider calls.
+// The provider calls are not limited if max is 0.
+func newProviderCallLimiter(max int) providerCallLimiter {
+	if max <= 0 {
+		return nil
+	}
+	return make(providerCallLimiter, max)
+}
+
+// acquire blocks until the provider call can be started or the context is done
+func (l providerCallLimiter) acquire(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+	select {
+	case l <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// release completes a provider call started with acquire
+func (l providerCallLimiter) release() {
+	if l == nil {
+		return
+	}
+	<-l
+}
@@ -0,0 +1,68 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package secretsstore
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestProviderCallLimiter(t *testing.T) {
+	// a nil limiter doesn't limit the provider calls
+	unlimited := newProviderCallLimiter(0)
+	for i := 0; i < 10; i++ {
+		if err := unlimited.acquire(context.TODO()); err != nil {
+			t.Fatalf("expected err to be nil, got: %+v", err)
+		}
+	}
+	unlimited.release()
+
+	limiter := newProviderCallLimiter(2)
+	for i := 0; i < 2; i++ {
+		if err := limiter.acquire(context.TODO()); err != nil {
+			t.Fatalf("expected err to be nil, got: %+v", err)
+		}
+	}
+
+	// the third call waits until the context is done
+	ctx, cancel := context.WithTimeout(context.TODO(), 10*time.Millisecond)
+	defer cancel()
+	if err := limiter.acquire(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("expected err: %v, got: %+v", context.DeadlineExceeded, err)
+	}
+
+	// the third call starts once a call is completed
+	acquired := make(chan error)
+	go func() {
+		acquired <- limiter.acquire(context.TODO())
+	}()
+	select {
+	case err := <-acquired:
+		t.Fatalf("expected the call to wait, got: %+v", err)
+	case <-time.After(10 * time.Millisecond):
+	}
+	limiter.release()
+	select {
+	case err := <-acquired:
+		if err != nil {
+			t.Fatalf("expected err to be nil, got: %+v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("expected the call to start after a call is completed")
+	}
+}
@@ -0,0 +1,225 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package secretsstore
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"sigs.k8s.io/secrets-store-csi-driver/provider/v1alpha1"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+const (
+	// mountCacheMaxEntries is the maximum number of cached mount contents
+	mountCacheMaxEntries = 1000
+	// mountCacheMaxSize is the maximum total size in bytes of the cached files
+	mountCacheMaxSize = 64 << 20
+	// mountCacheSweepInterval is the interval the expired entries are removed at
+	mountCacheSweepInterval = time.Minute
+)
+
+// mountCacheEntry is the mounted contents of a volume
+type mountCacheEntry struct {
+	key            string
+	objectVersions map[string]string
+	files          []*v1alpha1.File
+	// objectsExpiry is the earliest expiry of the mounted objects
+	objectsExpiry time.Time
+	// mountTime is the time the contents were fetched from the providers
+	mountTime time.Time
+	expiry    time.Time
+	// staleExpiry is the expiry of the contents served when the providers
+	// are unavailable
+	staleExpiry time.Time
+	// size is the total size in bytes of the files
+	size int64
+}
+
+// mountCache caches the mounted contents of volumes for the TTL configured in
+// the SecretProviderClass so mount requests in a short window (e.g. pods of a
+// deployment scheduled at the same time) reuse the provider response. The
+// contents are kept for maxStaleAge to be served when the providers are
+// unavailable. The cache is bounded by maxEntries and maxSize, the least
+// recently used entries are evicted first.
+type mountCache struct {
+	lock    sync.Mutex
+	entries map[string]*list.Element
+	// lru is the list of entries ordered from the most to the least recently used
+	lru         *list.List
+	size        int64
+	maxEntries  int
+	maxSize     int64
+	maxStaleAge time.Duration
+	now         func() time.Time
+}
+
+func newMountCache(maxStaleAge time.Duration) *mountCache {
+	return &mountCache{
+		entries:     make(map[string]*list.Element),
+		lru:         list.New(),
+		maxEntries:  mountCacheMaxEntries,
+		maxSize:     mountCacheMaxSize,
+		maxStaleAge: maxStaleAge,
+		now:         time.Now,
+	}
+}
+
+// run removes the expired entries periodically until stopCh is closed
+func (c *mountCache) run(stopCh <-chan struct{}) {
+	wait.Until(c.sweep, mountCacheSweepInterval, stopCh)
+}
+
+// sweep removes the expired entries
+func (c *mountCache) sweep() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	now := c.now()
+	for _, element := range c.entries {
+		if element.Value.(*mountCacheEntry).expired(now) {
+			c.remove(element)
+		}
+	}
+}
+
+// remove removes the entry of the list element from the cache
+func (c *mountCache) remove(element *list.Element) {
+	entry := c.lru.Remove(element).(*mountCacheEntry)
+	delete(c.entries, entry.key)
+	c.size -= entry.size
+}
+
+// mountCacheKey returns the cache key for a mount request. The pod name, uid
+// and service account tokens are excluded so pods with the same namespace,
+// service account and parameters share the cache entry. The SecretProviderClass generation is
+// included so updating the SecretProviderClass invalidates the entries.
+func mountCacheKey(spcUID string, spcGeneration int64, parameters, secrets map[string]string) (string, error) {
+	cacheParameters := make(map[string]string, len(parameters))
+	for k, v := range parameters {
+		if k == csipodname || k == csipoduid || k == csipodsatokens {
+			continue
+		}
+		cacheParameters[k] = v
+	}
+	data, err := json.Marshal(struct {
+		UID        string            `json:"uid"`
+		Generation int64             `json:"generation"`
+		Parameters map[string]string `json:"parameters"`
+		Secrets    map[string]string `json:"secrets"`
+	}{spcUID, spcGeneration, cacheParameters, secrets})
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// get returns the cache entry for the key if it hasn't expired
+func (c *mountCache) get(key string) (*mountCacheEntry, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	element, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := element.Value.(*mountCacheEntry)
+	if !c.now().Before(entry.expiry) {
+		if entry.expired(c.now()) {
+			c.remove(element)
+		}
+		return nil, false
+	}
+	c.lru.MoveToFront(element)
+	return entry, true
+}
+
+// getStale returns the cache entry for the key to be served when the
+// providers are unavailable, if it is younger than the maximum stale age and
+// the mounted objects haven't expired
+func (c *mountCache) getStale(key string) (*mountCacheEntry, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	element, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := element.Value.(*mountCacheEntry)
+	if entry.expired(c.now()) {
+		c.remove(element)
+		return nil, false
+	}
+	c.lru.MoveToFront(element)
+	return entry, c.now().Before(entry.staleExpiry)
+}
+
+// set adds the mounted contents to the cache for ttl, and for the maximum
+// stale age to be served when the providers are unavailable, and removes the
+// expired entries. The contents aren't cached beyond the expiry of the mounted
+// objects. The least recently used entries are evicted to keep the cache
+// within its bounds, contents larger than the maximum size aren't cached.
+func (c *mountCache) set(key string, objectVersions map[string]string, files []*v1alpha1.File, ttl time.Duration, objectsExpiry time.Time) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	now := c.now()
+	if element, ok := c.entries[key]; ok {
+		c.remove(element)
+	}
+	for _, element := range c.entries {
+		if element.Value.(*mountCacheEntry).expired(now) {
+			c.remove(element)
+		}
+	}
+	var size int64
+	for _, file := range files {
+		size += int64(len(file.GetPath()) + len(file.GetContents()))
+	}
+	if size > c.maxSize {
+		return
+	}
+	for c.lru.Len() > 0 && (c.lru.Len() >= c.maxEntries || c.size+size > c.maxSize) {
+		c.remove(c.lru.Back())
+	}
+	entry := &mountCacheEntry{
+		key:            key,
+		objectVersions: objectVersions,
+		files:          files,
+		objectsExpiry:  objectsExpiry,
+		mountTime:      now,
+		expiry:         earliestExpiry(now.Add(ttl), objectsExpiry),
+		size:           size,
+	}
+	if c.maxStaleAge > 0 {
+		entry.staleExpiry = earliestExpiry(now.Add(c.maxStaleAge), objectsExpiry)
+	}
+	c.entries[key] = c.lru.PushFront(entry)
+	c.size += size
+}
+
+// expired returns true if the entry can neither be reused nor served when the
+// providers are unavailable
+func (e *mountCacheEntry) expired(now time.Time) bool {
+	return !now.Before(e.expiry) && !now.Before(e.staleExpiry)
+}
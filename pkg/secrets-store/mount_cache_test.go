@@ -0,0 +1,232 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package secretsstore
+
+import (
+	"testing"
+	"time"
+
+	"sigs.k8s.io/secrets-store-csi-driver/provider/v1alpha1"
+)
+
+func TestMountCache(t *testing.T) {
+	now := time.Now()
+	cache := newMountCache(0)
+	cache.now = func() time.Time { return now }
+
+	if _, ok := cache.get("key1"); ok {
+		t.Fatalf("expected key1 to not be cached")
+	}
+	cache.set("key1", map[string]string{"secret/secret1": "v1"}, []*v1alpha1.File{{Path: "secret1", Contents: []byte("value1")}}, time.Minute, time.Time{})
+	entry, ok := cache.get("key1")
+	if !ok {
+		t.Fatalf("expected key1 to be cached")
+	}
+	if entry.objectVersions["secret/secret1"] != "v1" || len(entry.files) != 1 {
+		t.Errorf("unexpected cache entry: %+v", entry)
+	}
+
+	now = now.Add(time.Minute)
+	if _, ok := cache.get("key1"); ok {
+		t.Errorf("expected key1 to be expired")
+	}
+	if len(cache.entries) != 0 {
+		t.Errorf("expected expired entries to be removed, got: %d", len(cache.entries))
+	}
+
+	// the contents aren't cached beyond the expiry of the mounted objects
+	cache.set("key2", map[string]string{"secret/secret1": "v1"}, nil, time.Minute, now.Add(30*time.Second))
+	now = now.Add(30 * time.Second)
+	if _, ok := cache.get("key2"); ok {
+		t.Errorf("expected key2 to be expired with the mounted objects")
+	}
+}
+
+func TestMountCacheStale(t *testing.T) {
+	now := time.Now()
+	cache := newMountCache(time.Hour)
+	cache.now = func() time.Time { return now }
+
+	// the contents are kept for the maximum stale age when they aren't reused
+	cache.set("key1", map[string]string{"secret/secret1": "v1"}, nil, 0, time.Time{})
+	if _, ok := cache.get("key1"); ok {
+		t.Errorf("expected key1 to not be reused without a ttl")
+	}
+	now = now.Add(30 * time.Minute)
+	entry, ok := cache.getStale("key1")
+	if !ok {
+		t.Fatalf("expected key1 to be served when the providers are unavailable")
+	}
+	if entry.objectVersions["secret/secret1"] != "v1" || !entry.mountTime.Equal(now.Add(-30*time.Minute)) {
+		t.Errorf("unexpected cache entry: %+v", entry)
+	}
+	now = now.Add(30 * time.Minute)
+	if _, ok := cache.getStale("key1"); ok {
+		t.Errorf("expected key1 to be older than the maximum stale age")
+	}
+	if len(cache.entries) != 0 {
+		t.Errorf("expected expired entries to be removed, got: %d", len(cache.entries))
+	}
+
+	// the contents aren't served beyond the expiry of the mounted objects
+	cache.set("key2", map[string]string{"secret/secret1": "v1"}, nil, time.Minute, now.Add(10*time.Minute))
+	now = now.Add(10 * time.Minute)
+	if _, ok := cache.getStale("key2"); ok {
+		t.Errorf("expected key2 to be expired with the mounted objects")
+	}
+
+	// the contents aren't kept without a maximum stale age
+	cache = newMountCache(0)
+	cache.now = func() time.Time { return now }
+	cache.set("key3", map[string]string{"secret/secret1": "v1"}, nil, time.Minute, time.Time{})
+	now = now.Add(time.Minute)
+	if _, ok := cache.getStale("key3"); ok {
+		t.Errorf("expected key3 to not be served without a maximum stale age")
+	}
+}
+
+func TestMountCacheEviction(t *testing.T) {
+	cache := newMountCache(0)
+	cache.maxEntries = 2
+	cache.maxSize = 30
+	file := func(contents string) []*v1alpha1.File {
+		return []*v1alpha1.File{{Path: "secret1", Contents: []byte(contents)}}
+	}
+
+	cache.set("key1", nil, file("value1"), time.Minute, time.Time{})
+	cache.set("key2", nil, file("value2"), time.Minute, time.Time{})
+	// key1 is used more recently than key2
+	if _, ok := cache.get("key1"); !ok {
+		t.Fatalf("expected key1 to be cached")
+	}
+	// the least recently used key2 is evicted for the maximum entries
+	cache.set("key3", nil, file("value3"), time.Minute, time.Time{})
+	if _, ok := cache.get("key2"); ok {
+		t.Errorf("expected key2 to be evicted")
+	}
+	for _, key := range []string{"key1", "key3"} {
+		if _, ok := cache.get(key); !ok {
+			t.Errorf("expected %s to be cached", key)
+		}
+	}
+
+	// key1 is evicted for the maximum size
+	cache.set("key4", nil, file("val4"), time.Minute, time.Time{})
+	if _, ok := cache.get("key1"); ok {
+		t.Errorf("expected key1 to be evicted")
+	}
+	if cache.size != 24 {
+		t.Errorf("expected cache size: 24, got: %d", cache.size)
+	}
+
+	// contents larger than the maximum size aren't cached
+	cache.set("key5", nil, file("a much longer secret value5"), time.Minute, time.Time{})
+	if _, ok := cache.get("key5"); ok {
+		t.Errorf("expected key5 to not be cached")
+	}
+	if len(cache.entries) != 2 || cache.lru.Len() != 2 {
+		t.Errorf("expected 2 entries, got: %d", len(cache.entries))
+	}
+}
+
+func TestMountCacheSweep(t *testing.T) {
+	now := time.Now()
+	cache := newMountCache(0)
+	cache.now = func() time.Time { return now }
+
+	cache.set("key1", nil, []*v1alpha1.File{{Path: "secret1", Contents: []byte("value1")}}, time.Minute, time.Time{})
+	cache.set("key2", nil, nil, time.Hour, time.Time{})
+	now = now.Add(time.Minute)
+	cache.sweep()
+	if _, ok := cache.entries["key1"]; ok {
+		t.Errorf("expected key1 to be removed")
+	}
+	if _, ok := cache.entries["key2"]; !ok {
+		t.Errorf("expected key2 to be cached")
+	}
+	if cache.size != 0 {
+		t.Errorf("expected cache size: 0, got: %d", cache.size)
+	}
+}
+
+func TestMountCacheKey(t *testing.T) {
+	parameters := map[string]string{
+		"parameter1":    "value1",
+		csipodname:      "pod1",
+		csipoduid:       "poduid1",
+		csipodnamespace: "default",
+		csipodsa:        "sa1",
+	}
+	key, err := mountCacheKey("spcuid1", 1, parameters, nil)
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+
+	cases := []struct {
+		name          string
+		spcUID        string
+		generation    int64
+		parameters    map[string]string
+		secrets       map[string]string
+		expectedMatch bool
+	}{
+		{
+			name:          "different pod with same service account",
+			spcUID:        "spcuid1",
+			generation:    1,
+			parameters:    map[string]string{"parameter1": "value1", csipodname: "pod2", csipoduid: "poduid2", csipodnamespace: "default", csipodsa: "sa1"},
+			expectedMatch: true,
+		},
+		{
+			name:       "different service account",
+			spcUID:     "spcuid1",
+			generation: 1,
+			parameters: map[string]string{"parameter1": "value1", csipodname: "pod1", csipoduid: "poduid1", csipodnamespace: "default", csipodsa: "sa2"},
+		},
+		{
+			name:       "secret provider class updated",
+			spcUID:     "spcuid1",
+			generation: 2,
+			parameters: parameters,
+		},
+		{
+			name:       "different secret provider class",
+			spcUID:     "spcuid2",
+			generation: 1,
+			parameters: parameters,
+		},
+		{
+			name:       "different node publish secrets",
+			spcUID:     "spcuid1",
+			generation: 1,
+			parameters: parameters,
+			secrets:    map[string]string{"clientid": "id1"},
+		},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			k, err := mountCacheKey(test.spcUID, test.generation, test.parameters, test.secrets)
+			if err != nil {
+				t.Fatalf("expected err to be nil, got: %+v", err)
+			}
+			if (k == key) != test.expectedMatch {
+				t.Errorf("expected key match: %v, got: %v", test.expectedMatch, k == key)
+			}
+		})
+	}
+}
@@ -0,0 +1,108 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package secretsstore
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+)
+
+// inFlightMountGracePeriod is how long a mount keeps running once all the
+// requests waiting for it are gone, so the retries of the kubelet attach to it
+const inFlightMountGracePeriod = 30 * time.Second
+
+// mountFlights deduplicates the in-flight NodePublishVolume requests of each
+// volume. The kubelet retries the mounts that timed out, a retry waits for the
+// result of the mount in progress instead of fetching the contents from the
+// providers again.
+type mountFlights struct {
+	lock    sync.Mutex
+	flights map[string]*mountFlight
+	// gracePeriod is how long a mount keeps running without requests waiting
+	// for it
+	gracePeriod time.Duration
+}
+
+// mountFlight is a mount in progress
+type mountFlight struct {
+	// done is closed once the mount completed
+	done chan struct{}
+	npvr *csi.NodePublishVolumeResponse
+	err  error
+	// waiters is the number of requests waiting for the mount, the mount is
+	// cancelled after the grace period once there are none
+	waiters int
+	timer   *time.Timer
+	cancel  context.CancelFunc
+}
+
+// newMountFlights returns the in-flight mounts, cancelled after the grace
+// period once no request waits for them
+func newMountFlights(gracePeriod time.Duration) *mountFlights {
+	return &mountFlights{
+		flights:     make(map[string]*mountFlight),
+		gracePeriod: gracePeriod,
+	}
+}
+
+// do starts the mount of the volume or attaches to the mount in progress, and
+// returns its result. shared is true if the mount was started by another
+// request. The mount runs with its own context, so it isn't cancelled when the
+// request that started it times out.
+func (f *mountFlights) do(ctx context.Context, volumeID string, mount func(ctx context.Context) (*csi.NodePublishVolumeResponse, error)) (npvr *csi.NodePublishVolumeResponse, shared bool, err error) {
+	f.lock.Lock()
+	flight, shared := f.flights[volumeID]
+	if !shared {
+		mountCtx, cancel := context.WithCancel(context.Background())
+		flight = &mountFlight{done: make(chan struct{}), cancel: cancel}
+		f.flights[volumeID] = flight
+		go func() {
+			npvr, err := mount(mountCtx)
+			f.lock.Lock()
+			delete(f.flights, volumeID)
+			if flight.timer != nil {
+				flight.timer.Stop()
+			}
+			flight.npvr, flight.err = npvr, err
+			f.lock.Unlock()
+			cancel()
+			close(flight.done)
+		}()
+	}
+	flight.waiters++
+	if flight.timer != nil {
+		flight.timer.Stop()
+		flight.timer = nil
+	}
+	f.lock.Unlock()
+
+	select {
+	case <-flight.done:
+		return flight.npvr, shared, flight.err
+	case <-ctx.Done():
+		f.lock.Lock()
+		flight.waiters--
+		if flight.waiters == 0 {
+			flight.timer = time.AfterFunc(f.gracePeriod, flight.cancel)
+		}
+		f.lock.Unlock()
+		return nil, shared, ctx.Err()
+	}
+}
@@ -0,0 +1,104 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package secretsstore
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+)
+
+func TestMountFlights(t *testing.T) {
+	flights := newMountFlights(time.Minute)
+
+	var lock sync.Mutex
+	var calls int
+	release := make(chan struct{})
+	mount := func(ctx context.Context) (*csi.NodePublishVolumeResponse, error) {
+		lock.Lock()
+		calls++
+		lock.Unlock()
+		<-release
+		return nil, errors.New("mount failed")
+	}
+
+	// the first request times out, the mount keeps running
+	ctx, cancel := context.WithTimeout(context.TODO(), 10*time.Millisecond)
+	defer cancel()
+	if _, shared, err := flights.do(ctx, "vol1", mount); err != context.DeadlineExceeded || shared {
+		t.Fatalf("expected err: %v and shared: false, got: %+v, %v", context.DeadlineExceeded, err, shared)
+	}
+
+	// the retries attach to the mount in progress
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, shared, err := flights.do(context.TODO(), "vol1", mount)
+			if err == nil || err.Error() != "mount failed" || !shared {
+				t.Errorf("expected the shared mount error, got: %+v, %v", err, shared)
+			}
+		}()
+	}
+	// the mounts of other volumes aren't shared
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		flights.do(context.TODO(), "vol2", mount)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	lock.Lock()
+	if calls != 2 {
+		t.Errorf("expected 2 mounts, got: %d", calls)
+	}
+	lock.Unlock()
+
+	// the next request starts a new mount once the mount completed
+	if _, shared, _ := flights.do(context.TODO(), "vol1", mount); shared {
+		t.Errorf("expected a new mount once the mount completed")
+	}
+}
+
+func TestMountFlightsGracePeriod(t *testing.T) {
+	flights := newMountFlights(10 * time.Millisecond)
+
+	cancelled := make(chan struct{})
+	mount := func(ctx context.Context) (*csi.NodePublishVolumeResponse, error) {
+		<-ctx.Done()
+		close(cancelled)
+		return nil, ctx.Err()
+	}
+	ctx, cancel := context.WithCancel(context.TODO())
+	cancel()
+	if _, _, err := flights.do(ctx, "vol1", mount); err != context.Canceled {
+		t.Fatalf("expected err: %v, got: %+v", context.Canceled, err)
+	}
+
+	// the mount is cancelled once no request waited for it for the grace period
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Fatalf("expected the mount to be cancelled after the grace period")
+	}
+}
@@ -0,0 +1,101 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package secretsstore
+
+import (
+	"context"
+	"sync"
+)
+
+// mountPool runs the mounts on a bounded number of workers, so the pods started
+// at the same time on a big node are mounted in parallel without an unbounded
+// number of concurrent mounts and provider calls. The requests of a volume are
+// serialized, e.g. the kubelet retries a mount that timed out while the
+// previous attempt is still running.
+type mountPool struct {
+	// jobs are the mounts waiting for a worker, the mounts run in the goroutine
+	// of the request if nil
+	jobs chan func()
+	lock sync.Mutex
+	// volumes are the volumes with a request in progress, the channel is closed
+	// once the request completes
+	volumes map[string]chan struct{}
+}
+
+// newMountPool returns a pool with the number of workers. The mounts aren't
+// bounded if workers is 0.
+func newMountPool(workers int) *mountPool {
+	p := &mountPool{volumes: make(map[string]chan struct{})}
+	if workers <= 0 {
+		return p
+	}
+	p.jobs = make(chan func())
+	for i := 0; i < workers; i++ {
+		go func() {
+			for job := range p.jobs {
+				job()
+			}
+		}()
+	}
+	return p
+}
+
+// lockVolume blocks until the other requests of the volume completed or the
+// context is done. The returned function completes the request.
+func (p *mountPool) lockVolume(ctx context.Context, volumeID string) (func(), error) {
+	for {
+		p.lock.Lock()
+		done, inProgress := p.volumes[volumeID]
+		if !inProgress {
+			done = make(chan struct{})
+			p.volumes[volumeID] = done
+			p.lock.Unlock()
+			return func() {
+				p.lock.Lock()
+				delete(p.volumes, volumeID)
+				p.lock.Unlock()
+				close(done)
+			}, nil
+		}
+		p.lock.Unlock()
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// waitWorker blocks until a worker runs the mount or the context is done. It
+// returns once the mount completed.
+func (p *mountPool) waitWorker(ctx context.Context, mount func()) error {
+	if p.jobs == nil {
+		mount()
+		return nil
+	}
+	completed := make(chan struct{})
+	select {
+	case p.jobs <- func() {
+		defer close(completed)
+		mount()
+	}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	<-completed
+	return nil
+}
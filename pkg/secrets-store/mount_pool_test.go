@@ -0,0 +1,136 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package secretsstore
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMountPoolWorkers(t *testing.T) {
+	pool := newMountPool(2)
+
+	var lock sync.Mutex
+	var running, maxRunning, completed int
+	var wg sync.WaitGroup
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := pool.waitWorker(context.TODO(), func() {
+				lock.Lock()
+				running++
+				if running > maxRunning {
+					maxRunning = running
+				}
+				lock.Unlock()
+				time.Sleep(10 * time.Millisecond)
+				lock.Lock()
+				running--
+				completed++
+				lock.Unlock()
+			})
+			if err != nil {
+				t.Errorf("expected err to be nil, got: %+v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if completed != 6 {
+		t.Errorf("expected 6 completed mounts, got: %d", completed)
+	}
+	if maxRunning > 2 {
+		t.Errorf("expected at most 2 parallel mounts, got: %d", maxRunning)
+	}
+
+	// the mount waits for a worker until the context is done
+	block := make(chan struct{})
+	defer close(block)
+	started := make(chan struct{})
+	for i := 0; i < 2; i++ {
+		go pool.waitWorker(context.TODO(), func() {
+			started <- struct{}{}
+			<-block
+		})
+	}
+	<-started
+	<-started
+	ctx, cancel := context.WithTimeout(context.TODO(), 50*time.Millisecond)
+	defer cancel()
+	if err := pool.waitWorker(ctx, func() { t.Errorf("expected the mount to not run") }); err != context.DeadlineExceeded {
+		t.Fatalf("expected err: %v, got: %+v", context.DeadlineExceeded, err)
+	}
+}
+
+func TestMountPoolUnbounded(t *testing.T) {
+	pool := newMountPool(0)
+	var ran bool
+	if err := pool.waitWorker(context.TODO(), func() { ran = true }); err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	if !ran {
+		t.Errorf("expected the mount to run")
+	}
+}
+
+func TestMountPoolLockVolume(t *testing.T) {
+	pool := newMountPool(0)
+
+	unlock, err := pool.lockVolume(context.TODO(), "vol1")
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	// the requests of other volumes aren't serialized
+	unlock2, err := pool.lockVolume(context.TODO(), "vol2")
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	unlock2()
+
+	// the second request of the volume waits until the context is done
+	ctx, cancel := context.WithTimeout(context.TODO(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := pool.lockVolume(ctx, "vol1"); err != context.DeadlineExceeded {
+		t.Fatalf("expected err: %v, got: %+v", context.DeadlineExceeded, err)
+	}
+
+	// the second request of the volume starts once the first one completed
+	locked := make(chan error)
+	go func() {
+		unlock, err := pool.lockVolume(context.TODO(), "vol1")
+		if err == nil {
+			unlock()
+		}
+		locked <- err
+	}()
+	select {
+	case err := <-locked:
+		t.Fatalf("expected the second request to wait, got: %+v", err)
+	case <-time.After(10 * time.Millisecond):
+	}
+	unlock()
+	select {
+	case err := <-locked:
+		if err != nil {
+			t.Fatalf("expected err to be nil, got: %+v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("expected the second request to start")
+	}
+}
@@ -0,0 +1,85 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package secretsstore
+
+import (
+	"fmt"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+const (
+	mountPhaseFetch = "fetching the contents from the providers"
+	mountPhaseWrite = "writing the mounted files"
+)
+
+// MountTimeout is the deadline of NodePublishVolume, split between fetching the
+// contents from the providers and writing the mounted files, so a slow backend
+// fails the mount with the phase that timed out instead of an opaque deadline
+// error
+type MountTimeout struct {
+	// Timeout is the deadline of a mount, the mounts aren't timed out by the
+	// driver if zero
+	Timeout time.Duration
+	// WriteTimeout is the part of the timeout reserved for writing the mounted
+	// files, the contents are fetched within the rest of the timeout
+	WriteTimeout time.Duration
+}
+
+// Validate returns an error if a timeout is negative or if the write timeout
+// doesn't leave time to fetch the contents
+func (t MountTimeout) Validate() error {
+	if t.Timeout < 0 {
+		return fmt.Errorf("mount timeout must not be negative, got: %v", t.Timeout)
+	}
+	if t.WriteTimeout < 0 {
+		return fmt.Errorf("mount write timeout must not be negative, got: %v", t.WriteTimeout)
+	}
+	if t.Timeout > 0 && t.WriteTimeout >= t.Timeout {
+		return fmt.Errorf("mount write timeout %v must be shorter than the mount timeout %v", t.WriteTimeout, t.Timeout)
+	}
+	return nil
+}
+
+// contexts returns the context of a mount, timed out after the timeout, and
+// the context of its fetch phase, timed out the write timeout earlier. The
+// contexts aren't timed out if the timeout is 0.
+func (t MountTimeout) contexts(ctx context.Context) (context.Context, context.Context, context.CancelFunc) {
+	if t.Timeout <= 0 {
+		mountCtx, cancel := context.WithCancel(ctx)
+		return mountCtx, mountCtx, cancel
+	}
+	mountCtx, cancel := context.WithTimeout(ctx, t.Timeout)
+	fetchCtx, cancelFetch := context.WithTimeout(mountCtx, t.Timeout-t.WriteTimeout)
+	return mountCtx, fetchCtx, func() {
+		cancelFetch()
+		cancel()
+	}
+}
+
+// phaseTimeout returns why the phase of a mount timed out and true if the
+// context of the phase exceeded its deadline
+func (t MountTimeout) phaseTimeout(phaseCtx context.Context, phase string) (string, bool) {
+	if t.Timeout <= 0 || phaseCtx.Err() != context.DeadlineExceeded {
+		return "", false
+	}
+	if phase == mountPhaseFetch {
+		return fmt.Sprintf("%s didn't complete within %v of the %v mount timeout", phase, t.Timeout-t.WriteTimeout, t.Timeout), true
+	}
+	return fmt.Sprintf("%s didn't complete within the %v mount timeout", phase, t.Timeout), true
+}
@@ -0,0 +1,97 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package secretsstore
+
+import (
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+func TestMountTimeoutValidate(t *testing.T) {
+	cases := []struct {
+		name         string
+		mountTimeout MountTimeout
+		expectedErr  bool
+	}{
+		{
+			name: "no timeout",
+		},
+		{
+			name:         "write timeout without timeout",
+			mountTimeout: MountTimeout{WriteTimeout: 10 * time.Second},
+		},
+		{
+			name:         "valid timeout",
+			mountTimeout: MountTimeout{Timeout: time.Minute, WriteTimeout: 10 * time.Second},
+		},
+		{
+			name:         "negative timeout",
+			mountTimeout: MountTimeout{Timeout: -time.Second},
+			expectedErr:  true,
+		},
+		{
+			name:         "negative write timeout",
+			mountTimeout: MountTimeout{Timeout: time.Minute, WriteTimeout: -time.Second},
+			expectedErr:  true,
+		},
+		{
+			name:         "write timeout longer than timeout",
+			mountTimeout: MountTimeout{Timeout: 10 * time.Second, WriteTimeout: 10 * time.Second},
+			expectedErr:  true,
+		},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.mountTimeout.Validate()
+			if test.expectedErr != (err != nil) {
+				t.Fatalf("expected err: %v, got: %+v", test.expectedErr, err)
+			}
+		})
+	}
+}
+
+func TestMountTimeoutPhaseTimeout(t *testing.T) {
+	mountTimeout := MountTimeout{Timeout: 200 * time.Millisecond, WriteTimeout: 100 * time.Millisecond}
+	mountCtx, fetchCtx, cancel := mountTimeout.contexts(context.Background())
+	defer cancel()
+
+	if _, timedOut := mountTimeout.phaseTimeout(fetchCtx, mountPhaseFetch); timedOut {
+		t.Fatalf("expected fetch phase to not be timed out")
+	}
+	<-fetchCtx.Done()
+	if mountCtx.Err() != nil {
+		t.Fatalf("expected mount context to not be done at the end of the fetch phase, got: %+v", mountCtx.Err())
+	}
+	reason, timedOut := mountTimeout.phaseTimeout(fetchCtx, mountPhaseFetch)
+	if !timedOut {
+		t.Fatalf("expected fetch phase to be timed out")
+	}
+	if expected := "fetching the contents from the providers didn't complete within 100ms of the 200ms mount timeout"; reason != expected {
+		t.Errorf("expected reason: %s, got: %s", expected, reason)
+	}
+	<-mountCtx.Done()
+	reason, timedOut = mountTimeout.phaseTimeout(mountCtx, mountPhaseWrite)
+	if !timedOut {
+		t.Fatalf("expected write phase to be timed out")
+	}
+	if expected := "writing the mounted files didn't complete within the 200ms mount timeout"; reason != expected {
+		t.Errorf("expected reason: %s, got: %s", expected, reason)
+	}
+}
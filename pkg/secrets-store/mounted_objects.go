@@ -0,0 +1,395 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package secretsstore
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"sigs.k8s.io/secrets-store-csi-driver/apis/v1alpha1"
+	"sigs.k8s.io/secrets-store-csi-driver/pkg/util/fileutil"
+	providerv1alpha1 "sigs.k8s.io/secrets-store-csi-driver/provider/v1alpha1"
+)
+
+// maxObjectVersionHistory is the maximum number of previous versions kept of a
+// mounted object
+const maxObjectVersionHistory = 10
+
+// validateMountedObjects returns an error if the object name or file name of
+// a mounted object isn't a valid relative path, if the file permission isn't
+// a valid octal permission, if the encoding, the format or the version history
+// isn't supported, or if more than one mounted object uses the same object name or
+// file name, including the file names of the previous versions. Nested file
+// names, e.g. certs/tls.crt, are allowed, but a file name can't be a parent
+// directory of another file name or start with '..', which is reserved for the
+// files of the driver.
+func validateMountedObjects(mountedObjects []*v1alpha1.MountedObject) error {
+	objectNames := make(map[string]bool, len(mountedObjects))
+	fileNames := make(map[string]bool, len(mountedObjects))
+	for _, mountedObj := range mountedObjects {
+		if mountedObj == nil {
+			continue
+		}
+		if err := fileutil.ValidatePath(mountedObj.ObjectName); err != nil {
+			return fmt.Errorf("invalid object name of mounted object, err: %v", err)
+		}
+		objectName := filepath.Clean(mountedObj.ObjectName)
+		if objectNames[objectName] {
+			return fmt.Errorf("object %s is mounted more than once", mountedObj.ObjectName)
+		}
+		objectNames[objectName] = true
+		if _, err := mountedObjectPermission(mountedObj); err != nil {
+			return err
+		}
+		switch mountedObj.Encoding {
+		case "", v1alpha1.ObjectEncodingUTF8, v1alpha1.ObjectEncodingBase64, v1alpha1.ObjectEncodingHex:
+		default:
+			return fmt.Errorf("unsupported encoding %q of mounted object %s", mountedObj.Encoding, mountedObj.ObjectName)
+		}
+		switch mountedObj.Format {
+		case "", v1alpha1.ObjectFormatJSON, v1alpha1.ObjectFormatYAML, v1alpha1.ObjectFormatSplitKeys, v1alpha1.ObjectFormatSplitPEM:
+		default:
+			return fmt.Errorf("unsupported format %q of mounted object %s", mountedObj.Format, mountedObj.ObjectName)
+		}
+		if isSplitFormat(mountedObj.Format) && mountedObj.ObjectVersionHistory > 0 {
+			return fmt.Errorf("previous versions of mounted object %s can't be kept with the %s format", mountedObj.ObjectName, mountedObj.Format)
+		}
+		if mountedObj.ObjectVersionHistory < 0 || mountedObj.ObjectVersionHistory > maxObjectVersionHistory {
+			return fmt.Errorf("invalid version history %d of mounted object %s, the version history must be between 0 and %d", mountedObj.ObjectVersionHistory, mountedObj.ObjectName, maxObjectVersionHistory)
+		}
+		if len(mountedObj.FileName) > 0 {
+			if err := fileutil.ValidatePath(mountedObj.FileName); err != nil {
+				return fmt.Errorf("invalid file name of mounted object %s, err: %v", mountedObj.ObjectName, err)
+			}
+			fileName := filepath.Clean(mountedObj.FileName)
+			if strings.HasPrefix(fileName, "..") {
+				return fmt.Errorf("invalid file name %s of mounted object %s, file names starting with '..' are reserved", mountedObj.FileName, mountedObj.ObjectName)
+			}
+			if fileNames[fileName] {
+				return fmt.Errorf("file name %s is used by more than one mounted object", mountedObj.FileName)
+			}
+			fileNames[fileName] = true
+		}
+	}
+	files := make(map[string]bool, len(mountedObjects))
+	for _, mountedObj := range mountedObjects {
+		if mountedObj != nil {
+			files[filepath.Clean(mountedObjectFileName(mountedObj))] = true
+		}
+	}
+	for _, mountedObj := range mountedObjects {
+		if mountedObj == nil {
+			continue
+		}
+		fileName := filepath.Clean(mountedObjectFileName(mountedObj))
+		for dir := filepath.Dir(fileName); dir != "." && dir != string(filepath.Separator); dir = filepath.Dir(dir) {
+			if files[dir] {
+				return fmt.Errorf("file name %s of mounted object %s is inside file name %s of another mounted object", fileName, mountedObj.ObjectName, dir)
+			}
+		}
+		for n := int32(1); n <= mountedObj.ObjectVersionHistory; n++ {
+			if versionFile := versionHistoryFileName(fileName, n); fileNames[versionFile] || objectNames[versionFile] {
+				return fmt.Errorf("file name %s of previous version %d of mounted object %s is used by another mounted object", versionFile, n, mountedObj.ObjectName)
+			}
+		}
+	}
+	return nil
+}
+
+// mountedObjectPermission returns the file permission of the mounted object,
+// or 0 if the permission isn't set
+func mountedObjectPermission(mountedObj *v1alpha1.MountedObject) (os.FileMode, error) {
+	if len(mountedObj.FilePermission) == 0 {
+		return 0, nil
+	}
+	perm, err := parseFilePermission(mountedObj.FilePermission)
+	if err != nil {
+		return 0, fmt.Errorf("invalid file permission %q of mounted object %s, the permission must be an octal number between 0000 and 0777", mountedObj.FilePermission, mountedObj.ObjectName)
+	}
+	return perm, nil
+}
+
+// parseFilePermission returns the octal file permission between 0000 and 0777
+func parseFilePermission(filePermission string) (os.FileMode, error) {
+	perm, err := strconv.ParseUint(filePermission, 8, 32)
+	if err != nil {
+		return 0, err
+	}
+	if perm > 0777 {
+		return 0, fmt.Errorf("permission %s has bits above 0777", filePermission)
+	}
+	return os.FileMode(perm), nil
+}
+
+// decodeMountedObject returns the contents of the mounted object decoded with
+// its encoding. The whitespace around base64 and hex contents is ignored, e.g.
+// the trailing newline of a file.
+func decodeMountedObject(mountedObj *v1alpha1.MountedObject, contents []byte) ([]byte, error) {
+	var decoded []byte
+	var err error
+	switch mountedObj.Encoding {
+	case v1alpha1.ObjectEncodingBase64:
+		encoded := bytes.TrimSpace(contents)
+		decoded = make([]byte, base64.StdEncoding.DecodedLen(len(encoded)))
+		var n int
+		n, err = base64.StdEncoding.Decode(decoded, encoded)
+		decoded = decoded[:n]
+	case v1alpha1.ObjectEncodingHex:
+		encoded := bytes.TrimSpace(contents)
+		decoded = make([]byte, hex.DecodedLen(len(encoded)))
+		_, err = hex.Decode(decoded, encoded)
+	default:
+		return contents, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode the %s contents of mounted object %s, err: %v", mountedObj.Encoding, mountedObj.ObjectName, err)
+	}
+	return decoded, nil
+}
+
+// mountedObjectFileName returns the path of the file of the mounted object
+// relative to the target path
+func mountedObjectFileName(mountedObj *v1alpha1.MountedObject) string {
+	if len(mountedObj.FileName) > 0 {
+		return mountedObj.FileName
+	}
+	return mountedObj.ObjectName
+}
+
+// versionHistoryFileName returns the path of the nth previous version of the
+// file of a mounted object
+func versionHistoryFileName(fileName string, n int32) string {
+	return fmt.Sprintf("%s.%d", fileName, n)
+}
+
+// versionHistories returns the version history of the mounted objects that
+// keep previous versions, by the path of their file relative to the target path
+func versionHistories(mountedObjects []*v1alpha1.MountedObject) map[string]int32 {
+	histories := make(map[string]int32)
+	for _, mountedObj := range mountedObjects {
+		if mountedObj != nil && mountedObj.ObjectVersionHistory > 0 {
+			histories[filepath.Clean(mountedObjectFileName(mountedObj))] = mountedObj.ObjectVersionHistory
+		}
+	}
+	return histories
+}
+
+// keepPreviousVersion copies the file at path to its first previous version
+// before the file is replaced by its rotated version, after shifting the
+// existing previous versions by one. The oldest version beyond the version
+// history is overwritten. The file is copied instead of renamed, so it exists
+// until it's replaced.
+func keepPreviousVersion(path string, history int32) error {
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	for n := history - 1; n >= 1; n-- {
+		if err := os.Rename(versionHistoryFileName(path, n), versionHistoryFileName(path, n+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	previous := versionHistoryFileName(path, 1)
+	if err := ioutil.WriteFile(previous, contents, fileutil.FileMode(info.Mode().Perm())); err != nil {
+		return err
+	}
+	// the permission isn't changed if the file already exists
+	return os.Chmod(previous, fileutil.FileMode(info.Mode().Perm()))
+}
+
+// previousVersionFiles returns the paths relative to the target path of the
+// previous versions in the target path of the file, up to the version history
+func previousVersionFiles(targetPath, file string, history int32) []string {
+	var files []string
+	for n := int32(1); n <= history; n++ {
+		versionFile := versionHistoryFileName(file, n)
+		if _, err := os.Lstat(filepath.Join(targetPath, versionFile)); err == nil {
+			files = append(files, versionFile)
+		}
+	}
+	return files
+}
+
+// applyMountedObjects renames the files of the mounted objects in the target
+// path to their file names, decodes their contents, converts them to their
+// formats and sets their file permissions. Objects that weren't mounted to the target path are skipped,
+// e.g. because they are mounted by another provider of the secret provider
+// class. The directories of the object names that are left empty are removed.
+// It returns the error reason with the error.
+func applyMountedObjects(targetPath string, mountedObjects []*v1alpha1.MountedObject) (string, error) {
+	// the mounted objects are validated again as the secret provider class
+	// could have changed since the volume was mounted, e.g. for the rotation
+	if err := validateMountedObjects(mountedObjects); err != nil {
+		return InvalidMountedObjects, err
+	}
+	for _, mountedObj := range mountedObjects {
+		if mountedObj == nil {
+			continue
+		}
+		if err := fileutil.ValidateParents(targetPath, mountedObj.ObjectName); err != nil {
+			return FailedToWriteFiles, fmt.Errorf("invalid object name of mounted object, err: %v", err)
+		}
+		src := filepath.Join(targetPath, mountedObj.ObjectName)
+		info, err := os.Lstat(src)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return FailedToWriteFiles, err
+		}
+		dest := filepath.Join(targetPath, mountedObjectFileName(mountedObj))
+		if dest != src {
+			if _, err := os.Lstat(dest); err == nil {
+				return FilePathCollision, fmt.Errorf("file name %s of mounted object %s is already used by another file", mountedObj.FileName, mountedObj.ObjectName)
+			} else if !os.IsNotExist(err) {
+				return FailedToWriteFiles, err
+			}
+			if err := fileutil.MkdirParents(targetPath, mountedObjectFileName(mountedObj)); err != nil {
+				return FilePathCollision, fmt.Errorf("failed to create directory of file name %s of mounted object %s, err: %v", mountedObj.FileName, mountedObj.ObjectName, err)
+			}
+			if err := os.Rename(src, dest); err != nil {
+				return FailedToWriteFiles, fmt.Errorf("failed to rename mounted object %s to %s, err: %v", mountedObj.ObjectName, mountedObj.FileName, err)
+			}
+			removeEmptyDirs(targetPath, filepath.Dir(src))
+		}
+		paths := []string{dest}
+		if (len(mountedObj.Encoding) > 0 && mountedObj.Encoding != v1alpha1.ObjectEncodingUTF8) || len(mountedObj.Format) > 0 {
+			contents, err := ioutil.ReadFile(dest)
+			if err != nil {
+				return FailedToWriteFiles, fmt.Errorf("failed to read mounted object %s, err: %v", mountedObj.ObjectName, err)
+			}
+			decoded, err := decodeMountedObject(mountedObj, contents)
+			if err != nil {
+				return InvalidProviderResponse, err
+			}
+			files, err := formatMountedObject(mountedObj, decoded)
+			if err != nil {
+				return InvalidProviderResponse, err
+			}
+			// the file of a split object is replaced by the directory of
+			// its files
+			if isSplitFormat(mountedObj.Format) {
+				if err := os.Remove(dest); err != nil {
+					return FailedToWriteFiles, err
+				}
+				if err := os.Mkdir(dest, 0755); err != nil {
+					return FailedToWriteFiles, fmt.Errorf("failed to create directory of mounted object %s, err: %v", mountedObj.ObjectName, err)
+				}
+			}
+			paths = paths[:0]
+			for file, contents := range files {
+				path := filepath.Join(targetPath, file)
+				if err := ioutil.WriteFile(path, contents, fileutil.FileMode(info.Mode().Perm())); err != nil {
+					return FailedToWriteFiles, fmt.Errorf("failed to write decoded mounted object %s, err: %v", mountedObj.ObjectName, err)
+				}
+				paths = append(paths, path)
+			}
+		}
+		perm, err := mountedObjectPermission(mountedObj)
+		if err != nil {
+			return InvalidMountedObjects, err
+		}
+		if perm != 0 {
+			for _, path := range paths {
+				if err := os.Chmod(path, fileutil.FileMode(perm)); err != nil {
+					return FailedToWriteFiles, fmt.Errorf("failed to set file permission of mounted object %s, err: %v", mountedObj.ObjectName, err)
+				}
+			}
+		}
+	}
+	return "", nil
+}
+
+// removeEmptyDirs removes dir and its parent directories up to, but not
+// including, targetPath as long as they are empty
+func removeEmptyDirs(targetPath, dir string) {
+	for dir != targetPath && len(dir) > len(targetPath) {
+		if err := os.Remove(dir); err != nil {
+			// the directory isn't empty
+			return
+		}
+		dir = filepath.Dir(dir)
+	}
+}
+
+// applyMountedObjectFiles returns the files fetched from a provider with the
+// paths, contents and modes of the mounted objects replaced by their file
+// names, decoded and converted contents and file permissions, the same way
+// applyMountedObjects updates the files in the target path. It returns the
+// error reason with the error.
+func applyMountedObjectFiles(files []*providerv1alpha1.File, mountedObjects []*v1alpha1.MountedObject) ([]*providerv1alpha1.File, string, error) {
+	if err := validateMountedObjects(mountedObjects); err != nil {
+		return nil, InvalidMountedObjects, err
+	}
+	if len(mountedObjects) == 0 {
+		return files, "", nil
+	}
+	byObjectName := make(map[string]*v1alpha1.MountedObject, len(mountedObjects))
+	for _, mountedObj := range mountedObjects {
+		if mountedObj != nil {
+			byObjectName[filepath.Clean(mountedObj.ObjectName)] = mountedObj
+		}
+	}
+	applied := make([]*providerv1alpha1.File, 0, len(files))
+	for _, file := range files {
+		if mountedObj, ok := byObjectName[filepath.Clean(file.Path)]; ok {
+			perm, err := mountedObjectPermission(mountedObj)
+			if err != nil {
+				return nil, InvalidMountedObjects, err
+			}
+			mode := file.Mode
+			if perm != 0 {
+				mode = int32(perm)
+			}
+			contents, err := decodeMountedObject(mountedObj, file.Contents)
+			if err != nil {
+				return nil, InvalidProviderResponse, err
+			}
+			formatted, err := formatMountedObject(mountedObj, contents)
+			if err != nil {
+				return nil, InvalidProviderResponse, err
+			}
+			paths := make([]string, 0, len(formatted))
+			for path := range formatted {
+				paths = append(paths, path)
+			}
+			sort.Strings(paths)
+			for _, path := range paths {
+				applied = append(applied, &providerv1alpha1.File{Path: path, Mode: mode, Contents: formatted[path]})
+			}
+			continue
+		}
+		applied = append(applied, file)
+	}
+	if err := fileutil.ValidatePayloads(applied); err != nil {
+		return nil, FilePathCollision, fmt.Errorf("invalid file names of mounted objects, err: %v", err)
+	}
+	return applied, "", nil
+}
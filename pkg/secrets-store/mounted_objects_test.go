@@ -0,0 +1,430 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package secretsstore
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"sigs.k8s.io/secrets-store-csi-driver/apis/v1alpha1"
+	providerv1alpha1 "sigs.k8s.io/secrets-store-csi-driver/provider/v1alpha1"
+)
+
+func TestValidateMountedObjects(t *testing.T) {
+	cases := []struct {
+		name           string
+		mountedObjects []*v1alpha1.MountedObject
+		expectedErr    bool
+	}{
+		{
+			name: "valid",
+			mountedObjects: []*v1alpha1.MountedObject{
+				{ObjectName: "projects/123/secrets/db-password/versions/latest", FileName: "db-password"},
+				{ObjectName: "tls.crt"},
+			},
+		},
+		{
+			name:           "object name outside of the volume",
+			mountedObjects: []*v1alpha1.MountedObject{{ObjectName: "../secret1", FileName: "secret1"}},
+			expectedErr:    true,
+		},
+		{
+			name:           "absolute file name",
+			mountedObjects: []*v1alpha1.MountedObject{{ObjectName: "secret1", FileName: "/etc/passwd"}},
+			expectedErr:    true,
+		},
+		{
+			name:           "file permission",
+			mountedObjects: []*v1alpha1.MountedObject{{ObjectName: "tls.key", FilePermission: "0400"}, {ObjectName: "ca.crt", FilePermission: "444"}},
+		},
+		{
+			name:           "invalid file permission",
+			mountedObjects: []*v1alpha1.MountedObject{{ObjectName: "tls.key", FilePermission: "0800"}},
+			expectedErr:    true,
+		},
+		{
+			name:           "file permission with special bits",
+			mountedObjects: []*v1alpha1.MountedObject{{ObjectName: "tls.key", FilePermission: "4755"}},
+			expectedErr:    true,
+		},
+		{
+			name:           "unsupported encoding",
+			mountedObjects: []*v1alpha1.MountedObject{{ObjectName: "keystore.p12", Encoding: "base32"}},
+			expectedErr:    true,
+		},
+		{
+			name:           "version history",
+			mountedObjects: []*v1alpha1.MountedObject{{ObjectName: "signing.key", ObjectVersionHistory: 2}},
+		},
+		{
+			name:           "version history above the maximum",
+			mountedObjects: []*v1alpha1.MountedObject{{ObjectName: "signing.key", ObjectVersionHistory: 11}},
+			expectedErr:    true,
+		},
+		{
+			name: "previous version with the file name of another object",
+			mountedObjects: []*v1alpha1.MountedObject{
+				{ObjectName: "secret1", FileName: "signing.key", ObjectVersionHistory: 2},
+				{ObjectName: "signing.key.2"},
+			},
+			expectedErr: true,
+		},
+		{
+			name: "nested file names",
+			mountedObjects: []*v1alpha1.MountedObject{
+				{ObjectName: "tls-cert", FileName: "certs/tls.crt"},
+				{ObjectName: "tls-key", FileName: "certs/tls.key"},
+				{ObjectName: "app-config", FileName: "config/app/config.yaml"},
+			},
+		},
+		{
+			name: "file name inside the file name of another object",
+			mountedObjects: []*v1alpha1.MountedObject{
+				{ObjectName: "tls-cert", FileName: "certs/tls.crt"},
+				{ObjectName: "certs"},
+			},
+			expectedErr: true,
+		},
+		{
+			name:           "reserved file name",
+			mountedObjects: []*v1alpha1.MountedObject{{ObjectName: "tls-cert", FileName: "..data/tls.crt"}},
+			expectedErr:    true,
+		},
+		{
+			name: "formats",
+			mountedObjects: []*v1alpha1.MountedObject{
+				{ObjectName: "config", Format: v1alpha1.ObjectFormatYAML},
+				{ObjectName: "db", Format: v1alpha1.ObjectFormatSplitKeys},
+				{ObjectName: "bundle", FileName: "tls", Format: v1alpha1.ObjectFormatSplitPEM},
+			},
+		},
+		{
+			name:           "unsupported format",
+			mountedObjects: []*v1alpha1.MountedObject{{ObjectName: "config", Format: "toml"}},
+			expectedErr:    true,
+		},
+		{
+			name:           "version history of split object",
+			mountedObjects: []*v1alpha1.MountedObject{{ObjectName: "db", Format: v1alpha1.ObjectFormatSplitKeys, ObjectVersionHistory: 1}},
+			expectedErr:    true,
+		},
+		{
+			name: "file name inside the directory of a split object",
+			mountedObjects: []*v1alpha1.MountedObject{
+				{ObjectName: "db", Format: v1alpha1.ObjectFormatSplitKeys},
+				{ObjectName: "db-host", FileName: "db/host"},
+			},
+			expectedErr: true,
+		},
+		{
+			name: "duplicate object name",
+			mountedObjects: []*v1alpha1.MountedObject{
+				{ObjectName: "secret1", FileName: "file1"},
+				{ObjectName: "./secret1", FileName: "file2"},
+			},
+			expectedErr: true,
+		},
+		{
+			name: "duplicate file name",
+			mountedObjects: []*v1alpha1.MountedObject{
+				{ObjectName: "secret1", FileName: "file1"},
+				{ObjectName: "secret2", FileName: "file1"},
+			},
+			expectedErr: true,
+		},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			err := validateMountedObjects(test.mountedObjects)
+			if test.expectedErr != (err != nil) {
+				t.Fatalf("expected err: %v, got: %+v", test.expectedErr, err)
+			}
+		})
+	}
+}
+
+func TestApplyMountedObjects(t *testing.T) {
+	cases := []struct {
+		name           string
+		files          []string
+		mountedObjects []*v1alpha1.MountedObject
+		expectedFiles  []string
+		expectedErr    bool
+	}{
+		{
+			name:  "nested object renamed",
+			files: []string{"projects/123/secrets/db-password/versions/latest", "projects/123/secrets/db-user/versions/latest"},
+			mountedObjects: []*v1alpha1.MountedObject{
+				{ObjectName: "projects/123/secrets/db-password/versions/latest", FileName: "db-password"},
+			},
+			expectedFiles: []string{"db-password", "projects/123/secrets/db-user/versions/latest"},
+		},
+		{
+			name:  "all objects renamed",
+			files: []string{"projects/123/secrets/db-password/versions/latest"},
+			mountedObjects: []*v1alpha1.MountedObject{
+				{ObjectName: "projects/123/secrets/db-password/versions/latest", FileName: "db/password"},
+			},
+			expectedFiles: []string{"db/password"},
+		},
+		{
+			name:  "objects renamed to nested file names",
+			files: []string{"tls-cert", "tls-key", "app-config"},
+			mountedObjects: []*v1alpha1.MountedObject{
+				{ObjectName: "tls-cert", FileName: "certs/tls.crt"},
+				{ObjectName: "tls-key", FileName: "certs/tls.key"},
+				{ObjectName: "app-config", FileName: "config/app/config.yaml"},
+			},
+			expectedFiles: []string{"certs/tls.crt", "certs/tls.key", "config/app/config.yaml"},
+		},
+		{
+			name:  "file name inside a file",
+			files: []string{"tls-cert", "certs"},
+			mountedObjects: []*v1alpha1.MountedObject{
+				{ObjectName: "tls-cert", FileName: "certs/tls.crt"},
+			},
+			expectedErr: true,
+		},
+		{
+			name:  "object not mounted",
+			files: []string{"secret1"},
+			mountedObjects: []*v1alpha1.MountedObject{
+				{ObjectName: "secret2", FileName: "file2"},
+				{ObjectName: "secret1"},
+			},
+			expectedFiles: []string{"secret1"},
+		},
+		{
+			name:           "file name used by another file",
+			files:          []string{"secret1", "secret2"},
+			mountedObjects: []*v1alpha1.MountedObject{{ObjectName: "secret1", FileName: "secret2"}},
+			expectedErr:    true,
+		},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			targetPath := getTestTargetPath(t)
+			defer os.RemoveAll(targetPath)
+			for _, file := range test.files {
+				p := filepath.Join(targetPath, file)
+				if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+					t.Fatalf("expected err to be nil, got: %+v", err)
+				}
+				if err := ioutil.WriteFile(p, []byte(file), 0644); err != nil {
+					t.Fatalf("expected err to be nil, got: %+v", err)
+				}
+			}
+
+			_, err := applyMountedObjects(targetPath, test.mountedObjects)
+			if test.expectedErr != (err != nil) {
+				t.Fatalf("expected err: %v, got: %+v", test.expectedErr, err)
+			}
+			if test.expectedErr {
+				return
+			}
+			var files []string
+			err = filepath.Walk(targetPath, func(path string, info os.FileInfo, err error) error {
+				if err != nil {
+					return err
+				}
+				rel, err := filepath.Rel(targetPath, path)
+				if err != nil {
+					return err
+				}
+				// only the files and the directories that were left are listed
+				if !info.IsDir() {
+					files = append(files, filepath.ToSlash(rel))
+				} else if entries, _ := ioutil.ReadDir(path); len(entries) == 0 {
+					files = append(files, filepath.ToSlash(rel)+"/")
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("expected err to be nil, got: %+v", err)
+			}
+			if !reflect.DeepEqual(files, test.expectedFiles) {
+				t.Fatalf("expected files: %v, got: %v", test.expectedFiles, files)
+			}
+		})
+	}
+}
+
+func TestApplyMountedObjectsFilePermission(t *testing.T) {
+	targetPath := getTestTargetPath(t)
+	defer os.RemoveAll(targetPath)
+	for _, file := range []string{"tls.key", "ca.crt", "tls.crt"} {
+		if err := ioutil.WriteFile(filepath.Join(targetPath, file), []byte(file), 0644); err != nil {
+			t.Fatalf("expected err to be nil, got: %+v", err)
+		}
+	}
+
+	_, err := applyMountedObjects(targetPath, []*v1alpha1.MountedObject{
+		{ObjectName: "tls.key", FileName: "private/tls.key", FilePermission: "0400"},
+		{ObjectName: "ca.crt", FilePermission: "0444"},
+	})
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	expectedModes := map[string]os.FileMode{"private/tls.key": 0400, "ca.crt": 0444, "tls.crt": 0644}
+	for file, expectedMode := range expectedModes {
+		info, err := os.Stat(filepath.Join(targetPath, file))
+		if err != nil {
+			t.Fatalf("expected err to be nil, got: %+v", err)
+		}
+		if info.Mode().Perm() != expectedMode {
+			t.Fatalf("expected mode of %s: %v, got: %v", file, expectedMode, info.Mode().Perm())
+		}
+	}
+}
+
+func TestDecodeMountedObject(t *testing.T) {
+	cases := []struct {
+		name             string
+		encoding         v1alpha1.ObjectEncoding
+		contents         string
+		expectedContents []byte
+		expectedErr      bool
+	}{
+		{
+			name:             "default encoding",
+			contents:         "value1\n",
+			expectedContents: []byte("value1\n"),
+		},
+		{
+			name:             "utf-8",
+			encoding:         v1alpha1.ObjectEncodingUTF8,
+			contents:         "value1",
+			expectedContents: []byte("value1"),
+		},
+		{
+			name:             "base64 with trailing newline",
+			encoding:         v1alpha1.ObjectEncodingBase64,
+			contents:         "AAEC/w==\n",
+			expectedContents: []byte{0x00, 0x01, 0x02, 0xff},
+		},
+		{
+			name:             "hex",
+			encoding:         v1alpha1.ObjectEncodingHex,
+			contents:         "000102ff",
+			expectedContents: []byte{0x00, 0x01, 0x02, 0xff},
+		},
+		{
+			name:        "invalid base64",
+			encoding:    v1alpha1.ObjectEncodingBase64,
+			contents:    "value1!",
+			expectedErr: true,
+		},
+		{
+			name:        "invalid hex",
+			encoding:    v1alpha1.ObjectEncodingHex,
+			contents:    "0g",
+			expectedErr: true,
+		},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			contents, err := decodeMountedObject(&v1alpha1.MountedObject{ObjectName: "object1", Encoding: test.encoding}, []byte(test.contents))
+			if test.expectedErr != (err != nil) {
+				t.Fatalf("expected err: %v, got: %+v", test.expectedErr, err)
+			}
+			if !test.expectedErr && !reflect.DeepEqual(contents, test.expectedContents) {
+				t.Fatalf("expected contents: %v, got: %v", test.expectedContents, contents)
+			}
+		})
+	}
+}
+
+func TestApplyMountedObjectsEncoding(t *testing.T) {
+	targetPath := getTestTargetPath(t)
+	defer os.RemoveAll(targetPath)
+	if err := ioutil.WriteFile(filepath.Join(targetPath, "keystore"), []byte("AAEC/w==\n"), 0600); err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+
+	_, err := applyMountedObjects(targetPath, []*v1alpha1.MountedObject{
+		{ObjectName: "keystore", FileName: "keystore.p12", Encoding: v1alpha1.ObjectEncodingBase64},
+	})
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	contents, err := ioutil.ReadFile(filepath.Join(targetPath, "keystore.p12"))
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	if !reflect.DeepEqual(contents, []byte{0x00, 0x01, 0x02, 0xff}) {
+		t.Fatalf("expected decoded contents, got: %v", contents)
+	}
+	info, err := os.Stat(filepath.Join(targetPath, "keystore.p12"))
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Fatalf("expected mode: %v, got: %v", os.FileMode(0600), info.Mode().Perm())
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(targetPath, "cert"), []byte("not hex"), 0644); err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	errorReason, err := applyMountedObjects(targetPath, []*v1alpha1.MountedObject{{ObjectName: "cert", Encoding: v1alpha1.ObjectEncodingHex}})
+	if err == nil || errorReason != InvalidProviderResponse {
+		t.Fatalf("expected %s err, got reason: %s, err: %+v", InvalidProviderResponse, errorReason, err)
+	}
+}
+
+func TestApplyMountedObjectFiles(t *testing.T) {
+	files := []*providerv1alpha1.File{
+		{Path: "projects/123/secrets/db-password/versions/latest", Mode: 0600, Contents: []byte("password")},
+		{Path: "db-user", Contents: []byte("user")},
+		{Path: "keystore", Contents: []byte("AAEC/w==")},
+		{Path: "app", Contents: []byte(`{"host":"db.local","port":5432}`)},
+	}
+
+	renamed, _, err := applyMountedObjectFiles(files, []*v1alpha1.MountedObject{
+		{ObjectName: "projects/123/secrets/db-password/versions/latest", FileName: "db-password"},
+		{ObjectName: "db-user", FilePermission: "0440"},
+		{ObjectName: "keystore", Encoding: v1alpha1.ObjectEncodingBase64},
+		{ObjectName: "app", FilePermission: "0400", Format: v1alpha1.ObjectFormatSplitKeys},
+	})
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	expected := []*providerv1alpha1.File{
+		{Path: "db-password", Mode: 0600, Contents: []byte("password")},
+		{Path: "db-user", Mode: 0440, Contents: []byte("user")},
+		{Path: "keystore", Contents: []byte{0x00, 0x01, 0x02, 0xff}},
+		{Path: "app/host", Mode: 0400, Contents: []byte("db.local")},
+		{Path: "app/port", Mode: 0400, Contents: []byte("5432")},
+	}
+	if !reflect.DeepEqual(renamed, expected) {
+		t.Fatalf("expected files: %v, got: %v", expected, renamed)
+	}
+	if files[0].Path != "projects/123/secrets/db-password/versions/latest" {
+		t.Fatalf("expected the fetched files to be unchanged, got: %v", files[0].Path)
+	}
+
+	if _, _, err := applyMountedObjectFiles(files, []*v1alpha1.MountedObject{
+		{ObjectName: "projects/123/secrets/db-password/versions/latest", FileName: "db-user"},
+	}); err == nil {
+		t.Fatalf("expected err for file name used by another file, got nil")
+	}
+}
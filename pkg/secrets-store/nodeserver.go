@@ -21,21 +21,34 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"os"
-	"os/exec"
+	"path/filepath"
 	"runtime"
+	"strings"
+	"time"
 
 	"github.com/container-storage-interface/spec/lib/go/csi"
 
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/secrets-store-csi-driver/apis/v1alpha1"
+	"sigs.k8s.io/secrets-store-csi-driver/controllers"
 	csicommon "sigs.k8s.io/secrets-store-csi-driver/pkg/csi-common"
+	"sigs.k8s.io/secrets-store-csi-driver/pkg/sandbox"
+	"sigs.k8s.io/secrets-store-csi-driver/pkg/util/fileutil"
 	version "sigs.k8s.io/secrets-store-csi-driver/pkg/version"
+	providerv1alpha1 "sigs.k8s.io/secrets-store-csi-driver/provider/v1alpha1"
 
 	log "github.com/sirupsen/logrus"
 	"golang.org/x/net/context"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/utils/mount"
 )
 
@@ -47,27 +60,116 @@ type nodeServer struct {
 	reporter               StatsReporter
 	nodeID                 string
 	client                 client.Client
+	kubeClient             kubernetes.Interface
 	grpcSupportedProviders map[string]bool
+	providerClients        *PluginClientBuilder
+	providerSandbox        sandbox.Config
+	mountCache             *mountCache
+	retryPolicy            RetryPolicy
+	providerTimeout        time.Duration
+	maxFileSize            int64
+	providerCallLimiter    providerCallLimiter
+	// mountPool bounds the parallel mounts and serializes the requests of
+	// each volume
+	mountPool *mountPool
+	// mountFlights deduplicates the retries of the mounts in progress
+	mountFlights *mountFlights
+	// fetchFlights shares the contents fetched for the pods that mount the
+	// same contents at the same time
+	fetchFlights *fetchFlights
+	// serviceAccountTokens are the latest service account tokens passed by
+	// the kubelet for the mounted volumes
+	serviceAccountTokens *serviceAccountTokens
+	// mountTimeout is the deadline of NodePublishVolume, split between the
+	// fetch and the write phases
+	mountTimeout MountTimeout
+	// tmpfsSize is the size limit in bytes of the tmpfs mounted for each
+	// volume, the tmpfs isn't limited if zero
+	tmpfsSize int64
+	// volumeQuota limits the total size and the number of files of a volume
+	volumeQuota VolumeQuota
+	// tmpfsBacked returns true if the target path is on a tmpfs file system
+	tmpfsBacked func(path string) (bool, error)
+	// fsGroupPolicy is FSGroupPolicyFile if the mounted files are owned by
+	// the fsGroup of the pod
+	fsGroupPolicy string
+	// seLinuxContext is true if the SELinux context of the tmpfs is derived
+	// from the SELinux options of the pod
+	seLinuxContext bool
+	// seLinuxEnabled returns true if SELinux is enabled on the node
+	seLinuxEnabled func() bool
+	// rotationEnabled is true if the mounted contents are rotated, so the
+	// containers that mount the volumes with subPath are warned about
+	rotationEnabled bool
+	// allowedProviders are the providers the driver is allowed to call, all
+	// providers are allowed if nil
+	allowedProviders map[string]bool
+	// auditLog records the object versions delivered to the volumes, nothing
+	// is recorded if nil
+	auditLog      *AuditLog
+	eventRecorder record.EventRecorder
 }
 
 const (
-	permission               os.FileMode = 0644
-	csipodname                           = "csi.storage.k8s.io/pod.name"
-	csipodnamespace                      = "csi.storage.k8s.io/pod.namespace"
-	csipoduid                            = "csi.storage.k8s.io/pod.uid"
-	csipodsa                             = "csi.storage.k8s.io/serviceAccount.name"
-	secretProviderClassField             = "secretProviderClass"
+	permission                      os.FileMode = 0644
+	csipodname                                  = "csi.storage.k8s.io/pod.name"
+	csipodnamespace                             = "csi.storage.k8s.io/pod.namespace"
+	csipoduid                                   = "csi.storage.k8s.io/pod.uid"
+	csipodsa                                    = "csi.storage.k8s.io/serviceAccount.name"
+	csipodsatokens                              = "csi.storage.k8s.io/serviceAccount.tokens"
+	secretProviderClassField                    = "secretProviderClass"
+	clusterSecretProviderClassField             = "clusterSecretProviderClass"
 )
 
-func (ns *nodeServer) NodePublishVolume(ctx context.Context, req *csi.NodePublishVolumeRequest) (npvr *csi.NodePublishVolumeResponse, err error) {
+// NodePublishVolume mounts the volume on a worker of the mount pool once the
+// other requests of the volume completed. The retries of a mount in progress
+// wait for its result instead of mounting the volume again.
+func (ns *nodeServer) NodePublishVolume(ctx context.Context, req *csi.NodePublishVolumeRequest) (*csi.NodePublishVolumeResponse, error) {
+	key := volumeKey(req.GetVolumeId(), req.GetTargetPath())
+	npvr, shared, err := ns.mountFlights.do(ctx, key, func(ctx context.Context) (*csi.NodePublishVolumeResponse, error) {
+		unlock, err := ns.mountPool.lockVolume(ctx, key)
+		if err != nil {
+			return nil, status.Errorf(codes.Aborted, "an operation is already in progress for volume %s, err: %v", req.GetVolumeId(), err)
+		}
+		defer unlock()
+		var npvr *csi.NodePublishVolumeResponse
+		var publishErr error
+		if err = ns.mountPool.waitWorker(ctx, func() {
+			npvr, publishErr = ns.publishVolume(ctx, req)
+		}); err != nil {
+			return nil, status.Errorf(codes.Aborted, "failed to wait for a mount worker for volume %s, err: %v", req.GetVolumeId(), err)
+		}
+		return npvr, publishErr
+	})
+	if ctx.Err() != nil && err == ctx.Err() {
+		code := codes.DeadlineExceeded
+		if err == context.Canceled {
+			code = codes.Canceled
+		}
+		return nil, status.Errorf(code, "mount of volume %s is still in progress, the retries wait for its result, err: %v", req.GetVolumeId(), err)
+	}
+	if shared {
+		log.Infof("NodePublishVolume: attached to the mount in progress of volume %s", req.GetVolumeId())
+	}
+	return npvr, err
+}
+
+// publishVolume mounts the volume, writes the contents fetched from the
+// providers to the target path and creates the secret provider class pod status
+func (ns *nodeServer) publishVolume(ctx context.Context, req *csi.NodePublishVolumeRequest) (npvr *csi.NodePublishVolumeResponse, err error) {
 	var parameters map[string]string
 	var providerName string
 	var podName, podNamespace, podUID string
 	var targetPath string
 	var mounted bool
+	var spc *v1alpha1.SecretProviderClass
+	var cached bool
 	errorReason := FailedToMount
 
 	defer func() {
+		if spc != nil {
+			ns.updateMountConditions(ctx, spc, providerName, podName, podNamespace, errorReason, cached, err)
+		}
 		if err != nil {
 			// if there is an error at any stage during node publish volume and if the path
 			// has already been mounted, unmount the target path so the next time kubelet calls
@@ -76,7 +178,17 @@ func (ns *nodeServer) NodePublishVolume(ctx context.Context, req *csi.NodePublis
 				log.Infof("unmounting target path %s as node publish volume failed", targetPath)
 				ns.mounter.Unmount(targetPath)
 			}
+			// the tokens are only kept for the mounted volumes
+			if targetPath != "" {
+				ns.serviceAccountTokens.delete(targetPath)
+			}
 			ns.reporter.reportNodePublishErrorCtMetric(providerName, errorReason)
+			if errorReason == IncompatibleProviderVersion || errorReason == IncompatibleDriverVersion {
+				ns.reporter.reportIncompatibleVersionCtMetric(providerName, errorReason)
+			}
+			if podEventReasons[errorReason] {
+				ns.recordPodEvent(podName, podNamespace, podUID, corev1.EventTypeWarning, errorReason, err.Error())
+			}
 			return
 		}
 		ns.reporter.reportNodePublishCtMetric(providerName)
@@ -96,6 +208,11 @@ func (ns *nodeServer) NodePublishVolume(ctx context.Context, req *csi.NodePublis
 		return nil, status.Error(codes.InvalidArgument, "Volume attributes missing in request")
 	}
 
+	// the contents are fetched from the providers within the fetch context, the
+	// rest of the mount timeout is left for writing the files
+	mountCtx, fetchCtx, cancel := ns.mountTimeout.contexts(ctx)
+	defer cancel()
+
 	targetPath = req.GetTargetPath()
 	volumeID := req.GetVolumeId()
 	attrib := req.GetVolumeContext()
@@ -108,7 +225,17 @@ func (ns *nodeServer) NodePublishVolume(ctx context.Context, req *csi.NodePublis
 		return nil, status.Errorf(codes.Internal, "Could not mount target %q: %v", targetPath, err)
 	}
 	if mounted {
-		log.Infof("NodePublishVolume: %s is already mounted", targetPath)
+		// the kubelet republishes the mounted volumes periodically since the
+		// CSIDriver requires republish, the contents aren't mounted again but
+		// the refreshed service account tokens are used by the rotation
+		if tokens := attrib[csipodsatokens]; len(tokens) > 0 {
+			if refreshed, err := ns.serviceAccountTokens.set(targetPath, tokens); err != nil {
+				log.Warningf("NodePublishVolume: failed to refresh service account tokens of %s, err: %v", targetPath, err)
+			} else if refreshed {
+				log.Infof("NodePublishVolume: refreshed service account tokens of %s", targetPath)
+			}
+		}
+		log.Debugf("NodePublishVolume: %s is already mounted", targetPath)
 		return &csi.NodePublishVolumeResponse{}, nil
 	}
 
@@ -116,6 +243,7 @@ func (ns *nodeServer) NodePublishVolume(ctx context.Context, req *csi.NodePublis
 		targetPath, volumeID, attrib, mountFlags)
 
 	secretProviderClass := attrib[secretProviderClassField]
+	clusterSecretProviderClass := attrib[clusterSecretProviderClassField]
 	providerName = attrib["providerName"]
 	podName = attrib[csipodname]
 	podNamespace = attrib[csipodnamespace]
@@ -132,12 +260,25 @@ func (ns *nodeServer) NodePublishVolume(ctx context.Context, req *csi.NodePublis
 		return &csi.NodePublishVolumeResponse{}, nil
 	}
 
+	var spcKind string
+	if clusterSecretProviderClass != "" {
+		if secretProviderClass != "" {
+			return nil, status.Error(codes.InvalidArgument, "secretProviderClass and clusterSecretProviderClass are mutually exclusive")
+		}
+		secretProviderClass = clusterSecretProviderClass
+		spcKind = v1alpha1.ClusterSecretProviderClassKind
+	}
 	if secretProviderClass == "" {
 		return nil, fmt.Errorf("secretProviderClass is not set")
 	}
 
-	spc, err := getSecretProviderItem(ctx, ns.client, secretProviderClass, podNamespace)
+	spc, err = getSecretProviderItem(ctx, ns.client, secretProviderClass, spcKind, podNamespace)
 	if err != nil {
+		spc = nil
+		if errors.Is(err, controllers.ErrNamespaceNotSelected) {
+			errorReason = NamespaceNotSelected
+			return nil, status.Error(codes.PermissionDenied, err.Error())
+		}
 		errorReason = SecretProviderClassNotFound
 		return nil, err
 	}
@@ -146,6 +287,54 @@ func (ns *nodeServer) NodePublishVolume(ctx context.Context, req *csi.NodePublis
 		return nil, err
 	}
 	providerName = provider
+	if err = ns.checkProvidersAllowed(spc); err != nil {
+		errorReason = ProviderNotAllowed
+		return nil, err
+	}
+	// the pod of the volume context is fetched at most once, by the first
+	// step of the mount that needs it
+	var pod *corev1.Pod
+	getPod := func() (*corev1.Pod, error) {
+		if pod != nil {
+			return pod, nil
+		}
+		p, err := ns.kubeClient.CoreV1().Pods(podNamespace).Get(podName, metav1.GetOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get pod %s/%s, err: %v", podNamespace, podName, err)
+		}
+		pod = p
+		return pod, nil
+	}
+	if controllers.RestrictsPods(spc) {
+		if _, err = getPod(); err != nil {
+			return nil, err
+		}
+		if err = controllers.CheckPodAllowed(spc, pod); err != nil {
+			if errors.Is(err, controllers.ErrPodNotAllowed) {
+				errorReason = PodNotAllowed
+				return nil, status.Error(codes.PermissionDenied, err.Error())
+			}
+			return nil, err
+		}
+	}
+	if err = validateMountedObjects(spc.Spec.MountedObjects); err != nil {
+		errorReason = InvalidMountedObjects
+		return nil, status.Errorf(codes.InvalidArgument, "invalid mounted objects in secretproviderclass %s/%s: %v", podNamespace, secretProviderClass, err)
+	}
+	if err = validateOutputFiles(spc.Spec.OutputFiles); err != nil {
+		errorReason = InvalidOutputFiles
+		return nil, status.Errorf(codes.InvalidArgument, "invalid output files in secretproviderclass %s/%s: %v", podNamespace, secretProviderClass, err)
+	}
+	if hasParameterTemplates(spc) {
+		if _, err = getPod(); err == nil {
+			spc, err = renderParameterTemplates(spc, podParameterTemplateData(pod))
+		}
+		if err != nil {
+			errorReason = InvalidProviderParameters
+			return nil, status.Errorf(codes.InvalidArgument, "invalid parameters in secretproviderclass %s/%s: %v", podNamespace, secretProviderClass, err)
+		}
+	}
+
 	parameters, err = getParametersFromSPC(spc)
 	if err != nil {
 		return nil, err
@@ -154,17 +343,21 @@ func (ns *nodeServer) NodePublishVolume(ctx context.Context, req *csi.NodePublis
 	parameters[csipodnamespace] = attrib[csipodnamespace]
 	parameters[csipoduid] = attrib[csipoduid]
 	parameters[csipodsa] = attrib[csipodsa]
+	// the service account tokens are only set if the CSIDriver requests them
+	if tokens := attrib[csipodsatokens]; len(tokens) > 0 {
+		if _, err = ns.serviceAccountTokens.set(targetPath, tokens); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid service account tokens in volume context, err: %v", err)
+		}
+		parameters[csipodsatokens] = tokens
+	}
 
-	// ensure it's read-only
-	if !req.GetReadonly() {
+	// ensure it's read-only, the kubelet doesn't set readonly for the volumes
+	// provisioned for the claims with a read only access mode, e.g. the generic
+	// ephemeral volumes
+	if !req.GetReadonly() && !readerOnlyAccessMode(req.GetVolumeCapability().GetAccessMode()) {
 		return nil, status.Error(codes.InvalidArgument, "Readonly is not true in request")
 	}
 
-	parametersStr, err := json.Marshal(parameters)
-	if err != nil {
-		log.Errorf("failed to marshal parameters, err: %v for pod: %s/%s", err, podNamespace, podName)
-		return nil, err
-	}
 	secretStr, err := json.Marshal(secrets)
 	if err != nil {
 		log.Errorf("failed to marshal secrets, err: %v for pod: %s/%s", err, podNamespace, podName)
@@ -178,29 +371,466 @@ func (ns *nodeServer) NodePublishVolume(ctx context.Context, req *csi.NodePublis
 
 	// mount before providers can write content to it
 	// In linux Mount tmpfs mounts tmpfs to targetPath
-	// In windows Mount tmpfs checks if the targetPath exists and if not, will create the target path
-	// https://github.com/kubernetes/utils/blob/master/mount/mount_windows.go#L68-L71
-	err = ns.mounter.Mount("tmpfs", targetPath, "tmpfs", []string{})
+	// In windows Mount tmpfs creates the targetPath directory, see directoryMounter
+	// the mounted files are labeled with the SELinux context of the pod, so
+	// the containers can read them on the nodes that enforce SELinux
+	if ns.podSELinuxContext(mountFlags) {
+		if _, err = getPod(); err != nil {
+			return nil, err
+		}
+	}
+	mountOptions := ns.seLinuxMountOptions(mountFlags, pod)
+	if ns.tmpfsSize > 0 {
+		mountOptions = append(mountOptions, fmt.Sprintf("size=%d", ns.tmpfsSize))
+	}
+	err = ns.mounter.Mount("tmpfs", targetPath, "tmpfs", mountOptions)
 	if err != nil {
 		errorReason = FailedToMount
 		log.Errorf("mount err: %v for pod: %s/%s", err, podNamespace, podName)
 		return nil, err
 	}
 	mounted = true
+	// the secrets are never written to the node disks, so the mount fails if
+	// the target path isn't backed by the tmpfs
+	tmpfs, err := ns.tmpfsBacked(targetPath)
+	if err != nil {
+		errorReason = FailedToMount
+		return nil, fmt.Errorf("failed to check the file system of target path %s, err: %v", targetPath, err)
+	}
+	if !tmpfs {
+		errorReason = TargetPathNotTmpfs
+		return nil, fmt.Errorf("target path %s of pod %s/%s is not backed by tmpfs", targetPath, podNamespace, podName)
+	}
+
+	// reuse the contents mounted for a previous request if the cache is enabled
+	// in the secret provider class. The contents are also cached to be served
+	// when the providers are unavailable if the driver keeps stale contents.
+	var cacheKey string
+	var cacheTTL time.Duration
+	if spc.Spec.CacheTTL != nil {
+		cacheTTL = spc.Spec.CacheTTL.Duration
+	}
+	if cacheTTL > 0 || ns.mountCache.maxStaleAge > 0 {
+		if cacheKey, err = mountCacheKey(string(spc.UID), spc.Generation, parameters, secrets); err != nil {
+			return nil, err
+		}
+	}
 	var objectVersions map[string]string
-	if objectVersions, errorReason, err = ns.mountSecretsStoreObjectContent(ctx, providerName, string(parametersStr), string(secretStr), targetPath, string(permissionStr)); err != nil {
-		return nil, fmt.Errorf("failed to mount secrets store objects for pod %s/%s, err: %v", podNamespace, podName, err)
+	var expiry time.Time
+	// fetchTime is the time the mounted contents were fetched from the
+	// providers, the time they were cached for the cached contents
+	fetchTime := time.Now()
+	if entry, ok := ns.mountCache.get(cacheKey); ok {
+		log.Infof("using cached contents of secretproviderclass %s/%s for pod %s/%s", podNamespace, secretProviderClass, podNamespace, podName)
+		if err = fileutil.WritePayloads(targetPath, entry.files); err != nil {
+			errorReason = FailedToWriteFiles
+			return nil, fmt.Errorf("failed to write cached contents for pod %s/%s, err: %v", podNamespace, podName, err)
+		}
+		objectVersions = entry.objectVersions
+		expiry = entry.objectsExpiry
+		fetchTime = entry.mountTime
+		cached = true
+	} else {
+		mount := func() fetchResult {
+			return ns.mountProviders(fetchCtx, spc, providerName, parameters, attrib, string(secretStr), targetPath, string(permissionStr), podName, podNamespace, podUID)
+		}
+		var result fetchResult
+		if spc.Spec.SharedFetch {
+			// the pods that mount the class at the same time with the same
+			// parameters share the contents fetched from the providers
+			var fetchKey string
+			if fetchKey, err = mountCacheKey(string(spc.UID), spc.Generation, parameters, secrets); err != nil {
+				return nil, err
+			}
+			result = ns.sharedMountProviders(fetchCtx, fetchKey, providerName, targetPath, podName, podNamespace, mount)
+		} else {
+			result = mount()
+		}
+		objectVersions, expiry, providerName, errorReason, err = result.objectVersions, result.expiry, result.providerName, result.errorReason, result.err
+		if err != nil {
+			// the contents previously mounted for the class are served if the
+			// providers are unavailable, so a backend outage doesn't block
+			// the pods restarted on the node
+			entry, ok := ns.mountCache.getStale(cacheKey)
+			if !ok || !isProviderUnavailableReason(errorReason) {
+				return nil, err
+			}
+			log.Warningf("providers of secretproviderclass %s/%s are unavailable, using contents cached at %v for pod %s/%s, err: %v", podNamespace, secretProviderClass, entry.mountTime.UTC().Format(time.RFC3339), podNamespace, podName, err)
+			ns.recordPodEvent(podName, podNamespace, podUID, corev1.EventTypeWarning, CachedContentServed, fmt.Sprintf("providers are unavailable, serving the contents of secretproviderclass %s fetched at %v, err: %v", secretProviderClass, entry.mountTime.UTC().Format(time.RFC3339), err))
+			ns.reporter.reportCachedContentServedCtMetric(providerName, podNamespace, cachedContentMount)
+			// remove the contents partially written by the providers
+			if err = removeMountedFiles(targetPath); err != nil {
+				errorReason = FailedToWriteFiles
+				return nil, fmt.Errorf("failed to clean target path %s for cached contents, err: %v", targetPath, err)
+			}
+			if err = fileutil.WritePayloads(targetPath, entry.files); err != nil {
+				errorReason = FailedToWriteFiles
+				return nil, fmt.Errorf("failed to write cached contents for pod %s/%s, err: %v", podNamespace, podName, err)
+			}
+			errorReason = FailedToMount
+			objectVersions = entry.objectVersions
+			expiry = entry.objectsExpiry
+			fetchTime = entry.mountTime
+			cached = true
+		} else if len(cacheKey) > 0 {
+			files, err := fileutil.ReadPayloads(targetPath)
+			if err != nil {
+				log.Warningf("failed to cache mounted contents for pod %s/%s, err: %v", podNamespace, podName, err)
+			} else {
+				ns.mountCache.set(cacheKey, objectVersions, files, cacheTTL, expiry)
+			}
+		}
+	}
+
+	// the mounted files are moved to a data directory, so they can be
+	// rotated at once by swapping the data directory symlink
+	dataDir, err := fileutil.NewDataDir(targetPath)
+	if err != nil {
+		errorReason = FailedToWriteFiles
+		return nil, fmt.Errorf("failed to create data directory for pod %s/%s, err: %v", podNamespace, podName, err)
+	}
+	if _, errorReason, err = writeOutputFiles(dataDir, spc.Spec.OutputFiles, false); err != nil {
+		return nil, fmt.Errorf("failed to write output files for pod %s/%s, err: %v", podNamespace, podName, err)
+	}
+	if spc.Spec.WriteMetadata {
+		if err = fileutil.WriteMetadata(dataDir, mountedObjectsMetadata(objectVersions, fetchTime)); err != nil {
+			errorReason = FailedToWriteFiles
+			return nil, fmt.Errorf("failed to write metadata for pod %s/%s, err: %v", podNamespace, podName, err)
+		}
+	}
+	if spc.Spec.WriteChecksums {
+		if err = fileutil.WriteChecksums(dataDir); err != nil {
+			errorReason = FailedToWriteFiles
+			return nil, fmt.Errorf("failed to write checksums for pod %s/%s, err: %v", podNamespace, podName, err)
+		}
+	}
+	if err = ns.volumeQuota.validate(dataDir); err != nil {
+		errorReason = VolumeQuotaExceeded
+		return nil, status.Errorf(codes.ResourceExhausted, "contents mounted for pod %s/%s exceed the volume quota, err: %v", podNamespace, podName, err)
+	}
+	// the fsGroup of the pod is only used with the File fsGroup policy
+	if ns.fsGroupPolicy == FSGroupPolicyFile {
+		if _, err = getPod(); err != nil {
+			return nil, err
+		}
+	}
+	uid, gid := ns.fileOwner(spc, pod)
+	if err = fileutil.SetOwnership(dataDir, uid, gid); err != nil {
+		errorReason = FailedToWriteFiles
+		return nil, fmt.Errorf("failed to set the owner of the mounted files for pod %s/%s, err: %v", podNamespace, podName, err)
+	}
+	// the files aren't published once the mount timed out, as the kubelet
+	// retries the mount
+	if reason, timedOut := ns.mountTimeout.phaseTimeout(mountCtx, mountPhaseWrite); timedOut {
+		errorReason = MountWriteTimeout
+		return nil, status.Errorf(codes.DeadlineExceeded, "failed to mount secrets store objects for pod %s/%s, %s", podNamespace, podName, reason)
+	}
+	if err = fileutil.PublishDataDir(targetPath, dataDir); err != nil {
+		errorReason = FailedToWriteFiles
+		return nil, fmt.Errorf("failed to publish mounted files for pod %s/%s, err: %v", podNamespace, podName, err)
+	}
+	if err = writeDataVersion(targetPath); err != nil {
+		errorReason = FailedToWriteFiles
+		return nil, fmt.Errorf("failed to write data version for pod %s/%s, err: %v", podNamespace, podName, err)
 	}
 
 	// create the secret provider class pod status object
-	if err = createSecretProviderClassPodStatus(ctx, ns.client, podName, podNamespace, podUID, secretProviderClass, targetPath, ns.nodeID, true, objectVersions); err != nil {
+	if err = createSecretProviderClassPodStatus(ctx, ns.client, podName, podNamespace, podUID, secretProviderClass, spcKind, targetPath, ns.nodeID, true, objectVersions, expiry, spc.Generation); err != nil {
 		return nil, fmt.Errorf("failed to create secret provider class pod status for pod %s/%s, err: %v", podNamespace, podName, err)
 	}
+	ns.recordAudit(auditEventMount, podName, podNamespace, podUID, secretProviderClass, providerName, targetPath, objectVersions)
+	// failing to check the subPath mounts doesn't fail the mount
+	if ns.rotationEnabled {
+		if _, err := getPod(); err != nil {
+			log.Errorf("failed to check the subPath mounts, err: %v", err)
+		} else {
+			ns.warnSubPathMounts(pod, targetPath)
+		}
+	}
 
 	return &csi.NodePublishVolumeResponse{}, nil
 }
 
-func (ns *nodeServer) NodeUnpublishVolume(ctx context.Context, req *csi.NodeUnpublishVolumeRequest) (nuvr *csi.NodeUnpublishVolumeResponse, err error) {
+// warnSubPathMounts records a warning event on the pod if containers of the
+// pod mount the volume of the target path with subPath, as the rotated
+// contents aren't visible to them
+func (ns *nodeServer) warnSubPathMounts(pod *corev1.Pod, targetPath string) {
+	// the target path is <kubelet root>/pods/<uid>/volumes/kubernetes.io~csi/<volume>/mount
+	volumeName := filepath.Base(filepath.Dir(targetPath))
+	if containers := controllers.SubPathContainers(pod, volumeName); len(containers) > 0 {
+		ns.recordPodEvent(pod.Name, pod.Namespace, string(pod.UID), corev1.EventTypeWarning, SubPathMount, fmt.Sprintf("containers %s mount volume %s with subPath, the rotated contents of the volume aren't visible with subPath", strings.Join(containers, ", "), volumeName))
+	}
+}
+
+// checkProvidersAllowed returns an error if the primary, fallback or additional
+// providers of the secret provider class aren't in the providers allowlist
+func (ns *nodeServer) checkProvidersAllowed(spc *v1alpha1.SecretProviderClass) error {
+	if ns.allowedProviders == nil {
+		return nil
+	}
+	providers := []v1alpha1.Provider{spc.Spec.Provider}
+	if spc.Spec.Fallback != nil && len(spc.Spec.Fallback.Provider) > 0 {
+		providers = append(providers, spc.Spec.Fallback.Provider)
+	}
+	for _, additionalProvider := range spc.Spec.AdditionalProviders {
+		providers = append(providers, additionalProvider.Provider)
+	}
+	for _, provider := range providers {
+		if !ns.allowedProviders[string(provider)] {
+			return status.Errorf(codes.PermissionDenied, "provider %s used by secretproviderclass %s/%s is not in the providers allowlist of the driver", provider, spc.Namespace, spc.Name)
+		}
+	}
+	return nil
+}
+
+// mountProviders mounts the contents of the primary provider, or of the
+// fallback provider if the primary provider failed, and of the additional
+// providers to the target path
+func (ns *nodeServer) mountProviders(ctx context.Context, spc *v1alpha1.SecretProviderClass, providerName string, parameters, attrib map[string]string, secrets, targetPath, permission, podName, podNamespace, podUID string) fetchResult {
+	objectVersions, expiry, errorReason, err := ns.mountProvider(ctx, spc, providerName, parameters, secrets, targetPath, permission, podName, podNamespace)
+	// the fallback provider isn't called once the fetch phase timed out
+	if err != nil && ctx.Err() == nil && spc.Spec.Fallback != nil {
+		fallbackProvider := providerName
+		if len(spc.Spec.Fallback.Provider) > 0 {
+			fallbackProvider = string(spc.Spec.Fallback.Provider)
+		}
+		log.Warningf("failed to mount secrets store objects for pod %s/%s with provider %s, using fallback provider %s, err: %v", podNamespace, podName, providerName, fallbackProvider, err)
+		ns.recordPodEvent(podName, podNamespace, podUID, corev1.EventTypeWarning, errorReason, fmt.Sprintf("provider %s failed, using fallback provider %s, err: %v", providerName, fallbackProvider, err))
+		// remove the contents partially written by the primary provider
+		if err = removeMountedFiles(targetPath); err != nil {
+			return fetchResult{providerName: providerName, errorReason: FailedToWriteFiles, err: fmt.Errorf("failed to clean target path %s for fallback provider, err: %v", targetPath, err)}
+		}
+		providerName = fallbackProvider
+		objectVersions, expiry, errorReason, err = ns.mountProvider(ctx, spc, providerName, providerParameters(spc.Spec.Fallback.Parameters, attrib), secrets, targetPath, permission, podName, podNamespace)
+	}
+	if err != nil {
+		if reason, timedOut := ns.mountTimeout.phaseTimeout(ctx, mountPhaseFetch); timedOut {
+			errorReason = MountFetchTimeout
+			err = status.Errorf(codes.DeadlineExceeded, "failed to mount secrets store objects for pod %s/%s, %s, err: %v", podNamespace, podName, reason, err)
+		}
+	}
+	for i := 0; err == nil && i < len(spc.Spec.AdditionalProviders); i++ {
+		additionalProvider := spc.Spec.AdditionalProviders[i]
+		var additionalObjectVersions map[string]string
+		var additionalExpiry time.Time
+		additionalObjectVersions, additionalExpiry, errorReason, err = ns.mountAdditionalProvider(ctx, spc, i, additionalProvider, attrib, secrets, targetPath, permission, podName, podNamespace)
+		if err != nil {
+			if reason, timedOut := ns.mountTimeout.phaseTimeout(ctx, mountPhaseFetch); timedOut {
+				errorReason = MountFetchTimeout
+				err = status.Errorf(codes.DeadlineExceeded, "failed to mount secrets store objects for pod %s/%s, %s, err: %v", podNamespace, podName, reason, err)
+			}
+			break
+		}
+		expiry = earliestExpiry(expiry, additionalExpiry)
+		if objectVersions == nil && len(additionalObjectVersions) > 0 {
+			objectVersions = make(map[string]string, len(additionalObjectVersions))
+		}
+		for id, version := range additionalObjectVersions {
+			objectVersions[id] = version
+		}
+	}
+	return fetchResult{objectVersions: objectVersions, expiry: expiry, providerName: providerName, errorReason: errorReason, err: err}
+}
+
+// sharedMountProviders writes the contents fetched for another pod to the
+// target path if a fetch of the same contents is in progress. Otherwise it
+// mounts the contents from the providers and shares them with the pods mounted
+// in the meantime.
+func (ns *nodeServer) sharedMountProviders(ctx context.Context, key, providerName, targetPath, podName, podNamespace string, mount func() fetchResult) fetchResult {
+	var mounted fetchResult
+	result, shared, err := ns.fetchFlights.do(ctx, key, func() fetchResult {
+		mounted = mount()
+		if mounted.err != nil {
+			return mounted
+		}
+		files, err := fileutil.ReadPayloads(targetPath)
+		if err != nil {
+			log.Warningf("failed to share mounted contents of pod %s/%s, err: %v", podNamespace, podName, err)
+			return fetchResult{providerName: mounted.providerName, errorReason: FailedToWriteFiles, err: fmt.Errorf("failed to read the contents mounted for another pod, err: %v", err)}
+		}
+		result := mounted
+		result.files = files
+		return result
+	})
+	if !shared {
+		return mounted
+	}
+	if err != nil {
+		if reason, timedOut := ns.mountTimeout.phaseTimeout(ctx, mountPhaseFetch); timedOut {
+			return fetchResult{providerName: providerName, errorReason: MountFetchTimeout, err: status.Errorf(codes.DeadlineExceeded, "failed to mount secrets store objects for pod %s/%s, %s, err: %v", podNamespace, podName, reason, err)}
+		}
+		return fetchResult{providerName: providerName, errorReason: FailedToMount, err: fmt.Errorf("failed to wait for the contents fetched for another pod, err: %v", err)}
+	}
+	if result.err != nil {
+		return result
+	}
+	log.Infof("using the contents fetched for another pod with provider %s for pod %s/%s", result.providerName, podNamespace, podName)
+	if err = fileutil.WritePayloads(targetPath, result.files); err != nil {
+		return fetchResult{providerName: result.providerName, errorReason: FailedToWriteFiles, err: fmt.Errorf("failed to write shared contents for pod %s/%s, err: %v", podNamespace, podName, err)}
+	}
+	return result
+}
+
+// mountProvider mounts the secrets store objects from the provider to the target
+// path and validates the mounted contents. It returns the object versions and
+// the earliest expiry of the mounted objects.
+func (ns *nodeServer) mountProvider(ctx context.Context, spc *v1alpha1.SecretProviderClass, providerName string, parameters map[string]string, secrets, targetPath, permission, podName, podNamespace string) (map[string]string, time.Time, string, error) {
+	// fail fast if the last health check reported the provider as unhealthy
+	// instead of timing out while the volume is being mounted
+	if healthy, message := ns.providerClients.IsHealthy(providerName); !healthy {
+		return nil, time.Time{}, ProviderUnhealthy, status.Errorf(codes.Unavailable, "provider %s is unhealthy, err: %s", providerName, message)
+	}
+	// reject parameters that don't match the schema of the provider instead
+	// of failing in the provider, e.g. because of a misspelled parameter key
+	if err := ns.validateProviderParameters(ctx, providerName, parameters); err != nil {
+		return nil, time.Time{}, InvalidProviderParameters, status.Errorf(codes.InvalidArgument, "invalid parameters in secretproviderclass %s/%s for provider %s: %v", spc.Namespace, spc.Name, providerName, err)
+	}
+
+	parametersStr, err := json.Marshal(parameters)
+	if err != nil {
+		log.Errorf("failed to marshal parameters, err: %v for pod: %s/%s", err, podNamespace, podName)
+		return nil, time.Time{}, FailedToMount, err
+	}
+
+	providerCtx, cancel, providerTimeout := ns.providerContext(ctx, spc)
+	objectVersions, expiry, errorReason, err := ns.mountSecretsStoreObjectContent(providerCtx, providerName, string(parametersStr), secrets, targetPath, permission, ns.retryPolicy.withOverrides(spc.Spec.RetryPolicy))
+	timedOut := providerCtx.Err() == context.DeadlineExceeded && ctx.Err() == nil
+	cancel()
+	if err != nil && timedOut {
+		return nil, time.Time{}, ProviderTimeout, status.Errorf(codes.DeadlineExceeded, "failed to mount secrets store objects for pod %s/%s, provider %s didn't respond within %v, err: %v", podNamespace, podName, providerName, providerTimeout, err)
+	}
+	if err != nil {
+		return nil, time.Time{}, errorReason, fmt.Errorf("failed to mount secrets store objects for pod %s/%s, err: %v", podNamespace, podName, err)
+	}
+	if errorReason, err = applyMountedObjects(targetPath, spc.Spec.MountedObjects); err != nil {
+		return nil, time.Time{}, errorReason, fmt.Errorf("failed to apply the mounted objects of provider %s for pod %s/%s, err: %v", providerName, podNamespace, podName, err)
+	}
+	// reject empty mounts and files larger than the maximum file size,
+	// regardless of whether the driver or the provider wrote the files
+	if err = fileutil.ValidateTargetPath(targetPath, ns.maxFileSize); err != nil {
+		return nil, time.Time{}, InvalidProviderResponse, fmt.Errorf("invalid contents mounted by provider %s for pod %s/%s, err: %v", providerName, podNamespace, podName, err)
+	}
+	return objectVersions, expiry, "", nil
+}
+
+// fetchProvider fetches the secrets store objects from the provider without
+// writing them to the target path, e.g. to refresh the synced k8s secrets of a
+// volume that is no longer mounted. It returns the object versions, the
+// earliest expiry of the objects and the files returned by the provider.
+func (ns *nodeServer) fetchProvider(ctx context.Context, spc *v1alpha1.SecretProviderClass, providerName string, parameters map[string]string, secrets, targetPath, permission, podName, podNamespace string) (map[string]string, time.Time, []*providerv1alpha1.File, string, error) {
+	if healthy, message := ns.providerClients.IsHealthy(providerName); !healthy {
+		return nil, time.Time{}, nil, ProviderUnhealthy, status.Errorf(codes.Unavailable, "provider %s is unhealthy, err: %s", providerName, message)
+	}
+	if !ns.providerClients.HasProvider(providerName) {
+		return nil, time.Time{}, nil, FailedToMount, fmt.Errorf("provider %s doesn't use grpc, the contents can only be fetched from grpc providers", providerName)
+	}
+
+	parametersStr, err := json.Marshal(parameters)
+	if err != nil {
+		return nil, time.Time{}, nil, FailedToMount, err
+	}
+
+	providerCtx, cancel, providerTimeout := ns.providerContext(ctx, spc)
+	defer cancel()
+	var objectVersions map[string]string
+	var expiry time.Time
+	var files []*providerv1alpha1.File
+	errorReason, err := ns.callProvider(providerCtx, providerName, ns.retryPolicy.withOverrides(spc.Spec.RetryPolicy), func(client providerv1alpha1.CSIDriverProviderClient, capabilities ProviderCapabilities) (errorCode string, err error) {
+		objectVersions, expiry, files, errorCode, err = fetchContent(providerCtx, client, capabilities, newStreamLimits(ns.maxFileSize, ns.volumeQuota.MaxSize), string(parametersStr), secrets, targetPath, permission)
+		return errorCode, err
+	})
+	if err != nil && providerCtx.Err() == context.DeadlineExceeded && ctx.Err() == nil {
+		return nil, time.Time{}, nil, ProviderTimeout, status.Errorf(codes.DeadlineExceeded, "failed to fetch secrets store objects for pod %s/%s, provider %s didn't respond within %v, err: %v", podNamespace, podName, providerName, providerTimeout, err)
+	}
+	if err != nil {
+		return nil, time.Time{}, nil, errorReason, fmt.Errorf("failed to fetch secrets store objects for pod %s/%s, err: %v", podNamespace, podName, err)
+	}
+	if files, errorReason, err = applyMountedObjectFiles(files, spc.Spec.MountedObjects); err != nil {
+		return nil, time.Time{}, nil, errorReason, fmt.Errorf("failed to apply the mounted objects to the files fetched from provider %s for pod %s/%s, err: %v", providerName, podNamespace, podName, err)
+	}
+	for _, file := range files {
+		if ns.maxFileSize > 0 && int64(len(file.Contents)) > ns.maxFileSize {
+			return nil, time.Time{}, nil, InvalidProviderResponse, fmt.Errorf("invalid contents fetched from provider %s for pod %s/%s, file %s is larger than the maximum file size %d", providerName, podNamespace, podName, file.Path, ns.maxFileSize)
+		}
+	}
+	return objectVersions, expiry, files, "", nil
+}
+
+// providerContext returns the context of the provider calls for the secret
+// provider class, with the provider timeout of the secret provider class or
+// the driver, and the timeout. The context isn't timed out if the timeout is 0.
+func (ns *nodeServer) providerContext(ctx context.Context, spc *v1alpha1.SecretProviderClass) (context.Context, context.CancelFunc, time.Duration) {
+	providerTimeout := ns.providerTimeout
+	if spc.Spec.ProviderTimeout != nil {
+		providerTimeout = spc.Spec.ProviderTimeout.Duration
+	}
+	if providerTimeout > 0 {
+		providerCtx, cancel := context.WithTimeout(ctx, providerTimeout)
+		return providerCtx, cancel, providerTimeout
+	}
+	providerCtx, cancel := context.WithCancel(ctx)
+	return providerCtx, cancel, providerTimeout
+}
+
+// mountAdditionalProvider mounts the secrets store objects from the additional
+// provider to a staging directory in the target path and moves the files to the
+// target path. The mount fails if a file with the same path was already mounted
+// by another provider.
+func (ns *nodeServer) mountAdditionalProvider(ctx context.Context, spc *v1alpha1.SecretProviderClass, index int, additionalProvider *v1alpha1.AdditionalProvider, attrib map[string]string, secrets, targetPath, permission, podName, podNamespace string) (map[string]string, time.Time, string, error) {
+	providerName := string(additionalProvider.Provider)
+	// the staging directory is created in the target path so the contents are
+	// never written outside of the tmpfs mount
+	stagingPath := filepath.Join(targetPath, fmt.Sprintf(".%s-%d", providerName, index))
+	if err := os.Mkdir(stagingPath, 0755); err != nil {
+		return nil, time.Time{}, FailedToWriteFiles, fmt.Errorf("failed to create staging directory for provider %s, err: %v", providerName, err)
+	}
+	defer os.RemoveAll(stagingPath)
+
+	objectVersions, expiry, errorReason, err := ns.mountProvider(ctx, spc, providerName, providerParameters(additionalProvider.Parameters, attrib), secrets, stagingPath, permission, podName, podNamespace)
+	if err != nil {
+		return nil, time.Time{}, errorReason, err
+	}
+
+	files, err := ioutil.ReadDir(stagingPath)
+	if err != nil {
+		return nil, time.Time{}, FailedToWriteFiles, fmt.Errorf("failed to list files mounted by provider %s, err: %v", providerName, err)
+	}
+	for _, file := range files {
+		if _, err := os.Lstat(filepath.Join(targetPath, file.Name())); err == nil {
+			return nil, time.Time{}, FilePathCollision, fmt.Errorf("file %s mounted by provider %s for pod %s/%s is already mounted by another provider", file.Name(), providerName, podNamespace, podName)
+		} else if !os.IsNotExist(err) {
+			return nil, time.Time{}, FailedToWriteFiles, err
+		}
+	}
+	for _, file := range files {
+		if err := os.Rename(filepath.Join(stagingPath, file.Name()), filepath.Join(targetPath, file.Name())); err != nil {
+			return nil, time.Time{}, FailedToWriteFiles, fmt.Errorf("failed to move file %s mounted by provider %s, err: %v", file.Name(), providerName, err)
+		}
+	}
+	return objectVersions, expiry, "", nil
+}
+
+// NodeUnpublishVolume unmounts the volume once the other requests of the volume
+// completed. The volumes are unmounted without waiting for a mount worker.
+func (ns *nodeServer) NodeUnpublishVolume(ctx context.Context, req *csi.NodeUnpublishVolumeRequest) (*csi.NodeUnpublishVolumeResponse, error) {
+	unlock, err := ns.mountPool.lockVolume(ctx, volumeKey(req.GetVolumeId(), req.GetTargetPath()))
+	if err != nil {
+		return nil, status.Errorf(codes.Aborted, "an operation is already in progress for volume %s, err: %v", req.GetVolumeId(), err)
+	}
+	defer unlock()
+	return ns.unpublishVolume(ctx, req)
+}
+
+// volumeKey returns the key of the requests of the volume at the target path.
+// The volume id of a pre-provisioned persistent volume is the same for all the
+// pods of the node using it, so the requests are keyed by the target path of
+// the pod as well.
+func volumeKey(volumeID, targetPath string) string {
+	return volumeID + ":" + targetPath
+}
+
+// unpublishVolume removes the mounted files and unmounts the target path
+func (ns *nodeServer) unpublishVolume(ctx context.Context, req *csi.NodeUnpublishVolumeRequest) (nuvr *csi.NodeUnpublishVolumeResponse, err error) {
 	var podUID string
 
 	defer func() {
@@ -220,8 +850,6 @@ func (ns *nodeServer) NodeUnpublishVolume(ctx context.Context, req *csi.NodeUnpu
 	}
 	targetPath := req.GetTargetPath()
 	volumeID := req.GetVolumeId()
-	files, err := getMountedFiles(targetPath)
-
 	if isMockTargetPath(targetPath) {
 		return &csi.NodeUnpublishVolumeResponse{}, nil
 	}
@@ -230,21 +858,13 @@ func (ns *nodeServer) NodeUnpublishVolume(ctx context.Context, req *csi.NodeUnpu
 	if len(podUID) == 0 {
 		return nil, status.Error(codes.InvalidArgument, "Cannot get podUID from Target path")
 	}
-	// remove files
-	if runtime.GOOS == "windows" {
-		for _, file := range files {
-			err = os.RemoveAll(file)
-			if err != nil {
-				log.Errorf("failed to remove file %s, err: %v for pod: %s", file, err, podUID)
-				return nil, status.Error(codes.Internal, err.Error())
-			}
-		}
-	}
+	// the windows mounter removes the mounted files when unmounting the target path
 	err = mount.CleanupMountPoint(targetPath, ns.mounter, false)
 	if err != nil {
 		log.Errorf("error cleaning and unmounting target path %s, err: %v for pod: %s", targetPath, err, podUID)
 		return nil, status.Error(codes.Internal, err.Error())
 	}
+	ns.serviceAccountTokens.delete(targetPath)
 
 	log.Debugf("targetPath %s volumeID %s has been unmounted for pod: %s", targetPath, volumeID, podUID)
 	return &csi.NodeUnpublishVolumeResponse{}, nil
@@ -274,52 +894,75 @@ func (ns *nodeServer) NodeUnstageVolume(ctx context.Context, req *csi.NodeUnstag
 	return &csi.NodeUnstageVolumeResponse{}, nil
 }
 
-func (ns *nodeServer) mountSecretsStoreObjectContent(ctx context.Context, providerName, attributes, secrets, targetPath, permission string) (map[string]string, string, error) {
+func (ns *nodeServer) mountSecretsStoreObjectContent(ctx context.Context, providerName, attributes, secrets, targetPath, permission string, retryPolicy RetryPolicy) (map[string]string, time.Time, string, error) {
 	if len(attributes) == 0 {
-		return nil, "", errors.New("missing attributes")
+		return nil, time.Time{}, "", errors.New("missing attributes")
 	}
 	if len(targetPath) == 0 {
-		return nil, "", errors.New("missing target path")
+		return nil, time.Time{}, "", errors.New("missing target path")
 	}
 	if len(permission) == 0 {
-		return nil, "", errors.New("missing file permissions")
+		return nil, time.Time{}, "", errors.New("missing file permissions")
 	}
 	// get provider volume path
 	providerVolumePath := ns.providerVolumePath
 	if providerVolumePath == "" {
-		return nil, "", fmt.Errorf("providers volume path not found. Set PROVIDERS_VOLUME_PATH")
+		return nil, time.Time{}, "", fmt.Errorf("providers volume path not found. Set PROVIDERS_VOLUME_PATH")
 	}
 
-	// if the provider supports and is running grpc server, then communicate with
-	// provider using the grpc client, otherwise fallback to invoking the provider
+	// if the provider has registered a socket in the providers directory (or is
+	// explicitly marked as grpc supported), communicate with the provider using
+	// the long-lived grpc client. Otherwise fallback to invoking the provider
 	// binary which is how it was initially implemented
 	_, exists := ns.grpcSupportedProviders[providerName]
-	if exists {
+	if exists || ns.providerClients.HasProvider(providerName) {
 		log.Infof("Using grpc client for provider: %s", providerName)
-		providerClient, err := newProviderClient(csiProviderName(providerName), ns.providerVolumePath)
-		if err != nil {
-			return nil, FailedToCreateProviderGRPCClient, fmt.Errorf("failed to create provider client, err: %+v", err)
-		}
-		return providerClient.MountContent(ctx, attributes, secrets, targetPath, permission)
+		var objectVersions map[string]string
+		var expiry time.Time
+		errorCode, err := ns.callProvider(ctx, providerName, retryPolicy, func(client providerv1alpha1.CSIDriverProviderClient, capabilities ProviderCapabilities) (errorCode string, err error) {
+			if capabilities.Streaming {
+				objectVersions, expiry, errorCode, err = mountContentStream(ctx, client, capabilities, newStreamLimits(ns.maxFileSize, ns.volumeQuota.MaxSize), attributes, secrets, targetPath, permission)
+			} else {
+				objectVersions, expiry, errorCode, err = mountContent(ctx, client, capabilities, attributes, secrets, targetPath, permission)
+			}
+			return errorCode, err
+		})
+		return objectVersions, expiry, errorCode, err
 	}
 
 	providerBinary := ns.getProviderPath(runtime.GOOS, providerName)
 	if _, err := os.Stat(providerBinary); err != nil {
-		return nil, ProviderBinaryNotFound, fmt.Errorf("failed to find provider binary %s, err: %v", providerName, err)
+		return nil, time.Time{}, ProviderBinaryNotFound, fmt.Errorf("failed to find provider binary %s, err: %v", providerName, err)
 	}
 
-	// check if minimum compatible provider version with current driver version is set
-	// if minimum version is not provided, skip check
-	if _, exists := ns.minProviderVersions[providerName]; !exists {
+	// the timeout applies to the version check and the mount operation so a
+	// provider binary that hangs can't block the volume mount indefinitely
+	if ns.providerSandbox.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, ns.providerSandbox.Timeout)
+		defer cancel()
+	}
+
+	// check if the provider is compatible with the driver and the driver is compatible with
+	// the minimum driver version required by the provider. If minimum compatible provider
+	// version is not provided, the provider version check is skipped.
+	minProviderVersion, exists := ns.minProviderVersions[providerName]
+	if !exists {
 		log.Warningf("minimum compatible %s provider version not set", providerName)
+	}
+	compatibility, err := version.CheckCompatibility(ctx, ns.providerSandbox, providerBinary, minProviderVersion, vendorVersion)
+	if err != nil {
+		if exists {
+			return nil, time.Time{}, "", err
+		}
+		// reporting the version is only required if the minimum provider version is set
+		log.Warningf("failed to check %s provider version compatibility, err: %+v", providerName, err)
 	} else {
-		// check if provider is compatible with driver
-		providerCompatible, err := version.IsProviderCompatible(ctx, providerBinary, ns.minProviderVersions[providerName])
-		if err != nil {
-			return nil, "", err
+		if !compatibility.ProviderCompatible {
+			return nil, time.Time{}, IncompatibleProviderVersion, fmt.Errorf("Minimum supported %s provider version with current driver is %s", providerName, minProviderVersion)
 		}
-		if !providerCompatible {
-			return nil, IncompatibleProviderVersion, fmt.Errorf("Minimum supported %s provider version with current driver is %s", providerName, ns.minProviderVersions[providerName])
+		if !compatibility.DriverCompatible {
+			return nil, time.Time{}, IncompatibleDriverVersion, fmt.Errorf("%s provider version %s requires minimum driver version %s, current driver version is %s", providerName, compatibility.ProviderVersion, compatibility.MinDriverVersion, vendorVersion)
 		}
 	}
 
@@ -334,9 +977,10 @@ func (ns *nodeServer) mountSecretsStoreObjectContent(ctx context.Context, provid
 		"--attributes [REDACTED] --secrets [REDACTED]", args[4:])
 
 	// using exec.CommandContext will ensure if the parent context deadlines, the call to provider is terminated
-	// and the process is killed
-	cmd := exec.CommandContext(
+	// and the process is killed. The provider runs with the resource limits and environment of the sandbox.
+	cmd := sandbox.Command(
 		ctx,
+		ns.providerSandbox,
 		providerBinary,
 		args...,
 	)
@@ -345,10 +989,163 @@ func (ns *nodeServer) mountSecretsStoreObjectContent(ctx context.Context, provid
 	stderr := &bytes.Buffer{}
 	cmd.Stderr, cmd.Stdout = stderr, stdout
 
-	err := cmd.Run()
+	if err = ns.providerCallLimiter.acquire(ctx); err != nil {
+		return nil, time.Time{}, ProviderError, fmt.Errorf("failed to wait for concurrent provider calls to complete, err: %v", err)
+	}
+	start := time.Now()
+	err = cmd.Run()
+	ns.providerCallLimiter.release()
+	ns.reportProviderCall(ctx, providerName, start, &err)
 	log.Infof(stdout.String())
 	if err != nil {
-		return nil, ProviderError, fmt.Errorf("failed to mount objects, err: %s", err.Error()+"\n"+stderr.String())
+		return nil, time.Time{}, ProviderError, fmt.Errorf("failed to mount objects, err: %s", err.Error()+"\n"+stderr.String())
+	}
+	return nil, time.Time{}, "", nil
+}
+
+// validateProviderParameters validates the parameters against the parameters
+// schema advertised by the provider. The parameters aren't validated if the
+// capabilities can't be fetched, the provider call reports the error instead.
+func (ns *nodeServer) validateProviderParameters(ctx context.Context, providerName string, parameters map[string]string) error {
+	capabilities, err := ns.providerClients.Capabilities(ctx, providerName)
+	if err != nil {
+		return nil
+	}
+	return capabilities.ValidateParameters(parameters)
+}
+
+// callProvider calls the grpc provider with the retry policy. The client,
+// version and capabilities are looked up for every attempt, so a provider that
+// recreated its socket, e.g. during an upgrade of the provider, is reconnected
+// and negotiated with again.
+func (ns *nodeServer) callProvider(ctx context.Context, providerName string, retryPolicy RetryPolicy, call func(client providerv1alpha1.CSIDriverProviderClient, capabilities ProviderCapabilities) (string, error)) (string, error) {
+	return retryPolicy.do(ctx, providerName, func() (errorCode string, err error) {
+		providerClient, err := ns.providerClients.Get(ctx, providerName)
+		if errors.Is(err, ErrProviderNotFound) {
+			// the socket is recreated while the provider is restarted
+			return FailedToCreateProviderGRPCClient, status.Errorf(codes.Unavailable, "failed to create provider client, err: %+v", err)
+		}
+		if err != nil {
+			return FailedToCreateProviderGRPCClient, fmt.Errorf("failed to create provider client, err: %+v", err)
+		}
+		if errorCode, err := ns.providerClients.checkDriverCompatibility(ctx, providerName); err != nil {
+			return errorCode, err
+		}
+		capabilities, err := ns.providerClients.Capabilities(ctx, providerName)
+		if err != nil {
+			return FailedToCreateProviderGRPCClient, fmt.Errorf("failed to get provider capabilities, err: %+v", err)
+		}
+		if err = ns.providerCallLimiter.acquire(ctx); err != nil {
+			return GRPCProviderError, fmt.Errorf("failed to wait for concurrent provider calls to complete, err: %v", err)
+		}
+		defer ns.providerCallLimiter.release()
+		defer ns.reportProviderCall(ctx, providerName, time.Now(), &err)
+		return call(providerClient, capabilities)
+	})
+}
+
+// reportProviderCall reports the duration of the provider call started at start
+// and the error of the provider call labeled by the grpc code
+func (ns *nodeServer) reportProviderCall(ctx context.Context, providerName string, start time.Time, err *error) {
+	code := providerCallCode(ctx, *err)
+	ns.reporter.reportProviderCallDuration(providerName, code.String(), time.Since(start).Seconds())
+	if code != codes.OK {
+		ns.reporter.reportProviderCallErrorCtMetric(providerName, code.String())
+	}
+}
+
+// providerCallCode returns the grpc code of the provider call error. Errors of
+// provider binaries are reported as Unknown unless the context is done.
+func providerCallCode(ctx context.Context, err error) codes.Code {
+	if err == nil {
+		return codes.OK
+	}
+	if s, ok := status.FromError(err); ok {
+		return s.Code()
+	}
+	switch ctx.Err() {
+	case context.DeadlineExceeded:
+		return codes.DeadlineExceeded
+	case context.Canceled:
+		return codes.Canceled
+	}
+	return codes.Unknown
+}
+
+// updateMountConditions sets the LastMountError and ProviderReachable
+// conditions of the secret provider class to the result of the mount. The
+// ProviderReachable condition isn't changed if the mount failed before calling
+// the provider or used the cached contents. Failures are only logged, so the
+// status update doesn't change the result of the mount.
+func (ns *nodeServer) updateMountConditions(ctx context.Context, spc *v1alpha1.SecretProviderClass, providerName, podName, podNamespace, errorReason string, cached bool, mountErr error) {
+	lastMountError := v1alpha1.SecretProviderClassCondition{
+		Type:    v1alpha1.LastMountError,
+		Status:  corev1.ConditionFalse,
+		Reason:  controllers.MountSucceededReason,
+		Message: "last mount succeeded",
+	}
+	reachable := v1alpha1.SecretProviderClassCondition{
+		Type:    v1alpha1.ProviderReachable,
+		Status:  corev1.ConditionTrue,
+		Reason:  controllers.ProviderReachableReason,
+		Message: fmt.Sprintf("provider %s is reachable", providerName),
+	}
+	if mountErr != nil {
+		lastMountError.Status = corev1.ConditionTrue
+		lastMountError.Reason = errorReason
+		lastMountError.Message = fmt.Sprintf("failed to mount for pod %s/%s on node %s, err: %v", podNamespace, podName, ns.nodeID, mountErr)
+	}
+	conditions := []v1alpha1.SecretProviderClassCondition{lastMountError}
+	switch {
+	case mountErr == nil:
+		if !cached {
+			conditions = append(conditions, reachable)
+		}
+	case isProviderUnreachableReason(errorReason):
+		reachable.Status = corev1.ConditionFalse
+		reachable.Reason = controllers.ProviderUnreachableReason
+		reachable.Message = fmt.Sprintf("provider %s is unreachable from node %s, err: %v", providerName, ns.nodeID, mountErr)
+		conditions = append(conditions, reachable)
+	case isProviderErrorReason(errorReason):
+		// the provider responded with an error
+		conditions = append(conditions, reachable)
+	}
+	if err := controllers.UpdateSecretProviderClassConditions(ctx, ns.client, spc, conditions...); err != nil {
+		log.Warningf("failed to update conditions of spc %s/%s, err: %+v", spc.Namespace, spc.Name, err)
+	}
+}
+
+// isProviderUnreachableReason returns true if the mount failed with a reason
+// that means the provider couldn't be reached
+func isProviderUnreachableReason(errorReason string) bool {
+	switch errorReason {
+	case ProviderUnhealthy, ProviderTimeout, FailedToCreateProviderGRPCClient, ProviderBinaryNotFound:
+		return true
+	}
+	return false
+}
+
+// isProviderUnavailableReason returns true if the mount failed with a reason
+// that means the provider or its backend is unavailable, as opposed to the
+// provider rejecting the request
+func isProviderUnavailableReason(errorReason string) bool {
+	switch errorReason {
+	case ProviderThrottled, ProviderBackendTimeout, MountFetchTimeout:
+		return true
+	}
+	return isProviderUnreachableReason(errorReason)
+}
+
+// recordPodEvent records an event on the pod that requested the volume
+func (ns *nodeServer) recordPodEvent(podName, podNamespace, podUID, eventType, reason, message string) {
+	if ns.eventRecorder == nil || len(podName) == 0 || len(podNamespace) == 0 {
+		return
+	}
+	ref := &corev1.ObjectReference{
+		Kind:      "Pod",
+		Name:      podName,
+		Namespace: podNamespace,
+		UID:       types.UID(podUID),
 	}
-	return nil, "", nil
+	ns.eventRecorder.Event(ref, eventType, reason, message)
 }
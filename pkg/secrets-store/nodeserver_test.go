@@ -17,21 +17,34 @@ limitations under the License.
 package secretsstore
 
 import (
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/container-storage-interface/spec/lib/go/csi"
 	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	kubefake "k8s.io/client-go/kubernetes/fake"
 	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/utils/mount"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 	"sigs.k8s.io/secrets-store-csi-driver/apis/v1alpha1"
+	"sigs.k8s.io/secrets-store-csi-driver/pkg/util/fileutil"
+	providerfake "sigs.k8s.io/secrets-store-csi-driver/provider/fake"
+	providerv1alpha1 "sigs.k8s.io/secrets-store-csi-driver/provider/v1alpha1"
 )
 
 func testNodeServer(mountPoints []mount.MountPoint, client client.Client, grpcSupportProviders string) (*nodeServer, error) {
@@ -39,7 +52,39 @@ func testNodeServer(mountPoints []mount.MountPoint, client client.Client, grpcSu
 	if err != nil {
 		return nil, err
 	}
-	return newNodeServer(NewFakeDriver(), tmpDir, "", grpcSupportProviders, "testnode", mount.NewFakeMounter(mountPoints), client)
+	ns, err := newNodeServer(NewFakeDriver(), mount.NewFakeMounter(mountPoints), Config{
+		NodeID:                 "testnode",
+		ProviderVolumePath:     tmpDir,
+		GRPCSupportedProviders: grpcSupportProviders,
+		ProviderClients:        NewPluginClientBuilder(tmpDir),
+		FSGroupPolicy:          FSGroupPolicyNone,
+		Client:                 applyClient{client},
+		KubeClient:             kubefake.NewSimpleClientset(),
+		EventRecorder:          record.NewFakeRecorder(10),
+	})
+	if err != nil {
+		return nil, err
+	}
+	// the fake mounter doesn't mount a tmpfs
+	ns.tmpfsBacked = func(string) (bool, error) { return true, nil }
+	return ns, nil
+}
+
+// applyClient is a client that supports server-side apply patches, which the
+// fake client doesn't, by converting them into merge patches
+type applyClient struct {
+	client.Client
+}
+
+func (c applyClient) Patch(ctx context.Context, obj runtime.Object, patch client.Patch, opts ...client.PatchOption) error {
+	if patch.Type() != types.ApplyPatchType {
+		return c.Client.Patch(ctx, obj, patch, opts...)
+	}
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return err
+	}
+	return c.Client.Patch(ctx, obj, client.RawPatch(types.MergePatchType, data))
 }
 
 func getTestTargetPath(t *testing.T) string {
@@ -286,63 +331,2150 @@ func TestNodePublishVolume(t *testing.T) {
 	}
 }
 
-func TestMountSecretsStoreObjectContent(t *testing.T) {
-	tests := []struct {
-		name                 string
-		attributes           string
-		secrets              string
-		targetPath           string
-		permission           string
-		grpcSupportProviders string
-		expectedErrorReason  string
-		expectedErr          bool
+func TestNodePublishVolumeProviderUnhealthy(t *testing.T) {
+	spc := &v1alpha1.SecretProviderClass{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "provider1",
+			Namespace: "default",
+		},
+		Spec: v1alpha1.SecretProviderClassSpec{
+			Provider:   "provider1",
+			Parameters: map[string]string{"parameter1": "value1"},
+		},
+	}
+	s := scheme.Scheme
+	s.AddKnownTypes(v1alpha1.GroupVersion,
+		&v1alpha1.SecretProviderClass{},
+		&v1alpha1.SecretProviderClassList{},
+	)
+
+	ns, err := testNodeServer(nil, fake.NewFakeClientWithScheme(s, spc), "")
+	if err != nil {
+		t.Fatalf("expected error to be nil, got: %+v", err)
+	}
+	defer os.RemoveAll(ns.providerVolumePath)
+
+	server, err := providerfake.NewMocKCSIProviderServer(fmt.Sprintf("%s/provider1.sock", ns.providerVolumePath))
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	server.SetHealth(false, "backend not reachable")
+	server.Start()
+	ns.providerClients.checkHealth()
+
+	targetPath := getTestTargetPath(t)
+	defer os.RemoveAll(targetPath)
+
+	_, err = ns.NodePublishVolume(context.TODO(), &csi.NodePublishVolumeRequest{
+		VolumeCapability: &csi.VolumeCapability{},
+		VolumeId:         "testvolid1",
+		TargetPath:       targetPath,
+		VolumeContext:    map[string]string{"secretProviderClass": "provider1", csipodname: "pod1", csipodnamespace: "default", csipoduid: "poduid1"},
+		Readonly:         true,
+	})
+	if status.Code(err) != codes.Unavailable {
+		t.Fatalf("expected err code: %v, got: %+v", codes.Unavailable, err)
+	}
+	mnts, err := ns.mounter.List()
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %v", err)
+	}
+	if len(mnts) != 0 {
+		t.Fatalf("expected mount points to be 0, got: %d", len(mnts))
+	}
+
+	// the failed mount is reported in the status of the secret provider class
+	updated := &v1alpha1.SecretProviderClass{}
+	if err := ns.client.Get(context.TODO(), types.NamespacedName{Name: "provider1", Namespace: "default"}, updated); err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	expectedConditions := map[v1alpha1.SecretProviderClassConditionType]string{
+		v1alpha1.LastMountError:    ProviderUnhealthy,
+		v1alpha1.ProviderReachable: "Unreachable",
+	}
+	for _, condition := range updated.Status.Conditions {
+		if reason, ok := expectedConditions[condition.Type]; ok && condition.Reason == reason {
+			delete(expectedConditions, condition.Type)
+		}
+	}
+	if len(expectedConditions) > 0 {
+		t.Errorf("expected conditions with reasons: %v, got: %+v", expectedConditions, updated.Status.Conditions)
+	}
+}
+
+func TestNodePublishVolumeInvalidParameters(t *testing.T) {
+	spc := &v1alpha1.SecretProviderClass{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "provider1",
+			Namespace: "default",
+		},
+		Spec: v1alpha1.SecretProviderClassSpec{
+			Provider:   "provider1",
+			Parameters: map[string]string{"objets": "secret1"},
+		},
+	}
+	s := scheme.Scheme
+	s.AddKnownTypes(v1alpha1.GroupVersion,
+		&v1alpha1.SecretProviderClass{},
+		&v1alpha1.SecretProviderClassList{},
+	)
+
+	ns, err := testNodeServer(nil, fake.NewFakeClientWithScheme(s, spc), "")
+	if err != nil {
+		t.Fatalf("expected error to be nil, got: %+v", err)
+	}
+	defer os.RemoveAll(ns.providerVolumePath)
+
+	server, err := providerfake.NewMocKCSIProviderServer(fmt.Sprintf("%s/provider1.sock", ns.providerVolumePath))
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	server.SetParametersSchema(`{"properties": {"objects": {"type": "string"}}, "additionalProperties": false}`)
+	server.SetObjects(map[string]string{"secret/secret1": "v1"})
+	server.Start()
+
+	targetPath := getTestTargetPath(t)
+	defer os.RemoveAll(targetPath)
+
+	_, err = ns.NodePublishVolume(context.TODO(), &csi.NodePublishVolumeRequest{
+		VolumeCapability: &csi.VolumeCapability{},
+		VolumeId:         "testvolid1",
+		TargetPath:       targetPath,
+		VolumeContext:    map[string]string{"secretProviderClass": "provider1", csipodname: "pod1", csipodnamespace: "default", csipoduid: "poduid1"},
+		Readonly:         true,
+	})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected err code: %v, got: %+v", codes.InvalidArgument, err)
+	}
+	if !strings.Contains(err.Error(), `unknown parameter "objets", did you mean "objects"`) {
+		t.Errorf("expected err to name the misspelled parameter, got: %+v", err)
+	}
+}
+
+func TestNodePublishVolumeClusterSecretProviderClass(t *testing.T) {
+	cspc := &v1alpha1.ClusterSecretProviderClass{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:       "provider1",
+			UID:        "cspcuid1",
+			Generation: 3,
+		},
+		Spec: v1alpha1.ClusterSecretProviderClassSpec{
+			SecretProviderClassSpec: v1alpha1.SecretProviderClassSpec{
+				Provider:   "provider1",
+				Parameters: map[string]string{"parameter1": "value1"},
+			},
+			NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"team": "a"}},
+		},
+	}
+	selected := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-a", Labels: map[string]string{"team": "a"}}}
+	notSelected := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-b", Labels: map[string]string{"team": "b"}}}
+	s := scheme.Scheme
+	s.AddKnownTypes(v1alpha1.GroupVersion,
+		&v1alpha1.ClusterSecretProviderClass{},
+		&v1alpha1.ClusterSecretProviderClassList{},
+		&v1alpha1.SecretProviderClassPodStatus{},
+		&v1alpha1.SecretProviderClassPodStatusList{},
+	)
+
+	ns, err := testNodeServer(nil, fake.NewFakeClientWithScheme(s, cspc, selected, notSelected), "")
+	if err != nil {
+		t.Fatalf("expected error to be nil, got: %+v", err)
+	}
+	defer os.RemoveAll(ns.providerVolumePath)
+
+	server, err := providerfake.NewMocKCSIProviderServer(fmt.Sprintf("%s/provider1.sock", ns.providerVolumePath))
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	server.SetObjects(map[string]string{"secret/secret1": "v1"})
+	server.SetFiles(map[string]string{"secret1": "value1"})
+	server.Start()
+
+	cases := []struct {
+		name         string
+		namespace    string
+		expectedCode codes.Code
 	}{
 		{
-			name:        "attributes empty",
-			expectedErr: true,
+			name:         "namespace selected",
+			namespace:    "team-a",
+			expectedCode: codes.OK,
 		},
 		{
-			name:        "target path empty",
-			attributes:  "{}",
-			expectedErr: true,
+			name:         "namespace not selected",
+			namespace:    "team-b",
+			expectedCode: codes.PermissionDenied,
+		},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			targetPath := getTestTargetPath(t)
+			defer os.RemoveAll(targetPath)
+
+			_, err := ns.NodePublishVolume(context.TODO(), &csi.NodePublishVolumeRequest{
+				VolumeCapability: &csi.VolumeCapability{},
+				VolumeId:         "testvolid1",
+				TargetPath:       targetPath,
+				VolumeContext:    map[string]string{"clusterSecretProviderClass": "provider1", csipodname: "pod1", csipodnamespace: test.namespace, csipoduid: "poduid1"},
+				Readonly:         true,
+			})
+			if status.Code(err) != test.expectedCode {
+				t.Fatalf("expected err code: %v, got: %+v", test.expectedCode, err)
+			}
+			if test.expectedCode != codes.OK {
+				return
+			}
+			content, err := ioutil.ReadFile(filepath.Join(targetPath, "secret1"))
+			if err != nil {
+				t.Fatalf("expected err to be nil, got: %+v", err)
+			}
+			if string(content) != "value1" {
+				t.Errorf("expected file content: value1, got: %s", string(content))
+			}
+			spcPodStatus := &v1alpha1.SecretProviderClassPodStatus{}
+			if err := ns.client.Get(context.TODO(), types.NamespacedName{Name: "pod1-team-a-cluster-provider1", Namespace: "team-a"}, spcPodStatus); err != nil {
+				t.Fatalf("expected err to be nil, got: %+v", err)
+			}
+			if spcPodStatus.Status.SecretProviderClassKind != v1alpha1.ClusterSecretProviderClassKind {
+				t.Errorf("expected secret provider class kind: %s, got: %s", v1alpha1.ClusterSecretProviderClassKind, spcPodStatus.Status.SecretProviderClassKind)
+			}
+			if spcPodStatus.Status.SecretProviderClassGeneration != 3 {
+				t.Errorf("expected secret provider class generation: 3, got: %d", spcPodStatus.Status.SecretProviderClassGeneration)
+			}
+		})
+	}
+}
+
+func TestNodePublishVolumeParameterTemplates(t *testing.T) {
+	spc := &v1alpha1.SecretProviderClass{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "provider1",
+			Namespace: "team-a",
 		},
+		Spec: v1alpha1.SecretProviderClassSpec{
+			Provider:   "provider1",
+			Parameters: map[string]string{"objects": "apps/{{ .PodNamespace }}/{{ .PodLabels.app }}"},
+		},
+	}
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "pod1", Namespace: "team-a", Labels: map[string]string{"app": "db"}},
+	}
+	s := scheme.Scheme
+	s.AddKnownTypes(v1alpha1.GroupVersion,
+		&v1alpha1.SecretProviderClass{},
+		&v1alpha1.SecretProviderClassList{},
+		&v1alpha1.SecretProviderClassPodStatus{},
+		&v1alpha1.SecretProviderClassPodStatusList{},
+	)
+
+	ns, err := testNodeServer(nil, fake.NewFakeClientWithScheme(s, spc), "")
+	if err != nil {
+		t.Fatalf("expected error to be nil, got: %+v", err)
+	}
+	defer os.RemoveAll(ns.providerVolumePath)
+	ns.kubeClient = kubefake.NewSimpleClientset(pod)
+
+	server, err := providerfake.NewMocKCSIProviderServer(fmt.Sprintf("%s/provider1.sock", ns.providerVolumePath))
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	// the mount fails unless the provider receives the rendered parameter
+	server.SetParametersSchema(`{"properties": {"objects": {"type": "string", "pattern": "^apps/team-a/db$"}}}`)
+	server.SetObjects(map[string]string{"secret/secret1": "v1"})
+	server.SetFiles(map[string]string{"secret1": "value1"})
+	server.Start()
+
+	cases := []struct {
+		name         string
+		podName      string
+		expectedCode codes.Code
+	}{
 		{
-			name:        "permission not set",
-			attributes:  "{}",
-			targetPath:  getTestTargetPath(t),
-			expectedErr: true,
+			name:         "rendered with the pod metadata",
+			podName:      "pod1",
+			expectedCode: codes.OK,
 		},
 		{
-			name:                "provider binary not found",
-			attributes:          "{}",
-			targetPath:          getTestTargetPath(t),
-			permission:          fmt.Sprint(permission),
-			expectedErrorReason: ProviderBinaryNotFound,
-			expectedErr:         true,
+			name:         "pod not found",
+			podName:      "pod2",
+			expectedCode: codes.InvalidArgument,
+		},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			targetPath := getTestTargetPath(t)
+			defer os.RemoveAll(targetPath)
+
+			_, err := ns.NodePublishVolume(context.TODO(), &csi.NodePublishVolumeRequest{
+				VolumeCapability: &csi.VolumeCapability{},
+				VolumeId:         "testvolid1",
+				TargetPath:       targetPath,
+				VolumeContext:    map[string]string{"secretProviderClass": "provider1", csipodname: test.podName, csipodnamespace: "team-a", csipoduid: test.podName + "uid"},
+				Readonly:         true,
+			})
+			if status.Code(err) != test.expectedCode {
+				t.Fatalf("expected err code: %v, got: %+v", test.expectedCode, err)
+			}
+		})
+	}
+}
+
+func TestNodePublishVolumeMountedObjects(t *testing.T) {
+	spcs := []*v1alpha1.SecretProviderClass{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "renamed", Namespace: "default"},
+			Spec: v1alpha1.SecretProviderClassSpec{
+				Provider:   "provider1",
+				Parameters: map[string]string{"parameter1": "value1"},
+				MountedObjects: []*v1alpha1.MountedObject{
+					{ObjectName: "projects/123/secrets/db-password/versions/latest", FileName: "db-password"},
+				},
+			},
 		},
 		{
-			name:                 "failed to create provider grpc client",
-			attributes:           "{}",
-			targetPath:           getTestTargetPath(t),
-			permission:           fmt.Sprint(permission),
-			grpcSupportProviders: "provider1",
-			expectedErrorReason:  "GRPCProviderError",
-			expectedErr:          true,
+			ObjectMeta: metav1.ObjectMeta{Name: "invalid", Namespace: "default"},
+			Spec: v1alpha1.SecretProviderClassSpec{
+				Provider:   "provider1",
+				Parameters: map[string]string{"parameter1": "value1"},
+				MountedObjects: []*v1alpha1.MountedObject{
+					{ObjectName: "projects/123/secrets/db-password/versions/latest", FileName: "../db-password"},
+				},
+			},
 		},
 	}
+	s := scheme.Scheme
+	s.AddKnownTypes(v1alpha1.GroupVersion,
+		&v1alpha1.SecretProviderClass{},
+		&v1alpha1.SecretProviderClassList{},
+		&v1alpha1.SecretProviderClassPodStatus{},
+		&v1alpha1.SecretProviderClassPodStatusList{},
+	)
 
-	for _, test := range tests {
+	ns, err := testNodeServer(nil, fake.NewFakeClientWithScheme(s, spcs[0], spcs[1]), "")
+	if err != nil {
+		t.Fatalf("expected error to be nil, got: %+v", err)
+	}
+	defer os.RemoveAll(ns.providerVolumePath)
+
+	server, err := providerfake.NewMocKCSIProviderServer(fmt.Sprintf("%s/provider1.sock", ns.providerVolumePath))
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	server.SetObjects(map[string]string{"projects/123/secrets/db-password": "latest"})
+	server.SetFiles(map[string]string{"projects/123/secrets/db-password/versions/latest": "password"})
+	server.Start()
+
+	cases := []struct {
+		name          string
+		spcName       string
+		expectedCode  codes.Code
+		expectedFiles []string
+	}{
+		{
+			name:          "object renamed to file name",
+			spcName:       "renamed",
+			expectedCode:  codes.OK,
+			expectedFiles: []string{fileutil.DataDirLink, fileutil.DataVersionFile, "db-password"},
+		},
+		{
+			name:         "invalid file name",
+			spcName:      "invalid",
+			expectedCode: codes.InvalidArgument,
+		},
+	}
+
+	for _, test := range cases {
 		t.Run(test.name, func(t *testing.T) {
-			ns, err := testNodeServer(nil, fake.NewFakeClientWithScheme(nil), test.grpcSupportProviders)
+			targetPath := getTestTargetPath(t)
+			defer os.RemoveAll(targetPath)
+
+			_, err := ns.NodePublishVolume(context.TODO(), &csi.NodePublishVolumeRequest{
+				VolumeCapability: &csi.VolumeCapability{},
+				VolumeId:         "testvolid1",
+				TargetPath:       targetPath,
+				VolumeContext:    map[string]string{"secretProviderClass": test.spcName, csipodname: "pod1", csipodnamespace: "default", csipoduid: test.spcName + "uid"},
+				Readonly:         true,
+			})
+			if status.Code(err) != test.expectedCode {
+				t.Fatalf("expected err code: %v, got: %+v", test.expectedCode, err)
+			}
+			if test.expectedCode != codes.OK {
+				return
+			}
+			files, err := ioutil.ReadDir(targetPath)
 			if err != nil {
-				t.Fatalf("expected error to be nil, got: %+v", err)
+				t.Fatalf("expected err to be nil, got: %+v", err)
 			}
-			_, errorReason, err := ns.mountSecretsStoreObjectContent(context.TODO(), "provider1", test.attributes, test.secrets, test.targetPath, test.permission)
-			if errorReason != test.expectedErrorReason {
-				t.Fatalf("expected error reason to be %s, got: %s", test.expectedErrorReason, errorReason)
+			var names []string
+			for _, file := range files {
+				// the name of the data directory is timestamped
+				if filepath.Join(targetPath, file.Name()) == fileutil.DataDir(targetPath) {
+					continue
+				}
+				names = append(names, file.Name())
 			}
-			if test.expectedErr && err == nil || !test.expectedErr && err != nil {
-				t.Fatalf("expected err: %v, got: %+v", test.expectedErr, err)
+			if !reflect.DeepEqual(names, test.expectedFiles) {
+				t.Fatalf("expected files: %v, got: %v", test.expectedFiles, names)
+			}
+		})
+	}
+}
+
+func TestNodePublishVolumePodSelector(t *testing.T) {
+	spc := &v1alpha1.SecretProviderClass{
+		ObjectMeta: metav1.ObjectMeta{Name: "provider1", Namespace: "default"},
+		Spec: v1alpha1.SecretProviderClassSpec{
+			Provider:    "provider1",
+			Parameters:  map[string]string{"parameter1": "value1"},
+			PodSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "db"}},
+		},
+	}
+	s := scheme.Scheme
+	s.AddKnownTypes(v1alpha1.GroupVersion,
+		&v1alpha1.SecretProviderClass{},
+		&v1alpha1.SecretProviderClassList{},
+		&v1alpha1.SecretProviderClassPodStatus{},
+		&v1alpha1.SecretProviderClassPodStatusList{},
+	)
+
+	ns, err := testNodeServer(nil, fake.NewFakeClientWithScheme(s, spc), "")
+	if err != nil {
+		t.Fatalf("expected error to be nil, got: %+v", err)
+	}
+	defer os.RemoveAll(ns.providerVolumePath)
+	ns.kubeClient = kubefake.NewSimpleClientset(
+		&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "db", Namespace: "default", Labels: map[string]string{"app": "db"}}},
+		&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default", Labels: map[string]string{"app": "web"}}},
+	)
+
+	server, err := providerfake.NewMocKCSIProviderServer(fmt.Sprintf("%s/provider1.sock", ns.providerVolumePath))
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	server.SetObjects(map[string]string{"secret/secret1": "v1"})
+	server.SetFiles(map[string]string{"secret1": "value1"})
+	server.Start()
+
+	cases := []struct {
+		name         string
+		podName      string
+		expectedCode codes.Code
+	}{
+		{
+			name:         "pod selected",
+			podName:      "db",
+			expectedCode: codes.OK,
+		},
+		{
+			name:         "pod not selected",
+			podName:      "web",
+			expectedCode: codes.PermissionDenied,
+		},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			targetPath := getTestTargetPath(t)
+			defer os.RemoveAll(targetPath)
+
+			_, err := ns.NodePublishVolume(context.TODO(), &csi.NodePublishVolumeRequest{
+				VolumeCapability: &csi.VolumeCapability{},
+				VolumeId:         "testvolid1",
+				TargetPath:       targetPath,
+				VolumeContext:    map[string]string{"secretProviderClass": "provider1", csipodname: test.podName, csipodnamespace: "default", csipoduid: test.podName + "uid"},
+				Readonly:         true,
+			})
+			if status.Code(err) != test.expectedCode {
+				t.Fatalf("expected err code: %v, got: %+v", test.expectedCode, err)
+			}
+		})
+	}
+}
+
+func TestNodePublishVolumeGetsPodOnce(t *testing.T) {
+	spc := &v1alpha1.SecretProviderClass{
+		ObjectMeta: metav1.ObjectMeta{Name: "provider1", Namespace: "default"},
+		Spec: v1alpha1.SecretProviderClassSpec{
+			Provider:    "provider1",
+			Parameters:  map[string]string{"parameter1": "apps/{{ .PodNamespace }}/db"},
+			PodSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "db"}},
+		},
+	}
+	s := scheme.Scheme
+	s.AddKnownTypes(v1alpha1.GroupVersion,
+		&v1alpha1.SecretProviderClass{},
+		&v1alpha1.SecretProviderClassList{},
+		&v1alpha1.SecretProviderClassPodStatus{},
+		&v1alpha1.SecretProviderClassPodStatusList{},
+	)
+
+	ns, err := testNodeServer(nil, fake.NewFakeClientWithScheme(s, spc), "")
+	if err != nil {
+		t.Fatalf("expected error to be nil, got: %+v", err)
+	}
+	defer os.RemoveAll(ns.providerVolumePath)
+	// the pod selector, the parameter templates, the SELinux context, the
+	// fsGroup and the subPath warning all use the pod of the volume
+	ns.seLinuxContext = true
+	ns.seLinuxEnabled = func() bool { return true }
+	ns.fsGroupPolicy = FSGroupPolicyFile
+	ns.rotationEnabled = true
+	kubeClient := kubefake.NewSimpleClientset(
+		&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "db", Namespace: "default", Labels: map[string]string{"app": "db"}}},
+	)
+	ns.kubeClient = kubeClient
+
+	server, err := providerfake.NewMocKCSIProviderServer(fmt.Sprintf("%s/provider1.sock", ns.providerVolumePath))
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	server.SetObjects(map[string]string{"secret/secret1": "v1"})
+	server.SetFiles(map[string]string{"secret1": "value1"})
+	server.Start()
+	defer server.Stop()
+
+	targetPath := getTestTargetPath(t)
+	defer os.RemoveAll(targetPath)
+
+	_, err = ns.NodePublishVolume(context.TODO(), &csi.NodePublishVolumeRequest{
+		VolumeCapability: &csi.VolumeCapability{},
+		VolumeId:         "testvolid1",
+		TargetPath:       targetPath,
+		VolumeContext:    map[string]string{"secretProviderClass": "provider1", csipodname: "db", csipodnamespace: "default", csipoduid: "dbuid"},
+		Readonly:         true,
+	})
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	gets := 0
+	for _, action := range kubeClient.Actions() {
+		if action.Matches("get", "pods") {
+			gets++
+		}
+	}
+	if gets != 1 {
+		t.Errorf("expected the pod to be fetched once, got: %d", gets)
+	}
+}
+
+func TestNodePublishVolumeCache(t *testing.T) {
+	spc := &v1alpha1.SecretProviderClass{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "provider1",
+			Namespace: "default",
+			UID:       "spcuid1",
+		},
+		Spec: v1alpha1.SecretProviderClassSpec{
+			Provider:   "provider1",
+			Parameters: map[string]string{"parameter1": "value1"},
+			CacheTTL:   &metav1.Duration{Duration: time.Minute},
+		},
+	}
+	s := scheme.Scheme
+	s.AddKnownTypes(v1alpha1.GroupVersion,
+		&v1alpha1.SecretProviderClass{},
+		&v1alpha1.SecretProviderClassList{},
+		&v1alpha1.SecretProviderClassPodStatus{},
+		&v1alpha1.SecretProviderClassPodStatusList{},
+	)
+
+	ns, err := testNodeServer(nil, fake.NewFakeClientWithScheme(s, spc), "")
+	if err != nil {
+		t.Fatalf("expected error to be nil, got: %+v", err)
+	}
+	defer os.RemoveAll(ns.providerVolumePath)
+
+	server, err := providerfake.NewMocKCSIProviderServer(fmt.Sprintf("%s/provider1.sock", ns.providerVolumePath))
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	server.SetObjects(map[string]string{"secret/secret1": "v1"})
+	server.SetFiles(map[string]string{"secret1": "value1"})
+	server.Start()
+
+	for i, pod := range []string{"pod1", "pod2"} {
+		// the second pod must be served from the cache
+		if i > 0 {
+			server.SetReturnError(fmt.Errorf("provider unavailable"))
+		}
+		targetPath := getTestTargetPath(t)
+		defer os.RemoveAll(targetPath)
+
+		_, err = ns.NodePublishVolume(context.TODO(), &csi.NodePublishVolumeRequest{
+			VolumeCapability: &csi.VolumeCapability{},
+			VolumeId:         "testvolid1",
+			TargetPath:       targetPath,
+			VolumeContext:    map[string]string{"secretProviderClass": "provider1", csipodname: pod, csipodnamespace: "default", csipoduid: pod + "uid", csipodsa: "sa1"},
+			Readonly:         true,
+		})
+		if err != nil {
+			t.Fatalf("expected err to be nil for %s, got: %+v", pod, err)
+		}
+		content, err := ioutil.ReadFile(filepath.Join(targetPath, "secret1"))
+		if err != nil {
+			t.Fatalf("expected err to be nil, got: %+v", err)
+		}
+		if string(content) != "value1" {
+			t.Errorf("expected file content: value1, got: %s", string(content))
+		}
+	}
+
+	updated := &v1alpha1.SecretProviderClass{}
+	if err := ns.client.Get(context.TODO(), types.NamespacedName{Name: "provider1", Namespace: "default"}, updated); err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	expectedConditions := map[v1alpha1.SecretProviderClassConditionType]corev1.ConditionStatus{
+		v1alpha1.LastMountError:    corev1.ConditionFalse,
+		v1alpha1.ProviderReachable: corev1.ConditionTrue,
+	}
+	for _, condition := range updated.Status.Conditions {
+		if expectedConditions[condition.Type] == condition.Status {
+			delete(expectedConditions, condition.Type)
+		}
+	}
+	if len(expectedConditions) > 0 {
+		t.Errorf("expected conditions: %v, got: %+v", expectedConditions, updated.Status.Conditions)
+	}
+}
+
+func TestNodePublishVolumeCachedContent(t *testing.T) {
+	spc := &v1alpha1.SecretProviderClass{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "provider1",
+			Namespace: "default",
+			UID:       "spcuid1",
+		},
+		Spec: v1alpha1.SecretProviderClassSpec{
+			Provider:   "provider1",
+			Parameters: map[string]string{"parameter1": "value1"},
+		},
+	}
+	s := scheme.Scheme
+	s.AddKnownTypes(v1alpha1.GroupVersion,
+		&v1alpha1.SecretProviderClass{},
+		&v1alpha1.SecretProviderClassList{},
+		&v1alpha1.SecretProviderClassPodStatus{},
+		&v1alpha1.SecretProviderClassPodStatusList{},
+	)
+
+	ns, err := testNodeServer(nil, fake.NewFakeClientWithScheme(s, spc), "")
+	if err != nil {
+		t.Fatalf("expected error to be nil, got: %+v", err)
+	}
+	defer os.RemoveAll(ns.providerVolumePath)
+	ns.mountCache = newMountCache(time.Minute)
+
+	server, err := providerfake.NewMocKCSIProviderServer(fmt.Sprintf("%s/provider1.sock", ns.providerVolumePath))
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	server.SetObjects(map[string]string{"secret/secret1": "v1"})
+	server.SetFiles(map[string]string{"secret1": "value1"})
+	server.Start()
+	defer server.Stop()
+
+	publish := func(pod string) (string, error) {
+		targetPath := getTestTargetPath(t)
+		_, err := ns.NodePublishVolume(context.TODO(), &csi.NodePublishVolumeRequest{
+			VolumeCapability: &csi.VolumeCapability{},
+			VolumeId:         pod + "volid",
+			TargetPath:       targetPath,
+			VolumeContext:    map[string]string{"secretProviderClass": "provider1", csipodname: pod, csipodnamespace: "default", csipoduid: pod + "uid", csipodsa: "sa1"},
+			Readonly:         true,
+		})
+		return targetPath, err
+	}
+
+	targetPath, err := publish("pod1")
+	defer os.RemoveAll(targetPath)
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	// the contents aren't reused without a cache TTL while the provider is available
+	server.SetFiles(map[string]string{"secret1": "value2"})
+	targetPath, err = publish("pod2")
+	defer os.RemoveAll(targetPath)
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	if content, _ := ioutil.ReadFile(filepath.Join(targetPath, "secret1")); string(content) != "value2" {
+		t.Errorf("expected file content: value2, got: %s", string(content))
+	}
+
+	// the cached contents are served while the provider is unhealthy
+	server.SetHealth(false, "backend not reachable")
+	ns.providerClients.checkHealth()
+	targetPath, err = publish("pod3")
+	defer os.RemoveAll(targetPath)
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	if content, _ := ioutil.ReadFile(filepath.Join(targetPath, "secret1")); string(content) != "value2" {
+		t.Errorf("expected cached file content: value2, got: %s", string(content))
+	}
+	select {
+	case event := <-ns.eventRecorder.(*record.FakeRecorder).Events:
+		if !strings.HasPrefix(event, "Warning CachedContentServed") {
+			t.Errorf("expected CachedContentServed event, got: %s", event)
+		}
+	default:
+		t.Errorf("expected CachedContentServed event to be recorded")
+	}
+
+	// the cached contents aren't served if the provider rejects the request
+	server.SetHealth(true, "")
+	ns.providerClients.checkHealth()
+	server.SetProviderErrorReason(providerv1alpha1.ErrorReason_AUTH_FAILURE, "role is not authorized to read secret1")
+	targetPath, err = publish("pod4")
+	defer os.RemoveAll(targetPath)
+	if err == nil {
+		t.Fatalf("expected the mount to fail when the provider rejects the request")
+	}
+
+	// the cached contents aren't served beyond the maximum cached content age
+	server.SetProviderErrorReason(providerv1alpha1.ErrorReason_UNSPECIFIED, "")
+	server.SetHealth(false, "backend not reachable")
+	ns.providerClients.checkHealth()
+	now := time.Now().Add(time.Minute)
+	ns.mountCache.now = func() time.Time { return now }
+	targetPath, err = publish("pod5")
+	defer os.RemoveAll(targetPath)
+	if status.Code(err) != codes.Unavailable {
+		t.Fatalf("expected err code: %v, got: %+v", codes.Unavailable, err)
+	}
+}
+
+func TestNodePublishVolumeChecksums(t *testing.T) {
+	spc := &v1alpha1.SecretProviderClass{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "provider1",
+			Namespace: "default",
+		},
+		Spec: v1alpha1.SecretProviderClassSpec{
+			Provider:       "provider1",
+			Parameters:     map[string]string{"parameter1": "value1"},
+			WriteChecksums: true,
+		},
+	}
+	s := scheme.Scheme
+	s.AddKnownTypes(v1alpha1.GroupVersion,
+		&v1alpha1.SecretProviderClass{},
+		&v1alpha1.SecretProviderClassList{},
+		&v1alpha1.SecretProviderClassPodStatus{},
+		&v1alpha1.SecretProviderClassPodStatusList{},
+	)
+
+	ns, err := testNodeServer(nil, fake.NewFakeClientWithScheme(s, spc), "")
+	if err != nil {
+		t.Fatalf("expected error to be nil, got: %+v", err)
+	}
+	defer os.RemoveAll(ns.providerVolumePath)
+
+	server, err := providerfake.NewMocKCSIProviderServer(fmt.Sprintf("%s/provider1.sock", ns.providerVolumePath))
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	server.SetObjects(map[string]string{"secret/secret1": "v1"})
+	server.SetFiles(map[string]string{"secret1": "value1"})
+	server.Start()
+	defer server.Stop()
+
+	targetPath := getTestTargetPath(t)
+	defer os.RemoveAll(targetPath)
+	_, err = ns.NodePublishVolume(context.TODO(), &csi.NodePublishVolumeRequest{
+		VolumeCapability: &csi.VolumeCapability{},
+		VolumeId:         "testvolid1",
+		TargetPath:       targetPath,
+		VolumeContext:    map[string]string{"secretProviderClass": "provider1", csipodname: "pod1", csipodnamespace: "default", csipoduid: "poduid1"},
+		Readonly:         true,
+	})
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(targetPath, fileutil.ChecksumsFile))
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	var checksums fileutil.Checksums
+	if err := json.Unmarshal(data, &checksums); err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	// sha256 of value1
+	expected := "3c9683017f9e4bf33d0fbedd26bf143fd72de9b9dd145441b75f0604047ea28e"
+	if len(checksums.Files) != 1 || checksums.Files["secret1"] != expected {
+		t.Errorf("expected the digest of secret1 to be %s, got: %+v", expected, checksums.Files)
+	}
+}
+
+func TestNodePublishVolumeSharedFetch(t *testing.T) {
+	spc := &v1alpha1.SecretProviderClass{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "provider1",
+			Namespace: "default",
+		},
+		Spec: v1alpha1.SecretProviderClassSpec{
+			Provider:    "provider1",
+			Parameters:  map[string]string{"parameter1": "value1"},
+			SharedFetch: true,
+		},
+	}
+	s := scheme.Scheme
+	s.AddKnownTypes(v1alpha1.GroupVersion,
+		&v1alpha1.SecretProviderClass{},
+		&v1alpha1.SecretProviderClassList{},
+		&v1alpha1.SecretProviderClassPodStatus{},
+		&v1alpha1.SecretProviderClassPodStatusList{},
+	)
+
+	ns, err := testNodeServer(nil, fake.NewFakeClientWithScheme(s, spc), "")
+	if err != nil {
+		t.Fatalf("expected error to be nil, got: %+v", err)
+	}
+	defer os.RemoveAll(ns.providerVolumePath)
+
+	server, err := providerfake.NewMocKCSIProviderServer(fmt.Sprintf("%s/provider1.sock", ns.providerVolumePath))
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	server.SetObjects(map[string]string{"secret/secret1": "v1"})
+	server.SetFiles(map[string]string{"secret1": "value1"})
+	server.Start()
+	defer server.Stop()
+
+	// the contents are being fetched for another pod of the namespace
+	key, err := mountCacheKey("", 0, map[string]string{"parameter1": "value1", csipodnamespace: "default", csipodsa: ""}, nil)
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	started := make(chan struct{})
+	release := make(chan struct{})
+	fetched := make(chan struct{})
+	go func() {
+		defer close(fetched)
+		ns.fetchFlights.do(context.TODO(), key, func() fetchResult {
+			close(started)
+			<-release
+			return fetchResult{
+				objectVersions: map[string]string{"secret/secret1": "v2"},
+				files:          []*providerv1alpha1.File{{Path: "secret1", Contents: []byte("value2")}},
+				providerName:   "provider1",
+			}
+		})
+	}()
+	<-started
+
+	publish := func(targetPath, podName string) error {
+		_, err := ns.NodePublishVolume(context.TODO(), &csi.NodePublishVolumeRequest{
+			VolumeCapability: &csi.VolumeCapability{},
+			VolumeId:         "testvolid1",
+			TargetPath:       targetPath,
+			VolumeContext:    map[string]string{"secretProviderClass": "provider1", csipodname: podName, csipodnamespace: "default", csipoduid: podName + "uid"},
+			Readonly:         true,
+		})
+		return err
+	}
+
+	// the pod mounted in the meantime gets the shared contents instead of
+	// calling the provider
+	targetPath := getTestTargetPath(t)
+	defer os.RemoveAll(targetPath)
+	done := make(chan error)
+	go func() {
+		done <- publish(targetPath, "pod2")
+	}()
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	<-fetched
+	contents, err := ioutil.ReadFile(filepath.Join(targetPath, "secret1"))
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	if string(contents) != "value2" {
+		t.Errorf("expected the shared contents of secret1: value2, got: %s", string(contents))
+	}
+
+	// the contents are fetched from the provider once the fetch completed
+	targetPath = getTestTargetPath(t)
+	defer os.RemoveAll(targetPath)
+	if err := publish(targetPath, "pod3"); err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	if contents, err = ioutil.ReadFile(filepath.Join(targetPath, "secret1")); err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	if string(contents) != "value1" {
+		t.Errorf("expected the contents of secret1: value1, got: %s", string(contents))
+	}
+}
+
+func TestNodePublishVolumeNestedFiles(t *testing.T) {
+	spc := &v1alpha1.SecretProviderClass{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "provider1",
+			Namespace: "default",
+			UID:       "spcuid1",
+		},
+		Spec: v1alpha1.SecretProviderClassSpec{
+			Provider:   "provider1",
+			Parameters: map[string]string{"parameter1": "value1"},
+			CacheTTL:   &metav1.Duration{Duration: time.Minute},
+		},
+	}
+	s := scheme.Scheme
+	s.AddKnownTypes(v1alpha1.GroupVersion,
+		&v1alpha1.SecretProviderClass{},
+		&v1alpha1.SecretProviderClassList{},
+		&v1alpha1.SecretProviderClassPodStatus{},
+		&v1alpha1.SecretProviderClassPodStatusList{},
+	)
+
+	ns, err := testNodeServer(nil, fake.NewFakeClientWithScheme(s, spc), "")
+	if err != nil {
+		t.Fatalf("expected error to be nil, got: %+v", err)
+	}
+	defer os.RemoveAll(ns.providerVolumePath)
+
+	server, err := providerfake.NewMocKCSIProviderServer(fmt.Sprintf("%s/provider1.sock", ns.providerVolumePath))
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	files := map[string]string{"secret1": "value1", "certs/tls.crt": "cert1"}
+	server.SetObjects(map[string]string{"secret/secret1": "v1", "secret/tls": "v1"})
+	server.SetFiles(files)
+	server.Start()
+	defer server.Stop()
+
+	expectFiles := func(targetPath string) {
+		for name, expected := range files {
+			content, err := ioutil.ReadFile(filepath.Join(targetPath, name))
+			if err != nil {
+				t.Fatalf("expected err to be nil, got: %+v", err)
+			}
+			if string(content) != expected {
+				t.Errorf("expected file content of %s: %s, got: %s", name, expected, string(content))
+			}
+		}
+	}
+
+	// the nested files are cached with the mounted contents
+	for i, pod := range []string{"pod1", "pod2"} {
+		if i > 0 {
+			server.SetReturnError(fmt.Errorf("provider unavailable"))
+		}
+		targetPath := getTestTargetPath(t)
+		defer os.RemoveAll(targetPath)
+
+		_, err = ns.NodePublishVolume(context.TODO(), &csi.NodePublishVolumeRequest{
+			VolumeCapability: &csi.VolumeCapability{},
+			VolumeId:         "testvolid1",
+			TargetPath:       targetPath,
+			VolumeContext:    map[string]string{"secretProviderClass": "provider1", csipodname: pod, csipodnamespace: "default", csipoduid: pod + "uid", csipodsa: "sa1"},
+			Readonly:         true,
+		})
+		if err != nil {
+			t.Fatalf("expected err to be nil for %s, got: %+v", pod, err)
+		}
+		expectFiles(targetPath)
+	}
+
+	// the nested files are shared with the pods mounted during the fetch
+	started := make(chan struct{})
+	release := make(chan struct{})
+	fetched := make(chan struct{})
+	targetPath := getTestTargetPath(t)
+	defer os.RemoveAll(targetPath)
+	go func() {
+		defer close(fetched)
+		ns.sharedMountProviders(context.TODO(), "key1", "provider1", targetPath, "pod3", "default", func() fetchResult {
+			close(started)
+			<-release
+			payloads := []*providerv1alpha1.File{{Path: "secret1", Contents: []byte("value1")}, {Path: "certs/tls.crt", Contents: []byte("cert1")}}
+			if err := fileutil.WritePayloads(targetPath, payloads); err != nil {
+				return fetchResult{err: err}
+			}
+			return fetchResult{providerName: "provider1"}
+		})
+	}()
+	<-started
+
+	sharedPath := getTestTargetPath(t)
+	defer os.RemoveAll(sharedPath)
+	done := make(chan fetchResult)
+	go func() {
+		done <- ns.sharedMountProviders(context.TODO(), "key1", "provider1", sharedPath, "pod4", "default", func() fetchResult {
+			return fetchResult{err: fmt.Errorf("expected the contents to be shared")}
+		})
+	}()
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	if result := <-done; result.err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", result.err)
+	}
+	<-fetched
+	expectFiles(sharedPath)
+}
+
+func TestNodePublishVolumeRepublish(t *testing.T) {
+	spc := &v1alpha1.SecretProviderClass{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "provider1",
+			Namespace: "default",
+		},
+		Spec: v1alpha1.SecretProviderClassSpec{
+			Provider:   "provider1",
+			Parameters: map[string]string{"parameter1": "value1"},
+		},
+	}
+	s := scheme.Scheme
+	s.AddKnownTypes(v1alpha1.GroupVersion,
+		&v1alpha1.SecretProviderClass{},
+		&v1alpha1.SecretProviderClassList{},
+		&v1alpha1.SecretProviderClassPodStatus{},
+		&v1alpha1.SecretProviderClassPodStatusList{},
+	)
+
+	ns, err := testNodeServer(nil, fake.NewFakeClientWithScheme(s, spc), "")
+	if err != nil {
+		t.Fatalf("expected error to be nil, got: %+v", err)
+	}
+	defer os.RemoveAll(ns.providerVolumePath)
+
+	server, err := providerfake.NewMocKCSIProviderServer(fmt.Sprintf("%s/provider1.sock", ns.providerVolumePath))
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	server.SetObjects(map[string]string{"secret/secret1": "v1"})
+	server.SetFiles(map[string]string{"secret1": "value1"})
+	server.Start()
+	defer server.Stop()
+
+	// the volume is unmounted from the target path of the pod
+	dir, targetPath := getTestRotationTargetPath(t, "poduid1", "secrets-store-inline")
+	defer os.RemoveAll(dir)
+	publish := func(tokens string) error {
+		_, err := ns.NodePublishVolume(context.TODO(), &csi.NodePublishVolumeRequest{
+			VolumeCapability: &csi.VolumeCapability{},
+			VolumeId:         "testvolid1",
+			TargetPath:       targetPath,
+			VolumeContext:    map[string]string{"secretProviderClass": "provider1", csipodname: "pod1", csipodnamespace: "default", csipoduid: "poduid1", csipodsatokens: tokens},
+			Readonly:         true,
+		})
+		return err
+	}
+
+	tokens1 := `{"vault":{"token":"token1","expirationTimestamp":"2021-01-01T10:00:00Z"}}`
+	if err = publish(tokens1); err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	// the tokens are passed to the provider
+	var attributes map[string]string
+	if err = json.Unmarshal([]byte(server.Attributes()), &attributes); err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	if attributes[csipodsatokens] != tokens1 {
+		t.Errorf("expected the service account tokens %s in the attributes, got: %+v", tokens1, attributes)
+	}
+
+	// the republish of the mounted volume refreshes the tokens without
+	// calling the provider again
+	server.SetReturnError(fmt.Errorf("provider called"))
+	tokens2 := `{"vault":{"token":"token2","expirationTimestamp":"2021-01-01T11:00:00Z"}}`
+	if err = publish(tokens2); err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	if tokens, _, _ := ns.serviceAccountTokens.get(targetPath); tokens != tokens2 {
+		t.Errorf("expected the refreshed tokens %s, got: %s", tokens2, tokens)
+	}
+	contents, err := ioutil.ReadFile(filepath.Join(targetPath, "secret1"))
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	if string(contents) != "value1" {
+		t.Errorf("expected contents of secret1: value1, got: %s", string(contents))
+	}
+
+	// the tokens are removed once the volume is unmounted, the fake mounter
+	// doesn't discard the contents of the tmpfs
+	files, err := ioutil.ReadDir(targetPath)
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	for _, file := range files {
+		os.RemoveAll(filepath.Join(targetPath, file.Name()))
+	}
+	if _, err = ns.NodeUnpublishVolume(context.TODO(), &csi.NodeUnpublishVolumeRequest{VolumeId: "testvolid1", TargetPath: targetPath}); err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	if _, _, ok := ns.serviceAccountTokens.get(targetPath); ok {
+		t.Errorf("expected the tokens to be removed once the volume is unmounted")
+	}
+}
+
+func TestNodePublishVolumeReaderOnlyAccessMode(t *testing.T) {
+	spc := &v1alpha1.SecretProviderClass{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "provider1",
+			Namespace: "default",
+		},
+		Spec: v1alpha1.SecretProviderClassSpec{
+			Provider:   "provider1",
+			Parameters: map[string]string{"parameter1": "value1"},
+		},
+	}
+	s := scheme.Scheme
+	s.AddKnownTypes(v1alpha1.GroupVersion,
+		&v1alpha1.SecretProviderClass{},
+		&v1alpha1.SecretProviderClassList{},
+		&v1alpha1.SecretProviderClassPodStatus{},
+		&v1alpha1.SecretProviderClassPodStatusList{},
+	)
+
+	ns, err := testNodeServer(nil, fake.NewFakeClientWithScheme(s, spc), "")
+	if err != nil {
+		t.Fatalf("expected error to be nil, got: %+v", err)
+	}
+	defer os.RemoveAll(ns.providerVolumePath)
+
+	server, err := providerfake.NewMocKCSIProviderServer(fmt.Sprintf("%s/provider1.sock", ns.providerVolumePath))
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	server.SetObjects(map[string]string{"secret/secret1": "v1"})
+	server.SetFiles(map[string]string{"secret1": "value1"})
+	server.Start()
+	defer server.Stop()
+
+	targetPath := getTestTargetPath(t)
+	defer os.RemoveAll(targetPath)
+	_, err = ns.NodePublishVolume(context.TODO(), &csi.NodePublishVolumeRequest{
+		// the kubelet doesn't set readonly for the generic ephemeral volumes
+		// with the ReadOnlyMany access mode
+		VolumeCapability: &csi.VolumeCapability{
+			AccessMode: &csi.VolumeCapability_AccessMode{Mode: csi.VolumeCapability_AccessMode_MULTI_NODE_READER_ONLY},
+		},
+		VolumeId:      "pvc-1",
+		TargetPath:    targetPath,
+		VolumeContext: map[string]string{"secretProviderClass": "provider1", csipodname: "pod1", csipodnamespace: "default", csipoduid: "poduid1"},
+	})
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+
+	contents, err := ioutil.ReadFile(filepath.Join(targetPath, "secret1"))
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	if string(contents) != "value1" {
+		t.Errorf("expected contents of secret1: value1, got: %s", string(contents))
+	}
+}
+
+func TestNodePublishVolumeMetadata(t *testing.T) {
+	spc := &v1alpha1.SecretProviderClass{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "provider1",
+			Namespace: "default",
+		},
+		Spec: v1alpha1.SecretProviderClassSpec{
+			Provider:      "provider1",
+			Parameters:    map[string]string{"parameter1": "value1"},
+			WriteMetadata: true,
+		},
+	}
+	s := scheme.Scheme
+	s.AddKnownTypes(v1alpha1.GroupVersion,
+		&v1alpha1.SecretProviderClass{},
+		&v1alpha1.SecretProviderClassList{},
+		&v1alpha1.SecretProviderClassPodStatus{},
+		&v1alpha1.SecretProviderClassPodStatusList{},
+	)
+
+	ns, err := testNodeServer(nil, fake.NewFakeClientWithScheme(s, spc), "")
+	if err != nil {
+		t.Fatalf("expected error to be nil, got: %+v", err)
+	}
+	defer os.RemoveAll(ns.providerVolumePath)
+
+	server, err := providerfake.NewMocKCSIProviderServer(fmt.Sprintf("%s/provider1.sock", ns.providerVolumePath))
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	server.SetObjects(map[string]string{"secret/secret1": "v1"})
+	server.SetFiles(map[string]string{"secret1": "value1"})
+	server.Start()
+	defer server.Stop()
+
+	targetPath := getTestTargetPath(t)
+	defer os.RemoveAll(targetPath)
+	_, err = ns.NodePublishVolume(context.TODO(), &csi.NodePublishVolumeRequest{
+		VolumeCapability: &csi.VolumeCapability{},
+		VolumeId:         "testvolid1",
+		TargetPath:       targetPath,
+		VolumeContext:    map[string]string{"secretProviderClass": "provider1", csipodname: "pod1", csipodnamespace: "default", csipoduid: "poduid1"},
+		Readonly:         true,
+	})
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+
+	metadata, err := fileutil.ReadMetadata(targetPath)
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	if len(metadata.Objects) != 1 {
+		t.Fatalf("expected 1 object in the metadata, got: %+v", metadata.Objects)
+	}
+	if object := metadata.Objects[0]; object.ID != "secret/secret1" || object.Version != "v1" || object.FetchTime.IsZero() {
+		t.Errorf("expected the metadata of secret/secret1 at version v1 with a fetch time, got: %+v", object)
+	}
+}
+
+func TestNodePublishVolumeProviderTimeout(t *testing.T) {
+	spc := &v1alpha1.SecretProviderClass{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "provider1",
+			Namespace: "default",
+		},
+		Spec: v1alpha1.SecretProviderClassSpec{
+			Provider:        "provider1",
+			Parameters:      map[string]string{"parameter1": "value1"},
+			ProviderTimeout: &metav1.Duration{Duration: 100 * time.Millisecond},
+		},
+	}
+	s := scheme.Scheme
+	s.AddKnownTypes(v1alpha1.GroupVersion,
+		&v1alpha1.SecretProviderClass{},
+		&v1alpha1.SecretProviderClassList{},
+	)
+
+	ns, err := testNodeServer(nil, fake.NewFakeClientWithScheme(s, spc), "")
+	if err != nil {
+		t.Fatalf("expected error to be nil, got: %+v", err)
+	}
+	defer os.RemoveAll(ns.providerVolumePath)
+
+	// provider binary that doesn't respond within the provider timeout
+	if err := os.MkdirAll(filepath.Join(ns.providerVolumePath, "provider1"), 0755); err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	if err := ioutil.WriteFile(ns.getProviderPath("linux", "provider1"), []byte("#!/bin/sh\nexec sleep 10\n"), 0755); err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+
+	targetPath := getTestTargetPath(t)
+	defer os.RemoveAll(targetPath)
+
+	start := time.Now()
+	_, err = ns.NodePublishVolume(context.TODO(), &csi.NodePublishVolumeRequest{
+		VolumeCapability: &csi.VolumeCapability{},
+		VolumeId:         "testvolid1",
+		TargetPath:       targetPath,
+		VolumeContext:    map[string]string{"secretProviderClass": "provider1", csipodname: "pod1", csipodnamespace: "default", csipoduid: "poduid1"},
+		Readonly:         true,
+	})
+	if status.Code(err) != codes.DeadlineExceeded {
+		t.Fatalf("expected err code: %v, got: %+v", codes.DeadlineExceeded, err)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Errorf("expected the provider call to be cancelled after the provider timeout")
+	}
+}
+
+func TestNodePublishVolumeMountTimeout(t *testing.T) {
+	spc := &v1alpha1.SecretProviderClass{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "provider1",
+			Namespace: "default",
+		},
+		Spec: v1alpha1.SecretProviderClassSpec{
+			Provider:   "provider1",
+			Parameters: map[string]string{"parameter1": "value1"},
+		},
+	}
+	s := scheme.Scheme
+	s.AddKnownTypes(v1alpha1.GroupVersion,
+		&v1alpha1.SecretProviderClass{},
+		&v1alpha1.SecretProviderClassList{},
+	)
+
+	ns, err := testNodeServer(nil, fake.NewFakeClientWithScheme(s, spc), "")
+	if err != nil {
+		t.Fatalf("expected error to be nil, got: %+v", err)
+	}
+	defer os.RemoveAll(ns.providerVolumePath)
+	ns.mountTimeout = MountTimeout{Timeout: 300 * time.Millisecond, WriteTimeout: 200 * time.Millisecond}
+
+	// provider binary that doesn't respond within the fetch phase of the mount
+	if err := os.MkdirAll(filepath.Join(ns.providerVolumePath, "provider1"), 0755); err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	if err := ioutil.WriteFile(ns.getProviderPath("linux", "provider1"), []byte("#!/bin/sh\nexec sleep 10\n"), 0755); err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+
+	targetPath := getTestTargetPath(t)
+	defer os.RemoveAll(targetPath)
+
+	start := time.Now()
+	_, err = ns.NodePublishVolume(context.TODO(), &csi.NodePublishVolumeRequest{
+		VolumeCapability: &csi.VolumeCapability{},
+		VolumeId:         "testvolid1",
+		TargetPath:       targetPath,
+		VolumeContext:    map[string]string{"secretProviderClass": "provider1", csipodname: "pod1", csipodnamespace: "default", csipoduid: "poduid1"},
+		Readonly:         true,
+	})
+	if status.Code(err) != codes.DeadlineExceeded {
+		t.Fatalf("expected err code: %v, got: %+v", codes.DeadlineExceeded, err)
+	}
+	if !strings.Contains(err.Error(), "fetching the contents from the providers didn't complete within 100ms of the 300ms mount timeout") {
+		t.Errorf("expected err to name the fetch phase, got: %+v", err)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Errorf("expected the provider call to be cancelled after the fetch timeout")
+	}
+
+	select {
+	case event := <-ns.eventRecorder.(*record.FakeRecorder).Events:
+		if !strings.HasPrefix(event, "Warning MountFetchTimeout") {
+			t.Errorf("expected MountFetchTimeout event, got: %s", event)
+		}
+	default:
+		t.Errorf("expected MountFetchTimeout event to be recorded")
+	}
+}
+
+func TestNodePublishVolumeInProgress(t *testing.T) {
+	ns, err := testNodeServer(nil, fake.NewFakeClientWithScheme(scheme.Scheme), "")
+	if err != nil {
+		t.Fatalf("expected error to be nil, got: %+v", err)
+	}
+	defer os.RemoveAll(ns.providerVolumePath)
+
+	targetPath := getTestTargetPath(t)
+	defer os.RemoveAll(targetPath)
+	unlock, err := ns.mountPool.lockVolume(context.TODO(), volumeKey("testvolid1", targetPath))
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	req := &csi.NodePublishVolumeRequest{
+		VolumeCapability: &csi.VolumeCapability{},
+		VolumeId:         "testvolid1",
+		TargetPath:       targetPath,
+		VolumeContext:    map[string]string{"secretProviderClass": "provider1", csipodname: "pod1", csipodnamespace: "default", csipoduid: "poduid1"},
+		Readonly:         true,
+	}
+
+	// the requests wait for the request in progress until the context is done
+	ctx, cancel := context.WithTimeout(context.TODO(), 10*time.Millisecond)
+	defer cancel()
+	_, err = ns.NodeUnpublishVolume(ctx, &csi.NodeUnpublishVolumeRequest{
+		VolumeId:   "testvolid1",
+		TargetPath: targetPath,
+	})
+	if status.Code(err) != codes.Aborted {
+		t.Fatalf("expected err code: %v, got: %+v", codes.Aborted, err)
+	}
+	_, err = ns.NodePublishVolume(ctx, req)
+	if status.Code(err) != codes.DeadlineExceeded {
+		t.Fatalf("expected err code: %v, got: %+v", codes.DeadlineExceeded, err)
+	}
+	if _, inFlight := ns.mountFlights.flights[volumeKey("testvolid1", targetPath)]; !inFlight {
+		t.Fatalf("expected the mount to keep running once the request timed out")
+	}
+
+	// the mount of another pod using the same persistent volume doesn't wait
+	// for the mount in progress
+	otherTargetPath := getTestTargetPath(t)
+	defer os.RemoveAll(otherTargetPath)
+	_, err = ns.NodePublishVolume(context.TODO(), &csi.NodePublishVolumeRequest{
+		VolumeCapability: &csi.VolumeCapability{},
+		VolumeId:         "testvolid1",
+		TargetPath:       otherTargetPath,
+		VolumeContext:    map[string]string{"secretProviderClass": "provider1", csipodname: "pod2", csipodnamespace: "default", csipoduid: "poduid2"},
+		Readonly:         true,
+	})
+	if err == nil || status.Code(err) == codes.DeadlineExceeded || status.Code(err) == codes.Aborted {
+		t.Fatalf("expected the mount error of the other pod, got: %+v", err)
+	}
+
+	// the retry gets the result of the mount in progress, which fails as the
+	// secret provider class doesn't exist
+	unlock()
+	_, err = ns.NodePublishVolume(context.TODO(), req)
+	if err == nil || status.Code(err) == codes.DeadlineExceeded {
+		t.Fatalf("expected the mount error, got: %+v", err)
+	}
+}
+
+func TestNodePublishVolumeFallbackProvider(t *testing.T) {
+	cases := []struct {
+		name             string
+		primaryUnhealthy bool
+		primaryError     error
+		fallbackError    error
+		expectedContent  string
+		expectedErr      bool
+	}{
+		{
+			name:            "primary provider succeeds",
+			expectedContent: "primary",
+		},
+		{
+			name:            "primary provider fails",
+			primaryError:    fmt.Errorf("region unavailable"),
+			expectedContent: "fallback",
+		},
+		{
+			name:             "primary provider unhealthy",
+			primaryUnhealthy: true,
+			expectedContent:  "fallback",
+		},
+		{
+			name:          "primary and fallback providers fail",
+			primaryError:  fmt.Errorf("region unavailable"),
+			fallbackError: fmt.Errorf("region unavailable"),
+			expectedErr:   true,
+		},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			spc := &v1alpha1.SecretProviderClass{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "provider1",
+					Namespace: "default",
+				},
+				Spec: v1alpha1.SecretProviderClassSpec{
+					Provider:   "provider1",
+					Parameters: map[string]string{"parameter1": "value1"},
+					Fallback: &v1alpha1.FallbackProvider{
+						Provider:   "provider2",
+						Parameters: map[string]string{"parameter1": "value2"},
+					},
+				},
+			}
+			s := scheme.Scheme
+			s.AddKnownTypes(v1alpha1.GroupVersion,
+				&v1alpha1.SecretProviderClass{},
+				&v1alpha1.SecretProviderClassList{},
+				&v1alpha1.SecretProviderClassPodStatus{},
+				&v1alpha1.SecretProviderClassPodStatusList{},
+			)
+
+			ns, err := testNodeServer(nil, fake.NewFakeClientWithScheme(s, spc), "")
+			if err != nil {
+				t.Fatalf("expected error to be nil, got: %+v", err)
+			}
+			defer os.RemoveAll(ns.providerVolumePath)
+
+			for provider, content := range map[string]string{"provider1": "primary", "provider2": "fallback"} {
+				server, err := providerfake.NewMocKCSIProviderServer(fmt.Sprintf("%s/%s.sock", ns.providerVolumePath, provider))
+				if err != nil {
+					t.Fatalf("expected err to be nil, got: %+v", err)
+				}
+				server.SetObjects(map[string]string{"secret/secret1": "v1"})
+				server.SetFiles(map[string]string{"secret1": content})
+				if provider == "provider1" {
+					server.SetHealth(!test.primaryUnhealthy, "backend not reachable")
+					server.SetReturnError(test.primaryError)
+				} else {
+					server.SetReturnError(test.fallbackError)
+				}
+				server.Start()
+			}
+			ns.providerClients.checkHealth()
+
+			targetPath := getTestTargetPath(t)
+			defer os.RemoveAll(targetPath)
+
+			_, err = ns.NodePublishVolume(context.TODO(), &csi.NodePublishVolumeRequest{
+				VolumeCapability: &csi.VolumeCapability{},
+				VolumeId:         "testvolid1",
+				TargetPath:       targetPath,
+				VolumeContext:    map[string]string{"secretProviderClass": "provider1", csipodname: "pod1", csipodnamespace: "default", csipoduid: "poduid1"},
+				Readonly:         true,
+			})
+			if test.expectedErr {
+				if err == nil {
+					t.Fatalf("expected err to be not nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected err to be nil, got: %+v", err)
+			}
+			content, err := ioutil.ReadFile(filepath.Join(targetPath, "secret1"))
+			if err != nil {
+				t.Fatalf("expected err to be nil, got: %+v", err)
+			}
+			if string(content) != test.expectedContent {
+				t.Errorf("expected file content: %s, got: %s", test.expectedContent, string(content))
+			}
+		})
+	}
+}
+
+func TestNodePublishVolumeAdditionalProviders(t *testing.T) {
+	cases := []struct {
+		name                  string
+		files                 map[string]map[string]string
+		expectedFiles         map[string]string
+		expectedObjectVersion map[string]string
+		expectedErr           bool
+	}{
+		{
+			name: "files merged from all providers",
+			files: map[string]map[string]string{
+				"provider1": {"secret1": "value1"},
+				"provider2": {"secret2": "value2", "secret3": "value3"},
+			},
+			expectedFiles:         map[string]string{"secret1": "value1", "secret2": "value2", "secret3": "value3"},
+			expectedObjectVersion: map[string]string{"provider1/secret1": "v1", "provider2/secret2": "v1", "provider2/secret3": "v1"},
+		},
+		{
+			name: "file path collision",
+			files: map[string]map[string]string{
+				"provider1": {"secret1": "value1"},
+				"provider2": {"secret1": "value2"},
+			},
+			expectedErr: true,
+		},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			spc := &v1alpha1.SecretProviderClass{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "provider1",
+					Namespace: "default",
+				},
+				Spec: v1alpha1.SecretProviderClassSpec{
+					Provider:   "provider1",
+					Parameters: map[string]string{"parameter1": "value1"},
+					AdditionalProviders: []*v1alpha1.AdditionalProvider{
+						{
+							Provider:   "provider2",
+							Parameters: map[string]string{"parameter1": "value2"},
+						},
+					},
+				},
+			}
+			s := scheme.Scheme
+			s.AddKnownTypes(v1alpha1.GroupVersion,
+				&v1alpha1.SecretProviderClass{},
+				&v1alpha1.SecretProviderClassList{},
+				&v1alpha1.SecretProviderClassPodStatus{},
+				&v1alpha1.SecretProviderClassPodStatusList{},
+			)
+			c := fake.NewFakeClientWithScheme(s, spc)
+
+			ns, err := testNodeServer(nil, c, "")
+			if err != nil {
+				t.Fatalf("expected error to be nil, got: %+v", err)
+			}
+			defer os.RemoveAll(ns.providerVolumePath)
+
+			for provider, files := range test.files {
+				server, err := providerfake.NewMocKCSIProviderServer(fmt.Sprintf("%s/%s.sock", ns.providerVolumePath, provider))
+				if err != nil {
+					t.Fatalf("expected err to be nil, got: %+v", err)
+				}
+				objects := make(map[string]string)
+				for file := range files {
+					objects[provider+"/"+file] = "v1"
+				}
+				server.SetObjects(objects)
+				server.SetFiles(files)
+				server.Start()
+			}
+
+			targetPath := getTestTargetPath(t)
+			defer os.RemoveAll(targetPath)
+
+			_, err = ns.NodePublishVolume(context.TODO(), &csi.NodePublishVolumeRequest{
+				VolumeCapability: &csi.VolumeCapability{},
+				VolumeId:         "testvolid1",
+				TargetPath:       targetPath,
+				VolumeContext:    map[string]string{"secretProviderClass": "provider1", csipodname: "pod1", csipodnamespace: "default", csipoduid: "poduid1"},
+				Readonly:         true,
+			})
+			if test.expectedErr {
+				if err == nil || !strings.Contains(err.Error(), "already mounted by another provider") {
+					t.Fatalf("expected file path collision err, got: %+v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected err to be nil, got: %+v", err)
+			}
+
+			files, err := ioutil.ReadDir(targetPath)
+			if err != nil {
+				t.Fatalf("expected err to be nil, got: %+v", err)
+			}
+			// the data version file, the data directory and its symlink are
+			// written with the mounted files
+			if len(files) != len(test.expectedFiles)+3 {
+				t.Errorf("expected %d files, the data version file and the data directory in the target path, got: %d", len(test.expectedFiles), len(files))
+			}
+			if _, err := os.Stat(filepath.Join(targetPath, fileutil.DataVersionFile)); err != nil {
+				t.Errorf("expected data version file to be written, got: %+v", err)
+			}
+			for file, expectedContent := range test.expectedFiles {
+				content, err := ioutil.ReadFile(filepath.Join(targetPath, file))
+				if err != nil {
+					t.Fatalf("expected err to be nil, got: %+v", err)
+				}
+				if string(content) != expectedContent {
+					t.Errorf("expected file content: %s, got: %s", expectedContent, string(content))
+				}
+			}
+
+			spcps := &v1alpha1.SecretProviderClassPodStatus{}
+			if err := c.Get(context.TODO(), client.ObjectKey{Name: "pod1-default-provider1", Namespace: "default"}, spcps); err != nil {
+				t.Fatalf("expected err to be nil, got: %+v", err)
+			}
+			objectVersions := make(map[string]string)
+			for _, object := range spcps.Status.Objects {
+				objectVersions[object.ID] = object.Version
+			}
+			if !reflect.DeepEqual(objectVersions, test.expectedObjectVersion) {
+				t.Errorf("expected object versions: %v, got: %v", test.expectedObjectVersion, objectVersions)
+			}
+		})
+	}
+}
+
+func TestNodePublishVolumeProvidersAllowlist(t *testing.T) {
+	cases := []struct {
+		name        string
+		allowlist   string
+		expectedErr bool
+	}{
+		{
+			name: "allowlist not set",
+		},
+		{
+			name:      "primary and fallback providers allowed",
+			allowlist: "provider1, provider2",
+		},
+		{
+			name:        "fallback provider not allowed",
+			allowlist:   "provider1",
+			expectedErr: true,
+		},
+		{
+			name:        "primary provider not allowed",
+			allowlist:   "provider2",
+			expectedErr: true,
+		},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			spc := &v1alpha1.SecretProviderClass{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "provider1",
+					Namespace: "default",
+				},
+				Spec: v1alpha1.SecretProviderClassSpec{
+					Provider:   "provider1",
+					Parameters: map[string]string{"parameter1": "value1"},
+					Fallback: &v1alpha1.FallbackProvider{
+						Provider: "provider2",
+					},
+				},
+			}
+			s := scheme.Scheme
+			s.AddKnownTypes(v1alpha1.GroupVersion,
+				&v1alpha1.SecretProviderClass{},
+				&v1alpha1.SecretProviderClassList{},
+				&v1alpha1.SecretProviderClassPodStatus{},
+				&v1alpha1.SecretProviderClassPodStatusList{},
+			)
+
+			ns, err := testNodeServer(nil, fake.NewFakeClientWithScheme(s, spc), "")
+			if err != nil {
+				t.Fatalf("expected error to be nil, got: %+v", err)
+			}
+			defer os.RemoveAll(ns.providerVolumePath)
+			ns.allowedProviders = parseProvidersAllowlist(test.allowlist)
+
+			server, err := providerfake.NewMocKCSIProviderServer(fmt.Sprintf("%s/provider1.sock", ns.providerVolumePath))
+			if err != nil {
+				t.Fatalf("expected err to be nil, got: %+v", err)
+			}
+			server.SetObjects(map[string]string{"secret/secret1": "v1"})
+			server.SetFiles(map[string]string{"secret1": "primary"})
+			server.Start()
+
+			targetPath := getTestTargetPath(t)
+			defer os.RemoveAll(targetPath)
+
+			_, err = ns.NodePublishVolume(context.TODO(), &csi.NodePublishVolumeRequest{
+				VolumeCapability: &csi.VolumeCapability{},
+				VolumeId:         "testvolid1",
+				TargetPath:       targetPath,
+				VolumeContext:    map[string]string{"secretProviderClass": "provider1", csipodname: "pod1", csipodnamespace: "default", csipoduid: "poduid1"},
+				Readonly:         true,
+			})
+			if test.expectedErr {
+				if status.Code(err) != codes.PermissionDenied {
+					t.Fatalf("expected err code to be %v, got: %+v", codes.PermissionDenied, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected err to be nil, got: %+v", err)
+			}
+		})
+	}
+}
+
+func TestNodePublishVolumeQuota(t *testing.T) {
+	spc := &v1alpha1.SecretProviderClass{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "provider1",
+			Namespace: "default",
+		},
+		Spec: v1alpha1.SecretProviderClassSpec{
+			Provider:   "provider1",
+			Parameters: map[string]string{"parameter1": "value1"},
+		},
+	}
+	s := scheme.Scheme
+	s.AddKnownTypes(v1alpha1.GroupVersion,
+		&v1alpha1.SecretProviderClass{},
+		&v1alpha1.SecretProviderClassList{},
+		&v1alpha1.SecretProviderClassPodStatus{},
+		&v1alpha1.SecretProviderClassPodStatusList{},
+	)
+
+	ns, err := testNodeServer(nil, fake.NewFakeClientWithScheme(s, spc), "")
+	if err != nil {
+		t.Fatalf("expected error to be nil, got: %+v", err)
+	}
+	defer os.RemoveAll(ns.providerVolumePath)
+
+	server, err := providerfake.NewMocKCSIProviderServer(fmt.Sprintf("%s/provider1.sock", ns.providerVolumePath))
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	server.SetObjects(map[string]string{"secret/secret1": "v1", "secret/secret2": "v1"})
+	server.SetFiles(map[string]string{"secret1": "value1", "secret2": "value2"})
+	server.Start()
+
+	cases := []struct {
+		name          string
+		quota         VolumeQuota
+		expectedEvent bool
+	}{
+		{
+			name:  "within the quota",
+			quota: VolumeQuota{MaxSize: 12, MaxFiles: 2},
+		},
+		{
+			name:          "size above the quota",
+			quota:         VolumeQuota{MaxSize: 11},
+			expectedEvent: true,
+		},
+		{
+			name:          "files above the quota",
+			quota:         VolumeQuota{MaxFiles: 1},
+			expectedEvent: true,
+		},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			targetPath := getTestTargetPath(t)
+			defer os.RemoveAll(targetPath)
+			ns.volumeQuota = test.quota
+
+			_, err := ns.NodePublishVolume(context.TODO(), &csi.NodePublishVolumeRequest{
+				VolumeCapability: &csi.VolumeCapability{},
+				VolumeId:         "testvolid1",
+				TargetPath:       targetPath,
+				VolumeContext:    map[string]string{"secretProviderClass": "provider1", csipodname: "pod1", csipodnamespace: "default", csipoduid: "poduid1"},
+				Readonly:         true,
+			})
+			if test.expectedEvent != (err != nil) {
+				t.Fatalf("expected err: %v, got: %+v", test.expectedEvent, err)
+			}
+			if test.expectedEvent && status.Code(err) != codes.ResourceExhausted {
+				t.Errorf("expected code: %v, got: %v", codes.ResourceExhausted, status.Code(err))
+			}
+
+			select {
+			case event := <-ns.eventRecorder.(*record.FakeRecorder).Events:
+				if !test.expectedEvent || !strings.HasPrefix(event, "Warning VolumeQuotaExceeded") {
+					t.Errorf("expected VolumeQuotaExceeded event: %v, got: %s", test.expectedEvent, event)
+				}
+			default:
+				if test.expectedEvent {
+					t.Errorf("expected VolumeQuotaExceeded event to be recorded")
+				}
+			}
+		})
+	}
+}
+
+func TestNodePublishVolumeProviderErrorEvent(t *testing.T) {
+	spc := &v1alpha1.SecretProviderClass{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "provider1",
+			Namespace: "default",
+		},
+		Spec: v1alpha1.SecretProviderClassSpec{
+			Provider:   "provider1",
+			Parameters: map[string]string{"parameter1": "value1"},
+		},
+	}
+	s := scheme.Scheme
+	s.AddKnownTypes(v1alpha1.GroupVersion,
+		&v1alpha1.SecretProviderClass{},
+		&v1alpha1.SecretProviderClassList{},
+		&v1alpha1.SecretProviderClassPodStatus{},
+		&v1alpha1.SecretProviderClassPodStatusList{},
+	)
+
+	ns, err := testNodeServer(nil, fake.NewFakeClientWithScheme(s, spc), "")
+	if err != nil {
+		t.Fatalf("expected error to be nil, got: %+v", err)
+	}
+	defer os.RemoveAll(ns.providerVolumePath)
+
+	server, err := providerfake.NewMocKCSIProviderServer(fmt.Sprintf("%s/provider1.sock", ns.providerVolumePath))
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	server.SetProviderErrorCode("AccessDenied")
+	server.SetProviderErrorReason(providerv1alpha1.ErrorReason_AUTH_FAILURE, "role is not authorized to read secret1")
+	server.Start()
+
+	targetPath := getTestTargetPath(t)
+	defer os.RemoveAll(targetPath)
+
+	_, err = ns.NodePublishVolume(context.TODO(), &csi.NodePublishVolumeRequest{
+		VolumeCapability: &csi.VolumeCapability{},
+		VolumeId:         "testvolid1",
+		TargetPath:       targetPath,
+		VolumeContext:    map[string]string{"secretProviderClass": "provider1", csipodname: "pod1", csipodnamespace: "default", csipoduid: "poduid1"},
+		Readonly:         true,
+	})
+	if err == nil {
+		t.Fatalf("expected err to be not nil")
+	}
+
+	select {
+	case event := <-ns.eventRecorder.(*record.FakeRecorder).Events:
+		if !strings.HasPrefix(event, "Warning ProviderAuthFailure") || !strings.Contains(event, "role is not authorized to read secret1") {
+			t.Errorf("expected ProviderAuthFailure event, got: %s", event)
+		}
+	default:
+		t.Errorf("expected ProviderAuthFailure event to be recorded")
+	}
+}
+
+func TestNodePublishVolumeMountOptions(t *testing.T) {
+	cases := []struct {
+		name           string
+		tmpfsSize      int64
+		tmpfsBacked    bool
+		mountFlags     []string
+		seLinuxContext bool
+		seLinuxOptions *corev1.SELinuxOptions
+		expectedOpts   []string
+		expectedEvent  string
+	}{
+		{
+			name:        "tmpfs not limited",
+			tmpfsBacked: true,
+		},
+		{
+			name:         "tmpfs size limit",
+			tmpfsSize:    10 * 1024 * 1024,
+			tmpfsBacked:  true,
+			expectedOpts: []string{"size=10485760"},
+		},
+		{
+			name:          "target path not backed by tmpfs",
+			expectedEvent: "Warning TargetPathNotTmpfs",
+		},
+		{
+			name:           "default selinux context",
+			tmpfsBacked:    true,
+			seLinuxContext: true,
+			expectedOpts:   []string{`context="system_u:object_r:container_file_t:s0"`},
+		},
+		{
+			name:           "selinux context of the pod",
+			tmpfsSize:      1024,
+			tmpfsBacked:    true,
+			seLinuxContext: true,
+			seLinuxOptions: &corev1.SELinuxOptions{Level: "s0:c1,c2"},
+			expectedOpts:   []string{`context="system_u:object_r:container_file_t:s0:c1,c2"`, "size=1024"},
+		},
+		{
+			name:           "selinux context of the mount flags",
+			tmpfsBacked:    true,
+			mountFlags:     []string{`context="system_u:object_r:container_file_t:s0:c3,c4"`},
+			seLinuxContext: true,
+			seLinuxOptions: &corev1.SELinuxOptions{Level: "s0:c1,c2"},
+			expectedOpts:   []string{`context="system_u:object_r:container_file_t:s0:c3,c4"`},
+		},
+	}
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			spc := &v1alpha1.SecretProviderClass{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "provider1",
+					Namespace: "default",
+				},
+				Spec: v1alpha1.SecretProviderClassSpec{
+					Provider:   "provider1",
+					Parameters: map[string]string{"parameter1": "value1"},
+				},
+			}
+			s := scheme.Scheme
+			s.AddKnownTypes(v1alpha1.GroupVersion,
+				&v1alpha1.SecretProviderClass{},
+				&v1alpha1.SecretProviderClassList{},
+				&v1alpha1.SecretProviderClassPodStatus{},
+				&v1alpha1.SecretProviderClassPodStatusList{},
+			)
+
+			ns, err := testNodeServer(nil, fake.NewFakeClientWithScheme(s, spc), "")
+			if err != nil {
+				t.Fatalf("expected error to be nil, got: %+v", err)
+			}
+			defer os.RemoveAll(ns.providerVolumePath)
+			ns.tmpfsSize = test.tmpfsSize
+			ns.tmpfsBacked = func(string) (bool, error) { return test.tmpfsBacked, nil }
+			ns.seLinuxContext = test.seLinuxContext
+			ns.seLinuxEnabled = func() bool { return true }
+			ns.kubeClient = kubefake.NewSimpleClientset(&corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: "pod1", Namespace: "default"},
+				Spec:       corev1.PodSpec{SecurityContext: &corev1.PodSecurityContext{SELinuxOptions: test.seLinuxOptions}},
+			})
+
+			server, err := providerfake.NewMocKCSIProviderServer(fmt.Sprintf("%s/provider1.sock", ns.providerVolumePath))
+			if err != nil {
+				t.Fatalf("expected err to be nil, got: %+v", err)
+			}
+			server.SetObjects(map[string]string{"secret/secret1": "v1"})
+			server.SetFiles(map[string]string{"secret1": "value1"})
+			server.Start()
+			defer server.Stop()
+
+			targetPath := getTestTargetPath(t)
+			defer os.RemoveAll(targetPath)
+
+			_, err = ns.NodePublishVolume(context.TODO(), &csi.NodePublishVolumeRequest{
+				VolumeCapability: &csi.VolumeCapability{
+					AccessType: &csi.VolumeCapability_Mount{Mount: &csi.VolumeCapability_MountVolume{MountFlags: test.mountFlags}},
+				},
+				VolumeId:      "testvolid1",
+				TargetPath:    targetPath,
+				VolumeContext: map[string]string{"secretProviderClass": "provider1", csipodname: "pod1", csipodnamespace: "default", csipoduid: "poduid1"},
+				Readonly:      true,
+			})
+			mnts, listErr := ns.mounter.List()
+			if listErr != nil {
+				t.Fatalf("expected err to be nil, got: %v", listErr)
+			}
+			if len(test.expectedEvent) > 0 {
+				if err == nil {
+					t.Fatalf("expected err to be not nil")
+				}
+				// the target path is unmounted before any file is written
+				if len(mnts) != 0 {
+					t.Errorf("expected mount points to be 0, got: %d", len(mnts))
+				}
+				select {
+				case event := <-ns.eventRecorder.(*record.FakeRecorder).Events:
+					if !strings.HasPrefix(event, test.expectedEvent) {
+						t.Errorf("expected %s event, got: %s", test.expectedEvent, event)
+					}
+				default:
+					t.Errorf("expected %s event to be recorded", test.expectedEvent)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected err to be nil, got: %+v", err)
+			}
+			if len(mnts) != 1 || strings.Join(mnts[0].Opts, ",") != strings.Join(test.expectedOpts, ",") {
+				t.Errorf("expected tmpfs mount point with options %v, got: %+v", test.expectedOpts, mnts)
+			}
+		})
+	}
+}
+
+func TestMountSecretsStoreObjectContent(t *testing.T) {
+	tests := []struct {
+		name                 string
+		attributes           string
+		secrets              string
+		targetPath           string
+		permission           string
+		grpcSupportProviders string
+		expectedErrorReason  string
+		expectedErr          bool
+	}{
+		{
+			name:        "attributes empty",
+			expectedErr: true,
+		},
+		{
+			name:        "target path empty",
+			attributes:  "{}",
+			expectedErr: true,
+		},
+		{
+			name:        "permission not set",
+			attributes:  "{}",
+			targetPath:  getTestTargetPath(t),
+			expectedErr: true,
+		},
+		{
+			name:                "provider binary not found",
+			attributes:          "{}",
+			targetPath:          getTestTargetPath(t),
+			permission:          fmt.Sprint(permission),
+			expectedErrorReason: ProviderBinaryNotFound,
+			expectedErr:         true,
+		},
+		{
+			name:                 "failed to create provider grpc client",
+			attributes:           "{}",
+			targetPath:           getTestTargetPath(t),
+			permission:           fmt.Sprint(permission),
+			grpcSupportProviders: "provider1",
+			expectedErrorReason:  FailedToCreateProviderGRPCClient,
+			expectedErr:          true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ns, err := testNodeServer(nil, fake.NewFakeClientWithScheme(nil), test.grpcSupportProviders)
+			if err != nil {
+				t.Fatalf("expected error to be nil, got: %+v", err)
+			}
+			_, _, errorReason, err := ns.mountSecretsStoreObjectContent(context.TODO(), "provider1", test.attributes, test.secrets, test.targetPath, test.permission, RetryPolicy{})
+			if errorReason != test.expectedErrorReason {
+				t.Fatalf("expected error reason to be %s, got: %s", test.expectedErrorReason, errorReason)
+			}
+			if test.expectedErr && err == nil || !test.expectedErr && err != nil {
+				t.Fatalf("expected err: %v, got: %+v", test.expectedErr, err)
+			}
+		})
+	}
+}
+
+func TestProviderCallCode(t *testing.T) {
+	cancelledCtx, cancel := context.WithCancel(context.Background())
+	cancel()
+	timedOutCtx, cancel := context.WithTimeout(context.Background(), 0)
+	defer cancel()
+
+	cases := []struct {
+		name         string
+		ctx          context.Context
+		err          error
+		expectedCode codes.Code
+	}{
+		{
+			name:         "no error",
+			ctx:          context.Background(),
+			expectedCode: codes.OK,
+		},
+		{
+			name:         "grpc error",
+			ctx:          context.Background(),
+			err:          status.Error(codes.Unavailable, "provider unavailable"),
+			expectedCode: codes.Unavailable,
+		},
+		{
+			name:         "provider binary error",
+			ctx:          context.Background(),
+			err:          fmt.Errorf("exit status 1"),
+			expectedCode: codes.Unknown,
+		},
+		{
+			name:         "provider binary timed out",
+			ctx:          timedOutCtx,
+			err:          fmt.Errorf("signal: killed"),
+			expectedCode: codes.DeadlineExceeded,
+		},
+		{
+			name:         "provider binary cancelled",
+			ctx:          cancelledCtx,
+			err:          fmt.Errorf("signal: killed"),
+			expectedCode: codes.Canceled,
+		},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			if code := providerCallCode(test.ctx, test.err); code != test.expectedCode {
+				t.Errorf("expected code: %v, got: %v", test.expectedCode, code)
+			}
+		})
+	}
+}
+
+func TestWarnSubPathMounts(t *testing.T) {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "pod1", Namespace: "default", UID: "poduid1"},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{
+				{Name: "app", VolumeMounts: []corev1.VolumeMount{{Name: "secrets", MountPath: "/etc/app/tls.crt", SubPath: "tls.crt"}}},
+				{Name: "sidecar", VolumeMounts: []corev1.VolumeMount{{Name: "secrets", MountPath: "/mnt/secrets"}}},
+			},
+		},
+	}
+
+	cases := []struct {
+		name          string
+		targetPath    string
+		expectedEvent bool
+	}{
+		{
+			name:          "volume mounted with subPath",
+			targetPath:    "/var/lib/kubelet/pods/poduid1/volumes/kubernetes.io~csi/secrets/mount",
+			expectedEvent: true,
+		},
+		{
+			name:       "volume mounted without subPath",
+			targetPath: "/var/lib/kubelet/pods/poduid1/volumes/kubernetes.io~csi/other/mount",
+		},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			ns := &nodeServer{eventRecorder: record.NewFakeRecorder(10)}
+			ns.warnSubPathMounts(pod, test.targetPath)
+
+			select {
+			case event := <-ns.eventRecorder.(*record.FakeRecorder).Events:
+				if !test.expectedEvent {
+					t.Fatalf("expected no event, got: %s", event)
+				}
+				if !strings.HasPrefix(event, "Warning SubPathMount") || !strings.Contains(event, "containers app mount volume secrets") {
+					t.Errorf("expected SubPathMount event, got: %s", event)
+				}
+			default:
+				if test.expectedEvent {
+					t.Errorf("expected SubPathMount event to be recorded")
+				}
 			}
 		})
 	}
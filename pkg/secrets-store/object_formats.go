@@ -0,0 +1,144 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package secretsstore
+
+import (
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+
+	"sigs.k8s.io/secrets-store-csi-driver/apis/v1alpha1"
+)
+
+const (
+	// splitPEMKeyFile is the file of the private key of a split PEM bundle
+	splitPEMKeyFile = "tls.key"
+	// splitPEMCertFile is the file of the first certificate of a split PEM
+	// bundle
+	splitPEMCertFile = "tls.crt"
+	// splitPEMCAFile is the file of the other certificates of a split PEM
+	// bundle, the CA chain
+	splitPEMCAFile = "ca.crt"
+)
+
+// isSplitFormat returns true if the mounted objects of the format are written
+// to a directory of files instead of a single file
+func isSplitFormat(format v1alpha1.ObjectFormat) bool {
+	return format == v1alpha1.ObjectFormatSplitKeys || format == v1alpha1.ObjectFormatSplitPEM
+}
+
+// splitObjectDirs returns the paths relative to the target path of the
+// directories of the mounted objects that are split into files
+func splitObjectDirs(mountedObjects []*v1alpha1.MountedObject) []string {
+	var dirs []string
+	for _, mountedObj := range mountedObjects {
+		if mountedObj != nil && isSplitFormat(mountedObj.Format) {
+			dirs = append(dirs, filepath.Clean(mountedObjectFileName(mountedObj)))
+		}
+	}
+	return dirs
+}
+
+// formatMountedObject returns the files of the mounted object with its decoded
+// contents converted to its format, by their paths relative to the target
+// path. The object is returned under its file name if it isn't split.
+func formatMountedObject(mountedObj *v1alpha1.MountedObject, contents []byte) (map[string][]byte, error) {
+	fileName := mountedObjectFileName(mountedObj)
+	var files map[string][]byte
+	var err error
+	switch mountedObj.Format {
+	case v1alpha1.ObjectFormatJSON:
+		contents, err = yaml.YAMLToJSON(contents)
+	case v1alpha1.ObjectFormatYAML:
+		contents, err = yaml.JSONToYAML(contents)
+	case v1alpha1.ObjectFormatSplitKeys:
+		files, err = splitKeys(contents)
+	case v1alpha1.ObjectFormatSplitPEM:
+		files, err = splitPEM(contents)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert mounted object %s to %s, err: %v", mountedObj.ObjectName, mountedObj.Format, err)
+	}
+	if !isSplitFormat(mountedObj.Format) {
+		return map[string][]byte{fileName: contents}, nil
+	}
+	split := make(map[string][]byte, len(files))
+	for name, contents := range files {
+		split[filepath.Join(fileName, name)] = contents
+	}
+	return split, nil
+}
+
+// splitKeys returns the values of the keys of the JSON or YAML object by their
+// keys. String values are returned as is, other values are encoded as JSON.
+func splitKeys(contents []byte) (map[string][]byte, error) {
+	var obj map[string]interface{}
+	if err := yaml.Unmarshal(contents, &obj); err != nil {
+		return nil, fmt.Errorf("contents aren't a JSON or YAML object, err: %v", err)
+	}
+	files := make(map[string][]byte, len(obj))
+	for key, value := range obj {
+		// the keys are file names in the directory of the object
+		if len(key) == 0 || strings.ContainsAny(key, `/\`) || strings.HasPrefix(key, "..") || key == "." {
+			return nil, fmt.Errorf("key %q isn't a valid file name", key)
+		}
+		if s, ok := value.(string); ok {
+			files[key] = []byte(s)
+			continue
+		}
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode the value of key %s, err: %v", key, err)
+		}
+		files[key] = encoded
+	}
+	return files, nil
+}
+
+// splitPEM returns the private key, the first certificate and the other
+// certificates of the PEM bundle by their file names. The text around the PEM
+// blocks is ignored.
+func splitPEM(contents []byte) (map[string][]byte, error) {
+	files := make(map[string][]byte)
+	var certs int
+	for block, rest := pem.Decode(contents); block != nil; block, rest = pem.Decode(rest) {
+		switch {
+		case strings.HasSuffix(block.Type, "PRIVATE KEY"):
+			if _, ok := files[splitPEMKeyFile]; ok {
+				return nil, fmt.Errorf("PEM bundle contains more than one private key")
+			}
+			files[splitPEMKeyFile] = pem.EncodeToMemory(block)
+		case block.Type == "CERTIFICATE":
+			file := splitPEMCAFile
+			if certs == 0 {
+				file = splitPEMCertFile
+			}
+			files[file] = append(files[file], pem.EncodeToMemory(block)...)
+			certs++
+		default:
+			return nil, fmt.Errorf("unsupported PEM block type %s", block.Type)
+		}
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("contents contain no PEM blocks")
+	}
+	return files, nil
+}
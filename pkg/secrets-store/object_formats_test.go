@@ -0,0 +1,232 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package secretsstore
+
+import (
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"sigs.k8s.io/secrets-store-csi-driver/apis/v1alpha1"
+)
+
+func testPEMBlock(blockType, contents string) string {
+	return string(pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: []byte(contents)}))
+}
+
+func TestFormatMountedObject(t *testing.T) {
+	key := testPEMBlock("RSA PRIVATE KEY", "key")
+	cert := testPEMBlock("CERTIFICATE", "cert")
+	intermediate := testPEMBlock("CERTIFICATE", "intermediate")
+	root := testPEMBlock("CERTIFICATE", "root")
+
+	cases := []struct {
+		name          string
+		mountedObj    *v1alpha1.MountedObject
+		contents      string
+		expectedFiles map[string]string
+		expectedErr   bool
+	}{
+		{
+			name:          "no format",
+			mountedObj:    &v1alpha1.MountedObject{ObjectName: "config", FileName: "config.json"},
+			contents:      `{"a":1}`,
+			expectedFiles: map[string]string{"config.json": `{"a":1}`},
+		},
+		{
+			name:          "json to yaml",
+			mountedObj:    &v1alpha1.MountedObject{ObjectName: "config", FileName: "config.yaml", Format: v1alpha1.ObjectFormatYAML},
+			contents:      `{"server":{"port":8080},"debug":true}`,
+			expectedFiles: map[string]string{"config.yaml": "debug: true\nserver:\n  port: 8080\n"},
+		},
+		{
+			name:          "yaml to json",
+			mountedObj:    &v1alpha1.MountedObject{ObjectName: "config", Format: v1alpha1.ObjectFormatJSON},
+			contents:      "server:\n  port: 8080\n",
+			expectedFiles: map[string]string{"config": `{"server":{"port":8080}}`},
+		},
+		{
+			name:        "invalid yaml",
+			mountedObj:  &v1alpha1.MountedObject{ObjectName: "config", Format: v1alpha1.ObjectFormatJSON},
+			contents:    "a: b: c",
+			expectedErr: true,
+		},
+		{
+			name:       "split keys",
+			mountedObj: &v1alpha1.MountedObject{ObjectName: "projects/123/secrets/db", FileName: "db", Format: v1alpha1.ObjectFormatSplitKeys},
+			contents:   `{"username":"admin","password":"p@ss","port":5432,"options":{"ssl":true}}`,
+			expectedFiles: map[string]string{
+				"db/username": "admin",
+				"db/password": "p@ss",
+				"db/port":     "5432",
+				"db/options":  `{"ssl":true}`,
+			},
+		},
+		{
+			name:        "split keys of an array",
+			mountedObj:  &v1alpha1.MountedObject{ObjectName: "db", Format: v1alpha1.ObjectFormatSplitKeys},
+			contents:    `["admin"]`,
+			expectedErr: true,
+		},
+		{
+			name:        "split key outside of the directory",
+			mountedObj:  &v1alpha1.MountedObject{ObjectName: "db", Format: v1alpha1.ObjectFormatSplitKeys},
+			contents:    `{"../username":"admin"}`,
+			expectedErr: true,
+		},
+		{
+			name:       "split pem",
+			mountedObj: &v1alpha1.MountedObject{ObjectName: "bundle", FileName: "tls", Format: v1alpha1.ObjectFormatSplitPEM},
+			contents:   key + cert + "\n" + intermediate + root,
+			expectedFiles: map[string]string{
+				"tls/tls.key": key,
+				"tls/tls.crt": cert,
+				"tls/ca.crt":  intermediate + root,
+			},
+		},
+		{
+			name:          "split pem without chain",
+			mountedObj:    &v1alpha1.MountedObject{ObjectName: "bundle", Format: v1alpha1.ObjectFormatSplitPEM},
+			contents:      cert + key,
+			expectedFiles: map[string]string{"bundle/tls.key": key, "bundle/tls.crt": cert},
+		},
+		{
+			name:        "split pem with two private keys",
+			mountedObj:  &v1alpha1.MountedObject{ObjectName: "bundle", Format: v1alpha1.ObjectFormatSplitPEM},
+			contents:    key + key + cert,
+			expectedErr: true,
+		},
+		{
+			name:        "split pem with unsupported block",
+			mountedObj:  &v1alpha1.MountedObject{ObjectName: "bundle", Format: v1alpha1.ObjectFormatSplitPEM},
+			contents:    cert + testPEMBlock("CERTIFICATE REQUEST", "csr"),
+			expectedErr: true,
+		},
+		{
+			name:        "split pem without blocks",
+			mountedObj:  &v1alpha1.MountedObject{ObjectName: "bundle", Format: v1alpha1.ObjectFormatSplitPEM},
+			contents:    "not pem",
+			expectedErr: true,
+		},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			files, err := formatMountedObject(test.mountedObj, []byte(test.contents))
+			if test.expectedErr != (err != nil) {
+				t.Fatalf("expected err: %v, got: %+v", test.expectedErr, err)
+			}
+			if test.expectedErr {
+				return
+			}
+			actual := make(map[string]string, len(files))
+			for file, contents := range files {
+				actual[file] = string(contents)
+			}
+			if !reflect.DeepEqual(actual, test.expectedFiles) {
+				t.Fatalf("expected files: %v, got: %v", test.expectedFiles, actual)
+			}
+		})
+	}
+}
+
+func TestApplyMountedObjectsFormat(t *testing.T) {
+	targetPath := getTestTargetPath(t)
+	defer os.RemoveAll(targetPath)
+	if err := os.MkdirAll(filepath.Join(targetPath, "projects/123/secrets"), 0755); err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(targetPath, "projects/123/secrets/db"), []byte(`{"username":"admin","password":"p@ss"}`), 0644); err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+
+	_, err := applyMountedObjects(targetPath, []*v1alpha1.MountedObject{
+		{ObjectName: "projects/123/secrets/db", FileName: "db", FilePermission: "0400", Format: v1alpha1.ObjectFormatSplitKeys},
+	})
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	for file, expected := range map[string]string{"db/username": "admin", "db/password": "p@ss"} {
+		contents, err := ioutil.ReadFile(filepath.Join(targetPath, file))
+		if err != nil {
+			t.Fatalf("expected err to be nil, got: %+v", err)
+		}
+		if string(contents) != expected {
+			t.Fatalf("expected contents of %s: %s, got: %s", file, expected, contents)
+		}
+		info, err := os.Stat(filepath.Join(targetPath, file))
+		if err != nil {
+			t.Fatalf("expected err to be nil, got: %+v", err)
+		}
+		if info.Mode().Perm() != 0400 {
+			t.Fatalf("expected mode of %s: %v, got: %v", file, os.FileMode(0400), info.Mode().Perm())
+		}
+	}
+	if _, err := os.Stat(filepath.Join(targetPath, "projects")); !os.IsNotExist(err) {
+		t.Fatalf("expected the empty directories of the object name to be removed, got: %+v", err)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(targetPath, "config"), []byte("not: valid: yaml"), 0644); err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	errorReason, err := applyMountedObjects(targetPath, []*v1alpha1.MountedObject{{ObjectName: "config", Format: v1alpha1.ObjectFormatJSON}})
+	if err == nil || errorReason != InvalidProviderResponse {
+		t.Fatalf("expected %s err, got reason: %s, err: %+v", InvalidProviderResponse, errorReason, err)
+	}
+}
+
+func TestRemoveStaleSplitFiles(t *testing.T) {
+	dataDir := getTestTargetPath(t)
+	defer os.RemoveAll(dataDir)
+	for _, file := range []string{"db/username", "db/password", "db/port", "other"} {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(dataDir, file)), 0755); err != nil {
+			t.Fatalf("expected err to be nil, got: %+v", err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(dataDir, file), []byte(file), 0644); err != nil {
+			t.Fatalf("expected err to be nil, got: %+v", err)
+		}
+	}
+	mountedObjects := []*v1alpha1.MountedObject{
+		{ObjectName: "db", Format: v1alpha1.ObjectFormatSplitKeys},
+		{ObjectName: "tls", Format: v1alpha1.ObjectFormatSplitPEM},
+	}
+
+	removed, err := removeStaleSplitFiles(dataDir, mountedObjects, map[string]bool{"db/username": true, "db/password": true})
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	if !removed {
+		t.Fatalf("expected the stale key to be removed")
+	}
+	for file, exists := range map[string]bool{"db/username": true, "db/password": true, "db/port": false, "other": true} {
+		if _, err := os.Stat(filepath.Join(dataDir, file)); os.IsNotExist(err) == exists {
+			t.Fatalf("expected %s to exist: %v, got err: %+v", file, exists, err)
+		}
+	}
+
+	// the files of an object that wasn't mounted are kept
+	removed, err = removeStaleSplitFiles(dataDir, mountedObjects, map[string]bool{"other": true})
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	if removed {
+		t.Fatalf("expected no file to be removed")
+	}
+}
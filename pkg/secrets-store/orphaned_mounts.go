@@ -0,0 +1,128 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package secretsstore
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	log "github.com/sirupsen/logrus"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/utils/mount"
+)
+
+const (
+	// csiVolumesDir is the directory of the csi volumes in a kubelet pod directory
+	csiVolumesDir = "kubernetes.io~csi"
+	// volDataFile is the file the kubelet writes next to the target path of a
+	// csi volume, with the name of the driver of the volume
+	volDataFile = "vol_data.json"
+)
+
+// orphanedTargetPath is the target path of a volume of the driver in the
+// kubelet pods directory
+type orphanedTargetPath struct {
+	podUID     string
+	targetPath string
+}
+
+// cleanupOrphanedTargetPaths unmounts and removes the target paths of the
+// volumes of the driver in the kubelet pods directory whose pods no longer
+// exist, e.g. the pods deleted while the driver or the node was down, so the
+// mounted contents aren't left on the node. It runs before the driver serves
+// the kubelet requests.
+func (ns *nodeServer) cleanupOrphanedTargetPaths(podsDir, driverName string) error {
+	targetPaths, err := findTargetPaths(podsDir, driverName)
+	if err != nil || len(targetPaths) == 0 {
+		return err
+	}
+	pods, err := ns.kubeClient.CoreV1().Pods("").List(metav1.ListOptions{
+		FieldSelector: fields.OneTermEqualSelector("spec.nodeName", ns.nodeID).String(),
+	})
+	if err != nil {
+		return err
+	}
+	podUIDs := make(map[string]bool, len(pods.Items))
+	for _, pod := range pods.Items {
+		podUIDs[string(pod.UID)] = true
+		// the kubelet directory of a static pod is named after the uid of
+		// the static pod, not of its mirror pod
+		if uid := pod.Annotations[corev1.MirrorPodAnnotationKey]; len(uid) > 0 {
+			podUIDs[uid] = true
+		}
+	}
+	for _, t := range targetPaths {
+		if podUIDs[t.podUID] {
+			continue
+		}
+		if err := mount.CleanupMountPoint(t.targetPath, ns.mounter, false); err != nil {
+			log.Errorf("failed to clean up orphaned target path %s of pod %s, err: %v", t.targetPath, t.podUID, err)
+			continue
+		}
+		// the volume directory is removed once empty, so the kubelet removes
+		// the orphaned pod directory
+		volumeDir := filepath.Dir(t.targetPath)
+		if err := os.Remove(filepath.Join(volumeDir, volDataFile)); err != nil && !os.IsNotExist(err) {
+			log.Errorf("failed to remove volume data of orphaned target path %s, err: %v", t.targetPath, err)
+			continue
+		}
+		if err := os.Remove(volumeDir); err != nil && !os.IsNotExist(err) {
+			log.Errorf("failed to remove volume directory of orphaned target path %s, err: %v", t.targetPath, err)
+			continue
+		}
+		log.Infof("cleaned up orphaned target path %s of pod %s", t.targetPath, t.podUID)
+	}
+	return nil
+}
+
+// findTargetPaths returns the target paths of the volumes of the driver in
+// the kubelet pods directory, <pods dir>/<uid>/volumes/kubernetes.io~csi/<volume>/mount
+func findTargetPaths(podsDir, driverName string) ([]orphanedTargetPath, error) {
+	volDataFiles, err := filepath.Glob(filepath.Join(podsDir, "*", "volumes", csiVolumesDir, "*", volDataFile))
+	if err != nil {
+		return nil, err
+	}
+	var targetPaths []orphanedTargetPath
+	for _, file := range volDataFiles {
+		contents, err := ioutil.ReadFile(file)
+		if err != nil {
+			log.Warningf("failed to read volume data %s, err: %v", file, err)
+			continue
+		}
+		var volData struct {
+			DriverName string `json:"driverName"`
+		}
+		if err := json.Unmarshal(contents, &volData); err != nil {
+			log.Warningf("failed to parse volume data %s, err: %v", file, err)
+			continue
+		}
+		if volData.DriverName != driverName {
+			continue
+		}
+		volumeDir := filepath.Dir(file)
+		targetPaths = append(targetPaths, orphanedTargetPath{
+			podUID:     filepath.Base(filepath.Dir(filepath.Dir(filepath.Dir(volumeDir)))),
+			targetPath: filepath.Join(volumeDir, "mount"),
+		})
+	}
+	return targetPaths, nil
+}
@@ -0,0 +1,122 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package secretsstore
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/utils/mount"
+)
+
+// createTargetPath creates the target path of a csi volume of the driver in
+// the kubelet pods directory
+func createTargetPath(t *testing.T, podsDir, podUID, driverName string) string {
+	volumeDir := filepath.Join(podsDir, podUID, "volumes", csiVolumesDir, "secrets-store-inline")
+	targetPath := filepath.Join(volumeDir, "mount")
+	if err := os.MkdirAll(targetPath, 0755); err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	volData := fmt.Sprintf(`{"driverName":%q,"specVolID":"secrets-store-inline"}`, driverName)
+	if err := ioutil.WriteFile(filepath.Join(volumeDir, volDataFile), []byte(volData), 0644); err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	return targetPath
+}
+
+func TestCleanupOrphanedTargetPaths(t *testing.T) {
+	ns, err := testNodeServer(nil, nil, "")
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	defer os.RemoveAll(ns.providerVolumePath)
+	podsDir := filepath.Join(ns.providerVolumePath, "pods")
+
+	running := createTargetPath(t, podsDir, "running", "secrets-store.csi.k8s.io")
+	static := createTargetPath(t, podsDir, "static", "secrets-store.csi.k8s.io")
+	orphaned := createTargetPath(t, podsDir, "orphaned", "secrets-store.csi.k8s.io")
+	otherDriver := createTargetPath(t, podsDir, "otherdriver", "other.csi.k8s.io")
+
+	ns.mounter = mount.NewFakeMounter([]mount.MountPoint{{Path: running}, {Path: static}, {Path: orphaned}, {Path: otherDriver}})
+	ns.kubeClient = kubefake.NewSimpleClientset(
+		&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "running", Namespace: "default", UID: types.UID("running")},
+			Spec:       corev1.PodSpec{NodeName: "testnode"},
+		},
+		&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "static",
+				Namespace:   "kube-system",
+				UID:         types.UID("mirror"),
+				Annotations: map[string]string{corev1.MirrorPodAnnotationKey: "static"},
+			},
+			Spec: corev1.PodSpec{NodeName: "testnode"},
+		},
+	)
+
+	if err := ns.cleanupOrphanedTargetPaths(podsDir, "secrets-store.csi.k8s.io"); err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	for _, targetPath := range []string{running, static, otherDriver} {
+		if notMnt, err := ns.mounter.IsLikelyNotMountPoint(targetPath); err != nil || notMnt {
+			t.Fatalf("expected target path %s to be kept mounted, got: %v, %+v", targetPath, notMnt, err)
+		}
+	}
+	if notMnt, _ := ns.mounter.IsLikelyNotMountPoint(orphaned); !notMnt {
+		t.Fatalf("expected orphaned target path to be unmounted")
+	}
+	if _, err := os.Stat(filepath.Dir(orphaned)); !os.IsNotExist(err) {
+		t.Fatalf("expected volume directory of the orphaned target path to be removed, got: %+v", err)
+	}
+	if _, err := os.Stat(filepath.Dir(filepath.Dir(orphaned))); err != nil {
+		t.Fatalf("expected csi volumes directory of the orphaned pod to be kept, got: %+v", err)
+	}
+}
+
+func TestFindTargetPaths(t *testing.T) {
+	podsDir, err := ioutil.TempDir("", "pods")
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	defer os.RemoveAll(podsDir)
+
+	targetPath := createTargetPath(t, podsDir, "pod1", "secrets-store.csi.k8s.io")
+	createTargetPath(t, podsDir, "pod2", "other.csi.k8s.io")
+	// volume data that can't be parsed is skipped
+	invalid := filepath.Join(podsDir, "pod3", "volumes", csiVolumesDir, "vol")
+	if err := os.MkdirAll(invalid, 0755); err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(invalid, volDataFile), []byte("{"), 0644); err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+
+	targetPaths, err := findTargetPaths(podsDir, "secrets-store.csi.k8s.io")
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	if len(targetPaths) != 1 || targetPaths[0].podUID != "pod1" || targetPaths[0].targetPath != targetPath {
+		t.Fatalf("expected target path %s of pod1, got: %+v", targetPath, targetPaths)
+	}
+}
@@ -0,0 +1,310 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package secretsstore
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"sigs.k8s.io/secrets-store-csi-driver/apis/v1alpha1"
+	"sigs.k8s.io/secrets-store-csi-driver/controllers"
+	"sigs.k8s.io/secrets-store-csi-driver/pkg/util/fileutil"
+	"sigs.k8s.io/secrets-store-csi-driver/pkg/util/keystore"
+)
+
+// defaultKeystoreAlias is the alias of the private key entry of a keystore
+// output file without alias
+const defaultKeystoreAlias = "tls"
+
+var (
+	// dotenvKeyPattern matches the keys of a dotenv file, the names of
+	// environment variables
+	dotenvKeyPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	// dotenvPlainValuePattern matches the values of a dotenv file that don't
+	// need to be quoted
+	dotenvPlainValuePattern = regexp.MustCompile(`^[A-Za-z0-9_./:@%+,=-]*$`)
+	// dotenvEscaper escapes the values of a dotenv file in double quotes
+	dotenvEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, `$`, `\$`, "\n", `\n`, "\r", `\r`)
+)
+
+// validateOutputFiles returns an error if the file name of an output file
+// isn't a valid relative path, starts with '..' or is used by more than one
+// output file, if the format or the file permission isn't supported, or if
+// the objects of an output file aren't valid for its format
+func validateOutputFiles(outputFiles []*v1alpha1.OutputFile) error {
+	fileNames := make(map[string]bool, len(outputFiles))
+	for _, outputFile := range outputFiles {
+		if outputFile == nil {
+			continue
+		}
+		if err := fileutil.ValidatePath(outputFile.FileName); err != nil {
+			return fmt.Errorf("invalid file name of output file, err: %v", err)
+		}
+		fileName := filepath.Clean(outputFile.FileName)
+		if strings.HasPrefix(fileName, "..") {
+			return fmt.Errorf("invalid file name %s of output file, file names starting with '..' are reserved", outputFile.FileName)
+		}
+		if fileNames[fileName] {
+			return fmt.Errorf("file name %s is used by more than one output file", outputFile.FileName)
+		}
+		fileNames[fileName] = true
+		if _, err := outputFilePermission(outputFile); err != nil {
+			return err
+		}
+		for _, obj := range outputFile.Objects {
+			if obj == nil {
+				continue
+			}
+			if err := fileutil.ValidatePath(obj.ObjectName); err != nil {
+				return fmt.Errorf("invalid object name of output file %s, err: %v", outputFile.FileName, err)
+			}
+		}
+		if outputFile.Format != v1alpha1.OutputFileFormatTemplate && len(outputFile.Objects) == 0 {
+			return fmt.Errorf("output file %s has no objects", outputFile.FileName)
+		}
+		if outputFile.Format != v1alpha1.OutputFileFormatTemplate && len(outputFile.Template) > 0 {
+			return fmt.Errorf("the template of output file %s is only used by the template format", outputFile.FileName)
+		}
+		switch outputFile.Format {
+		case v1alpha1.OutputFileFormatDotenv:
+			keys := make(map[string]bool, len(outputFile.Objects))
+			for _, obj := range outputFile.Objects {
+				if obj == nil {
+					continue
+				}
+				if !dotenvKeyPattern.MatchString(obj.Key) {
+					return fmt.Errorf("invalid key %q of output file %s, the keys of a dotenv file must be environment variable names", obj.Key, outputFile.FileName)
+				}
+				if keys[obj.Key] {
+					return fmt.Errorf("key %s is used by more than one object of output file %s", obj.Key, outputFile.FileName)
+				}
+				keys[obj.Key] = true
+			}
+			if len(outputFile.PassphraseObjectName) > 0 || len(outputFile.Alias) > 0 {
+				return fmt.Errorf("the passphrase object name and the alias of output file %s are only used by the keystore formats", outputFile.FileName)
+			}
+		case v1alpha1.OutputFileFormatPKCS12, v1alpha1.OutputFileFormatJKS:
+			for _, obj := range outputFile.Objects {
+				if obj != nil && len(obj.Key) > 0 {
+					return fmt.Errorf("key %s of output file %s isn't used by the %s format", obj.Key, outputFile.FileName, outputFile.Format)
+				}
+			}
+			if len(outputFile.PassphraseObjectName) == 0 {
+				return fmt.Errorf("output file %s of format %s has no passphrase object name", outputFile.FileName, outputFile.Format)
+			}
+			if err := fileutil.ValidatePath(outputFile.PassphraseObjectName); err != nil {
+				return fmt.Errorf("invalid passphrase object name of output file %s, err: %v", outputFile.FileName, err)
+			}
+		case v1alpha1.OutputFileFormatTemplate:
+			if len(outputFile.Template) == 0 {
+				return fmt.Errorf("output file %s of format %s has no template", outputFile.FileName, outputFile.Format)
+			}
+			if len(outputFile.Objects) > 0 {
+				return fmt.Errorf("the objects of output file %s aren't used by the template format, the template references the objects with the object function", outputFile.FileName)
+			}
+			if len(outputFile.PassphraseObjectName) > 0 || len(outputFile.Alias) > 0 {
+				return fmt.Errorf("the passphrase object name and the alias of output file %s are only used by the keystore formats", outputFile.FileName)
+			}
+			if err := controllers.ValidateSecretTemplate(outputFile.Template); err != nil {
+				return fmt.Errorf("invalid template of output file %s, err: %v", outputFile.FileName, err)
+			}
+		default:
+			return fmt.Errorf("unsupported format %q of output file %s", outputFile.Format, outputFile.FileName)
+		}
+	}
+	return nil
+}
+
+// outputFilePermission returns the file permission of the output file, the
+// default file permission if the permission isn't set
+func outputFilePermission(outputFile *v1alpha1.OutputFile) (os.FileMode, error) {
+	if len(outputFile.FilePermission) == 0 {
+		return permission, nil
+	}
+	perm, err := parseFilePermission(outputFile.FilePermission)
+	if err != nil {
+		return 0, fmt.Errorf("invalid file permission %q of output file %s, the permission must be an octal number between 0000 and 0777", outputFile.FilePermission, outputFile.FileName)
+	}
+	return perm, nil
+}
+
+// renderOutputFiles returns the contents of the output files by file name,
+// rendered from the contents of their objects returned by object
+func renderOutputFiles(outputFiles []*v1alpha1.OutputFile, object func(objectName string) ([]byte, error)) (map[string][]byte, error) {
+	if err := validateOutputFiles(outputFiles); err != nil {
+		return nil, err
+	}
+	rendered := make(map[string][]byte, len(outputFiles))
+	for _, outputFile := range outputFiles {
+		if outputFile == nil {
+			continue
+		}
+		var contents []byte
+		var err error
+		switch outputFile.Format {
+		case v1alpha1.OutputFileFormatDotenv:
+			contents, err = renderDotenv(outputFile, object)
+		case v1alpha1.OutputFileFormatPKCS12, v1alpha1.OutputFileFormatJKS:
+			contents, err = renderKeystore(outputFile, object)
+		case v1alpha1.OutputFileFormatTemplate:
+			contents, err = controllers.RenderSecretTemplate(outputFile.Template, object)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to render output file %s, err: %v", outputFile.FileName, err)
+		}
+		rendered[filepath.Clean(outputFile.FileName)] = contents
+	}
+	return rendered, nil
+}
+
+// renderDotenv renders the objects of the output file as KEY=value lines. A
+// trailing newline of the contents of an object is removed.
+func renderDotenv(outputFile *v1alpha1.OutputFile, object func(objectName string) ([]byte, error)) ([]byte, error) {
+	var buf bytes.Buffer
+	for _, obj := range outputFile.Objects {
+		if obj == nil {
+			continue
+		}
+		contents, err := object(obj.ObjectName)
+		if err != nil {
+			return nil, err
+		}
+		if !utf8.Valid(contents) || bytes.IndexByte(contents, 0) >= 0 {
+			return nil, fmt.Errorf("contents of object %s aren't text", obj.ObjectName)
+		}
+		value := strings.TrimSuffix(strings.TrimSuffix(string(contents), "\n"), "\r")
+		fmt.Fprintf(&buf, "%s=%s\n", obj.Key, dotenvValue(value))
+	}
+	return buf.Bytes(), nil
+}
+
+// renderKeystore bundles the PEM private key and certificates of the objects of
+// the output file into a keystore encrypted with the passphrase object. A
+// trailing newline of the passphrase is removed.
+func renderKeystore(outputFile *v1alpha1.OutputFile, object func(objectName string) ([]byte, error)) ([]byte, error) {
+	var bundle []byte
+	for _, obj := range outputFile.Objects {
+		if obj == nil {
+			continue
+		}
+		contents, err := object(obj.ObjectName)
+		if err != nil {
+			return nil, err
+		}
+		bundle = append(append(bundle, contents...), '\n')
+	}
+	alias := outputFile.Alias
+	if len(alias) == 0 {
+		alias = defaultKeystoreAlias
+	}
+	entry, err := keystore.ParsePEM(alias, bundle)
+	if err != nil {
+		return nil, err
+	}
+	passphrase, err := object(outputFile.PassphraseObjectName)
+	if err != nil {
+		return nil, err
+	}
+	password := strings.TrimSuffix(strings.TrimSuffix(string(passphrase), "\n"), "\r")
+	if len(password) == 0 {
+		return nil, fmt.Errorf("passphrase object %s is empty", outputFile.PassphraseObjectName)
+	}
+	if outputFile.Format == v1alpha1.OutputFileFormatJKS {
+		return keystore.EncodeJKS(entry, password)
+	}
+	return keystore.EncodePKCS12(entry, password)
+}
+
+// dotenvValue returns the value quoted for a dotenv file. Values with special
+// characters are single quoted, so they are read as is, and values with
+// single quotes or newlines are double quoted with the backslashes, double
+// quotes, dollar signs and newlines escaped.
+func dotenvValue(value string) string {
+	if dotenvPlainValuePattern.MatchString(value) {
+		return value
+	}
+	if !strings.ContainsAny(value, "'\n\r") {
+		return "'" + value + "'"
+	}
+	return `"` + dotenvEscaper.Replace(value) + `"`
+}
+
+// writeOutputFiles renders the output files from the files of the mounted
+// objects in dir and writes them to dir. An output file replaces an existing
+// file with its file name only if replace is set, e.g. the output file of the
+// previous rotation. It returns true if the contents of an output file
+// changed, and the error reason with the error.
+func writeOutputFiles(dir string, outputFiles []*v1alpha1.OutputFile, replace bool) (bool, string, error) {
+	rendered, err := renderOutputFiles(outputFiles, func(objectName string) ([]byte, error) {
+		// the objects are only read from the regular files of the volume, so
+		// a symlink mounted by a provider can't expose a file of the node
+		if err := fileutil.ValidateParents(dir, objectName); err != nil {
+			return nil, err
+		}
+		p := filepath.Join(dir, objectName)
+		info, err := os.Lstat(p)
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("object %s isn't mounted", objectName)
+		} else if err != nil {
+			return nil, err
+		}
+		if !info.Mode().IsRegular() {
+			return nil, fmt.Errorf("object %s isn't a regular file", objectName)
+		}
+		return ioutil.ReadFile(p)
+	})
+	if err != nil {
+		return false, InvalidOutputFiles, err
+	}
+	changed := false
+	for _, outputFile := range outputFiles {
+		if outputFile == nil {
+			continue
+		}
+		contents := rendered[filepath.Clean(outputFile.FileName)]
+		p := filepath.Join(dir, outputFile.FileName)
+		existing, err := ioutil.ReadFile(p)
+		if err == nil && !replace {
+			return false, FilePathCollision, fmt.Errorf("file name %s of output file is already used by another file", outputFile.FileName)
+		} else if err != nil && !os.IsNotExist(err) {
+			return false, FailedToWriteFiles, err
+		}
+		perm, err := outputFilePermission(outputFile)
+		if err != nil {
+			return false, InvalidOutputFiles, err
+		}
+		if existing == nil || !bytes.Equal(existing, contents) {
+			changed = true
+			if err := fileutil.MkdirParents(dir, outputFile.FileName); err != nil {
+				return false, FilePathCollision, fmt.Errorf("failed to create directory of output file %s, err: %v", outputFile.FileName, err)
+			}
+			if err := ioutil.WriteFile(p, contents, fileutil.FileMode(perm)); err != nil {
+				return false, FailedToWriteFiles, fmt.Errorf("failed to write output file %s, err: %v", outputFile.FileName, err)
+			}
+		}
+		if err := os.Chmod(p, fileutil.FileMode(perm)); err != nil {
+			return false, FailedToWriteFiles, fmt.Errorf("failed to set file permission of output file %s, err: %v", outputFile.FileName, err)
+		}
+	}
+	return changed, "", nil
+}
@@ -0,0 +1,363 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package secretsstore
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/pkcs12"
+
+	"sigs.k8s.io/secrets-store-csi-driver/apis/v1alpha1"
+)
+
+func TestValidateOutputFiles(t *testing.T) {
+	dotenv := func(fileName string, keys ...string) *v1alpha1.OutputFile {
+		outputFile := &v1alpha1.OutputFile{FileName: fileName, Format: v1alpha1.OutputFileFormatDotenv}
+		for _, key := range keys {
+			outputFile.Objects = append(outputFile.Objects, &v1alpha1.OutputFileObject{ObjectName: "db-" + key, Key: key})
+		}
+		return outputFile
+	}
+
+	cases := []struct {
+		name        string
+		outputFiles []*v1alpha1.OutputFile
+		expectedErr bool
+	}{
+		{
+			name:        "valid",
+			outputFiles: []*v1alpha1.OutputFile{dotenv("app.env", "DB_USER", "DB_PASSWORD"), dotenv("config/worker.env", "_TOKEN")},
+		},
+		{
+			name:        "absolute file name",
+			outputFiles: []*v1alpha1.OutputFile{dotenv("/etc/app.env", "DB_USER")},
+			expectedErr: true,
+		},
+		{
+			name:        "reserved file name",
+			outputFiles: []*v1alpha1.OutputFile{dotenv("..data/app.env", "DB_USER")},
+			expectedErr: true,
+		},
+		{
+			name:        "duplicate file name",
+			outputFiles: []*v1alpha1.OutputFile{dotenv("app.env", "DB_USER"), dotenv("./app.env", "DB_PASSWORD")},
+			expectedErr: true,
+		},
+		{
+			name:        "no objects",
+			outputFiles: []*v1alpha1.OutputFile{dotenv("app.env")},
+			expectedErr: true,
+		},
+		{
+			name:        "duplicate key",
+			outputFiles: []*v1alpha1.OutputFile{dotenv("app.env", "DB_USER", "DB_USER")},
+			expectedErr: true,
+		},
+		{
+			name:        "invalid dotenv key",
+			outputFiles: []*v1alpha1.OutputFile{dotenv("app.env", "DB-USER")},
+			expectedErr: true,
+		},
+		{
+			name:        "unsupported format",
+			outputFiles: []*v1alpha1.OutputFile{{FileName: "app.ini", Format: "ini", Objects: []*v1alpha1.OutputFileObject{{ObjectName: "db-user", Key: "user"}}}},
+			expectedErr: true,
+		},
+		{
+			name: "keystores",
+			outputFiles: []*v1alpha1.OutputFile{
+				{FileName: "keystore.p12", Format: v1alpha1.OutputFileFormatPKCS12, PassphraseObjectName: "passphrase", Objects: []*v1alpha1.OutputFileObject{{ObjectName: "tls.crt"}, {ObjectName: "tls.key"}}},
+				{FileName: "keystore.jks", Format: v1alpha1.OutputFileFormatJKS, PassphraseObjectName: "passphrase", Alias: "server", Objects: []*v1alpha1.OutputFileObject{{ObjectName: "tls.pem"}}},
+			},
+		},
+		{
+			name:        "keystore without passphrase",
+			outputFiles: []*v1alpha1.OutputFile{{FileName: "keystore.p12", Format: v1alpha1.OutputFileFormatPKCS12, Objects: []*v1alpha1.OutputFileObject{{ObjectName: "tls.pem"}}}},
+			expectedErr: true,
+		},
+		{
+			name:        "keystore with passphrase outside of the volume",
+			outputFiles: []*v1alpha1.OutputFile{{FileName: "keystore.p12", Format: v1alpha1.OutputFileFormatPKCS12, PassphraseObjectName: "../passphrase", Objects: []*v1alpha1.OutputFileObject{{ObjectName: "tls.pem"}}}},
+			expectedErr: true,
+		},
+		{
+			name:        "keystore with key",
+			outputFiles: []*v1alpha1.OutputFile{{FileName: "keystore.jks", Format: v1alpha1.OutputFileFormatJKS, PassphraseObjectName: "passphrase", Objects: []*v1alpha1.OutputFileObject{{ObjectName: "tls.pem", Key: "tls"}}}},
+			expectedErr: true,
+		},
+		{
+			name:        "dotenv with passphrase",
+			outputFiles: []*v1alpha1.OutputFile{{FileName: "app.env", Format: v1alpha1.OutputFileFormatDotenv, PassphraseObjectName: "passphrase", Objects: []*v1alpha1.OutputFileObject{{ObjectName: "db-user", Key: "DB_USER"}}}},
+			expectedErr: true,
+		},
+		{
+			name:        "template",
+			outputFiles: []*v1alpha1.OutputFile{{FileName: "application.properties", Format: v1alpha1.OutputFileFormatTemplate, Template: `db.user={{ object "db-user" }}`}},
+		},
+		{
+			name:        "template format without template",
+			outputFiles: []*v1alpha1.OutputFile{{FileName: "application.properties", Format: v1alpha1.OutputFileFormatTemplate}},
+			expectedErr: true,
+		},
+		{
+			name:        "invalid template",
+			outputFiles: []*v1alpha1.OutputFile{{FileName: "application.properties", Format: v1alpha1.OutputFileFormatTemplate, Template: `{{ object "db-user" `}},
+			expectedErr: true,
+		},
+		{
+			name:        "template with objects",
+			outputFiles: []*v1alpha1.OutputFile{{FileName: "application.properties", Format: v1alpha1.OutputFileFormatTemplate, Template: "static", Objects: []*v1alpha1.OutputFileObject{{ObjectName: "db-user", Key: "user"}}}},
+			expectedErr: true,
+		},
+		{
+			name:        "dotenv with template",
+			outputFiles: []*v1alpha1.OutputFile{{FileName: "app.env", Format: v1alpha1.OutputFileFormatDotenv, Template: "static", Objects: []*v1alpha1.OutputFileObject{{ObjectName: "db-user", Key: "DB_USER"}}}},
+			expectedErr: true,
+		},
+		{
+			name:        "invalid file permission",
+			outputFiles: []*v1alpha1.OutputFile{{FileName: "app.env", Format: v1alpha1.OutputFileFormatDotenv, FilePermission: "0800", Objects: []*v1alpha1.OutputFileObject{{ObjectName: "db-user", Key: "DB_USER"}}}},
+			expectedErr: true,
+		},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			err := validateOutputFiles(test.outputFiles)
+			if test.expectedErr != (err != nil) {
+				t.Fatalf("expected err: %v, got: %+v", test.expectedErr, err)
+			}
+		})
+	}
+}
+
+func TestDotenvValue(t *testing.T) {
+	cases := []struct {
+		value    string
+		expected string
+	}{
+		{value: "", expected: ""},
+		{value: "admin", expected: "admin"},
+		{value: "postgres://db.example.com:5432/app", expected: "postgres://db.example.com:5432/app"},
+		{value: "p@ss word#1", expected: "'p@ss word#1'"},
+		{value: "$HOME", expected: "'$HOME'"},
+		{value: `it's "quoted" $HOME \n`, expected: `"it's \"quoted\" \$HOME \\n"`},
+		{value: "line1\nline2", expected: `"line1\nline2"`},
+	}
+
+	for _, test := range cases {
+		if actual := dotenvValue(test.value); actual != test.expected {
+			t.Errorf("expected dotenv value of %q: %s, got: %s", test.value, test.expected, actual)
+		}
+	}
+}
+
+func TestWriteOutputFiles(t *testing.T) {
+	outputFiles := []*v1alpha1.OutputFile{
+		{
+			FileName:       "config/app.env",
+			Format:         v1alpha1.OutputFileFormatDotenv,
+			FilePermission: "0440",
+			Objects: []*v1alpha1.OutputFileObject{
+				{ObjectName: "db/user", Key: "DB_USER"},
+				{ObjectName: "db/password", Key: "DB_PASSWORD"},
+			},
+		},
+	}
+
+	dir := getTestTargetPath(t)
+	defer os.RemoveAll(dir)
+	if err := os.MkdirAll(filepath.Join(dir, "db"), 0755); err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	for file, contents := range map[string]string{"db/user": "admin\n", "db/password": "p@ss word"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, file), []byte(contents), 0644); err != nil {
+			t.Fatalf("expected err to be nil, got: %+v", err)
+		}
+	}
+
+	changed, _, err := writeOutputFiles(dir, outputFiles, false)
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	if !changed {
+		t.Errorf("expected output files to be changed")
+	}
+	p := filepath.Join(dir, "config", "app.env")
+	contents, err := ioutil.ReadFile(p)
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	if expected := "DB_USER=admin\nDB_PASSWORD='p@ss word'\n"; string(contents) != expected {
+		t.Errorf("expected output file contents: %q, got: %q", expected, string(contents))
+	}
+	if info, err := os.Stat(p); err != nil || info.Mode().Perm() != 0440 {
+		t.Errorf("expected output file permission 0440, got: %v, err: %+v", info.Mode().Perm(), err)
+	}
+
+	// the output file of the previous mount is only replaced with replace
+	if _, reason, err := writeOutputFiles(dir, outputFiles, false); err == nil || reason != FilePathCollision {
+		t.Errorf("expected %s error, got: %s, %+v", FilePathCollision, reason, err)
+	}
+	changed, _, err = writeOutputFiles(dir, outputFiles, true)
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	if changed {
+		t.Errorf("expected output files not to be changed")
+	}
+
+	// objects that aren't regular files of the volume aren't rendered
+	if err := os.Remove(filepath.Join(dir, "db", "password")); err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	if _, reason, err := writeOutputFiles(dir, outputFiles, true); err == nil || reason != InvalidOutputFiles {
+		t.Errorf("expected %s error for missing object, got: %s, %+v", InvalidOutputFiles, reason, err)
+	}
+	if err := os.Symlink("/etc/hostname", filepath.Join(dir, "db", "password")); err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	if _, reason, err := writeOutputFiles(dir, outputFiles, true); err == nil || reason != InvalidOutputFiles {
+		t.Errorf("expected %s error for symlink object, got: %s, %+v", InvalidOutputFiles, reason, err)
+	}
+}
+
+func TestRenderKeystore(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "app"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	objects := map[string][]byte{
+		"tls.crt":    pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		"tls.key":    pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}),
+		"passphrase": []byte("changeit\n"),
+		"empty":      {},
+	}
+	object := func(objectName string) ([]byte, error) {
+		contents, ok := objects[objectName]
+		if !ok {
+			return nil, fmt.Errorf("object %s isn't mounted", objectName)
+		}
+		return contents, nil
+	}
+	outputFile := &v1alpha1.OutputFile{
+		FileName:             "keystore.p12",
+		Format:               v1alpha1.OutputFileFormatPKCS12,
+		PassphraseObjectName: "passphrase",
+		Objects:              []*v1alpha1.OutputFileObject{{ObjectName: "tls.crt"}, {ObjectName: "tls.key"}},
+	}
+
+	contents, err := renderKeystore(outputFile, object)
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	decodedKey, cert, err := pkcs12.Decode(contents, "changeit")
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	if !bytes.Equal(cert.Raw, der) || !decodedKey.(*ecdsa.PrivateKey).Equal(key) {
+		t.Fatalf("expected the certificate and the private key of the objects")
+	}
+
+	outputFile.Format = v1alpha1.OutputFileFormatJKS
+	if _, err := renderKeystore(outputFile, object); err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+
+	outputFile.PassphraseObjectName = "empty"
+	if _, err := renderKeystore(outputFile, object); err == nil {
+		t.Fatalf("expected err for empty passphrase, got nil")
+	}
+	outputFile.PassphraseObjectName = "passphrase"
+	outputFile.Objects = []*v1alpha1.OutputFileObject{{ObjectName: "tls.crt"}}
+	if _, err := renderKeystore(outputFile, object); err == nil {
+		t.Fatalf("expected err for objects without private key, got nil")
+	}
+}
+
+func TestWriteOutputFilesTemplate(t *testing.T) {
+	outputFiles := []*v1alpha1.OutputFile{
+		{
+			FileName: "application.properties",
+			Format:   v1alpha1.OutputFileFormatTemplate,
+			Template: "spring.datasource.url=jdbc:postgresql://{{ object \"db/host\" | trimSpace }}/app\nspring.datasource.username={{ object \"db/user\" }}\n",
+		},
+	}
+
+	dir := getTestTargetPath(t)
+	defer os.RemoveAll(dir)
+	if err := os.MkdirAll(filepath.Join(dir, "db"), 0755); err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	for file, contents := range map[string]string{"db/host": "db.example.com", "db/user": "admin"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, file), []byte(contents), 0644); err != nil {
+			t.Fatalf("expected err to be nil, got: %+v", err)
+		}
+	}
+
+	if _, _, err := writeOutputFiles(dir, outputFiles, false); err == nil {
+		t.Fatalf("expected err for template function that isn't defined, got nil")
+	}
+	outputFiles[0].Template = "spring.datasource.url=jdbc:postgresql://{{ object \"db/host\" }}/app\nspring.datasource.username={{ object \"db/user\" }}\n"
+	changed, _, err := writeOutputFiles(dir, outputFiles, false)
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	if !changed {
+		t.Fatalf("expected the output file to be written")
+	}
+	contents, err := ioutil.ReadFile(filepath.Join(dir, "application.properties"))
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	expected := "spring.datasource.url=jdbc:postgresql://db.example.com/app\nspring.datasource.username=admin\n"
+	if string(contents) != expected {
+		t.Fatalf("expected contents: %q, got: %q", expected, contents)
+	}
+
+	outputFiles[0].Template = `{{ object "db/port" }}`
+	if _, errorReason, err := writeOutputFiles(dir, outputFiles, true); err == nil || errorReason != InvalidOutputFiles {
+		t.Fatalf("expected %s err for object that isn't mounted, got reason: %s, err: %+v", InvalidOutputFiles, errorReason, err)
+	}
+}
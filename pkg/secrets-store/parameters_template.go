@@ -0,0 +1,111 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package secretsstore
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"sigs.k8s.io/secrets-store-csi-driver/apis/v1alpha1"
+)
+
+// parameterTemplateData is the pod metadata the parameter templates of a
+// secret provider class can reference, e.g. apps/{{ .PodNamespace }}/db
+type parameterTemplateData struct {
+	PodName            string
+	PodNamespace       string
+	PodUID             string
+	ServiceAccountName string
+	PodLabels          map[string]string
+	PodAnnotations     map[string]string
+}
+
+// podParameterTemplateData returns the parameter template data of the pod
+func podParameterTemplateData(pod *corev1.Pod) parameterTemplateData {
+	return parameterTemplateData{
+		PodName:            pod.Name,
+		PodNamespace:       pod.Namespace,
+		PodUID:             string(pod.UID),
+		ServiceAccountName: pod.Spec.ServiceAccountName,
+		PodLabels:          pod.Labels,
+		PodAnnotations:     pod.Annotations,
+	}
+}
+
+// isParameterTemplate returns true if the parameter value is a template
+func isParameterTemplate(value string) bool {
+	return strings.Contains(value, "{{")
+}
+
+// providerParameterMaps returns the parameters of the primary, fallback and
+// additional providers of the secret provider class
+func providerParameterMaps(spc *v1alpha1.SecretProviderClass) []map[string]string {
+	maps := []map[string]string{spc.Spec.Parameters}
+	if spc.Spec.Fallback != nil {
+		maps = append(maps, spc.Spec.Fallback.Parameters)
+	}
+	for _, additionalProvider := range spc.Spec.AdditionalProviders {
+		if additionalProvider != nil {
+			maps = append(maps, additionalProvider.Parameters)
+		}
+	}
+	return maps
+}
+
+// hasParameterTemplates returns true if any provider parameter of the secret
+// provider class is a template
+func hasParameterTemplates(spc *v1alpha1.SecretProviderClass) bool {
+	for _, parameters := range providerParameterMaps(spc) {
+		for _, v := range parameters {
+			if isParameterTemplate(v) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// renderParameterTemplates returns a copy of the secret provider class with
+// the parameter templates of its providers rendered with the pod metadata. A
+// template that references a missing label or annotation fails, unless it's
+// referenced with index.
+func renderParameterTemplates(spc *v1alpha1.SecretProviderClass, data parameterTemplateData) (*v1alpha1.SecretProviderClass, error) {
+	if !hasParameterTemplates(spc) {
+		return spc, nil
+	}
+	rendered := spc.DeepCopy()
+	for _, parameters := range providerParameterMaps(rendered) {
+		for k, v := range parameters {
+			if !isParameterTemplate(v) {
+				continue
+			}
+			tmpl, err := template.New(k).Option("missingkey=error").Parse(v)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse template of parameter %s, err: %v", k, err)
+			}
+			var b strings.Builder
+			if err := tmpl.Execute(&b, data); err != nil {
+				return nil, fmt.Errorf("failed to render template of parameter %s, err: %v", k, err)
+			}
+			parameters[k] = b.String()
+		}
+	}
+	return rendered, nil
+}
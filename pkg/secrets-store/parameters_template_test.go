@@ -0,0 +1,109 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package secretsstore
+
+import (
+	"reflect"
+	"testing"
+
+	"sigs.k8s.io/secrets-store-csi-driver/apis/v1alpha1"
+)
+
+func TestRenderParameterTemplates(t *testing.T) {
+	data := parameterTemplateData{
+		PodName:            "pod1",
+		PodNamespace:       "team-a",
+		PodUID:             "poduid1",
+		ServiceAccountName: "sa1",
+		PodLabels:          map[string]string{"app": "db", "app.kubernetes.io/name": "db"},
+	}
+
+	cases := []struct {
+		name               string
+		spec               v1alpha1.SecretProviderClassSpec
+		expectedParameters []map[string]string
+		expectedErr        bool
+	}{
+		{
+			name: "no templates",
+			spec: v1alpha1.SecretProviderClassSpec{
+				Parameters: map[string]string{"objects": "apps/team-a/db"},
+			},
+			expectedParameters: []map[string]string{{"objects": "apps/team-a/db"}},
+		},
+		{
+			name: "pod metadata",
+			spec: v1alpha1.SecretProviderClassSpec{
+				Parameters: map[string]string{
+					"objects":  "apps/{{ .PodNamespace }}/{{ .PodLabels.app }}",
+					"roleName": "{{ .ServiceAccountName }}",
+					"name":     `{{ index .PodLabels "app.kubernetes.io/name" }}-{{ index .PodLabels "missing" }}`,
+				},
+				Fallback: &v1alpha1.FallbackProvider{Parameters: map[string]string{"objects": "fallback/{{ .PodName }}"}},
+				AdditionalProviders: []*v1alpha1.AdditionalProvider{
+					{Provider: "provider2", Parameters: map[string]string{"objects": "{{ .PodUID }}"}},
+				},
+			},
+			expectedParameters: []map[string]string{
+				{"objects": "apps/team-a/db", "roleName": "sa1", "name": "db-"},
+				{"objects": "fallback/pod1"},
+				{"objects": "poduid1"},
+			},
+		},
+		{
+			name: "missing label",
+			spec: v1alpha1.SecretProviderClassSpec{
+				Parameters: map[string]string{"objects": "apps/{{ .PodLabels.team }}"},
+			},
+			expectedErr: true,
+		},
+		{
+			name: "unknown field",
+			spec: v1alpha1.SecretProviderClassSpec{
+				Parameters: map[string]string{"objects": "apps/{{ .Namespace }}"},
+			},
+			expectedErr: true,
+		},
+		{
+			name: "invalid template",
+			spec: v1alpha1.SecretProviderClassSpec{
+				Parameters: map[string]string{"objects": "apps/{{ .PodNamespace"},
+			},
+			expectedErr: true,
+		},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			spc := &v1alpha1.SecretProviderClass{Spec: test.spec}
+			original := spc.DeepCopy()
+			rendered, err := renderParameterTemplates(spc, data)
+			if test.expectedErr && err == nil || !test.expectedErr && err != nil {
+				t.Fatalf("expected err: %v, got: %+v", test.expectedErr, err)
+			}
+			if !reflect.DeepEqual(original, spc) {
+				t.Errorf("expected secret provider class to be unchanged, got: %+v", spc)
+			}
+			if test.expectedErr {
+				return
+			}
+			if parameters := providerParameterMaps(rendered); !reflect.DeepEqual(test.expectedParameters, parameters) {
+				t.Errorf("expected parameters: %v, got: %v", test.expectedParameters, parameters)
+			}
+		})
+	}
+}
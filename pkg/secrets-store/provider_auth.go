@@ -0,0 +1,122 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package secretsstore
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+// ProviderAuth configures how the driver authenticates the providers it
+// connects to. The zero value only relies on the filesystem ACLs of the
+// provider sockets.
+type ProviderAuth struct {
+	// AllowedUIDs are the user ids the provider processes are allowed to run
+	// as. The uid of the process listening on the provider socket is read with
+	// SO_PEERCRED (linux only). The uid isn't verified if AllowedUIDs is empty.
+	AllowedUIDs []uint32
+	// TLSCAFile is the CA bundle the provider certificates are verified with.
+	// mTLS is only enabled if TLSCAFile is set. The provider certificate must be
+	// issued for the provider name, so a provider can't impersonate another one.
+	TLSCAFile string
+	// TLSCertFile and TLSKeyFile are the client certificate and key presented
+	// by the driver to the providers.
+	TLSCertFile string
+	TLSKeyFile  string
+}
+
+// dialer returns the dial option connecting to the provider sockets
+func (a ProviderAuth) dialer() grpc.DialOption {
+	allowedUIDs := append([]uint32{}, a.AllowedUIDs...)
+	return grpc.WithContextDialer(func(ctx context.Context, target string) (net.Conn, error) {
+		// the process listening on a named pipe isn't verified with AllowedUIDs
+		if isNamedPipe(target) {
+			return dialPipe(ctx, target)
+		}
+		conn, err := (&net.Dialer{}).DialContext(ctx, "unix", target)
+		if err != nil || len(allowedUIDs) == 0 {
+			return conn, err
+		}
+		if err := verifyPeerUID(conn, allowedUIDs); err != nil {
+			conn.Close()
+			log.Errorf("rejected connection to provider socket %s, err: %v", target, err)
+			return nil, err
+		}
+		return conn, nil
+	})
+}
+
+// tlsConfig returns the mTLS configuration for the provider connections, or nil
+// if mTLS isn't enabled
+func (a ProviderAuth) tlsConfig() (*tls.Config, error) {
+	if len(a.TLSCAFile) == 0 {
+		return nil, nil
+	}
+	ca, err := ioutil.ReadFile(a.TLSCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read provider CA file %s, err: %v", a.TLSCAFile, err)
+	}
+	rootCAs := x509.NewCertPool()
+	if !rootCAs.AppendCertsFromPEM(ca) {
+		return nil, fmt.Errorf("no certificates found in provider CA file %s", a.TLSCAFile)
+	}
+	config := &tls.Config{RootCAs: rootCAs}
+	if len(a.TLSCertFile) > 0 || len(a.TLSKeyFile) > 0 {
+		cert, err := tls.LoadX509KeyPair(a.TLSCertFile, a.TLSKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load provider client certificate, err: %v", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+// transportCredentials returns the dial option securing the connection to the
+// provider
+func (p *PluginClientBuilder) transportCredentials(provider string) grpc.DialOption {
+	if p.tlsConfig == nil {
+		// the interface is only secured through filesystem ACLs
+		return grpc.WithInsecure()
+	}
+	config := p.tlsConfig.Clone()
+	// the provider certificate is verified against the provider name
+	config.ServerName = provider
+	return grpc.WithTransportCredentials(credentials.NewTLS(config))
+}
+
+// verifyPeerUID returns an error if the process at the other end of the
+// connection doesn't run as one of the allowed uids
+func verifyPeerUID(conn net.Conn, allowedUIDs []uint32) error {
+	uid, err := peerUID(conn)
+	if err != nil {
+		return fmt.Errorf("failed to get provider process uid, err: %v", err)
+	}
+	for _, allowedUID := range allowedUIDs {
+		if uid == allowedUID {
+			return nil
+		}
+	}
+	return fmt.Errorf("provider process uid %d is not allowed", uid)
+}
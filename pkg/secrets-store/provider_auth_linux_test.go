@@ -0,0 +1,79 @@
+//go:build linux
+// +build linux
+
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package secretsstore
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+
+	"sigs.k8s.io/secrets-store-csi-driver/provider/fake"
+)
+
+func TestProviderAuthAllowedUIDs(t *testing.T) {
+	uid := uint32(os.Getuid())
+	cases := []struct {
+		name        string
+		allowedUIDs []uint32
+		expectedErr bool
+	}{
+		{
+			name: "uid not verified",
+		},
+		{
+			name:        "provider uid allowed",
+			allowedUIDs: []uint32{uid + 1, uid},
+		},
+		{
+			name:        "provider uid not allowed",
+			allowedUIDs: []uint32{uid + 1},
+			expectedErr: true,
+		},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			socketPath := getTempTestDir(t)
+			defer os.RemoveAll(socketPath)
+
+			server, err := fake.NewMocKCSIProviderServer(fmt.Sprintf("%s/provider1.sock", socketPath))
+			if err != nil {
+				t.Fatalf("expected err to be nil, got: %+v", err)
+			}
+			server.Start()
+			defer server.Stop()
+
+			pool, err := NewPluginClientBuilderWithAuth(socketPath, ProviderAuth{AllowedUIDs: test.allowedUIDs})
+			if err != nil {
+				t.Fatalf("expected err to be nil, got: %+v", err)
+			}
+			defer pool.Cleanup()
+
+			_, err = pool.Version(context.TODO(), "provider1")
+			if test.expectedErr && err == nil {
+				t.Fatalf("expected err to be not nil")
+			}
+			if !test.expectedErr && err != nil {
+				t.Fatalf("expected err to be nil, got: %+v", err)
+			}
+		})
+	}
+}
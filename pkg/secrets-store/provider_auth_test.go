@@ -0,0 +1,209 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package secretsstore
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+
+	"sigs.k8s.io/secrets-store-csi-driver/provider/fake"
+)
+
+// testCertificate creates a certificate for the dns name signed by the issuer,
+// or a self-signed CA certificate if issuer is nil
+func testCertificate(t *testing.T, dnsName string, issuer *tls.Certificate) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: dnsName},
+		DNSNames:     []string{dnsName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	parent, signer := template, interface{}(key)
+	if issuer == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+	} else {
+		if parent, err = x509.ParseCertificate(issuer.Certificate[0]); err != nil {
+			t.Fatalf("expected err to be nil, got: %+v", err)
+		}
+		signer = issuer.PrivateKey
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, signer)
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// writeTestCertificate writes the PEM encoded certificate and key to dir
+func writeTestCertificate(t *testing.T, dir, name string, cert tls.Certificate) (string, string) {
+	keyDER, err := x509.MarshalECPrivateKey(cert.PrivateKey.(*ecdsa.PrivateKey))
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	certFile, keyFile := filepath.Join(dir, name+".crt"), filepath.Join(dir, name+".key")
+	if err := ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]}), 0600); err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	if err := ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	return certFile, keyFile
+}
+
+func TestProviderAuthTLS(t *testing.T) {
+	certDir := getTempTestDir(t)
+	defer os.RemoveAll(certDir)
+
+	ca := testCertificate(t, "ca", nil)
+	caFile, _ := writeTestCertificate(t, certDir, "ca", ca)
+	clientCertFile, clientKeyFile := writeTestCertificate(t, certDir, "client", testCertificate(t, "driver", &ca))
+	caCert, err := x509.ParseCertificate(ca.Certificate[0])
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	caPool := x509.NewCertPool()
+	caPool.AddCert(caCert)
+
+	cases := []struct {
+		name        string
+		serverName  string
+		expectedErr bool
+	}{
+		{
+			name:       "provider certificate issued for provider name",
+			serverName: "provider1",
+		},
+		{
+			name:        "provider certificate issued for another provider",
+			serverName:  "provider2",
+			expectedErr: true,
+		},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			socketPath := getTempTestDir(t)
+			defer os.RemoveAll(socketPath)
+
+			creds := credentials.NewTLS(&tls.Config{
+				Certificates: []tls.Certificate{testCertificate(t, test.serverName, &ca)},
+				ClientCAs:    caPool,
+				ClientAuth:   tls.RequireAndVerifyClientCert,
+			})
+			server, err := fake.NewMocKCSIProviderServer(fmt.Sprintf("%s/provider1.sock", socketPath), grpc.Creds(creds))
+			if err != nil {
+				t.Fatalf("expected err to be nil, got: %+v", err)
+			}
+			server.Start()
+			defer server.Stop()
+
+			pool, err := NewPluginClientBuilderWithAuth(socketPath, ProviderAuth{
+				TLSCAFile:   caFile,
+				TLSCertFile: clientCertFile,
+				TLSKeyFile:  clientKeyFile,
+			})
+			if err != nil {
+				t.Fatalf("expected err to be nil, got: %+v", err)
+			}
+			defer pool.Cleanup()
+
+			_, err = pool.Version(context.TODO(), "provider1")
+			if test.expectedErr && err == nil {
+				t.Fatalf("expected err to be not nil")
+			}
+			if !test.expectedErr && err != nil {
+				t.Fatalf("expected err to be nil, got: %+v", err)
+			}
+		})
+	}
+}
+
+func TestProviderAuthTLSConfig(t *testing.T) {
+	certDir := getTempTestDir(t)
+	defer os.RemoveAll(certDir)
+
+	invalidCAFile := filepath.Join(certDir, "invalid.crt")
+	if err := ioutil.WriteFile(invalidCAFile, []byte("invalid"), 0600); err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	caFile, _ := writeTestCertificate(t, certDir, "ca", testCertificate(t, "ca", nil))
+
+	cases := []struct {
+		name        string
+		auth        ProviderAuth
+		expectedErr bool
+	}{
+		{
+			name: "filesystem ACLs only",
+		},
+		{
+			name: "ca without client certificate",
+			auth: ProviderAuth{TLSCAFile: caFile},
+		},
+		{
+			name:        "ca file not found",
+			auth:        ProviderAuth{TLSCAFile: filepath.Join(certDir, "notfound.crt")},
+			expectedErr: true,
+		},
+		{
+			name:        "ca file without certificates",
+			auth:        ProviderAuth{TLSCAFile: invalidCAFile},
+			expectedErr: true,
+		},
+		{
+			name:        "client key not found",
+			auth:        ProviderAuth{TLSCAFile: caFile, TLSCertFile: caFile},
+			expectedErr: true,
+		},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := test.auth.tlsConfig()
+			if test.expectedErr && err == nil {
+				t.Fatalf("expected err to be not nil")
+			}
+			if !test.expectedErr && err != nil {
+				t.Fatalf("expected err to be nil, got: %+v", err)
+			}
+		})
+	}
+}
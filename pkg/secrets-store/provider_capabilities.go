@@ -0,0 +1,114 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package secretsstore
+
+import (
+	"context"
+
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"sigs.k8s.io/secrets-store-csi-driver/provider/v1alpha1"
+)
+
+// ProviderCapabilities are the optional features advertised by a provider
+type ProviderCapabilities struct {
+	// Rotation is true if the provider keeps the mounted contents up to date
+	// and doesn't need to be polled to rotate the contents
+	Rotation bool
+	// Streaming is true if the provider supports the streaming mount RPC
+	Streaming bool
+	// ObjectVersioning is true if the provider returns the versions of the
+	// mounted objects in the mount response
+	ObjectVersioning bool
+	// TokenAuth is true if the provider authenticates with the pod service
+	// account token
+	TokenAuth bool
+	// Watch is true if the provider supports the watch RPC to push the changes
+	// of the mounted objects
+	Watch bool
+	// ParametersSchema is the schema the secret provider class parameters
+	// are validated against, nil if the provider doesn't advertise a schema
+	ParametersSchema *parametersSchema
+}
+
+// defaultProviderCapabilities are the capabilities assumed for providers that
+// don't implement the Capabilities() RPC.
+var defaultProviderCapabilities = ProviderCapabilities{ObjectVersioning: true}
+
+// newProviderCapabilities returns the ProviderCapabilities for the capabilities
+// in the provider's response. Unknown capabilities are ignored.
+func newProviderCapabilities(capabilities []v1alpha1.Capability) ProviderCapabilities {
+	var c ProviderCapabilities
+	for _, capability := range capabilities {
+		switch capability {
+		case v1alpha1.Capability_ROTATION:
+			c.Rotation = true
+		case v1alpha1.Capability_STREAMING:
+			c.Streaming = true
+		case v1alpha1.Capability_OBJECT_VERSIONING:
+			c.ObjectVersioning = true
+		case v1alpha1.Capability_TOKEN_AUTH:
+			c.TokenAuth = true
+		case v1alpha1.Capability_WATCH:
+			c.Watch = true
+		}
+	}
+	return c
+}
+
+// Capabilities returns the capabilities advertised by the provider. The
+// capabilities are cached until the provider socket is removed or recreated.
+// If the provider fails to report the capabilities, the default capabilities
+// are returned and the provider is asked again on the next call.
+func (p *PluginClientBuilder) Capabilities(ctx context.Context, provider string) (ProviderCapabilities, error) {
+	p.lock.RLock()
+	capabilities, ok := p.capabilities[provider]
+	p.lock.RUnlock()
+	if ok {
+		return capabilities, nil
+	}
+
+	client, err := p.Get(ctx, provider)
+	if err != nil {
+		return defaultProviderCapabilities, err
+	}
+	resp, err := client.Capabilities(ctx, &v1alpha1.CapabilitiesRequest{})
+	switch {
+	case status.Code(err) == codes.Unimplemented:
+		capabilities = defaultProviderCapabilities
+	case err != nil:
+		log.Warningf("failed to get %s provider capabilities, err: %+v", provider, err)
+		return defaultProviderCapabilities, nil
+	default:
+		capabilities = newProviderCapabilities(resp.GetCapabilities())
+		// a provider with an invalid schema is still used without validating
+		// the parameters, so a provider bug doesn't break all the mounts
+		if capabilities.ParametersSchema, err = parseParametersSchema(resp.GetParametersSchema()); err != nil {
+			log.Warningf("ignoring %s provider parameters schema, err: %+v", provider, err)
+		}
+	}
+	log.Debugf("provider %s capabilities: %+v", provider, capabilities)
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	// only cache the capabilities if the client wasn't removed in the meantime
+	if _, ok := p.clients[provider]; ok {
+		p.capabilities[provider] = capabilities
+	}
+	return capabilities, nil
+}
@@ -0,0 +1,159 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package secretsstore
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"reflect"
+	"testing"
+
+	"sigs.k8s.io/secrets-store-csi-driver/provider/fake"
+	"sigs.k8s.io/secrets-store-csi-driver/provider/v1alpha1"
+)
+
+func TestCapabilities(t *testing.T) {
+	cases := []struct {
+		name                 string
+		capabilities         []v1alpha1.Capability
+		expectedCapabilities ProviderCapabilities
+	}{
+		{
+			name:                 "capabilities rpc not implemented",
+			expectedCapabilities: defaultProviderCapabilities,
+		},
+		{
+			name:                 "no capabilities advertised",
+			capabilities:         []v1alpha1.Capability{},
+			expectedCapabilities: ProviderCapabilities{},
+		},
+		{
+			name:                 "all capabilities advertised",
+			capabilities:         []v1alpha1.Capability{v1alpha1.Capability_ROTATION, v1alpha1.Capability_STREAMING, v1alpha1.Capability_OBJECT_VERSIONING, v1alpha1.Capability_TOKEN_AUTH, v1alpha1.Capability_WATCH},
+			expectedCapabilities: ProviderCapabilities{Rotation: true, Streaming: true, ObjectVersioning: true, TokenAuth: true, Watch: true},
+		},
+		{
+			name:                 "unknown capabilities are ignored",
+			capabilities:         []v1alpha1.Capability{v1alpha1.Capability_UNKNOWN, v1alpha1.Capability(100), v1alpha1.Capability_ROTATION},
+			expectedCapabilities: ProviderCapabilities{Rotation: true},
+		},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			socketPath := getTempTestDir(t)
+			defer os.RemoveAll(socketPath)
+
+			server, err := fake.NewMocKCSIProviderServer(fmt.Sprintf("%s/provider1.sock", socketPath))
+			if err != nil {
+				t.Fatalf("expected err to be nil, got: %+v", err)
+			}
+			if test.capabilities != nil {
+				server.SetCapabilities(test.capabilities...)
+			}
+			server.Start()
+
+			pool := NewPluginClientBuilder(socketPath)
+			defer pool.Cleanup()
+
+			capabilities, err := pool.Capabilities(context.TODO(), "provider1")
+			if err != nil {
+				t.Fatalf("expected err to be nil, got: %+v", err)
+			}
+			if !reflect.DeepEqual(capabilities, test.expectedCapabilities) {
+				t.Errorf("expected capabilities: %+v, got: %+v", test.expectedCapabilities, capabilities)
+			}
+
+			// the capabilities are cached until the provider socket is recreated
+			server.SetCapabilities(v1alpha1.Capability_TOKEN_AUTH)
+			capabilities, err = pool.Capabilities(context.TODO(), "provider1")
+			if err != nil {
+				t.Fatalf("expected err to be nil, got: %+v", err)
+			}
+			if !reflect.DeepEqual(capabilities, test.expectedCapabilities) {
+				t.Errorf("expected cached capabilities: %+v, got: %+v", test.expectedCapabilities, capabilities)
+			}
+			pool.remove("provider1")
+			capabilities, err = pool.Capabilities(context.TODO(), "provider1")
+			if err != nil {
+				t.Fatalf("expected err to be nil, got: %+v", err)
+			}
+			if !capabilities.TokenAuth {
+				t.Errorf("expected capabilities to be renegotiated after the provider is removed, got: %+v", capabilities)
+			}
+		})
+	}
+}
+
+func TestCapabilitiesProviderNotFound(t *testing.T) {
+	socketPath := getTempTestDir(t)
+	defer os.RemoveAll(socketPath)
+
+	pool := NewPluginClientBuilder(socketPath)
+	defer pool.Cleanup()
+
+	if _, err := pool.Capabilities(context.TODO(), "provider1"); err == nil {
+		t.Errorf("expected err to be not nil")
+	}
+}
+
+func TestCapabilitiesParametersSchema(t *testing.T) {
+	cases := []struct {
+		name           string
+		schema         string
+		expectedSchema bool
+	}{
+		{
+			name: "schema not advertised",
+		},
+		{
+			name:           "valid schema",
+			schema:         `{"properties": {"objects": {"type": "string"}}, "required": ["objects"]}`,
+			expectedSchema: true,
+		},
+		{
+			name:   "invalid schema is ignored",
+			schema: `{"properties": {"objects": {"pattern": "["}}}`,
+		},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			socketPath := getTempTestDir(t)
+			defer os.RemoveAll(socketPath)
+
+			server, err := fake.NewMocKCSIProviderServer(fmt.Sprintf("%s/provider1.sock", socketPath))
+			if err != nil {
+				t.Fatalf("expected err to be nil, got: %+v", err)
+			}
+			server.SetParametersSchema(test.schema)
+			server.Start()
+
+			pool := NewPluginClientBuilder(socketPath)
+			defer pool.Cleanup()
+
+			capabilities, err := pool.Capabilities(context.TODO(), "provider1")
+			if err != nil {
+				t.Fatalf("expected err to be nil, got: %+v", err)
+			}
+			if (capabilities.ParametersSchema != nil) != test.expectedSchema {
+				t.Errorf("expected parameters schema: %v, got: %+v", test.expectedSchema, capabilities.ParametersSchema)
+			}
+		})
+	}
+}
@@ -18,91 +18,735 @@ package secretsstore
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"io"
-	"net"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
 
+	log "github.com/sirupsen/logrus"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"gopkg.in/fsnotify.v1"
+	"sigs.k8s.io/secrets-store-csi-driver/pkg/util/fileutil"
+	"sigs.k8s.io/secrets-store-csi-driver/pkg/version"
 	"sigs.k8s.io/secrets-store-csi-driver/provider/v1alpha1"
 )
 
-// Strongly typed address
-type providerAddr string
-
-// Strongly typed provider name
-type csiProviderName string
+var (
+	// ErrProviderNotFound is returned by PluginClientBuilder.Get when the
+	// provider socket does not exist in the providers directory
+	ErrProviderNotFound = errors.New("provider not found")
+)
 
-type csiProviderClientCreator func(addr providerAddr) (
-	providerClient v1alpha1.CSIDriverProviderClient,
-	closer io.Closer,
-	err error,
+const (
+	// providerHealthCheckTimeout is the timeout for a single provider health check
+	providerHealthCheckTimeout = 5 * time.Second
+	// namedPipePrefix is the prefix of the windows named pipes
+	namedPipePrefix = `\\.\pipe\`
 )
 
-// csiProviderClient encapsulates all csi-provider methods
-type csiProviderClient struct {
-	providerName             csiProviderName
-	addr                     providerAddr
-	csiProviderClientCreator csiProviderClientCreator
+// providerHealth is the result of the last health check of a provider
+type providerHealth struct {
+	healthy bool
+	message string
+}
+
+// PluginClientBuilder builds and caches long-lived grpc clients for the
+// providers. Providers register by creating a unix domain socket named
+// <provider-name>.sock in the socket path, or in the socket dir of the provider.
+type PluginClientBuilder struct {
+	clients map[string]v1alpha1.CSIDriverProviderClient
+	conns   map[string]*grpc.ClientConn
+	// sockets are the provider sockets the connections were dialed to
+	sockets    map[string]os.FileInfo
+	socketPath string
+	// socketDirs are the directories of the provider sockets that aren't in
+	// the socket path
+	socketDirs map[string]string
+	// pipes are the named pipes of the providers on windows nodes
+	pipes map[string]string
+	lock  sync.RWMutex
+	opts  []grpc.DialOption
+	// tlsConfig is the mTLS configuration for the provider connections, nil if
+	// the connections are only secured through filesystem ACLs
+	tlsConfig *tls.Config
+	// capabilities caches the capabilities advertised by the providers
+	capabilities map[string]ProviderCapabilities
+	// versions caches the versions reported by the providers
+	versions map[string]providerVersion
+
+	health     map[string]providerHealth
+	healthLock sync.RWMutex
+}
+
+// NewPluginClientBuilder creates a PluginClientBuilder that will connect to
+// plugins in the provided absolute path to a folder. Plugin servers must listen
+// to the unix domain socket at:
+//
+//	<path>/<plugin_name>.sock
+//
+// where <plugin_name> must match the spec.provider field in the
+// SecretProviderClass.
+func NewPluginClientBuilder(path string, opts ...grpc.DialOption) *PluginClientBuilder {
+	return newPluginClientBuilder(path, nil, append([]grpc.DialOption{ProviderAuth{}.dialer()}, opts...))
+}
+
+// NewPluginClientBuilderWithAuth creates a PluginClientBuilder that verifies
+// the providers it connects to with the provider auth.
+func NewPluginClientBuilderWithAuth(path string, auth ProviderAuth, opts ...grpc.DialOption) (*PluginClientBuilder, error) {
+	tlsConfig, err := auth.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+	return newPluginClientBuilder(path, tlsConfig, append([]grpc.DialOption{auth.dialer()}, opts...)), nil
+}
+
+func newPluginClientBuilder(path string, tlsConfig *tls.Config, opts []grpc.DialOption) *PluginClientBuilder {
+	return &PluginClientBuilder{
+		clients:      make(map[string]v1alpha1.CSIDriverProviderClient),
+		conns:        make(map[string]*grpc.ClientConn),
+		sockets:      make(map[string]os.FileInfo),
+		socketPath:   path,
+		socketDirs:   make(map[string]string),
+		pipes:        make(map[string]string),
+		capabilities: make(map[string]ProviderCapabilities),
+		versions:     make(map[string]providerVersion),
+		lock:         sync.RWMutex{},
+		health:       make(map[string]providerHealth),
+		opts:         opts,
+		tlsConfig:    tlsConfig,
+	}
+}
+
+// SetProviderSocketDirs sets the directories of the provider sockets that
+// aren't in the socket path, e.g. for providers installed in a non-standard
+// location. The socket of the provider must be named <provider>.sock in the
+// directory. SetProviderSocketDirs must be called before the
+// PluginClientBuilder is used.
+func (p *PluginClientBuilder) SetProviderSocketDirs(dirs map[string]string) {
+	p.socketDirs = make(map[string]string, len(dirs))
+	for provider, dir := range dirs {
+		p.socketDirs[provider] = dir
+	}
+}
+
+// SetProviderPipes sets the named pipes of the providers on windows nodes,
+// e.g. \\.\pipe\vault. The providers with a named pipe don't need a socket.
+// SetProviderPipes must be called before the PluginClientBuilder is used.
+func (p *PluginClientBuilder) SetProviderPipes(pipes map[string]string) {
+	p.pipes = make(map[string]string, len(pipes))
+	for provider, pipe := range pipes {
+		p.pipes[provider] = pipe
+	}
+}
+
+// ParseProviderSocketDirs parses a comma separated list of provider=dir pairs
+func ParseProviderSocketDirs(providerSockets string) (map[string]string, error) {
+	return parseProviderPairs(providerSockets, "socket dir")
+}
+
+// ParseProviderPipes parses a comma separated list of provider=pipe pairs
+func ParseProviderPipes(providerPipes string) (map[string]string, error) {
+	pipes, err := parseProviderPairs(providerPipes, "pipe")
+	if err != nil {
+		return nil, err
+	}
+	for provider, pipe := range pipes {
+		if !isNamedPipe(pipe) {
+			return nil, fmt.Errorf("provider %s pipe %s is not a named pipe, expected %s<name>", provider, pipe, namedPipePrefix)
+		}
+	}
+	return pipes, nil
+}
+
+// parseProviderPairs parses a comma separated list of provider=value pairs
+func parseProviderPairs(pairs, kind string) (map[string]string, error) {
+	values := make(map[string]string)
+	for _, pair := range strings.Split(pairs, ",") {
+		pair = strings.TrimSpace(pair)
+		if len(pair) == 0 {
+			continue
+		}
+		pv := strings.SplitN(pair, "=", 2)
+		if len(pv) != 2 || len(strings.TrimSpace(pv[0])) == 0 || len(strings.TrimSpace(pv[1])) == 0 {
+			return nil, fmt.Errorf("provider %s not defined in expected format provider=value, got %s", kind, pair)
+		}
+		provider, value := strings.TrimSpace(pv[0]), strings.TrimSpace(pv[1])
+		if _, exists := values[provider]; exists {
+			return nil, fmt.Errorf("found duplicate provider %s in provider %ss", provider, kind)
+		}
+		values[provider] = value
+	}
+	return values, nil
+}
+
+// isNamedPipe returns true if the path is the path of a windows named pipe
+func isNamedPipe(path string) bool {
+	return strings.HasPrefix(path, namedPipePrefix)
+}
+
+// socketFile returns the absolute path to the provider socket, or the named
+// pipe of the provider
+func (p *PluginClientBuilder) socketFile(provider string) string {
+	if pipe, ok := p.pipes[provider]; ok {
+		return pipe
+	}
+	if dir, ok := p.socketDirs[provider]; ok {
+		return filepath.Join(dir, provider+".sock")
+	}
+	return filepath.Join(p.socketPath, provider+".sock")
+}
+
+// providers returns the providers with a socket in the socket path or in their
+// socket dir
+func (p *PluginClientBuilder) providers() ([]string, error) {
+	files, err := ioutil.ReadDir(p.socketPath)
+	if err != nil {
+		return nil, err
+	}
+	var providers []string
+	for _, file := range files {
+		provider, ok := providerFromSocket(file.Name())
+		if !ok {
+			continue
+		}
+		// the provider socket is expected in its socket dir
+		if _, ok := p.socketDirs[provider]; ok {
+			continue
+		}
+		if _, ok := p.pipes[provider]; ok {
+			continue
+		}
+		providers = append(providers, provider)
+	}
+	for provider := range p.socketDirs {
+		if _, ok := p.pipes[provider]; !ok && p.HasProvider(provider) {
+			providers = append(providers, provider)
+		}
+	}
+	for provider := range p.pipes {
+		providers = append(providers, provider)
+	}
+	return providers, nil
 }
 
-func newProviderClient(providerName csiProviderName, socketPath string) (*csiProviderClient, error) {
-	if providerName == "" {
+// HasProvider returns true if the provider socket exists in the socket path,
+// or a named pipe is set for the provider
+func (p *PluginClientBuilder) HasProvider(provider string) bool {
+	if provider == "" {
+		return false
+	}
+	// the named pipe isn't stat'ed as that could take a pipe instance
+	if _, ok := p.pipes[provider]; ok {
+		return true
+	}
+	_, err := os.Stat(p.socketFile(provider))
+	return err == nil
+}
+
+// Get returns a CSIDriverProviderClient for the provider. If an existing client
+// is not found a new one will be created and added to the PluginClientBuilder.
+// The existing client is dropped if the provider socket was removed or recreated
+// since the client was created, even if the change wasn't observed by Watch.
+func (p *PluginClientBuilder) Get(ctx context.Context, provider string) (v1alpha1.CSIDriverProviderClient, error) {
+	if provider == "" {
 		return nil, fmt.Errorf("provider name is empty")
 	}
-	return &csiProviderClient{
-		providerName:             providerName,
-		addr:                     providerAddr(fmt.Sprintf("%s/%s.sock", socketPath, providerName)),
-		csiProviderClientCreator: newCSIProviderClient,
-	}, nil
+
+	p.lock.RLock()
+	client, ok := p.clients[provider]
+	socketInfo := p.sockets[provider]
+	p.lock.RUnlock()
+	if _, isPipe := p.pipes[provider]; ok && isPipe {
+		// the connection to the named pipe is reestablished by grpc when the
+		// provider recreates the pipe
+		return client, nil
+	}
+	if ok && p.socketUnchanged(provider, socketInfo) {
+		return client, nil
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	// check again in case another goroutine created the client, or already
+	// replaced the client of the changed socket. Only the client of the
+	// changed socket is removed, so the client another goroutine created for
+	// the new socket isn't closed while it's in use.
+	if client, ok := p.clients[provider]; ok {
+		if _, isPipe := p.pipes[provider]; isPipe || p.socketUnchanged(provider, p.sockets[provider]) {
+			return client, nil
+		}
+		log.Infof("provider %s socket changed, reconnecting", provider)
+		p.removeLocked(provider)
+	}
+
+	socket := p.socketFile(provider)
+	var info os.FileInfo
+	if _, isPipe := p.pipes[provider]; !isPipe {
+		var err error
+		if info, err = os.Stat(socket); err != nil {
+			return nil, fmt.Errorf("%w: provider %q socket %s, err: %v", ErrProviderNotFound, provider, socket, err)
+		}
+	}
+
+	conn, err := grpc.DialContext(ctx, socket, append([]grpc.DialOption{p.transportCredentials(provider)}, p.opts...)...)
+	if err != nil {
+		return nil, err
+	}
+	client = v1alpha1.NewCSIDriverProviderClient(conn)
+	p.conns[provider] = conn
+	p.sockets[provider] = info
+	p.clients[provider] = client
+	return client, nil
+}
+
+// Watch watches the socket path for provider sockets being created or removed.
+// New providers are logged as soon as their socket is created and cached clients
+// are dropped when the socket is removed or recreated, so the next call to Get
+// dials the new socket. The watch is stopped when stopCh is closed.
+func (p *PluginClientBuilder) Watch(stopCh <-chan struct{}) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	if err := watcher.Add(p.socketPath); err != nil {
+		watcher.Close()
+		return fmt.Errorf("failed to watch provider socket path %s, err: %+v", p.socketPath, err)
+	}
+	for provider, dir := range p.socketDirs {
+		if err := watcher.Add(dir); err != nil {
+			watcher.Close()
+			return fmt.Errorf("failed to watch provider %s socket dir %s, err: %+v", provider, dir, err)
+		}
+	}
+
+	if providers, err := p.providers(); err == nil {
+		for _, provider := range providers {
+			log.Infof("discovered provider %s", provider)
+		}
+	}
+
+	go func() {
+		defer watcher.Close()
+		for {
+			select {
+			case <-stopCh:
+				return
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				p.handleSocketEvent(event)
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				log.Errorf("error watching provider socket path %s, err: %+v", p.socketPath, err)
+			}
+		}
+	}()
+	return nil
+}
+
+// handleSocketEvent drops the cached client for the provider when the socket
+// is created, removed or renamed.
+func (p *PluginClientBuilder) handleSocketEvent(event fsnotify.Event) {
+	provider, ok := providerFromSocket(event.Name)
+	if !ok {
+		return
+	}
+	// ignore sockets of other providers in a provider socket dir and sockets in
+	// the socket path of providers with a socket dir
+	if filepath.Clean(event.Name) != filepath.Clean(p.socketFile(provider)) {
+		return
+	}
+	switch {
+	case event.Op&fsnotify.Create == fsnotify.Create:
+		log.Infof("discovered provider %s", provider)
+		p.remove(provider)
+	case event.Op&(fsnotify.Remove|fsnotify.Rename) != 0:
+		log.Infof("provider %s socket removed", provider)
+		p.remove(provider)
+	}
+}
+
+// socketUnchanged returns true if the provider socket is the socket the
+// client was created for
+func (p *PluginClientBuilder) socketUnchanged(provider string, socketInfo os.FileInfo) bool {
+	info, err := os.Stat(p.socketFile(provider))
+	return err == nil && socketInfo != nil && os.SameFile(info, socketInfo)
+}
+
+// remove closes the connection to the provider and removes the cached client.
+func (p *PluginClientBuilder) remove(provider string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.removeLocked(provider)
+}
+
+// removeLocked closes the connection to the provider and removes the cached
+// client. The caller must hold the write lock.
+func (p *PluginClientBuilder) removeLocked(provider string) {
+	if conn, ok := p.conns[provider]; ok {
+		if err := conn.Close(); err != nil {
+			log.Errorf("failed to close connection to provider %s, err: %+v", provider, err)
+		}
+	}
+	delete(p.conns, provider)
+	delete(p.sockets, provider)
+	delete(p.clients, provider)
+	delete(p.capabilities, provider)
+	delete(p.versions, provider)
+
+	// the health of the new socket is unknown until it's checked again
+	p.healthLock.Lock()
+	delete(p.health, provider)
+	p.healthLock.Unlock()
+}
+
+// providerFromSocket returns the provider name from the socket file name
+func providerFromSocket(name string) (string, bool) {
+	base := filepath.Base(name)
+	if !strings.HasSuffix(base, ".sock") {
+		return "", false
+	}
+	provider := strings.TrimSuffix(base, ".sock")
+	return provider, len(provider) > 0
+}
+
+// Cleanup closes all underlying connections and removes all clients.
+func (p *PluginClientBuilder) Cleanup() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	for provider, conn := range p.conns {
+		if err := conn.Close(); err != nil {
+			log.Errorf("failed to close connection to provider %s, err: %+v", provider, err)
+		}
+	}
+	p.clients = make(map[string]v1alpha1.CSIDriverProviderClient)
+	p.conns = make(map[string]*grpc.ClientConn)
+	p.sockets = make(map[string]os.FileInfo)
+	p.capabilities = make(map[string]ProviderCapabilities)
+	p.versions = make(map[string]providerVersion)
+}
+
+// HealthCheck calls the Health() RPC of all the providers with a socket in the
+// socket path or in their socket dir every interval until stopCh is closed.
+func (p *PluginClientBuilder) HealthCheck(stopCh <-chan struct{}, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		p.checkHealth()
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+		}
+	}
 }
 
-func newCSIProviderClient(addr providerAddr) (providerClient v1alpha1.CSIDriverProviderClient, closer io.Closer, err error) {
-	var conn *grpc.ClientConn
-	conn, err = newGrpcConn(addr)
+// checkHealth checks and records the health of all the providers
+func (p *PluginClientBuilder) checkHealth() {
+	providers, err := p.providers()
 	if err != nil {
-		return nil, nil, err
+		log.Errorf("failed to list providers in %s, err: %+v", p.socketPath, err)
+		return
 	}
+	for _, provider := range providers {
+		health := p.probeHealth(provider)
+
+		p.healthLock.Lock()
+		previous, checked := p.health[provider]
+		p.health[provider] = health
+		p.healthLock.Unlock()
+
+		if !health.healthy && (!checked || previous.healthy) {
+			log.Warningf("provider %s is unhealthy, err: %s", provider, health.message)
+		} else if health.healthy && checked && !previous.healthy {
+			log.Infof("provider %s is healthy", provider)
+		}
+	}
+}
+
+// probeHealth calls the provider's Health() RPC. Providers that don't implement
+// the Health() RPC are considered healthy.
+func (p *PluginClientBuilder) probeHealth(provider string) providerHealth {
+	ctx, cancel := context.WithTimeout(context.Background(), providerHealthCheckTimeout)
+	defer cancel()
 
-	providerClient = v1alpha1.NewCSIDriverProviderClient(conn)
-	return providerClient, conn, nil
+	client, err := p.Get(ctx, provider)
+	if err != nil {
+		return providerHealth{message: err.Error()}
+	}
+	resp, err := client.Health(ctx, &v1alpha1.HealthRequest{})
+	if status.Code(err) == codes.Unimplemented {
+		return providerHealth{healthy: true}
+	}
+	if err != nil {
+		return providerHealth{message: fmt.Sprintf("health check failed, err: %v", err)}
+	}
+	return providerHealth{healthy: resp.GetHealthy(), message: resp.GetMessage()}
 }
 
-func newGrpcConn(addr providerAddr) (*grpc.ClientConn, error) {
-	network := "unix"
-	return grpc.Dial(
-		string(addr),
-		grpc.WithInsecure(),
-		grpc.WithContextDialer(func(ctx context.Context, target string) (net.Conn, error) {
-			return (&net.Dialer{}).DialContext(ctx, network, target)
-		}),
-	)
+// IsHealthy returns false and the reason if the last health check reported the
+// provider as unhealthy. Providers that haven't been checked yet are considered
+// healthy.
+func (p *PluginClientBuilder) IsHealthy(provider string) (bool, string) {
+	p.healthLock.RLock()
+	defer p.healthLock.RUnlock()
+
+	health, ok := p.health[provider]
+	if !ok {
+		return true, ""
+	}
+	return health.healthy, health.message
 }
 
-func (c *csiProviderClient) MountContent(ctx context.Context, attributes, secrets, targetPath, permission string) (map[string]string, string, error) {
-	client, closer, err := c.csiProviderClientCreator(c.addr)
+// checkDriverCompatibility gets the provider version and checks the driver
+// version is compatible with the minimum driver version required by the provider.
+// Providers that fail to report the version are considered compatible.
+func (p *PluginClientBuilder) checkDriverCompatibility(ctx context.Context, provider string) (string, error) {
+	resp, err := p.Version(ctx, provider)
+	if err != nil {
+		log.Warningf("failed to get %s provider version, err: %+v", provider, err)
+		return "", nil
+	}
+	compatible, err := version.IsDriverCompatible(vendorVersion, resp.GetMinDriverVersion())
 	if err != nil {
-		return nil, FailedToCreateProviderGRPCClient, err
+		return IncompatibleDriverVersion, err
 	}
-	defer closer.Close()
+	if !compatible {
+		return IncompatibleDriverVersion, fmt.Errorf("%s provider version %s requires minimum driver version %s, current driver version is %s", provider, resp.GetRuntimeVersion(), resp.GetMinDriverVersion(), vendorVersion)
+	}
+	return "", nil
+}
 
-	req := &v1alpha1.MountRequest{
+// providerErrorReasons are the error reasons recorded as pod events for the
+// standardized error reasons of the providers
+var providerErrorReasons = map[v1alpha1.ErrorReason]string{
+	v1alpha1.ErrorReason_AUTH_FAILURE:     ProviderAuthFailure,
+	v1alpha1.ErrorReason_OBJECT_NOT_FOUND: SecretObjectNotFound,
+	v1alpha1.ErrorReason_THROTTLED:        ProviderThrottled,
+	v1alpha1.ErrorReason_TIMEOUT:          ProviderBackendTimeout,
+}
+
+// isProviderErrorReason returns true if the error reason is the reason of a
+// standardized provider error
+func isProviderErrorReason(errorReason string) bool {
+	for _, reason := range providerErrorReasons {
+		if errorReason == reason {
+			return true
+		}
+	}
+	return false
+}
+
+// hasProviderError returns true if the provider set an error in the response
+func hasProviderError(e *v1alpha1.Error) bool {
+	return len(e.GetCode()) > 0 || e.GetReason() != v1alpha1.ErrorReason_UNSPECIFIED
+}
+
+// providerError returns the error code and error for the error set by the
+// provider in the response. The error reason of a standardized provider error
+// is returned as the error code instead of the provider error code.
+func providerError(e *v1alpha1.Error, err error) (string, error) {
+	reason, ok := providerErrorReasons[e.GetReason()]
+	if !ok {
+		return e.GetCode(), fmt.Errorf("mount request failed with provider error code %s, err: %+v", e.GetCode(), err)
+	}
+	message := fmt.Sprintf("mount request failed with provider error %s, code: %s, message: %s", reason, e.GetCode(), e.GetMessage())
+	if e.GetReason() == v1alpha1.ErrorReason_THROTTLED {
+		// throttled mount requests are retried with backoff
+		return reason, status.Error(codes.ResourceExhausted, message)
+	}
+	return reason, errors.New(message)
+}
+
+// MountContent calls the client's Mount() RPC with helpers to format the
+// request and interpret the response. If the provider returns files in the
+// response, they are written to the target path by the driver. The object
+// versions are only required from providers that advertise object versioning.
+func MountContent(ctx context.Context, client v1alpha1.CSIDriverProviderClient, capabilities ProviderCapabilities, attributes, secrets, targetPath, permission string) (map[string]string, string, error) {
+	objectVersions, _, errorCode, err := mountContent(ctx, client, capabilities, attributes, secrets, targetPath, permission)
+	return objectVersions, errorCode, err
+}
+
+// mountContent implements MountContent and also returns the earliest expiry
+// of the mounted objects
+func mountContent(ctx context.Context, client v1alpha1.CSIDriverProviderClient, capabilities ProviderCapabilities, attributes, secrets, targetPath, permission string) (map[string]string, time.Time, string, error) {
+	ov, files, errorCode, err := callMount(ctx, client, mountRequest(attributes, secrets, targetPath, permission))
+	if err != nil {
+		return nil, time.Time{}, errorCode, err
+	}
+	objectVersions, errorCode, err := writeMountResponse(capabilities, targetPath, ov, files)
+	return objectVersions, objectsExpiry(ov), errorCode, err
+}
+
+// mountRequest returns the mount request for the provider
+func mountRequest(attributes, secrets, targetPath, permission string) *v1alpha1.MountRequest {
+	return &v1alpha1.MountRequest{
 		Attributes: attributes,
 		Secrets:    secrets,
 		TargetPath: targetPath,
 		Permission: permission,
 	}
+}
 
+// callMount calls the client's Mount() RPC and returns the object versions
+// and files in the response
+func callMount(ctx context.Context, client v1alpha1.CSIDriverProviderClient, req *v1alpha1.MountRequest) ([]*v1alpha1.ObjectVersion, []*v1alpha1.File, string, error) {
 	resp, err := client.Mount(ctx, req)
-	if resp != nil && resp.GetError() != nil && len(resp.GetError().Code) > 0 {
-		return nil, resp.GetError().Code, fmt.Errorf("mount request failed with provider error code %s, err: %+v", resp.GetError().Code, err)
+	if hasProviderError(resp.GetError()) {
+		errorCode, err := providerError(resp.GetError(), err)
+		return nil, nil, errorCode, err
 	}
 	if err != nil {
-		return nil, GRPCProviderError, err
+		return nil, nil, GRPCProviderError, err
 	}
+	return resp.GetObjectVersion(), resp.GetFiles(), "", nil
+}
 
-	ov := resp.GetObjectVersion()
-	if ov == nil {
+// defaultMaxStreamSize is the maximum total size in bytes of the files
+// reassembled from a mount stream if the volume size isn't limited
+const defaultMaxStreamSize = 64 << 20
+
+// streamLimits bounds the contents reassembled from the chunks streamed by a
+// provider, so a misbehaving provider can't exhaust the memory of the driver
+type streamLimits struct {
+	// maxFileSize is the maximum size in bytes of a file, the size of the
+	// files isn't limited if zero
+	maxFileSize int64
+	// maxSize is the maximum total size in bytes of the files of a stream
+	maxSize int64
+}
+
+// newStreamLimits returns the limits of the mount streams for the maximum file
+// size and the maximum volume size, defaultMaxStreamSize bounds the streams if
+// the volume size isn't limited
+func newStreamLimits(maxFileSize, maxVolumeSize int64) streamLimits {
+	limits := streamLimits{maxFileSize: maxFileSize, maxSize: maxVolumeSize}
+	if limits.maxSize <= 0 {
+		limits.maxSize = defaultMaxStreamSize
+	}
+	return limits
+}
+
+// MountContentStream calls the client's MountStream() RPC with helpers to format
+// the request and interpret the responses. The file chunks streamed by the
+// provider are reassembled and the files are only written to the target path
+// once the stream is complete. The files of the stream are limited to
+// defaultMaxStreamSize bytes in total.
+func MountContentStream(ctx context.Context, client v1alpha1.CSIDriverProviderClient, capabilities ProviderCapabilities, attributes, secrets, targetPath, permission string) (map[string]string, string, error) {
+	objectVersions, _, errorCode, err := mountContentStream(ctx, client, capabilities, newStreamLimits(0, 0), attributes, secrets, targetPath, permission)
+	return objectVersions, errorCode, err
+}
+
+// mountContentStream implements MountContentStream and also returns the
+// earliest expiry of the mounted objects
+func mountContentStream(ctx context.Context, client v1alpha1.CSIDriverProviderClient, capabilities ProviderCapabilities, limits streamLimits, attributes, secrets, targetPath, permission string) (map[string]string, time.Time, string, error) {
+	ov, files, errorCode, err := callMountStream(ctx, client, limits, mountRequest(attributes, secrets, targetPath, permission))
+	if err != nil {
+		return nil, time.Time{}, errorCode, err
+	}
+	objectVersions, errorCode, err := writeMountResponse(capabilities, targetPath, ov, files)
+	return objectVersions, objectsExpiry(ov), errorCode, err
+}
+
+// callMountStream calls the client's MountStream() RPC and returns the object
+// versions and the files reassembled from the streamed chunks. The stream fails
+// as soon as a file or the files in total exceed the limits.
+func callMountStream(ctx context.Context, client v1alpha1.CSIDriverProviderClient, limits streamLimits, req *v1alpha1.MountRequest) ([]*v1alpha1.ObjectVersion, []*v1alpha1.File, string, error) {
+	stream, err := client.MountStream(ctx, req)
+	if err != nil {
+		return nil, nil, GRPCProviderError, err
+	}
+
+	var ov []*v1alpha1.ObjectVersion
+	var files []*v1alpha1.File
+	// index of the reassembled files by path
+	filesByPath := make(map[string]*v1alpha1.File)
+	var size int64
+	for {
+		resp, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if hasProviderError(resp.GetError()) {
+			errorCode, err := providerError(resp.GetError(), err)
+			return nil, nil, errorCode, err
+		}
+		if err != nil {
+			return nil, nil, GRPCProviderError, err
+		}
+
+		ov = append(ov, resp.GetObjectVersion()...)
+		for _, chunk := range resp.GetChunks() {
+			file, ok := filesByPath[chunk.GetPath()]
+			if !ok {
+				file = &v1alpha1.File{Path: chunk.GetPath(), Mode: chunk.GetMode()}
+				filesByPath[chunk.GetPath()] = file
+				files = append(files, file)
+			}
+			if chunk.GetOffset() != int64(len(file.Contents)) {
+				return nil, nil, GRPCProviderError, fmt.Errorf("chunk for file %s at offset %d received out of order, expected offset %d", chunk.GetPath(), chunk.GetOffset(), len(file.Contents))
+			}
+			chunkSize := int64(len(chunk.GetContents()))
+			if limits.maxFileSize > 0 && int64(len(file.Contents))+chunkSize > limits.maxFileSize {
+				return nil, nil, InvalidProviderResponse, status.Errorf(codes.ResourceExhausted, "file %s streamed by the provider is larger than the maximum file size %d", chunk.GetPath(), limits.maxFileSize)
+			}
+			if size += chunkSize; limits.maxSize > 0 && size > limits.maxSize {
+				return nil, nil, InvalidProviderResponse, status.Errorf(codes.ResourceExhausted, "files streamed by the provider are larger than the maximum size %d in total", limits.maxSize)
+			}
+			file.Contents = append(file.Contents, chunk.GetContents()...)
+		}
+	}
+	return ov, files, "", nil
+}
+
+// fetchContent calls the client's MountStream() RPC if the provider supports
+// streaming or the Mount() RPC otherwise, and returns the object versions, the
+// earliest expiry and the files in the response without writing the files to
+// the target path. Providers that write the contents to the target path
+// themselves aren't supported.
+func fetchContent(ctx context.Context, client v1alpha1.CSIDriverProviderClient, capabilities ProviderCapabilities, limits streamLimits, attributes, secrets, targetPath, permission string) (map[string]string, time.Time, []*v1alpha1.File, string, error) {
+	call := callMount
+	if capabilities.Streaming {
+		call = func(ctx context.Context, client v1alpha1.CSIDriverProviderClient, req *v1alpha1.MountRequest) ([]*v1alpha1.ObjectVersion, []*v1alpha1.File, string, error) {
+			return callMountStream(ctx, client, limits, req)
+		}
+	}
+	ov, files, errorCode, err := call(ctx, client, mountRequest(attributes, secrets, targetPath, permission))
+	if err != nil {
+		return nil, time.Time{}, nil, errorCode, err
+	}
+	objectVersions, errorCode, err := responseObjectVersions(capabilities, ov)
+	if err != nil {
+		return nil, time.Time{}, nil, errorCode, err
+	}
+	if len(files) == 0 {
+		return nil, time.Time{}, nil, InvalidProviderResponse, errors.New("missing files in the mount response")
+	}
+	if err := fileutil.ValidatePayloads(files); err != nil {
+		return nil, time.Time{}, nil, InvalidProviderResponse, err
+	}
+	return objectVersions, objectsExpiry(ov), files, "", nil
+}
+
+// responseObjectVersions returns the object versions in the mount response.
+// The object versions are required from providers that advertise object
+// versioning.
+func responseObjectVersions(capabilities ProviderCapabilities, ov []*v1alpha1.ObjectVersion) (map[string]string, string, error) {
+	if ov == nil && capabilities.ObjectVersioning {
 		return nil, GRPCProviderError, errors.New("missing object versions")
 	}
 	objectVersions := make(map[string]string)
@@ -111,3 +755,46 @@ func (c *csiProviderClient) MountContent(ctx context.Context, attributes, secret
 	}
 	return objectVersions, "", nil
 }
+
+// writeMountResponse returns the object versions in the mount response and
+// writes the files in the mount response to the target path.
+func writeMountResponse(capabilities ProviderCapabilities, targetPath string, ov []*v1alpha1.ObjectVersion, files []*v1alpha1.File) (map[string]string, string, error) {
+	objectVersions, errorCode, err := responseObjectVersions(capabilities, ov)
+	if err != nil {
+		return nil, errorCode, err
+	}
+
+	// the provider has written the contents to the target path if no files
+	// are returned in the response
+	if len(files) == 0 {
+		return objectVersions, "", nil
+	}
+	if err := fileutil.ValidatePayloads(files); err != nil {
+		return nil, InvalidProviderResponse, err
+	}
+	if err := fileutil.WritePayloads(targetPath, files); err != nil {
+		return nil, FailedToWriteFiles, err
+	}
+	return objectVersions, "", nil
+}
+
+// objectsExpiry returns the earliest expiry time of the objects, or the zero
+// time if none of the objects expire
+func objectsExpiry(ov []*v1alpha1.ObjectVersion) time.Time {
+	var expiry time.Time
+	for _, v := range ov {
+		if v.GetExpiryTime() > 0 {
+			expiry = earliestExpiry(expiry, time.Unix(v.GetExpiryTime(), 0))
+		}
+	}
+	return expiry
+}
+
+// earliestExpiry returns the earlier of the expiry times. The zero time never
+// expires.
+func earliestExpiry(a, b time.Time) time.Time {
+	if a.IsZero() || (!b.IsZero() && b.Before(a)) {
+		return b
+	}
+	return a
+}
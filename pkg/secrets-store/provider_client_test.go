@@ -22,10 +22,20 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"reflect"
+	"sort"
+	"sync"
 	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"gopkg.in/fsnotify.v1"
+	"k8s.io/apimachinery/pkg/util/wait"
 
 	"sigs.k8s.io/secrets-store-csi-driver/provider/fake"
+	"sigs.k8s.io/secrets-store-csi-driver/provider/v1alpha1"
 )
 
 func getTempTestDir(t *testing.T) string {
@@ -39,7 +49,7 @@ func getTempTestDir(t *testing.T) string {
 func TestMountContent(t *testing.T) {
 	cases := []struct {
 		name                  string
-		providerName          csiProviderName
+		providerName          string
 		socketPath            string
 		attributes            string
 		secrets               string
@@ -48,6 +58,7 @@ func TestMountContent(t *testing.T) {
 		expectedObjectVersion map[string]string
 		providerError         error
 		expectedErrorCode     string
+		capabilities          ProviderCapabilities
 	}{
 		{
 			name:                  "provider successful response",
@@ -57,15 +68,20 @@ func TestMountContent(t *testing.T) {
 			targetPath:            "/var/lib/kubelet/pods/d448c6a2-cda8-42e3-84fb-3cf75faa8399/volumes/kubernetes.io~csi/secrets-store-inline/mount",
 			permission:            "0644",
 			expectedObjectVersion: map[string]string{"secret/secret1": "v1", "secret/secret2": "v2"},
+			capabilities:          defaultProviderCapabilities,
+		},
+		{
+			name:         "provider without object versioning capability",
+			providerName: "provider1",
+			socketPath:   getTempTestDir(t),
+			attributes:   "{}",
+			targetPath:   "/var/lib/kubelet/pods/d448c6a2-cda8-42e3-84fb-3cf75faa8399/volumes/kubernetes.io~csi/secrets-store-inline/mount",
+			permission:   "0644",
 		},
 	}
 
 	for _, test := range cases {
 		t.Run(test.name, func(t *testing.T) {
-			client, err := newProviderClient(test.providerName, test.socketPath)
-			if err != nil {
-				t.Fatalf("expected err to be nil, got: %+v", err)
-			}
 			serverEndpoint := fmt.Sprintf("%s/%s.sock", test.socketPath, test.providerName)
 			defer os.Remove(serverEndpoint)
 
@@ -78,7 +94,15 @@ func TestMountContent(t *testing.T) {
 			server.SetProviderErrorCode(test.expectedErrorCode)
 			server.Start()
 
-			objectVersions, errorCode, err := client.MountContent(context.TODO(), test.attributes, test.secrets, test.targetPath, test.permission)
+			pool := NewPluginClientBuilder(test.socketPath)
+			defer pool.Cleanup()
+
+			client, err := pool.Get(context.TODO(), test.providerName)
+			if err != nil {
+				t.Fatalf("expected err to be nil, got: %+v", err)
+			}
+
+			objectVersions, errorCode, err := MountContent(context.TODO(), client, test.capabilities, test.attributes, test.secrets, test.targetPath, test.permission)
 			if err != nil {
 				t.Errorf("expected err to be nil, got: %+v", err)
 			}
@@ -95,7 +119,7 @@ func TestMountContent(t *testing.T) {
 func TestMountContentError(t *testing.T) {
 	cases := []struct {
 		name                  string
-		providerName          csiProviderName
+		providerName          string
 		socketPath            string
 		attributes            string
 		secrets               string
@@ -167,10 +191,6 @@ func TestMountContentError(t *testing.T) {
 
 	for _, test := range cases {
 		t.Run(test.name, func(t *testing.T) {
-			client, err := newProviderClient(test.providerName, test.socketPath)
-			if err != nil {
-				t.Fatalf("expected err to be nil, got: %+v", err)
-			}
 			serverEndpoint := fmt.Sprintf("%s/%s.sock", test.socketPath, test.providerName)
 			defer os.Remove(serverEndpoint)
 
@@ -183,7 +203,15 @@ func TestMountContentError(t *testing.T) {
 			server.SetProviderErrorCode(test.expectedErrorCode)
 			server.Start()
 
-			objectVersions, errorCode, err := client.MountContent(context.TODO(), test.attributes, test.secrets, test.targetPath, test.permission)
+			pool := NewPluginClientBuilder(test.socketPath)
+			defer pool.Cleanup()
+
+			client, err := pool.Get(context.TODO(), test.providerName)
+			if err != nil {
+				t.Fatalf("expected err to be nil, got: %+v", err)
+			}
+
+			objectVersions, errorCode, err := MountContent(context.TODO(), client, defaultProviderCapabilities, test.attributes, test.secrets, test.targetPath, test.permission)
 			if err == nil {
 				t.Errorf("expected err to be not nil")
 			}
@@ -196,3 +224,927 @@ func TestMountContentError(t *testing.T) {
 		})
 	}
 }
+
+func TestMountContentProviderErrorReason(t *testing.T) {
+	cases := []struct {
+		name              string
+		reason            v1alpha1.ErrorReason
+		expectedErrorCode string
+		expectedCode      codes.Code
+	}{
+		{
+			name:              "auth failure",
+			reason:            v1alpha1.ErrorReason_AUTH_FAILURE,
+			expectedErrorCode: ProviderAuthFailure,
+			expectedCode:      codes.Unknown,
+		},
+		{
+			name:              "object not found",
+			reason:            v1alpha1.ErrorReason_OBJECT_NOT_FOUND,
+			expectedErrorCode: SecretObjectNotFound,
+			expectedCode:      codes.Unknown,
+		},
+		{
+			name:              "throttled",
+			reason:            v1alpha1.ErrorReason_THROTTLED,
+			expectedErrorCode: ProviderThrottled,
+			expectedCode:      codes.ResourceExhausted,
+		},
+		{
+			name:              "timeout",
+			reason:            v1alpha1.ErrorReason_TIMEOUT,
+			expectedErrorCode: ProviderBackendTimeout,
+			expectedCode:      codes.Unknown,
+		},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			socketPath := getTempTestDir(t)
+			defer os.RemoveAll(socketPath)
+
+			server, err := fake.NewMocKCSIProviderServer(fmt.Sprintf("%s/provider1.sock", socketPath))
+			if err != nil {
+				t.Fatalf("expected err to be nil, got: %+v", err)
+			}
+			server.SetProviderErrorCode("BackendError")
+			server.SetProviderErrorReason(test.reason, "backend error")
+			server.Start()
+			defer server.Stop()
+
+			pool := NewPluginClientBuilder(socketPath)
+			defer pool.Cleanup()
+
+			client, err := pool.Get(context.TODO(), "provider1")
+			if err != nil {
+				t.Fatalf("expected err to be nil, got: %+v", err)
+			}
+			_, errorCode, err := MountContent(context.TODO(), client, defaultProviderCapabilities, "{}", "", "/tmp", "0644")
+			if err == nil {
+				t.Fatalf("expected err to be not nil")
+			}
+			if errorCode != test.expectedErrorCode {
+				t.Errorf("expected error code: %v, got: %+v", test.expectedErrorCode, errorCode)
+			}
+			if status.Code(err) != test.expectedCode {
+				t.Errorf("expected err code: %v, got: %+v", test.expectedCode, err)
+			}
+			if !isProviderErrorReason(errorCode) {
+				t.Errorf("expected %s to be a provider error reason", errorCode)
+			}
+		})
+	}
+}
+
+func TestMountContentWritesFiles(t *testing.T) {
+	socketPath := getTempTestDir(t)
+	defer os.RemoveAll(socketPath)
+	targetPath := getTempTestDir(t)
+	defer os.RemoveAll(targetPath)
+
+	server, err := fake.NewMocKCSIProviderServer(fmt.Sprintf("%s/provider1.sock", socketPath))
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	server.SetObjects(map[string]string{"secret/secret1": "v1"})
+	server.SetFiles(map[string]string{"secret1": "value1"})
+	server.Start()
+
+	pool := NewPluginClientBuilder(socketPath)
+	defer pool.Cleanup()
+
+	client, err := pool.Get(context.TODO(), "provider1")
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	if _, _, err = MountContent(context.TODO(), client, defaultProviderCapabilities, "{}", "", targetPath, "0644"); err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	content, err := ioutil.ReadFile(filepath.Join(targetPath, "secret1"))
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	if string(content) != "value1" {
+		t.Errorf("expected file content: value1, got: %s", string(content))
+	}
+}
+
+func TestMountContentInvalidResponse(t *testing.T) {
+	socketPath := getTempTestDir(t)
+	defer os.RemoveAll(socketPath)
+	targetPath := getTempTestDir(t)
+	defer os.RemoveAll(targetPath)
+
+	server, err := fake.NewMocKCSIProviderServer(fmt.Sprintf("%s/provider1.sock", socketPath))
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	server.SetObjects(map[string]string{"secret/secret1": "v1"})
+	server.SetFiles(map[string]string{"../secret1": "value1"})
+	server.Start()
+
+	pool := NewPluginClientBuilder(socketPath)
+	defer pool.Cleanup()
+
+	client, err := pool.Get(context.TODO(), "provider1")
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	_, errorCode, err := MountContent(context.TODO(), client, defaultProviderCapabilities, "{}", "", targetPath, "0644")
+	if err == nil {
+		t.Fatalf("expected err to be not nil")
+	}
+	if errorCode != InvalidProviderResponse {
+		t.Errorf("expected error code: %v, got: %+v", InvalidProviderResponse, errorCode)
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(targetPath), "secret1")); !os.IsNotExist(err) {
+		t.Errorf("expected file outside the target path to not exist, got: %+v", err)
+	}
+}
+
+func TestMountContentStream(t *testing.T) {
+	cases := []struct {
+		name                  string
+		chunkSize             int
+		files                 map[string]string
+		expectedObjectVersion map[string]string
+		providerError         error
+		providerErrorCode     string
+		expectedErrorCode     string
+		expectedErr           bool
+	}{
+		{
+			name:                  "files reassembled from chunks",
+			chunkSize:             3,
+			files:                 map[string]string{"secret1": "value1", "secret2": "a much longer value2"},
+			expectedObjectVersion: map[string]string{"secret/secret1": "v1", "secret/secret2": "v2"},
+		},
+		{
+			name:                  "empty file",
+			chunkSize:             3,
+			files:                 map[string]string{"secret1": ""},
+			expectedObjectVersion: map[string]string{"secret/secret1": "v1"},
+		},
+		{
+			name:              "provider error",
+			providerError:     errors.New("failed in provider"),
+			expectedErrorCode: GRPCProviderError,
+			expectedErr:       true,
+		},
+		{
+			name:              "provider returns error code",
+			providerErrorCode: "AuthenticationFailed",
+			expectedErrorCode: "AuthenticationFailed",
+			expectedErr:       true,
+		},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			socketPath := getTempTestDir(t)
+			defer os.RemoveAll(socketPath)
+			targetPath := getTempTestDir(t)
+			defer os.RemoveAll(targetPath)
+
+			server, err := fake.NewMocKCSIProviderServer(fmt.Sprintf("%s/provider1.sock", socketPath))
+			if err != nil {
+				t.Fatalf("expected err to be nil, got: %+v", err)
+			}
+			server.SetReturnError(test.providerError)
+			server.SetProviderErrorCode(test.providerErrorCode)
+			server.SetObjects(test.expectedObjectVersion)
+			server.SetFiles(test.files)
+			if test.chunkSize > 0 {
+				server.SetChunkSize(test.chunkSize)
+			}
+			server.Start()
+
+			pool := NewPluginClientBuilder(socketPath)
+			defer pool.Cleanup()
+
+			client, err := pool.Get(context.TODO(), "provider1")
+			if err != nil {
+				t.Fatalf("expected err to be nil, got: %+v", err)
+			}
+			objectVersions, errorCode, err := MountContentStream(context.TODO(), client, ProviderCapabilities{Streaming: true}, "{}", "", targetPath, "0644")
+			if test.expectedErr && err == nil || !test.expectedErr && err != nil {
+				t.Fatalf("expected err: %v, got: %+v", test.expectedErr, err)
+			}
+			if errorCode != test.expectedErrorCode {
+				t.Errorf("expected error code: %v, got: %+v", test.expectedErrorCode, errorCode)
+			}
+			if test.expectedObjectVersion != nil && !reflect.DeepEqual(test.expectedObjectVersion, objectVersions) {
+				t.Errorf("expected object versions: %v, got: %+v", test.expectedObjectVersion, objectVersions)
+			}
+			for name, expected := range test.files {
+				content, err := ioutil.ReadFile(filepath.Join(targetPath, name))
+				if err != nil {
+					t.Fatalf("expected err to be nil, got: %+v", err)
+				}
+				if string(content) != expected {
+					t.Errorf("expected file content: %s, got: %s", expected, string(content))
+				}
+			}
+		})
+	}
+}
+
+func TestMountContentStreamLimits(t *testing.T) {
+	cases := []struct {
+		name         string
+		limits       streamLimits
+		files        map[string]string
+		expectedCode codes.Code
+		expectedErr  bool
+	}{
+		{
+			name:   "files within the limits",
+			limits: streamLimits{maxFileSize: 6, maxSize: 12},
+			files:  map[string]string{"secret1": "value1", "secret2": "value2"},
+		},
+		{
+			name:         "file larger than the maximum file size",
+			limits:       streamLimits{maxFileSize: 5, maxSize: 12},
+			files:        map[string]string{"secret1": "value1"},
+			expectedCode: codes.ResourceExhausted,
+			expectedErr:  true,
+		},
+		{
+			name:         "files larger than the maximum size in total",
+			limits:       streamLimits{maxFileSize: 6, maxSize: 11},
+			files:        map[string]string{"secret1": "value1", "secret2": "value2"},
+			expectedCode: codes.ResourceExhausted,
+			expectedErr:  true,
+		},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			socketPath := getTempTestDir(t)
+			defer os.RemoveAll(socketPath)
+			targetPath := getTempTestDir(t)
+			defer os.RemoveAll(targetPath)
+
+			server, err := fake.NewMocKCSIProviderServer(fmt.Sprintf("%s/provider1.sock", socketPath))
+			if err != nil {
+				t.Fatalf("expected err to be nil, got: %+v", err)
+			}
+			server.SetFiles(test.files)
+			server.SetChunkSize(2)
+			server.Start()
+
+			pool := NewPluginClientBuilder(socketPath)
+			defer pool.Cleanup()
+
+			client, err := pool.Get(context.TODO(), "provider1")
+			if err != nil {
+				t.Fatalf("expected err to be nil, got: %+v", err)
+			}
+			_, _, errorCode, err := mountContentStream(context.TODO(), client, ProviderCapabilities{Streaming: true}, test.limits, "{}", "", targetPath, "0644")
+			if test.expectedErr && err == nil || !test.expectedErr && err != nil {
+				t.Fatalf("expected err: %v, got: %+v", test.expectedErr, err)
+			}
+			if !test.expectedErr {
+				return
+			}
+			if errorCode != InvalidProviderResponse {
+				t.Errorf("expected error code: %v, got: %+v", InvalidProviderResponse, errorCode)
+			}
+			if code := status.Code(err); code != test.expectedCode {
+				t.Errorf("expected status code: %v, got: %v", test.expectedCode, code)
+			}
+			files, err := ioutil.ReadDir(targetPath)
+			if err != nil {
+				t.Fatalf("expected err to be nil, got: %+v", err)
+			}
+			if len(files) != 0 {
+				t.Errorf("expected no files to be written, got: %d", len(files))
+			}
+		})
+	}
+}
+
+func TestFetchContent(t *testing.T) {
+	cases := []struct {
+		name              string
+		capabilities      ProviderCapabilities
+		files             map[string]string
+		expectedErrorCode string
+		expectedErr       bool
+	}{
+		{
+			name:  "files fetched with mount",
+			files: map[string]string{"secret1": "value1", "secret2": "value2"},
+		},
+		{
+			name:         "files fetched with mount stream",
+			capabilities: ProviderCapabilities{Streaming: true},
+			files:        map[string]string{"secret1": "value1", "secret2": "value2"},
+		},
+		{
+			name:              "provider doesn't return the files",
+			expectedErrorCode: InvalidProviderResponse,
+			expectedErr:       true,
+		},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			socketPath := getTempTestDir(t)
+			defer os.RemoveAll(socketPath)
+			targetPath := getTempTestDir(t)
+			defer os.RemoveAll(targetPath)
+
+			server, err := fake.NewMocKCSIProviderServer(fmt.Sprintf("%s/provider1.sock", socketPath))
+			if err != nil {
+				t.Fatalf("expected err to be nil, got: %+v", err)
+			}
+			server.SetObjects(map[string]string{"secret/secret1": "v1"})
+			server.SetFiles(test.files)
+			server.Start()
+
+			pool := NewPluginClientBuilder(socketPath)
+			defer pool.Cleanup()
+
+			client, err := pool.Get(context.TODO(), "provider1")
+			if err != nil {
+				t.Fatalf("expected err to be nil, got: %+v", err)
+			}
+			_, _, files, errorCode, err := fetchContent(context.TODO(), client, test.capabilities, newStreamLimits(0, 0), "{}", "", targetPath, "0644")
+			if test.expectedErr && err == nil || !test.expectedErr && err != nil {
+				t.Fatalf("expected err: %v, got: %+v", test.expectedErr, err)
+			}
+			if errorCode != test.expectedErrorCode {
+				t.Errorf("expected error code: %v, got: %+v", test.expectedErrorCode, errorCode)
+			}
+			fetched := make(map[string]string)
+			for _, file := range files {
+				fetched[file.Path] = string(file.Contents)
+			}
+			if len(test.files) > 0 && !reflect.DeepEqual(test.files, fetched) {
+				t.Errorf("expected files: %v, got: %v", test.files, fetched)
+			}
+			// the files are never written to the target path
+			if mounted, err := ioutil.ReadDir(targetPath); err != nil || len(mounted) != 0 {
+				t.Errorf("expected no files in target path, got: %v, err: %+v", mounted, err)
+			}
+		})
+	}
+}
+
+func TestObjectsExpiry(t *testing.T) {
+	cases := []struct {
+		name           string
+		objectVersions []*v1alpha1.ObjectVersion
+		expectedExpiry time.Time
+	}{
+		{
+			name:           "objects don't expire",
+			objectVersions: []*v1alpha1.ObjectVersion{{Id: "secret/secret1", Version: "v1"}},
+		},
+		{
+			name: "earliest expiry of the objects",
+			objectVersions: []*v1alpha1.ObjectVersion{
+				{Id: "secret/secret1", Version: "v1", ExpiryTime: 1700000300},
+				{Id: "secret/secret2", Version: "v1"},
+				{Id: "secret/secret3", Version: "v1", ExpiryTime: 1700000100},
+			},
+			expectedExpiry: time.Unix(1700000100, 0),
+		},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			if expiry := objectsExpiry(test.objectVersions); !expiry.Equal(test.expectedExpiry) {
+				t.Errorf("expected expiry: %v, got: %v", test.expectedExpiry, expiry)
+			}
+		})
+	}
+}
+
+func TestPluginClientBuilder(t *testing.T) {
+	socketPath := getTempTestDir(t)
+	defer os.RemoveAll(socketPath)
+
+	pool := NewPluginClientBuilder(socketPath)
+	defer pool.Cleanup()
+
+	if pool.HasProvider("provider1") {
+		t.Errorf("expected provider1 to not be registered")
+	}
+	if _, err := pool.Get(context.TODO(), "provider1"); !errors.Is(err, ErrProviderNotFound) {
+		t.Errorf("expected err to be ErrProviderNotFound, got: %+v", err)
+	}
+
+	server, err := fake.NewMocKCSIProviderServer(fmt.Sprintf("%s/provider1.sock", socketPath))
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	server.Start()
+
+	if !pool.HasProvider("provider1") {
+		t.Errorf("expected provider1 to be registered")
+	}
+	client1, err := pool.Get(context.TODO(), "provider1")
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	client2, err := pool.Get(context.TODO(), "provider1")
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	if client1 != client2 {
+		t.Errorf("expected the same client to be returned for provider1")
+	}
+}
+
+func TestPluginClientBuilderWatch(t *testing.T) {
+	socketPath := getTempTestDir(t)
+	defer os.RemoveAll(socketPath)
+
+	pool := NewPluginClientBuilder(socketPath)
+	defer pool.Cleanup()
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	if err := pool.Watch(stopCh); err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+
+	serverEndpoint := fmt.Sprintf("%s/provider1.sock", socketPath)
+	server, err := fake.NewMocKCSIProviderServer(serverEndpoint)
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	server.Start()
+
+	if _, err := pool.Get(context.TODO(), "provider1"); err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	if err := os.Remove(serverEndpoint); err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+
+	// the cached client should be dropped once the socket is removed
+	if err := wait.PollImmediate(10*time.Millisecond, 5*time.Second, func() (bool, error) {
+		pool.lock.RLock()
+		defer pool.lock.RUnlock()
+		_, ok := pool.clients["provider1"]
+		return !ok, nil
+	}); err != nil {
+		t.Fatalf("expected client for provider1 to be removed, err: %+v", err)
+	}
+}
+
+func TestPluginClientBuilderSocketDirs(t *testing.T) {
+	socketPath := getTempTestDir(t)
+	defer os.RemoveAll(socketPath)
+	socketDir := getTempTestDir(t)
+	defer os.RemoveAll(socketDir)
+
+	pool := NewPluginClientBuilder(socketPath)
+	defer pool.Cleanup()
+	pool.SetProviderSocketDirs(map[string]string{"provider2": socketDir})
+
+	// provider2 is only discovered in its socket dir
+	for _, socket := range []string{fmt.Sprintf("%s/provider1.sock", socketPath), fmt.Sprintf("%s/provider2.sock", socketPath), fmt.Sprintf("%s/provider2.sock", socketDir)} {
+		server, err := fake.NewMocKCSIProviderServer(socket)
+		if err != nil {
+			t.Fatalf("expected err to be nil, got: %+v", err)
+		}
+		server.Start()
+		defer server.Stop()
+	}
+
+	providers, err := pool.providers()
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	sort.Strings(providers)
+	if !reflect.DeepEqual(providers, []string{"provider1", "provider2"}) {
+		t.Errorf("expected providers: [provider1 provider2], got: %v", providers)
+	}
+	if socket := pool.socketFile("provider2"); socket != filepath.Join(socketDir, "provider2.sock") {
+		t.Errorf("expected provider2 socket in %s, got: %s", socketDir, socket)
+	}
+	for _, provider := range []string{"provider1", "provider2"} {
+		if _, err := pool.Version(context.TODO(), provider); err != nil {
+			t.Fatalf("expected err to be nil, got: %+v", err)
+		}
+	}
+
+	// the provider2 socket in the socket path doesn't drop the client
+	pool.handleSocketEvent(fsnotify.Event{Name: fmt.Sprintf("%s/provider2.sock", socketPath), Op: fsnotify.Remove})
+	pool.lock.RLock()
+	_, ok := pool.clients["provider2"]
+	pool.lock.RUnlock()
+	if !ok {
+		t.Errorf("expected client for provider2 to be cached")
+	}
+	pool.handleSocketEvent(fsnotify.Event{Name: fmt.Sprintf("%s/provider2.sock", socketDir), Op: fsnotify.Remove})
+	pool.lock.RLock()
+	_, ok = pool.clients["provider2"]
+	pool.lock.RUnlock()
+	if ok {
+		t.Errorf("expected client for provider2 to be removed")
+	}
+}
+
+func TestParseProviderSocketDirs(t *testing.T) {
+	cases := []struct {
+		name            string
+		providerSockets string
+		expectedDirs    map[string]string
+		expectedErr     bool
+	}{
+		{
+			name:            "empty",
+			providerSockets: "",
+			expectedDirs:    map[string]string{},
+		},
+		{
+			name:            "multiple providers",
+			providerSockets: "vault=/path/a, aws=/path/b",
+			expectedDirs:    map[string]string{"vault": "/path/a", "aws": "/path/b"},
+		},
+		{
+			name:            "dir not set",
+			providerSockets: "vault=",
+			expectedErr:     true,
+		},
+		{
+			name:            "invalid format",
+			providerSockets: "vault",
+			expectedErr:     true,
+		},
+		{
+			name:            "duplicate provider",
+			providerSockets: "vault=/path/a,vault=/path/b",
+			expectedErr:     true,
+		},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			dirs, err := ParseProviderSocketDirs(test.providerSockets)
+			if test.expectedErr {
+				if err == nil {
+					t.Fatalf("expected err to be not nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected err to be nil, got: %+v", err)
+			}
+			if !reflect.DeepEqual(dirs, test.expectedDirs) {
+				t.Errorf("expected dirs: %v, got: %v", test.expectedDirs, dirs)
+			}
+		})
+	}
+}
+
+func TestParseProviderPipes(t *testing.T) {
+	cases := []struct {
+		name          string
+		providerPipes string
+		expectedPipes map[string]string
+		expectedErr   bool
+	}{
+		{
+			name:          "empty",
+			providerPipes: "",
+			expectedPipes: map[string]string{},
+		},
+		{
+			name:          "multiple providers",
+			providerPipes: `vault=\\.\pipe\vault,azure=\\.\pipe\azure-provider`,
+			expectedPipes: map[string]string{"vault": `\\.\pipe\vault`, "azure": `\\.\pipe\azure-provider`},
+		},
+		{
+			name:          "not a named pipe",
+			providerPipes: "vault=/path/a",
+			expectedErr:   true,
+		},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			pipes, err := ParseProviderPipes(test.providerPipes)
+			if test.expectedErr {
+				if err == nil {
+					t.Fatalf("expected err to be not nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected err to be nil, got: %+v", err)
+			}
+			if !reflect.DeepEqual(pipes, test.expectedPipes) {
+				t.Errorf("expected pipes: %v, got: %v", test.expectedPipes, pipes)
+			}
+		})
+	}
+}
+
+func TestPluginClientBuilderPipes(t *testing.T) {
+	socketPath := getTempTestDir(t)
+	defer os.RemoveAll(socketPath)
+
+	pool := NewPluginClientBuilder(socketPath)
+	defer pool.Cleanup()
+	pool.SetProviderPipes(map[string]string{"provider1": `\\.\pipe\provider1`})
+
+	// the socket of a provider with a named pipe isn't used
+	server, err := fake.NewMocKCSIProviderServer(fmt.Sprintf("%s/provider1.sock", socketPath))
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	server.Start()
+	defer server.Stop()
+
+	if !pool.HasProvider("provider1") {
+		t.Errorf("expected provider1 with a named pipe to be found")
+	}
+	if socket := pool.socketFile("provider1"); socket != `\\.\pipe\provider1` {
+		t.Errorf("expected provider1 named pipe, got: %s", socket)
+	}
+	providers, err := pool.providers()
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	if !reflect.DeepEqual(providers, []string{"provider1"}) {
+		t.Errorf("expected providers: [provider1], got: %v", providers)
+	}
+	if _, err := pool.Get(context.TODO(), "provider1"); err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+}
+
+func TestProviderFromSocket(t *testing.T) {
+	cases := []struct {
+		name             string
+		expectedProvider string
+		expectedOK       bool
+	}{
+		{name: "/etc/kubernetes/secrets-store-csi-providers/vault.sock", expectedProvider: "vault", expectedOK: true},
+		{name: "azure.sock", expectedProvider: "azure", expectedOK: true},
+		{name: "/etc/kubernetes/secrets-store-csi-providers/azure"},
+		{name: ".sock"},
+	}
+
+	for _, tc := range cases {
+		provider, ok := providerFromSocket(tc.name)
+		if provider != tc.expectedProvider || ok != tc.expectedOK {
+			t.Errorf("expected (%s, %v) for %s, got: (%s, %v)", tc.expectedProvider, tc.expectedOK, tc.name, provider, ok)
+		}
+	}
+}
+
+func TestCheckDriverCompatibility(t *testing.T) {
+	cases := []struct {
+		name              string
+		minDriverVersion  string
+		expectedErrorCode string
+		expectedErr       bool
+	}{
+		{
+			name: "min driver version not set",
+		},
+		{
+			name:             "driver version is compatible",
+			minDriverVersion: "0.0.1",
+		},
+		{
+			name:              "driver version is not compatible",
+			minDriverVersion:  "100.0.0",
+			expectedErrorCode: IncompatibleDriverVersion,
+			expectedErr:       true,
+		},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			socketPath := getTempTestDir(t)
+			defer os.RemoveAll(socketPath)
+
+			server, err := fake.NewMocKCSIProviderServer(fmt.Sprintf("%s/provider1.sock", socketPath))
+			if err != nil {
+				t.Fatalf("expected err to be nil, got: %+v", err)
+			}
+			server.SetMinDriverVersion(test.minDriverVersion)
+			server.Start()
+
+			pool := NewPluginClientBuilder(socketPath)
+			defer pool.Cleanup()
+
+			errorCode, err := pool.checkDriverCompatibility(context.TODO(), "provider1")
+			if test.expectedErr && err == nil || !test.expectedErr && err != nil {
+				t.Fatalf("expected err: %v, got: %+v", test.expectedErr, err)
+			}
+			if errorCode != test.expectedErrorCode {
+				t.Errorf("expected error code: %v, got: %+v", test.expectedErrorCode, errorCode)
+			}
+		})
+	}
+}
+
+func TestPluginClientBuilderVersion(t *testing.T) {
+	socketPath := getTempTestDir(t)
+	defer os.RemoveAll(socketPath)
+
+	server, err := fake.NewMocKCSIProviderServer(fmt.Sprintf("%s/provider1.sock", socketPath))
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	server.SetMinDriverVersion("0.0.1")
+	server.Start()
+
+	pool := NewPluginClientBuilder(socketPath)
+	defer pool.Cleanup()
+
+	resp, err := pool.Version(context.TODO(), "provider1")
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	if resp.GetMinDriverVersion() != "0.0.1" {
+		t.Errorf("expected min driver version: 0.0.1, got: %s", resp.GetMinDriverVersion())
+	}
+
+	// the cached version is returned until the provider is removed
+	server.SetMinDriverVersion("0.0.2")
+	if resp, err = pool.Version(context.TODO(), "provider1"); err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	if resp.GetMinDriverVersion() != "0.0.1" {
+		t.Errorf("expected cached min driver version: 0.0.1, got: %s", resp.GetMinDriverVersion())
+	}
+
+	pool.remove("provider1")
+	if resp, err = pool.Version(context.TODO(), "provider1"); err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	if resp.GetMinDriverVersion() != "0.0.2" {
+		t.Errorf("expected min driver version: 0.0.2, got: %s", resp.GetMinDriverVersion())
+	}
+
+	// the cached version expires after the cache ttl
+	pool.lock.Lock()
+	version := pool.versions["provider1"]
+	version.expiry = time.Now().Add(-time.Second)
+	pool.versions["provider1"] = version
+	pool.lock.Unlock()
+	server.SetMinDriverVersion("0.0.3")
+	if resp, err = pool.Version(context.TODO(), "provider1"); err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	if resp.GetMinDriverVersion() != "0.0.3" {
+		t.Errorf("expected min driver version: 0.0.3, got: %s", resp.GetMinDriverVersion())
+	}
+}
+
+func TestPluginClientBuilderSocketRecreated(t *testing.T) {
+	socketPath := getTempTestDir(t)
+	defer os.RemoveAll(socketPath)
+	socket := fmt.Sprintf("%s/provider1.sock", socketPath)
+
+	server, err := fake.NewMocKCSIProviderServer(socket)
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	server.SetMinDriverVersion("0.0.1")
+	server.Start()
+
+	// the provider volume path isn't watched, so the recreated socket has to be
+	// detected when the client is looked up
+	pool := NewPluginClientBuilder(socketPath)
+	defer pool.Cleanup()
+
+	if _, err := pool.Get(context.TODO(), "provider1"); err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	if _, err := pool.Version(context.TODO(), "provider1"); err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+
+	server.Stop()
+	if _, err := pool.Get(context.TODO(), "provider1"); !errors.Is(err, ErrProviderNotFound) {
+		t.Fatalf("expected err to be ErrProviderNotFound, got: %+v", err)
+	}
+
+	server, err = fake.NewMocKCSIProviderServer(socket)
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	server.SetMinDriverVersion("0.0.2")
+	server.Start()
+	defer server.Stop()
+
+	if _, err := pool.Get(context.TODO(), "provider1"); err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	resp, err := pool.Version(context.TODO(), "provider1")
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	if resp.GetMinDriverVersion() != "0.0.2" {
+		t.Errorf("expected min driver version: 0.0.2, got: %s", resp.GetMinDriverVersion())
+	}
+}
+
+func TestPluginClientBuilderSocketRecreatedConcurrentGet(t *testing.T) {
+	socketPath := getTempTestDir(t)
+	defer os.RemoveAll(socketPath)
+	socket := fmt.Sprintf("%s/provider1.sock", socketPath)
+
+	server, err := fake.NewMocKCSIProviderServer(socket)
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	server.Start()
+	defer server.Stop()
+
+	pool := NewPluginClientBuilder(socketPath)
+	defer pool.Cleanup()
+
+	if _, err := pool.Get(context.TODO(), "provider1"); err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	// the cached client is for another socket file, as if the provider
+	// recreated its socket since the client was created
+	stale, err := os.Stat(socketPath)
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	pool.lock.Lock()
+	pool.sockets["provider1"] = stale
+	pool.lock.Unlock()
+
+	// the mounts that all see the stale socket share the client of the new
+	// socket instead of closing each other's client
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	clients := make(chan v1alpha1.CSIDriverProviderClient, 20)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			client, err := pool.Get(context.TODO(), "provider1")
+			if err != nil {
+				t.Errorf("expected err to be nil, got: %+v", err)
+				return
+			}
+			clients <- client
+		}()
+	}
+	close(start)
+	wg.Wait()
+	close(clients)
+	var shared v1alpha1.CSIDriverProviderClient
+	for client := range clients {
+		if shared == nil {
+			shared = client
+		}
+		if client != shared {
+			t.Errorf("expected the client of the new socket to be shared")
+		}
+		if _, err := client.Version(context.TODO(), &v1alpha1.VersionRequest{Version: "v1alpha1"}); err != nil {
+			t.Errorf("expected err to be nil, got: %+v", err)
+		}
+	}
+}
+
+func TestPluginClientBuilderHealthCheck(t *testing.T) {
+	socketPath := getTempTestDir(t)
+	defer os.RemoveAll(socketPath)
+
+	pool := NewPluginClientBuilder(socketPath)
+	defer pool.Cleanup()
+
+	// providers that haven't been checked are considered healthy
+	if healthy, _ := pool.IsHealthy("provider1"); !healthy {
+		t.Errorf("expected provider1 to be healthy before the health check")
+	}
+
+	server, err := fake.NewMocKCSIProviderServer(fmt.Sprintf("%s/provider1.sock", socketPath))
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	server.SetHealth(false, "backend not reachable")
+	server.Start()
+
+	pool.checkHealth()
+	healthy, message := pool.IsHealthy("provider1")
+	if healthy {
+		t.Errorf("expected provider1 to be unhealthy")
+	}
+	if message != "backend not reachable" {
+		t.Errorf("expected message: backend not reachable, got: %s", message)
+	}
+
+	server.SetHealth(true, "")
+	pool.checkHealth()
+	if healthy, message := pool.IsHealthy("provider1"); !healthy {
+		t.Errorf("expected provider1 to be healthy, got: %s", message)
+	}
+}
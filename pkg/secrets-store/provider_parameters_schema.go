@@ -0,0 +1,184 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package secretsstore
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+// podInfoParameterPrefix is the prefix of the pod info parameters added by
+// the driver. The pod info parameters aren't validated against the provider's
+// parameters schema.
+const podInfoParameterPrefix = "csi.storage.k8s.io/"
+
+// parametersSchema is the JSON schema of the SecretProviderClass parameters
+// advertised by a provider. The parameters are a map of strings, so only the
+// keywords of an object of string properties are supported and the other
+// keywords are ignored.
+type parametersSchema struct {
+	Properties           map[string]*parameterSchema `json:"properties"`
+	Required             []string                    `json:"required"`
+	AdditionalProperties *bool                       `json:"additionalProperties"`
+}
+
+// parameterSchema is the JSON schema of a single parameter. Parameters of type
+// boolean, integer or number must be strings that parse as the type.
+type parameterSchema struct {
+	Type    string   `json:"type"`
+	Enum    []string `json:"enum"`
+	Pattern string   `json:"pattern"`
+
+	pattern *regexp.Regexp
+}
+
+// parseParametersSchema parses the parameters schema advertised by a provider.
+// It returns nil if the provider doesn't advertise a schema.
+func parseParametersSchema(schema string) (*parametersSchema, error) {
+	if len(strings.TrimSpace(schema)) == 0 {
+		return nil, nil
+	}
+	var s parametersSchema
+	if err := json.Unmarshal([]byte(schema), &s); err != nil {
+		return nil, fmt.Errorf("failed to parse parameters schema, err: %v", err)
+	}
+	for name, property := range s.Properties {
+		if property == nil {
+			return nil, fmt.Errorf("parameter %q schema is not set", name)
+		}
+		switch property.Type {
+		case "", "string", "boolean", "integer", "number":
+		default:
+			return nil, fmt.Errorf("parameter %q has unsupported type %q", name, property.Type)
+		}
+		if len(property.Pattern) > 0 {
+			pattern, err := regexp.Compile(property.Pattern)
+			if err != nil {
+				return nil, fmt.Errorf("parameter %q has invalid pattern, err: %v", name, err)
+			}
+			property.pattern = pattern
+		}
+	}
+	return &s, nil
+}
+
+// validate returns an error listing all the parameters that don't match the
+// schema. Unknown parameters are rejected if additionalProperties is false.
+func (s *parametersSchema) validate(parameters map[string]string) error {
+	var errs []string
+	for _, name := range s.Required {
+		if _, ok := parameters[name]; !ok {
+			errs = append(errs, fmt.Sprintf("missing required parameter %q", name))
+		}
+	}
+	names := make([]string, 0, len(parameters))
+	for name := range parameters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if strings.HasPrefix(name, podInfoParameterPrefix) {
+			continue
+		}
+		property, ok := s.Properties[name]
+		if !ok {
+			if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+				errs = append(errs, s.unknownParameterError(name))
+			}
+			continue
+		}
+		if err := property.validate(parameters[name]); err != nil {
+			errs = append(errs, fmt.Sprintf("parameter %q %v", name, err))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, ", "))
+	}
+	return nil
+}
+
+// unknownParameterError returns the error of an unknown parameter with the
+// closest known parameter, as unknown parameters are usually misspelled.
+func (s *parametersSchema) unknownParameterError(name string) string {
+	suggestion, distance := "", len(name)/2+1
+	for property := range s.Properties {
+		if d := editDistance(strings.ToLower(name), strings.ToLower(property)); d < distance || (d == distance && property < suggestion) {
+			suggestion, distance = property, d
+		}
+	}
+	if len(suggestion) > 0 {
+		return fmt.Sprintf("unknown parameter %q, did you mean %q", name, suggestion)
+	}
+	return fmt.Sprintf("unknown parameter %q", name)
+}
+
+// validate returns an error if the value doesn't match the parameter schema
+func (p *parameterSchema) validate(value string) error {
+	var err error
+	switch p.Type {
+	case "boolean":
+		_, err = strconv.ParseBool(value)
+	case "integer":
+		_, err = strconv.ParseInt(value, 10, 64)
+	case "number":
+		_, err = strconv.ParseFloat(value, 64)
+	}
+	if err != nil {
+		return fmt.Errorf("must be of type %s, got %q", p.Type, value)
+	}
+	if len(p.Enum) > 0 && !sets.NewString(p.Enum...).Has(value) {
+		return fmt.Errorf("must be one of %q, got %q", p.Enum, value)
+	}
+	if p.pattern != nil && !p.pattern.MatchString(value) {
+		return fmt.Errorf("must match pattern %q, got %q", p.Pattern, value)
+	}
+	return nil
+}
+
+// editDistance returns the levenshtein distance of a and b
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = minInt(minInt(prev[j]+1, cur[j-1]+1), prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,147 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package secretsstore
+
+import (
+	"testing"
+)
+
+func TestParseParametersSchema(t *testing.T) {
+	cases := []struct {
+		name           string
+		schema         string
+		expectedSchema bool
+		expectedErr    bool
+	}{
+		{
+			name: "schema not set",
+		},
+		{
+			name:           "valid schema",
+			schema:         `{"type": "object", "properties": {"objects": {"type": "string", "description": "objects to mount"}, "usePodIdentity": {"type": "boolean"}}, "required": ["objects"], "additionalProperties": false}`,
+			expectedSchema: true,
+		},
+		{
+			name:        "invalid json",
+			schema:      `{"properties":`,
+			expectedErr: true,
+		},
+		{
+			name:        "unsupported type",
+			schema:      `{"properties": {"objects": {"type": "array"}}}`,
+			expectedErr: true,
+		},
+		{
+			name:        "invalid pattern",
+			schema:      `{"properties": {"objects": {"pattern": "["}}}`,
+			expectedErr: true,
+		},
+		{
+			name:        "property schema not set",
+			schema:      `{"properties": {"objects": null}}`,
+			expectedErr: true,
+		},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			schema, err := parseParametersSchema(test.schema)
+			if test.expectedErr != (err != nil) {
+				t.Fatalf("expected err: %v, got: %+v", test.expectedErr, err)
+			}
+			if test.expectedSchema != (schema != nil) {
+				t.Errorf("expected schema: %v, got: %+v", test.expectedSchema, schema)
+			}
+		})
+	}
+}
+
+func TestValidateParameters(t *testing.T) {
+	schema, err := parseParametersSchema(`{
+		"properties": {
+			"objects": {"type": "string"},
+			"keyvaultName": {"type": "string", "pattern": "^[a-z0-9-]+$"},
+			"cloudName": {"type": "string", "enum": ["AzurePublicCloud", "AzureChinaCloud"]},
+			"usePodIdentity": {"type": "boolean"},
+			"maxRetries": {"type": "integer"}
+		},
+		"required": ["objects"],
+		"additionalProperties": false
+	}`)
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+
+	cases := []struct {
+		name        string
+		parameters  map[string]string
+		expectedErr string
+	}{
+		{
+			name: "valid parameters",
+			parameters: map[string]string{
+				"objects":        "secret1",
+				"keyvaultName":   "kv-1",
+				"cloudName":      "AzurePublicCloud",
+				"usePodIdentity": "true",
+				"maxRetries":     "3",
+				csipodname:       "pod1",
+			},
+		},
+		{
+			name:        "missing required parameter",
+			parameters:  map[string]string{"keyvaultName": "kv-1"},
+			expectedErr: `missing required parameter "objects"`,
+		},
+		{
+			name:        "misspelled parameter",
+			parameters:  map[string]string{"objects": "secret1", "keyVaultname": "kv-1"},
+			expectedErr: `unknown parameter "keyVaultname", did you mean "keyvaultName"`,
+		},
+		{
+			name:        "unknown parameter",
+			parameters:  map[string]string{"objects": "secret1", "tenant": "tenant1"},
+			expectedErr: `unknown parameter "tenant"`,
+		},
+		{
+			name:        "invalid values",
+			parameters:  map[string]string{"objects": "secret1", "keyvaultName": "KV_1", "cloudName": "Azure", "usePodIdentity": "yes", "maxRetries": "1.5"},
+			expectedErr: `parameter "cloudName" must be one of ["AzurePublicCloud" "AzureChinaCloud"], got "Azure", parameter "keyvaultName" must match pattern "^[a-z0-9-]+$", got "KV_1", parameter "maxRetries" must be of type integer, got "1.5", parameter "usePodIdentity" must be of type boolean, got "yes"`,
+		},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			err := schema.validate(test.parameters)
+			if len(test.expectedErr) == 0 {
+				if err != nil {
+					t.Fatalf("expected err to be nil, got: %+v", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != test.expectedErr {
+				t.Errorf("expected err: %s, got: %+v", test.expectedErr, err)
+			}
+		})
+	}
+
+	// unknown parameters are allowed unless additionalProperties is false
+	schema.AdditionalProperties = nil
+	if err := schema.validate(map[string]string{"objects": "secret1", "tenant": "tenant1"}); err != nil {
+		t.Errorf("expected err to be nil, got: %+v", err)
+	}
+}
@@ -0,0 +1,143 @@
+//go:build windows
+// +build windows
+
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package secretsstore
+
+import (
+	"context"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"golang.org/x/sys/windows"
+)
+
+const (
+	// securitySQOSPresent and securityIdentification only allow the provider to
+	// identify the driver, not to impersonate it
+	securitySQOSPresent    = 0x00100000
+	securityIdentification = 0x00010000
+
+	// pipeBusyRetryInterval is the interval between attempts to open a named
+	// pipe with all instances busy
+	pipeBusyRetryInterval = 10 * time.Millisecond
+)
+
+// pipeAddr is the address of a named pipe
+type pipeAddr string
+
+func (a pipeAddr) Network() string { return "pipe" }
+func (a pipeAddr) String() string  { return string(a) }
+
+// pipeConn is a net.Conn on a named pipe opened for overlapped I/O, so reads
+// and writes from different goroutines don't block each other
+type pipeConn struct {
+	handle    windows.Handle
+	path      string
+	closeOnce sync.Once
+}
+
+// dialPipe connects to the named pipe, retrying while all pipe instances are
+// busy until ctx is done
+func dialPipe(ctx context.Context, path string) (net.Conn, error) {
+	name, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		handle, err := windows.CreateFile(name, windows.GENERIC_READ|windows.GENERIC_WRITE, 0, nil, windows.OPEN_EXISTING,
+			windows.FILE_FLAG_OVERLAPPED|securitySQOSPresent|securityIdentification, 0)
+		if err == nil {
+			return &pipeConn{handle: handle, path: path}, nil
+		}
+		if err != windows.ERROR_PIPE_BUSY {
+			return nil, &net.OpError{Op: "dial", Net: "pipe", Addr: pipeAddr(path), Err: err}
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(pipeBusyRetryInterval):
+		}
+	}
+}
+
+// overlapped runs the read or write on the pipe and waits for it to complete
+func (c *pipeConn) overlapped(b []byte, op func(windows.Handle, []byte, *uint32, *windows.Overlapped) error) (int, error) {
+	event, err := windows.CreateEvent(nil, 1, 0, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer windows.CloseHandle(event)
+
+	o := &windows.Overlapped{HEvent: event}
+	var n uint32
+	err = op(c.handle, b, &n, o)
+	if err == windows.ERROR_IO_PENDING {
+		err = windows.GetOverlappedResult(c.handle, o, &n, true)
+	}
+	return int(n), err
+}
+
+func (c *pipeConn) Read(b []byte) (int, error) {
+	n, err := c.overlapped(b, windows.ReadFile)
+	switch err {
+	case nil:
+		return n, nil
+	case windows.ERROR_BROKEN_PIPE, windows.ERROR_PIPE_NOT_CONNECTED:
+		return n, io.EOF
+	case windows.ERROR_OPERATION_ABORTED:
+		return n, io.ErrClosedPipe
+	}
+	return n, &net.OpError{Op: "read", Net: "pipe", Addr: pipeAddr(c.path), Err: err}
+}
+
+func (c *pipeConn) Write(b []byte) (int, error) {
+	var written int
+	for written < len(b) {
+		n, err := c.overlapped(b[written:], windows.WriteFile)
+		written += n
+		if err == windows.ERROR_OPERATION_ABORTED {
+			return written, io.ErrClosedPipe
+		}
+		if err != nil {
+			return written, &net.OpError{Op: "write", Net: "pipe", Addr: pipeAddr(c.path), Err: err}
+		}
+	}
+	return written, nil
+}
+
+// Close cancels the pending reads and writes and closes the pipe
+func (c *pipeConn) Close() error {
+	var err error
+	c.closeOnce.Do(func() {
+		windows.CancelIoEx(c.handle, nil)
+		err = windows.CloseHandle(c.handle)
+	})
+	return err
+}
+
+func (c *pipeConn) LocalAddr() net.Addr  { return pipeAddr(c.path) }
+func (c *pipeConn) RemoteAddr() net.Addr { return pipeAddr(c.path) }
+
+// SetDeadline, SetReadDeadline and SetWriteDeadline aren't supported, the
+// provider calls are bounded by the request context instead
+func (c *pipeConn) SetDeadline(t time.Time) error      { return nil }
+func (c *pipeConn) SetReadDeadline(t time.Time) error  { return nil }
+func (c *pipeConn) SetWriteDeadline(t time.Time) error { return nil }
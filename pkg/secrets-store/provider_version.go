@@ -0,0 +1,64 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package secretsstore
+
+import (
+	"context"
+	"time"
+
+	"sigs.k8s.io/secrets-store-csi-driver/provider/v1alpha1"
+)
+
+// providerVersionCacheTTL is the duration the version reported by a provider is
+// cached. The cached version is dropped earlier if the provider socket is
+// removed or recreated.
+const providerVersionCacheTTL = 5 * time.Minute
+
+// providerVersion is the cached version response of a provider
+type providerVersion struct {
+	resp   *v1alpha1.VersionResponse
+	expiry time.Time
+}
+
+// Version returns the version reported by the provider. The version is cached
+// for providerVersionCacheTTL or until the provider socket is removed or recreated,
+// so the Version() RPC isn't called for every mount request. Errors aren't cached.
+func (p *PluginClientBuilder) Version(ctx context.Context, provider string) (*v1alpha1.VersionResponse, error) {
+	p.lock.RLock()
+	version, ok := p.versions[provider]
+	p.lock.RUnlock()
+	if ok && time.Now().Before(version.expiry) {
+		return version.resp, nil
+	}
+
+	client, err := p.Get(ctx, provider)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Version(ctx, &v1alpha1.VersionRequest{Version: vendorVersion})
+	if err != nil {
+		return nil, err
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	// only cache the version if the client wasn't removed in the meantime
+	if _, ok := p.clients[provider]; ok {
+		p.versions[provider] = providerVersion{resp: resp, expiry: time.Now().Add(providerVersionCacheTTL)}
+	}
+	return resp, nil
+}
@@ -0,0 +1,104 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package secretsstore
+
+import (
+	"context"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/apimachinery/pkg/util/wait"
+
+	"sigs.k8s.io/secrets-store-csi-driver/apis/v1alpha1"
+)
+
+const (
+	// retryBackoffFactor is the factor the backoff is multiplied by for every retry
+	retryBackoffFactor = 2.0
+	// retryBackoffJitter is the maximum fraction of the backoff added as jitter
+	retryBackoffJitter = 0.2
+)
+
+// RetryPolicy configures the retries of provider calls that fail with a
+// retryable grpc code
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts, including the first attempt
+	MaxAttempts int
+	// InitialBackoff is the backoff before the first retry
+	InitialBackoff time.Duration
+	// MaxBackoff is the maximum backoff between retries
+	MaxBackoff time.Duration
+}
+
+// withOverrides returns the retry policy with the overrides defined in the
+// SecretProviderClass retry policy
+func (p RetryPolicy) withOverrides(overrides *v1alpha1.RetryPolicy) RetryPolicy {
+	if overrides == nil {
+		return p
+	}
+	if overrides.MaxAttempts != nil {
+		p.MaxAttempts = int(*overrides.MaxAttempts)
+	}
+	if overrides.InitialBackoff != nil {
+		p.InitialBackoff = overrides.InitialBackoff.Duration
+	}
+	if overrides.MaxBackoff != nil {
+		p.MaxBackoff = overrides.MaxBackoff.Duration
+	}
+	return p
+}
+
+// isRetryable returns true if the provider call failed with a transient error
+func isRetryable(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.ResourceExhausted, codes.Aborted:
+		return true
+	default:
+		return false
+	}
+}
+
+// do calls fn until it succeeds, fails with an error that isn't retryable, the
+// maximum attempts are reached or the context is done. The error code and error
+// of the last attempt are returned.
+func (p RetryPolicy) do(ctx context.Context, provider string, fn func() (string, error)) (string, error) {
+	backoff := wait.Backoff{
+		Duration: p.InitialBackoff,
+		Factor:   retryBackoffFactor,
+		Jitter:   retryBackoffJitter,
+		Steps:    p.MaxAttempts,
+		Cap:      p.MaxBackoff,
+	}
+	for attempt := 1; ; attempt++ {
+		errorCode, err := fn()
+		if err == nil || attempt >= p.MaxAttempts || !isRetryable(err) {
+			return errorCode, err
+		}
+		delay := backoff.Step()
+		log.Warningf("provider %s call failed, attempt %d of %d, retrying in %v, err: %v", provider, attempt, p.MaxAttempts, delay, err)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return errorCode, err
+		case <-timer.C:
+		}
+	}
+}
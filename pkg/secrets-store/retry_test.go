@@ -0,0 +1,144 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package secretsstore
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"sigs.k8s.io/secrets-store-csi-driver/apis/v1alpha1"
+)
+
+func TestRetryPolicyDo(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond}
+
+	cases := []struct {
+		name             string
+		errs             []error
+		expectedAttempts int
+		expectedErr      bool
+	}{
+		{
+			name:             "success on first attempt",
+			errs:             []error{nil},
+			expectedAttempts: 1,
+		},
+		{
+			name:             "success after retryable errors",
+			errs:             []error{status.Error(codes.Unavailable, "unavailable"), status.Error(codes.ResourceExhausted, "exhausted"), nil},
+			expectedAttempts: 3,
+		},
+		{
+			name:             "error is not retryable",
+			errs:             []error{status.Error(codes.InvalidArgument, "invalid"), nil},
+			expectedAttempts: 1,
+			expectedErr:      true,
+		},
+		{
+			name:             "error without grpc code is not retryable",
+			errs:             []error{errors.New("failed"), nil},
+			expectedAttempts: 1,
+			expectedErr:      true,
+		},
+		{
+			name:             "maximum attempts reached",
+			errs:             []error{status.Error(codes.Unavailable, "unavailable"), status.Error(codes.Unavailable, "unavailable"), status.Error(codes.Unavailable, "unavailable"), nil},
+			expectedAttempts: 3,
+			expectedErr:      true,
+		},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			attempts := 0
+			_, err := policy.do(context.TODO(), "provider1", func() (string, error) {
+				err := test.errs[attempts]
+				attempts++
+				return "", err
+			})
+			if test.expectedErr && err == nil || !test.expectedErr && err != nil {
+				t.Fatalf("expected err: %v, got: %+v", test.expectedErr, err)
+			}
+			if attempts != test.expectedAttempts {
+				t.Errorf("expected attempts: %d, got: %d", test.expectedAttempts, attempts)
+			}
+		})
+	}
+}
+
+func TestRetryPolicyDoContextDone(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Hour, MaxBackoff: time.Hour}
+
+	ctx, cancel := context.WithTimeout(context.TODO(), 10*time.Millisecond)
+	defer cancel()
+
+	attempts := 0
+	_, err := policy.do(ctx, "provider1", func() (string, error) {
+		attempts++
+		return GRPCProviderError, status.Error(codes.Unavailable, "unavailable")
+	})
+	if err == nil {
+		t.Fatalf("expected err to be not nil")
+	}
+	if attempts != 1 {
+		t.Errorf("expected attempts: 1, got: %d", attempts)
+	}
+}
+
+func TestRetryPolicyWithOverrides(t *testing.T) {
+	maxAttempts := int32(5)
+	policy := RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Second, MaxBackoff: time.Minute}
+
+	cases := []struct {
+		name           string
+		overrides      *v1alpha1.RetryPolicy
+		expectedPolicy RetryPolicy
+	}{
+		{
+			name:           "no overrides",
+			expectedPolicy: policy,
+		},
+		{
+			name:           "max attempts override",
+			overrides:      &v1alpha1.RetryPolicy{MaxAttempts: &maxAttempts},
+			expectedPolicy: RetryPolicy{MaxAttempts: 5, InitialBackoff: time.Second, MaxBackoff: time.Minute},
+		},
+		{
+			name: "backoff overrides",
+			overrides: &v1alpha1.RetryPolicy{
+				InitialBackoff: &metav1.Duration{Duration: 2 * time.Second},
+				MaxBackoff:     &metav1.Duration{Duration: 10 * time.Second},
+			},
+			expectedPolicy: RetryPolicy{MaxAttempts: 3, InitialBackoff: 2 * time.Second, MaxBackoff: 10 * time.Second},
+		},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			if p := policy.withOverrides(test.overrides); !reflect.DeepEqual(p, test.expectedPolicy) {
+				t.Errorf("expected policy: %+v, got: %+v", test.expectedPolicy, p)
+			}
+		})
+	}
+}
@@ -0,0 +1,1111 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package secretsstore
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/net/context"
+	"golang.org/x/time/rate"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"sigs.k8s.io/secrets-store-csi-driver/apis/v1alpha1"
+	"sigs.k8s.io/secrets-store-csi-driver/controllers"
+	"sigs.k8s.io/secrets-store-csi-driver/pkg/util/cron"
+	"sigs.k8s.io/secrets-store-csi-driver/pkg/util/fileutil"
+)
+
+const (
+	// rotationWorkers is the number of volumes rotated concurrently
+	rotationWorkers = 5
+	// rotationFailureEventThreshold is the number of consecutive failed
+	// rotation attempts of a volume after which a warning event is recorded
+	// on the pod for every failed attempt
+	rotationFailureEventThreshold = 3
+)
+
+// RotationConfig configures the rotation of the mounted contents
+type RotationConfig struct {
+	// Enabled enables fetching the mounted contents from the providers again
+	// every poll interval and updating the files in the target paths
+	Enabled bool
+	// PollInterval is the interval the mounted contents are rotated
+	PollInterval time.Duration
+	// Jitter is the maximum random delay of the rotation of a volume as a
+	// fraction of the poll interval, so the volumes of a node don't call the
+	// providers at the same time
+	Jitter float64
+	// RenewBefore is how long before the expiry of the mounted objects reported
+	// by the providers the volume is rotated. Volumes with objects that expire
+	// are rotated before the expiry instead of every poll interval.
+	RenewBefore time.Duration
+	// MaxBackoff is the maximum interval between the rotation attempts of a
+	// volume that keeps failing. The interval is doubled after every failed
+	// attempt, starting from the poll interval. Volumes aren't backed off if
+	// the max backoff is 0.
+	MaxBackoff time.Duration
+	// RateLimit is the maximum number of provider calls per second for the
+	// rotation of the volumes of the node, so the rotation doesn't starve the
+	// mounts of new pods or exceed the quotas of the secrets stores. The
+	// provider calls aren't limited if the rate limit is 0.
+	RateLimit float64
+	// RateBurst is the maximum number of provider calls for the rotation above
+	// the rate limit
+	RateBurst int
+	// TriggerAddr is the address of the http endpoint that rotates the volumes
+	// of a pod or secret provider class without waiting for the next poll, a
+	// loopback host:port or a unix:// socket path. The endpoint isn't
+	// authenticated, so it isn't served on the addresses reachable by the pods
+	// of the host network node plugin. The endpoint is disabled if empty.
+	TriggerAddr string
+	// DryRun only reports the changes the rotation would make with events,
+	// metrics and the rotation status, without updating the mounted files,
+	// the synced secrets or the object versions of the volumes
+	DryRun bool
+	// SyncNamespaces are the namespaces the synced secrets are allowed to be
+	// rotated in from other namespaces, the same as the secret provider class
+	// pod status controller
+	SyncNamespaces []string
+	// SyncDebounce is the minimum interval between the updates of a synced
+	// secret or configmap. The changes within the interval are coalesced into
+	// a single update with the latest contents at the end of the interval. The
+	// updates aren't debounced if the interval is 0.
+	SyncDebounce time.Duration
+	// SyncRateLimit is the maximum number of updates of the synced secrets and
+	// configmaps per second per namespace, so the rotation doesn't flood the
+	// api server. The updates aren't limited if the rate limit is 0.
+	SyncRateLimit float64
+	// SyncRateBurst is the maximum number of updates per namespace above the
+	// sync rate limit
+	SyncRateBurst int
+}
+
+// Validate returns an error if the rotation config is invalid
+func (c RotationConfig) Validate() error {
+	if !c.Enabled {
+		return nil
+	}
+	if c.PollInterval <= 0 {
+		return fmt.Errorf("rotation poll interval must be greater than 0, got: %v", c.PollInterval)
+	}
+	if c.Jitter < 0 || c.Jitter > 1 {
+		return fmt.Errorf("rotation jitter must be between 0 and 1, got: %v", c.Jitter)
+	}
+	if c.RenewBefore < 0 {
+		return fmt.Errorf("rotation renew before must not be negative, got: %v", c.RenewBefore)
+	}
+	if c.MaxBackoff < 0 {
+		return fmt.Errorf("rotation max backoff must not be negative, got: %v", c.MaxBackoff)
+	}
+	if c.RateLimit < 0 {
+		return fmt.Errorf("rotation rate limit must not be negative, got: %v", c.RateLimit)
+	}
+	if c.RateLimit > 0 && c.RateBurst < 1 {
+		return fmt.Errorf("rotation rate burst must be greater than 0, got: %v", c.RateBurst)
+	}
+	if c.SyncDebounce < 0 {
+		return fmt.Errorf("rotation sync debounce must not be negative, got: %v", c.SyncDebounce)
+	}
+	if c.SyncRateLimit < 0 {
+		return fmt.Errorf("rotation sync rate limit must not be negative, got: %v", c.SyncRateLimit)
+	}
+	if c.SyncRateLimit > 0 && c.SyncRateBurst < 1 {
+		return fmt.Errorf("rotation sync rate burst must be greater than 0, got: %v", c.SyncRateBurst)
+	}
+	if len(c.TriggerAddr) > 0 {
+		if err := validateTriggerAddr(c.TriggerAddr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rotationReconciler rotates the contents of the volumes mounted on the node.
+// The volumes are listed from the secret provider class pod statuses every
+// poll interval and each volume is rotated after a random delay. Volumes of
+// providers with the watch capability are also rotated as soon as the provider
+// reports a change of the mounted objects, and volumes can be rotated on
+// demand with the rotation trigger endpoint. The queued volumes with mounted
+// certificates are rotated before the other volumes, in the order of the
+// certificate expiry.
+type rotationReconciler struct {
+	ns     *nodeServer
+	config RotationConfig
+	queue  *rotationQueue
+	// random returns a pseudo-random number in [0.0,1.0)
+	random func() float64
+	// limiter limits the rate of the provider calls for the rotation
+	limiter *rate.Limiter
+	// syncWriter debounces and rate limits the updates of the synced secrets
+	// and configmaps
+	syncWriter *syncWriter
+
+	watchLock sync.Mutex
+	// watches are the open watch streams of the volumes
+	watches map[types.NamespacedName]*volumeWatch
+
+	certExpiryLock sync.Mutex
+	// certExpiry is the earliest expiry of the certificates mounted in the
+	// volumes, the priority of the volumes in the queue
+	certExpiry map[types.NamespacedName]time.Time
+}
+
+// newRotationReconciler returns a rotation reconciler for the volumes mounted
+// by the node server
+func newRotationReconciler(ns *nodeServer, config RotationConfig) *rotationReconciler {
+	limiter := rate.NewLimiter(rate.Inf, 0)
+	if config.RateLimit > 0 {
+		limiter = rate.NewLimiter(rate.Limit(config.RateLimit), config.RateBurst)
+	}
+	r := &rotationReconciler{
+		ns:         ns,
+		config:     config,
+		random:     rand.Float64,
+		limiter:    limiter,
+		syncWriter: newSyncWriter(config),
+		watches:    make(map[types.NamespacedName]*volumeWatch),
+		certExpiry: make(map[types.NamespacedName]time.Time),
+	}
+	r.queue = newRotationQueue(r.queuePriority)
+	return r
+}
+
+// run rotates the mounted contents until the stop channel is closed
+func (r *rotationReconciler) run(stopCh <-chan struct{}) {
+	defer r.queue.ShutDown()
+	defer r.stopWatches(nil)
+	log.Infof("rotating mounted contents every %v with jitter %v", r.config.PollInterval, r.config.Jitter)
+	for i := 0; i < rotationWorkers; i++ {
+		go wait.Until(r.runWorker, time.Second, stopCh)
+	}
+	if len(r.config.TriggerAddr) > 0 {
+		go r.serveTrigger(stopCh)
+	}
+	wait.Until(r.enqueueVolumes, r.config.PollInterval, stopCh)
+}
+
+// enqueueVolumes adds the secret provider class pod statuses of the node to
+// the queue with a random delay, or shortly before the expiry of the mounted
+// objects. The volumes of the secret provider classes that changed since the
+// volumes were mounted are added without delay. The watch streams of the
+// volumes that are no longer mounted on the node are closed.
+func (r *rotationReconciler) enqueueVolumes() {
+	ctx := context.Background()
+	spcPodStatuses := &v1alpha1.SecretProviderClassPodStatusList{}
+	if err := r.ns.client.List(ctx, spcPodStatuses, client.MatchingLabels{v1alpha1.InternalNodeLabel: r.ns.nodeID}); err != nil {
+		log.Errorf("failed to list secret provider class pod statuses for rotation, err: %+v", err)
+		return
+	}
+	volumes := make(map[types.NamespacedName]bool, len(spcPodStatuses.Items))
+	targetPaths := make(map[types.NamespacedName]string, len(spcPodStatuses.Items))
+	for _, spcPodStatus := range spcPodStatuses.Items {
+		key := types.NamespacedName{Namespace: spcPodStatus.Namespace, Name: spcPodStatus.Name}
+		volumes[key] = true
+		targetPaths[key] = spcPodStatus.Status.TargetPath
+	}
+	r.updateCertificateExpiry(targetPaths)
+	// the classes are fetched once per class and namespace for all the volumes
+	classes := make(map[string]*v1alpha1.SecretProviderClass)
+	for _, spcPodStatus := range spcPodStatuses.Items {
+		key := types.NamespacedName{Namespace: spcPodStatus.Namespace, Name: spcPodStatus.Name}
+		var generation int64
+		var interval time.Duration
+		if spc := r.volumeClass(ctx, &spcPodStatus, classes); spc != nil {
+			generation = spc.Generation
+			if spc.Spec.Defaults != nil && spc.Spec.Defaults.RotationInterval != nil {
+				interval = spc.Spec.Defaults.RotationInterval.Duration
+			}
+		}
+		if delay, ok := r.delay(&spcPodStatus, specChanged(&spcPodStatus, generation), interval); ok {
+			r.queue.AddAfter(key, delay)
+		}
+	}
+	r.stopWatches(volumes)
+}
+
+// updateCertificateExpiry parses the certificates mounted in the target paths
+// of the volumes that don't have a certificate expiry yet, and forgets the
+// certificate expiry of the volumes that are no longer on the node
+func (r *rotationReconciler) updateCertificateExpiry(targetPaths map[types.NamespacedName]string) {
+	r.certExpiryLock.Lock()
+	missing := make(map[types.NamespacedName]string)
+	for key, targetPath := range targetPaths {
+		if _, ok := r.certExpiry[key]; !ok {
+			missing[key] = targetPath
+		}
+	}
+	r.certExpiryLock.Unlock()
+
+	// the files are parsed without holding the lock, so the queue isn't blocked
+	parsed := make(map[types.NamespacedName]time.Time, len(missing))
+	for key, targetPath := range missing {
+		parsed[key] = certificateExpiry(targetPath)
+	}
+
+	r.certExpiryLock.Lock()
+	defer r.certExpiryLock.Unlock()
+	for key := range r.certExpiry {
+		if _, ok := targetPaths[key]; !ok {
+			delete(r.certExpiry, key)
+		}
+	}
+	for key, expiry := range parsed {
+		if _, ok := r.certExpiry[key]; !ok {
+			r.certExpiry[key] = expiry
+		}
+	}
+}
+
+// setCertificateExpiry sets the earliest expiry of the certificates mounted
+// in the volume
+func (r *rotationReconciler) setCertificateExpiry(key types.NamespacedName, expiry time.Time) {
+	r.certExpiryLock.Lock()
+	defer r.certExpiryLock.Unlock()
+	r.certExpiry[key] = expiry
+}
+
+// queuePriority returns the earliest expiry of the certificates mounted in the
+// volume, the zero time if the volume has no certificates or wasn't parsed yet
+func (r *rotationReconciler) queuePriority(item interface{}) time.Time {
+	r.certExpiryLock.Lock()
+	defer r.certExpiryLock.Unlock()
+	return r.certExpiry[item.(types.NamespacedName)]
+}
+
+// volumeClass returns the secret provider class of the volume with the specs
+// of its base classes merged, nil if the class can't be fetched. The classes
+// are cached by class and namespace in classes.
+func (r *rotationReconciler) volumeClass(ctx context.Context, spcPodStatus *v1alpha1.SecretProviderClassPodStatus, classes map[string]*v1alpha1.SecretProviderClass) *v1alpha1.SecretProviderClass {
+	name, kind := spcPodStatus.Status.SecretProviderClassName, spcPodStatus.Status.SecretProviderClassKind
+	cacheKey := kind + "/" + spcPodStatus.Namespace + "/" + name
+	if spc, ok := classes[cacheKey]; ok {
+		return spc
+	}
+	spc, err := getSecretProviderItem(ctx, r.ns.client, name, kind, spcPodStatus.Namespace)
+	if err != nil {
+		log.Debugf("failed to get secretproviderclass of %s/%s for rotation, err: %+v", spcPodStatus.Namespace, spcPodStatus.Name, err)
+		spc = nil
+	}
+	classes[cacheKey] = spc
+	return spc
+}
+
+// specChanged returns true if the generation of the secret provider class
+// differs from the generation the volume was mounted with. Volumes mounted
+// before the generation was recorded in the secret provider class pod status,
+// and classes that can't be fetched, aren't considered changed.
+func specChanged(spcPodStatus *v1alpha1.SecretProviderClassPodStatus, generation int64) bool {
+	mounted := spcPodStatus.Status.SecretProviderClassGeneration
+	return mounted != 0 && generation != 0 && mounted != generation
+}
+
+// delay returns the delay of the rotation of the volume. Volumes with objects
+// that expire are rotated the renew before duration ahead of the expiry,
+// volumes with a rotation interval aren't rotated before the interval since
+// the last attempt, or since the mount, passed, volumes of changed secret
+// provider classes are rotated without delay, and volumes that failed to
+// rotate aren't rotated before the backoff since the last attempt passed.
+// false is returned if the volume doesn't need to be rotated before the next
+// poll.
+func (r *rotationReconciler) delay(spcPodStatus *v1alpha1.SecretProviderClassPodStatus, changed bool, interval time.Duration) (time.Duration, bool) {
+	delay := r.jitter()
+	if spcPodStatus.Status.ExpiryTime != nil {
+		delay = time.Until(spcPodStatus.Status.ExpiryTime.Add(-r.config.RenewBefore))
+	} else if interval > 0 {
+		last := spcPodStatus.CreationTimestamp.Time
+		if rotation := spcPodStatus.Status.Rotation; rotation != nil && rotation.LastAttemptTime != nil {
+			last = rotation.LastAttemptTime.Time
+		}
+		if next := time.Until(last.Add(interval)); next > delay {
+			delay = next
+		}
+	}
+	if changed {
+		delay = 0
+	}
+	if rotation := spcPodStatus.Status.Rotation; rotation != nil && rotation.FailureCount > 0 && rotation.LastAttemptTime != nil {
+		if retry := time.Until(rotation.LastAttemptTime.Add(r.backoff(rotation.FailureCount))); retry > delay {
+			delay = retry
+		}
+	}
+	if delay > r.config.PollInterval {
+		return 0, false
+	}
+	if delay < 0 {
+		delay = 0
+	}
+	return delay, true
+}
+
+// backoff returns the interval between the last failed rotation attempt of a
+// volume and the next attempt. The interval is doubled for every consecutive
+// failed attempt, up to the max backoff.
+func (r *rotationReconciler) backoff(failureCount int32) time.Duration {
+	if r.config.MaxBackoff <= 0 {
+		return 0
+	}
+	backoff := r.config.PollInterval
+	for i := int32(1); i < failureCount && backoff < r.config.MaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > r.config.MaxBackoff {
+		backoff = r.config.MaxBackoff
+	}
+	return backoff
+}
+
+// jitter returns the random delay of the rotation of a volume
+func (r *rotationReconciler) jitter() time.Duration {
+	if r.config.Jitter <= 0 {
+		return 0
+	}
+	return time.Duration(r.random() * r.config.Jitter * float64(r.config.PollInterval))
+}
+
+func (r *rotationReconciler) runWorker() {
+	for r.processNextItem() {
+	}
+}
+
+// processNextItem rotates the next volume in the queue. It returns false if
+// the queue is shut down.
+func (r *rotationReconciler) processNextItem() bool {
+	item, shutdown := r.queue.Get()
+	if shutdown {
+		return false
+	}
+	defer r.queue.Done(item)
+	key := item.(types.NamespacedName)
+	if err := r.reconcile(context.Background(), key); err != nil {
+		log.Errorf("failed to rotate mounted contents for secret provider class pod status %s, err: %+v", key, err)
+	}
+	return true
+}
+
+// reconcile fetches the contents of the volume of the secret provider class
+// pod status from the providers and updates the files in the target path and
+// the object versions and rotation status in the secret provider class pod
+// status
+func (r *rotationReconciler) reconcile(ctx context.Context, key types.NamespacedName) error {
+	spcPodStatus := &v1alpha1.SecretProviderClassPodStatus{}
+	if err := r.ns.client.Get(ctx, key, spcPodStatus); err != nil {
+		if apierrors.IsNotFound(err) {
+			r.stopWatch(key)
+			return nil
+		}
+		return err
+	}
+	if !spcPodStatus.GetDeletionTimestamp().IsZero() || !spcPodStatus.Status.Mounted {
+		r.stopWatch(key)
+		return nil
+	}
+	targetPath := spcPodStatus.Status.TargetPath
+	pod := &corev1.Pod{}
+	if err := r.ns.client.Get(ctx, types.NamespacedName{Namespace: key.Namespace, Name: spcPodStatus.Status.PodName}, pod); err != nil {
+		if apierrors.IsNotFound(err) {
+			r.stopWatch(key)
+			return nil
+		}
+		return err
+	}
+	podUID := spcPodStatus.Status.PodUID
+	if len(podUID) == 0 {
+		podUID = getPodUIDFromTargetPath(targetPath)
+	}
+	if string(pod.UID) != podUID || !pod.GetDeletionTimestamp().IsZero() {
+		r.stopWatch(key)
+		return nil
+	}
+	// the volume is unmounted while the pod is deleted or after the pod
+	// completed, the contents must not be written to the node disk
+	notMnt, err := r.ns.mounter.IsLikelyNotMountPoint(targetPath)
+	mounted := err == nil && !notMnt
+	if !mounted {
+		r.stopWatch(key)
+	}
+
+	contents, attempted, err := r.rotate(ctx, key, spcPodStatus, pod, mounted)
+	if !attempted && err == nil {
+		return nil
+	}
+	return r.updateRotationStatus(ctx, spcPodStatus, contents, err)
+}
+
+// rotate fetches the contents of the volume from the providers and updates
+// the files in the target path and the synced k8s secrets. It returns the
+// fetched contents and false if the rotation of the volume is skipped. The
+// data version file is only updated if any of the mounted files changed. Only
+// the synced k8s secrets are updated if the volume isn't mounted.
+func (r *rotationReconciler) rotate(ctx context.Context, key types.NamespacedName, spcPodStatus *v1alpha1.SecretProviderClassPodStatus, pod *corev1.Pod, mounted bool) (contents rotatedContents, attempted bool, err error) {
+	var providerName string
+	errorReason := FailedToMount
+	start := time.Now()
+
+	defer func() {
+		if !attempted {
+			return
+		}
+		r.ns.reporter.reportRotationDuration(providerName, key.Namespace, time.Since(start).Seconds())
+		if err != nil {
+			r.ns.reporter.reportRotationErrorCtMetric(providerName, key.Namespace, errorReason)
+			return
+		}
+		r.ns.reporter.reportRotationCtMetric(providerName, key.Namespace)
+	}()
+
+	targetPath := spcPodStatus.Status.TargetPath
+	spc, err := getSecretProviderItem(ctx, r.ns.client, spcPodStatus.Status.SecretProviderClassName, spcPodStatus.Status.SecretProviderClassKind, key.Namespace)
+	if err != nil && !mounted {
+		return rotatedContents{}, false, nil
+	}
+	if err != nil {
+		errorReason = SecretProviderClassNotFound
+		return rotatedContents{}, true, err
+	}
+	// a changed secret provider class is remounted outside of its rotation
+	// windows and for providers that keep the contents up to date, as the
+	// mounted objects or the parameters could have changed
+	changed := specChanged(spcPodStatus, spc.Generation)
+	if !mounted && !hasSyncedObjects(spc) {
+		log.Debugf("skipping rotation of %s, target path %s is not mounted", key, targetPath)
+		return rotatedContents{}, false, nil
+	}
+	if isRotationPaused(pod) || isRotationPaused(spc) {
+		log.Debugf("skipping rotation of %s, rotation is paused", key)
+		r.stopWatch(key)
+		return rotatedContents{}, false, nil
+	}
+	allowed, err := rotationAllowed(spc, time.Now())
+	if err != nil {
+		errorReason = InvalidRotationWindow
+		return rotatedContents{}, true, err
+	}
+	// objects that expire are rotated ahead of the expiry even outside of the
+	// rotation windows, so the mounted objects don't expire
+	if !allowed && !r.expiring(spcPodStatus) && !changed {
+		log.Debugf("skipping rotation of %s, secretproviderclass %s is outside of its rotation windows", key, spc.Name)
+		return rotatedContents{}, false, nil
+	}
+	providerName, err = getProviderFromSPC(spc)
+	if err != nil {
+		return rotatedContents{}, true, err
+	}
+	if err = r.ns.checkProvidersAllowed(spc); err != nil {
+		errorReason = ProviderNotAllowed
+		return rotatedContents{}, true, err
+	}
+	capabilities := defaultProviderCapabilities
+	if r.ns.providerClients.HasProvider(providerName) {
+		if c, err := r.ns.providerClients.Capabilities(ctx, providerName); err == nil {
+			capabilities = c
+		}
+	}
+	if capabilities.Rotation && mounted && !changed {
+		log.Debugf("skipping rotation of %s, provider %s keeps the mounted contents up to date", key, providerName)
+		r.stopWatch(key)
+		return rotatedContents{}, false, nil
+	}
+	if _, err = getParametersFromSPC(spc); err != nil {
+		return rotatedContents{}, true, err
+	}
+	attrib := map[string]string{
+		csipodname:      pod.Name,
+		csipodnamespace: pod.Namespace,
+		csipoduid:       string(pod.UID),
+		csipodsa:        pod.Spec.ServiceAccountName,
+	}
+	// the providers are called with the latest service account tokens the
+	// kubelet passed when it republished the volume
+	if tokens, expiry, ok := r.ns.serviceAccountTokens.get(targetPath); ok {
+		if !expiry.IsZero() && !time.Now().Before(expiry) {
+			errorReason = ServiceAccountTokensExpired
+			return rotatedContents{}, true, fmt.Errorf("service account tokens of pod %s/%s expired at %v, the volume wasn't republished", pod.Namespace, pod.Name, expiry.UTC().Format(time.RFC3339))
+		}
+		attrib[csipodsatokens] = tokens
+	}
+	if spc, err = renderParameterTemplates(spc, podParameterTemplateData(pod)); err != nil {
+		errorReason = InvalidProviderParameters
+		return rotatedContents{}, true, err
+	}
+	// the pod could no longer be allowed to mount the class since the volume
+	// was mounted, e.g. after the pod selector of the class was changed
+	if err = controllers.CheckPodAllowed(spc, pod); err != nil {
+		errorReason = PodNotAllowed
+		return rotatedContents{}, true, err
+	}
+
+	secrets, err := r.nodePublishSecrets(ctx, pod, targetPath)
+	if err != nil {
+		return rotatedContents{}, true, err
+	}
+	secretStr, err := json.Marshal(secrets)
+	if err != nil {
+		return rotatedContents{}, true, err
+	}
+	permissionStr, err := json.Marshal(permission)
+	if err != nil {
+		return rotatedContents{}, true, err
+	}
+
+	if r.config.DryRun {
+		contents, errorReason, err = r.dryRun(ctx, spcPodStatus, spc, providerName, attrib, string(secretStr), targetPath, string(permissionStr), pod, mounted)
+		return contents, true, err
+	}
+	if !mounted {
+		contents, errorReason, err = r.refreshSecrets(ctx, spc, providerName, attrib, string(secretStr), targetPath, string(permissionStr), pod)
+		if err == nil {
+			log.Infof("refreshed synced secrets of secretproviderclass %s/%s for pod %s/%s", spc.Namespace, spc.Name, pod.Namespace, pod.Name)
+			if objectVersionsChanged(spcPodStatus.Status.Objects, contents.objectVersions) {
+				r.ns.recordAudit(auditEventSecretsRefresh, pod.Name, pod.Namespace, string(pod.UID), spc.Name, providerName, targetPath, contents.objectVersions)
+			}
+		}
+		return contents, true, err
+	}
+	// the providers rotate the files in a new data directory that is only
+	// published once all the providers rotated, so applications never read a
+	// mix of rotated and previous files. The data directory is discarded if
+	// the rotation failed or the contents didn't change.
+	dataDir, err := fileutil.NewDataDir(targetPath)
+	if err != nil {
+		errorReason = FailedToWriteFiles
+		return rotatedContents{}, true, fmt.Errorf("failed to create data directory in %s, err: %+v", targetPath, err)
+	}
+	defer func() {
+		if fileutil.DataDir(targetPath) != dataDir {
+			os.RemoveAll(dataDir)
+		}
+	}()
+	// the files copied to the data directory are owned by the driver
+	uid, gid := r.ns.fileOwner(spc, pod)
+	contents, errorReason, err = r.ns.rotateProviders(ctx, r.limiter, spc, providerName, attrib, string(secretStr), dataDir, string(permissionStr), pod.Name, pod.Namespace, uid, gid)
+	if err != nil {
+		if !changed {
+			r.keepMountedContents(spcPodStatus, providerName, errorReason, err)
+		}
+		return contents, true, err
+	}
+	contents.generation = spc.Generation
+	// the output files are rendered from the rotated objects of all the
+	// providers
+	outputChanged, errorReason, err := writeOutputFiles(dataDir, spc.Spec.OutputFiles, true)
+	if err != nil {
+		return contents, true, fmt.Errorf("failed to write output files to %s, err: %+v", targetPath, err)
+	}
+	for _, outputFile := range spc.Spec.OutputFiles {
+		if outputFile != nil {
+			contents.files[filepath.Clean(outputFile.FileName)] = true
+		}
+	}
+	contents.changed = contents.changed || outputChanged
+	if changed {
+		// the files of the objects removed from the secret provider class
+		// aren't mounted by the providers anymore
+		removed, err := removeStaleFiles(dataDir, contents.files)
+		if err != nil {
+			errorReason = FailedToWriteFiles
+			return contents, true, fmt.Errorf("failed to remove stale files from %s, err: %+v", targetPath, err)
+		}
+		contents.changed = contents.changed || removed
+		// the checksums and metadata files are written or removed once the
+		// class enables or disables them
+		if _, err := os.Lstat(filepath.Join(targetPath, fileutil.ChecksumsFile)); os.IsNotExist(err) == spc.Spec.WriteChecksums {
+			contents.changed = true
+		}
+		if _, err := os.Lstat(filepath.Join(targetPath, fileutil.MetadataFile)); os.IsNotExist(err) == spc.Spec.WriteMetadata {
+			contents.changed = true
+		}
+		log.Infof("remounted contents of secretproviderclass %s/%s for pod %s/%s, secretproviderclass changed to generation %d", spc.Namespace, spc.Name, pod.Namespace, pod.Name, spc.Generation)
+	} else {
+		// the keys removed from the objects split into files aren't written
+		// by the providers anymore
+		removed, err := removeStaleSplitFiles(dataDir, spc.Spec.MountedObjects, contents.files)
+		if err != nil {
+			errorReason = FailedToWriteFiles
+			return contents, true, fmt.Errorf("failed to remove stale files from %s, err: %+v", targetPath, err)
+		}
+		contents.changed = contents.changed || removed
+	}
+	// the metadata are published if the versions of the objects changed, even
+	// if the mounted files didn't change. The fetch time of the objects with
+	// the same version is kept.
+	var metadata fileutil.Metadata
+	var metadataChanged bool
+	if spc.Spec.WriteMetadata {
+		previous, err := fileutil.ReadMetadata(targetPath)
+		if err != nil {
+			log.Warningf("failed to read metadata of %s, fetch times of the objects are reset, err: %v", targetPath, err)
+		}
+		metadata, metadataChanged = objectsMetadata(contents.objectVersions, time.Now(), previous)
+	}
+	// applications watching the data version file reload the rotated files,
+	// so the data version isn't updated if the contents didn't change
+	if contents.changed || metadataChanged {
+		if spc.Spec.WriteMetadata {
+			if err = fileutil.WriteMetadata(dataDir, metadata); err != nil {
+				errorReason = FailedToWriteFiles
+				return contents, true, fmt.Errorf("failed to write metadata to %s, err: %+v", targetPath, err)
+			}
+		}
+		if spc.Spec.WriteChecksums {
+			if err = fileutil.WriteChecksums(dataDir); err != nil {
+				errorReason = FailedToWriteFiles
+				return contents, true, fmt.Errorf("failed to write checksums to %s, err: %+v", targetPath, err)
+			}
+		}
+		if err = r.ns.volumeQuota.validate(dataDir); err != nil {
+			errorReason = VolumeQuotaExceeded
+			return contents, true, fmt.Errorf("contents rotated in %s exceed the volume quota, err: %+v", targetPath, err)
+		}
+		if err = fileutil.SetOwnership(dataDir, uid, gid); err != nil {
+			errorReason = FailedToWriteFiles
+			return contents, true, fmt.Errorf("failed to set the owner of the rotated files in %s, err: %+v", targetPath, err)
+		}
+		if err = fileutil.PublishDataDir(targetPath, dataDir); err != nil {
+			errorReason = FailedToWriteFiles
+			return contents, true, fmt.Errorf("failed to publish rotated files to %s, err: %+v", targetPath, err)
+		}
+		if err = writeDataVersion(targetPath); err != nil {
+			errorReason = FailedToWriteFiles
+			return contents, true, fmt.Errorf("failed to write data version to %s, err: %+v", targetPath, err)
+		}
+		r.setCertificateExpiry(key, certificateExpiry(targetPath))
+	}
+	if hasSyncedObjects(spc) {
+		objects, err := mountedObjects(spc, targetPath)
+		if err != nil {
+			errorReason = FailedToSyncSecrets
+			return contents, true, err
+		}
+		if errorReason, err = r.syncSecrets(ctx, spc, objects); err != nil {
+			return contents, true, err
+		}
+	}
+	if capabilities.Watch {
+		parametersStr, err := json.Marshal(providerParameters(spc.Spec.Parameters, attrib))
+		if err != nil {
+			return contents, true, err
+		}
+		r.watchVolume(key, providerName, string(parametersStr), string(secretStr), targetPath, string(permissionStr), contents.objectVersions)
+	}
+	if contents.changed || objectVersionsChanged(spcPodStatus.Status.Objects, contents.objectVersions) {
+		log.Infof("rotated mounted contents of secretproviderclass %s/%s for pod %s/%s", spc.Namespace, spc.Name, pod.Namespace, pod.Name)
+		r.ns.recordAudit(auditEventRotation, pod.Name, pod.Namespace, string(pod.UID), spc.Name, providerName, targetPath, contents.objectVersions)
+	} else {
+		log.Debugf("mounted contents of %s are up to date", key)
+	}
+	// the pod is restarted again if the previous restart failed, failing to
+	// restart the pod doesn't fail the rotation of the volume
+	if contents.changed || (spcPodStatus.Status.Rotation != nil && spcPodStatus.Status.Rotation.RestartPending) {
+		contents.restartPending = r.restartPod(ctx, spc, pod) != nil
+	}
+	return contents, true, nil
+}
+
+// keepMountedContents records a warning event and the cached content metric
+// if the rotation of the volume failed as the providers are unavailable and
+// the mounted contents are still valid, i.e. their objects haven't expired and
+// they are younger than the maximum cached content age. The mounted contents
+// are kept until the providers are available again.
+func (r *rotationReconciler) keepMountedContents(spcPodStatus *v1alpha1.SecretProviderClassPodStatus, providerName, errorReason string, rotateErr error) {
+	maxAge := r.ns.mountCache.maxStaleAge
+	if maxAge <= 0 || !isProviderUnavailableReason(errorReason) {
+		return
+	}
+	now := time.Now()
+	if expiry := spcPodStatus.Status.ExpiryTime; expiry != nil && !now.Before(expiry.Time) {
+		return
+	}
+	mountTime := spcPodStatus.CreationTimestamp.Time
+	if rotation := spcPodStatus.Status.Rotation; rotation != nil && rotation.LastRotationTime != nil {
+		mountTime = rotation.LastRotationTime.Time
+	}
+	if now.Sub(mountTime) >= maxAge {
+		return
+	}
+	log.Warningf("providers of secretproviderclass %s/%s are unavailable, keeping the contents mounted at %v in %s, err: %v", spcPodStatus.Namespace, spcPodStatus.Status.SecretProviderClassName, mountTime.UTC().Format(time.RFC3339), spcPodStatus.Status.TargetPath, rotateErr)
+	r.ns.recordPodEvent(spcPodStatus.Status.PodName, spcPodStatus.Namespace, spcPodStatus.Status.PodUID, corev1.EventTypeWarning, CachedContentServed,
+		fmt.Sprintf("providers are unavailable, serving the contents of secretproviderclass %s mounted at %v, err: %v", spcPodStatus.Status.SecretProviderClassName, mountTime.UTC().Format(time.RFC3339), rotateErr))
+	r.ns.reporter.reportCachedContentServedCtMetric(providerName, spcPodStatus.Namespace, cachedContentRotation)
+}
+
+// updateRotationStatus records the result of the rotation attempt in the
+// secret provider class pod status. The object versions and expiry of the
+// mounted contents are only updated if the rotation succeeded. A warning event
+// is recorded on the pod if the rotation failed repeatedly.
+func (r *rotationReconciler) updateRotationStatus(ctx context.Context, spcPodStatus *v1alpha1.SecretProviderClassPodStatus, contents rotatedContents, rotateErr error) error {
+	now := metav1.Now()
+	rotation := spcPodStatus.Status.Rotation
+	if rotation == nil {
+		rotation = &v1alpha1.RotationStatus{}
+	}
+	rotation.LastAttemptTime = &now
+	rotation.LastAttemptedObjects = secretProviderClassObjects(contents.objectVersions)
+	rotation.LastError = ""
+	if rotateErr != nil {
+		rotation.LastError = rotateErr.Error()
+		rotation.FailureCount++
+		if rotation.FailureCount >= rotationFailureEventThreshold {
+			r.ns.recordPodEvent(spcPodStatus.Status.PodName, spcPodStatus.Namespace, spcPodStatus.Status.PodUID, corev1.EventTypeWarning, FailedToRotate,
+				fmt.Sprintf("failed to rotate mounted contents of secretproviderclass %s %d times in a row, err: %v", spcPodStatus.Status.SecretProviderClassName, rotation.FailureCount, rotateErr))
+		}
+	} else if contents.dryRun {
+		// the mounted contents aren't rotated in dry run mode
+		rotation.FailureCount = 0
+		rotation.DryRunChanges = contents.dryRunChanges
+	} else {
+		rotation.FailureCount = 0
+		rotation.RestartPending = contents.restartPending
+		rotation.DryRunChanges = nil
+		rotation.LastRotationTime = &now
+		spcPodStatus.Status.Objects = secretProviderClassObjects(contents.objectVersions)
+		spcPodStatus.Status.ExpiryTime = expiryTime(contents.expiry)
+		if contents.generation != 0 {
+			spcPodStatus.Status.SecretProviderClassGeneration = contents.generation
+		}
+	}
+	spcPodStatus.Status.Rotation = rotation
+	if err := r.ns.client.Update(ctx, spcPodStatus); err != nil {
+		return fmt.Errorf("failed to update rotation status in secret provider class pod status %s/%s, err: %+v", spcPodStatus.Namespace, spcPodStatus.Name, err)
+	}
+	return rotateErr
+}
+
+// nodePublishSecrets returns the node publish secrets of the pod volume with
+// the target path, the same secrets kubelet sends in the node publish request
+func (r *rotationReconciler) nodePublishSecrets(ctx context.Context, pod *corev1.Pod, targetPath string) (map[string]string, error) {
+	// the target path is <kubelet root>/pods/<uid>/volumes/kubernetes.io~csi/<volume>/mount
+	volumeName := filepath.Base(filepath.Dir(targetPath))
+	secretRef, err := r.nodePublishSecretRef(ctx, pod, volumeName)
+	if err != nil {
+		return nil, err
+	}
+	if secretRef == nil {
+		return map[string]string{}, nil
+	}
+	secret := &corev1.Secret{}
+	if err := r.ns.client.Get(ctx, types.NamespacedName{Namespace: secretRef.Namespace, Name: secretRef.Name}, secret); err != nil {
+		return nil, fmt.Errorf("failed to get node publish secret %s/%s, err: %+v", secretRef.Namespace, secretRef.Name, err)
+	}
+	secrets := make(map[string]string, len(secret.Data))
+	for k, v := range secret.Data {
+		secrets[k] = string(v)
+	}
+	return secrets, nil
+}
+
+// nodePublishSecretRef returns the node publish secret of the volume of the
+// pod, nil if the volume has none. The volume of a persistent volume, either
+// pre-provisioned or provisioned for a generic ephemeral volume, is named after
+// the persistent volume, its node publish secret is set in the persistent
+// volume.
+func (r *rotationReconciler) nodePublishSecretRef(ctx context.Context, pod *corev1.Pod, volumeName string) (*corev1.SecretReference, error) {
+	for _, volume := range pod.Spec.Volumes {
+		if volume.Name != volumeName || volume.CSI == nil {
+			continue
+		}
+		if volume.CSI.NodePublishSecretRef == nil {
+			return nil, nil
+		}
+		return &corev1.SecretReference{Namespace: pod.Namespace, Name: volume.CSI.NodePublishSecretRef.Name}, nil
+	}
+	pv := &corev1.PersistentVolume{}
+	if err := r.ns.client.Get(ctx, types.NamespacedName{Name: volumeName}, pv); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get persistent volume %s, err: %+v", volumeName, err)
+	}
+	if pv.Spec.CSI == nil || pv.Spec.CSI.NodePublishSecretRef == nil {
+		return nil, nil
+	}
+	return pv.Spec.CSI.NodePublishSecretRef, nil
+}
+
+// rotateProviders fetches the contents of the provider, falling back to the
+// fallback provider, and of the additional providers of the secret provider
+// class and updates the files in the data directory. Every provider call waits
+// for the limiter. If an additional provider fails, the contents of the
+// providers rotated before are returned with the error.
+func (ns *nodeServer) rotateProviders(ctx context.Context, limiter *rate.Limiter, spc *v1alpha1.SecretProviderClass, providerName string, attrib map[string]string, secrets, dataDir, permission, podName, podNamespace string, uid, gid int) (rotatedContents, string, error) {
+	contents, errorReason, err := ns.rotateProvider(ctx, limiter, spc, providerName, providerParameters(spc.Spec.Parameters, attrib), secrets, dataDir, permission, podName, podNamespace, uid, gid)
+	if err != nil && spc.Spec.Fallback != nil {
+		fallbackProvider := providerName
+		if len(spc.Spec.Fallback.Provider) > 0 {
+			fallbackProvider = string(spc.Spec.Fallback.Provider)
+		}
+		log.Warningf("failed to rotate secrets store objects for pod %s/%s with provider %s, using fallback provider %s, err: %v", podNamespace, podName, providerName, fallbackProvider, err)
+		contents, errorReason, err = ns.rotateProvider(ctx, limiter, spc, fallbackProvider, providerParameters(spc.Spec.Fallback.Parameters, attrib), secrets, dataDir, permission, podName, podNamespace, uid, gid)
+	}
+	if err != nil {
+		return rotatedContents{}, errorReason, err
+	}
+	for _, additionalProvider := range spc.Spec.AdditionalProviders {
+		additionalContents, errorReason, err := ns.rotateProvider(ctx, limiter, spc, string(additionalProvider.Provider), providerParameters(additionalProvider.Parameters, attrib), secrets, dataDir, permission, podName, podNamespace, uid, gid)
+		if err != nil {
+			// the contents of the providers before the additional provider
+			// are returned, they are discarded with the data directory
+			return contents, errorReason, err
+		}
+		if contents.objectVersions == nil && len(additionalContents.objectVersions) > 0 {
+			contents.objectVersions = make(map[string]string, len(additionalContents.objectVersions))
+		}
+		for id, version := range additionalContents.objectVersions {
+			contents.objectVersions[id] = version
+		}
+		contents.expiry = earliestExpiry(contents.expiry, additionalContents.expiry)
+		contents.changed = contents.changed || additionalContents.changed
+		for file := range additionalContents.files {
+			contents.files[file] = true
+		}
+	}
+	return contents, "", nil
+}
+
+// rotateProvider mounts the contents of the provider to a staging directory in
+// the data directory and moves the changed files over the copies of the mounted
+// files, so the files are only replaced once the provider fetched all objects.
+// Files with the same contents as the mounted files aren't rewritten. The
+// replaced files of the mounted objects with a version history are kept as
+// their previous versions. The rotated files are owned by the uid and gid, -1
+// keeps the owner or the group.
+func (ns *nodeServer) rotateProvider(ctx context.Context, limiter *rate.Limiter, spc *v1alpha1.SecretProviderClass, providerName string, parameters map[string]string, secrets, dataDir, permission, podName, podNamespace string, uid, gid int) (rotatedContents, string, error) {
+	if err := limiter.Wait(ctx); err != nil {
+		return rotatedContents{}, FailedToMount, fmt.Errorf("failed to wait for the rotation rate limit of provider %s, err: %v", providerName, err)
+	}
+	stagingPath := filepath.Join(dataDir, fmt.Sprintf(".%s-rotation", providerName))
+	if err := os.RemoveAll(stagingPath); err != nil {
+		return rotatedContents{}, FailedToWriteFiles, err
+	}
+	if err := os.Mkdir(stagingPath, 0755); err != nil {
+		return rotatedContents{}, FailedToWriteFiles, fmt.Errorf("failed to create staging directory for provider %s, err: %v", providerName, err)
+	}
+	defer os.RemoveAll(stagingPath)
+
+	objectVersions, expiry, errorReason, err := ns.mountProvider(ctx, spc, providerName, parameters, secrets, stagingPath, permission, podName, podNamespace)
+	if err != nil {
+		return rotatedContents{}, errorReason, err
+	}
+	// the staged files get the owner and the group permissions of the mounted
+	// files before they are compared, so the files aren't rewritten for the
+	// group permissions added when the data directory is published
+	if err := fileutil.SetOwnership(stagingPath, uid, gid); err != nil {
+		return rotatedContents{}, FailedToWriteFiles, fmt.Errorf("failed to set the owner of the files rotated by provider %s, err: %v", providerName, err)
+	}
+	contents := rotatedContents{objectVersions: objectVersions, expiry: expiry, files: make(map[string]bool)}
+	histories := versionHistories(spc.Spec.MountedObjects)
+	err = filepath.Walk(stagingPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(stagingPath, path)
+		if err != nil {
+			return err
+		}
+		contents.files[rel] = true
+		dest := filepath.Join(dataDir, rel)
+		same, err := fileutil.SameContents(path, dest)
+		if err != nil || same {
+			return err
+		}
+		contents.changed = true
+		if err := fileutil.MkdirParents(dataDir, rel); err != nil {
+			return err
+		}
+		if history := histories[rel]; history > 0 {
+			if err := keepPreviousVersion(dest, history); err != nil {
+				return fmt.Errorf("failed to keep previous version of %s, err: %v", rel, err)
+			}
+		}
+		return os.Rename(path, dest)
+	})
+	if err != nil {
+		return rotatedContents{}, FailedToWriteFiles, fmt.Errorf("failed to move files rotated by provider %s, err: %v", providerName, err)
+	}
+	// the previous versions are part of the mounted contents, so they aren't
+	// removed as stale files
+	for file, history := range histories {
+		if contents.files[file] {
+			for _, versionFile := range previousVersionFiles(dataDir, file, history) {
+				contents.files[versionFile] = true
+			}
+		}
+	}
+	return contents, "", nil
+}
+
+// removeStaleFiles removes the files in the data directory that weren't
+// mounted by the providers. The directories left empty are removed. It returns
+// true if any file was removed.
+func removeStaleFiles(dataDir string, files map[string]bool) (bool, error) {
+	var stale []string
+	err := filepath.Walk(dataDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dataDir, path)
+		if err != nil {
+			return err
+		}
+		if !files[rel] {
+			stale = append(stale, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+	for _, path := range stale {
+		if err := os.Remove(path); err != nil {
+			return false, err
+		}
+		removeEmptyDirs(dataDir, filepath.Dir(path))
+	}
+	return len(stale) > 0, nil
+}
+
+// removeStaleSplitFiles removes the files in the directories of the mounted
+// objects split into files that weren't mounted by the providers, e.g. for the
+// keys removed from a JSON secret. The directories of the objects that weren't
+// mounted at all are left as is. It returns true if any file was removed.
+func removeStaleSplitFiles(dataDir string, mountedObjects []*v1alpha1.MountedObject, files map[string]bool) (bool, error) {
+	var removed bool
+	for _, dir := range splitObjectDirs(mountedObjects) {
+		splitFiles := make(map[string]bool)
+		for file := range files {
+			if rel, err := filepath.Rel(dir, file); err == nil && !strings.HasPrefix(rel, "..") {
+				splitFiles[rel] = true
+			}
+		}
+		if len(splitFiles) == 0 {
+			continue
+		}
+		if info, err := os.Lstat(filepath.Join(dataDir, dir)); err != nil || !info.IsDir() {
+			continue
+		}
+		dirRemoved, err := removeStaleFiles(filepath.Join(dataDir, dir), splitFiles)
+		if err != nil {
+			return false, err
+		}
+		removed = removed || dirRemoved
+	}
+	return removed, nil
+}
+
+// isRotationPaused returns true if the rotation of the volumes of the object is
+// paused with the rotation annotation
+func isRotationPaused(obj metav1.Object) bool {
+	return obj.GetAnnotations()[v1alpha1.RotationAnnotation] == v1alpha1.RotationPaused
+}
+
+// rotationAllowed returns true if the volumes of the secret provider class
+// can be rotated at the time: during one of its rotation windows, if it has
+// any, and outside of its rotation blackouts
+func rotationAllowed(spc *v1alpha1.SecretProviderClass, now time.Time) (bool, error) {
+	blackout, err := inRotationWindow(spc.Spec.RotationBlackouts, now)
+	if err != nil || blackout {
+		return false, err
+	}
+	if len(spc.Spec.RotationWindows) == 0 {
+		return true, nil
+	}
+	return inRotationWindow(spc.Spec.RotationWindows, now)
+}
+
+// inRotationWindow returns true if the time is within any of the windows
+func inRotationWindow(windows []v1alpha1.RotationWindow, now time.Time) (bool, error) {
+	for _, window := range windows {
+		schedule, err := cron.Parse(window.Schedule)
+		if err != nil {
+			return false, fmt.Errorf("invalid rotation window schedule %q, err: %v", window.Schedule, err)
+		}
+		if window.Duration.Duration <= 0 {
+			return false, fmt.Errorf("invalid rotation window duration %v for schedule %q, must be greater than 0", window.Duration.Duration, window.Schedule)
+		}
+		if schedule.Active(now.UTC(), window.Duration.Duration) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// expiring returns true if the earliest expiry of the mounted objects is
+// within the renew before duration
+func (r *rotationReconciler) expiring(spcPodStatus *v1alpha1.SecretProviderClassPodStatus) bool {
+	return spcPodStatus.Status.ExpiryTime != nil && time.Until(spcPodStatus.Status.ExpiryTime.Time) <= r.config.RenewBefore
+}
+
+// rotatedContents are the contents of a volume fetched from the providers
+type rotatedContents struct {
+	objectVersions map[string]string
+	// expiry is the earliest expiry of the objects
+	expiry time.Time
+	// changed is true if any of the mounted files was rewritten
+	changed bool
+	// files are the paths of the files mounted by the providers relative to
+	// the target path
+	files map[string]bool
+	// generation is the generation of the secret provider class the contents
+	// were mounted with, 0 if the mounted files weren't rotated
+	generation int64
+	// restartPending is true if the pod couldn't be restarted with the restart
+	// policy of the secret provider class after the rotation
+	restartPending bool
+	// dryRun is true if the contents were fetched in dry run mode, dryRunChanges
+	// are the changes the rotation would have made
+	dryRun        bool
+	dryRunChanges []string
+}
+
+// objectVersionsChanged returns true if the object versions differ from the
+// objects in the secret provider class pod status
+func objectVersionsChanged(objects []v1alpha1.SecretProviderClassObject, objectVersions map[string]string) bool {
+	if len(objects) != len(objectVersions) {
+		return true
+	}
+	for _, object := range objects {
+		if version, ok := objectVersions[object.ID]; !ok || version != object.Version {
+			return true
+		}
+	}
+	return false
+}
+
+// secretProviderClassObjects returns the objects of the secret provider class
+// pod status for the object versions, sorted by id
+func secretProviderClassObjects(objectVersions map[string]string) []v1alpha1.SecretProviderClassObject {
+	var objects []v1alpha1.SecretProviderClassObject
+	for id, version := range objectVersions {
+		objects = append(objects, v1alpha1.SecretProviderClassObject{ID: id, Version: version})
+	}
+	sort.Slice(objects, func(i, j int) bool { return objects[i].ID < objects[j].ID })
+	return objects
+}
@@ -0,0 +1,152 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package secretsstore
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/net/context"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+
+	"sigs.k8s.io/secrets-store-csi-driver/apis/v1alpha1"
+	"sigs.k8s.io/secrets-store-csi-driver/controllers"
+)
+
+// RotationDryRun is the reason of the events recorded for the changes a
+// rotation in dry run mode would make
+const RotationDryRun = "RotationDryRun"
+
+// dryRun fetches the contents of the volume from the providers and reports
+// the object versions, mounted files and synced k8s secrets the rotation
+// would change, without writing the contents to the target path or updating
+// the synced secrets. The changes are logged, recorded as an event on the pod
+// and returned in the rotated contents for the rotation status.
+func (r *rotationReconciler) dryRun(ctx context.Context, spcPodStatus *v1alpha1.SecretProviderClassPodStatus, spc *v1alpha1.SecretProviderClass, providerName string, attrib map[string]string, secrets, targetPath, permission string, pod *corev1.Pod, mounted bool) (rotatedContents, string, error) {
+	contents, objects, errorReason, err := r.ns.fetchProviders(ctx, r.limiter, spc, providerName, attrib, secrets, targetPath, permission, pod.Name, pod.Namespace)
+	if err != nil {
+		return rotatedContents{}, errorReason, err
+	}
+	changes := changedObjects(spcPodStatus.Status.Objects, contents.objectVersions)
+	// the files of a volume that isn't mounted aren't rotated
+	if mounted {
+		changes = append(changes, changedFiles(targetPath, objects)...)
+	}
+	changedSecrets, err := r.changedSecrets(ctx, spc, objects)
+	if err != nil {
+		return rotatedContents{}, FailedToSyncSecrets, err
+	}
+	changes = append(changes, changedSecrets...)
+
+	contents.dryRun = true
+	contents.dryRunChanges = changes
+	if len(changes) == 0 {
+		log.Debugf("dry run rotation of secretproviderclass %s/%s for pod %s/%s wouldn't change the contents", spc.Namespace, spc.Name, pod.Namespace, pod.Name)
+		return contents, "", nil
+	}
+	message := fmt.Sprintf("dry run rotation of secretproviderclass %s would change %s", spc.Name, strings.Join(changes, ", "))
+	log.Infof("%s for pod %s/%s", message, pod.Namespace, pod.Name)
+	r.ns.recordPodEvent(pod.Name, pod.Namespace, string(pod.UID), corev1.EventTypeNormal, RotationDryRun, message)
+	r.ns.reporter.reportRotationDryRunChangeCtMetric(providerName, pod.Namespace)
+	return contents, "", nil
+}
+
+// changedObjects returns the objects with a version that differs from the
+// objects in the secret provider class pod status, sorted by id
+func changedObjects(objects []v1alpha1.SecretProviderClassObject, objectVersions map[string]string) []string {
+	versions := make(map[string]string, len(objects))
+	for _, object := range objects {
+		versions[object.ID] = object.Version
+	}
+	var changes []string
+	for id, version := range objectVersions {
+		if current, ok := versions[id]; !ok || current != version {
+			changes = append(changes, "object "+id)
+		}
+	}
+	sort.Strings(changes)
+	return changes
+}
+
+// changedFiles returns the fetched files by path that differ from the files
+// mounted in the target path, sorted by path
+func changedFiles(targetPath string, files map[string][]byte) []string {
+	var changes []string
+	for path, contents := range files {
+		current, err := ioutil.ReadFile(filepath.Join(targetPath, path))
+		if err != nil || !bytes.Equal(current, contents) {
+			changes = append(changes, "file "+path)
+		}
+	}
+	sort.Strings(changes)
+	return changes
+}
+
+// changedSecrets returns the k8s secrets and configmaps synced from the volume
+// with data that differs from the contents of the fetched objects by object name.
+// Secrets that don't exist yet are skipped, the same as in syncSecrets.
+func (r *rotationReconciler) changedSecrets(ctx context.Context, spc *v1alpha1.SecretProviderClass, objects map[string][]byte) ([]string, error) {
+	var changes []string
+	for _, secretObj := range spc.Spec.SecretObjects {
+		namespace, err := syncedSecretNamespace(ctx, r.ns.client, r.config.SyncNamespaces, spc, secretObj)
+		if err != nil {
+			return nil, fmt.Errorf("failed to sync secret %s, err: %+v", secretObj.SecretName, err)
+		}
+		secret := &corev1.Secret{}
+		if err := r.ns.client.Get(ctx, types.NamespacedName{Namespace: namespace, Name: secretObj.SecretName}, secret); err != nil {
+			if apierrors.IsNotFound(err) {
+				continue
+			}
+			return nil, fmt.Errorf("failed to get synced secret %s/%s, err: %+v", namespace, secretObj.SecretName, err)
+		}
+		data, err := secretData(secretObj, objects)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get data of synced secret %s/%s, err: %+v", namespace, secretObj.SecretName, err)
+		}
+		// secrets that aren't synced with the Fail conflict policy don't change
+		if err = controllers.CheckConflictPolicy(secretObj.ConflictPolicy, secret); err != nil {
+			continue
+		}
+		if dataChanged(secret.Data, data) {
+			changes = append(changes, "secret "+secretObj.SecretName)
+		}
+	}
+	for _, configMapObj := range spc.Spec.ConfigMapObjects {
+		configMap := &corev1.ConfigMap{}
+		if err := r.ns.client.Get(ctx, types.NamespacedName{Namespace: spc.Namespace, Name: configMapObj.ConfigMapName}, configMap); err != nil {
+			if apierrors.IsNotFound(err) {
+				continue
+			}
+			return nil, fmt.Errorf("failed to get synced configmap %s/%s, err: %+v", spc.Namespace, configMapObj.ConfigMapName, err)
+		}
+		data, err := configMapData(configMapObj, objects)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get data of synced configmap %s/%s, err: %+v", spc.Namespace, configMapObj.ConfigMapName, err)
+		}
+		if stringDataChanged(configMap.Data, data) {
+			changes = append(changes, "configmap "+configMapObj.ConfigMapName)
+		}
+	}
+	return changes, nil
+}
@@ -0,0 +1,224 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package secretsstore
+
+import (
+	"container/heap"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"sigs.k8s.io/secrets-store-csi-driver/pkg/util/fileutil"
+)
+
+// maxCertificateFileSize is the maximum size of the mounted files parsed for
+// certificates, larger files aren't certificates
+const maxCertificateFileSize = 1 << 20
+
+// rotationQueue is a delaying work queue of the volumes to rotate. Like the
+// client-go work queue, an item is only queued once and isn't handed out
+// again while it is processed. The queued items are handed out ordered by
+// their priority, the earliest expiry of the certificates mounted in the
+// volume, so volumes with certificates that are about to expire aren't
+// rotated after a backlog of other volumes. Items without a priority are
+// handed out after the items with a priority, in the order they were added.
+type rotationQueue struct {
+	cond *sync.Cond
+	// priority returns the priority of the item, the zero time if the item has
+	// no priority
+	priority func(item interface{}) time.Time
+
+	items      rotationQueueItems
+	seq        int64
+	dirty      map[interface{}]bool
+	processing map[interface{}]bool
+	shutdown   bool
+}
+
+// newRotationQueue returns a rotation queue that orders the items by the
+// priority
+func newRotationQueue(priority func(item interface{}) time.Time) *rotationQueue {
+	return &rotationQueue{
+		cond:       sync.NewCond(&sync.Mutex{}),
+		priority:   priority,
+		dirty:      make(map[interface{}]bool),
+		processing: make(map[interface{}]bool),
+	}
+}
+
+// Add queues the item, unless it is queued already
+func (q *rotationQueue) Add(item interface{}) {
+	q.cond.L.Lock()
+	defer q.cond.L.Unlock()
+	if q.shutdown || q.dirty[item] {
+		return
+	}
+	q.dirty[item] = true
+	// the item is queued again once it is done
+	if q.processing[item] {
+		return
+	}
+	q.push(item)
+}
+
+// AddAfter queues the item after the delay
+func (q *rotationQueue) AddAfter(item interface{}, delay time.Duration) {
+	if delay <= 0 {
+		q.Add(item)
+		return
+	}
+	time.AfterFunc(delay, func() { q.Add(item) })
+}
+
+// Get blocks until an item is queued and returns the item with the earliest
+// priority. It returns true if the queue is shut down.
+func (q *rotationQueue) Get() (interface{}, bool) {
+	q.cond.L.Lock()
+	defer q.cond.L.Unlock()
+	for len(q.items) == 0 && !q.shutdown {
+		q.cond.Wait()
+	}
+	if len(q.items) == 0 {
+		return nil, true
+	}
+	item := heap.Pop(&q.items).(*rotationQueueItem).item
+	q.processing[item] = true
+	delete(q.dirty, item)
+	return item, false
+}
+
+// Done marks the item as processed, the item is queued again if it was added
+// while it was processed
+func (q *rotationQueue) Done(item interface{}) {
+	q.cond.L.Lock()
+	defer q.cond.L.Unlock()
+	delete(q.processing, item)
+	if q.dirty[item] {
+		q.push(item)
+	}
+}
+
+// Len returns the number of queued items
+func (q *rotationQueue) Len() int {
+	q.cond.L.Lock()
+	defer q.cond.L.Unlock()
+	return len(q.items)
+}
+
+// ShutDown stops queueing items and unblocks the callers of Get once the
+// queued items are handed out
+func (q *rotationQueue) ShutDown() {
+	q.cond.L.Lock()
+	defer q.cond.L.Unlock()
+	q.shutdown = true
+	q.cond.Broadcast()
+}
+
+// push adds the item to the heap of the queued items, the lock must be held
+func (q *rotationQueue) push(item interface{}) {
+	q.seq++
+	heap.Push(&q.items, &rotationQueueItem{item: item, priority: q.priority(item), seq: q.seq})
+	q.cond.Signal()
+}
+
+// rotationQueueItem is a queued item with its priority
+type rotationQueueItem struct {
+	item     interface{}
+	priority time.Time
+	// seq orders the items with the same priority in the order they were added
+	seq int64
+}
+
+// rotationQueueItems implements heap.Interface for the queued items
+type rotationQueueItems []*rotationQueueItem
+
+func (h rotationQueueItems) Len() int { return len(h) }
+
+func (h rotationQueueItems) Less(i, j int) bool {
+	pi, pj := h[i].priority, h[j].priority
+	switch {
+	case pi.Equal(pj):
+		return h[i].seq < h[j].seq
+	case pi.IsZero():
+		return false
+	case pj.IsZero():
+		return true
+	default:
+		return pi.Before(pj)
+	}
+}
+
+func (h rotationQueueItems) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *rotationQueueItems) Push(x interface{}) { *h = append(*h, x.(*rotationQueueItem)) }
+
+func (h *rotationQueueItems) Pop() interface{} {
+	old := *h
+	item := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return item
+}
+
+// certificateExpiry returns the earliest expiry of the PEM encoded
+// certificates in the files mounted in the target path, the zero time if the
+// volume has no certificates. Hidden files and directories, e.g. the data
+// version file and the staging directories of the rotation, are skipped.
+func certificateExpiry(targetPath string) time.Time {
+	var expiry time.Time
+	// the mounted files in the target path are symlinks to the data directory
+	dataDir := fileutil.DataDir(targetPath)
+	filepath.Walk(dataDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		if path != dataDir && strings.HasPrefix(info.Name(), ".") {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !info.Mode().IsRegular() || info.Size() > maxCertificateFileSize {
+			return nil
+		}
+		contents, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil
+		}
+		for {
+			var block *pem.Block
+			block, contents = pem.Decode(contents)
+			if block == nil {
+				break
+			}
+			if block.Type != "CERTIFICATE" {
+				continue
+			}
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				continue
+			}
+			expiry = earliestExpiry(expiry, cert.NotAfter)
+		}
+		return nil
+	})
+	return expiry
+}
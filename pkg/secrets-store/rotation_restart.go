@@ -0,0 +1,104 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package secretsstore
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/net/context"
+
+	corev1 "k8s.io/api/core/v1"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"sigs.k8s.io/secrets-store-csi-driver/apis/v1alpha1"
+)
+
+// restartPod restarts the pod with the restart policy of the secret provider
+// class after the mounted contents of the pod volume were rotated. A warning
+// event is recorded on the pod if the pod couldn't be restarted, e.g. because
+// the eviction would violate a pod disruption budget.
+func (r *rotationReconciler) restartPod(ctx context.Context, spc *v1alpha1.SecretProviderClass, pod *corev1.Pod) error {
+	var err error
+	switch spc.Spec.RestartPolicy {
+	case "", v1alpha1.RestartPolicyNone:
+		return nil
+	case v1alpha1.RestartPolicyAnnotate:
+		err = r.annotatePod(ctx, pod)
+	case v1alpha1.RestartPolicyEvict:
+		err = r.evictPod(pod)
+	default:
+		err = fmt.Errorf("unknown restart policy %s", spc.Spec.RestartPolicy)
+	}
+	if err != nil {
+		r.ns.recordPodEvent(pod.Name, pod.Namespace, string(pod.UID), corev1.EventTypeWarning, FailedToRestart,
+			fmt.Sprintf("failed to restart pod after rotation of secretproviderclass %s with restart policy %s, err: %v", spc.Name, spc.Spec.RestartPolicy, err))
+		return err
+	}
+	log.Infof("restarted pod %s/%s after rotation of secretproviderclass %s/%s with restart policy %s", pod.Namespace, pod.Name, spc.Namespace, spc.Name, spc.Spec.RestartPolicy)
+	return nil
+}
+
+// annotatePod sets the rotated at annotation on the pod to the current time.
+// The uid of the pod is set in the patch, so the patch is rejected if the pod
+// was recreated with the same name since the rotation started.
+func (r *rotationReconciler) annotatePod(ctx context.Context, pod *corev1.Pod) error {
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"uid": pod.UID,
+			"annotations": map[string]string{
+				v1alpha1.RotatedAtAnnotation: time.Now().UTC().Format(time.RFC3339),
+			},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to annotate pod %s/%s, err: %+v", pod.Namespace, pod.Name, err)
+	}
+	if err := r.ns.client.Patch(ctx, pod, client.RawPatch(types.MergePatchType, patch)); err != nil {
+		return fmt.Errorf("failed to annotate pod %s/%s, err: %+v", pod.Namespace, pod.Name, err)
+	}
+	return nil
+}
+
+// evictPod evicts the pod with the eviction API, the eviction is rejected if
+// it would violate a pod disruption budget of the pod, or if the pod was
+// recreated with the same name since the rotation started
+func (r *rotationReconciler) evictPod(pod *corev1.Pod) error {
+	if r.ns.kubeClient == nil {
+		return fmt.Errorf("failed to evict pod %s/%s, kubernetes client is not configured", pod.Namespace, pod.Name)
+	}
+	eviction := &policyv1beta1.Eviction{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      pod.Name,
+			Namespace: pod.Namespace,
+		},
+		DeleteOptions: &metav1.DeleteOptions{Preconditions: metav1.NewUIDPreconditions(string(pod.UID))},
+	}
+	if err := r.ns.kubeClient.CoreV1().Pods(pod.Namespace).Evict(eviction); err != nil {
+		if apierrors.IsTooManyRequests(err) {
+			return fmt.Errorf("eviction of pod %s/%s is blocked by a pod disruption budget, err: %+v", pod.Namespace, pod.Name, err)
+		}
+		return fmt.Errorf("failed to evict pod %s/%s, err: %+v", pod.Namespace, pod.Name, err)
+	}
+	return nil
+}
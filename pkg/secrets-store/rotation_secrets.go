@@ -0,0 +1,409 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package secretsstore
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/net/context"
+	"golang.org/x/time/rate"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"sigs.k8s.io/secrets-store-csi-driver/apis/v1alpha1"
+	"sigs.k8s.io/secrets-store-csi-driver/controllers"
+	"sigs.k8s.io/secrets-store-csi-driver/pkg/util/fileutil"
+)
+
+// refreshSecrets fetches the contents of the volume from the providers and
+// updates the k8s secrets synced from the volume, without writing the contents
+// to the target path. It is used for volumes that are no longer mounted, e.g.
+// after the pod completed, so the consumers of the synced secrets still get
+// the rotated contents.
+func (r *rotationReconciler) refreshSecrets(ctx context.Context, spc *v1alpha1.SecretProviderClass, providerName string, attrib map[string]string, secrets, targetPath, permission string, pod *corev1.Pod) (rotatedContents, string, error) {
+	contents, objects, errorReason, err := r.ns.fetchProviders(ctx, r.limiter, spc, providerName, attrib, secrets, targetPath, permission, pod.Name, pod.Namespace)
+	if err != nil {
+		return rotatedContents{}, errorReason, err
+	}
+	if errorReason, err = r.syncSecrets(ctx, spc, objects); err != nil {
+		return contents, errorReason, err
+	}
+	return contents, "", nil
+}
+
+// fetchProviders fetches the contents of the provider, falling back to the
+// fallback provider, and of the additional providers of the secret provider
+// class. It returns the object versions and expiry of the contents and the
+// fetched files by path. Every provider call waits for the limiter.
+func (ns *nodeServer) fetchProviders(ctx context.Context, limiter *rate.Limiter, spc *v1alpha1.SecretProviderClass, providerName string, attrib map[string]string, secrets, targetPath, permission, podName, podNamespace string) (rotatedContents, map[string][]byte, string, error) {
+	objects := make(map[string][]byte)
+	fetch := func(providerName string, parameters map[string]string) (rotatedContents, string, error) {
+		if err := limiter.Wait(ctx); err != nil {
+			return rotatedContents{}, FailedToMount, fmt.Errorf("failed to wait for the rotation rate limit of provider %s, err: %v", providerName, err)
+		}
+		objectVersions, expiry, files, errorReason, err := ns.fetchProvider(ctx, spc, providerName, parameters, secrets, targetPath, permission, podName, podNamespace)
+		if err != nil {
+			return rotatedContents{}, errorReason, err
+		}
+		for _, file := range files {
+			objects[file.Path] = file.Contents
+		}
+		return rotatedContents{objectVersions: objectVersions, expiry: expiry}, "", nil
+	}
+
+	contents, errorReason, err := fetch(providerName, providerParameters(spc.Spec.Parameters, attrib))
+	if err != nil && spc.Spec.Fallback != nil {
+		fallbackProvider := providerName
+		if len(spc.Spec.Fallback.Provider) > 0 {
+			fallbackProvider = string(spc.Spec.Fallback.Provider)
+		}
+		log.Warningf("failed to fetch secrets store objects for pod %s/%s with provider %s, using fallback provider %s, err: %v", podNamespace, podName, providerName, fallbackProvider, err)
+		contents, errorReason, err = fetch(fallbackProvider, providerParameters(spc.Spec.Fallback.Parameters, attrib))
+	}
+	if err != nil {
+		return rotatedContents{}, nil, errorReason, err
+	}
+	for _, additionalProvider := range spc.Spec.AdditionalProviders {
+		additionalContents, errorReason, err := fetch(string(additionalProvider.Provider), providerParameters(additionalProvider.Parameters, attrib))
+		if err != nil {
+			return rotatedContents{}, nil, errorReason, err
+		}
+		if contents.objectVersions == nil && len(additionalContents.objectVersions) > 0 {
+			contents.objectVersions = make(map[string]string, len(additionalContents.objectVersions))
+		}
+		for id, version := range additionalContents.objectVersions {
+			contents.objectVersions[id] = version
+		}
+		contents.expiry = earliestExpiry(contents.expiry, additionalContents.expiry)
+	}
+	outputFiles, err := renderOutputFiles(spc.Spec.OutputFiles, func(objectName string) ([]byte, error) {
+		if contents, ok := objects[objectName]; ok {
+			return contents, nil
+		}
+		if contents, ok := objects[filepath.Clean(objectName)]; ok {
+			return contents, nil
+		}
+		return nil, fmt.Errorf("object %s isn't mounted", objectName)
+	})
+	if err != nil {
+		return rotatedContents{}, nil, InvalidOutputFiles, fmt.Errorf("failed to render output files, err: %v", err)
+	}
+	for fileName, contents := range outputFiles {
+		objects[fileName] = contents
+	}
+	return contents, objects, "", nil
+}
+
+// syncSecrets updates the data of the k8s secrets synced from the volume with
+// the contents of the objects by object name, and sets the labels and
+// annotations of the secret objects. Secrets that don't exist yet are
+// skipped, they are created by the secret provider class pod status
+// controller. The synced configmaps are updated the same way. The
+// SecretSynced condition of the secret provider class is set to the result.
+func (r *rotationReconciler) syncSecrets(ctx context.Context, spc *v1alpha1.SecretProviderClass, objects map[string][]byte) (string, error) {
+	updated, err := r.syncSecretObjects(ctx, spc, objects)
+	if len(spc.Spec.SecretObjects) > 0 {
+		if err := controllers.UpdateSecretSyncedCondition(ctx, r.ns.client, spc, err, updated); err != nil {
+			log.Errorf("failed to update %s condition of spc %s/%s, err: %+v", v1alpha1.SecretSynced, spc.Namespace, spc.Name, err)
+		}
+	}
+	if err != nil {
+		return FailedToSyncSecrets, err
+	}
+	return r.syncConfigMaps(ctx, spc, objects)
+}
+
+// syncSecretObjects updates the k8s secrets of the secret objects and returns
+// true if any of them was updated
+func (r *rotationReconciler) syncSecretObjects(ctx context.Context, spc *v1alpha1.SecretProviderClass, objects map[string][]byte) (bool, error) {
+	updated := false
+	for _, secretObj := range spc.Spec.SecretObjects {
+		namespace, err := syncedSecretNamespace(ctx, r.ns.client, r.config.SyncNamespaces, spc, secretObj)
+		if err != nil {
+			return updated, fmt.Errorf("failed to sync secret %s, err: %+v", secretObj.SecretName, err)
+		}
+		secret := &corev1.Secret{}
+		if err := r.ns.client.Get(ctx, types.NamespacedName{Namespace: namespace, Name: secretObj.SecretName}, secret); err != nil {
+			if apierrors.IsNotFound(err) {
+				continue
+			}
+			return updated, fmt.Errorf("failed to get synced secret %s/%s, err: %+v", namespace, secretObj.SecretName, err)
+		}
+		data, err := secretData(secretObj, objects)
+		if err != nil {
+			return updated, fmt.Errorf("failed to get data of synced secret %s/%s, err: %+v", namespace, secretObj.SecretName, err)
+		}
+		if err = controllers.CheckConflictPolicy(secretObj.ConflictPolicy, secret); err != nil {
+			log.Warningf("skipping rotation of synced secret, err: %+v", err)
+			continue
+		}
+		if !secretChanged(secret, secretObj, data) {
+			r.syncWriter.cancel("secret", namespace, secretObj.SecretName)
+			continue
+		}
+		key := types.NamespacedName{Namespace: namespace, Name: secretObj.SecretName}
+		labels, annotations := secretObj.Labels, secretObj.Annotations
+		written, err := r.syncWriter.write(ctx, "secret", namespace, secretObj.SecretName, func(ctx context.Context) error {
+			// the secret isn't created again if it was deleted before a
+			// debounced update
+			if err := r.ns.client.Get(ctx, key, &corev1.Secret{}); err != nil {
+				return client.IgnoreNotFound(err)
+			}
+			return controllers.ApplySecret(ctx, r.ns.client, key.Name, key.Namespace, labels, annotations, data)
+		})
+		if err != nil {
+			return updated, fmt.Errorf("failed to update synced secret %s/%s, err: %+v", namespace, secretObj.SecretName, err)
+		}
+		if !written {
+			log.Infof("debounced update of synced secret %s/%s with the rotated contents", namespace, secretObj.SecretName)
+			continue
+		}
+		log.Infof("updated synced secret %s/%s with the rotated contents", namespace, secretObj.SecretName)
+		updated = true
+	}
+	return updated, nil
+}
+
+// syncedSecretNamespace returns the namespace of the synced secret, or an error
+// if the secret provider class isn't allowed to sync the secret into another
+// namespace
+func syncedSecretNamespace(ctx context.Context, c client.Reader, syncNamespaces []string, spc *v1alpha1.SecretProviderClass, secretObj *v1alpha1.SecretObject) (string, error) {
+	if len(secretObj.Namespace) == 0 || secretObj.Namespace == spc.Namespace {
+		return spc.Namespace, nil
+	}
+	if err := controllers.CrossNamespaceSyncAllowed(ctx, c, syncNamespaces, spc.Namespace, secretObj.Namespace); err != nil {
+		return "", err
+	}
+	return secretObj.Namespace, nil
+}
+
+// syncConfigMaps updates the data of the k8s configmaps synced from the volume
+// with the contents of the objects by object name, and sets the labels and
+// annotations of the configmap objects. Configmaps that don't exist yet are
+// skipped, they are created by the secret provider class pod status controller.
+func (r *rotationReconciler) syncConfigMaps(ctx context.Context, spc *v1alpha1.SecretProviderClass, objects map[string][]byte) (string, error) {
+	for _, configMapObj := range spc.Spec.ConfigMapObjects {
+		configMap := &corev1.ConfigMap{}
+		if err := r.ns.client.Get(ctx, types.NamespacedName{Namespace: spc.Namespace, Name: configMapObj.ConfigMapName}, configMap); err != nil {
+			if apierrors.IsNotFound(err) {
+				continue
+			}
+			return FailedToSyncSecrets, fmt.Errorf("failed to get synced configmap %s/%s, err: %+v", spc.Namespace, configMapObj.ConfigMapName, err)
+		}
+		data, err := configMapData(configMapObj, objects)
+		if err != nil {
+			return FailedToSyncSecrets, fmt.Errorf("failed to get data of synced configmap %s/%s, err: %+v", spc.Namespace, configMapObj.ConfigMapName, err)
+		}
+		if !stringDataChanged(configMap.Data, data) && !metadataChanged(configMap.ObjectMeta, configMapObj.Labels, configMapObj.Annotations) {
+			r.syncWriter.cancel("configmap", spc.Namespace, configMapObj.ConfigMapName)
+			continue
+		}
+		key := types.NamespacedName{Namespace: spc.Namespace, Name: configMapObj.ConfigMapName}
+		labels, annotations := configMapObj.Labels, configMapObj.Annotations
+		written, err := r.syncWriter.write(ctx, "configmap", spc.Namespace, configMapObj.ConfigMapName, func(ctx context.Context) error {
+			if err := r.ns.client.Get(ctx, key, &corev1.ConfigMap{}); err != nil {
+				return client.IgnoreNotFound(err)
+			}
+			return controllers.ApplyConfigMap(ctx, r.ns.client, key.Name, key.Namespace, labels, annotations, data)
+		})
+		if err != nil {
+			return FailedToSyncSecrets, fmt.Errorf("failed to update synced configmap %s/%s, err: %+v", spc.Namespace, configMapObj.ConfigMapName, err)
+		}
+		if !written {
+			log.Infof("debounced update of synced configmap %s/%s with the rotated contents", spc.Namespace, configMapObj.ConfigMapName)
+			continue
+		}
+		log.Infof("updated synced configmap %s/%s with the rotated contents", spc.Namespace, configMapObj.ConfigMapName)
+	}
+	return "", nil
+}
+
+// configMapData returns the data of the synced configmap from the contents of
+// the objects by object name
+func configMapData(configMapObj *v1alpha1.ConfigMapObject, objects map[string][]byte) (map[string]string, error) {
+	return controllers.ConfigMapData(configMapObj.Data, func(objectName string) ([]byte, error) {
+		content, ok := objects[objectName]
+		if !ok {
+			return nil, fmt.Errorf("object %s not found", objectName)
+		}
+		return content, nil
+	})
+}
+
+// secretChanged returns true if the synced data, its content hash, or the
+// labels and annotations of the secret object aren't set on the secret. The
+// synced keys changed by someone else while the synced data didn't change are
+// logged as drift, and are overwritten with the synced data.
+func secretChanged(secret *corev1.Secret, secretObj *v1alpha1.SecretObject, data map[string][]byte) bool {
+	hash := controllers.SecretDataHash(data)
+	changed := dataChanged(secret.Data, data)
+	if changed && secret.Annotations[v1alpha1.ContentHashAnnotation] == hash {
+		log.Warningf("synced secret %s/%s drifted from the synced data, the synced keys are overwritten", secret.Namespace, secret.Name)
+	}
+	return changed || secret.Annotations[v1alpha1.ContentHashAnnotation] != hash || metadataChanged(secret.ObjectMeta, secretObj.Labels, secretObj.Annotations)
+}
+
+// metadataChanged returns true if the labels or annotations of the secret or
+// configmap object aren't set on the metadata of the synced object. Labels and
+// annotations set by other controllers are ignored.
+func metadataChanged(meta metav1.ObjectMeta, labels, annotations map[string]string) bool {
+	for k, v := range labels {
+		if current, ok := meta.Labels[k]; !ok || current != v {
+			return true
+		}
+	}
+	for k, v := range annotations {
+		if current, ok := meta.Annotations[k]; !ok || current != v {
+			return true
+		}
+	}
+	return false
+}
+
+// dataChanged returns true if the synced keys of data aren't set on the data
+// of the secret. Keys set by other controllers are ignored.
+func dataChanged(current, data map[string][]byte) bool {
+	for k, v := range data {
+		if c, ok := current[k]; !ok || !bytes.Equal(c, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// stringDataChanged returns true if the synced keys of data aren't set on the
+// data of the configmap, the same as dataChanged
+func stringDataChanged(current, data map[string]string) bool {
+	for k, v := range data {
+		if c, ok := current[k]; !ok || c != v {
+			return true
+		}
+	}
+	return false
+}
+
+// secretData returns the data of the synced secret from the contents of the
+// objects by object name
+func secretData(secretObj *v1alpha1.SecretObject, objects map[string][]byte) (map[string][]byte, error) {
+	secretType := controllers.GetSecretType(secretObj.Type)
+	data := make(map[string][]byte, len(secretObj.Data))
+	for _, d := range secretObj.Data {
+		if len(d.Template) > 0 {
+			content, err := controllers.RenderSecretTemplate(d.Template, func(objectName string) ([]byte, error) {
+				content, ok := objects[objectName]
+				if !ok {
+					return nil, fmt.Errorf("object %s not found", objectName)
+				}
+				return content, nil
+			})
+			if err != nil {
+				return nil, err
+			}
+			data[d.Key] = content
+			continue
+		}
+		content, ok := objects[d.ObjectName]
+		if !ok {
+			return nil, fmt.Errorf("object %s not found", d.ObjectName)
+		}
+		if secretType == corev1.SecretTypeTLS {
+			c, err := controllers.GetCertPart(content, d.Key)
+			if err != nil {
+				return nil, err
+			}
+			content = c
+		}
+		data[d.Key] = content
+	}
+	if err := controllers.ValidateSecretData(secretType, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// hasSyncedObjects returns true if the secret provider class syncs k8s secrets
+// or configmaps from the mounted contents
+func hasSyncedObjects(spc *v1alpha1.SecretProviderClass) bool {
+	return len(spc.Spec.SecretObjects) > 0 || len(spc.Spec.ConfigMapObjects) > 0
+}
+
+// mountedObjects returns the contents of the objects synced to k8s secrets and
+// configmaps by the secret provider class from the files mounted in the target
+// path. All the mounted objects are returned if a synced object uses a
+// template, as the objects referenced by the template are only known once
+// it's rendered.
+func mountedObjects(spc *v1alpha1.SecretProviderClass, targetPath string) (map[string][]byte, error) {
+	var data []*v1alpha1.SecretObjectData
+	for _, secretObj := range spc.Spec.SecretObjects {
+		data = append(data, secretObj.Data...)
+	}
+	for _, configMapObj := range spc.Spec.ConfigMapObjects {
+		data = append(data, configMapObj.Data...)
+	}
+	objects := make(map[string][]byte)
+	for _, d := range data {
+		if len(d.Template) > 0 {
+			if err := readMountedObjects(objects, targetPath); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if _, ok := objects[d.ObjectName]; ok {
+			continue
+		}
+		content, err := ioutil.ReadFile(filepath.Join(targetPath, d.ObjectName))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read mounted object %s, err: %v", d.ObjectName, err)
+		}
+		objects[d.ObjectName] = content
+	}
+	return objects, nil
+}
+
+// readMountedObjects adds the contents of all the files mounted in the target
+// path to objects by file name. Hidden files, e.g. the data version file, and
+// directories are skipped.
+func readMountedObjects(objects map[string][]byte, targetPath string) error {
+	// the mounted files in the target path are symlinks to the data directory
+	targetPath = fileutil.DataDir(targetPath)
+	files, err := ioutil.ReadDir(targetPath)
+	if err != nil {
+		return fmt.Errorf("failed to list mounted objects, err: %v", err)
+	}
+	for _, file := range files {
+		if strings.HasPrefix(file.Name(), ".") || file.IsDir() {
+			continue
+		}
+		if _, ok := objects[file.Name()]; ok {
+			continue
+		}
+		content, err := ioutil.ReadFile(filepath.Join(targetPath, file.Name()))
+		if err != nil {
+			return fmt.Errorf("failed to read mounted object %s, err: %v", file.Name(), err)
+		}
+		objects[file.Name()] = content
+	}
+	return nil
+}
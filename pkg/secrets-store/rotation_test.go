@@ -0,0 +1,2181 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package secretsstore
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	cryptorand "crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+	corev1 "k8s.io/api/core/v1"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/kubernetes/scheme"
+	clienttesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/mount"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/secrets-store-csi-driver/apis/v1alpha1"
+	"sigs.k8s.io/secrets-store-csi-driver/controllers"
+	"sigs.k8s.io/secrets-store-csi-driver/pkg/util/fileutil"
+	providerfake "sigs.k8s.io/secrets-store-csi-driver/provider/fake"
+	providerv1alpha1 "sigs.k8s.io/secrets-store-csi-driver/provider/v1alpha1"
+)
+
+// getTestRotationTargetPath returns a target path in the layout of the kubelet
+// pods directory for the pod uid and volume
+func getTestRotationTargetPath(t *testing.T, podUID, volume string) (string, string) {
+	dir := getTestTargetPath(t)
+	targetPath := filepath.Join(dir, "pods", podUID, "volumes", "kubernetes.io~csi", volume, "mount")
+	if err := os.MkdirAll(targetPath, 0755); err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	return dir, targetPath
+}
+
+func testRotationScheme() *runtime.Scheme {
+	s := scheme.Scheme
+	s.AddKnownTypes(v1alpha1.GroupVersion,
+		&v1alpha1.SecretProviderClass{},
+		&v1alpha1.SecretProviderClassList{},
+		&v1alpha1.SecretProviderClassPodStatus{},
+		&v1alpha1.SecretProviderClassPodStatusList{},
+	)
+	return s
+}
+
+// testRotationObjects returns the secret provider class, pod, node publish
+// secret and secret provider class pod status of a volume mounted for pod1
+func testRotationObjects(podUID, targetPath string) []runtime.Object {
+	spc := &v1alpha1.SecretProviderClass{
+		ObjectMeta: metav1.ObjectMeta{Name: "spc1", Namespace: "default"},
+		Spec: v1alpha1.SecretProviderClassSpec{
+			Provider:   "provider1",
+			Parameters: map[string]string{"parameter1": "value1"},
+		},
+	}
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "pod1", Namespace: "default", UID: types.UID(podUID)},
+		Spec: corev1.PodSpec{
+			ServiceAccountName: "default",
+			Volumes: []corev1.Volume{
+				{
+					Name: "secrets-store-inline",
+					VolumeSource: corev1.VolumeSource{
+						CSI: &corev1.CSIVolumeSource{
+							Driver:               "secrets-store.csi.k8s.io",
+							NodePublishSecretRef: &corev1.LocalObjectReference{Name: "secrets-store-creds"},
+						},
+					},
+				},
+			},
+		},
+	}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "secrets-store-creds", Namespace: "default"},
+		Data:       map[string][]byte{"clientid": []byte("id1")},
+	}
+	spcPodStatus := &v1alpha1.SecretProviderClassPodStatus{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "pod1-default-spc1",
+			Namespace: "default",
+			Labels:    map[string]string{v1alpha1.InternalNodeLabel: "testnode"},
+		},
+		Status: v1alpha1.SecretProviderClassPodStatusStatus{
+			PodName:                 "pod1",
+			PodUID:                  "poduid1",
+			SecretProviderClassName: "spc1",
+			Mounted:                 true,
+			TargetPath:              targetPath,
+			Objects:                 []v1alpha1.SecretProviderClassObject{{ID: "secret/secret1", Version: "v1"}},
+		},
+	}
+	return []runtime.Object{spc, pod, secret, spcPodStatus}
+}
+
+func TestRotationConfigValidate(t *testing.T) {
+	cases := []struct {
+		name        string
+		config      RotationConfig
+		expectedErr bool
+	}{
+		{
+			name:   "rotation disabled",
+			config: RotationConfig{},
+		},
+		{
+			name:   "valid config",
+			config: RotationConfig{Enabled: true, PollInterval: 2 * time.Minute, Jitter: 0.5},
+		},
+		{
+			name:        "poll interval not set",
+			config:      RotationConfig{Enabled: true},
+			expectedErr: true,
+		},
+		{
+			name:        "jitter greater than 1",
+			config:      RotationConfig{Enabled: true, PollInterval: 2 * time.Minute, Jitter: 1.5},
+			expectedErr: true,
+		},
+		{
+			name:        "negative jitter",
+			config:      RotationConfig{Enabled: true, PollInterval: 2 * time.Minute, Jitter: -0.5},
+			expectedErr: true,
+		},
+		{
+			name:        "negative rate limit",
+			config:      RotationConfig{Enabled: true, PollInterval: 2 * time.Minute, RateLimit: -1},
+			expectedErr: true,
+		},
+		{
+			name:        "rate limit without burst",
+			config:      RotationConfig{Enabled: true, PollInterval: 2 * time.Minute, RateLimit: 1},
+			expectedErr: true,
+		},
+		{
+			name:        "negative max backoff",
+			config:      RotationConfig{Enabled: true, PollInterval: 2 * time.Minute, MaxBackoff: -time.Minute},
+			expectedErr: true,
+		},
+		{
+			name:        "negative sync debounce",
+			config:      RotationConfig{Enabled: true, PollInterval: 2 * time.Minute, SyncDebounce: -time.Second},
+			expectedErr: true,
+		},
+		{
+			name:        "sync rate limit without burst",
+			config:      RotationConfig{Enabled: true, PollInterval: 2 * time.Minute, SyncRateLimit: 1},
+			expectedErr: true,
+		},
+		{
+			name:   "trigger on localhost",
+			config: RotationConfig{Enabled: true, PollInterval: 2 * time.Minute, TriggerAddr: "localhost:8095"},
+		},
+		{
+			name:   "trigger on loopback ip",
+			config: RotationConfig{Enabled: true, PollInterval: 2 * time.Minute, TriggerAddr: "[::1]:8095"},
+		},
+		{
+			name:   "trigger on unix socket",
+			config: RotationConfig{Enabled: true, PollInterval: 2 * time.Minute, TriggerAddr: "unix:///var/run/secrets-store-csi-driver/rotate.sock"},
+		},
+		{
+			name:        "trigger on all addresses",
+			config:      RotationConfig{Enabled: true, PollInterval: 2 * time.Minute, TriggerAddr: ":8095"},
+			expectedErr: true,
+		},
+		{
+			name:        "trigger on node ip",
+			config:      RotationConfig{Enabled: true, PollInterval: 2 * time.Minute, TriggerAddr: "10.0.0.4:8095"},
+			expectedErr: true,
+		},
+		{
+			name:        "trigger on unix socket without path",
+			config:      RotationConfig{Enabled: true, PollInterval: 2 * time.Minute, TriggerAddr: "unix://"},
+			expectedErr: true,
+		},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.config.Validate()
+			if test.expectedErr && err == nil || !test.expectedErr && err != nil {
+				t.Fatalf("expected err: %v, got: %+v", test.expectedErr, err)
+			}
+		})
+	}
+}
+
+func TestRotationJitter(t *testing.T) {
+	cases := []struct {
+		name     string
+		jitter   float64
+		random   float64
+		expected time.Duration
+	}{
+		{
+			name:     "no jitter",
+			random:   0.5,
+			expected: 0,
+		},
+		{
+			name:     "half of the maximum delay",
+			jitter:   0.5,
+			random:   0.5,
+			expected: 30 * time.Second,
+		},
+		{
+			name:     "no delay",
+			jitter:   0.5,
+			random:   0,
+			expected: 0,
+		},
+		{
+			name:     "delay up to the poll interval",
+			jitter:   1,
+			random:   0.75,
+			expected: 90 * time.Second,
+		},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			r := newRotationReconciler(nil, RotationConfig{Enabled: true, PollInterval: 2 * time.Minute, Jitter: test.jitter})
+			r.random = func() float64 { return test.random }
+			if delay := r.jitter(); delay != test.expected {
+				t.Errorf("expected delay: %v, got: %v", test.expected, delay)
+			}
+		})
+	}
+}
+
+func TestRotationBackoff(t *testing.T) {
+	cases := []struct {
+		name         string
+		maxBackoff   time.Duration
+		failureCount int32
+		expected     time.Duration
+	}{
+		{
+			name:         "backoff disabled",
+			failureCount: 3,
+			expected:     0,
+		},
+		{
+			name:         "first failure",
+			maxBackoff:   30 * time.Minute,
+			failureCount: 1,
+			expected:     2 * time.Minute,
+		},
+		{
+			name:         "doubled for every failure",
+			maxBackoff:   30 * time.Minute,
+			failureCount: 4,
+			expected:     16 * time.Minute,
+		},
+		{
+			name:         "capped at the max backoff",
+			maxBackoff:   30 * time.Minute,
+			failureCount: 100,
+			expected:     30 * time.Minute,
+		},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			r := newRotationReconciler(nil, RotationConfig{Enabled: true, PollInterval: 2 * time.Minute, MaxBackoff: test.maxBackoff})
+			if backoff := r.backoff(test.failureCount); backoff != test.expected {
+				t.Errorf("expected backoff: %v, got: %v", test.expected, backoff)
+			}
+		})
+	}
+}
+
+func TestRotationDelay(t *testing.T) {
+	now := time.Now()
+	cases := []struct {
+		name          string
+		expiry        *metav1.Time
+		rotation      *v1alpha1.RotationStatus
+		specChanged   bool
+		interval      time.Duration
+		created       time.Time
+		expectedDelay time.Duration
+		expectedOk    bool
+	}{
+		{
+			name:          "objects don't expire",
+			expectedDelay: time.Minute,
+			expectedOk:    true,
+		},
+		{
+			name:   "objects expire after the next poll",
+			expiry: &metav1.Time{Time: now.Add(time.Hour)},
+		},
+		{
+			name:          "objects expire before the next poll",
+			expiry:        &metav1.Time{Time: now.Add(90 * time.Second)},
+			expectedDelay: time.Minute,
+			expectedOk:    true,
+		},
+		{
+			name:       "objects expired",
+			expiry:     &metav1.Time{Time: now.Add(-time.Minute)},
+			expectedOk: true,
+		},
+		{
+			name:          "rotation failed once",
+			rotation:      &v1alpha1.RotationStatus{LastAttemptTime: &metav1.Time{Time: now.Add(-2 * time.Minute)}, FailureCount: 1},
+			expectedDelay: time.Minute,
+			expectedOk:    true,
+		},
+		{
+			name:          "backoff passes before the next poll",
+			rotation:      &v1alpha1.RotationStatus{LastAttemptTime: &metav1.Time{Time: now.Add(-6 * time.Minute)}, FailureCount: 3},
+			expectedDelay: 2 * time.Minute,
+			expectedOk:    true,
+		},
+		{
+			name:     "backoff passes after the next poll",
+			rotation: &v1alpha1.RotationStatus{LastAttemptTime: &metav1.Time{Time: now.Add(-2 * time.Minute)}, FailureCount: 3},
+		},
+		{
+			name:     "objects expired with backoff",
+			expiry:   &metav1.Time{Time: now.Add(-time.Minute)},
+			rotation: &v1alpha1.RotationStatus{LastAttemptTime: &metav1.Time{Time: now.Add(-time.Minute)}, FailureCount: 2},
+		},
+		{
+			name:        "secret provider class changed",
+			expiry:      &metav1.Time{Time: now.Add(time.Hour)},
+			specChanged: true,
+			expectedOk:  true,
+		},
+		{
+			name:        "secret provider class changed with backoff",
+			rotation:    &v1alpha1.RotationStatus{LastAttemptTime: &metav1.Time{Time: now.Add(-2 * time.Minute)}, FailureCount: 3},
+			specChanged: true,
+		},
+		{
+			name:          "rotation interval passes before the next poll",
+			rotation:      &v1alpha1.RotationStatus{LastAttemptTime: &metav1.Time{Time: now.Add(-510 * time.Second)}},
+			interval:      10 * time.Minute,
+			expectedDelay: 90 * time.Second,
+			expectedOk:    true,
+		},
+		{
+			name:     "rotation interval passes after the next poll",
+			rotation: &v1alpha1.RotationStatus{LastAttemptTime: &metav1.Time{Time: now.Add(-5 * time.Minute)}},
+			interval: 10 * time.Minute,
+		},
+		{
+			name:     "rotation interval since the mount",
+			interval: 10 * time.Minute,
+			created:  now.Add(-time.Minute),
+		},
+		{
+			name:          "rotation interval passed",
+			rotation:      &v1alpha1.RotationStatus{LastAttemptTime: &metav1.Time{Time: now.Add(-time.Hour)}},
+			interval:      10 * time.Minute,
+			expectedDelay: time.Minute,
+			expectedOk:    true,
+		},
+		{
+			name:          "objects expire before the rotation interval passes",
+			expiry:        &metav1.Time{Time: now.Add(90 * time.Second)},
+			rotation:      &v1alpha1.RotationStatus{LastAttemptTime: &metav1.Time{Time: now.Add(-time.Minute)}},
+			interval:      10 * time.Minute,
+			expectedDelay: time.Minute,
+			expectedOk:    true,
+		},
+		{
+			name:        "secret provider class changed before the rotation interval passes",
+			rotation:    &v1alpha1.RotationStatus{LastAttemptTime: &metav1.Time{Time: now.Add(-time.Minute)}},
+			interval:    10 * time.Minute,
+			specChanged: true,
+			expectedOk:  true,
+		},
+		{
+			name:          "rotation succeeded after failures",
+			rotation:      &v1alpha1.RotationStatus{LastAttemptTime: &metav1.Time{Time: now}},
+			expectedDelay: time.Minute,
+			expectedOk:    true,
+		},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			r := &rotationReconciler{
+				config: RotationConfig{PollInterval: 2 * time.Minute, Jitter: 1, RenewBefore: 30 * time.Second, MaxBackoff: 30 * time.Minute},
+				random: func() float64 { return 0.5 },
+			}
+			spcPodStatus := &v1alpha1.SecretProviderClassPodStatus{
+				ObjectMeta: metav1.ObjectMeta{CreationTimestamp: metav1.NewTime(test.created)},
+				Status:     v1alpha1.SecretProviderClassPodStatusStatus{ExpiryTime: test.expiry, Rotation: test.rotation},
+			}
+			delay, ok := r.delay(spcPodStatus, test.specChanged, test.interval)
+			if ok != test.expectedOk {
+				t.Fatalf("expected rotation before the next poll: %v, got: %v", test.expectedOk, ok)
+			}
+			// allow for the time passed since the expiry was set
+			if diff := test.expectedDelay - delay; diff < 0 || diff > time.Second {
+				t.Errorf("expected delay: %v, got: %v", test.expectedDelay, delay)
+			}
+		})
+	}
+}
+
+func TestRotationEnqueueVolumes(t *testing.T) {
+	var objects []runtime.Object
+	for i, node := range []string{"testnode", "testnode", "othernode"} {
+		objects = append(objects, &v1alpha1.SecretProviderClassPodStatus{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      fmt.Sprintf("pod%d-default-provider1", i),
+				Namespace: "default",
+				Labels:    map[string]string{v1alpha1.InternalNodeLabel: node},
+			},
+		})
+	}
+	ns, err := testNodeServer(nil, fake.NewFakeClientWithScheme(testRotationScheme(), objects...), "")
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	defer os.RemoveAll(ns.providerVolumePath)
+
+	r := newRotationReconciler(ns, RotationConfig{Enabled: true, PollInterval: 2 * time.Minute})
+	defer r.queue.ShutDown()
+	r.enqueueVolumes()
+	if r.queue.Len() != 2 {
+		t.Fatalf("expected 2 volumes of the node to be queued, got: %d", r.queue.Len())
+	}
+	queued := make(map[interface{}]bool)
+	for i := 0; i < 2; i++ {
+		item, _ := r.queue.Get()
+		queued[item] = true
+		r.queue.Done(item)
+	}
+	expected := map[interface{}]bool{
+		types.NamespacedName{Namespace: "default", Name: "pod0-default-provider1"}: true,
+		types.NamespacedName{Namespace: "default", Name: "pod1-default-provider1"}: true,
+	}
+	if !reflect.DeepEqual(queued, expected) {
+		t.Errorf("expected queued volumes: %v, got: %v", expected, queued)
+	}
+}
+
+// testCertificatePEM returns a PEM encoded self-signed certificate that
+// expires at notAfter
+func testCertificatePEM(t *testing.T, notAfter time.Time) []byte {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), cryptorand.Reader)
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: "test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(cryptorand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func TestRotationQueue(t *testing.T) {
+	now := time.Now()
+	priorities := map[string]time.Time{
+		"later":   now.Add(2 * time.Hour),
+		"earlier": now.Add(time.Hour),
+	}
+	q := newRotationQueue(func(item interface{}) time.Time { return priorities[item.(string)] })
+	defer q.ShutDown()
+
+	for _, item := range []string{"none1", "later", "none2", "earlier", "later"} {
+		q.Add(item)
+	}
+	if q.Len() != 4 {
+		t.Fatalf("expected 4 queued items, got: %d", q.Len())
+	}
+	// the items with the earliest priority are handed out first, the items
+	// without a priority in the order they were added
+	var order []interface{}
+	for i := 0; i < 4; i++ {
+		item, shutdown := q.Get()
+		if shutdown {
+			t.Fatalf("expected queue not to be shut down")
+		}
+		order = append(order, item)
+	}
+	expected := []interface{}{"earlier", "later", "none1", "none2"}
+	if !reflect.DeepEqual(order, expected) {
+		t.Errorf("expected queue order: %v, got: %v", expected, order)
+	}
+
+	// an item added while it is processed is queued again once it is done
+	q.Add("earlier")
+	if q.Len() != 0 {
+		t.Errorf("expected item not to be queued while it is processed, got: %d queued items", q.Len())
+	}
+	for _, item := range order {
+		q.Done(item)
+	}
+	if item, _ := q.Get(); item != "earlier" {
+		t.Errorf("expected item earlier to be queued again, got: %v", item)
+	}
+
+	q.ShutDown()
+	if _, shutdown := q.Get(); !shutdown {
+		t.Errorf("expected queue to be shut down")
+	}
+}
+
+func TestCertificateExpiry(t *testing.T) {
+	dir, targetPath := getTestRotationTargetPath(t, "poduid1", "secrets-store-inline")
+	defer os.RemoveAll(dir)
+	now := time.Now().Truncate(time.Second)
+
+	if expiry := certificateExpiry(targetPath); !expiry.IsZero() {
+		t.Errorf("expected no certificate expiry without certificates, got: %v", expiry)
+	}
+
+	files := map[string][]byte{
+		"secret1":          []byte("value1"),
+		"certs/cert1.pem":  testCertificatePEM(t, now.Add(2*time.Hour)),
+		"bundle.pem":       append(testCertificatePEM(t, now.Add(3*time.Hour)), testCertificatePEM(t, now.Add(time.Hour))...),
+		".hidden/cert.pem": testCertificatePEM(t, now.Add(time.Minute)),
+	}
+	for path, contents := range files {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(targetPath, path)), 0755); err != nil {
+			t.Fatalf("expected err to be nil, got: %+v", err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(targetPath, path), contents, 0644); err != nil {
+			t.Fatalf("expected err to be nil, got: %+v", err)
+		}
+	}
+	if expiry := certificateExpiry(targetPath); !expiry.Equal(now.Add(time.Hour)) {
+		t.Errorf("expected certificate expiry: %v, got: %v", now.Add(time.Hour), expiry)
+	}
+}
+
+func TestRotationEnqueueVolumesPriority(t *testing.T) {
+	var objects []runtime.Object
+	var expected []interface{}
+	for i, notAfter := range []time.Time{{}, time.Now().Add(2 * time.Hour), time.Now().Add(time.Hour)} {
+		dir, targetPath := getTestRotationTargetPath(t, fmt.Sprintf("poduid%d", i), "secrets-store-inline")
+		defer os.RemoveAll(dir)
+		if !notAfter.IsZero() {
+			if err := ioutil.WriteFile(filepath.Join(targetPath, "cert.pem"), testCertificatePEM(t, notAfter), 0644); err != nil {
+				t.Fatalf("expected err to be nil, got: %+v", err)
+			}
+		}
+		name := fmt.Sprintf("pod%d-default-provider1", i)
+		objects = append(objects, &v1alpha1.SecretProviderClassPodStatus{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: "default",
+				Labels:    map[string]string{v1alpha1.InternalNodeLabel: "testnode"},
+			},
+			Status: v1alpha1.SecretProviderClassPodStatusStatus{TargetPath: targetPath},
+		})
+		expected = append([]interface{}{types.NamespacedName{Namespace: "default", Name: name}}, expected...)
+	}
+	ns, err := testNodeServer(nil, fake.NewFakeClientWithScheme(testRotationScheme(), objects...), "")
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	defer os.RemoveAll(ns.providerVolumePath)
+
+	r := newRotationReconciler(ns, RotationConfig{Enabled: true, PollInterval: 2 * time.Minute})
+	defer r.queue.ShutDown()
+	r.enqueueVolumes()
+	// the volume with the certificate that expires first is rotated first
+	var order []interface{}
+	for r.queue.Len() > 0 {
+		item, _ := r.queue.Get()
+		order = append(order, item)
+		r.queue.Done(item)
+	}
+	if !reflect.DeepEqual(order, expected) {
+		t.Errorf("expected queue order: %v, got: %v", expected, order)
+	}
+}
+
+func TestRotationTrigger(t *testing.T) {
+	cases := []struct {
+		name           string
+		method         string
+		query          string
+		expectedStatus int
+		expectedQueued []string
+	}{
+		{
+			name:           "volumes of the pod",
+			method:         http.MethodPost,
+			query:          "namespace=default&pod=pod1",
+			expectedStatus: http.StatusAccepted,
+			expectedQueued: []string{"pod1-default-spc1", "pod1-default-spc2"},
+		},
+		{
+			name:           "volumes of the secret provider class",
+			method:         http.MethodPost,
+			query:          "namespace=default&secretProviderClass=spc1",
+			expectedStatus: http.StatusAccepted,
+			expectedQueued: []string{"pod1-default-spc1", "pod2-default-spc1"},
+		},
+		{
+			name:           "volume of the pod and secret provider class",
+			method:         http.MethodPost,
+			query:          "namespace=default&pod=pod2&secretProviderClass=spc1",
+			expectedStatus: http.StatusAccepted,
+			expectedQueued: []string{"pod2-default-spc1"},
+		},
+		{
+			name:           "no volumes of the pod on the node",
+			method:         http.MethodPost,
+			query:          "namespace=default&pod=pod3",
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "missing namespace",
+			method:         http.MethodPost,
+			query:          "pod=pod1",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "method not allowed",
+			method:         http.MethodGet,
+			query:          "namespace=default&pod=pod1",
+			expectedStatus: http.StatusMethodNotAllowed,
+		},
+	}
+
+	var objects []runtime.Object
+	for _, volume := range []struct{ pod, spc, node string }{{"pod1", "spc1", "testnode"}, {"pod1", "spc2", "testnode"}, {"pod2", "spc1", "testnode"}, {"pod3", "spc1", "othernode"}} {
+		objects = append(objects, &v1alpha1.SecretProviderClassPodStatus{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      fmt.Sprintf("%s-default-%s", volume.pod, volume.spc),
+				Namespace: "default",
+				Labels:    map[string]string{v1alpha1.InternalNodeLabel: volume.node},
+			},
+			Status: v1alpha1.SecretProviderClassPodStatusStatus{
+				PodName:                 volume.pod,
+				SecretProviderClassName: volume.spc,
+			},
+		})
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			ns, err := testNodeServer(nil, fake.NewFakeClientWithScheme(testRotationScheme(), objects...), "")
+			if err != nil {
+				t.Fatalf("expected err to be nil, got: %+v", err)
+			}
+			defer os.RemoveAll(ns.providerVolumePath)
+
+			r := newRotationReconciler(ns, RotationConfig{Enabled: true, PollInterval: 2 * time.Minute})
+			defer r.queue.ShutDown()
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(test.method, rotationTriggerPath+"?"+test.query, nil))
+			if w.Code != test.expectedStatus {
+				t.Fatalf("expected status: %d, got: %d, body: %s", test.expectedStatus, w.Code, w.Body.String())
+			}
+
+			queued := make(map[interface{}]bool)
+			for r.queue.Len() > 0 {
+				item, _ := r.queue.Get()
+				queued[item] = true
+				r.queue.Done(item)
+			}
+			expected := make(map[interface{}]bool)
+			for _, name := range test.expectedQueued {
+				expected[types.NamespacedName{Namespace: "default", Name: name}] = true
+			}
+			if !reflect.DeepEqual(queued, expected) {
+				t.Errorf("expected queued volumes: %v, got: %v", expected, queued)
+			}
+		})
+	}
+}
+
+func TestRotationAllowed(t *testing.T) {
+	// 2020-06-06 is a Saturday
+	now := time.Date(2020, time.June, 6, 3, 0, 0, 0, time.UTC)
+	saturday := v1alpha1.RotationWindow{Schedule: "0 2 * * 6", Duration: metav1.Duration{Duration: 4 * time.Hour}}
+	sunday := v1alpha1.RotationWindow{Schedule: "0 2 * * 0", Duration: metav1.Duration{Duration: 4 * time.Hour}}
+	cases := []struct {
+		name        string
+		windows     []v1alpha1.RotationWindow
+		blackouts   []v1alpha1.RotationWindow
+		expected    bool
+		expectedErr bool
+	}{
+		{
+			name:     "no rotation windows",
+			expected: true,
+		},
+		{
+			name:     "in a rotation window",
+			windows:  []v1alpha1.RotationWindow{sunday, saturday},
+			expected: true,
+		},
+		{
+			name:    "outside of the rotation windows",
+			windows: []v1alpha1.RotationWindow{sunday},
+		},
+		{
+			name:      "in a rotation blackout",
+			blackouts: []v1alpha1.RotationWindow{saturday},
+		},
+		{
+			name:      "blackout takes precedence over the rotation window",
+			windows:   []v1alpha1.RotationWindow{saturday},
+			blackouts: []v1alpha1.RotationWindow{saturday},
+		},
+		{
+			name:      "outside of the rotation blackouts",
+			blackouts: []v1alpha1.RotationWindow{sunday},
+			expected:  true,
+		},
+		{
+			name:        "invalid schedule",
+			windows:     []v1alpha1.RotationWindow{{Schedule: "0 2 * *", Duration: metav1.Duration{Duration: time.Hour}}},
+			expectedErr: true,
+		},
+		{
+			name:        "invalid duration",
+			blackouts:   []v1alpha1.RotationWindow{{Schedule: "0 2 * * 6"}},
+			expectedErr: true,
+		},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			spc := &v1alpha1.SecretProviderClass{
+				Spec: v1alpha1.SecretProviderClassSpec{RotationWindows: test.windows, RotationBlackouts: test.blackouts},
+			}
+			allowed, err := rotationAllowed(spc, now)
+			if test.expectedErr != (err != nil) {
+				t.Fatalf("expected error: %v, got: %+v", test.expectedErr, err)
+			}
+			if allowed != test.expected {
+				t.Errorf("expected rotation allowed: %v, got: %v", test.expected, allowed)
+			}
+		})
+	}
+}
+
+func TestRotationReconcile(t *testing.T) {
+	cases := []struct {
+		name             string
+		notMounted       bool
+		podUID           string
+		podAnnotations   map[string]string
+		spcAnnotations   map[string]string
+		windows          []v1alpha1.RotationWindow
+		blackouts        []v1alpha1.RotationWindow
+		capabilities     []providerv1alpha1.Capability
+		specChanged      bool
+		providerErr      error
+		objectsExpiry    time.Time
+		providerContents string
+		syncSecret       bool
+		expectedContents string
+		expectedSynced   string
+		expectedVersion  string
+		expectedRotated  bool
+		expectedSkipped  bool
+		expectedErr      bool
+	}{
+		{
+			name:             "contents rotated",
+			podUID:           "poduid1",
+			expectedContents: "value2",
+			expectedVersion:  "v2",
+			expectedRotated:  true,
+		},
+		{
+			name:             "objects with expiry rotated",
+			podUID:           "poduid1",
+			objectsExpiry:    time.Unix(1700000000, 0),
+			expectedContents: "value2",
+			expectedVersion:  "v2",
+			expectedRotated:  true,
+		},
+		{
+			name:             "contents unchanged",
+			podUID:           "poduid1",
+			providerContents: "value1",
+			expectedContents: "value1",
+			expectedVersion:  "v2",
+		},
+		{
+			name:             "provider fails to rotate the contents",
+			podUID:           "poduid1",
+			providerErr:      fmt.Errorf("secrets store not reachable"),
+			expectedContents: "value1",
+			expectedVersion:  "v1",
+			expectedErr:      true,
+		},
+		{
+			name:             "synced secret rotated",
+			podUID:           "poduid1",
+			syncSecret:       true,
+			expectedContents: "value2",
+			expectedSynced:   "value2",
+			expectedVersion:  "v2",
+			expectedRotated:  true,
+		},
+		{
+			name:             "synced secret of a volume that isn't mounted rotated",
+			notMounted:       true,
+			podUID:           "poduid1",
+			syncSecret:       true,
+			expectedContents: "value1",
+			expectedSynced:   "value2",
+			expectedVersion:  "v2",
+		},
+		{
+			name:             "synced secret not rotated if the provider fails",
+			podUID:           "poduid1",
+			syncSecret:       true,
+			providerErr:      fmt.Errorf("secrets store not reachable"),
+			expectedContents: "value1",
+			expectedSynced:   "value1",
+			expectedVersion:  "v1",
+			expectedErr:      true,
+		},
+		{
+			name:             "target path not mounted",
+			notMounted:       true,
+			podUID:           "poduid1",
+			expectedContents: "value1",
+			expectedVersion:  "v1",
+			expectedSkipped:  true,
+		},
+		{
+			name:             "pod recreated with the same name",
+			podUID:           "poduid2",
+			expectedContents: "value1",
+			expectedVersion:  "v1",
+			expectedSkipped:  true,
+		},
+		{
+			name:             "rotation paused on the pod",
+			podUID:           "poduid1",
+			podAnnotations:   map[string]string{v1alpha1.RotationAnnotation: v1alpha1.RotationPaused},
+			expectedContents: "value1",
+			expectedVersion:  "v1",
+			expectedSkipped:  true,
+		},
+		{
+			name:             "rotation paused on the secret provider class",
+			podUID:           "poduid1",
+			spcAnnotations:   map[string]string{v1alpha1.RotationAnnotation: v1alpha1.RotationPaused},
+			expectedContents: "value1",
+			expectedVersion:  "v1",
+			expectedSkipped:  true,
+		},
+		{
+			name:             "contents rotated during the rotation window",
+			podUID:           "poduid1",
+			windows:          []v1alpha1.RotationWindow{{Schedule: "* * * * *", Duration: metav1.Duration{Duration: time.Hour}}},
+			expectedContents: "value2",
+			expectedVersion:  "v2",
+			expectedRotated:  true,
+		},
+		{
+			name:             "outside of the rotation windows",
+			podUID:           "poduid1",
+			windows:          []v1alpha1.RotationWindow{{Schedule: "0 0 30 2 *", Duration: metav1.Duration{Duration: time.Hour}}},
+			expectedContents: "value1",
+			expectedVersion:  "v1",
+			expectedSkipped:  true,
+		},
+		{
+			name:             "rotation blackout",
+			podUID:           "poduid1",
+			windows:          []v1alpha1.RotationWindow{{Schedule: "* * * * *", Duration: metav1.Duration{Duration: time.Hour}}},
+			blackouts:        []v1alpha1.RotationWindow{{Schedule: "* * * * *", Duration: metav1.Duration{Duration: time.Hour}}},
+			expectedContents: "value1",
+			expectedVersion:  "v1",
+			expectedSkipped:  true,
+		},
+		{
+			name:             "invalid rotation window",
+			podUID:           "poduid1",
+			windows:          []v1alpha1.RotationWindow{{Schedule: "every saturday", Duration: metav1.Duration{Duration: time.Hour}}},
+			expectedContents: "value1",
+			expectedVersion:  "v1",
+			expectedErr:      true,
+		},
+		{
+			name:             "provider keeps the contents up to date",
+			podUID:           "poduid1",
+			capabilities:     []providerv1alpha1.Capability{providerv1alpha1.Capability_OBJECT_VERSIONING, providerv1alpha1.Capability_ROTATION},
+			expectedContents: "value1",
+			expectedVersion:  "v1",
+			expectedSkipped:  true,
+		},
+		{
+			name:             "changed secret provider class remounted outside of the rotation windows",
+			podUID:           "poduid1",
+			windows:          []v1alpha1.RotationWindow{{Schedule: "0 0 30 2 *", Duration: metav1.Duration{Duration: time.Hour}}},
+			specChanged:      true,
+			expectedContents: "value2",
+			expectedVersion:  "v2",
+			expectedRotated:  true,
+		},
+		{
+			name:             "changed secret provider class remounted for a provider that keeps the contents up to date",
+			podUID:           "poduid1",
+			capabilities:     []providerv1alpha1.Capability{providerv1alpha1.Capability_OBJECT_VERSIONING, providerv1alpha1.Capability_ROTATION},
+			specChanged:      true,
+			expectedContents: "value2",
+			expectedVersion:  "v2",
+			expectedRotated:  true,
+		},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			dir, targetPath := getTestRotationTargetPath(t, "poduid1", "secrets-store-inline")
+			defer os.RemoveAll(dir)
+			if err := ioutil.WriteFile(filepath.Join(targetPath, "secret1"), []byte("value1"), 0644); err != nil {
+				t.Fatalf("expected err to be nil, got: %+v", err)
+			}
+
+			var mountPoints []mount.MountPoint
+			if !test.notMounted {
+				mountPoints = []mount.MountPoint{{Path: targetPath}}
+			}
+			objects := testRotationObjects(test.podUID, targetPath)
+			objects[0].(*v1alpha1.SecretProviderClass).Annotations = test.spcAnnotations
+			objects[0].(*v1alpha1.SecretProviderClass).Spec.RotationWindows = test.windows
+			objects[0].(*v1alpha1.SecretProviderClass).Spec.RotationBlackouts = test.blackouts
+			objects[1].(*corev1.Pod).Annotations = test.podAnnotations
+			if test.specChanged {
+				objects[0].(*v1alpha1.SecretProviderClass).Generation = 2
+				objects[3].(*v1alpha1.SecretProviderClassPodStatus).Status.SecretProviderClassGeneration = 1
+			}
+			if test.syncSecret {
+				objects[0].(*v1alpha1.SecretProviderClass).Spec.SecretObjects = []*v1alpha1.SecretObject{
+					{SecretName: "synced1", Type: "Opaque", Data: []*v1alpha1.SecretObjectData{{ObjectName: "secret1", Key: "key1"}}},
+				}
+				objects = append(objects, &corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{Name: "synced1", Namespace: "default"},
+					Data:       map[string][]byte{"key1": []byte("value1")},
+				})
+			}
+			ns, err := testNodeServer(mountPoints, fake.NewFakeClientWithScheme(testRotationScheme(), objects...), "")
+			if err != nil {
+				t.Fatalf("expected err to be nil, got: %+v", err)
+			}
+			defer os.RemoveAll(ns.providerVolumePath)
+			auditLogPath := filepath.Join(dir, "audit.log")
+			if ns.auditLog, err = NewAuditLog(auditLogPath); err != nil {
+				t.Fatalf("expected err to be nil, got: %+v", err)
+			}
+			defer ns.auditLog.Close()
+
+			server, err := providerfake.NewMocKCSIProviderServer(filepath.Join(ns.providerVolumePath, "provider1.sock"))
+			if err != nil {
+				t.Fatalf("expected err to be nil, got: %+v", err)
+			}
+			providerContents := test.providerContents
+			if len(providerContents) == 0 {
+				providerContents = "value2"
+			}
+			server.SetFiles(map[string]string{"secret1": providerContents})
+			server.SetObjects(map[string]string{"secret/secret1": "v2"})
+			if test.capabilities != nil {
+				server.SetCapabilities(test.capabilities...)
+			}
+			server.SetReturnError(test.providerErr)
+			if !test.objectsExpiry.IsZero() {
+				server.SetObjectsExpiry(test.objectsExpiry)
+			}
+			server.Start()
+			defer server.Stop()
+
+			r := newRotationReconciler(ns, RotationConfig{Enabled: true, PollInterval: 2 * time.Minute})
+			defer r.queue.ShutDown()
+			key := types.NamespacedName{Namespace: "default", Name: "pod1-default-spc1"}
+			if err := r.reconcile(context.TODO(), key); test.expectedErr != (err != nil) {
+				t.Fatalf("expected error: %v, got: %+v", test.expectedErr, err)
+			}
+
+			contents, err := ioutil.ReadFile(filepath.Join(targetPath, "secret1"))
+			if err != nil {
+				t.Fatalf("expected err to be nil, got: %+v", err)
+			}
+			if string(contents) != test.expectedContents {
+				t.Errorf("expected contents: %s, got: %s", test.expectedContents, string(contents))
+			}
+			if _, err := os.Stat(filepath.Join(targetPath, ".provider1-rotation")); !os.IsNotExist(err) {
+				t.Errorf("expected staging directory to be removed, got: %+v", err)
+			}
+			_, err = os.Stat(filepath.Join(targetPath, fileutil.DataVersionFile))
+			if rotated := err == nil; rotated != test.expectedRotated {
+				t.Errorf("expected data version file written: %v, got: %+v", test.expectedRotated, err)
+			}
+
+			updated := &v1alpha1.SecretProviderClassPodStatus{}
+			if err := ns.client.Get(context.TODO(), key, updated); err != nil {
+				t.Fatalf("expected err to be nil, got: %+v", err)
+			}
+			expectedObjects := []v1alpha1.SecretProviderClassObject{{ID: "secret/secret1", Version: test.expectedVersion}}
+			if !reflect.DeepEqual(updated.Status.Objects, expectedObjects) {
+				t.Errorf("expected objects: %v, got: %v", expectedObjects, updated.Status.Objects)
+			}
+
+			// the delivery of new object versions is recorded in the audit log
+			var expectedEvents []string
+			if test.expectedVersion == "v2" {
+				expectedEvents = []string{auditEventRotation}
+				if test.notMounted {
+					expectedEvents = []string{auditEventSecretsRefresh}
+				}
+			}
+			var events []string
+			for _, record := range readAuditRecords(t, auditLogPath) {
+				if !reflect.DeepEqual(record.Objects, expectedObjects) || record.PodUID != "poduid1" {
+					t.Errorf("expected audit record of objects %v for pod poduid1, got: %+v", expectedObjects, record)
+				}
+				events = append(events, record.Event)
+			}
+			if !reflect.DeepEqual(events, expectedEvents) {
+				t.Errorf("expected audit events: %v, got: %v", expectedEvents, events)
+			}
+
+			if test.syncSecret {
+				synced := &corev1.Secret{}
+				if err := ns.client.Get(context.TODO(), types.NamespacedName{Namespace: "default", Name: "synced1"}, synced); err != nil {
+					t.Fatalf("expected err to be nil, got: %+v", err)
+				}
+				if string(synced.Data["key1"]) != test.expectedSynced {
+					t.Errorf("expected synced secret contents: %s, got: %s", test.expectedSynced, string(synced.Data["key1"]))
+				}
+			}
+
+			if !updated.Status.ExpiryTime.Equal(expiryTime(test.objectsExpiry)) {
+				t.Errorf("expected expiry time: %v, got: %v", test.objectsExpiry, updated.Status.ExpiryTime)
+			}
+
+			rotation := updated.Status.Rotation
+			switch {
+			case test.expectedSkipped:
+				if rotation != nil {
+					t.Errorf("expected rotation status to be nil for skipped rotation, got: %+v", rotation)
+				}
+			case rotation == nil || rotation.LastAttemptTime == nil:
+				t.Errorf("expected rotation attempt to be recorded, got: %+v", rotation)
+			case test.expectedErr:
+				if len(rotation.LastError) == 0 || rotation.LastRotationTime != nil || rotation.FailureCount != 1 {
+					t.Errorf("expected rotation error to be recorded without rotation time, got: %+v", rotation)
+				}
+			default:
+				if len(rotation.LastError) != 0 || rotation.LastRotationTime == nil || rotation.FailureCount != 0 {
+					t.Errorf("expected rotation time to be recorded without error, got: %+v", rotation)
+				}
+				if !reflect.DeepEqual(rotation.LastAttemptedObjects, expectedObjects) {
+					t.Errorf("expected last attempted objects: %v, got: %v", expectedObjects, rotation.LastAttemptedObjects)
+				}
+			}
+		})
+	}
+}
+
+func TestRotationSpecChanged(t *testing.T) {
+	dir, targetPath := getTestRotationTargetPath(t, "poduid1", "secrets-store-inline")
+	defer os.RemoveAll(dir)
+	// secret2 was removed from the secret provider class
+	for name, contents := range map[string]string{"secret1": "value1", "removed/secret2": "value2"} {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(targetPath, name)), 0755); err != nil {
+			t.Fatalf("expected err to be nil, got: %+v", err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(targetPath, name), []byte(contents), 0644); err != nil {
+			t.Fatalf("expected err to be nil, got: %+v", err)
+		}
+	}
+
+	objects := testRotationObjects("poduid1", targetPath)
+	objects[0].(*v1alpha1.SecretProviderClass).Generation = 2
+	objects[3].(*v1alpha1.SecretProviderClassPodStatus).Status.SecretProviderClassGeneration = 1
+	ns, err := testNodeServer([]mount.MountPoint{{Path: targetPath}}, fake.NewFakeClientWithScheme(testRotationScheme(), objects...), "")
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	defer os.RemoveAll(ns.providerVolumePath)
+
+	server, err := providerfake.NewMocKCSIProviderServer(filepath.Join(ns.providerVolumePath, "provider1.sock"))
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	server.SetFiles(map[string]string{"secret1": "value1", "secret3": "value3"})
+	server.SetObjects(map[string]string{"secret/secret1": "v1", "secret/secret3": "v1"})
+	server.Start()
+	defer server.Stop()
+
+	r := newRotationReconciler(ns, RotationConfig{Enabled: true, PollInterval: 2 * time.Minute, Jitter: 1})
+	r.random = func() float64 { return 0.5 }
+	defer r.queue.ShutDown()
+	// the volume of the changed secret provider class is queued without delay
+	r.enqueueVolumes()
+	if r.queue.Len() != 1 {
+		t.Fatalf("expected the volume to be queued without delay, got: %d queued volumes", r.queue.Len())
+	}
+	item, _ := r.queue.Get()
+	r.queue.Done(item)
+
+	key := types.NamespacedName{Namespace: "default", Name: "pod1-default-spc1"}
+	if err := r.reconcile(context.TODO(), key); err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	files, err := getMountedFiles(targetPath)
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	sort.Strings(files)
+	expectedFiles := []string{fileutil.DataDir(targetPath), filepath.Join(targetPath, fileutil.DataDirLink), filepath.Join(targetPath, fileutil.DataVersionFile), filepath.Join(targetPath, "secret1"), filepath.Join(targetPath, "secret3")}
+	if !reflect.DeepEqual(files, expectedFiles) {
+		t.Errorf("expected mounted files: %v, got: %v", expectedFiles, files)
+	}
+	if _, err := os.Stat(filepath.Join(targetPath, "removed")); !os.IsNotExist(err) {
+		t.Errorf("expected directory of the removed file to be removed, got: %+v", err)
+	}
+
+	updated := &v1alpha1.SecretProviderClassPodStatus{}
+	if err := ns.client.Get(context.TODO(), key, updated); err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	if updated.Status.SecretProviderClassGeneration != 2 {
+		t.Errorf("expected secret provider class generation: 2, got: %d", updated.Status.SecretProviderClassGeneration)
+	}
+
+	// the volume is rotated with a delay once the contents are remounted
+	r.enqueueVolumes()
+	if r.queue.Len() != 0 {
+		t.Errorf("expected no volume to be queued without delay, got: %d queued volumes", r.queue.Len())
+	}
+}
+
+func TestRotationObjectVersionHistory(t *testing.T) {
+	dir, targetPath := getTestRotationTargetPath(t, "poduid1", "secrets-store-inline")
+	defer os.RemoveAll(dir)
+	// signing.key.1 was kept by a previous rotation
+	for name, contents := range map[string]string{"signing.key": "key1", "signing.key.1": "key0"} {
+		if err := ioutil.WriteFile(filepath.Join(targetPath, name), []byte(contents), 0644); err != nil {
+			t.Fatalf("expected err to be nil, got: %+v", err)
+		}
+	}
+
+	objects := testRotationObjects("poduid1", targetPath)
+	spc := objects[0].(*v1alpha1.SecretProviderClass)
+	spc.Spec.MountedObjects = []*v1alpha1.MountedObject{{ObjectName: "signing.key", ObjectVersionHistory: 2}}
+	// the previous versions aren't removed as stale files when the secret
+	// provider class changed
+	spc.Generation = 2
+	objects[3].(*v1alpha1.SecretProviderClassPodStatus).Status.SecretProviderClassGeneration = 1
+	ns, err := testNodeServer([]mount.MountPoint{{Path: targetPath}}, fake.NewFakeClientWithScheme(testRotationScheme(), objects...), "")
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	defer os.RemoveAll(ns.providerVolumePath)
+
+	server, err := providerfake.NewMocKCSIProviderServer(filepath.Join(ns.providerVolumePath, "provider1.sock"))
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	server.Start()
+	defer server.Stop()
+
+	r := newRotationReconciler(ns, RotationConfig{Enabled: true, PollInterval: 2 * time.Minute})
+	defer r.queue.ShutDown()
+	key := types.NamespacedName{Namespace: "default", Name: "pod1-default-spc1"}
+
+	for _, test := range []struct {
+		version          string
+		expectedContents map[string]string
+	}{
+		{
+			version:          "key2",
+			expectedContents: map[string]string{"signing.key": "key2", "signing.key.1": "key1", "signing.key.2": "key0"},
+		},
+		{
+			// unchanged files don't shift the previous versions
+			version:          "key2",
+			expectedContents: map[string]string{"signing.key": "key2", "signing.key.1": "key1", "signing.key.2": "key0"},
+		},
+		{
+			version:          "key3",
+			expectedContents: map[string]string{"signing.key": "key3", "signing.key.1": "key2", "signing.key.2": "key1"},
+		},
+	} {
+		server.SetFiles(map[string]string{"signing.key": test.version})
+		server.SetObjects(map[string]string{"secret/signing.key": test.version})
+		if err := r.reconcile(context.TODO(), key); err != nil {
+			t.Fatalf("expected err to be nil, got: %+v", err)
+		}
+		files, err := getMountedFiles(targetPath)
+		if err != nil {
+			t.Fatalf("expected err to be nil, got: %+v", err)
+		}
+		if len(files) != len(test.expectedContents)+3 {
+			t.Errorf("expected %d mounted files, the data version file and the data directory, got: %v", len(test.expectedContents), files)
+		}
+		for name, expected := range test.expectedContents {
+			contents, err := ioutil.ReadFile(filepath.Join(targetPath, name))
+			if err != nil {
+				t.Fatalf("expected err to be nil, got: %+v", err)
+			}
+			if string(contents) != expected {
+				t.Errorf("expected contents of %s after rotation to %s: %s, got: %s", name, test.version, expected, string(contents))
+			}
+		}
+	}
+}
+
+func TestRotationMetadata(t *testing.T) {
+	dir, targetPath := getTestRotationTargetPath(t, "poduid1", "secrets-store-inline")
+	defer os.RemoveAll(dir)
+
+	objects := testRotationObjects("poduid1", targetPath)
+	objects[0].(*v1alpha1.SecretProviderClass).Spec.WriteMetadata = true
+	ns, err := testNodeServer([]mount.MountPoint{{Path: targetPath}}, fake.NewFakeClientWithScheme(testRotationScheme(), objects...), "")
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	defer os.RemoveAll(ns.providerVolumePath)
+
+	server, err := providerfake.NewMocKCSIProviderServer(filepath.Join(ns.providerVolumePath, "provider1.sock"))
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	server.SetFiles(map[string]string{"secret1": "value1"})
+	server.Start()
+	defer server.Stop()
+
+	r := newRotationReconciler(ns, RotationConfig{Enabled: true, PollInterval: 2 * time.Minute})
+	defer r.queue.ShutDown()
+	key := types.NamespacedName{Namespace: "default", Name: "pod1-default-spc1"}
+
+	var fetchTime time.Time
+	for _, test := range []struct {
+		name            string
+		version         string
+		expectedRefetch bool
+	}{
+		{name: "first rotation", version: "v1", expectedRefetch: true},
+		// the fetch time is kept while the version doesn't change
+		{name: "same version", version: "v1"},
+		// the metadata are published even though the files didn't change
+		{name: "changed version", version: "v2", expectedRefetch: true},
+	} {
+		server.SetObjects(map[string]string{"secret/secret1": test.version})
+		if err := r.reconcile(context.TODO(), key); err != nil {
+			t.Fatalf("%s: expected err to be nil, got: %+v", test.name, err)
+		}
+		metadata, err := fileutil.ReadMetadata(targetPath)
+		if err != nil {
+			t.Fatalf("%s: expected err to be nil, got: %+v", test.name, err)
+		}
+		if len(metadata.Objects) != 1 || metadata.Objects[0].ID != "secret/secret1" || metadata.Objects[0].Version != test.version {
+			t.Fatalf("%s: expected the metadata of secret/secret1 at version %s, got: %+v", test.name, test.version, metadata.Objects)
+		}
+		if refetched := !metadata.Objects[0].FetchTime.Equal(fetchTime); refetched != test.expectedRefetch {
+			t.Errorf("%s: expected the fetch time to be updated: %t, got fetch time: %v, previous: %v", test.name, test.expectedRefetch, metadata.Objects[0].FetchTime, fetchTime)
+		}
+		fetchTime = metadata.Objects[0].FetchTime
+	}
+}
+
+func TestRotationFileOwnerUnchanged(t *testing.T) {
+	dir, targetPath := getTestRotationTargetPath(t, "poduid1", "secrets-store-inline")
+	defer os.RemoveAll(dir)
+
+	objects := testRotationObjects("poduid1", targetPath)
+	spc := objects[0].(*v1alpha1.SecretProviderClass)
+	// the published files are made readable by the group of the owner, so the
+	// staged files without the group permission must not count as changed
+	gid := int64(os.Getgid())
+	spc.Spec.SecretObjectsOwner = &v1alpha1.FileOwner{GID: &gid}
+	spc.Spec.MountedObjects = []*v1alpha1.MountedObject{{ObjectName: "secret1", FilePermission: "0600"}}
+	ns, err := testNodeServer([]mount.MountPoint{{Path: targetPath}}, fake.NewFakeClientWithScheme(testRotationScheme(), objects...), "")
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	defer os.RemoveAll(ns.providerVolumePath)
+
+	server, err := providerfake.NewMocKCSIProviderServer(filepath.Join(ns.providerVolumePath, "provider1.sock"))
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	server.SetFiles(map[string]string{"secret1": "value1"})
+	server.SetObjects(map[string]string{"secret/secret1": "v1"})
+	server.Start()
+	defer server.Stop()
+
+	r := newRotationReconciler(ns, RotationConfig{Enabled: true, PollInterval: 2 * time.Minute})
+	defer r.queue.ShutDown()
+	key := types.NamespacedName{Namespace: "default", Name: "pod1-default-spc1"}
+
+	if err := r.reconcile(context.TODO(), key); err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	info, err := os.Stat(filepath.Join(targetPath, "secret1"))
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	if info.Mode().Perm() != 0640 {
+		t.Errorf("expected mode of secret1 to be 0640, got: %v", info.Mode().Perm())
+	}
+	dataDir := fileutil.DataDir(targetPath)
+	dataVersion, err := ioutil.ReadFile(filepath.Join(targetPath, fileutil.DataVersionFile))
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+
+	// the contents didn't change, so the data directory isn't republished
+	if err := r.reconcile(context.TODO(), key); err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	if got := fileutil.DataDir(targetPath); got != dataDir {
+		t.Errorf("expected data directory %s to be kept, got: %s", dataDir, got)
+	}
+	got, err := ioutil.ReadFile(filepath.Join(targetPath, fileutil.DataVersionFile))
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	if string(got) != string(dataVersion) {
+		t.Errorf("expected data version %s to be kept, got: %s", dataVersion, got)
+	}
+}
+
+func TestRotationServiceAccountTokens(t *testing.T) {
+	dir, targetPath := getTestRotationTargetPath(t, "poduid1", "secrets-store-inline")
+	defer os.RemoveAll(dir)
+
+	ns, err := testNodeServer([]mount.MountPoint{{Path: targetPath}}, fake.NewFakeClientWithScheme(testRotationScheme(), testRotationObjects("poduid1", targetPath)...), "")
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	defer os.RemoveAll(ns.providerVolumePath)
+
+	server, err := providerfake.NewMocKCSIProviderServer(filepath.Join(ns.providerVolumePath, "provider1.sock"))
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	server.SetFiles(map[string]string{"secret1": "value1"})
+	server.SetObjects(map[string]string{"secret/secret1": "v1"})
+	server.Start()
+	defer server.Stop()
+
+	r := newRotationReconciler(ns, RotationConfig{Enabled: true, PollInterval: 2 * time.Minute})
+	defer r.queue.ShutDown()
+	key := types.NamespacedName{Namespace: "default", Name: "pod1-default-spc1"}
+
+	// the providers are called with the latest tokens of the volume
+	tokens := fmt.Sprintf(`{"vault":{"token":"token1","expirationTimestamp":"%s"}}`, time.Now().Add(time.Hour).UTC().Format(time.RFC3339))
+	if _, err = ns.serviceAccountTokens.set(targetPath, tokens); err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	if err = r.reconcile(context.TODO(), key); err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	var attributes map[string]string
+	if err = json.Unmarshal([]byte(server.Attributes()), &attributes); err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	if attributes[csipodsatokens] != tokens {
+		t.Errorf("expected the service account tokens %s in the attributes, got: %+v", tokens, attributes)
+	}
+
+	// the volume isn't rotated with expired tokens
+	tokens = fmt.Sprintf(`{"vault":{"token":"token1","expirationTimestamp":"%s"}}`, time.Now().Add(-time.Minute).UTC().Format(time.RFC3339))
+	if _, err = ns.serviceAccountTokens.set(targetPath, tokens); err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	if err = r.reconcile(context.TODO(), key); err == nil || !strings.Contains(err.Error(), "expired") {
+		t.Errorf("expected the expired tokens error, got: %+v", err)
+	}
+}
+
+func TestRotationFailureEvents(t *testing.T) {
+	dir, targetPath := getTestRotationTargetPath(t, "poduid1", "secrets-store-inline")
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(targetPath, "secret1"), []byte("value1"), 0644); err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	ns, err := testNodeServer([]mount.MountPoint{{Path: targetPath}}, fake.NewFakeClientWithScheme(testRotationScheme(), testRotationObjects("poduid1", targetPath)...), "")
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	defer os.RemoveAll(ns.providerVolumePath)
+
+	server, err := providerfake.NewMocKCSIProviderServer(filepath.Join(ns.providerVolumePath, "provider1.sock"))
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	server.SetFiles(map[string]string{"secret1": "value2"})
+	server.SetObjects(map[string]string{"secret/secret1": "v2"})
+	server.SetReturnError(fmt.Errorf("secrets store not reachable"))
+	server.Start()
+	defer server.Stop()
+
+	r := newRotationReconciler(ns, RotationConfig{Enabled: true, PollInterval: 2 * time.Minute})
+	defer r.queue.ShutDown()
+	key := types.NamespacedName{Namespace: "default", Name: "pod1-default-spc1"}
+	events := ns.eventRecorder.(*record.FakeRecorder).Events
+
+	// no event is recorded until the rotation failed repeatedly
+	for i := 1; i < rotationFailureEventThreshold; i++ {
+		if err := r.reconcile(context.TODO(), key); err == nil {
+			t.Fatalf("expected err to be not nil")
+		}
+	}
+	select {
+	case event := <-events:
+		t.Fatalf("expected no event to be recorded, got: %s", event)
+	default:
+	}
+
+	if err := r.reconcile(context.TODO(), key); err == nil {
+		t.Fatalf("expected err to be not nil")
+	}
+	select {
+	case event := <-events:
+		if !strings.HasPrefix(event, "Warning FailedToRotate") || !strings.Contains(event, "secrets store not reachable") {
+			t.Errorf("expected FailedToRotate event, got: %s", event)
+		}
+	default:
+		t.Errorf("expected FailedToRotate event to be recorded")
+	}
+
+	// the failure count is reset once the rotation succeeds
+	server.SetReturnError(nil)
+	if err := r.reconcile(context.TODO(), key); err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	updated := &v1alpha1.SecretProviderClassPodStatus{}
+	if err := ns.client.Get(context.TODO(), key, updated); err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	if updated.Status.Rotation == nil || updated.Status.Rotation.FailureCount != 0 {
+		t.Errorf("expected failure count to be reset, got: %+v", updated.Status.Rotation)
+	}
+}
+
+func TestRotationCachedContent(t *testing.T) {
+	dir, targetPath := getTestRotationTargetPath(t, "poduid1", "secrets-store-inline")
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(targetPath, "secret1"), []byte("value1"), 0644); err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	objects := testRotationObjects("poduid1", targetPath)
+	lastRotationTime := metav1.NewTime(time.Now().Add(-10 * time.Minute))
+	objects[3].(*v1alpha1.SecretProviderClassPodStatus).Status.Rotation = &v1alpha1.RotationStatus{LastRotationTime: &lastRotationTime}
+	ns, err := testNodeServer([]mount.MountPoint{{Path: targetPath}}, fake.NewFakeClientWithScheme(testRotationScheme(), objects...), "")
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	defer os.RemoveAll(ns.providerVolumePath)
+	ns.mountCache = newMountCache(time.Hour)
+
+	server, err := providerfake.NewMocKCSIProviderServer(filepath.Join(ns.providerVolumePath, "provider1.sock"))
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	server.SetFiles(map[string]string{"secret1": "value2"})
+	server.SetObjects(map[string]string{"secret/secret1": "v2"})
+	server.SetHealth(false, "backend not reachable")
+	server.Start()
+	defer server.Stop()
+	ns.providerClients.checkHealth()
+
+	r := newRotationReconciler(ns, RotationConfig{Enabled: true, PollInterval: 2 * time.Minute})
+	defer r.queue.ShutDown()
+	key := types.NamespacedName{Namespace: "default", Name: "pod1-default-spc1"}
+	events := ns.eventRecorder.(*record.FakeRecorder).Events
+
+	// the mounted contents are kept with an event while the provider is unavailable
+	if err := r.reconcile(context.TODO(), key); err == nil {
+		t.Fatalf("expected err to be not nil")
+	}
+	select {
+	case event := <-events:
+		if !strings.HasPrefix(event, "Warning CachedContentServed") {
+			t.Errorf("expected CachedContentServed event, got: %s", event)
+		}
+	default:
+		t.Errorf("expected CachedContentServed event to be recorded")
+	}
+	content, err := ioutil.ReadFile(filepath.Join(targetPath, "secret1"))
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	if string(content) != "value1" {
+		t.Errorf("expected mounted file content: value1, got: %s", string(content))
+	}
+
+	// no event is recorded once the mounted contents are older than the
+	// maximum cached content age
+	ns.mountCache = newMountCache(5 * time.Minute)
+	if err := r.reconcile(context.TODO(), key); err == nil {
+		t.Fatalf("expected err to be not nil")
+	}
+	select {
+	case event := <-events:
+		t.Errorf("expected no event to be recorded, got: %s", event)
+	default:
+	}
+}
+
+func TestRotationRestartPolicy(t *testing.T) {
+	cases := []struct {
+		name             string
+		restartPolicy    v1alpha1.RestartPolicy
+		providerContents string
+		restartPending   bool
+		evictErr         error
+		expectedAnnotate bool
+		expectedEvict    bool
+		expectedPending  bool
+	}{
+		{
+			name:          "pod not restarted without restart policy",
+			restartPolicy: v1alpha1.RestartPolicyNone,
+		},
+		{
+			name:             "pod annotated",
+			restartPolicy:    v1alpha1.RestartPolicyAnnotate,
+			expectedAnnotate: true,
+		},
+		{
+			name:          "pod evicted",
+			restartPolicy: v1alpha1.RestartPolicyEvict,
+			expectedEvict: true,
+		},
+		{
+			name:             "pod not restarted if the contents didn't change",
+			restartPolicy:    v1alpha1.RestartPolicyEvict,
+			providerContents: "value1",
+		},
+		{
+			name:            "eviction blocked by a pod disruption budget",
+			restartPolicy:   v1alpha1.RestartPolicyEvict,
+			evictErr:        apierrors.NewTooManyRequests("cannot evict pod as it would violate the pod's disruption budget", 10),
+			expectedEvict:   true,
+			expectedPending: true,
+		},
+		{
+			name:             "pending restart retried",
+			restartPolicy:    v1alpha1.RestartPolicyEvict,
+			providerContents: "value1",
+			restartPending:   true,
+			expectedEvict:    true,
+		},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			dir, targetPath := getTestRotationTargetPath(t, "poduid1", "secrets-store-inline")
+			defer os.RemoveAll(dir)
+			if err := ioutil.WriteFile(filepath.Join(targetPath, "secret1"), []byte("value1"), 0644); err != nil {
+				t.Fatalf("expected err to be nil, got: %+v", err)
+			}
+			objects := testRotationObjects("poduid1", targetPath)
+			objects[0].(*v1alpha1.SecretProviderClass).Spec.RestartPolicy = test.restartPolicy
+			if test.restartPending {
+				objects[3].(*v1alpha1.SecretProviderClassPodStatus).Status.Rotation = &v1alpha1.RotationStatus{RestartPending: true}
+			}
+			ns, err := testNodeServer([]mount.MountPoint{{Path: targetPath}}, fake.NewFakeClientWithScheme(testRotationScheme(), objects...), "")
+			if err != nil {
+				t.Fatalf("expected err to be nil, got: %+v", err)
+			}
+			defer os.RemoveAll(ns.providerVolumePath)
+			kubeClient := kubefake.NewSimpleClientset()
+			kubeClient.PrependReactor("create", "pods", func(action clienttesting.Action) (bool, runtime.Object, error) {
+				return action.GetSubresource() == "eviction", nil, test.evictErr
+			})
+			ns.kubeClient = kubeClient
+
+			server, err := providerfake.NewMocKCSIProviderServer(filepath.Join(ns.providerVolumePath, "provider1.sock"))
+			if err != nil {
+				t.Fatalf("expected err to be nil, got: %+v", err)
+			}
+			providerContents := test.providerContents
+			if len(providerContents) == 0 {
+				providerContents = "value2"
+			}
+			server.SetFiles(map[string]string{"secret1": providerContents})
+			server.SetObjects(map[string]string{"secret/secret1": "v2"})
+			server.Start()
+			defer server.Stop()
+
+			r := newRotationReconciler(ns, RotationConfig{Enabled: true, PollInterval: 2 * time.Minute})
+			defer r.queue.ShutDown()
+			key := types.NamespacedName{Namespace: "default", Name: "pod1-default-spc1"}
+			// failing to restart the pod doesn't fail the rotation
+			if err := r.reconcile(context.TODO(), key); err != nil {
+				t.Fatalf("expected err to be nil, got: %+v", err)
+			}
+
+			pod := &corev1.Pod{}
+			if err := ns.client.Get(context.TODO(), types.NamespacedName{Namespace: "default", Name: "pod1"}, pod); err != nil {
+				t.Fatalf("expected err to be nil, got: %+v", err)
+			}
+			if _, annotated := pod.Annotations[v1alpha1.RotatedAtAnnotation]; annotated != test.expectedAnnotate {
+				t.Errorf("expected pod annotated: %v, got annotations: %v", test.expectedAnnotate, pod.Annotations)
+			}
+			evicted := false
+			for _, action := range kubeClient.Actions() {
+				if action.Matches("create", "pods") && action.GetSubresource() == "eviction" {
+					evicted = true
+					// the pod recreated with the same name isn't evicted
+					eviction := action.(clienttesting.CreateAction).GetObject().(*policyv1beta1.Eviction)
+					if eviction.DeleteOptions == nil || eviction.DeleteOptions.Preconditions == nil || eviction.DeleteOptions.Preconditions.UID == nil || *eviction.DeleteOptions.Preconditions.UID != pod.UID {
+						t.Errorf("expected eviction with uid precondition %s, got: %+v", pod.UID, eviction.DeleteOptions)
+					}
+				}
+			}
+			if evicted != test.expectedEvict {
+				t.Errorf("expected pod evicted: %v, got: %v", test.expectedEvict, evicted)
+			}
+
+			updated := &v1alpha1.SecretProviderClassPodStatus{}
+			if err := ns.client.Get(context.TODO(), key, updated); err != nil {
+				t.Fatalf("expected err to be nil, got: %+v", err)
+			}
+			if updated.Status.Rotation == nil || updated.Status.Rotation.RestartPending != test.expectedPending || updated.Status.Rotation.FailureCount != 0 {
+				t.Errorf("expected restart pending: %v without failure, got: %+v", test.expectedPending, updated.Status.Rotation)
+			}
+			if test.expectedPending {
+				select {
+				case event := <-ns.eventRecorder.(*record.FakeRecorder).Events:
+					if !strings.HasPrefix(event, "Warning FailedToRestart") {
+						t.Errorf("expected FailedToRestart event, got: %s", event)
+					}
+				default:
+					t.Errorf("expected FailedToRestart event to be recorded")
+				}
+			}
+		})
+	}
+}
+
+func TestRotationDryRun(t *testing.T) {
+	cases := []struct {
+		name             string
+		providerContents string
+		providerVersion  string
+		expectedChanges  []string
+	}{
+		{
+			name:             "dry run reports the changes",
+			providerContents: "value2",
+			providerVersion:  "v2",
+			expectedChanges:  []string{"object secret/secret1", "file secret1", "secret synced1"},
+		},
+		{
+			name:             "dry run without changes",
+			providerContents: "value1",
+			providerVersion:  "v1",
+		},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			dir, targetPath := getTestRotationTargetPath(t, "poduid1", "secrets-store-inline")
+			defer os.RemoveAll(dir)
+			if err := ioutil.WriteFile(filepath.Join(targetPath, "secret1"), []byte("value1"), 0644); err != nil {
+				t.Fatalf("expected err to be nil, got: %+v", err)
+			}
+			objects := testRotationObjects("poduid1", targetPath)
+			objects[0].(*v1alpha1.SecretProviderClass).Spec.SecretObjects = []*v1alpha1.SecretObject{
+				{SecretName: "synced1", Type: "Opaque", Data: []*v1alpha1.SecretObjectData{{ObjectName: "secret1", Key: "key1"}}},
+			}
+			objects = append(objects, &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "synced1", Namespace: "default"},
+				Data:       map[string][]byte{"key1": []byte("value1")},
+			})
+			ns, err := testNodeServer([]mount.MountPoint{{Path: targetPath}}, fake.NewFakeClientWithScheme(testRotationScheme(), objects...), "")
+			if err != nil {
+				t.Fatalf("expected err to be nil, got: %+v", err)
+			}
+			defer os.RemoveAll(ns.providerVolumePath)
+
+			server, err := providerfake.NewMocKCSIProviderServer(filepath.Join(ns.providerVolumePath, "provider1.sock"))
+			if err != nil {
+				t.Fatalf("expected err to be nil, got: %+v", err)
+			}
+			server.SetFiles(map[string]string{"secret1": test.providerContents})
+			server.SetObjects(map[string]string{"secret/secret1": test.providerVersion})
+			server.Start()
+			defer server.Stop()
+
+			r := newRotationReconciler(ns, RotationConfig{Enabled: true, PollInterval: 2 * time.Minute, DryRun: true})
+			defer r.queue.ShutDown()
+			key := types.NamespacedName{Namespace: "default", Name: "pod1-default-spc1"}
+			if err := r.reconcile(context.TODO(), key); err != nil {
+				t.Fatalf("expected err to be nil, got: %+v", err)
+			}
+
+			// the mounted contents and synced secrets aren't updated
+			contents, err := ioutil.ReadFile(filepath.Join(targetPath, "secret1"))
+			if err != nil {
+				t.Fatalf("expected err to be nil, got: %+v", err)
+			}
+			if string(contents) != "value1" {
+				t.Errorf("expected contents: value1, got: %s", string(contents))
+			}
+			if _, err := os.Stat(filepath.Join(targetPath, fileutil.DataVersionFile)); !os.IsNotExist(err) {
+				t.Errorf("expected data version file not to be written, got: %+v", err)
+			}
+			synced := &corev1.Secret{}
+			if err := ns.client.Get(context.TODO(), types.NamespacedName{Namespace: "default", Name: "synced1"}, synced); err != nil {
+				t.Fatalf("expected err to be nil, got: %+v", err)
+			}
+			if string(synced.Data["key1"]) != "value1" {
+				t.Errorf("expected synced secret contents: value1, got: %s", string(synced.Data["key1"]))
+			}
+
+			updated := &v1alpha1.SecretProviderClassPodStatus{}
+			if err := ns.client.Get(context.TODO(), key, updated); err != nil {
+				t.Fatalf("expected err to be nil, got: %+v", err)
+			}
+			expectedObjects := []v1alpha1.SecretProviderClassObject{{ID: "secret/secret1", Version: "v1"}}
+			if !reflect.DeepEqual(updated.Status.Objects, expectedObjects) {
+				t.Errorf("expected objects: %v, got: %v", expectedObjects, updated.Status.Objects)
+			}
+			rotation := updated.Status.Rotation
+			if rotation == nil || rotation.LastRotationTime != nil || len(rotation.LastError) != 0 {
+				t.Fatalf("expected rotation attempt to be recorded without rotation time, got: %+v", rotation)
+			}
+			if !reflect.DeepEqual(rotation.DryRunChanges, test.expectedChanges) {
+				t.Errorf("expected dry run changes: %v, got: %v", test.expectedChanges, rotation.DryRunChanges)
+			}
+
+			select {
+			case event := <-ns.eventRecorder.(*record.FakeRecorder).Events:
+				if len(test.expectedChanges) == 0 {
+					t.Errorf("expected no event to be recorded, got: %s", event)
+				} else if !strings.HasPrefix(event, "Normal RotationDryRun") || !strings.Contains(event, strings.Join(test.expectedChanges, ", ")) {
+					t.Errorf("expected RotationDryRun event with the changes, got: %s", event)
+				}
+			default:
+				if len(test.expectedChanges) > 0 {
+					t.Errorf("expected RotationDryRun event to be recorded")
+				}
+			}
+		})
+	}
+}
+
+func TestRotationRateLimit(t *testing.T) {
+	dir, targetPath := getTestRotationTargetPath(t, "poduid1", "secrets-store-inline")
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(targetPath, "secret1"), []byte("value1"), 0644); err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	ns, err := testNodeServer([]mount.MountPoint{{Path: targetPath}}, fake.NewFakeClientWithScheme(testRotationScheme(), testRotationObjects("poduid1", targetPath)...), "")
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	defer os.RemoveAll(ns.providerVolumePath)
+
+	server, err := providerfake.NewMocKCSIProviderServer(filepath.Join(ns.providerVolumePath, "provider1.sock"))
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	server.SetFiles(map[string]string{"secret1": "value2"})
+	server.SetObjects(map[string]string{"secret/secret1": "v2"})
+	server.Start()
+	defer server.Stop()
+
+	// the burst allows a single provider call an hour
+	r := newRotationReconciler(ns, RotationConfig{Enabled: true, PollInterval: 2 * time.Minute, RateLimit: 1.0 / 3600, RateBurst: 1})
+	defer r.queue.ShutDown()
+	key := types.NamespacedName{Namespace: "default", Name: "pod1-default-spc1"}
+	if err := r.reconcile(context.TODO(), key); err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.TODO(), 100*time.Millisecond)
+	defer cancel()
+	if err := r.reconcile(ctx, key); err == nil {
+		t.Fatalf("expected err to be not nil")
+	}
+	updated := &v1alpha1.SecretProviderClassPodStatus{}
+	if err := ns.client.Get(context.TODO(), key, updated); err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	if updated.Status.Rotation == nil || !strings.Contains(updated.Status.Rotation.LastError, "rate limit") {
+		t.Errorf("expected rate limit error to be recorded, got: %+v", updated.Status.Rotation)
+	}
+}
+
+func TestRotationWatch(t *testing.T) {
+	dir, targetPath := getTestRotationTargetPath(t, "poduid1", "secrets-store-inline")
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(targetPath, "secret1"), []byte("value1"), 0644); err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	ns, err := testNodeServer([]mount.MountPoint{{Path: targetPath}}, fake.NewFakeClientWithScheme(testRotationScheme(), testRotationObjects("poduid1", targetPath)...), "")
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	defer os.RemoveAll(ns.providerVolumePath)
+
+	server, err := providerfake.NewMocKCSIProviderServer(filepath.Join(ns.providerVolumePath, "provider1.sock"))
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	server.SetFiles(map[string]string{"secret1": "value2"})
+	server.SetObjects(map[string]string{"secret/secret1": "v2"})
+	server.SetCapabilities(providerv1alpha1.Capability_OBJECT_VERSIONING, providerv1alpha1.Capability_WATCH)
+	server.SetWatch()
+	server.Start()
+	defer server.Stop()
+
+	r := newRotationReconciler(ns, RotationConfig{Enabled: true, PollInterval: 2 * time.Minute})
+	defer r.queue.ShutDown()
+	defer r.stopWatches(nil)
+	key := types.NamespacedName{Namespace: "default", Name: "pod1-default-spc1"}
+	if err := r.reconcile(context.TODO(), key); err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	r.watchLock.Lock()
+	_, watched := r.watches[key]
+	r.watchLock.Unlock()
+	if !watched {
+		t.Fatalf("expected volume %s to be watched", key)
+	}
+
+	// the volume is rotated as soon as the provider reports a change
+	server.SendWatchEvent(map[string]string{"secret/secret1": "v3"})
+	queued := make(chan interface{})
+	go func() {
+		item, _ := r.queue.Get()
+		queued <- item
+	}()
+	select {
+	case item := <-queued:
+		if item != key {
+			t.Errorf("expected queued volume: %v, got: %v", key, item)
+		}
+		r.queue.Done(item)
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected volume %s to be queued after the watch event", key)
+	}
+
+	// the watch stream is closed once the volume is no longer mounted
+	spcPodStatus := &v1alpha1.SecretProviderClassPodStatus{}
+	if err := ns.client.Get(context.TODO(), key, spcPodStatus); err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	if err := ns.client.Delete(context.TODO(), spcPodStatus); err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	r.enqueueVolumes()
+	r.watchLock.Lock()
+	watches := len(r.watches)
+	r.watchLock.Unlock()
+	if watches != 0 {
+		t.Errorf("expected watch streams to be closed, got: %d", watches)
+	}
+}
+
+func TestRotationNodePublishSecrets(t *testing.T) {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "pod1", Namespace: "default"},
+		Spec: corev1.PodSpec{
+			Volumes: []corev1.Volume{
+				{
+					Name: "other-volume",
+					VolumeSource: corev1.VolumeSource{
+						CSI: &corev1.CSIVolumeSource{NodePublishSecretRef: &corev1.LocalObjectReference{Name: "other-creds"}},
+					},
+				},
+				{
+					Name: "secrets-store-inline",
+					VolumeSource: corev1.VolumeSource{
+						CSI: &corev1.CSIVolumeSource{NodePublishSecretRef: &corev1.LocalObjectReference{Name: "secrets-store-creds"}},
+					},
+				},
+			},
+		},
+	}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "secrets-store-creds", Namespace: "default"},
+		Data:       map[string][]byte{"clientid": []byte("id1"), "clientsecret": []byte("secret1")},
+	}
+	ns, err := testNodeServer(nil, fake.NewFakeClientWithScheme(testRotationScheme(), secret), "")
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	defer os.RemoveAll(ns.providerVolumePath)
+
+	r := newRotationReconciler(ns, RotationConfig{})
+	defer r.queue.ShutDown()
+	secrets, err := r.nodePublishSecrets(context.TODO(), pod, "/var/lib/kubelet/pods/poduid1/volumes/kubernetes.io~csi/secrets-store-inline/mount")
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	expected := map[string]string{"clientid": "id1", "clientsecret": "secret1"}
+	if !reflect.DeepEqual(secrets, expected) {
+		t.Errorf("expected secrets: %v, got: %v", expected, secrets)
+	}
+}
+
+func TestRotationNodePublishSecretsPersistentVolume(t *testing.T) {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "pod1", Namespace: "default"},
+		Spec: corev1.PodSpec{
+			Volumes: []corev1.Volume{
+				{
+					Name: "secrets-store",
+					VolumeSource: corev1.VolumeSource{
+						PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: "secrets-store-pvc", ReadOnly: true},
+					},
+				},
+			},
+		},
+	}
+	// the node publish secret of a persistent volume can be in another
+	// namespace than the pod
+	pv := &corev1.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{Name: "secrets-store-pv"},
+		Spec: corev1.PersistentVolumeSpec{
+			PersistentVolumeSource: corev1.PersistentVolumeSource{
+				CSI: &corev1.CSIPersistentVolumeSource{
+					Driver:               "secrets-store.csi.k8s.io",
+					VolumeHandle:         "secrets-store-pv",
+					NodePublishSecretRef: &corev1.SecretReference{Name: "secrets-store-creds", Namespace: "secrets"},
+				},
+			},
+		},
+	}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "secrets-store-creds", Namespace: "secrets"},
+		Data:       map[string][]byte{"clientid": []byte("id1")},
+	}
+	ns, err := testNodeServer(nil, fake.NewFakeClientWithScheme(testRotationScheme(), pv, secret), "")
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	defer os.RemoveAll(ns.providerVolumePath)
+
+	r := newRotationReconciler(ns, RotationConfig{})
+	defer r.queue.ShutDown()
+	secrets, err := r.nodePublishSecrets(context.TODO(), pod, "/var/lib/kubelet/pods/poduid1/volumes/kubernetes.io~csi/secrets-store-pv/mount")
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	expected := map[string]string{"clientid": "id1"}
+	if !reflect.DeepEqual(secrets, expected) {
+		t.Errorf("expected secrets: %v, got: %v", expected, secrets)
+	}
+}
+
+func TestMetadataChanged(t *testing.T) {
+	cases := []struct {
+		name            string
+		labels          map[string]string
+		annotations     map[string]string
+		secretObj       *v1alpha1.SecretObject
+		expectedChanged bool
+	}{
+		{
+			name:      "no labels and annotations",
+			labels:    map[string]string{"team": "a"},
+			secretObj: &v1alpha1.SecretObject{},
+		},
+		{
+			name:   "labels and annotations added",
+			labels: map[string]string{"app": "foo"},
+			secretObj: &v1alpha1.SecretObject{
+				Labels:      map[string]string{"team": "a"},
+				Annotations: map[string]string{"reloader.stakater.com/match": "true"},
+			},
+			expectedChanged: true,
+		},
+		{
+			name:        "labels and annotations unchanged",
+			labels:      map[string]string{"team": "a", "app": "foo"},
+			annotations: map[string]string{"argocd.argoproj.io/compare-options": "IgnoreExtraneous"},
+			secretObj: &v1alpha1.SecretObject{
+				Labels:      map[string]string{"team": "a"},
+				Annotations: map[string]string{"argocd.argoproj.io/compare-options": "IgnoreExtraneous"},
+			},
+		},
+		{
+			name:   "label value updated",
+			labels: map[string]string{"team": "a"},
+			secretObj: &v1alpha1.SecretObject{
+				Labels: map[string]string{"team": "b"},
+			},
+			expectedChanged: true,
+		},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			meta := metav1.ObjectMeta{Labels: test.labels, Annotations: test.annotations}
+			if changed := metadataChanged(meta, test.secretObj.Labels, test.secretObj.Annotations); changed != test.expectedChanged {
+				t.Errorf("expected changed: %v, got: %v", test.expectedChanged, changed)
+			}
+		})
+	}
+}
+
+func TestDataChanged(t *testing.T) {
+	cases := []struct {
+		name            string
+		current         map[string][]byte
+		data            map[string][]byte
+		expectedChanged bool
+	}{
+		{
+			name:    "keys unchanged",
+			current: map[string][]byte{"username": []byte("admin")},
+			data:    map[string][]byte{"username": []byte("admin")},
+		},
+		{
+			name:    "keys not synced are ignored",
+			current: map[string][]byte{"username": []byte("admin"), "extra": []byte("value")},
+			data:    map[string][]byte{"username": []byte("admin")},
+		},
+		{
+			name:            "key updated",
+			current:         map[string][]byte{"username": []byte("admin")},
+			data:            map[string][]byte{"username": []byte("root")},
+			expectedChanged: true,
+		},
+		{
+			name:            "key added",
+			current:         map[string][]byte{"username": []byte("admin")},
+			data:            map[string][]byte{"username": []byte("admin"), "password": []byte("secret")},
+			expectedChanged: true,
+		},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			if changed := dataChanged(test.current, test.data); changed != test.expectedChanged {
+				t.Errorf("expected changed: %v, got: %v", test.expectedChanged, changed)
+			}
+		})
+	}
+}
+
+func TestSecretChanged(t *testing.T) {
+	data := map[string][]byte{"username": []byte("admin")}
+	hash := controllers.SecretDataHash(data)
+	secretObj := &v1alpha1.SecretObject{Labels: map[string]string{"team": "a"}}
+
+	cases := []struct {
+		name            string
+		secret          *corev1.Secret
+		expectedChanged bool
+	}{
+		{
+			name: "secret unchanged",
+			secret: &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"team": "a"}, Annotations: map[string]string{v1alpha1.ContentHashAnnotation: hash}},
+				Data:       data,
+			},
+		},
+		{
+			name: "content hash missing",
+			secret: &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"team": "a"}},
+				Data:       data,
+			},
+			expectedChanged: true,
+		},
+		{
+			name: "synced keys drifted",
+			secret: &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"team": "a"}, Annotations: map[string]string{v1alpha1.ContentHashAnnotation: hash}},
+				Data:       map[string][]byte{"username": []byte("root")},
+			},
+			expectedChanged: true,
+		},
+		{
+			name: "label changed",
+			secret: &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{v1alpha1.ContentHashAnnotation: hash}},
+				Data:       data,
+			},
+			expectedChanged: true,
+		},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			if changed := secretChanged(test.secret, secretObj, data); changed != test.expectedChanged {
+				t.Errorf("expected changed: %v, got: %v", test.expectedChanged, changed)
+			}
+		})
+	}
+}
+
+func TestRotationSyncConfigMaps(t *testing.T) {
+	spc := &v1alpha1.SecretProviderClass{
+		ObjectMeta: metav1.ObjectMeta{Name: "spc1", Namespace: "default"},
+		Spec: v1alpha1.SecretProviderClassSpec{
+			ConfigMapObjects: []*v1alpha1.ConfigMapObject{
+				{ConfigMapName: "config1", Labels: map[string]string{"team": "a"}, Data: []*v1alpha1.SecretObjectData{{ObjectName: "object1", Key: "key1"}}},
+				{ConfigMapName: "notcreated", Data: []*v1alpha1.SecretObjectData{{ObjectName: "object1", Key: "key1"}}},
+			},
+		},
+	}
+	configMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "config1", Namespace: "default"},
+		Data:       map[string]string{"key1": "value1"},
+	}
+	ns, err := testNodeServer(nil, fake.NewFakeClientWithScheme(testRotationScheme(), spc, configMap), "")
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	defer os.RemoveAll(ns.providerVolumePath)
+	r := newRotationReconciler(ns, RotationConfig{Enabled: true, PollInterval: 2 * time.Minute})
+	defer r.queue.ShutDown()
+
+	if _, err := r.syncConfigMaps(context.TODO(), spc, map[string][]byte{"object1": []byte("value2")}); err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	synced := &corev1.ConfigMap{}
+	if err := ns.client.Get(context.TODO(), types.NamespacedName{Namespace: "default", Name: "config1"}, synced); err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	if synced.Data["key1"] != "value2" {
+		t.Errorf("expected synced configmap contents: value2, got: %s", synced.Data["key1"])
+	}
+	if synced.Labels["team"] != "a" {
+		t.Errorf("expected synced configmap label team: a, got: %v", synced.Labels)
+	}
+	if err := ns.client.Get(context.TODO(), types.NamespacedName{Namespace: "default", Name: "notcreated"}, &corev1.ConfigMap{}); !apierrors.IsNotFound(err) {
+		t.Errorf("expected configmap not to be created, got: %+v", err)
+	}
+
+	if _, err := r.syncConfigMaps(context.TODO(), spc, map[string][]byte{}); err == nil {
+		t.Errorf("expected err for missing object, got nil")
+	}
+}
@@ -0,0 +1,156 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package secretsstore
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/net/context"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"sigs.k8s.io/secrets-store-csi-driver/apis/v1alpha1"
+)
+
+// rotationTriggerPath is the path of the http endpoint that triggers the
+// rotation of the volumes mounted on the node
+const rotationTriggerPath = "/rotate"
+
+// unixSocketPrefix is the prefix of the trigger addresses of unix sockets
+const unixSocketPrefix = "unix://"
+
+// validateTriggerAddr returns an error if the rotation trigger address isn't
+// a loopback address or a unix socket. The endpoint isn't authenticated and
+// the node plugin runs with the host network, so any pod that can reach the
+// node could trigger the rotation of any namespace on the other addresses.
+func validateTriggerAddr(addr string) error {
+	if strings.HasPrefix(addr, unixSocketPrefix) {
+		if len(strings.TrimPrefix(addr, unixSocketPrefix)) == 0 {
+			return fmt.Errorf("rotation trigger address %s has no socket path", addr)
+		}
+		return nil
+	}
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("invalid rotation trigger address %s, err: %v", addr, err)
+	}
+	if host == "localhost" {
+		return nil
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+		return nil
+	}
+	return fmt.Errorf("rotation trigger address %s must be a loopback address or a %s socket, as the endpoint isn't authenticated", addr, unixSocketPrefix)
+}
+
+// listenTrigger returns the listener of the rotation trigger address. A stale
+// unix socket of a previous driver process is removed.
+func listenTrigger(addr string) (net.Listener, error) {
+	if strings.HasPrefix(addr, unixSocketPrefix) {
+		socket := strings.TrimPrefix(addr, unixSocketPrefix)
+		if err := os.Remove(socket); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		return net.Listen("unix", socket)
+	}
+	return net.Listen("tcp", addr)
+}
+
+// serveTrigger serves the rotation trigger endpoint on the trigger address
+// until the stop channel is closed
+func (r *rotationReconciler) serveTrigger(stopCh <-chan struct{}) {
+	listener, err := listenTrigger(r.config.TriggerAddr)
+	if err != nil {
+		log.Errorf("failed to serve rotation trigger on %s, err: %+v", r.config.TriggerAddr, err)
+		return
+	}
+	mux := http.NewServeMux()
+	mux.Handle(rotationTriggerPath, r)
+	server := &http.Server{Handler: mux}
+	go func() {
+		<-stopCh
+		server.Close()
+	}()
+	log.Infof("serving rotation trigger on %s%s", r.config.TriggerAddr, rotationTriggerPath)
+	if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+		log.Errorf("failed to serve rotation trigger on %s, err: %+v", r.config.TriggerAddr, err)
+	}
+}
+
+// ServeHTTP adds the volumes of the pod or secret provider class in the
+// namespace of the request to the rotation queue without delay, e.g. to push
+// a revoked credential to the pods without waiting for the next poll. POST
+// /rotate?namespace=<namespace>[&pod=<pod>][&secretProviderClass=<spc>]
+// rotates all volumes in the namespace that match the pod and secret provider
+// class.
+func (r *rotationReconciler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, fmt.Sprintf("method %s not allowed", req.Method), http.StatusMethodNotAllowed)
+		return
+	}
+	query := req.URL.Query()
+	namespace := query.Get("namespace")
+	if len(namespace) == 0 {
+		http.Error(w, "missing namespace", http.StatusBadRequest)
+		return
+	}
+	keys, err := r.triggerVolumes(req.Context(), namespace, query.Get("pod"), query.Get("secretProviderClass"))
+	if err != nil {
+		log.Errorf("failed to trigger rotation in namespace %s, err: %+v", namespace, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(keys) == 0 {
+		http.Error(w, fmt.Sprintf("no volumes found in namespace %s", namespace), http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+	for _, key := range keys {
+		fmt.Fprintln(w, key)
+	}
+}
+
+// triggerVolumes adds the secret provider class pod statuses of the node in
+// the namespace that match the pod and secret provider class to the rotation
+// queue and returns their keys. Empty names match all pods and secret provider
+// classes.
+func (r *rotationReconciler) triggerVolumes(ctx context.Context, namespace, podName, spcName string) ([]types.NamespacedName, error) {
+	spcPodStatuses := &v1alpha1.SecretProviderClassPodStatusList{}
+	if err := r.ns.client.List(ctx, spcPodStatuses, client.InNamespace(namespace), client.MatchingLabels{v1alpha1.InternalNodeLabel: r.ns.nodeID}); err != nil {
+		return nil, fmt.Errorf("failed to list secret provider class pod statuses, err: %+v", err)
+	}
+	var keys []types.NamespacedName
+	for _, spcPodStatus := range spcPodStatuses.Items {
+		if len(podName) > 0 && spcPodStatus.Status.PodName != podName {
+			continue
+		}
+		if len(spcName) > 0 && spcPodStatus.Status.SecretProviderClassName != spcName {
+			continue
+		}
+		key := types.NamespacedName{Namespace: spcPodStatus.Namespace, Name: spcPodStatus.Name}
+		log.Infof("rotation of %s triggered", key)
+		r.queue.Add(key)
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
@@ -0,0 +1,139 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package secretsstore
+
+import (
+	"context"
+	"io"
+	"sort"
+
+	"github.com/golang/protobuf/proto"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/apimachinery/pkg/types"
+
+	"sigs.k8s.io/secrets-store-csi-driver/provider/v1alpha1"
+)
+
+// volumeWatch is an open watch stream of the changes of the objects mounted
+// in a volume
+type volumeWatch struct {
+	// request is the watch request of the stream
+	request *v1alpha1.WatchRequest
+	cancel  context.CancelFunc
+}
+
+// watchVolume opens a watch stream to the provider for the volume if the
+// volume isn't watched yet. The stream is opened again if the mount request
+// changed, e.g. when the parameters of the secret provider class are updated.
+func (r *rotationReconciler) watchVolume(key types.NamespacedName, providerName, attributes, secrets, targetPath, permission string, objectVersions map[string]string) {
+	req := &v1alpha1.WatchRequest{
+		MountRequest: &v1alpha1.MountRequest{
+			Attributes: attributes,
+			Secrets:    secrets,
+			TargetPath: targetPath,
+			Permission: permission,
+		},
+	}
+	for id, version := range objectVersions {
+		req.ObjectVersion = append(req.ObjectVersion, &v1alpha1.ObjectVersion{Id: id, Version: version})
+	}
+	sort.Slice(req.ObjectVersion, func(i, j int) bool { return req.ObjectVersion[i].Id < req.ObjectVersion[j].Id })
+
+	r.watchLock.Lock()
+	defer r.watchLock.Unlock()
+	if w, ok := r.watches[key]; ok {
+		if proto.Equal(w.request.GetMountRequest(), req.GetMountRequest()) {
+			return
+		}
+		w.cancel()
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	w := &volumeWatch{request: req, cancel: cancel}
+	r.watches[key] = w
+	go r.watch(ctx, key, providerName, w)
+}
+
+// watch adds the volume to the rotation queue every time the provider reports
+// a change of the mounted objects, until the stream is closed
+func (r *rotationReconciler) watch(ctx context.Context, key types.NamespacedName, providerName string, w *volumeWatch) {
+	defer r.removeWatch(key, w)
+	client, err := r.ns.providerClients.Get(ctx, providerName)
+	if err != nil {
+		log.Errorf("failed to get provider %s to watch %s, err: %+v", providerName, key, err)
+		return
+	}
+	stream, err := client.Watch(ctx, w.request)
+	if err != nil {
+		log.Errorf("failed to watch %s with provider %s, err: %+v", key, providerName, err)
+		return
+	}
+	log.Debugf("watching %s with provider %s", key, providerName)
+	for {
+		resp, err := stream.Recv()
+		if err != nil {
+			switch {
+			case ctx.Err() != nil:
+			case err == io.EOF:
+				log.Debugf("provider %s closed the watch stream of %s", providerName, key)
+			case status.Code(err) == codes.Unimplemented:
+				log.Warningf("provider %s advertises the watch capability but doesn't implement the Watch RPC", providerName)
+			default:
+				log.Errorf("failed to watch %s with provider %s, err: %+v", key, providerName, err)
+			}
+			return
+		}
+		log.Infof("provider %s reported %d changed objects for %s, rotating mounted contents", providerName, len(resp.GetObjectVersion()), key)
+		r.queue.Add(key)
+	}
+}
+
+// stopWatch closes the watch stream of the volume
+func (r *rotationReconciler) stopWatch(key types.NamespacedName) {
+	r.watchLock.Lock()
+	defer r.watchLock.Unlock()
+	if w, ok := r.watches[key]; ok {
+		w.cancel()
+		delete(r.watches, key)
+	}
+}
+
+// stopWatches closes the watch streams of all volumes that aren't in the
+// volumes to keep
+func (r *rotationReconciler) stopWatches(keep map[types.NamespacedName]bool) {
+	r.watchLock.Lock()
+	defer r.watchLock.Unlock()
+	for key, w := range r.watches {
+		if keep[key] {
+			continue
+		}
+		w.cancel()
+		delete(r.watches, key)
+	}
+}
+
+// removeWatch removes the closed watch stream of the volume, unless the
+// stream was already replaced by a new stream
+func (r *rotationReconciler) removeWatch(key types.NamespacedName, w *volumeWatch) {
+	r.watchLock.Lock()
+	defer r.watchLock.Unlock()
+	if r.watches[key] == w {
+		w.cancel()
+		delete(r.watches, key)
+	}
+}
@@ -17,14 +17,20 @@ limitations under the License.
 package secretsstore
 
 import (
+	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/container-storage-interface/spec/lib/go/csi"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/utils/mount"
 
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	csicommon "sigs.k8s.io/secrets-store-csi-driver/pkg/csi-common"
 	"sigs.k8s.io/secrets-store-csi-driver/pkg/metrics"
+	"sigs.k8s.io/secrets-store-csi-driver/pkg/sandbox"
 	version "sigs.k8s.io/secrets-store-csi-driver/pkg/version"
 
 	log "github.com/sirupsen/logrus"
@@ -43,19 +49,80 @@ var (
 	vendorVersion = "0.0.13"
 )
 
+// Config is the configuration of the driver
+type Config struct {
+	// DriverName is the name of the CSI driver
+	DriverName string
+	// NodeID is the name of the node the driver runs on
+	NodeID string
+	// Endpoint is the CSI endpoint the driver serves
+	Endpoint string
+	// ProviderVolumePath is the directory of the provider binaries and sockets
+	ProviderVolumePath string
+	// KubeletRootDir is the root directory of the kubelet, the orphaned target
+	// paths under it are cleaned up on start if set
+	KubeletRootDir string
+	// MinProviderVersions are the minimum compatible versions of the providers
+	MinProviderVersions string
+	// GRPCSupportedProviders are the providers called over gRPC. Deprecated,
+	// the providers with a socket are discovered automatically.
+	GRPCSupportedProviders string
+	// ProviderClients builds the gRPC clients of the providers
+	ProviderClients *PluginClientBuilder
+	// ProviderSandbox is the sandbox the provider binaries are run in
+	ProviderSandbox sandbox.Config
+	// RetryPolicy is the policy of retrying the failed provider calls
+	RetryPolicy RetryPolicy
+	// ProviderTimeout is the timeout of a provider call
+	ProviderTimeout time.Duration
+	// MaxCachedContentAge is the maximum age of the cached contents served when
+	// the provider is unavailable
+	MaxCachedContentAge time.Duration
+	// MountTimeout is the timeout of a mount
+	MountTimeout MountTimeout
+	// MaxFileSize is the maximum size of a mounted file
+	MaxFileSize int64
+	// TmpfsSize is the size of the tmpfs mounted on the target paths
+	TmpfsSize int64
+	// VolumeQuota is the quota of the mounted contents of a volume
+	VolumeQuota VolumeQuota
+	// MaxConcurrentProviderCalls is the maximum number of concurrent provider calls
+	MaxConcurrentProviderCalls int
+	// MountWorkers is the number of workers mounting the volumes
+	MountWorkers int
+	// ProvidersAllowlist are the comma separated providers allowed to be used
+	ProvidersAllowlist string
+	// FSGroupPolicy is the policy of applying the fsGroup of the pods
+	FSGroupPolicy string
+	// SELinuxContext enables setting the SELinux context of the mounted files
+	SELinuxContext bool
+	// Rotation is the configuration of the rotation of the mounted contents
+	Rotation RotationConfig
+	// StandaloneSync is the configuration of the standalone secret sync
+	StandaloneSync StandaloneSyncConfig
+	// AuditLog logs the mounts, nil if the audit log is disabled
+	AuditLog *AuditLog
+	// Client is the controller-runtime client
+	Client client.Client
+	// KubeClient is the kubernetes clientset
+	KubeClient kubernetes.Interface
+	// EventRecorder records the pod events
+	EventRecorder record.EventRecorder
+}
+
 // GetDriver returns a new secrets store driver
 func GetDriver() *SecretsStore {
 	return &SecretsStore{}
 }
 
-func newNodeServer(d *csicommon.CSIDriver, providerVolumePath, minProviderVersions, grpcSupportedProviders, nodeID string, mounter mount.Interface, client client.Client) (*nodeServer, error) {
+func newNodeServer(d *csicommon.CSIDriver, mounter mount.Interface, cfg Config) (*nodeServer, error) {
 	// get a map of provider and compatible version
-	minProviderVersionsMap, err := version.GetMinimumProviderVersions(minProviderVersions)
+	minProviderVersionsMap, err := version.GetMinimumProviderVersions(cfg.MinProviderVersions)
 	if err != nil {
 		return nil, err
 	}
 	grpcSupportedProvidersMap := make(map[string]bool)
-	for _, provider := range strings.Split(grpcSupportedProviders, ";") {
+	for _, provider := range strings.Split(cfg.GRPCSupportedProviders, ";") {
 		if len(provider) != 0 {
 			grpcSupportedProvidersMap[provider] = true
 		}
@@ -64,21 +131,60 @@ func newNodeServer(d *csicommon.CSIDriver, providerVolumePath, minProviderVersio
 	if len(minProviderVersionsMap) == 0 {
 		log.Infof("minimum compatible provider versions not specified with --min-provider-version")
 	}
-	if len(grpcSupportedProvidersMap) == 0 {
-		log.Infof("grpc supported providers not enabled")
+	if len(grpcSupportedProvidersMap) != 0 {
+		log.Warningf("--grpc-supported-providers is deprecated, providers with a socket in %s are discovered automatically", cfg.ProviderVolumePath)
 	}
 	return &nodeServer{
 		DefaultNodeServer:      csicommon.NewDefaultNodeServer(d),
-		providerVolumePath:     providerVolumePath,
+		providerVolumePath:     cfg.ProviderVolumePath,
 		minProviderVersions:    minProviderVersionsMap,
 		mounter:                mounter,
 		reporter:               newStatsReporter(),
-		nodeID:                 nodeID,
-		client:                 client,
+		nodeID:                 cfg.NodeID,
+		client:                 cfg.Client,
+		kubeClient:             cfg.KubeClient,
 		grpcSupportedProviders: grpcSupportedProvidersMap,
+		providerClients:        cfg.ProviderClients,
+		providerSandbox:        cfg.ProviderSandbox,
+		mountCache:             newMountCache(cfg.MaxCachedContentAge),
+		retryPolicy:            cfg.RetryPolicy,
+		providerTimeout:        cfg.ProviderTimeout,
+		mountTimeout:           cfg.MountTimeout,
+		maxFileSize:            cfg.MaxFileSize,
+		tmpfsSize:              cfg.TmpfsSize,
+		volumeQuota:            cfg.VolumeQuota,
+		tmpfsBacked:            tmpfsBacked,
+		fsGroupPolicy:          cfg.FSGroupPolicy,
+		seLinuxContext:         cfg.SELinuxContext,
+		seLinuxEnabled:         seLinuxEnabled,
+		providerCallLimiter:    newProviderCallLimiter(cfg.MaxConcurrentProviderCalls),
+		mountPool:              newMountPool(cfg.MountWorkers),
+		mountFlights:           newMountFlights(inFlightMountGracePeriod),
+		fetchFlights:           newFetchFlights(),
+		serviceAccountTokens:   newServiceAccountTokens(),
+		allowedProviders:       parseProvidersAllowlist(cfg.ProvidersAllowlist),
+		auditLog:               cfg.AuditLog,
+		eventRecorder:          cfg.EventRecorder,
 	}, nil
 }
 
+// parseProvidersAllowlist returns the providers in the comma separated allowlist.
+// nil is returned if the allowlist is empty, so all providers are allowed.
+func parseProvidersAllowlist(providersAllowlist string) map[string]bool {
+	var allowedProviders map[string]bool
+	for _, provider := range strings.Split(providersAllowlist, ",") {
+		provider = strings.TrimSpace(provider)
+		if len(provider) == 0 {
+			continue
+		}
+		if allowedProviders == nil {
+			allowedProviders = make(map[string]bool)
+		}
+		allowedProviders[provider] = true
+	}
+	return allowedProviders
+}
+
 func newControllerServer(d *csicommon.CSIDriver) *controllerServer {
 	return &controllerServer{
 		DefaultControllerServer: csicommon.NewDefaultControllerServer(d),
@@ -93,15 +199,25 @@ func newIdentityServer(d *csicommon.CSIDriver) *identityServer {
 }
 
 // Run starts the CSI plugin
-func (s *SecretsStore) Run(driverName, nodeID, endpoint, providerVolumePath, minProviderVersions, grpcSupportedProviders string, client client.Client) {
-	log.Infof("Driver: %v ", driverName)
+func (s *SecretsStore) Run(cfg Config) {
+	log.Infof("Driver: %v ", cfg.DriverName)
 	log.Infof("Version: %s", vendorVersion)
-	log.Infof("Provider Volume Path: %s", providerVolumePath)
-	log.Infof("Minimum provider versions: %s", minProviderVersions)
-	log.Infof("GRPC supported providers: %s", grpcSupportedProviders)
+	log.Infof("Provider Volume Path: %s", cfg.ProviderVolumePath)
+	log.Infof("Kubelet root directory: %s", cfg.KubeletRootDir)
+	log.Infof("Minimum provider versions: %s", cfg.MinProviderVersions)
+	log.Infof("GRPC supported providers: %s", cfg.GRPCSupportedProviders)
+	log.Infof("Provider timeout: %v", cfg.ProviderTimeout)
+	log.Infof("Maximum cached content age: %v", cfg.MaxCachedContentAge)
+	log.Infof("Mount timeout: %v, write timeout: %v", cfg.MountTimeout.Timeout, cfg.MountTimeout.WriteTimeout)
+	log.Infof("Maximum concurrent provider calls: %d", cfg.MaxConcurrentProviderCalls)
+	log.Infof("Mount workers: %d", cfg.MountWorkers)
+	log.Infof("Providers allowlist: %s", cfg.ProvidersAllowlist)
+	log.Infof("Secret rotation enabled: %v", cfg.Rotation.Enabled)
+	log.Infof("Standalone sync enabled: %v", cfg.StandaloneSync.Interval > 0)
+	log.Infof("Audit log enabled: %v", cfg.AuditLog != nil)
 
 	// Initialize default library driver
-	s.driver = csicommon.NewCSIDriver(driverName, vendorVersion, nodeID)
+	s.driver = csicommon.NewCSIDriver(cfg.DriverName, vendorVersion, cfg.NodeID)
 	if s.driver == nil {
 		log.Fatal("Failed to initialize SecretsStore CSI Driver.")
 	}
@@ -121,15 +237,30 @@ func (s *SecretsStore) Run(driverName, nodeID, endpoint, providerVolumePath, min
 	}
 	defer m.Stop()
 
-	ns, err := newNodeServer(s.driver, providerVolumePath, minProviderVersions, grpcSupportedProviders, nodeID, mount.New(""), client)
+	ns, err := newNodeServer(s.driver, newMounter(), cfg)
 	if err != nil {
 		log.Fatalf("failed to initialize node server, error: %+v", err)
 	}
 	s.ns = ns
+	// the orphaned target paths are cleaned up before the driver serves the
+	// kubelet requests, so the cleanup doesn't race with new mounts
+	if len(cfg.KubeletRootDir) > 0 && cfg.KubeClient != nil {
+		if err := ns.cleanupOrphanedTargetPaths(filepath.Join(cfg.KubeletRootDir, "pods"), cfg.DriverName); err != nil {
+			log.Errorf("failed to clean up orphaned target paths, err: %v", err)
+		}
+	}
+	go ns.mountCache.run(wait.NeverStop)
+	ns.rotationEnabled = cfg.Rotation.Enabled
+	if cfg.Rotation.Enabled {
+		go newRotationReconciler(ns, cfg.Rotation).run(wait.NeverStop)
+	}
+	if cfg.StandaloneSync.Interval > 0 {
+		go newStandaloneSyncer(ns, cfg.StandaloneSync).run(wait.NeverStop)
+	}
 	s.cs = newControllerServer(s.driver)
 	s.ids = newIdentityServer(s.driver)
 
 	server := csicommon.NewNonBlockingGRPCServer()
-	server.Start(endpoint, s.ids, s.cs, s.ns)
+	server.Start(cfg.Endpoint, s.ids, s.cs, s.ns)
 	server.Wait()
 }
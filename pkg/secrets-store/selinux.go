@@ -0,0 +1,106 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package secretsstore
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// the default SELinux context of the volumes, files with the s0 level are
+	// readable by the containers of all pods like the volumes relabeled as
+	// shared by the container runtime
+	defaultSELinuxUser  = "system_u"
+	defaultSELinuxRole  = "object_r"
+	defaultSELinuxType  = "container_file_t"
+	defaultSELinuxLevel = "s0"
+	// seLinuxContextOption is the mount option that sets the SELinux context
+	// of all the files of the tmpfs
+	seLinuxContextOption = "context="
+)
+
+// seLinuxEnabled returns true if SELinux is enabled on the node, the SELinux
+// context of the driver process is only set if SELinux is enabled
+func seLinuxEnabled() bool {
+	current, err := ioutil.ReadFile("/proc/self/attr/current")
+	if err != nil {
+		return false
+	}
+	// the attribute is also used by AppArmor, whose profiles aren't
+	// user:role:type:level contexts
+	return strings.Count(strings.TrimRight(string(current), "\x00\n"), ":") >= 3
+}
+
+// seLinuxContext returns the SELinux context of the volume of a pod with the
+// SELinux options, the unset fields of the options are defaulted
+func seLinuxContext(opts *corev1.SELinuxOptions) string {
+	user, role, seLinuxType, level := defaultSELinuxUser, defaultSELinuxRole, defaultSELinuxType, defaultSELinuxLevel
+	if opts != nil {
+		if len(opts.User) > 0 {
+			user = opts.User
+		}
+		if len(opts.Role) > 0 {
+			role = opts.Role
+		}
+		if len(opts.Type) > 0 {
+			seLinuxType = opts.Type
+		}
+		if len(opts.Level) > 0 {
+			level = opts.Level
+		}
+	}
+	return fmt.Sprintf("%s:%s:%s:%s", user, role, seLinuxType, level)
+}
+
+// podSELinuxContext returns true if the SELinux context of the tmpfs of the
+// volume is derived from the SELinux options of the pod. The context in the
+// mount flags of the request is used instead, e.g. with the SELinuxMount
+// feature of the kubelet. No context is set if SELinux isn't enabled on the
+// node.
+func (ns *nodeServer) podSELinuxContext(mountFlags []string) bool {
+	for _, flag := range mountFlags {
+		if strings.HasPrefix(flag, seLinuxContextOption) {
+			return false
+		}
+	}
+	return ns.seLinuxContext && ns.seLinuxEnabled()
+}
+
+// seLinuxMountOptions returns the SELinux context mount option of the tmpfs
+// of the volume, from the mount flags of the request or from the SELinux
+// options of the pod. The pod is only required if podSELinuxContext returns
+// true for the mount flags.
+func (ns *nodeServer) seLinuxMountOptions(mountFlags []string, pod *corev1.Pod) []string {
+	for _, flag := range mountFlags {
+		if strings.HasPrefix(flag, seLinuxContextOption) {
+			return []string{flag}
+		}
+	}
+	if !ns.podSELinuxContext(mountFlags) {
+		return nil
+	}
+	var opts *corev1.SELinuxOptions
+	if pod.Spec.SecurityContext != nil {
+		opts = pod.Spec.SecurityContext.SELinuxOptions
+	}
+	// the level contains commas, so the context is quoted
+	return []string{fmt.Sprintf("%s%q", seLinuxContextOption, seLinuxContext(opts))}
+}
@@ -0,0 +1,103 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package secretsstore
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// serviceAccountToken is a service account token requested by the kubelet for
+// an audience of the CSIDriver tokenRequests
+type serviceAccountToken struct {
+	Token               string    `json:"token"`
+	ExpirationTimestamp time.Time `json:"expirationTimestamp"`
+}
+
+// volumeTokens are the service account tokens of a volume
+type volumeTokens struct {
+	// tokens is the serviceAccount.tokens attribute of the volume context
+	tokens string
+	// expiry is the earliest expiry of the tokens
+	expiry time.Time
+}
+
+// serviceAccountTokens are the service account tokens passed by the kubelet in
+// the volume context of the volumes, keyed by target path. The kubelet
+// republishes the volumes with refreshed tokens ahead of their expiry since
+// the CSIDriver requires republish, the rotation passes the latest tokens to
+// the providers.
+type serviceAccountTokens struct {
+	lock   sync.Mutex
+	tokens map[string]volumeTokens
+}
+
+func newServiceAccountTokens() *serviceAccountTokens {
+	return &serviceAccountTokens{
+		tokens: make(map[string]volumeTokens),
+	}
+}
+
+// set records the service account tokens of the volume of the target path. It
+// returns true if the tokens were refreshed.
+func (t *serviceAccountTokens) set(targetPath, tokens string) (bool, error) {
+	expiry, err := serviceAccountTokensExpiry(tokens)
+	if err != nil {
+		return false, err
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	previous, ok := t.tokens[targetPath]
+	t.tokens[targetPath] = volumeTokens{tokens: tokens, expiry: expiry}
+	return !ok || previous.tokens != tokens, nil
+}
+
+// get returns the latest service account tokens of the volume of the target
+// path and their earliest expiry, false if the volume has none
+func (t *serviceAccountTokens) get(targetPath string) (string, time.Time, bool) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	tokens, ok := t.tokens[targetPath]
+	return tokens.tokens, tokens.expiry, ok
+}
+
+// delete removes the service account tokens of the unmounted volume of the
+// target path
+func (t *serviceAccountTokens) delete(targetPath string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	delete(t.tokens, targetPath)
+}
+
+// serviceAccountTokensExpiry returns the earliest expiry of the service account
+// tokens of the serviceAccount.tokens attribute, keyed by audience
+func serviceAccountTokensExpiry(tokens string) (time.Time, error) {
+	var audienceTokens map[string]serviceAccountToken
+	if err := json.Unmarshal([]byte(tokens), &audienceTokens); err != nil {
+		return time.Time{}, fmt.Errorf("failed to parse service account tokens, err: %v", err)
+	}
+	var expiry time.Time
+	for _, token := range audienceTokens {
+		expiry = earliestExpiry(expiry, token.ExpirationTimestamp)
+	}
+	return expiry, nil
+}
@@ -0,0 +1,71 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package secretsstore
+
+import (
+	"testing"
+	"time"
+)
+
+func TestServiceAccountTokens(t *testing.T) {
+	tokens := newServiceAccountTokens()
+	if _, _, ok := tokens.get("/target1"); ok {
+		t.Fatalf("expected no tokens for /target1")
+	}
+
+	tokens1 := `{"vault":{"token":"token1","expirationTimestamp":"2021-01-01T10:00:00Z"},"aws":{"token":"token2","expirationTimestamp":"2021-01-01T09:00:00Z"}}`
+	refreshed, err := tokens.set("/target1", tokens1)
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	if !refreshed {
+		t.Errorf("expected the tokens to be refreshed")
+	}
+	got, expiry, ok := tokens.get("/target1")
+	if !ok || got != tokens1 {
+		t.Errorf("expected tokens: %s, got: %s", tokens1, got)
+	}
+	// the tokens expire with the earliest token
+	if expected := time.Date(2021, 1, 1, 9, 0, 0, 0, time.UTC); !expiry.Equal(expected) {
+		t.Errorf("expected expiry: %v, got: %v", expected, expiry)
+	}
+
+	// the republish with the same tokens doesn't refresh them
+	if refreshed, err = tokens.set("/target1", tokens1); err != nil || refreshed {
+		t.Errorf("expected the tokens not to be refreshed, got: %v, %+v", refreshed, err)
+	}
+	tokens2 := `{"vault":{"token":"token3","expirationTimestamp":"2021-01-01T11:00:00Z"}}`
+	if refreshed, err = tokens.set("/target1", tokens2); err != nil || !refreshed {
+		t.Errorf("expected the tokens to be refreshed, got: %v, %+v", refreshed, err)
+	}
+	if got, _, _ = tokens.get("/target1"); got != tokens2 {
+		t.Errorf("expected tokens: %s, got: %s", tokens2, got)
+	}
+
+	// invalid tokens don't replace the tokens of the volume
+	if _, err = tokens.set("/target1", "invalid"); err == nil {
+		t.Errorf("expected err to be not nil for invalid tokens")
+	}
+	if got, _, _ = tokens.get("/target1"); got != tokens2 {
+		t.Errorf("expected tokens: %s, got: %s", tokens2, got)
+	}
+
+	tokens.delete("/target1")
+	if _, _, ok = tokens.get("/target1"); ok {
+		t.Errorf("expected the tokens of /target1 to be deleted")
+	}
+}
@@ -0,0 +1,273 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package secretsstore
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/net/context"
+	"golang.org/x/time/rate"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"sigs.k8s.io/secrets-store-csi-driver/apis/v1alpha1"
+	"sigs.k8s.io/secrets-store-csi-driver/controllers"
+)
+
+const (
+	// standaloneSyncLeaseName is the name of the lease that elects the driver
+	// that syncs the secret provider classes annotated for standalone sync
+	standaloneSyncLeaseName = "secrets-store-csi-driver-standalone-sync"
+
+	standaloneSyncLeaseDuration = 15 * time.Second
+	standaloneSyncRenewDeadline = 10 * time.Second
+	standaloneSyncRetryPeriod   = 2 * time.Second
+)
+
+// StandaloneSyncConfig configures the sync of the secret provider classes
+// annotated with the StandaloneSyncAnnotation into k8s secrets, without pods
+// or volumes
+type StandaloneSyncConfig struct {
+	// Interval is the interval the secret provider classes are synced. The
+	// standalone sync is disabled if the interval is 0.
+	Interval time.Duration
+	// LeaseNamespace is the namespace of the lease that elects the driver that
+	// syncs the secret provider classes, so they are synced by a single node
+	LeaseNamespace string
+	// SyncNamespaces are the namespaces the secrets are allowed to be synced
+	// into from other namespaces
+	SyncNamespaces []string
+}
+
+// standaloneSyncer syncs the secret provider classes annotated for standalone
+// sync into k8s secrets on the node elected with the lease
+type standaloneSyncer struct {
+	ns     *nodeServer
+	config StandaloneSyncConfig
+	// limiter doesn't limit the provider calls, the secret provider classes
+	// are synced one at a time
+	limiter *rate.Limiter
+}
+
+// newStandaloneSyncer returns a standalone syncer for the providers of the
+// node server
+func newStandaloneSyncer(ns *nodeServer, config StandaloneSyncConfig) *standaloneSyncer {
+	return &standaloneSyncer{
+		ns:      ns,
+		config:  config,
+		limiter: rate.NewLimiter(rate.Inf, 0),
+	}
+}
+
+// run syncs the secret provider classes every interval while the node holds
+// the lease, until the stop channel is closed
+func (s *standaloneSyncer) run(stopCh <-chan struct{}) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-stopCh
+		cancel()
+	}()
+	lock := &resourcelock.LeaseLock{
+		LeaseMeta: metav1.ObjectMeta{
+			Name:      standaloneSyncLeaseName,
+			Namespace: s.config.LeaseNamespace,
+		},
+		Client:     s.ns.kubeClient.CoordinationV1(),
+		LockConfig: resourcelock.ResourceLockConfig{Identity: s.ns.nodeID},
+	}
+	log.Infof("syncing secretproviderclasses annotated for standalone sync every %v", s.config.Interval)
+	// the leader election is retried after the lease is lost
+	wait.Until(func() {
+		leaderelection.RunOrDie(ctx, leaderelection.LeaderElectionConfig{
+			Lock:            lock,
+			ReleaseOnCancel: true,
+			LeaseDuration:   standaloneSyncLeaseDuration,
+			RenewDeadline:   standaloneSyncRenewDeadline,
+			RetryPeriod:     standaloneSyncRetryPeriod,
+			Callbacks: leaderelection.LeaderCallbacks{
+				OnStartedLeading: func(ctx context.Context) {
+					log.Infof("started standalone sync of secretproviderclasses on node %s", s.ns.nodeID)
+					wait.Until(s.syncAll, s.config.Interval, ctx.Done())
+				},
+				OnStoppedLeading: func() {
+					log.Infof("stopped standalone sync of secretproviderclasses on node %s", s.ns.nodeID)
+				},
+			},
+		})
+	}, time.Second, stopCh)
+}
+
+// syncAll syncs the secret provider classes annotated for standalone sync
+func (s *standaloneSyncer) syncAll() {
+	ctx := context.Background()
+	spcs := &v1alpha1.SecretProviderClassList{}
+	if err := s.ns.client.List(ctx, spcs); err != nil {
+		log.Errorf("failed to list secretproviderclasses for standalone sync, err: %+v", err)
+		return
+	}
+	for i := range spcs.Items {
+		spc := &spcs.Items[i]
+		if spc.GetAnnotations()[v1alpha1.StandaloneSyncAnnotation] != "true" {
+			continue
+		}
+		spc, err := controllers.ResolveSecretProviderClass(ctx, s.ns.client, spc)
+		if err != nil {
+			log.Errorf("failed to resolve secretproviderclass %s/%s, err: %+v", spcs.Items[i].Namespace, spcs.Items[i].Name, err)
+			continue
+		}
+		updated, err := s.sync(ctx, spc)
+		if err != nil {
+			log.Errorf("failed to sync secretproviderclass %s/%s, err: %+v", spc.Namespace, spc.Name, err)
+			if s.ns.eventRecorder != nil {
+				s.ns.eventRecorder.Event(spc, corev1.EventTypeWarning, FailedToSyncSecrets, err.Error())
+			}
+		}
+		if len(spc.Spec.SecretObjects) > 0 {
+			if err := controllers.UpdateSecretSyncedCondition(ctx, s.ns.client, spc, err, updated); err != nil {
+				log.Errorf("failed to update %s condition of secretproviderclass %s/%s, err: %+v", v1alpha1.SecretSynced, spc.Namespace, spc.Name, err)
+			}
+		}
+	}
+}
+
+// sync fetches the contents of the secret provider class from the providers
+// and creates or updates the k8s secrets of its secret objects. The contents
+// are fetched into a temporary directory and aren't written to the node. It
+// returns true if any of the secrets was created or updated.
+func (s *standaloneSyncer) sync(ctx context.Context, spc *v1alpha1.SecretProviderClass) (bool, error) {
+	if len(spc.Spec.SecretObjects) == 0 {
+		return false, nil
+	}
+	providerName, err := getProviderFromSPC(spc)
+	if err != nil {
+		return false, err
+	}
+	if err = s.ns.checkProvidersAllowed(spc); err != nil {
+		return false, err
+	}
+	if _, err = getParametersFromSPC(spc); err != nil {
+		return false, err
+	}
+	// the provider authenticates with the service account of the annotation,
+	// as there is no pod
+	attrib := map[string]string{
+		csipodnamespace: spc.Namespace,
+		csipodsa:        spc.GetAnnotations()[v1alpha1.StandaloneSyncServiceAccountAnnotation],
+	}
+	spc, err = renderParameterTemplates(spc, parameterTemplateData{
+		PodNamespace:       attrib[csipodnamespace],
+		ServiceAccountName: attrib[csipodsa],
+	})
+	if err != nil {
+		return false, err
+	}
+	permissionStr, err := json.Marshal(permission)
+	if err != nil {
+		return false, err
+	}
+	targetPath, err := ioutil.TempDir("", "secrets-store-standalone-sync")
+	if err != nil {
+		return false, err
+	}
+	defer os.RemoveAll(targetPath)
+
+	_, objects, _, err := s.ns.fetchProviders(ctx, s.limiter, spc, providerName, attrib, "{}", targetPath, string(permissionStr), "", spc.Namespace)
+	if err != nil {
+		return false, err
+	}
+	updated := false
+	for _, secretObj := range spc.Spec.SecretObjects {
+		secretUpdated, err := s.syncSecret(ctx, spc, secretObj, objects)
+		if err != nil {
+			return updated, err
+		}
+		updated = updated || secretUpdated
+	}
+	return updated, nil
+}
+
+// syncSecret creates or updates the k8s secret of the secret object with the
+// contents of the objects by object name. The secrets created in the namespace
+// of the secret provider class are owned by it, so they are garbage collected
+// with the secret provider class. It returns true if the secret was created or
+// updated.
+func (s *standaloneSyncer) syncSecret(ctx context.Context, spc *v1alpha1.SecretProviderClass, secretObj *v1alpha1.SecretObject, objects map[string][]byte) (bool, error) {
+	namespace, err := syncedSecretNamespace(ctx, s.ns.client, s.config.SyncNamespaces, spc, secretObj)
+	if err != nil {
+		return false, fmt.Errorf("failed to sync secret %s, err: %+v", secretObj.SecretName, err)
+	}
+	data, err := secretData(secretObj, objects)
+	if err != nil {
+		return false, fmt.Errorf("failed to get data of synced secret %s/%s, err: %+v", namespace, secretObj.SecretName, err)
+	}
+	secret := &corev1.Secret{}
+	err = s.ns.client.Get(ctx, types.NamespacedName{Namespace: namespace, Name: secretObj.SecretName}, secret)
+	if apierrors.IsNotFound(err) {
+		secret = &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:   namespace,
+				Name:        secretObj.SecretName,
+				Labels:      map[string]string{v1alpha1.ManagedLabel: "true"},
+				Annotations: controllers.SyncedSecretAnnotations(secretObj.Annotations, data),
+			},
+			Type: controllers.GetSecretType(secretObj.Type),
+			Data: data,
+		}
+		for k, v := range secretObj.Labels {
+			secret.Labels[k] = v
+		}
+		if namespace == spc.Namespace {
+			secret.OwnerReferences = []metav1.OwnerReference{{
+				APIVersion: v1alpha1.GroupVersion.String(),
+				Kind:       "SecretProviderClass",
+				Name:       spc.Name,
+				UID:        spc.UID,
+			}}
+		}
+		if err := s.ns.client.Create(ctx, secret, client.FieldOwner(controllers.FieldManager)); err != nil {
+			return false, fmt.Errorf("failed to create synced secret %s/%s, err: %+v", namespace, secretObj.SecretName, err)
+		}
+		log.Infof("created synced secret %s/%s for secretproviderclass %s", namespace, secretObj.SecretName, spc.Name)
+		return true, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to get synced secret %s/%s, err: %+v", namespace, secretObj.SecretName, err)
+	}
+	if err = controllers.CheckConflictPolicy(secretObj.ConflictPolicy, secret); err != nil {
+		return false, err
+	}
+	if !secretChanged(secret, secretObj, data) {
+		return false, nil
+	}
+	if err := controllers.ApplySecret(ctx, s.ns.client, secretObj.SecretName, namespace, secretObj.Labels, secretObj.Annotations, data); err != nil {
+		return false, fmt.Errorf("failed to update synced secret %s/%s, err: %+v", namespace, secretObj.SecretName, err)
+	}
+	log.Infof("updated synced secret %s/%s for secretproviderclass %s", namespace, secretObj.SecretName, spc.Name)
+	return true, nil
+}
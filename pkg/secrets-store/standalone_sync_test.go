@@ -0,0 +1,115 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package secretsstore
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/net/context"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"sigs.k8s.io/secrets-store-csi-driver/apis/v1alpha1"
+	providerfake "sigs.k8s.io/secrets-store-csi-driver/provider/fake"
+)
+
+func TestStandaloneSync(t *testing.T) {
+	spc := &v1alpha1.SecretProviderClass{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "spc1",
+			Namespace:   "default",
+			UID:         "spc-uid",
+			Annotations: map[string]string{v1alpha1.StandaloneSyncAnnotation: "true"},
+		},
+		Spec: v1alpha1.SecretProviderClassSpec{
+			Provider:   "provider1",
+			Parameters: map[string]string{"parameter1": "value1"},
+			SecretObjects: []*v1alpha1.SecretObject{
+				{SecretName: "synced1", Type: "Opaque", Labels: map[string]string{"team": "a"}, Data: []*v1alpha1.SecretObjectData{{ObjectName: "secret1", Key: "key1"}}},
+			},
+		},
+	}
+	ns, err := testNodeServer(nil, fake.NewFakeClientWithScheme(testRotationScheme(), spc), "")
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	defer os.RemoveAll(ns.providerVolumePath)
+
+	server, err := providerfake.NewMocKCSIProviderServer(filepath.Join(ns.providerVolumePath, "provider1.sock"))
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	server.SetFiles(map[string]string{"secret1": "value1"})
+	server.SetObjects(map[string]string{"secret/secret1": "v1"})
+	server.Start()
+	defer server.Stop()
+
+	s := newStandaloneSyncer(ns, StandaloneSyncConfig{})
+	key := types.NamespacedName{Namespace: "default", Name: "synced1"}
+
+	// the secret is created and owned by the secret provider class
+	s.syncAll()
+	synced := &corev1.Secret{}
+	if err := ns.client.Get(context.TODO(), key, synced); err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	if string(synced.Data["key1"]) != "value1" {
+		t.Errorf("expected synced secret contents: value1, got: %s", string(synced.Data["key1"]))
+	}
+	if synced.Labels["team"] != "a" {
+		t.Errorf("expected synced secret label team: a, got: %v", synced.Labels)
+	}
+	if len(synced.OwnerReferences) != 1 || synced.OwnerReferences[0].UID != spc.UID {
+		t.Errorf("expected synced secret to be owned by the secretproviderclass, got: %+v", synced.OwnerReferences)
+	}
+	if err := ns.client.Get(context.TODO(), types.NamespacedName{Namespace: "default", Name: "spc1"}, spc); err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	if len(spc.Status.Conditions) != 1 || spc.Status.Conditions[0].Type != v1alpha1.SecretSynced || spc.Status.Conditions[0].Status != corev1.ConditionTrue {
+		t.Errorf("expected %s condition to be true, got: %+v", v1alpha1.SecretSynced, spc.Status.Conditions)
+	}
+
+	// the secret is updated with the changed contents
+	server.SetFiles(map[string]string{"secret1": "value2"})
+	if _, err := s.sync(context.TODO(), spc); err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	if err := ns.client.Get(context.TODO(), key, synced); err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	if string(synced.Data["key1"]) != "value2" {
+		t.Errorf("expected synced secret contents: value2, got: %s", string(synced.Data["key1"]))
+	}
+
+	// the secret provider class isn't synced without the annotation
+	spc.Annotations = nil
+	server.SetFiles(map[string]string{"secret1": "value3"})
+	if err := ns.client.Update(context.TODO(), spc); err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	s.syncAll()
+	if err := ns.client.Get(context.TODO(), key, synced); err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	if string(synced.Data["key1"]) != "value2" {
+		t.Errorf("expected synced secret contents: value2, got: %s", string(synced.Data["key1"]))
+	}
+}
@@ -24,16 +24,34 @@ import (
 )
 
 var (
-	providerKey             = "provider"
-	errorKey                = "error_type"
-	osTypeKey               = "os_type"
-	nodePublishTotal        metric.Int64Counter
-	nodeUnPublishTotal      metric.Int64Counter
-	nodePublishErrorTotal   metric.Int64Counter
-	nodeUnPublishErrorTotal metric.Int64Counter
-	syncK8sSecretTotal      metric.Int64Counter
-	syncK8sSecretDuration   metric.Float64Measure
-	runtimeOS               = runtime.GOOS
+	providerKey               = "provider"
+	errorKey                  = "error_type"
+	osTypeKey                 = "os_type"
+	grpcCodeKey               = "grpc_code"
+	namespaceKey              = "namespace"
+	operationKey              = "operation"
+	nodePublishTotal          metric.Int64Counter
+	nodeUnPublishTotal        metric.Int64Counter
+	nodePublishErrorTotal     metric.Int64Counter
+	nodeUnPublishErrorTotal   metric.Int64Counter
+	syncK8sSecretTotal        metric.Int64Counter
+	syncK8sSecretDuration     metric.Float64Measure
+	incompatibleVersionTotal  metric.Int64Counter
+	providerCallDuration      metric.Float64Measure
+	providerCallErrorTotal    metric.Int64Counter
+	rotationTotal             metric.Int64Counter
+	rotationErrorTotal        metric.Int64Counter
+	rotationDuration          metric.Float64Measure
+	rotationDryRunChangeTotal metric.Int64Counter
+	cachedContentServedTotal  metric.Int64Counter
+	runtimeOS                 = runtime.GOOS
+)
+
+const (
+	// cachedContentMount is the operation of the cached contents served for a mount
+	cachedContentMount = "mount"
+	// cachedContentRotation is the operation of the mounted contents kept for a rotation
+	cachedContentRotation = "rotation"
 )
 
 type reporter struct {
@@ -47,6 +65,14 @@ type StatsReporter interface {
 	reportNodeUnPublishErrorCtMetric()
 	reportSyncK8SecretCtMetric(provider string, count int)
 	reportSyncK8SecretDuration(duration float64)
+	reportIncompatibleVersionCtMetric(provider, errType string)
+	reportProviderCallDuration(provider, code string, duration float64)
+	reportProviderCallErrorCtMetric(provider, code string)
+	reportRotationCtMetric(provider, namespace string)
+	reportRotationErrorCtMetric(provider, namespace, errType string)
+	reportRotationDuration(provider, namespace string, duration float64)
+	reportRotationDryRunChangeCtMetric(provider, namespace string)
+	reportCachedContentServedCtMetric(provider, namespace, operation string)
 }
 
 func newStatsReporter() StatsReporter {
@@ -57,6 +83,14 @@ func newStatsReporter() StatsReporter {
 	nodeUnPublishErrorTotal = metric.Must(meter).NewInt64Counter("total_node_unpublish_error", metric.WithDescription("Total number of node unpublish calls with error"))
 	syncK8sSecretTotal = metric.Must(meter).NewInt64Counter("total_sync_k8s_secret", metric.WithDescription("Total number of k8s secrets synced"))
 	syncK8sSecretDuration = metric.Must(meter).NewFloat64Measure("sync_k8s_secret_duration_sec", metric.WithDescription("Distribution of how long it took to sync k8s secret"))
+	incompatibleVersionTotal = metric.Must(meter).NewInt64Counter("total_incompatible_version", metric.WithDescription("Total number of incompatible driver and provider version checks"))
+	providerCallDuration = metric.Must(meter).NewFloat64Measure("provider_call_duration_sec", metric.WithDescription("Distribution of how long it took to mount the contents from the provider"))
+	providerCallErrorTotal = metric.Must(meter).NewInt64Counter("total_provider_call_error", metric.WithDescription("Total number of provider calls to mount the contents with error"))
+	rotationTotal = metric.Must(meter).NewInt64Counter("total_rotation_reconcile", metric.WithDescription("Total number of rotation reconciles"))
+	rotationErrorTotal = metric.Must(meter).NewInt64Counter("total_rotation_reconcile_error", metric.WithDescription("Total number of rotation reconciles with error"))
+	rotationDuration = metric.Must(meter).NewFloat64Measure("rotation_reconcile_duration_sec", metric.WithDescription("Distribution of how long it took to rotate the mounted contents of a volume"))
+	rotationDryRunChangeTotal = metric.Must(meter).NewInt64Counter("total_rotation_dry_run_change", metric.WithDescription("Total number of dry run rotations that would change the mounted contents of a volume"))
+	cachedContentServedTotal = metric.Must(meter).NewInt64Counter("total_cached_content_served", metric.WithDescription("Total number of mounts and rotations that served the cached contents of a volume as the providers were unavailable"))
 	return &reporter{meter: meter}
 }
 
@@ -86,3 +120,43 @@ func (r *reporter) reportSyncK8SecretCtMetric(provider string, count int) {
 func (r *reporter) reportSyncK8SecretDuration(duration float64) {
 	r.meter.RecordBatch(context.Background(), []core.KeyValue{key.String(osTypeKey, runtimeOS)}, syncK8sSecretDuration.Measurement(duration))
 }
+
+func (r *reporter) reportIncompatibleVersionCtMetric(provider, errType string) {
+	labels := []core.KeyValue{key.String(providerKey, provider), key.String(errorKey, errType), key.String(osTypeKey, runtimeOS)}
+	incompatibleVersionTotal.Add(context.Background(), 1, labels...)
+}
+
+func (r *reporter) reportProviderCallDuration(provider, code string, duration float64) {
+	labels := []core.KeyValue{key.String(providerKey, provider), key.String(grpcCodeKey, code), key.String(osTypeKey, runtimeOS)}
+	r.meter.RecordBatch(context.Background(), labels, providerCallDuration.Measurement(duration))
+}
+
+func (r *reporter) reportProviderCallErrorCtMetric(provider, code string) {
+	labels := []core.KeyValue{key.String(providerKey, provider), key.String(grpcCodeKey, code), key.String(osTypeKey, runtimeOS)}
+	providerCallErrorTotal.Add(context.Background(), 1, labels...)
+}
+
+func (r *reporter) reportRotationCtMetric(provider, namespace string) {
+	labels := []core.KeyValue{key.String(providerKey, provider), key.String(namespaceKey, namespace), key.String(osTypeKey, runtimeOS)}
+	rotationTotal.Add(context.Background(), 1, labels...)
+}
+
+func (r *reporter) reportRotationErrorCtMetric(provider, namespace, errType string) {
+	labels := []core.KeyValue{key.String(providerKey, provider), key.String(namespaceKey, namespace), key.String(errorKey, errType), key.String(osTypeKey, runtimeOS)}
+	rotationErrorTotal.Add(context.Background(), 1, labels...)
+}
+
+func (r *reporter) reportRotationDuration(provider, namespace string, duration float64) {
+	labels := []core.KeyValue{key.String(providerKey, provider), key.String(namespaceKey, namespace), key.String(osTypeKey, runtimeOS)}
+	r.meter.RecordBatch(context.Background(), labels, rotationDuration.Measurement(duration))
+}
+
+func (r *reporter) reportRotationDryRunChangeCtMetric(provider, namespace string) {
+	labels := []core.KeyValue{key.String(providerKey, provider), key.String(namespaceKey, namespace), key.String(osTypeKey, runtimeOS)}
+	rotationDryRunChangeTotal.Add(context.Background(), 1, labels...)
+}
+
+func (r *reporter) reportCachedContentServedCtMetric(provider, namespace, operation string) {
+	labels := []core.KeyValue{key.String(providerKey, provider), key.String(namespaceKey, namespace), key.String(operationKey, operation), key.String(osTypeKey, runtimeOS)}
+	cachedContentServedTotal.Add(context.Background(), 1, labels...)
+}
@@ -0,0 +1,150 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package secretsstore
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/time/rate"
+)
+
+// syncWriter debounces and rate limits the updates of the synced secrets and
+// configmaps by the rotation, so rapid successive changes don't flood the api
+// server and the watchers of the synced objects don't see every intermediate
+// version. The first update of an object is written immediately, the updates
+// within the debounce interval after it are coalesced into a single write of
+// the latest contents at the end of the interval. The writes are rate limited
+// per namespace.
+type syncWriter struct {
+	debounce time.Duration
+	limit    rate.Limit
+	burst    int
+
+	lock sync.Mutex
+	// limiters are the rate limiters of the writes by namespace
+	limiters map[string]*rate.Limiter
+	// lastWrite is the time of the last write by object key
+	lastWrite map[string]time.Time
+	// pending are the coalesced writes by object key, written when the debounce
+	// interval since the last write ends
+	pending map[string]func(context.Context) error
+}
+
+// newSyncWriter returns a sync writer with the debounce interval and the rate
+// limit per namespace of the rotation config. The writes aren't debounced if
+// the interval is 0 and aren't limited if the rate limit is 0.
+func newSyncWriter(config RotationConfig) *syncWriter {
+	w := &syncWriter{
+		debounce:  config.SyncDebounce,
+		limit:     rate.Inf,
+		limiters:  make(map[string]*rate.Limiter),
+		lastWrite: make(map[string]time.Time),
+		pending:   make(map[string]func(context.Context) error),
+	}
+	if config.SyncRateLimit > 0 {
+		w.limit = rate.Limit(config.SyncRateLimit)
+		w.burst = config.SyncRateBurst
+	}
+	return w
+}
+
+// write writes the object with the namespace and name of kind with the write
+// func. It returns true if the object was written, and false if the write is
+// deferred to the end of the debounce interval, replacing any write of the
+// object that is already pending. The errors of deferred writes are logged.
+func (w *syncWriter) write(ctx context.Context, kind, namespace, name string, write func(context.Context) error) (bool, error) {
+	key := syncKey(kind, namespace, name)
+	w.lock.Lock()
+	if _, ok := w.pending[key]; ok {
+		w.pending[key] = write
+		w.lock.Unlock()
+		return false, nil
+	}
+	if last, ok := w.lastWrite[key]; ok && w.debounce > 0 {
+		if wait := w.debounce - time.Since(last); wait > 0 {
+			w.pending[key] = write
+			w.lock.Unlock()
+			time.AfterFunc(wait, func() {
+				w.flush(kind, namespace, name, key)
+			})
+			return false, nil
+		}
+	}
+	// the write is recorded before it's started, so the concurrent updates of
+	// the object are debounced
+	if w.debounce > 0 {
+		w.lastWrite[key] = time.Now()
+	}
+	limiter := w.limiter(namespace)
+	w.lock.Unlock()
+
+	if err := limiter.Wait(ctx); err != nil {
+		return false, err
+	}
+	return true, write(ctx)
+}
+
+// cancel drops the pending write of the object, e.g. because the object
+// already has the latest contents
+func (w *syncWriter) cancel(kind, namespace, name string) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	delete(w.pending, syncKey(kind, namespace, name))
+}
+
+// flush writes the pending write of the object at the end of the debounce
+// interval
+func (w *syncWriter) flush(kind, namespace, name, key string) {
+	w.lock.Lock()
+	write, ok := w.pending[key]
+	delete(w.pending, key)
+	w.lastWrite[key] = time.Now()
+	limiter := w.limiter(namespace)
+	w.lock.Unlock()
+	if !ok {
+		return
+	}
+
+	ctx := context.Background()
+	if err := limiter.Wait(ctx); err != nil {
+		log.Errorf("failed to wait for the sync rate limit of %s %s/%s, err: %+v", kind, namespace, name, err)
+		return
+	}
+	if err := write(ctx); err != nil {
+		log.Errorf("failed to write debounced update of %s %s/%s, err: %+v", kind, namespace, name, err)
+		return
+	}
+	log.Infof("wrote debounced update of %s %s/%s", kind, namespace, name)
+}
+
+// limiter returns the rate limiter of the namespace. The lock must be held.
+func (w *syncWriter) limiter(namespace string) *rate.Limiter {
+	limiter, ok := w.limiters[namespace]
+	if !ok {
+		limiter = rate.NewLimiter(w.limit, w.burst)
+		w.limiters[namespace] = limiter
+	}
+	return limiter
+}
+
+// syncKey returns the key of the synced object of kind with namespace and name
+func syncKey(kind, namespace, name string) string {
+	return kind + "/" + namespace + "/" + name
+}
@@ -0,0 +1,108 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package secretsstore
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSyncWriter(t *testing.T) {
+	var lock sync.Mutex
+	var writes []string
+	write := func(contents string) func(context.Context) error {
+		return func(context.Context) error {
+			lock.Lock()
+			defer lock.Unlock()
+			writes = append(writes, contents)
+			return nil
+		}
+	}
+	getWrites := func() []string {
+		lock.Lock()
+		defer lock.Unlock()
+		return append([]string{}, writes...)
+	}
+
+	w := newSyncWriter(RotationConfig{SyncDebounce: 50 * time.Millisecond})
+
+	// the first update is written immediately
+	written, err := w.write(context.TODO(), "secret", "default", "secret1", write("v1"))
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	if !written {
+		t.Fatalf("expected the first update to be written")
+	}
+
+	// the updates within the debounce interval are coalesced
+	for _, contents := range []string{"v2", "v3", "v4"} {
+		written, err = w.write(context.TODO(), "secret", "default", "secret1", write(contents))
+		if err != nil {
+			t.Fatalf("expected err to be nil, got: %+v", err)
+		}
+		if written {
+			t.Fatalf("expected update %s to be debounced", contents)
+		}
+	}
+	// other objects aren't debounced
+	if written, _ = w.write(context.TODO(), "configmap", "default", "secret1", write("configmap")); !written {
+		t.Fatalf("expected the update of another object to be written")
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if got := fmt.Sprint(getWrites()); got != "[v1 configmap v4]" {
+		t.Errorf("expected writes: [v1 configmap v4], got: %s", got)
+	}
+
+	// the update after the debounce interval is written immediately, and a
+	// canceled update isn't written
+	if written, _ = w.write(context.TODO(), "secret", "default", "secret1", write("v5")); !written {
+		t.Fatalf("expected the update after the debounce interval to be written")
+	}
+	if written, _ = w.write(context.TODO(), "secret", "default", "secret1", write("v6")); written {
+		t.Fatalf("expected the update to be debounced")
+	}
+	w.cancel("secret", "default", "secret1")
+	time.Sleep(100 * time.Millisecond)
+	if got := fmt.Sprint(getWrites()); got != "[v1 configmap v4 v5]" {
+		t.Errorf("expected writes: [v1 configmap v4 v5], got: %s", got)
+	}
+}
+
+func TestSyncWriterRateLimit(t *testing.T) {
+	w := newSyncWriter(RotationConfig{SyncRateLimit: 1, SyncRateBurst: 1})
+	noop := func(context.Context) error { return nil }
+
+	if _, err := w.write(context.TODO(), "secret", "default", "secret1", noop); err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	// the rate limit is per namespace
+	if _, err := w.write(context.TODO(), "secret", "other", "secret1", noop); err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+
+	// the second update in the namespace waits for the rate limit
+	ctx, cancel := context.WithTimeout(context.TODO(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := w.write(ctx, "secret", "default", "secret2", noop); err == nil {
+		t.Fatalf("expected the update to wait for the rate limit")
+	}
+}
@@ -20,9 +20,11 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"regexp"
-	"runtime"
+	"sort"
 	"strings"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 	"golang.org/x/net/context"
@@ -36,6 +38,8 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	"sigs.k8s.io/secrets-store-csi-driver/apis/v1alpha1"
+	"sigs.k8s.io/secrets-store-csi-driver/controllers"
+	"sigs.k8s.io/secrets-store-csi-driver/pkg/util/fileutil"
 )
 
 var (
@@ -84,6 +88,20 @@ func getMountedFiles(targetPath string) ([]string, error) {
 	return paths, nil
 }
 
+// removeMountedFiles removes all the files and directories in the target path
+func removeMountedFiles(targetPath string) error {
+	files, err := ioutil.ReadDir(targetPath)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		if err := os.RemoveAll(filepath.Join(targetPath, file.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // getPodUIDFromTargetPath returns podUID from targetPath
 func getPodUIDFromTargetPath(targetPath string) string {
 	re := regexp.MustCompile(`[\\|\/]+pods[\\|\/]+(.+?)[\\|\/]+volumes`)
@@ -118,56 +136,49 @@ func (ns *nodeServer) ensureMountPoint(target string) (bool, error) {
 		return !notMnt, err
 	}
 
-	if runtime.GOOS == "windows" {
-		// IsLikelyNotMountPoint always returns notMnt=true for windows as the
-		// target path is not a soft link to the global mount
-		// instead check if the dir exists for windows and if it's not empty
-		// If there are contents in the dir, then objects are already mounted
-		f, err := ioutil.ReadDir(target)
-		if err != nil {
-			return !notMnt, err
-		}
-		if len(f) > 0 {
-			notMnt = false
-			return !notMnt, err
-		}
-	}
-
 	return false, nil
 }
 
-// getSecretProviderItem returns the secretproviderclass object by name and namespace
-func getSecretProviderItem(ctx context.Context, c client.Client, name, namespace string) (*v1alpha1.SecretProviderClass, error) {
-	spc := &v1alpha1.SecretProviderClass{}
-	spcKey := types.NamespacedName{
-		Namespace: namespace,
-		Name:      name,
-	}
-	if err := c.Get(ctx, spcKey, spc); err != nil {
-		return nil, fmt.Errorf("failed to get secretproviderclass %s/%s, error: %+v", namespace, name, err)
+// getSecretProviderItem returns the secretproviderclass object by name and namespace,
+// or the clustersecretproviderclass object by name if kind is ClusterSecretProviderClass
+func getSecretProviderItem(ctx context.Context, c client.Client, name, kind, namespace string) (*v1alpha1.SecretProviderClass, error) {
+	spc, err := controllers.GetSecretProviderClass(ctx, c, name, kind, namespace)
+	if err != nil {
+		if kind == v1alpha1.ClusterSecretProviderClassKind {
+			return nil, fmt.Errorf("failed to get clustersecretproviderclass %s for namespace %s, error: %w", name, namespace, err)
+		}
+		return nil, fmt.Errorf("failed to get secretproviderclass %s/%s, error: %w", namespace, name, err)
 	}
 	return spc, nil
 }
 
 // createSecretProviderClassPodStatus creates secret provider class pod status
-func createSecretProviderClassPodStatus(ctx context.Context, c client.Client, podname, namespace, podUID, spcName, targetPath, nodeID string, mounted bool, objects map[string]string) error {
+func createSecretProviderClassPodStatus(ctx context.Context, c client.Client, podname, namespace, podUID, spcName, spcKind, targetPath, nodeID string, mounted bool, objects map[string]string, expiry time.Time, spcGeneration int64) error {
 	var o []v1alpha1.SecretProviderClassObject
 	for k, v := range objects {
 		o = append(o, v1alpha1.SecretProviderClassObject{ID: k, Version: v})
 	}
 
+	name := podname + "-" + namespace + "-" + spcName
+	if spcKind == v1alpha1.ClusterSecretProviderClassKind {
+		name = podname + "-" + namespace + "-cluster-" + spcName
+	}
 	spcPodStatus := &v1alpha1.SecretProviderClassPodStatus{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      podname + "-" + namespace + "-" + spcName,
+			Name:      name,
 			Namespace: namespace,
 			Labels:    map[string]string{v1alpha1.InternalNodeLabel: nodeID},
 		},
 		Status: v1alpha1.SecretProviderClassPodStatusStatus{
-			PodName:                 podname,
-			TargetPath:              targetPath,
-			Mounted:                 mounted,
-			SecretProviderClassName: spcName,
-			Objects:                 o,
+			PodName:                       podname,
+			PodUID:                        podUID,
+			TargetPath:                    targetPath,
+			Mounted:                       mounted,
+			SecretProviderClassName:       spcName,
+			SecretProviderClassKind:       spcKind,
+			Objects:                       o,
+			ExpiryTime:                    expiryTime(expiry),
+			SecretProviderClassGeneration: spcGeneration,
 		},
 	}
 	// Set owner reference to the pod as the mapping between secret provider class pod status and
@@ -189,6 +200,16 @@ func createSecretProviderClassPodStatus(ctx context.Context, c client.Client, po
 	return nil
 }
 
+// expiryTime returns the expiry for the secret provider class pod status, nil
+// if the mounted objects don't expire
+func expiryTime(expiry time.Time) *metav1.Time {
+	if expiry.IsZero() {
+		return nil
+	}
+	t := metav1.NewTime(expiry)
+	return &t
+}
+
 // getProviderFromSPC returns the provider as defined in SecretProviderClass
 func getProviderFromSPC(spc *v1alpha1.SecretProviderClass) (string, error) {
 	if len(spc.Spec.Provider) == 0 {
@@ -197,6 +218,22 @@ func getProviderFromSPC(spc *v1alpha1.SecretProviderClass) (string, error) {
 	return string(spc.Spec.Provider), nil
 }
 
+// providerParameters returns a copy of the provider parameters with the pod
+// attributes of the volume context
+func providerParameters(parameters, attrib map[string]string) map[string]string {
+	p := make(map[string]string, len(parameters)+4)
+	for k, v := range parameters {
+		p[k] = v
+	}
+	for _, k := range []string{csipodname, csipodnamespace, csipoduid, csipodsa} {
+		p[k] = attrib[k]
+	}
+	if tokens := attrib[csipodsatokens]; len(tokens) > 0 {
+		p[csipodsatokens] = tokens
+	}
+	return p
+}
+
 // getParametersFromSPC returns the parameters map as defined in SecretProviderClass
 func getParametersFromSPC(spc *v1alpha1.SecretProviderClass) (map[string]string, error) {
 	if len(spc.Spec.Parameters) == 0 {
@@ -204,3 +241,40 @@ func getParametersFromSPC(spc *v1alpha1.SecretProviderClass) (map[string]string,
 	}
 	return spc.Spec.Parameters, nil
 }
+
+// writeDataVersion updates the data version file in the target path after the
+// mounted files were written
+func writeDataVersion(targetPath string) error {
+	return fileutil.WriteDataVersion(targetPath, time.Now().UTC().Format(time.RFC3339Nano))
+}
+
+// mountedObjectsMetadata returns the metadata of the objects mounted into a new
+// volume, all the objects were fetched at the fetch time
+func mountedObjectsMetadata(objectVersions map[string]string, fetchTime time.Time) fileutil.Metadata {
+	metadata, _ := objectsMetadata(objectVersions, fetchTime, fileutil.Metadata{})
+	return metadata
+}
+
+// objectsMetadata returns the metadata of the mounted objects for the object
+// versions fetched at the fetch time, sorted by id. The fetch time of the
+// objects with the same version in the previous metadata is kept, so the
+// metadata only change if the versions of the objects changed. It returns true
+// if the metadata differ from the previous metadata.
+func objectsMetadata(objectVersions map[string]string, fetchTime time.Time, previous fileutil.Metadata) (fileutil.Metadata, bool) {
+	previousObjects := make(map[string]fileutil.ObjectMetadata, len(previous.Objects))
+	for _, object := range previous.Objects {
+		previousObjects[object.ID] = object
+	}
+	metadata := fileutil.Metadata{Objects: []fileutil.ObjectMetadata{}}
+	changed := len(objectVersions) != len(previous.Objects)
+	for id, version := range objectVersions {
+		object, ok := previousObjects[id]
+		if !ok || object.Version != version {
+			object = fileutil.ObjectMetadata{ID: id, Version: version, FetchTime: fetchTime.UTC()}
+			changed = true
+		}
+		metadata.Objects = append(metadata.Objects, object)
+	}
+	sort.Slice(metadata.Objects, func(i, j int) bool { return metadata.Objects[i].ID < metadata.Objects[j].ID })
+	return metadata, changed
+}
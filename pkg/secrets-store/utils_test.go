@@ -18,10 +18,13 @@ package secretsstore
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/utils/mount"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/secrets-store-csi-driver/pkg/util/fileutil"
 )
 
 func TestGetProviderPath(t *testing.T) {
@@ -45,7 +48,14 @@ func TestGetProviderPath(t *testing.T) {
 	}
 
 	for _, tc := range cases {
-		testNodeServer, err := newNodeServer(NewFakeDriver(), tc.providerVolumePath, "", "", "test-node", &mount.FakeMounter{}, fake.NewFakeClientWithScheme(nil))
+		testNodeServer, err := newNodeServer(NewFakeDriver(), &mount.FakeMounter{}, Config{
+			NodeID:             "test-node",
+			ProviderVolumePath: tc.providerVolumePath,
+			ProviderClients:    NewPluginClientBuilder(tc.providerVolumePath),
+			FSGroupPolicy:      FSGroupPolicyNone,
+			Client:             fake.NewFakeClientWithScheme(nil),
+			EventRecorder:      record.NewFakeRecorder(10),
+		})
 		assert.NoError(t, err)
 		assert.NotNil(t, testNodeServer)
 
@@ -53,3 +63,70 @@ func TestGetProviderPath(t *testing.T) {
 		assert.Equal(t, tc.expectedProviderBinary, actualProviderBinary)
 	}
 }
+
+func TestObjectsMetadata(t *testing.T) {
+	previousFetch := time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC)
+	fetchTime := previousFetch.Add(time.Hour)
+	previous := fileutil.Metadata{Objects: []fileutil.ObjectMetadata{
+		{ID: "secret/secret1", Version: "v1", FetchTime: previousFetch},
+		{ID: "secret/secret2", Version: "v1", FetchTime: previousFetch},
+	}}
+
+	cases := []struct {
+		name            string
+		objectVersions  map[string]string
+		previous        fileutil.Metadata
+		expected        fileutil.Metadata
+		expectedChanged bool
+	}{
+		{
+			name:           "no previous metadata",
+			objectVersions: map[string]string{"secret/secret2": "v1", "secret/secret1": "v1"},
+			expected: fileutil.Metadata{Objects: []fileutil.ObjectMetadata{
+				{ID: "secret/secret1", Version: "v1", FetchTime: fetchTime},
+				{ID: "secret/secret2", Version: "v1", FetchTime: fetchTime},
+			}},
+			expectedChanged: true,
+		},
+		{
+			name:           "same versions",
+			objectVersions: map[string]string{"secret/secret1": "v1", "secret/secret2": "v1"},
+			previous:       previous,
+			expected:       previous,
+		},
+		{
+			name:           "changed version",
+			objectVersions: map[string]string{"secret/secret1": "v1", "secret/secret2": "v2"},
+			previous:       previous,
+			expected: fileutil.Metadata{Objects: []fileutil.ObjectMetadata{
+				{ID: "secret/secret1", Version: "v1", FetchTime: previousFetch},
+				{ID: "secret/secret2", Version: "v2", FetchTime: fetchTime},
+			}},
+			expectedChanged: true,
+		},
+		{
+			name:            "removed object",
+			objectVersions:  map[string]string{"secret/secret1": "v1"},
+			previous:        previous,
+			expected:        fileutil.Metadata{Objects: previous.Objects[:1]},
+			expectedChanged: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			metadata, changed := objectsMetadata(tc.objectVersions, fetchTime, tc.previous)
+			assert.Equal(t, tc.expected, metadata)
+			assert.Equal(t, tc.expectedChanged, changed)
+		})
+	}
+}
+
+func TestMountedObjectsMetadata(t *testing.T) {
+	fetchTime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	metadata := mountedObjectsMetadata(map[string]string{"secret/secret2": "v2", "secret/secret1": "v1"}, fetchTime)
+	assert.Equal(t, fileutil.Metadata{Objects: []fileutil.ObjectMetadata{
+		{ID: "secret/secret1", Version: "v1", FetchTime: fetchTime},
+		{ID: "secret/secret2", Version: "v2", FetchTime: fetchTime},
+	}}, metadata)
+}
@@ -0,0 +1,99 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package secretsstore
+
+import (
+	"fmt"
+	"text/template"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+
+	"sigs.k8s.io/secrets-store-csi-driver/apis/v1alpha1"
+)
+
+// ValidateSecretProviderClass returns an error listing the problems the node
+// server would reject the secret provider class for before calling its
+// providers, e.g. a provider that isn't set or an invalid mounted object. The
+// base classes of the secret provider class must be merged into its spec.
+func ValidateSecretProviderClass(spc *v1alpha1.SecretProviderClass) error {
+	var errs []error
+	if _, err := getProviderFromSPC(spc); err != nil {
+		errs = append(errs, err)
+	}
+	if _, err := getParametersFromSPC(spc); err != nil {
+		errs = append(errs, err)
+	}
+	for i, additionalProvider := range spc.Spec.AdditionalProviders {
+		if additionalProvider == nil || len(additionalProvider.Provider) == 0 {
+			errs = append(errs, fmt.Errorf("provider of additional provider %d not set", i))
+		}
+	}
+	if err := validateMountedObjects(spc.Spec.MountedObjects); err != nil {
+		errs = append(errs, err)
+	}
+	if err := validateOutputFiles(spc.Spec.OutputFiles); err != nil {
+		errs = append(errs, err)
+	}
+	for _, windows := range [][]v1alpha1.RotationWindow{spc.Spec.RotationWindows, spc.Spec.RotationBlackouts} {
+		if _, err := inRotationWindow(windows, time.Now()); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if spc.Spec.PodSelector != nil {
+		if _, err := metav1.LabelSelectorAsSelector(spc.Spec.PodSelector); err != nil {
+			errs = append(errs, fmt.Errorf("invalid pod selector, err: %v", err))
+		}
+	}
+	for _, parameters := range providerParameterMaps(spc) {
+		for k, v := range parameters {
+			if !isParameterTemplate(v) {
+				continue
+			}
+			if _, err := template.New(k).Option("missingkey=error").Parse(v); err != nil {
+				errs = append(errs, fmt.Errorf("failed to parse template of parameter %s, err: %v", k, err))
+			}
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// RenderParameterTemplates returns a copy of the secret provider class with
+// the parameter templates of its providers rendered with the pod metadata
+func RenderParameterTemplates(spc *v1alpha1.SecretProviderClass, pod *corev1.Pod) (*v1alpha1.SecretProviderClass, error) {
+	return renderParameterTemplates(spc, podParameterTemplateData(pod))
+}
+
+// ValidateParameters validates the parameters against the parameters schema
+// advertised by the provider. The parameters aren't validated if the provider
+// doesn't advertise a schema.
+func (c ProviderCapabilities) ValidateParameters(parameters map[string]string) error {
+	if c.ParametersSchema == nil {
+		return nil
+	}
+	return c.ParametersSchema.validate(parameters)
+}
+
+// ApplyMountedObjects renames, decodes and sets the file permission of the
+// mounted objects of a secret provider class in the target path, as the node
+// server does after a provider mounted its objects. An error reason is
+// returned with the error.
+func ApplyMountedObjects(targetPath string, mountedObjects []*v1alpha1.MountedObject) (string, error) {
+	return applyMountedObjects(targetPath, mountedObjects)
+}
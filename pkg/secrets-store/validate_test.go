@@ -0,0 +1,112 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package secretsstore
+
+import (
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"sigs.k8s.io/secrets-store-csi-driver/apis/v1alpha1"
+)
+
+func TestValidateSecretProviderClass(t *testing.T) {
+	cases := []struct {
+		name        string
+		spec        v1alpha1.SecretProviderClassSpec
+		expectedErr bool
+	}{
+		{
+			name: "valid",
+			spec: v1alpha1.SecretProviderClassSpec{
+				Provider:        "provider1",
+				Parameters:      map[string]string{"path": "apps/{{ .PodNamespace }}/db"},
+				RotationWindows: []v1alpha1.RotationWindow{{Schedule: "0 2 * * *", Duration: metav1.Duration{Duration: time.Hour}}},
+				PodSelector:     &metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}},
+			},
+		},
+		{
+			name:        "provider not set",
+			spec:        v1alpha1.SecretProviderClassSpec{Parameters: map[string]string{"foo": "bar"}},
+			expectedErr: true,
+		},
+		{
+			name:        "parameters not set",
+			spec:        v1alpha1.SecretProviderClassSpec{Provider: "provider1"},
+			expectedErr: true,
+		},
+		{
+			name: "provider of additional provider not set",
+			spec: v1alpha1.SecretProviderClassSpec{
+				Provider:            "provider1",
+				Parameters:          map[string]string{"foo": "bar"},
+				AdditionalProviders: []*v1alpha1.AdditionalProvider{{Parameters: map[string]string{"foo": "bar"}}},
+			},
+			expectedErr: true,
+		},
+		{
+			name: "invalid mounted object",
+			spec: v1alpha1.SecretProviderClassSpec{
+				Provider:       "provider1",
+				Parameters:     map[string]string{"foo": "bar"},
+				MountedObjects: []*v1alpha1.MountedObject{{ObjectName: "../secret1"}},
+			},
+			expectedErr: true,
+		},
+		{
+			name: "invalid rotation blackout schedule",
+			spec: v1alpha1.SecretProviderClassSpec{
+				Provider:          "provider1",
+				Parameters:        map[string]string{"foo": "bar"},
+				RotationBlackouts: []v1alpha1.RotationWindow{{Schedule: "0 25 * * *", Duration: metav1.Duration{Duration: time.Hour}}},
+			},
+			expectedErr: true,
+		},
+		{
+			name: "invalid pod selector",
+			spec: v1alpha1.SecretProviderClassSpec{
+				Provider:    "provider1",
+				Parameters:  map[string]string{"foo": "bar"},
+				PodSelector: &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{{Key: "app", Operator: "Like"}}},
+			},
+			expectedErr: true,
+		},
+		{
+			name: "invalid fallback parameter template",
+			spec: v1alpha1.SecretProviderClassSpec{
+				Provider:   "provider1",
+				Parameters: map[string]string{"foo": "bar"},
+				Fallback:   &v1alpha1.FallbackProvider{Parameters: map[string]string{"path": "apps/{{ .PodNamespace"}},
+			},
+			expectedErr: true,
+		},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			spc := &v1alpha1.SecretProviderClass{
+				ObjectMeta: metav1.ObjectMeta{Name: "spc1", Namespace: "default"},
+				Spec:       test.spec,
+			}
+			err := ValidateSecretProviderClass(spc)
+			if test.expectedErr && err == nil || !test.expectedErr && err != nil {
+				t.Fatalf("expected err: %v, got: %+v", test.expectedErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package secretsstore
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// VolumeQuota limits the contents the providers write to each volume, so a
+// misbehaving provider or secret provider class can't fill the memory of the
+// node with the tmpfs of its volumes
+type VolumeQuota struct {
+	// MaxSize is the maximum total size in bytes of the files of a volume,
+	// the size isn't limited if zero
+	MaxSize int64
+	// MaxFiles is the maximum number of files of a volume, the number of files
+	// isn't limited if zero
+	MaxFiles int
+}
+
+// validate returns an error if the files in the data directory are larger
+// than the maximum size in total or if there are more files than the maximum
+// number of files
+func (q VolumeQuota) validate(dataDir string) error {
+	if q.MaxSize <= 0 && q.MaxFiles <= 0 {
+		return nil
+	}
+	var size int64
+	var count int
+	err := filepath.Walk(dataDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		size += info.Size()
+		count++
+		if q.MaxSize > 0 && size > q.MaxSize {
+			return fmt.Errorf("total size of the files exceeds the maximum volume size %d", q.MaxSize)
+		}
+		if q.MaxFiles > 0 && count > q.MaxFiles {
+			return fmt.Errorf("number of files exceeds the maximum number of files %d of the volume", q.MaxFiles)
+		}
+		return nil
+	})
+	return err
+}
@@ -0,0 +1,60 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package secretsstore
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestVolumeQuotaValidate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ut")
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.MkdirAll(filepath.Join(dir, "certs"), 0755); err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	for file, contents := range map[string]string{"secret1": "value1", "certs/tls.crt": "cert", "certs/tls.key": "key"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, file), []byte(contents), 0644); err != nil {
+			t.Fatalf("expected err to be nil, got: %+v", err)
+		}
+	}
+
+	cases := []struct {
+		name        string
+		quota       VolumeQuota
+		expectedErr bool
+	}{
+		{name: "not limited", quota: VolumeQuota{}},
+		{name: "within the quota", quota: VolumeQuota{MaxSize: 13, MaxFiles: 3}},
+		{name: "size above the quota", quota: VolumeQuota{MaxSize: 12}, expectedErr: true},
+		{name: "files above the quota", quota: VolumeQuota{MaxFiles: 2}, expectedErr: true},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.quota.validate(dir)
+			if test.expectedErr != (err != nil) {
+				t.Fatalf("expected err: %v, got: %+v", test.expectedErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package secretsstore
+
+import (
+	"os"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// volumeStats are the capacity and usage of the file system of a volume
+type volumeStats struct {
+	capacity   int64
+	available  int64
+	used       int64
+	inodes     int64
+	inodesFree int64
+	inodesUsed int64
+}
+
+// NodeGetCapabilities returns the capabilities of the node service, the driver
+// reports the stats of the mounted volumes
+func (ns *nodeServer) NodeGetCapabilities(ctx context.Context, req *csi.NodeGetCapabilitiesRequest) (*csi.NodeGetCapabilitiesResponse, error) {
+	return &csi.NodeGetCapabilitiesResponse{
+		Capabilities: []*csi.NodeServiceCapability{
+			{
+				Type: &csi.NodeServiceCapability_Rpc{
+					Rpc: &csi.NodeServiceCapability_RPC{
+						Type: csi.NodeServiceCapability_RPC_GET_VOLUME_STATS,
+					},
+				},
+			},
+		},
+	}, nil
+}
+
+// NodeGetVolumeStats returns the capacity and usage in bytes and inodes of the
+// tmpfs mounted for the volume, so the kubelet reports the volume metrics of
+// the mounted secrets
+func (ns *nodeServer) NodeGetVolumeStats(ctx context.Context, req *csi.NodeGetVolumeStatsRequest) (*csi.NodeGetVolumeStatsResponse, error) {
+	volumeID := req.GetVolumeId()
+	volumePath := req.GetVolumePath()
+	if len(volumeID) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "Volume ID missing in request")
+	}
+	if len(volumePath) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "Volume path missing in request")
+	}
+	if _, err := os.Stat(volumePath); err != nil {
+		if os.IsNotExist(err) {
+			return nil, status.Errorf(codes.NotFound, "volume path %s of volume %s doesn't exist", volumePath, volumeID)
+		}
+		return nil, status.Errorf(codes.Internal, "failed to stat volume path %s of volume %s, err: %v", volumePath, volumeID, err)
+	}
+	// the stats of the file system of the kubelet directory aren't reported
+	// for a volume path that isn't mounted
+	tmpfs, err := ns.tmpfsBacked(volumePath)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to check file system of volume path %s of volume %s, err: %v", volumePath, volumeID, err)
+	}
+	if !tmpfs {
+		return nil, status.Errorf(codes.NotFound, "volume %s is not mounted at %s", volumeID, volumePath)
+	}
+	stats, err := getVolumeStats(volumePath)
+	if err != nil {
+		log.Errorf("failed to get stats of volume %s at %s, err: %v", volumeID, volumePath, err)
+		return nil, status.Errorf(codes.Internal, "failed to get stats of volume %s at %s, err: %v", volumeID, volumePath, err)
+	}
+	return &csi.NodeGetVolumeStatsResponse{
+		Usage: []*csi.VolumeUsage{
+			{
+				Unit:      csi.VolumeUsage_BYTES,
+				Total:     stats.capacity,
+				Available: stats.available,
+				Used:      stats.used,
+			},
+			{
+				Unit:      csi.VolumeUsage_INODES,
+				Total:     stats.inodes,
+				Available: stats.inodesFree,
+				Used:      stats.inodesUsed,
+			},
+		},
+	}, nil
+}
@@ -0,0 +1,42 @@
+//go:build linux
+// +build linux
+
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package secretsstore
+
+import (
+	"golang.org/x/sys/unix"
+)
+
+// getVolumeStats returns the capacity and usage of the file system of the
+// path, the tmpfs of the volume
+func getVolumeStats(path string) (volumeStats, error) {
+	var fs unix.Statfs_t
+	if err := unix.Statfs(path, &fs); err != nil {
+		return volumeStats{}, err
+	}
+	bsize := int64(fs.Bsize)
+	return volumeStats{
+		capacity:   int64(fs.Blocks) * bsize,
+		available:  int64(fs.Bavail) * bsize,
+		used:       int64(fs.Blocks-fs.Bfree) * bsize,
+		inodes:     int64(fs.Files),
+		inodesFree: int64(fs.Ffree),
+		inodesUsed: int64(fs.Files - fs.Ffree),
+	}, nil
+}
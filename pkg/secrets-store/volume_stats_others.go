@@ -0,0 +1,46 @@
+//go:build !linux
+// +build !linux
+
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package secretsstore
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// getVolumeStats returns the size and number of the files in the path. The
+// volumes are directories in the kubelet directory without a file system of
+// their own, so the capacity of a volume is the size of its files.
+func getVolumeStats(path string) (volumeStats, error) {
+	var stats volumeStats
+	err := filepath.Walk(path, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		stats.used += info.Size()
+		stats.inodesUsed++
+		return nil
+	})
+	if err != nil {
+		return volumeStats{}, err
+	}
+	stats.capacity = stats.used
+	stats.inodes = stats.inodesUsed
+	return stats, nil
+}
@@ -0,0 +1,118 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package secretsstore
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestNodeGetCapabilities(t *testing.T) {
+	ns, err := testNodeServer(nil, fake.NewFakeClient(), "")
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	defer os.RemoveAll(ns.providerVolumePath)
+
+	resp, err := ns.NodeGetCapabilities(context.TODO(), &csi.NodeGetCapabilitiesRequest{})
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	if len(resp.GetCapabilities()) != 1 || resp.GetCapabilities()[0].GetRpc().GetType() != csi.NodeServiceCapability_RPC_GET_VOLUME_STATS {
+		t.Errorf("expected the GET_VOLUME_STATS capability, got: %+v", resp.GetCapabilities())
+	}
+}
+
+func TestNodeGetVolumeStats(t *testing.T) {
+	volumePath := getTestTargetPath(t)
+	defer os.RemoveAll(volumePath)
+	if err := ioutil.WriteFile(filepath.Join(volumePath, "secret1"), []byte("value1"), 0644); err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+
+	cases := []struct {
+		name         string
+		req          *csi.NodeGetVolumeStatsRequest
+		tmpfsBacked  bool
+		expectedCode codes.Code
+	}{
+		{
+			name:         "volume id missing",
+			req:          &csi.NodeGetVolumeStatsRequest{VolumePath: volumePath},
+			tmpfsBacked:  true,
+			expectedCode: codes.InvalidArgument,
+		},
+		{
+			name:         "volume path missing",
+			req:          &csi.NodeGetVolumeStatsRequest{VolumeId: "testvolid1"},
+			tmpfsBacked:  true,
+			expectedCode: codes.InvalidArgument,
+		},
+		{
+			name:         "volume path doesn't exist",
+			req:          &csi.NodeGetVolumeStatsRequest{VolumeId: "testvolid1", VolumePath: filepath.Join(volumePath, "missing")},
+			tmpfsBacked:  true,
+			expectedCode: codes.NotFound,
+		},
+		{
+			name:         "volume path not mounted",
+			req:          &csi.NodeGetVolumeStatsRequest{VolumeId: "testvolid1", VolumePath: volumePath},
+			expectedCode: codes.NotFound,
+		},
+		{
+			name:         "mounted volume",
+			req:          &csi.NodeGetVolumeStatsRequest{VolumeId: "testvolid1", VolumePath: volumePath},
+			tmpfsBacked:  true,
+			expectedCode: codes.OK,
+		},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			ns, err := testNodeServer(nil, fake.NewFakeClient(), "")
+			if err != nil {
+				t.Fatalf("expected err to be nil, got: %+v", err)
+			}
+			defer os.RemoveAll(ns.providerVolumePath)
+			ns.tmpfsBacked = func(string) (bool, error) { return test.tmpfsBacked, nil }
+
+			resp, err := ns.NodeGetVolumeStats(context.TODO(), test.req)
+			if code := status.Code(err); code != test.expectedCode {
+				t.Fatalf("expected error code %v, got: %+v", test.expectedCode, err)
+			}
+			if err != nil {
+				return
+			}
+			if len(resp.GetUsage()) != 2 {
+				t.Fatalf("expected the usage in bytes and inodes, got: %+v", resp.GetUsage())
+			}
+			for _, usage := range resp.GetUsage() {
+				if usage.GetTotal() <= 0 || usage.GetUsed() <= 0 || usage.GetUsed() > usage.GetTotal() {
+					t.Errorf("expected the used %v to be positive and not exceed the total, got: %+v", usage.GetUnit(), usage)
+				}
+			}
+		})
+	}
+}
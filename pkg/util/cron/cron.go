@@ -0,0 +1,179 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cron
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule is a cron schedule in the standard five field format: minute,
+// hour, day of month, month and day of week. Each field is a '*', a value, a
+// range 'a-b' or a comma separated list of them, optionally followed by a
+// step '/n'. Days of week are 0-6 (7 is also Sunday). Like in cron, a time
+// matches if either the day of month or the day of week matches when both are
+// restricted.
+type Schedule struct {
+	minute, hour, dom, month, dow uint64
+	// domStar and dowStar are true if the day of month or day of week is '*'
+	domStar, dowStar bool
+}
+
+// field defines the range of the values of a schedule field
+type field struct {
+	name     string
+	min, max int
+}
+
+var (
+	minuteField = field{name: "minute", min: 0, max: 59}
+	hourField   = field{name: "hour", min: 0, max: 23}
+	domField    = field{name: "day of month", min: 1, max: 31}
+	monthField  = field{name: "month", min: 1, max: 12}
+	dowField    = field{name: "day of week", min: 0, max: 7}
+)
+
+// Parse parses a cron schedule in the standard five field format, e.g.
+// "0 2 * * 6" for every Saturday at 02:00
+func Parse(spec string) (*Schedule, error) {
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("expected 5 fields in schedule %q, got: %d", spec, len(fields))
+	}
+	s := &Schedule{}
+	var err error
+	if s.minute, err = parseField(fields[0], minuteField); err != nil {
+		return nil, err
+	}
+	if s.hour, err = parseField(fields[1], hourField); err != nil {
+		return nil, err
+	}
+	if s.dom, err = parseField(fields[2], domField); err != nil {
+		return nil, err
+	}
+	if s.month, err = parseField(fields[3], monthField); err != nil {
+		return nil, err
+	}
+	if s.dow, err = parseField(fields[4], dowField); err != nil {
+		return nil, err
+	}
+	// 7 is Sunday as well
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+	s.domStar = fields[2] == "*"
+	s.dowStar = fields[4] == "*"
+	return s, nil
+}
+
+// parseField returns the bitset of the values of the schedule field
+func parseField(value string, f field) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(value, ",") {
+		rng, step := part, 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			var err error
+			if step, err = strconv.Atoi(part[i+1:]); err != nil || step < 1 {
+				return 0, fmt.Errorf("invalid step in %s %q", f.name, part)
+			}
+			rng = part[:i]
+		}
+		start, end := f.min, f.max
+		switch {
+		case rng == "*":
+		case strings.Contains(rng, "-"):
+			bounds := strings.SplitN(rng, "-", 2)
+			var err error
+			if start, err = parseValue(bounds[0], f); err != nil {
+				return 0, err
+			}
+			if end, err = parseValue(bounds[1], f); err != nil {
+				return 0, err
+			}
+			if start > end {
+				return 0, fmt.Errorf("invalid range in %s %q", f.name, part)
+			}
+		default:
+			var err error
+			if start, err = parseValue(rng, f); err != nil {
+				return 0, err
+			}
+			// a value with a step is the start of a range, e.g. 5/15
+			if step == 1 {
+				end = start
+			}
+		}
+		for v := start; v <= end; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+// parseValue parses a value of the schedule field
+func parseValue(value string, f field) (int, error) {
+	v, err := strconv.Atoi(value)
+	if err != nil || v < f.min || v > f.max {
+		return 0, fmt.Errorf("invalid %s %q, must be between %d and %d", f.name, value, f.min, f.max)
+	}
+	return v, nil
+}
+
+// Matches returns true if the minute of the time matches the schedule
+func (s *Schedule) Matches(t time.Time) bool {
+	return s.minute&(1<<uint(t.Minute())) != 0 &&
+		s.hour&(1<<uint(t.Hour())) != 0 &&
+		s.month&(1<<uint(t.Month())) != 0 &&
+		s.dayMatches(t)
+}
+
+// dayMatches returns true if the day of month or day of week of the time
+// matches the schedule
+func (s *Schedule) dayMatches(t time.Time) bool {
+	domMatches := s.dom&(1<<uint(t.Day())) != 0
+	dowMatches := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domStar || s.dowStar {
+		return domMatches && dowMatches
+	}
+	return domMatches || dowMatches
+}
+
+// Active returns true if the time is within the duration after a start time
+// of the schedule, i.e. in a window that starts at the schedule and lasts for
+// the duration
+func (s *Schedule) Active(t time.Time, d time.Duration) bool {
+	// the months, days and hours that don't match are skipped at once, so the
+	// windows are found without checking every minute of long durations
+	for start := t.Truncate(time.Minute); t.Sub(start) < d; {
+		year, month, day := start.Date()
+		switch {
+		case s.month&(1<<uint(month)) == 0:
+			start = time.Date(year, month, 1, 0, 0, 0, 0, start.Location()).Add(-time.Minute)
+		case !s.dayMatches(start):
+			start = time.Date(year, month, day, 0, 0, 0, 0, start.Location()).Add(-time.Minute)
+		case s.hour&(1<<uint(start.Hour())) == 0:
+			start = time.Date(year, month, day, start.Hour(), 0, 0, 0, start.Location()).Add(-time.Minute)
+		case s.minute&(1<<uint(start.Minute())) == 0:
+			start = start.Add(-time.Minute)
+		default:
+			return true
+		}
+	}
+	return false
+}
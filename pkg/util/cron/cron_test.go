@@ -0,0 +1,113 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cron
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	cases := []struct {
+		name        string
+		spec        string
+		expectedErr bool
+	}{
+		{name: "every minute", spec: "* * * * *"},
+		{name: "values, ranges, lists and steps", spec: "0,30 1-5 */2 1-12/3 1-5"},
+		{name: "sunday as 7", spec: "0 2 * * 7"},
+		{name: "missing fields", spec: "0 2 * *", expectedErr: true},
+		{name: "value out of range", spec: "60 * * * *", expectedErr: true},
+		{name: "invalid value", spec: "* two * * *", expectedErr: true},
+		{name: "invalid range", spec: "* 5-1 * * *", expectedErr: true},
+		{name: "invalid step", spec: "*/0 * * * *", expectedErr: true},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := Parse(test.spec); test.expectedErr != (err != nil) {
+				t.Fatalf("expected error: %v, got: %+v", test.expectedErr, err)
+			}
+		})
+	}
+}
+
+func TestMatches(t *testing.T) {
+	// 2020-06-06 is a Saturday
+	saturday := time.Date(2020, time.June, 6, 2, 0, 0, 0, time.UTC)
+	cases := []struct {
+		name     string
+		spec     string
+		time     time.Time
+		expected bool
+	}{
+		{name: "every minute", spec: "* * * * *", time: saturday, expected: true},
+		{name: "day of week", spec: "0 2 * * 6", time: saturday, expected: true},
+		{name: "sunday as 7", spec: "0 2 * * 7", time: saturday.AddDate(0, 0, 1), expected: true},
+		{name: "other minute", spec: "0 2 * * 6", time: saturday.Add(time.Minute)},
+		{name: "other day of week", spec: "0 2 * * 1-5", time: saturday},
+		{name: "step", spec: "*/15 * * * *", time: saturday.Add(45 * time.Minute), expected: true},
+		{name: "value with step", spec: "5/15 * * * *", time: saturday.Add(20 * time.Minute), expected: true},
+		{name: "day of month or day of week", spec: "0 2 1 * 6", time: saturday, expected: true},
+		{name: "day of month and any day of week", spec: "0 2 1 * *", time: saturday},
+		{name: "other month", spec: "0 2 * 1-5 *", time: saturday},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			s, err := Parse(test.spec)
+			if err != nil {
+				t.Fatalf("expected err to be nil, got: %+v", err)
+			}
+			if matches := s.Matches(test.time); matches != test.expected {
+				t.Errorf("expected schedule %q to match %v: %v, got: %v", test.spec, test.time, test.expected, matches)
+			}
+		})
+	}
+}
+
+func TestActive(t *testing.T) {
+	saturday := time.Date(2020, time.June, 6, 2, 0, 0, 0, time.UTC)
+	cases := []struct {
+		name     string
+		spec     string
+		duration time.Duration
+		time     time.Time
+		expected bool
+	}{
+		{name: "start of the window", spec: "0 2 * * 6", duration: time.Hour, time: saturday, expected: true},
+		{name: "in the window", spec: "0 2 * * 6", duration: time.Hour, time: saturday.Add(59 * time.Minute), expected: true},
+		{name: "end of the window", spec: "0 2 * * 6", duration: time.Hour, time: saturday.Add(time.Hour)},
+		{name: "before the window", spec: "0 2 * * 6", duration: time.Hour, time: saturday.Add(-time.Second)},
+		{name: "window across days", spec: "0 22 * * 5", duration: 6 * time.Hour, time: saturday, expected: true},
+		{name: "window across months", spec: "0 0 28 5 *", duration: 10 * 24 * time.Hour, time: saturday, expected: true},
+		{name: "long window ended", spec: "0 0 1 1 *", duration: 30 * 24 * time.Hour, time: saturday},
+		{name: "schedule never matches", spec: "0 0 30 2 *", duration: 365 * 24 * time.Hour, time: saturday},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			s, err := Parse(test.spec)
+			if err != nil {
+				t.Fatalf("expected err to be nil, got: %+v", err)
+			}
+			if active := s.Active(test.time, test.duration); active != test.expected {
+				t.Errorf("expected window %q for %v to be active at %v: %v, got: %v", test.spec, test.duration, test.time, test.expected, active)
+			}
+		})
+	}
+}
@@ -0,0 +1,229 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fileutil
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+const (
+	// DataDirLink is the symlink in the target path to the timestamped data
+	// directory with the mounted files. The mounted files in the target path
+	// are symlinks to the files in the data directory symlink, so all the
+	// files are replaced at once when the symlink is swapped.
+	DataDirLink = "..data"
+	// linkTmp is the symlink renamed over the data directory symlink and the
+	// mounted files
+	linkTmp = "..data_tmp"
+	// dataDirFormat is the prefix of the timestamped data directories
+	dataDirFormat = "..2006_01_02_15_04_05."
+)
+
+// DataDir returns the data directory the data directory symlink in the target
+// path points to. The target path is returned if the mounted files aren't in a
+// data directory, e.g. for the volumes mounted by previous driver versions.
+func DataDir(path string) string {
+	dir, err := os.Readlink(filepath.Join(path, DataDirLink))
+	if err != nil {
+		return path
+	}
+	return filepath.Join(path, filepath.Base(dir))
+}
+
+// NewDataDir creates a timestamped data directory in the target path with a
+// copy of the mounted files. The files in the data directory can be changed
+// without changing the mounted files until the data directory is published.
+func NewDataDir(path string) (string, error) {
+	dir, err := ioutil.TempDir(path, time.Now().UTC().Format(dataDirFormat))
+	if err != nil {
+		return "", fmt.Errorf("failed to create data directory, err: %v", err)
+	}
+	if err = os.Chmod(dir, 0755); err != nil {
+		os.RemoveAll(dir)
+		return "", fmt.Errorf("failed to set data directory mode, err: %v", err)
+	}
+	if err = copyDir(DataDir(path), dir); err != nil {
+		os.RemoveAll(dir)
+		return "", fmt.Errorf("failed to copy mounted files to data directory, err: %v", err)
+	}
+	return dir, nil
+}
+
+// PublishDataDir swaps the data directory symlink in the target path to the
+// data directory, so the consumers of the mounted files never observe
+// partially written or mixed versions of the files. The mounted files in the
+// target path are replaced by symlinks to the files in the data directory
+// symlink and the previous data directories are removed.
+func PublishDataDir(path, dir string) error {
+	name := filepath.Base(dir)
+	if err := swapDataDirLink(path, name); err != nil {
+		return fmt.Errorf("failed to swap data directory symlink, err: %v", err)
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("failed to list data directory, err: %v", err)
+	}
+	published := make(map[string]bool, len(files))
+	for _, file := range files {
+		published[file.Name()] = true
+		if err = linkFile(path, file.Name()); err != nil {
+			return fmt.Errorf("failed to link mounted file %s, err: %v", file.Name(), err)
+		}
+	}
+	files, err = ioutil.ReadDir(path)
+	if err != nil {
+		return fmt.Errorf("failed to list target path, err: %v", err)
+	}
+	for _, file := range files {
+		// the files managed by the driver, e.g. the data version file, are
+		// kept, except the previous data directories
+		if file.Name() == name || published[file.Name()] || (driverFile(file.Name()) && !isDataDir(file.Name())) {
+			continue
+		}
+		if err = os.RemoveAll(filepath.Join(path, file.Name())); err != nil {
+			return fmt.Errorf("failed to remove %s, err: %v", file.Name(), err)
+		}
+	}
+	return nil
+}
+
+// swapDataDirLink points the data directory symlink in the target path to the
+// data directory. The symlink is replaced atomically, except on windows where
+// directory symlinks can't be renamed over.
+func swapDataDirLink(path, name string) error {
+	link := filepath.Join(path, DataDirLink)
+	if runtime.GOOS == "windows" {
+		if err := os.Remove(link); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return os.Symlink(name, link)
+	}
+	tmp := filepath.Join(path, linkTmp)
+	if err := os.Remove(tmp); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.Symlink(name, tmp); err != nil {
+		return err
+	}
+	return os.Rename(tmp, link)
+}
+
+// linkFile replaces the file in the target path with a symlink to the file in
+// the data directory symlink. Regular files are replaced atomically, the
+// directories mounted by previous driver versions are removed first.
+func linkFile(path, name string) error {
+	p := filepath.Join(path, name)
+	target := filepath.Join(DataDirLink, name)
+	if dest, err := os.Readlink(p); err == nil && dest == target {
+		return nil
+	}
+	tmp := filepath.Join(path, linkTmp)
+	if err := os.Remove(tmp); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.Symlink(target, tmp); err != nil {
+		return err
+	}
+	if info, err := os.Lstat(p); err == nil && info.IsDir() {
+		if err = os.RemoveAll(p); err != nil {
+			return err
+		}
+	}
+	return os.Rename(tmp, p)
+}
+
+// copyDir copies the files, directories and symlinks in the source directory
+// to the destination directory. The files managed by the driver at the top of
+// the source directory and the checksums and metadata files, which are written
+// again for the new files, aren't copied.
+func copyDir(src, dest string) error {
+	return filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil || path == src {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		if rel == info.Name() && (driverFile(rel) || rel == ChecksumsFile || rel == MetadataFile) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		p := filepath.Join(dest, rel)
+		switch {
+		case info.IsDir():
+			if err := os.Mkdir(p, info.Mode().Perm()); err != nil {
+				return err
+			}
+			return os.Chmod(p, info.Mode().Perm())
+		case info.Mode()&os.ModeSymlink != 0:
+			target, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(target, p)
+		case info.Mode().IsRegular():
+			return copyFile(path, p, FileMode(info.Mode().Perm()))
+		}
+		return nil
+	})
+}
+
+// driverFile returns true if the file at the top of the target path is
+// managed by the driver, e.g. the data directories and the data version file
+func driverFile(name string) bool {
+	return name == DataDirLink || name == linkTmp || strings.HasPrefix(name, DataVersionFile) || isDataDir(name)
+}
+
+// isDataDir returns true if the name is the name of a timestamped data directory
+func isDataDir(name string) bool {
+	if len(name) <= len(dataDirFormat) {
+		return false
+	}
+	_, err := time.Parse(dataDirFormat, name[:len(dataDirFormat)])
+	return err == nil
+}
+
+// copyFile copies the contents of the file to a new file with the mode
+func copyFile(src, dest string, mode os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_EXCL, mode)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err = out.Close(); err != nil {
+		return err
+	}
+	return os.Chmod(dest, mode)
+}
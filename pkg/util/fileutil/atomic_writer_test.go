@@ -0,0 +1,148 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fileutil
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestPublishDataDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ut")
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// the files of a volume mounted by a previous driver version are moved
+	// to the data directory
+	for name, contents := range map[string]string{"secret1": "value1", "certs/cert1": "cert1", "removed": "removed"} {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0755); err != nil {
+			t.Fatalf("expected err to be nil, got: %+v", err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(contents), 0600); err != nil {
+			t.Fatalf("expected err to be nil, got: %+v", err)
+		}
+	}
+	if err := WriteDataVersion(dir, "v1"); err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	if DataDir(dir) != dir {
+		t.Fatalf("expected the target path to be the data directory, got: %s", DataDir(dir))
+	}
+	first, err := NewDataDir(dir)
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	if err := os.Remove(filepath.Join(first, "removed")); err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	if err := PublishDataDir(dir, first); err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	if DataDir(dir) != first {
+		t.Fatalf("expected data directory %s, got: %s", first, DataDir(dir))
+	}
+	expectFiles(t, dir, []string{filepath.Base(first), DataDirLink, DataVersionFile, "certs", "secret1"})
+	expectContents(t, dir, map[string]string{"secret1": "value1", "certs/cert1": "cert1", DataVersionFile: "v1\n"})
+	info, err := os.Stat(filepath.Join(dir, "secret1"))
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("expected the file mode to be kept, got: %v", info.Mode().Perm())
+	}
+
+	// the files changed in a new data directory are only mounted once the
+	// data directory is published
+	second, err := NewDataDir(dir)
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(second, "secret1"), []byte("value2"), 0600); err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(second, "secret2"), []byte("value2"), 0600); err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	if err := os.RemoveAll(filepath.Join(second, "certs")); err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	expectContents(t, dir, map[string]string{"secret1": "value1", "certs/cert1": "cert1"})
+	if err := PublishDataDir(dir, second); err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	expectFiles(t, dir, []string{filepath.Base(second), DataDirLink, DataVersionFile, "secret1", "secret2"})
+	expectContents(t, dir, map[string]string{"secret1": "value2", "secret2": "value2"})
+}
+
+func TestIsDataDir(t *testing.T) {
+	cases := []struct {
+		name     string
+		expected bool
+	}{
+		{name: "..2021_03_04_05_06_07.123456", expected: true},
+		{name: "..2021_03_04_05_06_07."},
+		{name: "..data"},
+		{name: "..secret"},
+		{name: "secret1"},
+	}
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			if actual := isDataDir(test.name); actual != test.expected {
+				t.Fatalf("expected data directory: %v, got: %v", test.expected, actual)
+			}
+		})
+	}
+}
+
+// expectFiles fails the test if the names in the target path aren't the
+// expected names
+func expectFiles(t *testing.T, dir string, expected []string) {
+	t.Helper()
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	var names []string
+	for _, file := range files {
+		names = append(names, file.Name())
+	}
+	sort.Strings(expected)
+	if !reflect.DeepEqual(names, expected) {
+		t.Fatalf("expected files: %v, got: %v", expected, names)
+	}
+}
+
+// expectContents fails the test if the contents of the files in the target
+// path aren't the expected contents
+func expectContents(t *testing.T, dir string, expected map[string]string) {
+	t.Helper()
+	for name, contents := range expected {
+		actual, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatalf("expected err to be nil, got: %+v", err)
+		}
+		if string(actual) != contents {
+			t.Errorf("expected contents of %s: %s, got: %s", name, contents, string(actual))
+		}
+	}
+}
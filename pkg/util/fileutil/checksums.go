@@ -0,0 +1,72 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fileutil
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// ChecksumsFile is the file in the data directory with the SHA-256 digests of
+// the mounted files, so applications can verify the integrity of the files
+const ChecksumsFile = "..checksums.json"
+
+// Checksums are the contents of the checksums file
+type Checksums struct {
+	// Algorithm is the hash algorithm of the digests
+	Algorithm string `json:"algorithm"`
+	// Files are the hex encoded digests of the mounted files by path relative
+	// to the target path, with forward slashes
+	Files map[string]string `json:"files"`
+}
+
+// WriteChecksums writes the checksums file with the digests of all the
+// regular files in the data directory. The checksums file is written in the
+// data directory, so it is published with the files it describes.
+func WriteChecksums(dir string) error {
+	checksums := Checksums{Algorithm: "sha256", Files: make(map[string]string)}
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || !info.Mode().IsRegular() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil || rel == ChecksumsFile {
+			return err
+		}
+		hash, err := fileHash(path)
+		if err != nil {
+			return err
+		}
+		checksums.Files[filepath.ToSlash(rel)] = hex.EncodeToString(hash)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to compute checksums of the mounted files, err: %v", err)
+	}
+	data, err := json.MarshalIndent(checksums, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err = ioutil.WriteFile(filepath.Join(dir, ChecksumsFile), append(data, '\n'), FileMode(defaultFileMode)); err != nil {
+		return fmt.Errorf("failed to write checksums file, err: %v", err)
+	}
+	return nil
+}
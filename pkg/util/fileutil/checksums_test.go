@@ -0,0 +1,96 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fileutil
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestWriteChecksums(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ut")
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	for name, contents := range map[string]string{"secret1": "value1", "certs/cert1": "cert1"} {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0755); err != nil {
+			t.Fatalf("expected err to be nil, got: %+v", err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(contents), 0600); err != nil {
+			t.Fatalf("expected err to be nil, got: %+v", err)
+		}
+	}
+	dataDir, err := NewDataDir(dir)
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	if err := WriteChecksums(dataDir); err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	// the checksums file isn't part of the digests when it is written again
+	if err := WriteChecksums(dataDir); err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	if err := PublishDataDir(dir, dataDir); err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, ChecksumsFile))
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	var checksums Checksums
+	if err := json.Unmarshal(data, &checksums); err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	digest := func(contents string) string {
+		sum := sha256.Sum256([]byte(contents))
+		return hex.EncodeToString(sum[:])
+	}
+	expected := Checksums{
+		Algorithm: "sha256",
+		Files:     map[string]string{"secret1": digest("value1"), "certs/cert1": digest("cert1")},
+	}
+	if !reflect.DeepEqual(checksums, expected) {
+		t.Errorf("expected checksums: %+v, got: %+v", expected, checksums)
+	}
+
+	// the checksums file isn't copied to a new data directory
+	next, err := NewDataDir(dir)
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	if _, err := os.Stat(filepath.Join(next, ChecksumsFile)); !os.IsNotExist(err) {
+		t.Errorf("expected checksums file to not be copied, got: %+v", err)
+	}
+	// the checksums file is removed once a data directory without checksums
+	// is published
+	if err := PublishDataDir(dir, next); err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	if _, err := os.Lstat(filepath.Join(dir, ChecksumsFile)); !os.IsNotExist(err) {
+		t.Errorf("expected checksums file to be removed, got: %+v", err)
+	}
+}
@@ -0,0 +1,80 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fileutil
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// MetadataFile is the file in the data directory with the versions of the
+// mounted objects, so tooling can check which versions a pod is running with
+const MetadataFile = "..metadata.json"
+
+// Metadata are the contents of the metadata file
+type Metadata struct {
+	// Objects are the mounted objects sorted by id
+	Objects []ObjectMetadata `json:"objects"`
+}
+
+// ObjectMetadata is the version of a mounted object
+type ObjectMetadata struct {
+	// ID is the id of the object returned by the provider
+	ID string `json:"id"`
+	// Version is the version of the object returned by the provider
+	Version string `json:"version"`
+	// FetchTime is the time the version of the object was fetched from the
+	// provider
+	FetchTime time.Time `json:"fetchTime"`
+}
+
+// WriteMetadata writes the metadata file in the data directory, so it is
+// published with the files it describes.
+func WriteMetadata(dir string, metadata Metadata) error {
+	if metadata.Objects == nil {
+		metadata.Objects = []ObjectMetadata{}
+	}
+	data, err := json.MarshalIndent(metadata, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err = ioutil.WriteFile(filepath.Join(dir, MetadataFile), append(data, '\n'), FileMode(defaultFileMode)); err != nil {
+		return fmt.Errorf("failed to write metadata file, err: %v", err)
+	}
+	return nil
+}
+
+// ReadMetadata returns the contents of the metadata file in the directory.
+// Empty metadata are returned if the file doesn't exist.
+func ReadMetadata(dir string) (Metadata, error) {
+	var metadata Metadata
+	data, err := ioutil.ReadFile(filepath.Join(dir, MetadataFile))
+	if os.IsNotExist(err) {
+		return metadata, nil
+	}
+	if err != nil {
+		return metadata, fmt.Errorf("failed to read metadata file, err: %v", err)
+	}
+	if err = json.Unmarshal(data, &metadata); err != nil {
+		return metadata, fmt.Errorf("failed to parse metadata file, err: %v", err)
+	}
+	return metadata, nil
+}
@@ -0,0 +1,74 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fileutil
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestWriteMetadata(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ut")
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// empty metadata are returned before the metadata file is written
+	metadata, err := ReadMetadata(dir)
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	if len(metadata.Objects) != 0 {
+		t.Errorf("expected no objects, got: %+v", metadata.Objects)
+	}
+
+	dataDir, err := NewDataDir(dir)
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	expected := Metadata{Objects: []ObjectMetadata{
+		{ID: "secret/secret1", Version: "v1", FetchTime: time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC)},
+		{ID: "secret/secret2", Version: "v2", FetchTime: time.Date(2021, 3, 4, 5, 6, 8, 0, time.UTC)},
+	}}
+	if err := WriteMetadata(dataDir, expected); err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	if err := PublishDataDir(dir, dataDir); err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	metadata, err = ReadMetadata(dir)
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	if !reflect.DeepEqual(metadata, expected) {
+		t.Errorf("expected metadata: %+v, got: %+v", expected, metadata)
+	}
+
+	// the metadata file isn't copied to a new data directory
+	next, err := NewDataDir(dir)
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	if _, err := os.Stat(filepath.Join(next, MetadataFile)); !os.IsNotExist(err) {
+		t.Errorf("expected metadata file to not be copied, got: %+v", err)
+	}
+}
@@ -0,0 +1,359 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fileutil
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"sigs.k8s.io/secrets-store-csi-driver/provider/v1alpha1"
+)
+
+const (
+	// defaultFileMode is used when the provider doesn't set the mode for a file
+	defaultFileMode os.FileMode = 0644
+	// DataVersionFile is the sentinel file in the target path that is updated
+	// every time the mounted files are written, so applications can watch a
+	// single file to reload the mounted contents
+	DataVersionFile = "..data_version"
+)
+
+// WritePayloads writes the files returned by the provider to the target path.
+// The payloads are validated before any file is written.
+func WritePayloads(path string, payloads []*v1alpha1.File) error {
+	if err := ValidatePayloads(payloads); err != nil {
+		return err
+	}
+	for _, payload := range payloads {
+		mode := os.FileMode(payload.GetMode())
+		if mode == 0 {
+			mode = defaultFileMode
+		}
+		p := filepath.Join(path, payload.GetPath())
+		// the parent directories of nested paths, e.g. the path of an object
+		// with a provider-specific name, are created
+		if err := MkdirParents(path, payload.GetPath()); err != nil {
+			return fmt.Errorf("failed to create directory of file %s, err: %v", payload.GetPath(), err)
+		}
+		if err := ioutil.WriteFile(p, payload.GetContents(), FileMode(mode)); err != nil {
+			return fmt.Errorf("failed to write file %s, err: %v", payload.GetPath(), err)
+		}
+	}
+	return nil
+}
+
+// FileMode returns the mode the files are written with. On windows, a mode
+// without the owner write permission sets the read-only attribute of the file,
+// which prevents the driver from replacing the file when it is rotated, so the
+// files are kept writable. The pods mount the volumes read-only.
+func FileMode(mode os.FileMode) os.FileMode {
+	if runtime.GOOS == "windows" {
+		return mode | 0200
+	}
+	return mode
+}
+
+// ValidatePayloads returns an error if a file path is empty, absolute, contains
+// '..' elements or is used by more than one file, so files can't be written
+// outside the target path or overwrite each other.
+func ValidatePayloads(payloads []*v1alpha1.File) error {
+	paths := make(map[string]bool, len(payloads))
+	for _, payload := range payloads {
+		if err := ValidatePath(payload.GetPath()); err != nil {
+			return err
+		}
+		p := filepath.Clean(payload.GetPath())
+		if paths[p] {
+			return fmt.Errorf("invalid file path %q, duplicate path", payload.GetPath())
+		}
+		paths[p] = true
+	}
+	return nil
+}
+
+// ValidatePath validates the file path relative to the target path
+func ValidatePath(p string) error {
+	if len(p) == 0 {
+		return fmt.Errorf("invalid file path, path is empty")
+	}
+	// windows absolute paths are rejected on all platforms
+	if filepath.IsAbs(p) || strings.HasPrefix(p, "/") || strings.HasPrefix(p, `\`) || (len(p) > 1 && p[1] == ':') {
+		return fmt.Errorf("invalid file path %q, path must be relative", p)
+	}
+	for _, element := range strings.FieldsFunc(p, func(r rune) bool { return r == '/' || r == '\\' }) {
+		if element == ".." {
+			return fmt.Errorf("invalid file path %q, path must not contain '..'", p)
+		}
+		if runtime.GOOS == "windows" {
+			if err := validateWindowsPathElement(element); err != nil {
+				return fmt.Errorf("invalid file path %q, %v", p, err)
+			}
+		}
+	}
+	return nil
+}
+
+// windowsReservedNames are the device names that can't be used as file names
+// on windows, with or without an extension
+var windowsReservedNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true, "COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true, "LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// validateWindowsPathElement returns an error if the path element isn't a
+// valid file name on windows, so a file can't be written to a device or to
+// another file than the one it is named after
+func validateWindowsPathElement(element string) error {
+	if element == "." {
+		return nil
+	}
+	for _, r := range element {
+		if r < 32 || strings.ContainsRune(`<>:"|?*`, r) {
+			return fmt.Errorf("path must not contain control characters or any of <>:\"|?*")
+		}
+	}
+	if strings.HasSuffix(element, ".") || strings.HasSuffix(element, " ") {
+		return fmt.Errorf("path elements must not end with a dot or a space")
+	}
+	name := strings.ToUpper(element)
+	if i := strings.IndexByte(name, '.'); i >= 0 {
+		name = name[:i]
+	}
+	if windowsReservedNames[strings.TrimRight(name, " ")] {
+		return fmt.Errorf("%s is a reserved file name", element)
+	}
+	return nil
+}
+
+// MkdirParents creates the parent directories of the file path relative to
+// the root path. Unlike os.MkdirAll, it returns an error if an existing parent
+// is a symlink or isn't a directory, so a file can't be written outside the
+// root path through a symlink.
+func MkdirParents(root, p string) error {
+	return walkParents(root, p, true)
+}
+
+// ValidateParents returns an error if an existing parent directory of the file
+// path relative to the root path is a symlink or isn't a directory, so a file
+// can't be read or moved from outside the root path through a symlink.
+func ValidateParents(root, p string) error {
+	return walkParents(root, p, false)
+}
+
+// walkParents checks the parent directories of the file path relative to the
+// root path, from the root path down, and creates the missing ones if create
+// is set
+func walkParents(root, p string, create bool) error {
+	if err := ValidatePath(p); err != nil {
+		return err
+	}
+	dir := root
+	elements := strings.FieldsFunc(filepath.Clean(p), func(r rune) bool { return r == '/' || r == '\\' })
+	for i := 0; i < len(elements)-1; i++ {
+		dir = filepath.Join(dir, elements[i])
+		info, err := os.Lstat(dir)
+		if os.IsNotExist(err) {
+			if !create {
+				return nil
+			}
+			if err := os.Mkdir(dir, 0755); err != nil {
+				return err
+			}
+			continue
+		} else if err != nil {
+			return err
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("invalid file path %q, parent directory %s is a symlink", p, filepath.Join(elements[:i+1]...))
+		}
+		if !info.IsDir() {
+			return fmt.Errorf("invalid file path %q, parent %s isn't a directory", p, filepath.Join(elements[:i+1]...))
+		}
+	}
+	return nil
+}
+
+// ValidateTargetPath returns an error if the target path doesn't contain any
+// file or if a file in the target path is larger than maxFileSize bytes. A zero
+// maxFileSize doesn't limit the file size.
+func ValidateTargetPath(path string, maxFileSize int64) error {
+	var count int
+	err := filepath.Walk(path, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		count++
+		if maxFileSize > 0 && info.Size() > maxFileSize {
+			return fmt.Errorf("file %s size %d exceeds the maximum file size %d", info.Name(), info.Size(), maxFileSize)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return fmt.Errorf("no files were written to the target path")
+	}
+	return nil
+}
+
+// ReadPayloads returns the files written to the target path, with their path
+// relative to the target path, including the files in nested directories. The
+// files managed by the driver at the top of the target path, the checksums and
+// metadata files and the symlinks aren't returned.
+func ReadPayloads(path string) ([]*v1alpha1.File, error) {
+	var payloads []*v1alpha1.File
+	err := filepath.Walk(path, func(p string, info os.FileInfo, err error) error {
+		if err != nil || p == path {
+			return err
+		}
+		rel, err := filepath.Rel(path, p)
+		if err != nil {
+			return err
+		}
+		if rel == info.Name() && (driverFile(rel) || rel == ChecksumsFile || rel == MetadataFile) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		contents, err := ioutil.ReadFile(p)
+		if err != nil {
+			return fmt.Errorf("failed to read file %s, err: %v", rel, err)
+		}
+		payloads = append(payloads, &v1alpha1.File{
+			Path:     filepath.ToSlash(rel),
+			Mode:     int32(info.Mode().Perm()),
+			Contents: contents,
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return payloads, nil
+}
+
+// WriteDataVersion writes the version to the data version file in the target
+// path. The file is replaced atomically and its modification time is updated
+// even if the version didn't change.
+func WriteDataVersion(path, version string) error {
+	tmp, err := ioutil.TempFile(path, DataVersionFile+".tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create data version file, err: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err = tmp.WriteString(version + "\n"); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write data version file, err: %v", err)
+	}
+	if err = tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write data version file, err: %v", err)
+	}
+	if err = os.Chmod(tmp.Name(), defaultFileMode); err != nil {
+		return fmt.Errorf("failed to set data version file mode, err: %v", err)
+	}
+	p := filepath.Join(path, DataVersionFile)
+	if err = os.Rename(tmp.Name(), p); err != nil {
+		return fmt.Errorf("failed to replace data version file, err: %v", err)
+	}
+	now := time.Now()
+	return os.Chtimes(p, now, now)
+}
+
+// SetOwnership changes the owner of the files and directories in the path to
+// the uid and gid, -1 keeps the owner or the group. If the gid is set, the
+// files are made readable and the directories searchable by the group. The
+// ownership isn't changed on windows.
+func SetOwnership(path string, uid, gid int) error {
+	if runtime.GOOS == "windows" || (uid < 0 && gid < 0) {
+		return nil
+	}
+	return filepath.Walk(path, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := os.Lchown(p, uid, gid); err != nil {
+			return fmt.Errorf("failed to change owner of %s, err: %v", info.Name(), err)
+		}
+		if gid < 0 || info.Mode()&os.ModeSymlink != 0 {
+			return nil
+		}
+		mode := info.Mode().Perm() | 0040
+		if info.IsDir() {
+			mode |= 0010
+		}
+		return os.Chmod(p, mode)
+	})
+}
+
+// SameContents returns true if the files have the same mode and the same
+// contents hash. False is returned if the second file doesn't exist.
+func SameContents(path1, path2 string) (bool, error) {
+	info1, err := os.Stat(path1)
+	if err != nil {
+		return false, err
+	}
+	info2, err := os.Stat(path2)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if info1.Mode() != info2.Mode() || info1.Size() != info2.Size() {
+		return false, nil
+	}
+	hash1, err := fileHash(path1)
+	if err != nil {
+		return false, err
+	}
+	hash2, err := fileHash(path2)
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(hash1, hash2), nil
+}
+
+// fileHash returns the sha256 hash of the file contents
+func fileHash(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
@@ -0,0 +1,77 @@
+//go:build linux
+// +build linux
+
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fileutil
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestSetOwnership(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("changing the owner of files requires root")
+	}
+	dir, err := ioutil.TempDir("", "ut")
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.Mkdir(filepath.Join(dir, "certs"), 0700); err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	if err := os.Chmod(filepath.Join(dir, "certs"), 0700); err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "certs", "cert1"), []byte("cert1"), 0600); err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+
+	if err := SetOwnership(dir, 1000, 2000); err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	for name, expectedMode := range map[string]os.FileMode{"certs": 0750, "certs/cert1": 0640} {
+		info, err := os.Stat(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatalf("expected err to be nil, got: %+v", err)
+		}
+		stat := info.Sys().(*syscall.Stat_t)
+		if stat.Uid != 1000 || stat.Gid != 2000 {
+			t.Errorf("expected %s to be owned by 1000:2000, got: %d:%d", name, stat.Uid, stat.Gid)
+		}
+		if info.Mode().Perm() != expectedMode {
+			t.Errorf("expected mode of %s: %v, got: %v", name, expectedMode, info.Mode().Perm())
+		}
+	}
+
+	// the group and the mode aren't changed without a gid
+	if err := SetOwnership(dir, 0, -1); err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	info, err := os.Stat(filepath.Join(dir, "certs", "cert1"))
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	if stat := info.Sys().(*syscall.Stat_t); stat.Uid != 0 || stat.Gid != 2000 {
+		t.Errorf("expected cert1 to be owned by 0:2000, got: %d:%d", stat.Uid, stat.Gid)
+	}
+}
@@ -0,0 +1,409 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fileutil
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"sigs.k8s.io/secrets-store-csi-driver/provider/v1alpha1"
+)
+
+func TestValidatePayloads(t *testing.T) {
+	cases := []struct {
+		name        string
+		payloads    []*v1alpha1.File
+		expectedErr bool
+	}{
+		{
+			name:     "valid paths",
+			payloads: []*v1alpha1.File{{Path: "secret1"}, {Path: "certs/cert1"}, {Path: "..secret"}},
+		},
+		{
+			name:        "empty path",
+			payloads:    []*v1alpha1.File{{Path: ""}},
+			expectedErr: true,
+		},
+		{
+			name:        "absolute path",
+			payloads:    []*v1alpha1.File{{Path: "/etc/passwd"}},
+			expectedErr: true,
+		},
+		{
+			name:        "windows absolute path",
+			payloads:    []*v1alpha1.File{{Path: `c:\windows\secret1`}},
+			expectedErr: true,
+		},
+		{
+			name:        "path traversal",
+			payloads:    []*v1alpha1.File{{Path: "../secret1"}},
+			expectedErr: true,
+		},
+		{
+			name:        "nested path traversal",
+			payloads:    []*v1alpha1.File{{Path: `certs\..\..\secret1`}},
+			expectedErr: true,
+		},
+		{
+			name:        "duplicate paths",
+			payloads:    []*v1alpha1.File{{Path: "secret1"}, {Path: "./secret1"}},
+			expectedErr: true,
+		},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			err := ValidatePayloads(test.payloads)
+			if test.expectedErr && err == nil || !test.expectedErr && err != nil {
+				t.Fatalf("expected err: %v, got: %+v", test.expectedErr, err)
+			}
+		})
+	}
+}
+
+func TestValidateWindowsPathElement(t *testing.T) {
+	cases := []struct {
+		element     string
+		expectedErr bool
+	}{
+		{element: "secret1"},
+		{element: "."},
+		{element: "..secret"},
+		{element: "tls.crt"},
+		{element: "console"},
+		{element: "COM10"},
+		{element: "secret:stream", expectedErr: true},
+		{element: "secret?", expectedErr: true},
+		{element: "secret\x01", expectedErr: true},
+		{element: "secret.", expectedErr: true},
+		{element: "secret ", expectedErr: true},
+		{element: "nul", expectedErr: true},
+		{element: "CON.txt", expectedErr: true},
+		{element: "Lpt1.tar.gz", expectedErr: true},
+		{element: "aux .txt", expectedErr: true},
+	}
+
+	for _, test := range cases {
+		t.Run(test.element, func(t *testing.T) {
+			err := validateWindowsPathElement(test.element)
+			if test.expectedErr && err == nil || !test.expectedErr && err != nil {
+				t.Fatalf("expected err: %v, got: %+v", test.expectedErr, err)
+			}
+		})
+	}
+}
+
+func TestWritePayloadsInvalidPath(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ut")
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	payloads := []*v1alpha1.File{
+		{Path: "secret1", Contents: []byte("value1")},
+		{Path: "../secret2", Contents: []byte("value2")},
+	}
+	if err := WritePayloads(dir, payloads); err == nil {
+		t.Fatalf("expected err to be not nil")
+	}
+	// no file is written if any of the payloads is invalid
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	if len(files) != 0 {
+		t.Errorf("expected no files in the target path, got: %d", len(files))
+	}
+}
+
+func TestMkdirParents(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ut")
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	defer os.RemoveAll(dir)
+	outside, err := ioutil.TempDir("", "ut")
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	defer os.RemoveAll(outside)
+	if err := os.Symlink(outside, filepath.Join(dir, "link")); err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "file"), []byte("value"), 0644); err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+
+	cases := []struct {
+		name        string
+		path        string
+		expectedErr bool
+	}{
+		{name: "file in the root path", path: "secret1"},
+		{name: "nested file", path: "certs/tls/tls.crt"},
+		{name: "existing parent directory", path: "certs/tls.key"},
+		{name: "parent directory outside of the root path", path: "../certs/tls.crt", expectedErr: true},
+		{name: "symlink parent directory", path: "link/tls.crt", expectedErr: true},
+		{name: "nested symlink parent directory", path: "link/certs/tls.crt", expectedErr: true},
+		{name: "file parent directory", path: "file/tls.crt", expectedErr: true},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			err := MkdirParents(dir, test.path)
+			if test.expectedErr != (err != nil) {
+				t.Fatalf("expected err: %v, got: %+v", test.expectedErr, err)
+			}
+			if test.expectedErr {
+				return
+			}
+			if info, err := os.Stat(filepath.Dir(filepath.Join(dir, test.path))); err != nil || !info.IsDir() {
+				t.Fatalf("expected parent directory of %s to be created, got: %+v", test.path, err)
+			}
+		})
+	}
+	// no directory is created through the symlink
+	if files, _ := ioutil.ReadDir(outside); len(files) != 0 {
+		t.Errorf("expected no files outside of the root path, got: %d", len(files))
+	}
+}
+
+func TestValidateParents(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ut")
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.Symlink(os.TempDir(), filepath.Join(dir, "link")); err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+
+	if err := ValidateParents(dir, "missing/secret1"); err != nil {
+		t.Errorf("expected err to be nil, got: %+v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "missing")); !os.IsNotExist(err) {
+		t.Errorf("expected missing parent directory not to be created, got: %+v", err)
+	}
+	if err := ValidateParents(dir, "link/secret1"); err == nil {
+		t.Errorf("expected err to be not nil")
+	}
+}
+
+func TestValidateTargetPath(t *testing.T) {
+	cases := []struct {
+		name        string
+		files       map[string]string
+		maxFileSize int64
+		expectedErr bool
+	}{
+		{
+			name:        "no files",
+			expectedErr: true,
+		},
+		{
+			name:  "no maximum file size",
+			files: map[string]string{"secret1": "value1"},
+		},
+		{
+			name:        "files within the maximum file size",
+			files:       map[string]string{"secret1": "value1", "secret2": "value2"},
+			maxFileSize: 6,
+		},
+		{
+			name:        "file exceeds the maximum file size",
+			files:       map[string]string{"secret1": "value1", "secret2": "a longer value2"},
+			maxFileSize: 6,
+			expectedErr: true,
+		},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "ut")
+			if err != nil {
+				t.Fatalf("expected err to be nil, got: %+v", err)
+			}
+			defer os.RemoveAll(dir)
+			for name, contents := range test.files {
+				if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(contents), 0644); err != nil {
+					t.Fatalf("expected err to be nil, got: %+v", err)
+				}
+			}
+
+			err = ValidateTargetPath(dir, test.maxFileSize)
+			if test.expectedErr && err == nil || !test.expectedErr && err != nil {
+				t.Fatalf("expected err: %v, got: %+v", test.expectedErr, err)
+			}
+		})
+	}
+}
+
+func TestWriteDataVersion(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ut")
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	p := filepath.Join(dir, DataVersionFile)
+	var modTime time.Time
+	for _, version := range []string{"v1", "v1", "v2"} {
+		if err := WriteDataVersion(dir, version); err != nil {
+			t.Fatalf("expected err to be nil, got: %+v", err)
+		}
+		contents, err := ioutil.ReadFile(p)
+		if err != nil {
+			t.Fatalf("expected err to be nil, got: %+v", err)
+		}
+		if string(contents) != version+"\n" {
+			t.Errorf("expected data version: %s, got: %s", version, string(contents))
+		}
+		info, err := os.Stat(p)
+		if err != nil {
+			t.Fatalf("expected err to be nil, got: %+v", err)
+		}
+		if info.ModTime().Before(modTime) {
+			t.Errorf("expected modification time to be updated, got: %v before %v", info.ModTime(), modTime)
+		}
+		modTime = info.ModTime()
+	}
+
+	// only the data version file is left in the target path
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	if len(files) != 1 {
+		t.Errorf("expected only the data version file in the target path, got: %d files", len(files))
+	}
+	payloads, err := ReadPayloads(dir)
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	if len(payloads) != 0 {
+		t.Errorf("expected data version file to be excluded from the payloads, got: %d", len(payloads))
+	}
+}
+
+func TestReadPayloads(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ut")
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	payloads := []*v1alpha1.File{
+		{Path: "secret1", Contents: []byte("value1"), Mode: 0600},
+		{Path: "certs/tls.crt", Contents: []byte("cert1"), Mode: 0644},
+	}
+	if err := WritePayloads(dir, payloads); err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	// the files managed by the driver and the symlinks aren't read
+	if err := WriteDataVersion(dir, "1"); err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	dataDir, err := NewDataDir(dir)
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, MetadataFile), []byte("{}"), 0644); err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	if err := os.Symlink(filepath.Join(filepath.Base(dataDir), "secret1"), filepath.Join(dir, "link1")); err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+
+	read, err := ReadPayloads(dir)
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	sort.Slice(read, func(i, j int) bool { return read[i].Path < read[j].Path })
+	sort.Slice(payloads, func(i, j int) bool { return payloads[i].Path < payloads[j].Path })
+	if !reflect.DeepEqual(read, payloads) {
+		t.Errorf("expected payloads: %v, got: %v", payloads, read)
+	}
+}
+
+func TestSameContents(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ut")
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := []struct {
+		name     string
+		contents string
+		mode     os.FileMode
+	}{
+		{name: "file1", contents: "value1", mode: 0644},
+		{name: "file2", contents: "value1", mode: 0644},
+		{name: "file3", contents: "value2", mode: 0644},
+		{name: "file4", contents: "value1", mode: 0600},
+	}
+	for _, f := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, f.name), []byte(f.contents), f.mode); err != nil {
+			t.Fatalf("expected err to be nil, got: %+v", err)
+		}
+		if err := os.Chmod(filepath.Join(dir, f.name), f.mode); err != nil {
+			t.Fatalf("expected err to be nil, got: %+v", err)
+		}
+	}
+
+	cases := []struct {
+		name         string
+		file         string
+		expectedSame bool
+	}{
+		{
+			name:         "same contents",
+			file:         "file2",
+			expectedSame: true,
+		},
+		{
+			name: "different contents",
+			file: "file3",
+		},
+		{
+			name: "different mode",
+			file: "file4",
+		},
+		{
+			name: "file doesn't exist",
+			file: "file5",
+		},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			same, err := SameContents(filepath.Join(dir, "file1"), filepath.Join(dir, test.file))
+			if err != nil {
+				t.Fatalf("expected err to be nil, got: %+v", err)
+			}
+			if same != test.expectedSame {
+				t.Errorf("expected same contents: %v, got: %v", test.expectedSame, same)
+			}
+		})
+	}
+}
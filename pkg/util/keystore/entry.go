@@ -0,0 +1,133 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package keystore encodes a private key and its certificate chain into the
+// PKCS#12 and Java keystore files read by JVM workloads
+package keystore
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"strings"
+	"unicode/utf16"
+)
+
+// Entry is a private key with its certificate chain, stored in a keystore
+// under its alias
+type Entry struct {
+	Alias      string
+	PrivateKey crypto.PrivateKey
+	// Certificates are the certificate of the private key followed by the
+	// certificates of its CA chain
+	Certificates []*x509.Certificate
+}
+
+// ParsePEM returns the entry of the private key and the certificates in the
+// PEM bundle. The certificate of the private key is moved to the front of the
+// certificates, the other certificates are kept in order. The text around
+// the PEM blocks is ignored.
+func ParsePEM(alias string, bundle []byte) (*Entry, error) {
+	entry := &Entry{Alias: alias}
+	var certs []*x509.Certificate
+	for block, rest := pem.Decode(bundle); block != nil; block, rest = pem.Decode(rest) {
+		switch {
+		case strings.HasSuffix(block.Type, "PRIVATE KEY"):
+			if entry.PrivateKey != nil {
+				return nil, fmt.Errorf("PEM bundle contains more than one private key")
+			}
+			key, err := parsePrivateKey(block.Bytes)
+			if err != nil {
+				return nil, err
+			}
+			entry.PrivateKey = key
+		case block.Type == "CERTIFICATE":
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse certificate, err: %v", err)
+			}
+			certs = append(certs, cert)
+		default:
+			return nil, fmt.Errorf("unsupported PEM block type %s", block.Type)
+		}
+	}
+	if entry.PrivateKey == nil {
+		return nil, fmt.Errorf("PEM bundle contains no private key")
+	}
+	signer, ok := entry.PrivateKey.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported private key type %T", entry.PrivateKey)
+	}
+	publicKey, err := x509.MarshalPKIXPublicKey(signer.Public())
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal public key, err: %v", err)
+	}
+	for i, cert := range certs {
+		if bytes.Equal(cert.RawSubjectPublicKeyInfo, publicKey) {
+			entry.Certificates = append([]*x509.Certificate{cert}, append(certs[:i:i], certs[i+1:]...)...)
+			return entry, nil
+		}
+	}
+	return nil, fmt.Errorf("PEM bundle contains no certificate of the private key")
+}
+
+// parsePrivateKey parses a PKCS#8, PKCS#1 or EC private key
+func parsePrivateKey(der []byte) (crypto.PrivateKey, error) {
+	if key, err := x509.ParsePKCS8PrivateKey(der); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(der); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParseECPrivateKey(der); err == nil {
+		return key, nil
+	}
+	return nil, fmt.Errorf("failed to parse private key, only PKCS#8, PKCS#1 and EC private keys are supported")
+}
+
+// salt returns a salt of length n derived from the password and the entry, so
+// encoding the same entry with the same password returns the same keystore
+// and a rotation only rewrites the keystore when its contents changed. Every
+// purpose gets a different salt.
+func salt(password string, entry *Entry, purpose string, n int) ([]byte, error) {
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(entry.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal private key, err: %v", err)
+	}
+	mac := hmac.New(sha256.New, []byte(password))
+	mac.Write([]byte(purpose))
+	mac.Write([]byte(entry.Alias))
+	mac.Write(pkcs8)
+	for _, cert := range entry.Certificates {
+		mac.Write(cert.Raw)
+	}
+	return mac.Sum(nil)[:n], nil
+}
+
+// utf16BE returns the string encoded as big-endian UTF-16, the encoding of the
+// keystore passwords
+func utf16BE(s string) []byte {
+	encoded := utf16.Encode([]rune(s))
+	b := make([]byte, 0, 2*len(encoded))
+	for _, c := range encoded {
+		b = append(b, byte(c>>8), byte(c))
+	}
+	return b
+}
@@ -0,0 +1,134 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package keystore
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/binary"
+	"fmt"
+)
+
+const (
+	// jksMagic and jksVersion start a Java keystore file
+	jksMagic   = 0xfeedfeed
+	jksVersion = 2
+	// jksPrivateKeyEntry is the tag of a private key entry
+	jksPrivateKeyEntry = 1
+	// jksIntegrityLabel is hashed with the password and the keystore into the
+	// integrity digest at the end of the keystore
+	jksIntegrityLabel = "Mighty Aphrodite"
+)
+
+// oidJKSKeyProtector is the algorithm of the private keys protected by the Sun
+// key protector of the Java keystores
+var oidJKSKeyProtector = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 42, 2, 17, 1, 1}
+
+// EncodeJKS returns the Java keystore file of the entry, with the private key
+// protected by the password and the keystore authenticated with the password.
+// The creation date of the entry is the start of the validity of its
+// certificate, so the same entry returns the same keystore.
+func EncodeJKS(entry *Entry, password string) ([]byte, error) {
+	if len(entry.Certificates) == 0 {
+		return nil, fmt.Errorf("entry has no certificate")
+	}
+	if len(entry.Alias) == 0 {
+		return nil, fmt.Errorf("entry has no alias")
+	}
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(entry.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal private key, err: %v", err)
+	}
+	keySalt, err := salt(password, entry, "jks private key", sha1.Size)
+	if err != nil {
+		return nil, err
+	}
+	protectedKey, err := asn1.Marshal(encryptedPrivateKeyInfo{
+		EncryptionAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidJKSKeyProtector, Parameters: asn1.NullRawValue},
+		EncryptedData:       protectJKSKey(utf16BE(password), keySalt, pkcs8),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	for _, v := range []uint32{jksMagic, jksVersion, 1, jksPrivateKeyEntry} {
+		binary.Write(&buf, binary.BigEndian, v)
+	}
+	if err := writeJKSString(&buf, entry.Alias); err != nil {
+		return nil, err
+	}
+	binary.Write(&buf, binary.BigEndian, entry.Certificates[0].NotBefore.UnixNano()/1e6)
+	binary.Write(&buf, binary.BigEndian, uint32(len(protectedKey)))
+	buf.Write(protectedKey)
+	binary.Write(&buf, binary.BigEndian, uint32(len(entry.Certificates)))
+	for _, cert := range entry.Certificates {
+		if err := writeJKSString(&buf, "X.509"); err != nil {
+			return nil, err
+		}
+		binary.Write(&buf, binary.BigEndian, uint32(len(cert.Raw)))
+		buf.Write(cert.Raw)
+	}
+
+	h := sha1.New()
+	h.Write(utf16BE(password))
+	h.Write([]byte(jksIntegrityLabel))
+	h.Write(buf.Bytes())
+	buf.Write(h.Sum(nil))
+	return buf.Bytes(), nil
+}
+
+// protectJKSKey protects the private key with the Sun key protector: the key
+// is XORed with a keystream of chained SHA-1 digests of the password and the
+// salt, and followed by the SHA-1 digest of the password and the key
+func protectJKSKey(password, salt, key []byte) []byte {
+	protected := append([]byte{}, salt...)
+	digest := salt
+	for offset := 0; offset < len(key); offset += sha1.Size {
+		h := sha1.New()
+		h.Write(password)
+		h.Write(digest)
+		digest = h.Sum(nil)
+		for i := 0; i < len(digest) && offset+i < len(key); i++ {
+			protected = append(protected, key[offset+i]^digest[i])
+		}
+	}
+	h := sha1.New()
+	h.Write(password)
+	h.Write(key)
+	return h.Sum(protected)
+}
+
+// writeJKSString writes the string with its 2 byte length, the encoding of
+// Java's DataOutput.writeUTF for strings without null characters and
+// supplementary characters
+func writeJKSString(buf *bytes.Buffer, s string) error {
+	for _, r := range s {
+		if r == 0 || r > 0xffff {
+			return fmt.Errorf("string %q contains characters not supported by the keystore", s)
+		}
+	}
+	if len(s) > 0xffff {
+		return fmt.Errorf("string of length %d is too long for the keystore", len(s))
+	}
+	binary.Write(buf, binary.BigEndian, uint16(len(s)))
+	buf.WriteString(s)
+	return nil
+}
@@ -0,0 +1,160 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package keystore
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/binary"
+	"io"
+	"testing"
+)
+
+// readJKS reads the private key entry of a Java keystore with a single entry,
+// the way Java's JavaKeyStore reads it, and returns the alias, the creation
+// date, the PKCS#8 private key and the certificates of the entry
+func readJKS(t *testing.T, jks []byte, password string) (string, int64, []byte, [][]byte) {
+	if len(jks) < sha1.Size {
+		t.Fatalf("expected keystore of %d bytes to end with the integrity digest", len(jks))
+	}
+	contents, integrity := jks[:len(jks)-sha1.Size], jks[len(jks)-sha1.Size:]
+	h := sha1.New()
+	h.Write(utf16BE(password))
+	h.Write([]byte(jksIntegrityLabel))
+	h.Write(contents)
+	if !bytes.Equal(h.Sum(nil), integrity) {
+		t.Fatalf("expected valid integrity digest")
+	}
+
+	r := bytes.NewReader(contents)
+	read := func(v interface{}) {
+		if err := binary.Read(r, binary.BigEndian, v); err != nil {
+			t.Fatalf("expected err to be nil, got: %+v", err)
+		}
+	}
+	readBytes := func(n int) []byte {
+		b := make([]byte, n)
+		if _, err := io.ReadFull(r, b); err != nil {
+			t.Fatalf("expected err to be nil, got: %+v", err)
+		}
+		return b
+	}
+	readString := func() string {
+		var n uint16
+		read(&n)
+		return string(readBytes(int(n)))
+	}
+	var magic, version, count, tag uint32
+	read(&magic)
+	read(&version)
+	read(&count)
+	read(&tag)
+	if magic != jksMagic || version != jksVersion || count != 1 || tag != jksPrivateKeyEntry {
+		t.Fatalf("expected a keystore with a private key entry, got magic: %x, version: %d, entries: %d, tag: %d", magic, version, count, tag)
+	}
+	alias := readString()
+	var created int64
+	read(&created)
+	var keyLen uint32
+	read(&keyLen)
+	var info encryptedPrivateKeyInfo
+	if _, err := asn1.Unmarshal(readBytes(int(keyLen)), &info); err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	if !info.EncryptionAlgorithm.Algorithm.Equal(oidJKSKeyProtector) {
+		t.Fatalf("expected key protector algorithm, got: %v", info.EncryptionAlgorithm.Algorithm)
+	}
+
+	// the key protector XORs the key with the chained digests of the password
+	// and the salt, and appends the digest of the password and the key
+	protected := info.EncryptedData
+	salt, encrypted, check := protected[:sha1.Size], protected[sha1.Size:len(protected)-sha1.Size], protected[len(protected)-sha1.Size:]
+	key := make([]byte, len(encrypted))
+	digest := salt
+	for offset := 0; offset < len(encrypted); offset += sha1.Size {
+		h.Reset()
+		h.Write(utf16BE(password))
+		h.Write(digest)
+		digest = h.Sum(nil)
+		for i := 0; i < sha1.Size && offset+i < len(encrypted); i++ {
+			key[offset+i] = encrypted[offset+i] ^ digest[i]
+		}
+	}
+	h.Reset()
+	h.Write(utf16BE(password))
+	h.Write(key)
+	if !bytes.Equal(h.Sum(nil), check) {
+		t.Fatalf("expected valid digest of the protected key")
+	}
+
+	var certCount uint32
+	read(&certCount)
+	var certs [][]byte
+	for i := uint32(0); i < certCount; i++ {
+		if certType := readString(); certType != "X.509" {
+			t.Fatalf("expected X.509 certificate, got: %s", certType)
+		}
+		var certLen uint32
+		read(&certLen)
+		certs = append(certs, readBytes(int(certLen)))
+	}
+	if r.Len() != 0 {
+		t.Fatalf("expected no data after the entry, got: %d bytes", r.Len())
+	}
+	return alias, created, key, certs
+}
+
+func TestEncodeJKS(t *testing.T) {
+	_, entry := testEntry(t)
+	jks, err := EncodeJKS(entry, "changeit")
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+
+	alias, created, key, certs := readJKS(t, jks, "changeit")
+	if alias != "tls" {
+		t.Fatalf("expected alias: tls, got: %s", alias)
+	}
+	if expected := entry.Certificates[0].NotBefore.UnixNano() / 1e6; created != expected {
+		t.Fatalf("expected creation date: %d, got: %d", expected, created)
+	}
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(entry.PrivateKey)
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	if !bytes.Equal(key, pkcs8) {
+		t.Fatalf("expected the private key of the entry")
+	}
+	if len(certs) != 2 || !bytes.Equal(certs[0], entry.Certificates[0].Raw) || !bytes.Equal(certs[1], entry.Certificates[1].Raw) {
+		t.Fatalf("expected the 2 certificates of the entry, got: %d certificates", len(certs))
+	}
+
+	again, err := EncodeJKS(entry, "changeit")
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	if !bytes.Equal(jks, again) {
+		t.Fatalf("expected the same keystore for the same entry")
+	}
+
+	entry.Alias = ""
+	if _, err := EncodeJKS(entry, "changeit"); err == nil {
+		t.Fatalf("expected err for entry without alias, got nil")
+	}
+}
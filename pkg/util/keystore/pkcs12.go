@@ -0,0 +1,316 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package keystore
+
+import (
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+)
+
+// pkcs12Iterations is the number of iterations of the key derivation of the
+// PKCS#12 encryption and MAC keys
+const pkcs12Iterations = 2048
+
+var (
+	oidData                 = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidEncryptedData        = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 6}
+	oidPBEWithSHAAnd3DESCBC = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 1, 3}
+	oidPKCS8ShroudedKeyBag  = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 10, 1, 2}
+	oidCertBag              = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 10, 1, 3}
+	oidX509Certificate      = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 22, 1}
+	oidFriendlyName         = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 20}
+	oidLocalKeyID           = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 21}
+	oidSHA1                 = asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}
+)
+
+type pfxPdu struct {
+	Version  int
+	AuthSafe contentInfo
+	MacData  macData
+}
+
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"tag:0,explicit"`
+}
+
+type encryptedData struct {
+	Version              int
+	EncryptedContentInfo encryptedContentInfo
+}
+
+type encryptedContentInfo struct {
+	ContentType                asn1.ObjectIdentifier
+	ContentEncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedContent           []byte `asn1:"tag:0"`
+}
+
+type encryptedPrivateKeyInfo struct {
+	EncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedData       []byte
+}
+
+type pbeParams struct {
+	Salt       []byte
+	Iterations int
+}
+
+type safeBag struct {
+	ID         asn1.ObjectIdentifier
+	Value      asn1.RawValue     `asn1:"tag:0,explicit"`
+	Attributes []pkcs12Attribute `asn1:"set,optional"`
+}
+
+type pkcs12Attribute struct {
+	ID     asn1.ObjectIdentifier
+	Values []asn1.RawValue `asn1:"set"`
+}
+
+type certBag struct {
+	ID   asn1.ObjectIdentifier
+	Data []byte `asn1:"tag:0,explicit"`
+}
+
+type macData struct {
+	Mac        digestInfo
+	MacSalt    []byte
+	Iterations int
+}
+
+type digestInfo struct {
+	Algorithm pkix.AlgorithmIdentifier
+	Digest    []byte
+}
+
+// EncodePKCS12 returns the PKCS#12 file of the entry encrypted with the
+// password. The private key and the certificates are encrypted with
+// pbeWithSHAAnd3-KeyTripleDES-CBC and the file is authenticated with an
+// HMAC-SHA1, the algorithms read by all the versions of Java and OpenSSL.
+func EncodePKCS12(entry *Entry, password string) ([]byte, error) {
+	if len(entry.Certificates) == 0 {
+		return nil, fmt.Errorf("entry has no certificate")
+	}
+	bmpPassword := bmpString(password)
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(entry.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal private key, err: %v", err)
+	}
+	// the local key id links the private key to its certificate
+	localKeyID := sha1.Sum(entry.Certificates[0].Raw)
+	attributes, err := bagAttributes(entry.Alias, localKeyID[:])
+	if err != nil {
+		return nil, err
+	}
+
+	var certBags []safeBag
+	for i, cert := range entry.Certificates {
+		value, err := asn1.Marshal(certBag{ID: oidX509Certificate, Data: cert.Raw})
+		if err != nil {
+			return nil, err
+		}
+		bag := safeBag{ID: oidCertBag, Value: explicitContent(value)}
+		if i == 0 {
+			bag.Attributes = attributes
+		}
+		certBags = append(certBags, bag)
+	}
+	certSafeContents, err := asn1.Marshal(certBags)
+	if err != nil {
+		return nil, err
+	}
+	certSalt, err := salt(password, entry, "pkcs12 certificates", 8)
+	if err != nil {
+		return nil, err
+	}
+	certAlgorithm, encryptedCerts, err := pbeEncrypt(bmpPassword, certSalt, certSafeContents)
+	if err != nil {
+		return nil, err
+	}
+	encryptedCertsContent, err := asn1.Marshal(encryptedData{
+		EncryptedContentInfo: encryptedContentInfo{
+			ContentType:                oidData,
+			ContentEncryptionAlgorithm: certAlgorithm,
+			EncryptedContent:           encryptedCerts,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	keySalt, err := salt(password, entry, "pkcs12 private key", 8)
+	if err != nil {
+		return nil, err
+	}
+	keyAlgorithm, encryptedKey, err := pbeEncrypt(bmpPassword, keySalt, pkcs8)
+	if err != nil {
+		return nil, err
+	}
+	keyValue, err := asn1.Marshal(encryptedPrivateKeyInfo{EncryptionAlgorithm: keyAlgorithm, EncryptedData: encryptedKey})
+	if err != nil {
+		return nil, err
+	}
+	keySafeContents, err := asn1.Marshal([]safeBag{{ID: oidPKCS8ShroudedKeyBag, Value: explicitContent(keyValue), Attributes: attributes}})
+	if err != nil {
+		return nil, err
+	}
+	keyData, err := asn1.Marshal(keySafeContents)
+	if err != nil {
+		return nil, err
+	}
+
+	authenticatedSafe, err := asn1.Marshal([]contentInfo{
+		{ContentType: oidEncryptedData, Content: explicitContent(encryptedCertsContent)},
+		{ContentType: oidData, Content: explicitContent(keyData)},
+	})
+	if err != nil {
+		return nil, err
+	}
+	authSafeData, err := asn1.Marshal(authenticatedSafe)
+	if err != nil {
+		return nil, err
+	}
+
+	macSalt, err := salt(password, entry, "pkcs12 mac", 8)
+	if err != nil {
+		return nil, err
+	}
+	mac := hmac.New(sha1.New, pkcs12KDF(bmpPassword, macSalt, 3, pkcs12Iterations, sha1.Size))
+	mac.Write(authenticatedSafe)
+	return asn1.Marshal(pfxPdu{
+		Version:  3,
+		AuthSafe: contentInfo{ContentType: oidData, Content: explicitContent(authSafeData)},
+		MacData: macData{
+			Mac: digestInfo{
+				Algorithm: pkix.AlgorithmIdentifier{Algorithm: oidSHA1, Parameters: asn1.NullRawValue},
+				Digest:    mac.Sum(nil),
+			},
+			MacSalt:    macSalt,
+			Iterations: pkcs12Iterations,
+		},
+	})
+}
+
+// bagAttributes returns the friendly name and local key id attributes of the
+// safe bags of the entry
+func bagAttributes(alias string, localKeyID []byte) ([]pkcs12Attribute, error) {
+	keyID, err := asn1.Marshal(localKeyID)
+	if err != nil {
+		return nil, err
+	}
+	attributes := []pkcs12Attribute{{ID: oidLocalKeyID, Values: []asn1.RawValue{{FullBytes: keyID}}}}
+	if len(alias) > 0 {
+		// the friendly name is a BMPString, without the terminating zero of
+		// the password
+		name := bmpString(alias)
+		attributes = append(attributes, pkcs12Attribute{
+			ID:     oidFriendlyName,
+			Values: []asn1.RawValue{{Class: asn1.ClassUniversal, Tag: 30, Bytes: name[:len(name)-2]}},
+		})
+	}
+	return attributes, nil
+}
+
+// explicitContent returns the DER value wrapped in the [0] EXPLICIT tag of
+// the content of a PKCS#12 structure. asn1.Marshal ignores the explicit tag
+// of a raw value, so the tag is set on the raw value.
+func explicitContent(der []byte) asn1.RawValue {
+	return asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: der}
+}
+
+// pbeEncrypt encrypts the data with pbeWithSHAAnd3-KeyTripleDES-CBC, and
+// returns the algorithm identifier with the encrypted data
+func pbeEncrypt(bmpPassword, salt, data []byte) (pkix.AlgorithmIdentifier, []byte, error) {
+	params, err := asn1.Marshal(pbeParams{Salt: salt, Iterations: pkcs12Iterations})
+	if err != nil {
+		return pkix.AlgorithmIdentifier{}, nil, err
+	}
+	block, err := des.NewTripleDESCipher(pkcs12KDF(bmpPassword, salt, 1, pkcs12Iterations, 24))
+	if err != nil {
+		return pkix.AlgorithmIdentifier{}, nil, err
+	}
+	iv := pkcs12KDF(bmpPassword, salt, 2, pkcs12Iterations, block.BlockSize())
+	// PKCS#7 padding
+	padding := block.BlockSize() - len(data)%block.BlockSize()
+	encrypted := make([]byte, len(data), len(data)+padding)
+	copy(encrypted, data)
+	for i := 0; i < padding; i++ {
+		encrypted = append(encrypted, byte(padding))
+	}
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(encrypted, encrypted)
+	return pkix.AlgorithmIdentifier{Algorithm: oidPBEWithSHAAnd3DESCBC, Parameters: asn1.RawValue{FullBytes: params}}, encrypted, nil
+}
+
+// pkcs12KDF derives n bytes of key material with the SHA-1 key derivation of
+// PKCS#12, RFC 7292 appendix B.2. The id is 1 for an encryption key, 2 for an
+// IV and 3 for a MAC key.
+func pkcs12KDF(bmpPassword, salt []byte, id byte, iterations, n int) []byte {
+	const u, v = sha1.Size, 64
+	d := make([]byte, v)
+	for i := range d {
+		d[i] = id
+	}
+	// I is the salt and the password, each repeated to a multiple of v bytes
+	var i []byte
+	for _, s := range [][]byte{salt, bmpPassword} {
+		if len(s) == 0 {
+			continue
+		}
+		l := v * ((len(s) + v - 1) / v)
+		for j := 0; j < l; j++ {
+			i = append(i, s[j%len(s)])
+		}
+	}
+	var key []byte
+	for len(key) < n {
+		h := sha1.New()
+		h.Write(d)
+		h.Write(i)
+		a := h.Sum(nil)
+		for r := 1; r < iterations; r++ {
+			sum := sha1.Sum(a)
+			a = sum[:]
+		}
+		key = append(key, a...)
+		// every v byte block of I is incremented by B+1, B being A
+		// repeated to v bytes
+		b := make([]byte, v)
+		for j := range b {
+			b[j] = a[j%u]
+		}
+		for j := 0; j < len(i); j += v {
+			carry := 1
+			for k := v - 1; k >= 0; k-- {
+				sum := int(i[j+k]) + int(b[k]) + carry
+				i[j+k] = byte(sum)
+				carry = sum >> 8
+			}
+		}
+	}
+	return key[:n]
+}
+
+// bmpString returns the password as a BMPString with a terminating zero, the
+// encoding of the PKCS#12 passwords
+func bmpString(s string) []byte {
+	return append(utf16BE(s), 0, 0)
+}
@@ -0,0 +1,85 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package keystore
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"testing"
+
+	"golang.org/x/crypto/pkcs12"
+)
+
+func TestEncodePKCS12(t *testing.T) {
+	_, entry := testEntry(t)
+	pfx, err := EncodePKCS12(entry, "changeit")
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+
+	blocks, err := pkcs12.ToPEM(pfx, "changeit")
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	var certs [][]byte
+	var keys int
+	for _, block := range blocks {
+		switch block.Type {
+		case "CERTIFICATE":
+			certs = append(certs, block.Bytes)
+		case "PRIVATE KEY":
+			keys++
+			if block.Headers["friendlyName"] != "tls" {
+				t.Fatalf("expected friendly name: tls, got: %v", block.Headers)
+			}
+		}
+	}
+	if keys != 1 || len(certs) != 2 || !bytes.Equal(certs[0], entry.Certificates[0].Raw) || !bytes.Equal(certs[1], entry.Certificates[1].Raw) {
+		t.Fatalf("expected the private key and the 2 certificates, got: %d keys and %d certificates", keys, len(certs))
+	}
+
+	if _, err := pkcs12.ToPEM(pfx, "wrong"); err == nil {
+		t.Fatalf("expected err for wrong password, got nil")
+	}
+
+	again, err := EncodePKCS12(entry, "changeit")
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	if !bytes.Equal(pfx, again) {
+		t.Fatalf("expected the same keystore for the same entry")
+	}
+}
+
+func TestEncodePKCS12Decode(t *testing.T) {
+	_, entry := testEntry(t)
+	entry.Certificates = entry.Certificates[:1]
+	pfx, err := EncodePKCS12(entry, "pässwörd")
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	key, cert, err := pkcs12.Decode(pfx, "pässwörd")
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	if !cert.Equal(entry.Certificates[0]) {
+		t.Fatalf("expected the certificate of the entry")
+	}
+	if !key.(*ecdsa.PrivateKey).Equal(entry.PrivateKey) {
+		t.Fatalf("expected the private key of the entry")
+	}
+}
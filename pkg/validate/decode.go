@@ -0,0 +1,133 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package validate
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"sigs.k8s.io/yaml"
+
+	secretsstorev1 "sigs.k8s.io/secrets-store-csi-driver/apis/v1"
+	"sigs.k8s.io/secrets-store-csi-driver/apis/v1alpha1"
+)
+
+// Object is a secret provider class decoded from a manifest
+type Object struct {
+	// Object is the object of the manifest, applied to the cluster with a
+	// dry run by the cluster checks
+	Object runtime.Object
+	// SecretProviderClass is the object as the driver sees it. A cluster
+	// secret provider class is a secret provider class of the
+	// ClusterSecretProviderClass kind without namespace.
+	SecretProviderClass *v1alpha1.SecretProviderClass
+	// NamespaceSelector is the namespace selector of a cluster secret
+	// provider class
+	NamespaceSelector *metav1.LabelSelector
+}
+
+// Name returns the kind and name of the object, e.g. SecretProviderClass default/foo
+func (o *Object) Name() string {
+	spc := o.SecretProviderClass
+	if spc.Kind == v1alpha1.ClusterSecretProviderClassKind {
+		return fmt.Sprintf("%s %s", spc.Kind, spc.Name)
+	}
+	return fmt.Sprintf("SecretProviderClass %s/%s", spc.Namespace, spc.Name)
+}
+
+// Decode decodes the secret provider classes and cluster secret provider
+// classes of the yaml or json documents. Unknown fields are rejected, as they
+// are usually misspelled fields the driver would silently ignore. Secret
+// provider classes without namespace are in namespace.
+func Decode(r io.Reader, namespace string) ([]*Object, error) {
+	var objects []*Object
+	reader := utilyaml.NewYAMLReader(bufio.NewReader(r))
+	for i := 1; ; i++ {
+		doc, err := reader.Read()
+		if err == io.EOF {
+			return objects, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read document %d, err: %v", i, err)
+		}
+		if len(bytes.TrimSpace(doc)) == 0 {
+			continue
+		}
+		var typeMeta metav1.TypeMeta
+		if err := yaml.Unmarshal(doc, &typeMeta); err != nil {
+			return nil, fmt.Errorf("failed to decode document %d, err: %v", i, err)
+		}
+		if len(typeMeta.APIVersion) == 0 && len(typeMeta.Kind) == 0 {
+			continue
+		}
+		obj, err := decodeObject(doc, typeMeta, namespace)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode document %d, err: %v", i, err)
+		}
+		objects = append(objects, obj)
+	}
+}
+
+// decodeObject decodes the document of the type
+func decodeObject(doc []byte, typeMeta metav1.TypeMeta, namespace string) (*Object, error) {
+	switch {
+	case typeMeta.APIVersion == v1alpha1.GroupVersion.String() && typeMeta.Kind == "SecretProviderClass":
+		spc := &v1alpha1.SecretProviderClass{}
+		if err := yaml.UnmarshalStrict(doc, spc); err != nil {
+			return nil, err
+		}
+		if len(spc.Namespace) == 0 {
+			spc.Namespace = namespace
+		}
+		return &Object{Object: spc, SecretProviderClass: spc.DeepCopy()}, nil
+	case typeMeta.APIVersion == secretsstorev1.GroupVersion.String() && typeMeta.Kind == "SecretProviderClass":
+		spcV1 := &secretsstorev1.SecretProviderClass{}
+		if err := yaml.UnmarshalStrict(doc, spcV1); err != nil {
+			return nil, err
+		}
+		if len(spcV1.Namespace) == 0 {
+			spcV1.Namespace = namespace
+		}
+		spc := &v1alpha1.SecretProviderClass{}
+		if err := spc.ConvertFrom(spcV1.DeepCopy()); err != nil {
+			return nil, err
+		}
+		spc.TypeMeta = metav1.TypeMeta{APIVersion: v1alpha1.GroupVersion.String(), Kind: "SecretProviderClass"}
+		return &Object{Object: spcV1, SecretProviderClass: spc}, nil
+	case typeMeta.APIVersion == v1alpha1.GroupVersion.String() && typeMeta.Kind == v1alpha1.ClusterSecretProviderClassKind:
+		cspc := &v1alpha1.ClusterSecretProviderClass{}
+		if err := yaml.UnmarshalStrict(doc, cspc); err != nil {
+			return nil, err
+		}
+		return &Object{
+			Object: cspc,
+			SecretProviderClass: &v1alpha1.SecretProviderClass{
+				TypeMeta:   metav1.TypeMeta{APIVersion: v1alpha1.GroupVersion.String(), Kind: v1alpha1.ClusterSecretProviderClassKind},
+				ObjectMeta: *cspc.ObjectMeta.DeepCopy(),
+				Spec:       *cspc.Spec.SecretProviderClassSpec.DeepCopy(),
+			},
+			NamespaceSelector: cspc.Spec.NamespaceSelector.DeepCopy(),
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported kind %s of %s, must be a SecretProviderClass or ClusterSecretProviderClass", typeMeta.Kind, typeMeta.APIVersion)
+	}
+}
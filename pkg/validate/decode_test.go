@@ -0,0 +1,133 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package validate
+
+import (
+	"strings"
+	"testing"
+
+	"sigs.k8s.io/secrets-store-csi-driver/apis/v1alpha1"
+)
+
+func TestDecode(t *testing.T) {
+	cases := []struct {
+		name          string
+		manifest      string
+		expectedNames []string
+		expectedErr   bool
+	}{
+		{
+			name: "secret provider classes",
+			manifest: `
+apiVersion: secrets-store.csi.x-k8s.io/v1alpha1
+kind: SecretProviderClass
+metadata:
+  name: spc1
+spec:
+  provider: provider1
+---
+# comment
+---
+apiVersion: secrets-store.csi.x-k8s.io/v1
+kind: SecretProviderClass
+metadata:
+  name: spc2
+  namespace: ns2
+spec:
+  provider: provider1
+  parameters:
+    foo: bar
+---
+apiVersion: secrets-store.csi.x-k8s.io/v1alpha1
+kind: ClusterSecretProviderClass
+metadata:
+  name: cspc1
+spec:
+  provider: provider1
+  namespaceSelector:
+    matchLabels:
+      team: a
+`,
+			expectedNames: []string{"SecretProviderClass default/spc1", "SecretProviderClass ns2/spc2", "ClusterSecretProviderClass cspc1"},
+		},
+		{
+			name: "unknown field",
+			manifest: `
+apiVersion: secrets-store.csi.x-k8s.io/v1alpha1
+kind: SecretProviderClass
+metadata:
+  name: spc1
+spec:
+  provier: provider1
+`,
+			expectedErr: true,
+		},
+		{
+			name: "unsupported kind",
+			manifest: `
+apiVersion: v1
+kind: Secret
+metadata:
+  name: secret1
+`,
+			expectedErr: true,
+		},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			objects, err := Decode(strings.NewReader(test.manifest), "default")
+			if test.expectedErr && err == nil || !test.expectedErr && err != nil {
+				t.Fatalf("expected err: %v, got: %+v", test.expectedErr, err)
+			}
+			if len(objects) != len(test.expectedNames) {
+				t.Fatalf("expected %d objects, got: %d", len(test.expectedNames), len(objects))
+			}
+			for i, obj := range objects {
+				if obj.Name() != test.expectedNames[i] {
+					t.Errorf("expected object %d name: %s, got: %s", i, test.expectedNames[i], obj.Name())
+				}
+			}
+		})
+	}
+}
+
+func TestDecodeConvertsV1(t *testing.T) {
+	objects, err := Decode(strings.NewReader(`
+apiVersion: secrets-store.csi.x-k8s.io/v1
+kind: SecretProviderClass
+metadata:
+  name: spc1
+spec:
+  provider: provider1
+  parameters:
+    foo: bar
+  mountedObjects:
+  - objectName: secret1
+    fileName: file1
+`), "default")
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	spc := objects[0].SecretProviderClass
+	if spc.APIVersion != v1alpha1.GroupVersion.String() {
+		t.Errorf("expected api version: %s, got: %s", v1alpha1.GroupVersion.String(), spc.APIVersion)
+	}
+	if spc.Spec.Parameters["foo"] != "bar" || len(spc.Spec.MountedObjects) != 1 || spc.Spec.MountedObjects[0].FileName != "file1" {
+		t.Errorf("expected the v1 spec to be converted, got: %+v", spc.Spec)
+	}
+}
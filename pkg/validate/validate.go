@@ -0,0 +1,556 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package validate checks secret provider classes before they are applied, so
+// misconfigurations are caught before the pods that mount them fail to start.
+// The spec is checked as the node server checks it, the providers are checked
+// to be available and to accept the parameters, and the objects can be
+// fetched from the providers with a dry run. It is used by the
+// kubectl-secrets_store plugin.
+package validate
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"sigs.k8s.io/secrets-store-csi-driver/apis/v1alpha1"
+	"sigs.k8s.io/secrets-store-csi-driver/controllers"
+	"sigs.k8s.io/secrets-store-csi-driver/pkg/providersdk"
+	secretsstore "sigs.k8s.io/secrets-store-csi-driver/pkg/secrets-store"
+	providerv1alpha1 "sigs.k8s.io/secrets-store-csi-driver/provider/v1alpha1"
+)
+
+// Status is the result of a check
+type Status string
+
+const (
+	// Passed is the status of a check the secret provider class passed
+	Passed Status = "PASS"
+	// Failed is the status of a check the secret provider class failed
+	Failed Status = "FAIL"
+	// Skipped is the status of a check that wasn't run
+	Skipped Status = "SKIP"
+)
+
+// permission is the file permission of the dry run mount requests
+const permission = "420"
+
+// Config is the configuration of a validation run
+type Config struct {
+	// Client is the client of the cluster the secret provider classes are
+	// applied to. The cluster checks are skipped if not set.
+	Client client.Client
+	// ProviderVolume is the directory of the provider sockets. The provider
+	// checks are skipped if not set.
+	ProviderVolume string
+	// Pod is the pod the parameter templates are rendered with and the pod
+	// info of the dry run mount requests is set from. The pod is in the
+	// namespace of the secret provider class, cluster secret provider classes
+	// are mounted in the namespace of the pod.
+	Pod *corev1.Pod
+	// Secrets are the node publish secrets of the dry run mount requests
+	Secrets map[string]string
+	// DryRunFetch fetches the objects from the providers into a temporary
+	// directory that is removed after the check. Only the names of the
+	// mounted files are reported.
+	DryRunFetch bool
+	// Timeout is the timeout of each provider call
+	Timeout time.Duration
+}
+
+// Result is the result of a check of a secret provider class
+type Result struct {
+	Object  string `json:"object"`
+	Check   string `json:"check"`
+	Status  Status `json:"status"`
+	Message string `json:"message,omitempty"`
+}
+
+// Report is the result of the checks of the secret provider classes
+type Report struct {
+	Results []Result `json:"results"`
+}
+
+// Passed returns true if no secret provider class failed a check
+func (r *Report) Passed() bool {
+	for _, result := range r.Results {
+		if result.Status == Failed {
+			return false
+		}
+	}
+	return true
+}
+
+// WriteText writes the report as a table
+func (r *Report) WriteText(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(tw, "OBJECT\tCHECK\tSTATUS\tMESSAGE\n")
+	for _, result := range r.Results {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", result.Object, result.Check, result.Status, result.Message)
+	}
+	summary := "PASSED"
+	if !r.Passed() {
+		summary = "FAILED"
+	}
+	fmt.Fprintf(tw, "\nvalidation %s\n", summary)
+	return tw.Flush()
+}
+
+// WriteJSON writes the report as json
+func (r *Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// check is a check of a secret provider class. run returns the status and a
+// message describing the result.
+type check struct {
+	name string
+	run  func(r *runner, ctx context.Context) (Status, string)
+}
+
+// checks are the checks in the order they are run. Later checks are skipped
+// if the checks they depend on didn't pass.
+var checks = []check{
+	{name: "Cluster", run: (*runner).checkCluster},
+	{name: "Spec", run: (*runner).checkSpec},
+	{name: "Pod", run: (*runner).checkPod},
+	{name: "Providers", run: (*runner).checkProviders},
+	{name: "Parameters", run: (*runner).checkParameters},
+	{name: "DryRunFetch", run: (*runner).checkDryRunFetch},
+}
+
+// providerMount is a provider of a secret provider class and the parameters
+// it's called with
+type providerMount struct {
+	provider   string
+	parameters map[string]string
+}
+
+// runner holds the state shared by the checks of a secret provider class
+type runner struct {
+	config  Config
+	builder *secretsstore.PluginClientBuilder
+	obj     *Object
+	// spc is the secret provider class with its base classes merged, nil if
+	// the Spec check didn't pass
+	spc *v1alpha1.SecretProviderClass
+	// pod is the pod the secret provider class is mounted by
+	pod *corev1.Pod
+	// rendered is spc with the parameter templates rendered, nil if the Pod
+	// check didn't pass
+	rendered *v1alpha1.SecretProviderClass
+	// capabilities are the capabilities of the providers, nil if the
+	// Providers check didn't pass
+	capabilities map[string]secretsstore.ProviderCapabilities
+}
+
+// Run runs the checks against the secret provider classes and returns the report
+func Run(ctx context.Context, objects []*Object, config Config) *Report {
+	if config.Timeout == 0 {
+		config.Timeout = 30 * time.Second
+	}
+	if config.Pod == nil {
+		config.Pod = &corev1.Pod{}
+	}
+	var builder *secretsstore.PluginClientBuilder
+	if len(config.ProviderVolume) > 0 {
+		builder = secretsstore.NewPluginClientBuilder(config.ProviderVolume)
+		defer builder.Cleanup()
+	}
+
+	report := &Report{}
+	for _, obj := range objects {
+		r := newRunner(config, builder, obj)
+		for _, c := range checks {
+			checkStatus, message := c.run(r, ctx)
+			report.Results = append(report.Results, Result{
+				Object:  obj.Name(),
+				Check:   c.name,
+				Status:  checkStatus,
+				Message: message,
+			})
+		}
+	}
+	return report
+}
+
+// newRunner returns a runner for the object with the pod of the config in
+// the namespace of the secret provider class
+func newRunner(config Config, builder *secretsstore.PluginClientBuilder, obj *Object) *runner {
+	pod := config.Pod.DeepCopy()
+	if obj.SecretProviderClass.Kind != v1alpha1.ClusterSecretProviderClassKind {
+		pod.Namespace = obj.SecretProviderClass.Namespace
+	}
+	if len(pod.Name) == 0 {
+		pod.Name = "kubectl-secrets-store-validate"
+	}
+	if len(pod.Namespace) == 0 {
+		pod.Namespace = "default"
+	}
+	if len(pod.Spec.ServiceAccountName) == 0 {
+		pod.Spec.ServiceAccountName = "default"
+	}
+	return &runner{config: config, builder: builder, obj: obj, pod: pod}
+}
+
+// checkCluster checks the cluster accepts the object with a server side dry
+// run, e.g. the CRD schema and the admission webhooks
+func (r *runner) checkCluster(ctx context.Context) (Status, string) {
+	if r.config.Client == nil {
+		return Skipped, "cluster checks are disabled"
+	}
+	obj := r.obj.Object.DeepCopyObject()
+	accessor, err := metaAccessor(obj)
+	if err != nil {
+		return Failed, err.Error()
+	}
+	existing := r.obj.Object.DeepCopyObject()
+	err = r.config.Client.Get(ctx, client.ObjectKey{Namespace: accessor.GetNamespace(), Name: accessor.GetName()}, existing)
+	switch {
+	case apierrors.IsNotFound(err):
+		if err := r.config.Client.Create(ctx, obj, client.DryRunAll); err != nil {
+			return Failed, fmt.Sprintf("dry run create failed, err: %v", err)
+		}
+		return Passed, "dry run create accepted"
+	case err != nil:
+		return Failed, fmt.Sprintf("failed to get %s, err: %v", r.obj.Name(), err)
+	}
+	existingAccessor, err := metaAccessor(existing)
+	if err != nil {
+		return Failed, err.Error()
+	}
+	accessor.SetResourceVersion(existingAccessor.GetResourceVersion())
+	if err := r.config.Client.Update(ctx, obj, client.DryRunAll); err != nil {
+		return Failed, fmt.Sprintf("dry run update failed, err: %v", err)
+	}
+	return Passed, "dry run update accepted"
+}
+
+// checkSpec checks the spec as the node server checks it before calling the
+// providers. The base classes are merged into the spec if the secret provider
+// class extends other classes, which requires the cluster checks.
+func (r *runner) checkSpec(ctx context.Context) (Status, string) {
+	spc := r.obj.SecretProviderClass
+	var message string
+	if len(spc.Spec.Extends) > 0 {
+		if r.config.Client == nil {
+			return Skipped, fmt.Sprintf("extends %s, the base classes can't be resolved with the cluster checks disabled", spc.Spec.Extends)
+		}
+		resolved, err := controllers.ResolveSecretProviderClass(ctx, r.config.Client, spc)
+		if err != nil {
+			return Failed, err.Error()
+		}
+		spc = resolved
+		message = fmt.Sprintf("merged base classes of %s", spc.Spec.Extends)
+	}
+	if err := secretsstore.ValidateSecretProviderClass(spc); err != nil {
+		return Failed, err.Error()
+	}
+	if r.obj.NamespaceSelector != nil {
+		if _, err := metav1.LabelSelectorAsSelector(r.obj.NamespaceSelector); err != nil {
+			return Failed, fmt.Sprintf("invalid namespace selector, err: %v", err)
+		}
+	}
+	r.spc = spc
+	return Passed, message
+}
+
+// checkPod checks the pod is allowed to mount the secret provider class and
+// the parameter templates render with the pod metadata
+func (r *runner) checkPod(ctx context.Context) (Status, string) {
+	if r.spc == nil {
+		return Skipped, "Spec check didn't pass"
+	}
+	if r.obj.NamespaceSelector != nil && r.config.Client != nil {
+		if err := r.checkNamespaceSelected(ctx); err != nil {
+			return Failed, err.Error()
+		}
+	}
+	if err := controllers.CheckPodAllowed(r.spc, r.pod); err != nil {
+		return Failed, err.Error()
+	}
+	rendered, err := secretsstore.RenderParameterTemplates(r.spc, r.pod)
+	if err != nil {
+		return Failed, err.Error()
+	}
+	r.rendered = rendered
+	return Passed, fmt.Sprintf("pod %s/%s", r.pod.Namespace, r.pod.Name)
+}
+
+// checkNamespaceSelected checks the namespace selector of the cluster secret
+// provider class selects the namespace of the pod
+func (r *runner) checkNamespaceSelected(ctx context.Context) error {
+	selector, err := metav1.LabelSelectorAsSelector(r.obj.NamespaceSelector)
+	if err != nil {
+		return err
+	}
+	ns := &corev1.Namespace{}
+	if err := r.config.Client.Get(ctx, client.ObjectKey{Name: r.pod.Namespace}, ns); err != nil {
+		return fmt.Errorf("failed to get namespace %s, err: %v", r.pod.Namespace, err)
+	}
+	if !selector.Matches(labels.Set(ns.GetLabels())) {
+		return fmt.Errorf("%v: namespace %s", controllers.ErrNamespaceNotSelected, r.pod.Namespace)
+	}
+	return nil
+}
+
+// checkProviders checks the providers of the secret provider class serve in
+// the provider volume and report to be healthy
+func (r *runner) checkProviders(ctx context.Context) (Status, string) {
+	if r.spc == nil {
+		return Skipped, "Spec check didn't pass"
+	}
+	if r.builder == nil {
+		return Skipped, "provider volume is not set"
+	}
+	capabilities := make(map[string]secretsstore.ProviderCapabilities)
+	var runtimes []string
+	for _, mount := range providerMounts(r.spc) {
+		if _, ok := capabilities[mount.provider]; ok {
+			continue
+		}
+		runtimeVersion, err := r.checkProvider(ctx, mount.provider)
+		if err != nil {
+			return Failed, err.Error()
+		}
+		ctx, cancel := context.WithTimeout(ctx, r.config.Timeout)
+		capabilities[mount.provider], err = r.builder.Capabilities(ctx, mount.provider)
+		cancel()
+		if err != nil {
+			return Failed, fmt.Sprintf("failed to get provider %s capabilities, err: %v", mount.provider, err)
+		}
+		runtimes = append(runtimes, fmt.Sprintf("%s (%s)", mount.provider, runtimeVersion))
+	}
+	r.capabilities = capabilities
+	return Passed, strings.Join(runtimes, ", ")
+}
+
+// checkProvider checks the provider serves in the provider volume and reports
+// to be healthy. The runtime name and version of the provider are returned.
+func (r *runner) checkProvider(ctx context.Context, provider string) (string, error) {
+	if !r.builder.HasProvider(provider) {
+		return "", fmt.Errorf("provider %s socket not found in %s", provider, r.config.ProviderVolume)
+	}
+	ctx, cancel := context.WithTimeout(ctx, r.config.Timeout)
+	defer cancel()
+	c, err := r.builder.Get(ctx, provider)
+	if err != nil {
+		return "", fmt.Errorf("failed to connect to provider %s, err: %v", provider, err)
+	}
+	version, err := c.Version(ctx, &providerv1alpha1.VersionRequest{})
+	if err != nil {
+		return "", fmt.Errorf("provider %s Version RPC failed, err: %v", provider, err)
+	}
+	health, err := c.Health(ctx, &providerv1alpha1.HealthRequest{})
+	if err != nil && status.Code(err) != codes.Unimplemented {
+		return "", fmt.Errorf("provider %s Health RPC failed, err: %v", provider, err)
+	}
+	if err == nil && !health.GetHealthy() {
+		return "", fmt.Errorf("provider %s is unhealthy: %s", provider, health.GetMessage())
+	}
+	return fmt.Sprintf("%s %s", version.GetRuntimeName(), version.GetRuntimeVersion()), nil
+}
+
+// checkParameters checks the rendered parameters against the parameters
+// schema advertised by each provider
+func (r *runner) checkParameters(ctx context.Context) (Status, string) {
+	if r.rendered == nil {
+		return Skipped, "Pod check didn't pass"
+	}
+	if r.capabilities == nil {
+		return Skipped, "Providers check didn't pass"
+	}
+	var unchecked []string
+	for _, mount := range providerMounts(r.rendered) {
+		capabilities := r.capabilities[mount.provider]
+		if capabilities.ParametersSchema == nil {
+			unchecked = append(unchecked, mount.provider)
+			continue
+		}
+		if err := capabilities.ValidateParameters(mount.parameters); err != nil {
+			return Failed, fmt.Sprintf("invalid parameters of provider %s: %v", mount.provider, err)
+		}
+	}
+	if len(unchecked) > 0 {
+		return Passed, fmt.Sprintf("providers without parameters schema: %s", strings.Join(unchecked, ", "))
+	}
+	return Passed, ""
+}
+
+// checkDryRunFetch mounts the objects of each provider to a temporary
+// directory, applies the mounted objects of the secret provider class and
+// checks every mounted object was mounted by a provider
+func (r *runner) checkDryRunFetch(ctx context.Context) (Status, string) {
+	if !r.config.DryRunFetch {
+		return Skipped, "dry run fetch is not enabled"
+	}
+	if r.rendered == nil {
+		return Skipped, "Pod check didn't pass"
+	}
+	if r.capabilities == nil {
+		return Skipped, "Providers check didn't pass"
+	}
+	secrets := r.config.Secrets
+	if secrets == nil {
+		secrets = map[string]string{}
+	}
+	secretsStr, err := json.Marshal(secrets)
+	if err != nil {
+		return Failed, fmt.Sprintf("failed to marshal secrets, err: %v", err)
+	}
+
+	mounted := make(map[string]bool)
+	var messages []string
+	for _, mount := range providerMounts(r.rendered) {
+		objectNames, fileNames, objectVersions, err := r.dryRunMount(ctx, mount, string(secretsStr))
+		if err != nil {
+			return Failed, err.Error()
+		}
+		for _, name := range objectNames {
+			mounted[filepath.Clean(name)] = true
+		}
+		messages = append(messages, fmt.Sprintf("%s mounted %d files (%s), %d object versions", mount.provider, len(fileNames), strings.Join(fileNames, ","), objectVersions))
+	}
+	for _, mountedObj := range r.rendered.Spec.MountedObjects {
+		if mountedObj != nil && !mounted[filepath.Clean(mountedObj.ObjectName)] {
+			return Failed, fmt.Sprintf("mounted object %s not mounted by any provider", mountedObj.ObjectName)
+		}
+	}
+	return Passed, strings.Join(messages, "; ")
+}
+
+// dryRunMount mounts the objects of the provider to a temporary directory and
+// applies the mounted objects. It returns the names of the files mounted by
+// the provider, the names of the files after the mounted objects were applied
+// and the number of object versions. The directory is removed before
+// returning, the contents of the files are never read.
+func (r *runner) dryRunMount(ctx context.Context, mount providerMount, secrets string) ([]string, []string, int, error) {
+	targetPath, err := ioutil.TempDir("", "kubectl-secrets-store-validate")
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	defer os.RemoveAll(targetPath)
+
+	parameters := map[string]string{
+		providersdk.PodNameParameter:            r.pod.Name,
+		providersdk.PodNamespaceParameter:       r.pod.Namespace,
+		providersdk.PodUIDParameter:             string(r.pod.UID),
+		providersdk.ServiceAccountNameParameter: r.pod.Spec.ServiceAccountName,
+	}
+	for k, v := range mount.parameters {
+		parameters[k] = v
+	}
+	attributes, err := json.Marshal(parameters)
+	if err != nil {
+		return nil, nil, 0, fmt.Errorf("failed to marshal parameters, err: %v", err)
+	}
+
+	c, err := r.builder.Get(ctx, mount.provider)
+	if err != nil {
+		return nil, nil, 0, fmt.Errorf("failed to connect to provider %s, err: %v", mount.provider, err)
+	}
+	mountCtx, cancel := context.WithTimeout(ctx, r.config.Timeout)
+	defer cancel()
+	objectVersions, errorCode, err := secretsstore.MountContent(mountCtx, c, r.capabilities[mount.provider], string(attributes), secrets, targetPath, permission)
+	if err != nil {
+		return nil, nil, 0, fmt.Errorf("provider %s mount failed with error code %s, err: %v", mount.provider, errorCode, err)
+	}
+	objectNames, err := listFiles(targetPath)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	if reason, err := secretsstore.ApplyMountedObjects(targetPath, r.rendered.Spec.MountedObjects); err != nil {
+		return nil, nil, 0, fmt.Errorf("failed to apply mounted objects to the files of provider %s with error reason %s, err: %v", mount.provider, reason, err)
+	}
+	fileNames, err := listFiles(targetPath)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	return objectNames, fileNames, len(objectVersions), nil
+}
+
+// providerMounts returns the primary, fallback and additional providers of
+// the secret provider class with their parameters
+func providerMounts(spc *v1alpha1.SecretProviderClass) []providerMount {
+	mounts := []providerMount{{provider: string(spc.Spec.Provider), parameters: spc.Spec.Parameters}}
+	if spc.Spec.Fallback != nil {
+		provider := spc.Spec.Provider
+		if len(spc.Spec.Fallback.Provider) > 0 {
+			provider = spc.Spec.Fallback.Provider
+		}
+		mounts = append(mounts, providerMount{provider: string(provider), parameters: spc.Spec.Fallback.Parameters})
+	}
+	for _, additionalProvider := range spc.Spec.AdditionalProviders {
+		if additionalProvider != nil {
+			mounts = append(mounts, providerMount{provider: string(additionalProvider.Provider), parameters: additionalProvider.Parameters})
+		}
+	}
+	return mounts
+}
+
+// listFiles returns the sorted paths of the files in the target path relative
+// to the target path
+func listFiles(targetPath string) ([]string, error) {
+	var files []string
+	err := filepath.Walk(targetPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(targetPath, path)
+		if err != nil {
+			return err
+		}
+		files = append(files, filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list files in %s, err: %v", targetPath, err)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// metaAccessor returns the object metadata of the object
+func metaAccessor(obj runtime.Object) (metav1.Object, error) {
+	accessor, ok := obj.(metav1.Object)
+	if !ok {
+		return nil, fmt.Errorf("object %T has no metadata", obj)
+	}
+	return accessor, nil
+}
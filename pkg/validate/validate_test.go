@@ -0,0 +1,284 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package validate
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"sigs.k8s.io/secrets-store-csi-driver/apis/v1alpha1"
+	fakeprovider "sigs.k8s.io/secrets-store-csi-driver/provider/fake"
+)
+
+func getTempTestDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "ut")
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	return dir
+}
+
+func setupScheme() *runtime.Scheme {
+	s := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(s)
+	_ = v1alpha1.AddToScheme(s)
+	return s
+}
+
+func newObject(name string, spec v1alpha1.SecretProviderClassSpec) *Object {
+	spc := &v1alpha1.SecretProviderClass{
+		TypeMeta:   metav1.TypeMeta{APIVersion: v1alpha1.GroupVersion.String(), Kind: "SecretProviderClass"},
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+		Spec:       spec,
+	}
+	return &Object{Object: spc, SecretProviderClass: spc.DeepCopy()}
+}
+
+func TestRun(t *testing.T) {
+	cases := []struct {
+		name             string
+		spec             v1alpha1.SecretProviderClassSpec
+		pod              *corev1.Pod
+		local            bool
+		expectedStatuses map[string]Status
+	}{
+		{
+			name: "objects fetched",
+			spec: v1alpha1.SecretProviderClassSpec{
+				Provider:       "fake",
+				Parameters:     map[string]string{"objects": "foo,bar"},
+				MountedObjects: []*v1alpha1.MountedObject{{ObjectName: "foo", FileName: "renamed/foo"}},
+			},
+			expectedStatuses: map[string]Status{
+				"Cluster":     Passed,
+				"Spec":        Passed,
+				"Pod":         Passed,
+				"Providers":   Passed,
+				"Parameters":  Passed,
+				"DryRunFetch": Passed,
+			},
+		},
+		{
+			name:  "cluster checks disabled",
+			spec:  v1alpha1.SecretProviderClassSpec{Provider: "fake", Parameters: map[string]string{"objects": "foo"}},
+			local: true,
+			expectedStatuses: map[string]Status{
+				"Cluster":     Skipped,
+				"DryRunFetch": Passed,
+			},
+		},
+		{
+			name: "invalid spec",
+			spec: v1alpha1.SecretProviderClassSpec{Provider: "fake"},
+			expectedStatuses: map[string]Status{
+				"Spec":        Failed,
+				"Pod":         Skipped,
+				"Providers":   Skipped,
+				"DryRunFetch": Skipped,
+			},
+		},
+		{
+			name: "pod not allowed",
+			spec: v1alpha1.SecretProviderClassSpec{
+				Provider:    "fake",
+				Parameters:  map[string]string{"objects": "foo"},
+				PodSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}},
+			},
+			pod: &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"app": "db"}}},
+			expectedStatuses: map[string]Status{
+				"Pod":         Failed,
+				"Providers":   Passed,
+				"Parameters":  Skipped,
+				"DryRunFetch": Skipped,
+			},
+		},
+		{
+			name: "parameter template rendered",
+			spec: v1alpha1.SecretProviderClassSpec{
+				Provider:   "fake",
+				Parameters: map[string]string{"objects": "{{ .PodLabels.app }}"},
+			},
+			pod: &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"app": "web"}}},
+			expectedStatuses: map[string]Status{
+				"Pod":         Passed,
+				"DryRunFetch": Passed,
+			},
+		},
+		{
+			name: "provider not found",
+			spec: v1alpha1.SecretProviderClassSpec{Provider: "missing", Parameters: map[string]string{"objects": "foo"}},
+			expectedStatuses: map[string]Status{
+				"Providers":   Failed,
+				"Parameters":  Skipped,
+				"DryRunFetch": Skipped,
+			},
+		},
+		{
+			name: "fetch failed",
+			spec: v1alpha1.SecretProviderClassSpec{Provider: "fake", Parameters: map[string]string{"foo": "bar"}},
+			expectedStatuses: map[string]Status{
+				"Providers":   Passed,
+				"DryRunFetch": Failed,
+			},
+		},
+		{
+			name: "mounted object not mounted",
+			spec: v1alpha1.SecretProviderClassSpec{
+				Provider:       "fake",
+				Parameters:     map[string]string{"objects": "foo"},
+				MountedObjects: []*v1alpha1.MountedObject{{ObjectName: "bar", FileName: "renamed/bar"}},
+			},
+			expectedStatuses: map[string]Status{
+				"DryRunFetch": Failed,
+			},
+		},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			dir := getTempTestDir(t)
+			defer os.RemoveAll(dir)
+
+			provider := fakeprovider.NewProvider(filepath.Join(dir, "fake.sock"), 0)
+			if err := provider.Start(); err != nil {
+				t.Fatalf("expected err to be nil, got: %+v", err)
+			}
+			defer provider.Stop()
+
+			config := Config{
+				ProviderVolume: dir,
+				Pod:            test.pod,
+				DryRunFetch:    true,
+				Timeout:        5 * time.Second,
+			}
+			if !test.local {
+				config.Client = fake.NewFakeClientWithScheme(setupScheme())
+			}
+			report := Run(context.TODO(), []*Object{newObject("spc1", test.spec)}, config)
+			if len(report.Results) != len(checks) {
+				t.Fatalf("expected %d results, got: %d", len(checks), len(report.Results))
+			}
+			for _, result := range report.Results {
+				if expected, ok := test.expectedStatuses[result.Check]; ok && result.Status != expected {
+					t.Errorf("expected check %s status: %s, got: %s (%s)", result.Check, expected, result.Status, result.Message)
+				}
+			}
+		})
+	}
+}
+
+func TestRunExtends(t *testing.T) {
+	base := &v1alpha1.SecretProviderClass{
+		ObjectMeta: metav1.ObjectMeta{Name: "base", Namespace: "default"},
+		Spec: v1alpha1.SecretProviderClassSpec{
+			Provider:   "fake",
+			Parameters: map[string]string{"objects": "foo"},
+		},
+	}
+	obj := newObject("spc1", v1alpha1.SecretProviderClassSpec{
+		Extends:        "base",
+		MountedObjects: []*v1alpha1.MountedObject{{ObjectName: "foo", FileName: "renamed/foo"}},
+	})
+
+	report := Run(context.TODO(), []*Object{obj}, Config{})
+	if report.Results[1].Check != "Spec" || report.Results[1].Status != Skipped {
+		t.Errorf("expected Spec check to be skipped without cluster checks, got: %+v", report.Results[1])
+	}
+
+	report = Run(context.TODO(), []*Object{obj}, Config{Client: fake.NewFakeClientWithScheme(setupScheme(), base)})
+	if report.Results[1].Check != "Spec" || report.Results[1].Status != Passed {
+		t.Errorf("expected Spec check to pass with the base class, got: %+v", report.Results[1])
+	}
+	if !report.Passed() {
+		t.Errorf("expected report to pass, got: %+v", report.Results)
+	}
+}
+
+func TestRunParametersSchema(t *testing.T) {
+	dir := getTempTestDir(t)
+	defer os.RemoveAll(dir)
+
+	server, err := fakeprovider.NewMocKCSIProviderServer(filepath.Join(dir, "provider1.sock"))
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	server.SetParametersSchema(`{"properties": {"objects": {"type": "string"}}, "additionalProperties": false}`)
+	if err := server.Start(); err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	defer server.Stop()
+
+	obj := newObject("spc1", v1alpha1.SecretProviderClassSpec{
+		Provider:   "provider1",
+		Parameters: map[string]string{"objcts": "foo"},
+	})
+	report := Run(context.TODO(), []*Object{obj}, Config{ProviderVolume: dir, DryRunFetch: true})
+	for _, result := range report.Results {
+		switch result.Check {
+		case "Parameters":
+			if result.Status != Failed || !strings.Contains(result.Message, "objects") {
+				t.Errorf("expected Parameters check to fail with the closest known parameter, got: %s (%s)", result.Status, result.Message)
+			}
+		case "DryRunFetch":
+			if result.Status != Passed {
+				t.Errorf("expected DryRunFetch check to pass, got: %s (%s)", result.Status, result.Message)
+			}
+		}
+	}
+}
+
+func TestReportWrite(t *testing.T) {
+	report := &Report{Results: []Result{
+		{Object: "SecretProviderClass default/spc1", Check: "Spec", Status: Passed},
+		{Object: "SecretProviderClass default/spc1", Check: "Providers", Status: Failed, Message: "provider fake socket not found"},
+	}}
+	if report.Passed() {
+		t.Fatalf("expected report to fail")
+	}
+
+	var text bytes.Buffer
+	if err := report.WriteText(&text); err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	if !strings.Contains(text.String(), "validation FAILED") {
+		t.Errorf("expected report summary, got: %s", text.String())
+	}
+	var buf bytes.Buffer
+	if err := report.WriteJSON(&buf); err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	var decoded Report
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	if len(decoded.Results) != len(report.Results) {
+		t.Errorf("expected %d results in json report, got: %d", len(report.Results), len(decoded.Results))
+	}
+}
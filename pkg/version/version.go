@@ -18,8 +18,12 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"os/exec"
+	"os"
 	"strings"
+	"sync"
+	"time"
+
+	"sigs.k8s.io/secrets-store-csi-driver/pkg/sandbox"
 
 	"github.com/blang/semver"
 	log "github.com/sirupsen/logrus"
@@ -32,20 +36,97 @@ type providerVersion struct {
 	// BuildDate is the date provider binary was built
 	BuildDate string `json:"buildDate"`
 	// MinDriverVersion is minimum driver version the provider works with
-	// this can be used later for bidirectional compatibility checks between driver-provider
+	// this is used for bidirectional compatibility checks between driver-provider
 	MinDriverVersion string `json:"minDriverVersion"`
 }
 
+// providerVersionCacheTTL is the duration the version of a provider binary is
+// cached. The cached version is dropped earlier if the provider binary changes.
+const providerVersionCacheTTL = 5 * time.Minute
+
+// providerVersionCacheEntry is the version of a provider binary and the
+// modification time and size of the binary the version was read from
+type providerVersionCacheEntry struct {
+	version *providerVersion
+	modTime time.Time
+	size    int64
+	expiry  time.Time
+}
+
+var (
+	providerVersionCache     = make(map[string]providerVersionCacheEntry)
+	providerVersionCacheLock sync.Mutex
+)
+
+// Compatibility is the result of the bidirectional version check between
+// the driver and the provider
+type Compatibility struct {
+	// ProviderVersion is the current provider version
+	ProviderVersion string
+	// MinDriverVersion is the minimum driver version required by the provider
+	MinDriverVersion string
+	// ProviderCompatible is false if the provider version is lower than the
+	// minimum provider version supported by the driver
+	ProviderCompatible bool
+	// DriverCompatible is false if the driver version is lower than the
+	// minimum driver version required by the provider
+	DriverCompatible bool
+}
+
 // IsProviderCompatible checks if the provider version is compatible with
-// current driver version.
-func IsProviderCompatible(ctx context.Context, provider string, minProviderVersion string) (bool, error) {
+// current driver version. The provider binary runs in the provider sandbox.
+func IsProviderCompatible(ctx context.Context, providerSandbox sandbox.Config, provider string, minProviderVersion string) (bool, error) {
 	// get current provider version
-	currProviderVersion, err := getProviderVersion(ctx, provider)
+	currProviderVersion, err := getCachedProviderVersion(ctx, providerSandbox, provider)
 	if err != nil {
 		return false, err
 	}
 	// check with normalized versions
-	return isProviderCompatible(normalizeVersion(currProviderVersion), normalizeVersion(minProviderVersion))
+	return isProviderCompatible(normalizeVersion(currProviderVersion.Version), normalizeVersion(minProviderVersion))
+}
+
+// CheckCompatibility gets the provider version and checks the provider version is
+// compatible with the minimum provider version and the driver version is compatible
+// with the minimum driver version required by the provider. Empty minimum
+// versions are considered compatible. The provider binary runs in the provider
+// sandbox.
+func CheckCompatibility(ctx context.Context, providerSandbox sandbox.Config, provider, minProviderVersion, driverVersion string) (*Compatibility, error) {
+	pv, err := getCachedProviderVersion(ctx, providerSandbox, provider)
+	if err != nil {
+		return nil, err
+	}
+	c := &Compatibility{
+		ProviderVersion:    pv.Version,
+		MinDriverVersion:   pv.MinDriverVersion,
+		ProviderCompatible: true,
+	}
+	if len(minProviderVersion) > 0 {
+		if c.ProviderCompatible, err = isProviderCompatible(normalizeVersion(pv.Version), normalizeVersion(minProviderVersion)); err != nil {
+			return nil, err
+		}
+	}
+	if c.DriverCompatible, err = IsDriverCompatible(driverVersion, pv.MinDriverVersion); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// IsDriverCompatible checks if the driver version is compatible with the minimum
+// driver version required by the provider. If the provider doesn't set a minimum
+// driver version, the driver is considered compatible. If the driver version is not
+// a valid semver (e.g. a development build), the check is skipped with a warning.
+func IsDriverCompatible(driverVersion, minDriverVersion string) (bool, error) {
+	if len(minDriverVersion) == 0 {
+		return true, nil
+	}
+	if err := isValidSemver(normalizeVersion(driverVersion)); err != nil {
+		log.Warningf("driver version %s is not a valid semver, skipping minimum driver version %s check", driverVersion, minDriverVersion)
+		return true, nil
+	}
+	if err := isValidSemver(normalizeVersion(minDriverVersion)); err != nil {
+		return false, fmt.Errorf("minimum driver version %s is not a valid semver, error %+v", minDriverVersion, err)
+	}
+	return isProviderCompatible(normalizeVersion(driverVersion), normalizeVersion(minDriverVersion))
 }
 
 // GetMinimumProviderVersions creates a map with provider name and minimum version
@@ -90,8 +171,41 @@ func GetMinimumProviderVersions(minProviderVersions string) (map[string]string,
 	return providerVersionMap, nil
 }
 
-func getProviderVersion(ctx context.Context, providerName string) (string, error) {
-	cmd := exec.CommandContext(ctx, providerName, "--version")
+// getCachedProviderVersion returns the cached version of the provider binary if
+// the binary didn't change since the version was cached. Otherwise the provider
+// binary is executed to get the version.
+func getCachedProviderVersion(ctx context.Context, providerSandbox sandbox.Config, providerName string) (*providerVersion, error) {
+	info, err := os.Stat(providerName)
+	if err != nil {
+		return getProviderVersion(ctx, providerSandbox, providerName)
+	}
+
+	providerVersionCacheLock.Lock()
+	entry, ok := providerVersionCache[providerName]
+	providerVersionCacheLock.Unlock()
+	if ok && entry.modTime.Equal(info.ModTime()) && entry.size == info.Size() && time.Now().Before(entry.expiry) {
+		return entry.version, nil
+	}
+
+	pv, err := getProviderVersion(ctx, providerSandbox, providerName)
+	if err != nil {
+		return nil, err
+	}
+	providerVersionCacheLock.Lock()
+	providerVersionCache[providerName] = providerVersionCacheEntry{
+		version: pv,
+		modTime: info.ModTime(),
+		size:    info.Size(),
+		expiry:  time.Now().Add(providerVersionCacheTTL),
+	}
+	providerVersionCacheLock.Unlock()
+	return pv, nil
+}
+
+// getProviderVersion executes the provider binary with the resource limits and
+// environment of the provider sandbox to get the version
+func getProviderVersion(ctx context.Context, providerSandbox sandbox.Config, providerName string) (*providerVersion, error) {
+	cmd := sandbox.Command(ctx, providerSandbox, providerName, "--version")
 
 	stdout := &bytes.Buffer{}
 	stderr := &bytes.Buffer{}
@@ -99,15 +213,15 @@ func getProviderVersion(ctx context.Context, providerName string) (string, error
 
 	err := cmd.Run()
 	if err != nil {
-		return "", fmt.Errorf("error getting current provider version for %s, err: %v, output: %v", providerName, err, stderr.String())
+		return nil, fmt.Errorf("error getting current provider version for %s, err: %v, output: %v", providerName, err, stderr.String())
 	}
 	var pv providerVersion
 	if err := json.Unmarshal(stdout.Bytes(), &pv); err != nil {
-		return "", fmt.Errorf("error unmarshalling provider version %v", err)
+		return nil, fmt.Errorf("error unmarshalling provider version %v", err)
 	}
 
-	log.Debugf("provider: %s, version %s, build date: %s", providerName, pv.Version, pv.BuildDate)
-	return pv.Version, nil
+	log.Debugf("provider: %s, version %s, build date: %s, min driver version: %s", providerName, pv.Version, pv.BuildDate, pv.MinDriverVersion)
+	return &pv, nil
 }
 
 func isProviderCompatible(currVersion, minVersion string) (bool, error) {
@@ -129,7 +243,5 @@ func isValidSemver(version string) error {
 
 func normalizeVersion(version string) string {
 	// driver currently uses prefix in version
-	// no checks are currently performed using driver version, but
-	// will be done in the future for bi-directional version validation.
 	return strings.TrimPrefix(version, "v")
 }
@@ -14,8 +14,17 @@ limitations under the License.
 package version
 
 import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
+
+	"sigs.k8s.io/secrets-store-csi-driver/pkg/sandbox"
 )
 
 func TestGetMinimumProviderVersions(t *testing.T) {
@@ -173,3 +182,149 @@ func TestIsProviderCompatible(t *testing.T) {
 		}
 	}
 }
+
+func TestIsDriverCompatible(t *testing.T) {
+	cases := []struct {
+		desc               string
+		driverVersion      string
+		minDriverVersion   string
+		expectedCompatible bool
+		expectedErr        bool
+	}{
+		{
+			desc:               "min driver version not set",
+			driverVersion:      "v0.0.13",
+			expectedCompatible: true,
+		},
+		{
+			desc:               "driver version is not semver",
+			driverVersion:      "dev",
+			minDriverVersion:   "0.0.13",
+			expectedCompatible: true,
+		},
+		{
+			desc:             "invalid min driver version",
+			driverVersion:    "v0.0.13",
+			minDriverVersion: ".13",
+			expectedErr:      true,
+		},
+		{
+			desc:               "driver version equal to min driver version",
+			driverVersion:      "v0.0.13",
+			minDriverVersion:   "v0.0.13",
+			expectedCompatible: true,
+		},
+		{
+			desc:               "driver version greater than min driver version",
+			driverVersion:      "v0.0.14",
+			minDriverVersion:   "0.0.13",
+			expectedCompatible: true,
+		},
+		{
+			desc:               "driver version lower than min driver version",
+			driverVersion:      "v0.0.13",
+			minDriverVersion:   "0.1.0",
+			expectedCompatible: false,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.desc, func(t *testing.T) {
+			compatible, err := IsDriverCompatible(tc.driverVersion, tc.minDriverVersion)
+			if tc.expectedErr && err == nil || !tc.expectedErr && err != nil {
+				t.Fatalf("expected err: %v, got: %+v", tc.expectedErr, err)
+			}
+			if compatible != tc.expectedCompatible {
+				t.Fatalf("expected compatible: %v, got: %v", tc.expectedCompatible, compatible)
+			}
+		})
+	}
+}
+
+func TestGetCachedProviderVersion(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ut")
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// the provider binary records every invocation in the calls file
+	provider := filepath.Join(dir, "provider1")
+	calls := filepath.Join(dir, "calls")
+	writeProvider := func(version string, modTime time.Time) {
+		script := fmt.Sprintf("#!/bin/sh\necho call >> %s\necho '{\"version\": \"%s\"}'\n", calls, version)
+		if err := ioutil.WriteFile(provider, []byte(script), 0755); err != nil {
+			t.Fatalf("expected err to be nil, got: %+v", err)
+		}
+		if err := os.Chtimes(provider, modTime, modTime); err != nil {
+			t.Fatalf("expected err to be nil, got: %+v", err)
+		}
+	}
+	getVersion := func(expectedVersion string, expectedCalls int) {
+		pv, err := getCachedProviderVersion(context.TODO(), sandbox.Config{}, provider)
+		if err != nil {
+			t.Fatalf("expected err to be nil, got: %+v", err)
+		}
+		if pv.Version != expectedVersion {
+			t.Errorf("expected version: %s, got: %s", expectedVersion, pv.Version)
+		}
+		content, err := ioutil.ReadFile(calls)
+		if err != nil {
+			t.Fatalf("expected err to be nil, got: %+v", err)
+		}
+		if n := strings.Count(string(content), "call"); n != expectedCalls {
+			t.Errorf("expected provider to be called %d times, got: %d", expectedCalls, n)
+		}
+	}
+
+	modTime := time.Now().Add(-time.Hour)
+	writeProvider("0.0.1", modTime)
+	getVersion("0.0.1", 1)
+	// the version is cached while the provider binary doesn't change
+	getVersion("0.0.1", 1)
+
+	// the cached version is dropped when the provider binary changes
+	writeProvider("0.0.2", modTime.Add(time.Minute))
+	getVersion("0.0.2", 2)
+
+	// the cached version expires after the cache ttl
+	providerVersionCacheLock.Lock()
+	entry := providerVersionCache[provider]
+	entry.expiry = time.Now().Add(-time.Second)
+	providerVersionCache[provider] = entry
+	providerVersionCacheLock.Unlock()
+	getVersion("0.0.2", 3)
+}
+
+func TestGetProviderVersionSandbox(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ut")
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// the provider binary reports the driver environment variable as version
+	provider := filepath.Join(dir, "provider1")
+	script := "#!/bin/sh\necho \"{\\\"version\\\": \\\"$PROVIDER_TEST_VERSION\\\"}\"\n"
+	if err := ioutil.WriteFile(provider, []byte(script), 0755); err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	os.Setenv("PROVIDER_TEST_VERSION", "0.0.1")
+	defer os.Unsetenv("PROVIDER_TEST_VERSION")
+
+	pv, err := getProviderVersion(context.TODO(), sandbox.Config{}, provider)
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	if pv.Version != "0.0.1" {
+		t.Errorf("expected version: 0.0.1, got: %s", pv.Version)
+	}
+	// the provider runs without the driver environment in the minimal env sandbox
+	pv, err = getProviderVersion(context.TODO(), sandbox.Config{MinimalEnv: true}, provider)
+	if err != nil {
+		t.Fatalf("expected err to be nil, got: %+v", err)
+	}
+	if pv.Version != "" {
+		t.Errorf("expected empty version, got: %s", pv.Version)
+	}
+}
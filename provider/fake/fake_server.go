@@ -20,27 +20,58 @@ import (
 	"context"
 	"fmt"
 	"net"
+	"os"
+	"sync"
+	"time"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 
 	"sigs.k8s.io/secrets-store-csi-driver/provider/v1alpha1"
 )
 
+// defaultChunkSize is the default maximum size of the file chunks in the mount stream
+const defaultChunkSize = 1024
+
 type MockCSIProviderServer struct {
 	grpcServer *grpc.Server
 	listener   net.Listener
 	socketPath string
 	returnErr  error
 	errorCode  string
-	objects    []*v1alpha1.ObjectVersion
+	// errorReason and errorMessage are returned in the mount response error
+	errorReason  v1alpha1.ErrorReason
+	errorMessage string
+	objects      []*v1alpha1.ObjectVersion
+	files        []*v1alpha1.File
+	// minDriverVersion is the minimum driver version returned in the version response
+	minDriverVersion string
+	// unhealthy and healthMessage are returned in the health response
+	unhealthy     bool
+	healthMessage string
+	// capabilities are returned in the capabilities response. The Capabilities
+	// RPC is unimplemented if capabilities is nil.
+	capabilities []v1alpha1.Capability
+	// parametersSchema is returned in the capabilities response
+	parametersSchema string
+	// chunkSize is the maximum size of the file chunks in the mount stream
+	chunkSize int
+	// watchEvents are the changed object versions sent in the watch stream.
+	// The Watch RPC is unimplemented if watchEvents is nil.
+	watchEvents chan []*v1alpha1.ObjectVersion
+	// lock guards the attributes of the last mount request
+	lock       sync.Mutex
+	attributes string
 }
 
 // NewMocKCSIProviderServer returns a mock csi-provider grpc server
-func NewMocKCSIProviderServer(socketPath string) (*MockCSIProviderServer, error) {
-	server := grpc.NewServer()
+func NewMocKCSIProviderServer(socketPath string, opts ...grpc.ServerOption) (*MockCSIProviderServer, error) {
+	server := grpc.NewServer(opts...)
 	s := &MockCSIProviderServer{
 		grpcServer: server,
 		socketPath: socketPath,
+		chunkSize:  defaultChunkSize,
 	}
 	v1alpha1.RegisterCSIDriverProviderServer(server, s)
 	return s, nil
@@ -60,11 +91,84 @@ func (m *MockCSIProviderServer) SetObjects(objects map[string]string) {
 	m.objects = ov
 }
 
+// SetObjectsExpiry sets the expiry of the expected objects set with SetObjects
+func (m *MockCSIProviderServer) SetObjectsExpiry(expiry time.Time) {
+	for _, ov := range m.objects {
+		ov.ExpiryTime = expiry.Unix()
+	}
+}
+
+// SetFiles sets expected files name and content returned in the mount response
+func (m *MockCSIProviderServer) SetFiles(files map[string]string) {
+	var f []*v1alpha1.File
+	for k, v := range files {
+		f = append(f, &v1alpha1.File{Path: k, Contents: []byte(v)})
+	}
+	m.files = f
+}
+
+// SetMinDriverVersion sets the minimum driver version returned in the version response
+func (m *MockCSIProviderServer) SetMinDriverVersion(version string) {
+	m.minDriverVersion = version
+}
+
+// SetHealth sets the health and message returned in the health response
+func (m *MockCSIProviderServer) SetHealth(healthy bool, message string) {
+	m.unhealthy = !healthy
+	m.healthMessage = message
+}
+
+// SetCapabilities sets the capabilities returned in the capabilities response
+func (m *MockCSIProviderServer) SetCapabilities(capabilities ...v1alpha1.Capability) {
+	m.capabilities = append([]v1alpha1.Capability{}, capabilities...)
+}
+
+// SetParametersSchema sets the parameters schema returned in the capabilities response
+func (m *MockCSIProviderServer) SetParametersSchema(schema string) {
+	m.parametersSchema = schema
+	if m.capabilities == nil {
+		m.capabilities = []v1alpha1.Capability{}
+	}
+}
+
+// SetChunkSize sets the maximum size of the file chunks in the mount stream
+func (m *MockCSIProviderServer) SetChunkSize(size int) {
+	m.chunkSize = size
+}
+
+// SetWatch implements the Watch RPC. The watch stream is kept open until the
+// driver closes it.
+func (m *MockCSIProviderServer) SetWatch() {
+	m.watchEvents = make(chan []*v1alpha1.ObjectVersion, 10)
+}
+
+// SendWatchEvent sends the changed objects id and version in the watch stream
+func (m *MockCSIProviderServer) SendWatchEvent(objects map[string]string) {
+	var ov []*v1alpha1.ObjectVersion
+	for k, v := range objects {
+		ov = append(ov, &v1alpha1.ObjectVersion{Id: k, Version: v})
+	}
+	m.watchEvents <- ov
+}
+
+// Attributes returns the attributes of the last mount request
+func (m *MockCSIProviderServer) Attributes() string {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.attributes
+}
+
 // SetProviderErrorCode sets provider error code to return
 func (m *MockCSIProviderServer) SetProviderErrorCode(errorCode string) {
 	m.errorCode = errorCode
 }
 
+// SetProviderErrorReason sets the standardized provider error reason and message to return
+func (m *MockCSIProviderServer) SetProviderErrorReason(reason v1alpha1.ErrorReason, message string) {
+	m.errorReason = reason
+	m.errorMessage = message
+}
+
 func (m *MockCSIProviderServer) Start() error {
 	var err error
 	m.listener, err = net.Listen("unix", m.socketPath)
@@ -75,24 +179,28 @@ func (m *MockCSIProviderServer) Start() error {
 	return nil
 }
 
+// Stop stops the server and removes the socket
+func (m *MockCSIProviderServer) Stop() {
+	m.grpcServer.Stop()
+	os.Remove(m.socketPath)
+}
+
 // Mount implements provider csi-provider method
 func (m *MockCSIProviderServer) Mount(ctx context.Context, req *v1alpha1.MountRequest) (*v1alpha1.MountResponse, error) {
+	m.setAttributes(req)
 	if m.returnErr != nil {
 		return &v1alpha1.MountResponse{}, m.returnErr
 	}
-	if len(req.GetAttributes()) == 0 {
-		return nil, fmt.Errorf("missing attributes")
-	}
-	if len(req.GetTargetPath()) == 0 {
-		return nil, fmt.Errorf("missing target path")
-	}
-	if len(req.GetPermission()) == 0 {
-		return nil, fmt.Errorf("missing permissions")
+	if err := validateMountRequest(req); err != nil {
+		return nil, err
 	}
 	return &v1alpha1.MountResponse{
 		ObjectVersion: m.objects,
+		Files:         m.files,
 		Error: &v1alpha1.Error{
-			Code: m.errorCode,
+			Code:    m.errorCode,
+			Reason:  m.errorReason,
+			Message: m.errorMessage,
 		},
 	}, nil
 }
@@ -100,8 +208,110 @@ func (m *MockCSIProviderServer) Mount(ctx context.Context, req *v1alpha1.MountRe
 // Version implements provider csi-provider method
 func (m *MockCSIProviderServer) Version(ctx context.Context, req *v1alpha1.VersionRequest) (*v1alpha1.VersionResponse, error) {
 	return &v1alpha1.VersionResponse{
-		Version:        "v1alpha1",
-		RuntimeName:    "fakeprovider",
-		RuntimeVersion: "0.0.10",
+		Version:          "v1alpha1",
+		RuntimeName:      "fakeprovider",
+		RuntimeVersion:   "0.0.10",
+		MinDriverVersion: m.minDriverVersion,
 	}, nil
 }
+
+// Health implements provider csi-provider method
+func (m *MockCSIProviderServer) Health(ctx context.Context, req *v1alpha1.HealthRequest) (*v1alpha1.HealthResponse, error) {
+	return &v1alpha1.HealthResponse{
+		Healthy: !m.unhealthy,
+		Message: m.healthMessage,
+	}, nil
+}
+
+// Capabilities implements provider csi-provider method
+func (m *MockCSIProviderServer) Capabilities(ctx context.Context, req *v1alpha1.CapabilitiesRequest) (*v1alpha1.CapabilitiesResponse, error) {
+	if m.capabilities == nil {
+		return nil, status.Errorf(codes.Unimplemented, "method Capabilities not implemented")
+	}
+	return &v1alpha1.CapabilitiesResponse{
+		Capabilities:     m.capabilities,
+		ParametersSchema: m.parametersSchema,
+	}, nil
+}
+
+// MountStream implements provider csi-provider method
+func (m *MockCSIProviderServer) MountStream(req *v1alpha1.MountRequest, stream v1alpha1.CSIDriverProvider_MountStreamServer) error {
+	m.setAttributes(req)
+	if m.returnErr != nil {
+		return m.returnErr
+	}
+	if err := validateMountRequest(req); err != nil {
+		return err
+	}
+	if len(m.errorCode) > 0 || m.errorReason != v1alpha1.ErrorReason_UNSPECIFIED {
+		return stream.Send(&v1alpha1.MountStreamResponse{
+			Error: &v1alpha1.Error{
+				Code:    m.errorCode,
+				Reason:  m.errorReason,
+				Message: m.errorMessage,
+			},
+		})
+	}
+	if err := stream.Send(&v1alpha1.MountStreamResponse{ObjectVersion: m.objects}); err != nil {
+		return err
+	}
+	for _, file := range m.files {
+		for offset := 0; offset == 0 || offset < len(file.Contents); offset += m.chunkSize {
+			end := offset + m.chunkSize
+			if end > len(file.Contents) {
+				end = len(file.Contents)
+			}
+			chunk := &v1alpha1.FileChunk{
+				Path:     file.Path,
+				Mode:     file.Mode,
+				Offset:   int64(offset),
+				Contents: file.Contents[offset:end],
+			}
+			if err := stream.Send(&v1alpha1.MountStreamResponse{Chunks: []*v1alpha1.FileChunk{chunk}}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Watch implements provider csi-provider method
+func (m *MockCSIProviderServer) Watch(req *v1alpha1.WatchRequest, stream v1alpha1.CSIDriverProvider_WatchServer) error {
+	if m.watchEvents == nil {
+		return status.Errorf(codes.Unimplemented, "method Watch not implemented")
+	}
+	if err := validateMountRequest(req.GetMountRequest()); err != nil {
+		return err
+	}
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case ov := <-m.watchEvents:
+			if err := stream.Send(&v1alpha1.WatchResponse{ObjectVersion: ov}); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// setAttributes records the attributes of the mount request
+func (m *MockCSIProviderServer) setAttributes(req *v1alpha1.MountRequest) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.attributes = req.GetAttributes()
+}
+
+// validateMountRequest validates the required fields are set in the mount request
+func validateMountRequest(req *v1alpha1.MountRequest) error {
+	if len(req.GetAttributes()) == 0 {
+		return fmt.Errorf("missing attributes")
+	}
+	if len(req.GetTargetPath()) == 0 {
+		return fmt.Errorf("missing target path")
+	}
+	if len(req.GetPermission()) == 0 {
+		return fmt.Errorf("missing permissions")
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fake
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"sigs.k8s.io/secrets-store-csi-driver/pkg/providersdk"
+	"sigs.k8s.io/secrets-store-csi-driver/provider/v1alpha1"
+)
+
+const (
+	// objectsParameter is the comma separated list of object names to mount
+	objectsParameter = "objects"
+	// versionParameter is the version of the mounted objects
+	versionParameter = "version"
+)
+
+// Provider is a provider that serves deterministic secrets over the provider
+// grpc interface for e2e tests and local development without the credentials
+// of an external secrets store. The contents of an object only depend on the
+// object name and version, e.g. the secret provider class parameters
+//
+//	parameters:
+//	  objects: "secret1,secret2"
+//	  version: "v2"
+//
+// mount the files secret1 and secret2 with the contents secret1-v2 and secret2-v2.
+// If the version isn't set, the version is v1 and incremented every rotation
+// interval so rotation of the mounted contents can be tested.
+type Provider struct {
+	server           *providersdk.Server
+	rotationInterval time.Duration
+	start            time.Time
+	now              func() time.Time
+}
+
+// NewProvider returns a fake provider that serves on the unix domain socket
+func NewProvider(socketPath string, rotationInterval time.Duration) *Provider {
+	p := &Provider{
+		rotationInterval: rotationInterval,
+		start:            time.Now(),
+		now:              time.Now,
+	}
+	p.server = providersdk.NewServer(socketPath, providersdk.Config{
+		Name:         "fake-provider",
+		Version:      "0.0.1",
+		Capabilities: []v1alpha1.Capability{v1alpha1.Capability_OBJECT_VERSIONING},
+	}, p)
+	return p
+}
+
+// Start starts serving the provider grpc interface
+func (p *Provider) Start() error {
+	return p.server.Start()
+}
+
+// Stop stops serving and removes the socket
+func (p *Provider) Stop() {
+	p.server.Stop()
+}
+
+// Mount implements the providersdk.Provider interface
+func (p *Provider) Mount(ctx context.Context, req *providersdk.MountRequest) (*providersdk.MountResponse, error) {
+	var objects []string
+	for _, object := range strings.Split(req.Parameters[objectsParameter], ",") {
+		if object = strings.TrimSpace(object); len(object) > 0 {
+			objects = append(objects, object)
+		}
+	}
+	if len(objects) == 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "%s parameter is not set", objectsParameter)
+	}
+
+	version := req.Parameters[versionParameter]
+	if len(version) == 0 {
+		version = p.currentVersion()
+	}
+
+	resp := providersdk.NewMountResponse()
+	for _, object := range objects {
+		if err := resp.AddObject(fmt.Sprintf("secret/%s", object), version, object, req.Permission, []byte(fmt.Sprintf("%s-%s", object, version))); err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+	}
+	return resp, nil
+}
+
+// currentVersion returns the version of the objects, incremented every
+// rotation interval since the provider started
+func (p *Provider) currentVersion() string {
+	version := 1
+	if p.rotationInterval > 0 {
+		version += int(p.now().Sub(p.start) / p.rotationInterval)
+	}
+	return fmt.Sprintf("v%d", version)
+}
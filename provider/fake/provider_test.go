@@ -0,0 +1,110 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fake
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"sigs.k8s.io/secrets-store-csi-driver/provider/v1alpha1"
+)
+
+func TestProviderMount(t *testing.T) {
+	cases := []struct {
+		name             string
+		attributes       string
+		elapsed          time.Duration
+		rotationInterval time.Duration
+		expectedFiles    map[string]string
+		expectedVersions map[string]string
+		expectedErr      bool
+	}{
+		{
+			name:             "objects mounted with default version",
+			attributes:       `{"objects": "secret1, secret2"}`,
+			expectedFiles:    map[string]string{"secret1": "secret1-v1", "secret2": "secret2-v1"},
+			expectedVersions: map[string]string{"secret/secret1": "v1", "secret/secret2": "v1"},
+		},
+		{
+			name:             "objects mounted with version parameter",
+			attributes:       `{"objects": "secret1", "version": "v5"}`,
+			elapsed:          time.Hour,
+			rotationInterval: time.Minute,
+			expectedFiles:    map[string]string{"secret1": "secret1-v5"},
+			expectedVersions: map[string]string{"secret/secret1": "v5"},
+		},
+		{
+			name:             "version incremented every rotation interval",
+			attributes:       `{"objects": "secret1"}`,
+			elapsed:          150 * time.Second,
+			rotationInterval: time.Minute,
+			expectedFiles:    map[string]string{"secret1": "secret1-v3"},
+			expectedVersions: map[string]string{"secret/secret1": "v3"},
+		},
+		{
+			name:        "objects not set",
+			attributes:  `{"version": "v1"}`,
+			expectedErr: true,
+		},
+		{
+			name:        "invalid attributes",
+			attributes:  `objects`,
+			expectedErr: true,
+		},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			p := NewProvider("", test.rotationInterval)
+			p.now = func() time.Time { return p.start.Add(test.elapsed) }
+
+			resp, err := p.server.Mount(context.TODO(), &v1alpha1.MountRequest{
+				Attributes: test.attributes,
+				TargetPath: "/var/lib/kubelet/pods/d448c6a2-cda8-42e3-84fb-3cf75faa8399/volumes/kubernetes.io~csi/secrets-store-inline/mount",
+				Permission: "420",
+			})
+			if test.expectedErr {
+				if err == nil {
+					t.Fatalf("expected err to be not nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected err to be nil, got: %+v", err)
+			}
+			files := make(map[string]string)
+			for _, file := range resp.GetFiles() {
+				if file.GetMode() != 0644 {
+					t.Errorf("expected file mode: 0644, got: %o", file.GetMode())
+				}
+				files[file.GetPath()] = string(file.GetContents())
+			}
+			if !reflect.DeepEqual(files, test.expectedFiles) {
+				t.Errorf("expected files: %v, got: %v", test.expectedFiles, files)
+			}
+			versions := make(map[string]string)
+			for _, ov := range resp.GetObjectVersion() {
+				versions[ov.GetId()] = ov.GetVersion()
+			}
+			if !reflect.DeepEqual(versions, test.expectedVersions) {
+				t.Errorf("expected object versions: %v, got: %v", test.expectedVersions, versions)
+			}
+		})
+	}
+}
@@ -0,0 +1,57 @@
+#!/usr/bin/env bats
+
+load helpers
+
+BATS_TESTS_DIR=test/bats/tests/fake
+WAIT_TIME=120
+SLEEP_TIME=1
+NAMESPACE=default
+
+export CONTAINER_IMAGE=nginx
+export FAKE_PROVIDER_IMAGE=${FAKE_PROVIDER_IMAGE:-"e2e/secrets-store-csi-fake-provider:latest"}
+export ROTATION_INTERVAL=${ROTATION_INTERVAL:-"0s"}
+
+@test "install fake provider" {
+  envsubst < $BATS_TESTS_DIR/fake-provider.yaml | kubectl apply --namespace $NAMESPACE -f -
+
+  cmd="kubectl wait --for=condition=Ready --timeout=60s pod -l app=csi-secrets-store-provider-fake --namespace $NAMESPACE"
+  wait_for_process $WAIT_TIME $SLEEP_TIME "$cmd"
+
+  FAKE_PROVIDER_POD=$(kubectl get pod --namespace $NAMESPACE -l app=csi-secrets-store-provider-fake -o jsonpath="{.items[0].metadata.name}")
+
+  run kubectl get pod/$FAKE_PROVIDER_POD --namespace $NAMESPACE
+  assert_success
+}
+
+@test "secretproviderclasses crd is established" {
+  cmd="kubectl wait --for condition=established --timeout=60s crd/secretproviderclasses.secrets-store.csi.x-k8s.io"
+  wait_for_process $WAIT_TIME $SLEEP_TIME "$cmd"
+
+  run kubectl get crd/secretproviderclasses.secrets-store.csi.x-k8s.io
+  assert_success
+}
+
+@test "deploy fake secretproviderclass crd" {
+  envsubst < $BATS_TESTS_DIR/fake_v1alpha1_secretproviderclass.yaml | kubectl apply -f -
+
+  cmd="kubectl get secretproviderclasses.secrets-store.csi.x-k8s.io/fake-foo -o yaml | grep fake"
+  wait_for_process $WAIT_TIME $SLEEP_TIME "$cmd"
+}
+
+@test "CSI inline volume test with pod portability" {
+  envsubst < $BATS_TESTS_DIR/nginx-pod-fake-inline-volume-secretproviderclass.yaml | kubectl apply -f -
+
+  cmd="kubectl wait --for=condition=Ready --timeout=60s pod/nginx-secrets-store-inline"
+  wait_for_process $WAIT_TIME $SLEEP_TIME "$cmd"
+
+  run kubectl get pod/nginx-secrets-store-inline
+  assert_success
+}
+
+@test "CSI inline volume test with pod portability - read fake secret from pod" {
+  result=$(kubectl exec -it nginx-secrets-store-inline -- cat /mnt/secrets-store/foo)
+  [[ "$result" == "foo-v1" ]]
+
+  result=$(kubectl exec -it nginx-secrets-store-inline -- cat /mnt/secrets-store/bar)
+  [[ "$result" == "bar-v1" ]]
+}